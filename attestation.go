@@ -0,0 +1,163 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/attest"
+	"github.com/drone/drone-kaniko/pkg/contexthash"
+	"github.com/drone/drone-kaniko/pkg/diagnostics"
+	"github.com/drone/drone-kaniko/pkg/registry"
+)
+
+// attestationEnv lists the environment variables identifying the pipeline
+// recorded in the attestation.
+var attestationEnv = []string{
+	"DRONE_REPO",
+	"DRONE_COMMIT_SHA",
+	"DRONE_COMMIT_REF",
+	"DRONE_BUILD_NUMBER",
+	"DRONE_BUILD_LINK",
+	"DRONE_STAGE_NAME",
+	"DRONE_STEP_NAME",
+}
+
+// writeAttestation records the resolved build inputs as in-toto link
+// metadata in the attestation file, and pushes it as a referrer of the
+// image when enabled, returning the reference of the pushed attestation.
+func (p Plugin) writeAttestation(ctx context.Context, remote bool) []artifact.Reference {
+	if p.Build.AttestationFile == "" && !p.Build.PushAttestation {
+		return nil
+	}
+	statement := p.attestation(ctx, remote)
+
+	if p.Build.AttestationFile != "" {
+		if err := attest.WriteFile(p.Build.AttestationFile, statement); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write attestation at path: %s with error: %s\n", p.Build.AttestationFile, err)
+		}
+	}
+
+	if !p.Build.PushAttestation || p.Build.NoPush || len(statement.Subject) == 0 {
+		return nil
+	}
+	content, err := json.Marshal(statement)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode attestation: %s\n", err)
+		return nil
+	}
+	ref, err := registry.ParseReference(p.Build.Repo + "@" + readDigest(p.Build.DigestFile))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to push attestation: %s\n", err)
+		return nil
+	}
+	digest, err := p.Build.registryClient().PushReferrer(ctx, ref, attest.MediaType, content, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to push attestation: %s\n", err)
+		return nil
+	}
+	fmt.Fprintf(os.Stdout, "Pushed attestation %s@%s\n", p.Build.Repo, digest)
+	return []artifact.Reference{{Type: "attestation", MediaType: attest.MediaType, Image: p.Build.Repo, Digest: digest}}
+}
+
+// attestation returns the statement describing the build inputs: the
+// Dockerfile, the build context and the base images, with the build args
+// and the pipeline and captured variables in the environment. Sensitive
+// build args are hashed.
+func (p Plugin) attestation(ctx context.Context, remote bool) attest.Statement {
+	var subjects []attest.Subject
+	if digest := attest.ParseDigest(readDigest(p.Build.DigestFile)); digest != nil {
+		subjects = append(subjects, attest.Subject{Name: p.Build.Repo, Digest: digest})
+	}
+
+	var materials []attest.Material
+	var dockerfile []byte
+	if remote {
+		materials = append(materials, attest.Material{Name: "context", URI: redactURL(p.Build.Context)})
+	} else {
+		var err error
+		if dockerfile, err = ioutil.ReadFile(p.Build.Dockerfile); err == nil {
+			materials = append(materials, attest.Material{Name: "dockerfile", URI: p.Build.Dockerfile, Digest: attest.SHA256(dockerfile)})
+		}
+		if hash, err := contexthash.Context(p.Build.contextRoot(), p.Build.dockerignore()); err == nil {
+			materials = append(materials, attest.Material{Name: "context", URI: p.Build.contextRoot(), Digest: attest.Digest{"sha256": hash}})
+		} else {
+			fmt.Fprintf(os.Stderr, "failed to hash the build context for the attestation: %s\n", err)
+		}
+	}
+
+	client := p.Build.registryClient()
+	for _, image := range attest.BaseImages(dockerfile, p.Build.Args) {
+		material := attest.Material{Name: "base-image", URI: image}
+		if ref, err := registry.ParseReference(image); err == nil {
+			if ref.Digest != "" {
+				material.Digest = attest.ParseDigest(ref.Digest)
+			} else if desc, err := client.Head(ctx, ref); err == nil {
+				material.Digest = attest.ParseDigest(desc.Digest)
+			} else {
+				fmt.Fprintf(os.Stderr, "failed to resolve base image %s for the attestation: %s\n", image, err)
+			}
+		}
+		materials = append(materials, material)
+	}
+
+	var args []string
+	for _, arg := range p.Build.Args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) == 2 && diagnostics.IsSensitive(parts[0]) {
+			arg = parts[0] + "=" + attest.HashSecret(parts[1])
+		}
+		args = append(args, arg)
+	}
+	environment := map[string]interface{}{
+		"builder":   p.Build.builder(),
+		"buildArgs": args,
+	}
+	if p.Build.Target != "" {
+		environment["target"] = p.Build.Target
+	}
+	if p.Build.Platform != "" {
+		environment["platform"] = p.Build.Platform
+	}
+	for _, name := range attestationEnv {
+		if value := os.Getenv(name); value != "" {
+			environment[name] = value
+		}
+	}
+	for _, env := range p.Build.capturedEnv {
+		environment[env[0]] = env[1]
+	}
+
+	return attest.NewStatement(subjects, attest.Link{
+		Name:        "build",
+		Materials:   materials,
+		Environment: environment,
+	})
+}
+
+// readDigest returns the digest in the digest file, or an empty string.
+func readDigest(digestFile string) string {
+	if digestFile == "" {
+		return ""
+	}
+	content, err := ioutil.ReadFile(digestFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// redactURL removes credentials from a remote context URL.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,69 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/git"
+)
+
+// label-schema labels set by AutoLabels.
+const (
+	labelSchemaVersion = "org.label-schema.schema-version"
+	labelVcsRef        = "org.label-schema.vcs-ref"
+	labelVcsAuthor     = "org.label-schema.vcs-author"
+	labelVcsMessage    = "org.label-schema.vcs-message"
+	labelVcsBranch     = "org.label-schema.vcs-branch"
+	labelVcsTag        = "org.label-schema.vcs-tag"
+)
+
+// autoLabels returns label-schema labels describing the built commit, and
+// labels recording the plugin and executor versions. The Drone variables are
+// used when set, the rest is read from the git checkout of the build context.
+// Labels set explicitly are not overridden.
+func (b Build) autoLabels() []string {
+	meta := git.Metadata{
+		Commit:  b.DroneCommitSha,
+		Author:  b.DroneCommitAuthor,
+		Message: firstLine(b.DroneCommitMessage),
+		Branch:  b.DroneCommitBranch,
+		Tag:     b.DroneTag,
+	}
+	if meta.Commit == "" {
+		dir := b.Context
+		if dir == "" || isRemoteContext(dir) {
+			dir = "."
+		}
+		local, err := git.ReadMetadata(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read git metadata for auto labels: %s\n", err)
+		} else {
+			meta = local
+		}
+	}
+
+	explicit := map[string]bool{}
+	for _, label := range b.Labels {
+		explicit[strings.SplitN(label, "=", 2)[0]] = true
+	}
+	var labels []string
+	for _, label := range append([][2]string{
+		{labelSchemaVersion, "1.0"},
+		{labelVcsRef, meta.Commit},
+		{labelVcsAuthor, meta.Author},
+		{labelVcsMessage, meta.Message},
+		{labelVcsBranch, meta.Branch},
+		{labelVcsTag, meta.Tag},
+	}, b.versionLabels()...) {
+		if label[1] != "" && !explicit[label[0]] {
+			labels = append(labels, label[0]+"="+label[1])
+		}
+	}
+	return labels
+}
+
+// firstLine returns the first line of s.
+func firstLine(s string) string {
+	return strings.TrimSpace(strings.SplitN(s, "\n", 2)[0])
+}
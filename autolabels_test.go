@@ -0,0 +1,60 @@
+package kaniko
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuild_autoLabels(t *testing.T) {
+	b := Build{
+		DroneCommitSha:     "abc123",
+		DroneCommitAuthor:  "octocat",
+		DroneCommitMessage: "Fix the build\n\nLonger description",
+		DroneCommitBranch:  "main",
+		Labels:             []string{"org.label-schema.vcs-author=someone"},
+	}
+	want := []string{
+		"org.label-schema.schema-version=1.0",
+		"org.label-schema.vcs-ref=abc123",
+		"org.label-schema.vcs-message=Fix the build",
+		"org.label-schema.vcs-branch=main",
+	}
+	if diff := cmp.Diff(want, b.autoLabels()); diff != "" {
+		t.Errorf("unexpected labels (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuild_autoLabelsFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "feature"},
+		{"-c", "user.name=octocat", "-c", "user.email=octocat@example.com", "commit", "-q", "--allow-empty", "-m", "Initial commit"},
+		{"tag", "v1.0.0"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s", args, out)
+		}
+	}
+
+	labels := Build{Context: dir}.autoLabels()
+	if len(labels) != 6 {
+		t.Fatalf("expected 6 labels, got %v", labels)
+	}
+	for i, want := range []string{
+		"org.label-schema.vcs-author=octocat",
+		"org.label-schema.vcs-message=Initial commit",
+		"org.label-schema.vcs-branch=feature",
+		"org.label-schema.vcs-tag=v1.0.0",
+	} {
+		if labels[i+2] != want {
+			t.Errorf("expected label %s, got %s", want, labels[i+2])
+		}
+	}
+}
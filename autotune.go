@@ -0,0 +1,53 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+	"github.com/drone/drone-kaniko/pkg/units"
+)
+
+// memoryLimit is replaced in tests.
+var memoryLimit = sysinfo.MemoryLimit
+
+// Memory limits below which the auto tuner trades build speed for a
+// smaller kaniko memory footprint.
+const (
+	noCompressedCachingBelow = 4 << 30
+	redoSnapshotBelow        = 2 << 30
+	singleSnapshotBelow      = 1 << 30
+)
+
+// autoTune picks kaniko settings known to reduce memory usage based on the
+// cgroup memory limit of the runner. Settings changed from their defaults
+// are left untouched. It returns the decisions made.
+func (b *Build) autoTune() []string {
+	limit, err := memoryLimit()
+	if err != nil {
+		return []string{fmt.Sprintf("no memory limit detected (%s), keeping the default settings", err)}
+	}
+
+	decisions := []string{fmt.Sprintf("memory limit is %s", units.FormatSize(limit))}
+	if limit < noCompressedCachingBelow && !b.DisableCompressedCaching {
+		b.DisableCompressedCaching = true
+		decisions = append(decisions, "disabled compressed caching")
+	}
+	if limit < redoSnapshotBelow && b.SnapshotMode == "" {
+		b.SnapshotMode = "redo"
+		decisions = append(decisions, "using the redo snapshot mode")
+	}
+	// a single snapshot squashes the layers, which defeats layer caching
+	if limit < singleSnapshotBelow && !b.SingleSnapshot && !b.EnableCache {
+		b.SingleSnapshot = true
+		decisions = append(decisions, "taking a single snapshot")
+	}
+	return decisions
+}
+
+// logAutoTune runs the auto tuner and logs its decisions.
+func (b *Build) logAutoTune() {
+	for _, decision := range b.autoTune() {
+		fmt.Fprintf(os.Stdout, "Auto tune: %s\n", decision)
+	}
+}
@@ -0,0 +1,64 @@
+package kaniko
+
+import (
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+func TestBuild_autoTune(t *testing.T) {
+	defer func() { memoryLimit = sysinfo.MemoryLimit }()
+
+	tests := []struct {
+		name  string
+		limit int64
+		err   error
+		build Build
+		want  Build
+	}{
+		{
+			name:  "no limit",
+			err:   sysinfo.ErrNoLimit,
+			build: Build{},
+			want:  Build{},
+		},
+		{
+			name:  "large limit",
+			limit: 8 << 30,
+			build: Build{},
+			want:  Build{},
+		},
+		{
+			name:  "medium limit",
+			limit: 3 << 30,
+			build: Build{},
+			want:  Build{DisableCompressedCaching: true},
+		},
+		{
+			name:  "small limit",
+			limit: 512 << 20,
+			build: Build{},
+			want:  Build{DisableCompressedCaching: true, SnapshotMode: "redo", SingleSnapshot: true},
+		},
+		{
+			name:  "small limit with cache and snapshot mode",
+			limit: 512 << 20,
+			build: Build{EnableCache: true, SnapshotMode: "time"},
+			want:  Build{DisableCompressedCaching: true, EnableCache: true, SnapshotMode: "time"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			memoryLimit = func() (int64, error) { return test.limit, test.err }
+			build := test.build
+			if decisions := build.autoTune(); len(decisions) == 0 {
+				t.Errorf("expected the decisions to be reported")
+			}
+			if build.DisableCompressedCaching != test.want.DisableCompressedCaching ||
+				build.SnapshotMode != test.want.SnapshotMode ||
+				build.SingleSnapshot != test.want.SingleSnapshot {
+				t.Errorf("expected %+v, got %+v", test.want, build)
+			}
+		})
+	}
+}
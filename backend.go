@@ -0,0 +1,152 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerengine"
+	"github.com/drone/drone-kaniko/pkg/kube"
+)
+
+// Execution backends running the kaniko executor.
+const (
+	BackendLocal      = "local"      // Executor in the plugin image
+	BackendDocker     = "docker"     // Executor image in a sibling container
+	BackendKubernetes = "kubernetes" // Executor image in a Kubernetes Job
+)
+
+// hostOS is the operating system the plugin runs on.
+var hostOS = runtime.GOOS
+
+// defaultExecutorImage is the executor image the plugin images are built on.
+const defaultExecutorImage = "gcr.io/kaniko-project/executor:v1.9.1"
+
+// Backend selects where the kaniko executor runs.
+type Backend struct {
+	Name          string // Backend name, defaults to local
+	ExecutorImage string // Executor image run by the docker backend
+	DockerHost    string // Docker Engine address, defaults to the local socket
+	Container     string // Container whose volumes the executor shares, defaults to the hostname
+
+	KubeAPIServer      string   // Kubernetes API server, defaults to the in-cluster address
+	KubeToken          string   // Kubernetes bearer token, defaults to the service account token
+	KubeNamespace      string   // Namespace of the job, defaults to the namespace of the service account
+	KubeServiceAccount string   // Service account of the job pod
+	KubeNodeSelector   []string // Node labels of the job pod in the form key=value
+	KubeContextVolume  string   // Persistent volume claim holding the workspace
+
+	ContextBucket string // S3 or GCS bucket the local build context is uploaded to
+}
+
+// executorRunner returns the runner of the kaniko executor: the custom
+// runner when set, otherwise the runner of the backend.
+func (p Plugin) executorRunner() (Runner, error) {
+	if p.Runner != nil {
+		return p.Runner, nil
+	}
+	if p.Build.builder() != BuilderKaniko && p.Backend.Name != "" && p.Backend.Name != BackendLocal {
+		return nil, fmt.Errorf("the %s builder only runs with the %s backend", p.Build.builder(), BackendLocal)
+	}
+	switch p.Backend.Name {
+	case "", BackendLocal:
+		if hostOS == "windows" {
+			// the executor is only built for linux, also when building windows images
+			return nil, fmt.Errorf("the kaniko executor does not run on windows, use the %s backend or the %s backend with a linux docker host", BackendKubernetes, BackendDocker)
+		}
+		return ExecRunner{}, nil
+	case BackendDocker:
+		return p.dockerRunner()
+	case BackendKubernetes:
+		return p.kubeRunner()
+	default:
+		return nil, fmt.Errorf("unknown backend %q, expected %s, %s or %s", p.Backend.Name, BackendLocal, BackendDocker, BackendKubernetes)
+	}
+}
+
+// dockerRunner runs the executor in a sibling container sharing the volumes
+// and network of the plugin container. The docker config and the files the
+// plugin stages in the kaniko directory are copied into it, as they are not
+// on a shared volume.
+func (p Plugin) dockerRunner() (Runner, error) {
+	client, err := dockerengine.NewClient(p.Backend.DockerHost)
+	if err != nil {
+		return nil, err
+	}
+	image := p.Backend.ExecutorImage
+	if image == "" {
+		image = defaultExecutorImage
+	}
+	container := p.Backend.Container
+	if container == "" {
+		// docker sets the hostname to the short container id
+		if container, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	configDir := filepath.Dir(p.Build.dockerConfigPath())
+	return dockerengine.Runner{
+		Client:         client,
+		Image:          image,
+		Container:      container,
+		Env:            []string{"DOCKER_CONFIG=" + configDir},
+		Upload:         []string{configDir},
+		UploadPrefixes: []string{p.Build.kanikoDir()},
+	}, nil
+}
+
+// kubeRunner runs the executor as a Kubernetes Job, for example on a separate
+// node pool. The docker config is passed in a Secret and the files staged in
+// the kaniko directory in a ConfigMap; the build context must be remote or in
+// the workspace on the context volume.
+func (p Plugin) kubeRunner() (Runner, error) {
+	client, err := kube.InClusterClient(p.Backend.KubeAPIServer, p.Backend.KubeToken, p.Backend.KubeNamespace)
+	if err != nil {
+		return nil, err
+	}
+	image := p.Backend.ExecutorImage
+	if image == "" {
+		image = defaultExecutorImage
+	}
+	nodeSelector := map[string]string{}
+	for _, label := range p.Backend.KubeNodeSelector {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid node selector %q, expected key=value", label)
+		}
+		nodeSelector[parts[0]] = parts[1]
+	}
+	workspace, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return kube.Runner{
+		Client:          client,
+		Image:           image,
+		ServiceAccount:  p.Backend.KubeServiceAccount,
+		NodeSelector:    nodeSelector,
+		ContextVolume:   p.Backend.KubeContextVolume,
+		ContextMount:    workspace,
+		DockerConfigDir: filepath.Dir(p.Build.dockerConfigPath()),
+		FilePrefixes:    []string{p.Build.kanikoDir()},
+	}, nil
+}
+
+// withSecretEnv returns the executor runner passing env, the values of the
+// secret build args, to the executor. Remote runners only forward variables
+// differing from the environment of the plugin, which would drop a secret
+// read from a variable of the same name, so they get them explicitly, on
+// Kubernetes in a Secret.
+func withSecretEnv(r Runner, env []string) Runner {
+	switch r := r.(type) {
+	case dockerengine.Runner:
+		r.SecretEnv = env
+		return r
+	case kube.Runner:
+		r.SecretEnv = env
+		return r
+	}
+	return r
+}
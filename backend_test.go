@@ -0,0 +1,80 @@
+package kaniko
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/dockerengine"
+	"github.com/drone/drone-kaniko/pkg/kube"
+)
+
+func TestPlugin_executorRunner(t *testing.T) {
+	if _, err := (Plugin{Backend: Backend{Name: "podman"}}).executorRunner(); err == nil {
+		t.Errorf("expected error for an unknown backend")
+	}
+
+	runner, err := (Plugin{}).executorRunner()
+	if _, ok := runner.(ExecRunner); err != nil || !ok {
+		t.Errorf("expected the local runner by default, got %T %v", runner, err)
+	}
+
+	hostOS = "windows"
+	if _, err := (Plugin{}).executorRunner(); err == nil {
+		t.Errorf("expected error for the local backend on windows")
+	}
+	hostOS = runtime.GOOS
+
+	custom := &fakeRunner{}
+	if runner, _ := (Plugin{Runner: custom, Backend: Backend{Name: BackendDocker}}).executorRunner(); runner != custom {
+		t.Errorf("expected the custom runner to take precedence")
+	}
+
+	p := Plugin{
+		Build:   Build{KanikoDir: "/state", DockerConfigDir: "/state/.docker"},
+		Backend: Backend{Name: BackendDocker, Container: "plugin"},
+	}
+	runner, err = p.executorRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	docker, ok := runner.(dockerengine.Runner)
+	if !ok {
+		t.Fatalf("expected the docker runner, got %T", runner)
+	}
+	if docker.Image != defaultExecutorImage || docker.Container != "plugin" {
+		t.Errorf("unexpected docker runner %+v", docker)
+	}
+	if len(docker.Upload) != 1 || docker.Upload[0] != "/state/.docker" || docker.Env[0] != "DOCKER_CONFIG=/state/.docker" {
+		t.Errorf("expected the docker config to be copied into the container, got %+v", docker)
+	}
+	if len(docker.UploadPrefixes) != 1 || docker.UploadPrefixes[0] != "/state" {
+		t.Errorf("expected files staged in the kaniko directory to be copied, got %v", docker.UploadPrefixes)
+	}
+
+	p = Plugin{
+		Build: Build{KanikoDir: "/state"},
+		Backend: Backend{
+			Name:             BackendKubernetes,
+			KubeAPIServer:    "https://kubernetes.example.com",
+			KubeToken:        "token",
+			KubeNamespace:    "ci",
+			KubeNodeSelector: []string{"pool=builds"},
+		},
+	}
+	runner, err = p.executorRunner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, ok := runner.(kube.Runner)
+	if !ok {
+		t.Fatalf("expected the kubernetes runner, got %T", runner)
+	}
+	if job.Client.Namespace != "ci" || job.NodeSelector["pool"] != "builds" || job.Image != defaultExecutorImage {
+		t.Errorf("unexpected kubernetes runner %+v", job)
+	}
+
+	p.Backend.KubeNodeSelector = []string{"pool"}
+	if _, err := p.executorRunner(); err == nil {
+		t.Errorf("expected error for an invalid node selector")
+	}
+}
@@ -0,0 +1,137 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+)
+
+// predefinedArgs are the build args available without being declared.
+var predefinedArgs = map[string]bool{
+	"HTTP_PROXY": true, "http_proxy": true,
+	"HTTPS_PROXY": true, "https_proxy": true,
+	"FTP_PROXY": true, "ftp_proxy": true,
+	"NO_PROXY": true, "no_proxy": true,
+	"ALL_PROXY": true, "all_proxy": true,
+}
+
+// platformArgs are set by the builder, so they need no default.
+var platformArgs = map[string]bool{
+	"TARGETPLATFORM": true, "TARGETOS": true, "TARGETARCH": true, "TARGETVARIANT": true,
+	"BUILDPLATFORM": true, "BUILDOS": true, "BUILDARCH": true, "BUILDVARIANT": true,
+}
+
+// proxyArgs are the dependency proxy env vars forwarded as build args by
+// AutoProxyArgs.
+var proxyArgs = []string{"GOPROXY", "NPM_CONFIG_REGISTRY", "PIP_INDEX_URL"}
+
+// autoProxyArgs returns the dependency proxy env vars that are set and
+// declared as args in the Dockerfile, as build args. Args already provided
+// are left unchanged.
+func (b Build) autoProxyArgs(remote bool) []string {
+	if remote {
+		return nil
+	}
+	d, err := dockerfile.ParseFile(b.Dockerfile)
+	if err != nil {
+		return nil
+	}
+	provided := argNames(b.Args)
+	var args []string
+	for _, name := range proxyArgs {
+		value := os.Getenv(name)
+		if value == "" || contains(provided, name) || !d.DeclaresArg(name) {
+			continue
+		}
+		args = append(args, name+"="+value)
+	}
+	return args
+}
+
+// argNames returns the names of the build args, in the NAME=value or NAME
+// form.
+func argNames(args []string) []string {
+	var names []string
+	for _, arg := range args {
+		names = append(names, strings.SplitN(arg, "=", 2)[0])
+	}
+	return names
+}
+
+// auditArgs returns the build args not declared in the Dockerfile, and the
+// declared args without a default that are not provided.
+func auditArgs(d *dockerfile.Dockerfile, provided []string) (undeclared, missing []string) {
+	declared := map[string]bool{}
+	defaults := map[string]bool{}
+	for _, arg := range d.MetaArgs {
+		declared[arg.Name] = true
+		defaults[arg.Name] = defaults[arg.Name] || arg.HasDefault
+	}
+	for _, stage := range d.Stages {
+		for _, arg := range stage.Args {
+			declared[arg.Name] = true
+		}
+	}
+
+	set := map[string]bool{}
+	for _, name := range provided {
+		set[name] = true
+		if !declared[name] && !predefinedArgs[name] && !contains(undeclared, name) {
+			undeclared = append(undeclared, name)
+		}
+	}
+
+	check := func(arg dockerfile.Arg) {
+		// stage args without a default inherit the default of the meta arg
+		if arg.HasDefault || defaults[arg.Name] || set[arg.Name] || platformArgs[arg.Name] || predefinedArgs[arg.Name] {
+			return
+		}
+		if !contains(missing, arg.Name) {
+			missing = append(missing, arg.Name)
+		}
+	}
+	for _, arg := range d.MetaArgs {
+		check(arg)
+	}
+	for _, stage := range d.Stages {
+		for _, arg := range stage.Args {
+			check(arg)
+		}
+	}
+	return undeclared, missing
+}
+
+// checkArgs warns about build args not declared in the Dockerfile and
+// declared args without a default that are not provided, failing the build
+// instead when StrictArgs is set.
+func (b Build) checkArgs(remote bool) error {
+	if remote {
+		return nil
+	}
+	d, err := dockerfile.ParseFile(b.Dockerfile)
+	if err != nil {
+		// reported by the executor
+		return nil
+	}
+	undeclared, missing := auditArgs(d, append(argNames(b.Args), argNames(b.SecretArgs)...))
+
+	var problems []string
+	if len(undeclared) > 0 {
+		problems = append(problems, fmt.Sprintf("build args not declared in %s: %s", b.Dockerfile, strings.Join(undeclared, ", ")))
+	}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("args declared in %s without a default are not provided: %s", b.Dockerfile, strings.Join(missing, ", ")))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if b.StrictArgs {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", problem)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package kaniko
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAuditArgs(t *testing.T) {
+	d, err := dockerfile.Parse(strings.NewReader(`ARG GO_VERSION=1.21
+ARG REGISTRY
+FROM $REGISTRY/golang:${GO_VERSION} AS build
+ARG GO_VERSION
+ARG TARGETARCH
+ARG VERSION
+ARG COMMIT=unknown
+FROM scratch
+ARG TOKEN
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	undeclared, missing := auditArgs(d, []string{"VERSION", "TYPO", "HTTP_PROXY", "TYPO"})
+	if diff := cmp.Diff([]string{"TYPO"}, undeclared); diff != "" {
+		t.Errorf("undeclared args mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"REGISTRY", "TOKEN"}, missing); diff != "" {
+		t.Errorf("missing args mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuild_checkArgs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM scratch\nARG VERSION\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Build{Dockerfile: path, Args: []string{"VERSION=1.0"}, StrictArgs: true}
+	if err := b.checkArgs(false); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	b.Args = []string{"VERSON=1.0"}
+	err := b.checkArgs(false)
+	if err == nil {
+		t.Fatal("expected strict args to fail")
+	}
+	for _, want := range []string{"not declared", "VERSON", "not provided", "VERSION"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	b.StrictArgs = false
+	if err := b.checkArgs(false); err != nil {
+		t.Errorf("expected only a warning, got %s", err)
+	}
+}
+
+func TestBuild_autoProxyArgs(t *testing.T) {
+	t.Setenv("GOPROXY", "https://proxy.example.com")
+	t.Setenv("NPM_CONFIG_REGISTRY", "https://npm.example.com")
+	t.Setenv("PIP_INDEX_URL", "https://pypi.example.com/simple")
+
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(path, []byte("FROM golang:1.22\nARG GOPROXY\nFROM node:20\nARG NPM_CONFIG_REGISTRY\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Build{Dockerfile: path}
+	want := []string{"GOPROXY=https://proxy.example.com", "NPM_CONFIG_REGISTRY=https://npm.example.com"}
+	if diff := cmp.Diff(want, b.autoProxyArgs(false)); diff != "" {
+		t.Errorf("proxy args mismatch (-want +got):\n%s", diff)
+	}
+
+	b.Args = []string{"GOPROXY=off"}
+	want = []string{"NPM_CONFIG_REGISTRY=https://npm.example.com"}
+	if diff := cmp.Diff(want, b.autoProxyArgs(false)); diff != "" {
+		t.Errorf("proxy args mismatch (-want +got):\n%s", diff)
+	}
+
+	if got := b.autoProxyArgs(true); got != nil {
+		t.Errorf("expected no proxy args for a remote context, got %v", got)
+	}
+}
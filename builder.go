@@ -0,0 +1,544 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Builders translating the build into a command.
+const (
+	BuilderKaniko   = "kaniko"   // Kaniko executor
+	BuilderBuildKit = "buildkit" // Rootless BuildKit run without a daemon
+	BuilderBuildah  = "buildah"  // Buildah, for privileged runners
+)
+
+// defaultBuildctl runs buildctl against a buildkitd started for the build,
+// as shipped in the rootless BuildKit image.
+const defaultBuildctl = "buildctl-daemonless.sh"
+
+// defaultBuildah is the buildah binary.
+const defaultBuildah = "buildah"
+
+// buildInput holds the values resolved by Exec the builder command is
+// derived from, next to the build settings.
+type buildInput struct {
+	context string   // Build context, possibly staged with extra contexts
+	tags    []string // Resolved tags
+	noPush  bool     // Build without pushing, also when the image is tested first
+	secrets bool     // Secrets are staged in the secrets directory
+	sshArgs []string // Build args exposing the staged ssh key and agent
+	sshDir  string   // Directory the ssh key is staged in
+
+	secretArgs  []string // Build args resolved by the builder from its environment
+	clientCerts []string // Staged registry client certificates, as registry=cert,key
+	uploaded    string   // Dockerfile path within the context uploaded to the context bucket
+
+	runCacheDirs []string // Directories restored from the run cache volume
+	volumes      []volume // Runner directories exposed to the RUN instructions
+	noPushCache  bool     // Read the cache without writing to it, another build holds the cache lock
+}
+
+// builder returns the builder name, defaulting to kaniko.
+func (b Build) builder() string {
+	if b.Builder == "" {
+		return BuilderKaniko
+	}
+	return b.Builder
+}
+
+// builderArgs translates the build into the arguments of the builder.
+func (p Plugin) builderArgs(in buildInput) ([]string, error) {
+	switch p.Build.builder() {
+	case BuilderKaniko:
+		return p.kanikoArgs(in), nil
+	case BuilderBuildKit:
+		return p.buildkitArgs(in)
+	case BuilderBuildah:
+		return p.buildahArgs(in)
+	default:
+		return nil, fmt.Errorf("unknown builder %q, expected %s, %s or %s", p.Build.Builder, BuilderKaniko, BuilderBuildKit, BuilderBuildah)
+	}
+}
+
+// kanikoArgs returns the arguments of the kaniko executor.
+func (p Plugin) kanikoArgs(in buildInput) []string {
+	dockerfile := p.Build.Dockerfile
+	if in.uploaded != "" {
+		dockerfile = in.uploaded
+	}
+	cmdArgs := []string{
+		fmt.Sprintf("--dockerfile=%s", dockerfile),
+		fmt.Sprintf("--context=%s", contextArg(in.context)),
+	}
+
+	if in.secrets {
+		// keep the staged secrets out of the image layers
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ignore-path=%s", secretsDir))
+	}
+	if path := p.Build.scratchIgnorePath(); path != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ignore-path=%s", path))
+	}
+
+	for _, arg := range in.sshArgs {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--build-arg=%s", arg))
+	}
+	if p.Build.SSHAgentSock != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ignore-path=%s", p.Build.SSHAgentSock))
+	}
+	if len(in.runCacheDirs) > 0 {
+		// keep the caches, and the volume they are kept in, out of the image
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ignore-path=%s", p.Build.runCacheVolume()))
+		for _, dir := range in.runCacheDirs {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--ignore-path=%s", dir))
+		}
+	}
+	for _, v := range in.volumes {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ignore-path=%s", v.dst))
+		if v.src != v.dst {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--ignore-path=%s", v.src))
+		}
+	}
+
+	if p.Build.ContextSubPath != "" && in.uploaded == "" {
+		// the uploaded archive holds the sub path only
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--context-sub-path=%s", p.Build.ContextSubPath))
+	}
+
+	// Set the destination repository only when we push or save to tarball
+	if !p.Build.NoPush || p.Build.TarPath != "" {
+		for _, tag := range in.tags {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--destination=%s:%s", p.Build.Repo, tag))
+		}
+	}
+
+	// Set the build arguments
+	for _, arg := range p.Build.Args {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--build-arg=%s", arg))
+	}
+	for _, name := range in.secretArgs {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--build-arg=%s", name))
+	}
+	// Set the labels
+	if p.Build.AutoLabels {
+		for _, label := range p.Build.autoLabels() {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--label=%s", label))
+		}
+	}
+	for _, label := range p.Build.Labels {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--label=%s", label))
+	}
+	// Set repository mirrors
+	for _, mirror := range p.Build.Mirrors {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--registry-mirror=%s", mirror))
+	}
+	if p.Build.Target != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--target=%s", p.Build.Target))
+	}
+
+	if p.Build.SkipTlsVerify {
+		cmdArgs = append(cmdArgs, "--skip-tls-verify=true")
+	}
+	if p.Build.CACert != "" {
+		for _, host := range p.Build.caCertRegistries() {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--registry-certificate=%s=%s", host, p.Build.CACert))
+		}
+	}
+	for _, cert := range in.clientCerts {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--registry-client-cert=%s", cert))
+	}
+
+	if p.Build.SnapshotMode != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--snapshotMode=%s", p.Build.SnapshotMode))
+	}
+
+	if p.Build.SingleSnapshot {
+		cmdArgs = append(cmdArgs, "--single-snapshot")
+	}
+
+	if p.Build.DisableCompressedCaching {
+		cmdArgs = append(cmdArgs, "--compressed-caching=false")
+	}
+
+	if p.Build.EnableCache {
+		cmdArgs = append(cmdArgs, "--cache=true")
+
+		if p.Build.CacheRepo != "" {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--cache-repo=%s", p.Build.CacheRepo))
+			if host := p.Build.cacheRegistry(); p.Build.CacheInsecure && host != "" {
+				cmdArgs = append(cmdArgs, fmt.Sprintf("--insecure-registry=%s", host))
+			}
+		}
+		if in.noPushCache {
+			cmdArgs = append(cmdArgs, "--no-push-cache")
+		}
+	}
+
+	if p.Build.CacheDir != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--cache-dir=%s", p.Build.CacheDir))
+	}
+
+	if p.Build.CacheTTL != 0 {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--cache-ttl=%dh", p.Build.CacheTTL))
+	}
+
+	if p.Build.DigestFile != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--digest-file=%s", p.Build.DigestFile))
+	}
+
+	if p.perTagDigests() {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--image-name-tag-with-digest-file=%s", p.Build.imageTagDigestPath()))
+	}
+
+	if in.noPush {
+		cmdArgs = append(cmdArgs, "--no-push")
+	} else if check, _ := p.Build.pushCheck(); check != PushCheckKaniko {
+		// the plugin probed the repositories already, or no check is wanted
+		cmdArgs = append(cmdArgs, "--skip-push-permission-check")
+	}
+
+	if p.Build.Verbosity != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--verbosity=%s", p.Build.Verbosity))
+	}
+	if logArgs, err := p.Build.logArgs(); err == nil {
+		cmdArgs = append(cmdArgs, logArgs...)
+	}
+
+	if p.Build.Platform != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--customPlatform=%s", p.Build.Platform))
+	}
+
+	if p.Build.SkipUnusedStages {
+		cmdArgs = append(cmdArgs, "--skip-unused-stages")
+	}
+
+	if p.Build.Cleanup {
+		cmdArgs = append(cmdArgs, "--cleanup")
+	}
+
+	if p.Build.TarPath != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--tar-path=%s", p.Build.TarPath))
+	}
+
+	if p.Build.OCILayout != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--oci-layout-path=%s", p.Build.OCILayout))
+	}
+
+	if p.Build.KanikoDir != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--kaniko-dir=%s", p.Build.KanikoDir))
+	}
+
+	if p.Build.IncludeVarRun {
+		cmdArgs = append(cmdArgs, "--ignore-var-run=false")
+	}
+
+	for _, path := range p.Build.IgnorePaths {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ignore-path=%s", path))
+	}
+
+	return cmdArgs
+}
+
+// buildkitArgs returns the arguments of buildctl building the image with the
+// dockerfile frontend. Kaniko specific settings without a BuildKit
+// equivalent are ignored with a warning.
+func (p Plugin) buildkitArgs(in buildInput) ([]string, error) {
+	if isRemoteContext(in.context) {
+		return nil, fmt.Errorf("remote build contexts are not supported by the %s builder", BuilderBuildKit)
+	}
+	if len(in.secretArgs) > 0 {
+		// buildctl does not read build arg values from the environment
+		return nil, fmt.Errorf("secret args are not supported by the %s builder, use secrets instead", BuilderBuildKit)
+	}
+	if len(in.volumes) > 0 {
+		return nil, fmt.Errorf("volumes are not supported by the %s builder", BuilderBuildKit)
+	}
+	buildContext := in.context
+	if p.Build.ContextSubPath != "" {
+		buildContext = filepath.Join(buildContext, p.Build.ContextSubPath)
+	}
+	cmdArgs := []string{
+		"build",
+		"--frontend=dockerfile.v0",
+		"--progress=plain",
+		fmt.Sprintf("--local=context=%s", buildContext),
+		fmt.Sprintf("--local=dockerfile=%s", filepath.Dir(p.Build.Dockerfile)),
+		fmt.Sprintf("--opt=filename=%s", filepath.Base(p.Build.Dockerfile)),
+	}
+
+	if in.secrets {
+		for _, value := range p.Build.Secrets {
+			id := strings.SplitN(value, "=", 2)[0]
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--secret=id=%s,src=%s", id, filepath.Join(secretsDir, id)))
+		}
+	}
+	switch {
+	case p.Build.SSHAgentSock != "":
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ssh=default=%s", p.Build.SSHAgentSock))
+	case p.Build.SSHKey != "":
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ssh=default=%s", filepath.Join(in.sshDir, "id_key")))
+	}
+	for _, arg := range in.sshArgs {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--opt=build-arg:%s", arg))
+	}
+
+	for _, arg := range p.Build.Args {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--opt=build-arg:%s", arg))
+	}
+	if p.Build.AutoLabels {
+		for _, label := range p.Build.autoLabels() {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--opt=label:%s", label))
+		}
+	}
+	for _, label := range p.Build.Labels {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--opt=label:%s", label))
+	}
+	if p.Build.Target != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--opt=target=%s", p.Build.Target))
+	}
+	if p.Build.Platform != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--opt=platform=%s", p.Build.Platform))
+	}
+
+	var names []string
+	for _, tag := range in.tags {
+		names = append(names, fmt.Sprintf("%s:%s", p.Build.Repo, tag))
+	}
+	output := []string{"type=image"}
+	switch {
+	case p.Build.TarPath != "" && p.Build.OCILayout != "":
+		return nil, fmt.Errorf("saving the image to a tarball and an oci layout is not supported by the %s builder", BuilderBuildKit)
+	case (p.Build.TarPath != "" || p.Build.OCILayout != "") && !in.noPush:
+		return nil, fmt.Errorf("saving the image while pushing is not supported by the %s builder", BuilderBuildKit)
+	case p.Build.TarPath != "":
+		output = []string{"type=docker", "dest=" + p.Build.TarPath}
+	case p.Build.OCILayout != "":
+		output = []string{"type=oci", "dest=" + p.Build.OCILayout, "tar=false"}
+	}
+	if len(names) > 0 {
+		output = append(output, fmt.Sprintf(`"name=%s"`, strings.Join(names, ",")))
+	}
+	if p.Build.TarPath == "" && p.Build.OCILayout == "" {
+		output = append(output, fmt.Sprintf("push=%t", !in.noPush))
+	}
+	if p.Build.SkipTlsVerify {
+		output = append(output, "registry.insecure=true")
+	}
+	cmdArgs = append(cmdArgs, "--output="+strings.Join(output, ","))
+
+	if p.Build.EnableCache && p.Build.CacheRepo != "" {
+		cache := fmt.Sprintf("type=registry,ref=%s:buildcache", p.Build.CacheRepo)
+		if p.Build.CacheInsecure {
+			cache += ",registry.insecure=true"
+		}
+		cmdArgs = append(cmdArgs, "--import-cache="+cache)
+		if !in.noPushCache {
+			cmdArgs = append(cmdArgs, "--export-cache="+cache+",mode=max")
+		}
+	}
+
+	if p.Build.DigestFile != "" {
+		os.Remove(p.Build.buildkitMetadataPath())
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--metadata-file=%s", p.Build.buildkitMetadataPath()))
+	}
+
+	ignored := []struct {
+		setting string
+		set     bool
+	}{
+		{"registry mirrors", len(p.Build.Mirrors) > 0},
+		{"snapshot mode", p.Build.SnapshotMode != ""},
+		{"single snapshot", p.Build.SingleSnapshot},
+		{"cache dir", p.Build.CacheDir != ""},
+		{"cache ttl", p.Build.CacheTTL != 0},
+		{"cache cleanup", p.Build.CacheCleanup},
+		{"ignore paths", len(p.Build.IgnorePaths) > 0},
+		{"include var run", p.Build.IncludeVarRun},
+		{"ca cert", p.Build.CACert != ""},
+		{"registry client certs", len(p.Build.RegistryClientCerts) > 0},
+	}
+	for _, i := range ignored {
+		if i.set {
+			fmt.Fprintf(os.Stderr, "warning: %s setting is not supported by the %s builder and is ignored\n", i.setting, BuilderBuildKit)
+		}
+	}
+	return cmdArgs, nil
+}
+
+// buildkitMetadataPath returns the file buildctl writes the build result to.
+func (b Build) buildkitMetadataPath() string {
+	dir := b.kanikoDir()
+	if _, err := os.Stat(dir); err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "buildkit-metadata.json")
+}
+
+// buildahArgs returns the arguments of buildah bud. The image is pushed or
+// saved by afterBuild, as buildah builds into local storage.
+func (p Plugin) buildahArgs(in buildInput) ([]string, error) {
+	if isRemoteContext(in.context) {
+		return nil, fmt.Errorf("remote build contexts are not supported by the %s builder", BuilderBuildah)
+	}
+	buildContext := in.context
+	if p.Build.ContextSubPath != "" {
+		buildContext = filepath.Join(buildContext, p.Build.ContextSubPath)
+	}
+	cmdArgs := []string{
+		"bud",
+		fmt.Sprintf("--file=%s", p.Build.Dockerfile),
+		fmt.Sprintf("--authfile=%s", p.Build.dockerConfigPath()),
+	}
+	for _, tag := range in.tags {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--tag=%s:%s", p.Build.Repo, tag))
+	}
+
+	if in.secrets {
+		for _, value := range p.Build.Secrets {
+			id := strings.SplitN(value, "=", 2)[0]
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--secret=id=%s,src=%s", id, filepath.Join(secretsDir, id)))
+		}
+	}
+	switch {
+	case p.Build.SSHAgentSock != "":
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ssh=default=%s", p.Build.SSHAgentSock))
+	case p.Build.SSHKey != "":
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--ssh=default=%s", filepath.Join(in.sshDir, "id_key")))
+	}
+	for _, arg := range in.sshArgs {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--build-arg=%s", arg))
+	}
+	for _, v := range in.volumes {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--volume=%s:%s", v.src, v.dst))
+	}
+
+	for _, arg := range p.Build.Args {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--build-arg=%s", arg))
+	}
+	for _, name := range in.secretArgs {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--build-arg=%s", name))
+	}
+	if p.Build.AutoLabels {
+		for _, label := range p.Build.autoLabels() {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--label=%s", label))
+		}
+	}
+	for _, label := range p.Build.Labels {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--label=%s", label))
+	}
+	if p.Build.Target != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--target=%s", p.Build.Target))
+	}
+	if p.Build.Platform != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--platform=%s", p.Build.Platform))
+	}
+	if p.Build.SkipTlsVerify {
+		cmdArgs = append(cmdArgs, "--tls-verify=false")
+	}
+	if p.Build.CACert != "" {
+		cmdArgs = append(cmdArgs, fmt.Sprintf("--cert-dir=%s", filepath.Dir(p.Build.CACert)))
+	}
+	if p.Build.EnableCache {
+		cmdArgs = append(cmdArgs, "--layers")
+		if p.Build.CacheRepo != "" {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--cache-from=%s", p.Build.CacheRepo))
+			if !in.noPushCache {
+				cmdArgs = append(cmdArgs, fmt.Sprintf("--cache-to=%s", p.Build.CacheRepo))
+			}
+		}
+		if p.Build.CacheTTL != 0 {
+			cmdArgs = append(cmdArgs, fmt.Sprintf("--cache-ttl=%dh", p.Build.CacheTTL))
+		}
+	}
+	if len(p.Build.IgnorePaths) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: ignore paths are not needed by the %s builder and are ignored\n", BuilderBuildah)
+	}
+	if p.Build.CacheCleanup {
+		fmt.Fprintf(os.Stderr, "warning: cache cleanup is not supported by the %s builder and is ignored\n", BuilderBuildah)
+	}
+	if len(p.Build.Mirrors) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: registry mirrors are configured in registries.conf for the %s builder and are ignored\n", BuilderBuildah)
+	}
+	if len(p.Build.RegistryClientCerts) > 0 {
+		fmt.Fprintf(os.Stderr, "warning: registry client certs are configured in the certs.d directory for the %s builder and are ignored\n", BuilderBuildah)
+	}
+	return append(cmdArgs, buildContext), nil
+}
+
+// buildahPushArgs returns the arguments of buildah push for each tag: the
+// tags are pushed to the registry, or the first one saved to the tarball.
+func (p Plugin) buildahPushArgs(in buildInput) [][]string {
+	var pushes [][]string
+	for i, tag := range in.tags {
+		image := fmt.Sprintf("%s:%s", p.Build.Repo, tag)
+		args := []string{"push", fmt.Sprintf("--authfile=%s", p.Build.dockerConfigPath())}
+		if p.Build.SkipTlsVerify {
+			args = append(args, "--tls-verify=false")
+		}
+		if p.Build.CACert != "" {
+			args = append(args, fmt.Sprintf("--cert-dir=%s", filepath.Dir(p.Build.CACert)))
+		}
+		if p.Build.TarPath != "" && i == 0 {
+			save := append(append([]string{}, args...), image, fmt.Sprintf("docker-archive:%s:%s", p.Build.TarPath, image))
+			pushes = append(pushes, save)
+		}
+		if p.Build.OCILayout != "" && i == 0 {
+			save := append(append([]string{}, args...), image, fmt.Sprintf("oci:%s", p.Build.OCILayout))
+			pushes = append(pushes, save)
+		}
+		if in.noPush {
+			continue
+		}
+		if p.Build.DigestFile != "" {
+			args = append(args, fmt.Sprintf("--digestfile=%s", p.Build.DigestFile))
+		}
+		pushes = append(pushes, append(args, image, "docker://"+image))
+	}
+	return pushes
+}
+
+// afterBuild completes the build and converts the outputs of the builder
+// into the outputs kaniko writes, so the steps after the build do not depend
+// on the builder. Commands run like the build command.
+func (p Plugin) afterBuild(ctx context.Context, executor Runner, build *exec.Cmd, in buildInput) error {
+	if p.Build.builder() == BuilderBuildah {
+		for _, args := range p.buildahPushArgs(in) {
+			cmd := exec.Command(build.Path, args...)
+			cmd.Dir, cmd.Env, cmd.Stdout, cmd.Stderr = build.Dir, build.Env, build.Stdout, build.Stderr
+			trace(cmd)
+			if err := executor.Run(ctx, cmd); err != nil {
+				return errors.Wrap(err, "failed to push the image")
+			}
+		}
+		return nil
+	}
+
+	if p.Build.builder() != BuilderBuildKit || p.Build.DigestFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(p.Build.buildkitMetadataPath())
+	if err != nil {
+		return errors.Wrap(err, "failed to read buildkit metadata")
+	}
+	defer os.Remove(p.Build.buildkitMetadataPath())
+	var metadata struct {
+		Digest string `json:"containerimage.digest"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return errors.Wrap(err, "failed to parse buildkit metadata")
+	}
+	if metadata.Digest == "" {
+		return nil
+	}
+	if err := ioutil.WriteFile(p.Build.DigestFile, []byte(metadata.Digest), 0644); err != nil {
+		return errors.Wrap(err, "failed to write digest file")
+	}
+	return nil
+}
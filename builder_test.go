@@ -0,0 +1,190 @@
+package kaniko
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlugin_ExecBuildKit(t *testing.T) {
+	b := testBuild(t)
+	b.Builder = BuilderBuildKit
+	b.Repo = "registry.example.com/app"
+	b.Tags = []string{"1.0", "latest"}
+	b.NoPush = false
+	b.Args = []string{"VERSION=1.0"}
+	b.Labels = []string{"team=build"}
+	b.Target = "release"
+	if err := ioutil.WriteFile(b.Dockerfile, []byte("FROM scratch AS release\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b.Platform = "linux/arm64"
+	b.EnableCache = true
+	b.CacheRepo = "registry.example.com/cache"
+	b.DigestFile = filepath.Join(b.KanikoDir, "digest")
+
+	runner := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		return ioutil.WriteFile(b.buildkitMetadataPath(), []byte(`{"containerimage.digest": "sha256:abc"}`), 0644)
+	}}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	args := runner.cmds[0].Args
+	if args[0] != defaultBuildctl || args[1] != "build" {
+		t.Errorf("expected buildctl build, got %v", args[:2])
+	}
+	for _, want := range []string{
+		"--frontend=dockerfile.v0",
+		"--local=context=" + b.Context,
+		"--local=dockerfile=" + filepath.Dir(b.Dockerfile),
+		"--opt=filename=Dockerfile",
+		"--opt=build-arg:VERSION=1.0",
+		"--opt=label:team=build",
+		"--opt=target=release",
+		"--opt=platform=linux/arm64",
+		`--output=type=image,"name=registry.example.com/app:1.0,registry.example.com/app:latest",push=true`,
+		"--import-cache=type=registry,ref=registry.example.com/cache:buildcache",
+		"--export-cache=type=registry,ref=registry.example.com/cache:buildcache,mode=max",
+		"--metadata-file=" + b.buildkitMetadataPath(),
+	} {
+		if !contains(args, want) {
+			t.Errorf("expected argument %s in %v", want, args)
+		}
+	}
+	if digest, _ := ioutil.ReadFile(b.DigestFile); string(digest) != "sha256:abc" {
+		t.Errorf("expected the digest from the buildkit metadata, got %q", digest)
+	}
+}
+
+func TestPlugin_buildkitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   Build
+		in      buildInput
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "no push",
+			build: Build{Repo: "app", Dockerfile: "Dockerfile"},
+			in:    buildInput{context: ".", tags: []string{"latest"}, noPush: true},
+			want:  `--output=type=image,"name=app:latest",push=false`,
+		},
+		{
+			name:  "tarball",
+			build: Build{Repo: "app", Dockerfile: "Dockerfile", TarPath: "/tmp/image.tar"},
+			in:    buildInput{context: ".", tags: []string{"latest"}, noPush: true},
+			want:  `--output=type=docker,dest=/tmp/image.tar,"name=app:latest"`,
+		},
+		{
+			name:  "insecure registry",
+			build: Build{Repo: "app", Dockerfile: "Dockerfile", SkipTlsVerify: true},
+			in:    buildInput{context: ".", tags: []string{"latest"}},
+			want:  `--output=type=image,"name=app:latest",push=true,registry.insecure=true`,
+		},
+		{
+			name:  "context sub path",
+			build: Build{Dockerfile: "Dockerfile", ContextSubPath: "app"},
+			in:    buildInput{context: "src"},
+			want:  "--local=context=src/app",
+		},
+		{
+			name:  "ssh agent",
+			build: Build{Dockerfile: "Dockerfile", SSHAgentSock: "/run/ssh.sock"},
+			in:    buildInput{context: "."},
+			want:  "--ssh=default=/run/ssh.sock",
+		},
+		{
+			name:  "secrets",
+			build: Build{Dockerfile: "Dockerfile", Secrets: []string{"npm=NPM_TOKEN"}},
+			in:    buildInput{context: ".", secrets: true},
+			want:  "--secret=id=npm,src=" + filepath.Join(secretsDir, "npm"),
+		},
+		{
+			name:    "remote context",
+			build:   Build{Dockerfile: "Dockerfile"},
+			in:      buildInput{context: "git://github.com/drone/drone-kaniko.git"},
+			wantErr: true,
+		},
+		{
+			name:    "tarball and push",
+			build:   Build{Dockerfile: "Dockerfile", TarPath: "/tmp/image.tar"},
+			in:      buildInput{context: "."},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args, err := Plugin{Build: tc.build}.buildkitArgs(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("buildkitArgs() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && !contains(args, tc.want) {
+				t.Errorf("expected argument %s in %v", tc.want, args)
+			}
+		})
+	}
+
+	if _, err := (Plugin{Build: Build{Builder: "docker"}}).builderArgs(buildInput{}); err == nil {
+		t.Errorf("expected error for an unknown builder")
+	}
+}
+
+func TestPlugin_ExecBuildah(t *testing.T) {
+	b := testBuild(t)
+	b.Builder = BuilderBuildah
+	b.Repo = "registry.example.com/app"
+	b.Tags = []string{"1.0", "latest"}
+	b.NoPush = false
+	b.Args = []string{"VERSION=1.0"}
+	b.EnableCache = true
+	b.CacheRepo = "registry.example.com/cache"
+	b.DigestFile = filepath.Join(b.KanikoDir, "digest")
+	b.DockerConfigDir = "/config"
+
+	runner := &fakeRunner{}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.cmds) != 3 {
+		t.Fatalf("expected the build and a push per tag, ran %d commands", len(runner.cmds))
+	}
+	args := runner.cmds[0].Args
+	for _, want := range []string{
+		"bud",
+		"--file=" + b.Dockerfile,
+		"--authfile=/config/config.json",
+		"--tag=registry.example.com/app:1.0",
+		"--tag=registry.example.com/app:latest",
+		"--build-arg=VERSION=1.0",
+		"--layers",
+		"--cache-from=registry.example.com/cache",
+		"--cache-to=registry.example.com/cache",
+	} {
+		if !contains(args, want) {
+			t.Errorf("expected argument %s in %v", want, args)
+		}
+	}
+	if args[len(args)-1] != b.Context {
+		t.Errorf("expected the context as last argument, got %v", args)
+	}
+	push := runner.cmds[2].Args
+	for _, want := range []string{"push", "--digestfile=" + b.DigestFile, "docker://registry.example.com/app:latest"} {
+		if !contains(push, want) {
+			t.Errorf("expected argument %s in %v", want, push)
+		}
+	}
+}
+
+func TestPlugin_buildahPushArgs(t *testing.T) {
+	p := Plugin{Build: Build{Repo: "app", TarPath: "/tmp/image.tar", DockerConfigDir: "/config"}}
+	pushes := p.buildahPushArgs(buildInput{tags: []string{"1.0", "latest"}, noPush: true})
+	if len(pushes) != 1 {
+		t.Fatalf("expected only the tarball to be saved, got %v", pushes)
+	}
+	if want := "docker-archive:/tmp/image.tar:app:1.0"; !contains(pushes[0], want) {
+		t.Errorf("expected argument %s in %v", want, pushes[0])
+	}
+}
@@ -0,0 +1,146 @@
+package kaniko
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/buildlog"
+	"github.com/drone/drone-kaniko/pkg/metrics"
+	"github.com/drone/drone-kaniko/pkg/state"
+	"github.com/drone/drone-kaniko/pkg/tagger"
+)
+
+// maxBuildHistory is the number of previous builds kept in the state.
+const maxBuildHistory = 20
+
+type (
+	// buildRecord is a build of the history.
+	buildRecord struct {
+		Time        time.Time `json:"time"`
+		Build       string    `json:"build,omitempty"`
+		Seconds     float64   `json:"seconds"`
+		CacheHits   int       `json:"cache_hits"`
+		CacheMisses int       `json:"cache_misses"`
+	}
+
+	// buildHistory is the state of a repository and branch.
+	buildHistory struct {
+		Builds []buildRecord `json:"builds"`
+	}
+)
+
+// cacheRatio returns the share of cache lookups that hit, or -1 when the
+// cache was not used.
+func (r buildRecord) cacheRatio() float64 {
+	return buildlog.Summary{CacheHits: r.CacheHits, CacheMisses: r.CacheMisses}.CacheRatio()
+}
+
+// stateKey returns the key of the build history of the repository and
+// branch.
+func (b Build) stateKey() string {
+	branch := b.DroneCommitBranch
+	if branch == "" {
+		branch = "default"
+	}
+	return strings.ReplaceAll(b.Repo, ":", "_") + "/" + tagger.Sanitize(branch) + ".json"
+}
+
+// recordBuildState compares the build with the previous builds of the
+// repository and branch, printing the trend and sending it as metrics,
+// and adds it to the history in the state store. Failures are only
+// reported, the history is informational.
+func (b Build) recordBuildState(ctx context.Context, s buildlog.Summary) {
+	store, err := state.Open(b.StateStore)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open the state store: %s\n", err)
+		return
+	}
+	key := b.stateKey()
+
+	var history buildHistory
+	data, err := store.Get(ctx, key)
+	switch {
+	case err == state.ErrNotFound:
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "failed to read the build history: %s\n", err)
+		return
+	default:
+		if err := json.Unmarshal(data, &history); err != nil {
+			fmt.Fprintf(os.Stderr, "ignoring the unreadable build history %s: %s\n", key, err)
+		}
+	}
+
+	record := buildRecord{
+		Time:        time.Now().UTC(),
+		Build:       b.DroneBuildNumber,
+		Seconds:     s.Seconds,
+		CacheHits:   s.CacheHits,
+		CacheMisses: s.CacheMisses,
+	}
+	if len(history.Builds) > 0 {
+		previous := history.Builds[len(history.Builds)-1]
+		printTrend(os.Stdout, previous, record)
+		if b.StatsdAddress != "" {
+			statsd := metrics.StatsD{Addr: b.StatsdAddress, Prefix: b.StatsdPrefix}
+			if err := statsd.Send(trendMetrics(b.Repo, previous, record)); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to send build trend: %s\n", err)
+			}
+		}
+	}
+
+	history.Builds = append(history.Builds, record)
+	if len(history.Builds) > maxBuildHistory {
+		history.Builds = history.Builds[len(history.Builds)-maxBuildHistory:]
+	}
+	if data, err = json.MarshalIndent(history, "", "  "); err == nil {
+		err = store.Put(ctx, key, bytes.NewReader(data))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the build history: %s\n", err)
+	}
+}
+
+// durationChange returns the change of the build time in percent.
+func durationChange(previous, current buildRecord) float64 {
+	if previous.Seconds == 0 {
+		return 0
+	}
+	return (current.Seconds - previous.Seconds) / previous.Seconds * 100
+}
+
+// printTrend writes how the build compares with the previous one to w.
+func printTrend(w io.Writer, previous, current buildRecord) {
+	seconds := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+	change := durationChange(previous, current)
+	switch {
+	case math.Round(change) > 0:
+		fmt.Fprintf(w, "Build took %s, %.0f%% slower than the last build (%s)\n", seconds(current.Seconds), change, seconds(previous.Seconds))
+	case math.Round(change) < 0:
+		fmt.Fprintf(w, "Build took %s, %.0f%% faster than the last build (%s)\n", seconds(current.Seconds), -change, seconds(previous.Seconds))
+	default:
+		fmt.Fprintf(w, "Build took %s, as long as the last build\n", seconds(current.Seconds))
+	}
+	if ratio, last := current.cacheRatio(), previous.cacheRatio(); ratio >= 0 && last >= 0 {
+		fmt.Fprintf(w, "Cache hit rate %.0f%% (last build %.0f%%)\n", ratio*100, last*100)
+	}
+}
+
+// trendMetrics returns the change of the build time and the cache hit rate
+// as gauges.
+func trendMetrics(repo string, previous, current buildRecord) []metrics.Metric {
+	tags := map[string]string{"repo": repo}
+	list := []metrics.Metric{
+		{Name: "build.duration_change", Value: math.Round(durationChange(previous, current)), Type: "g", Tags: tags},
+	}
+	if ratio := current.cacheRatio(); ratio >= 0 {
+		list = append(list, metrics.Metric{Name: "build.cache_ratio", Value: math.Round(ratio * 100), Type: "g", Tags: tags})
+	}
+	return list
+}
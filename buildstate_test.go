@@ -0,0 +1,78 @@
+package kaniko
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/buildlog"
+	"github.com/drone/drone-kaniko/pkg/state"
+)
+
+func TestBuild_recordBuildState(t *testing.T) {
+	dir := t.TempDir()
+	b := Build{Repo: "registry.example.com:5000/app", DroneCommitBranch: "feature/Login", StateStore: dir}
+	if key := b.stateKey(); key != "registry.example.com_5000/app/feature-login.json" {
+		t.Errorf("unexpected state key %s", key)
+	}
+
+	for i := 0; i < maxBuildHistory+2; i++ {
+		b.recordBuildState(context.Background(), buildlog.Summary{Seconds: float64(60 + i), CacheHits: 3, CacheMisses: 1})
+	}
+	data, err := state.Dir(dir).Get(context.Background(), b.stateKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var history buildHistory
+	if err := json.Unmarshal(data, &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Builds) != maxBuildHistory {
+		t.Fatalf("expected %d builds kept, got %d", maxBuildHistory, len(history.Builds))
+	}
+	if last := history.Builds[maxBuildHistory-1]; last.Seconds != 81 || last.CacheHits != 3 {
+		t.Errorf("unexpected last build %+v", last)
+	}
+}
+
+func TestPrintTrend(t *testing.T) {
+	tests := []struct {
+		previous, current buildRecord
+		want              string
+	}{
+		{
+			previous: buildRecord{Seconds: 64, CacheHits: 19, CacheMisses: 1},
+			current:  buildRecord{Seconds: 72, CacheHits: 4, CacheMisses: 1},
+			want:     "Build took 1m12s, 12% slower than the last build (1m4s)\nCache hit rate 80% (last build 95%)\n",
+		},
+		{
+			previous: buildRecord{Seconds: 100},
+			current:  buildRecord{Seconds: 50},
+			want:     "Build took 50s, 50% faster than the last build (1m40s)\n",
+		},
+		{
+			previous: buildRecord{Seconds: 100},
+			current:  buildRecord{Seconds: 100},
+			want:     "Build took 1m40s, as long as the last build\n",
+		},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		printTrend(&buf, tc.previous, tc.current)
+		if buf.String() != tc.want {
+			t.Errorf("got %q, want %q", buf.String(), tc.want)
+		}
+	}
+}
+
+func TestTrendMetrics(t *testing.T) {
+	var got []string
+	for _, m := range trendMetrics("app", buildRecord{Seconds: 64}, buildRecord{Seconds: 72, CacheHits: 4, CacheMisses: 1}) {
+		got = append(got, m.Format("kaniko"))
+	}
+	want := []string{"kaniko.build.duration_change:13|g|#repo:app", "kaniko.build.cache_ratio:80|g|#repo:app"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
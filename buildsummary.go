@@ -0,0 +1,49 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/drone/drone-kaniko/pkg/buildlog"
+	"github.com/drone/drone-kaniko/pkg/image"
+	"github.com/drone/drone-kaniko/pkg/units"
+)
+
+// defaultBuildSummaryFile is the build summary file name used next to the
+// artifact file.
+const defaultBuildSummaryFile = "build-summary.json"
+
+// writeBuildSummary prints the build summary and writes it to the summary
+// file. The image size is taken from the inspected image, or from the image
+// tarball when the image was not inspected.
+func (p Plugin) writeBuildSummary(summary buildlog.Summary, img *image.Image) {
+	if img == nil && p.Build.TarPath != "" {
+		if tarball, err := image.FromTarball(p.Build.TarPath); err == nil {
+			img = &tarball
+		}
+	}
+	if img != nil {
+		for _, layer := range img.Layers {
+			summary.ImageSize += layer.Size
+		}
+	}
+	buildlog.Print(os.Stdout, summary, units.FormatSize)
+
+	file := p.buildSummaryFile()
+	if file == "" {
+		return
+	}
+	if err := buildlog.WriteFile(file, summary); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write build summary at path: %s with error: %s\n", file, err)
+	}
+}
+
+// buildSummaryFile returns the file the build summary is written to, next
+// to the artifact file by default.
+func (p Plugin) buildSummaryFile() string {
+	if p.Build.BuildSummaryFile == "" && p.Artifact.ArtifactFile != "" {
+		return filepath.Join(filepath.Dir(p.Artifact.ArtifactFile), defaultBuildSummaryFile)
+	}
+	return p.Build.BuildSummaryFile
+}
@@ -0,0 +1,143 @@
+package kaniko
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// caCertDir is the directory, within the kaniko directory, the CA bundle is
+// written to.
+const caCertDir = "certs"
+
+// systemCertFiles are the system CA bundles of the common distributions and
+// of the kaniko image, as searched by Go.
+var systemCertFiles = []string{
+	"/kaniko/ssl/certs/ca-certificates.crt",
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// InstallCACert adds the PEM encoded CA certificates, given inline or as a
+// path, to the trust store of the plugin's own HTTP clients, including the
+// AWS SDK. The bundle is written to the kaniko directory, never snapshotted
+// into the image, and its path returned to pass it to the builder. Nothing
+// is installed when neither is set.
+func InstallCACert(cert, path, kanikoDir string) (string, error) {
+	if cert == "" && path == "" {
+		return "", nil
+	}
+	if cert != "" && path != "" {
+		return "", fmt.Errorf("ca cert and ca cert path cannot both be set")
+	}
+	content := []byte(cert)
+	if path != "" {
+		var err error
+		if content, err = ioutil.ReadFile(path); err != nil {
+			return "", errors.Wrap(err, "failed to read ca cert")
+		}
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return "", fmt.Errorf("no PEM encoded certificates found in the ca cert")
+	}
+
+	if kanikoDir == "" {
+		kanikoDir = defaultKanikoDir
+	}
+	dir := filepath.Join(kanikoDir, caCertDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrap(err, "failed to create ca cert directory")
+	}
+	bundle := filepath.Join(dir, "ca.crt")
+	if err := ioutil.WriteFile(bundle, content, 0644); err != nil {
+		return "", errors.Wrap(err, "failed to write ca cert")
+	}
+
+	// clients built on the default transport, including clones of it,
+	// trust the system and the custom certificates
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		config := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			config = transport.TLSClientConfig.Clone()
+		}
+		config.RootCAs = pool
+		transport.TLSClientConfig = config
+	}
+	// the AWS SDK builds its own transport, trusting only the certificates
+	// of AWS_CA_BUNDLE, so it gets the system and the custom certificates
+	if os.Getenv("AWS_CA_BUNDLE") == "" {
+		system := systemCerts()
+		if system == nil {
+			fmt.Fprintf(os.Stderr, "warning: no system CA bundle found, the ca cert is not used by the AWS SDK\n")
+			return bundle, nil
+		}
+		awsBundle := filepath.Join(dir, "aws-ca.crt")
+		if err := ioutil.WriteFile(awsBundle, append(append(system, '\n'), content...), 0644); err != nil {
+			return "", errors.Wrap(err, "failed to write ca cert")
+		}
+		os.Setenv("AWS_CA_BUNDLE", awsBundle)
+	}
+	return bundle, nil
+}
+
+// systemCerts returns the system CA bundle, the file of SSL_CERT_FILE when
+// set, or nil when none is found.
+func systemCerts() []byte {
+	files := systemCertFiles
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		files = []string{file}
+	}
+	for _, file := range files {
+		if content, err := ioutil.ReadFile(file); err == nil && len(content) > 0 {
+			return content
+		}
+	}
+	return nil
+}
+
+// caCertRegistries returns the registries the CA bundle is passed to kaniko
+// for: the registries of the repository, the cache repository, the mirrors
+// and the base images.
+func (b Build) caCertRegistries() []string {
+	var hosts []string
+	add := func(host string) {
+		if host != "" && !contains(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	for _, image := range []string{b.Repo, b.CacheRepo} {
+		if ref, err := registry.ParseReference(image); err == nil && image != "" {
+			add(ref.Registry)
+		}
+	}
+	for _, mirror := range b.Mirrors {
+		mirror = strings.TrimPrefix(strings.TrimPrefix(mirror, "https://"), "http://")
+		add(strings.SplitN(mirror, "/", 2)[0])
+	}
+	if d, err := dockerfile.ParseFile(b.Dockerfile); err == nil {
+		for _, image := range d.BaseImages(b.Args) {
+			if ref, err := registry.ParseReference(image); err == nil {
+				add(ref.Registry)
+			}
+		}
+	}
+	return hosts
+}
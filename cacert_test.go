@@ -0,0 +1,102 @@
+package kaniko
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInstallCACert(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	transport := http.DefaultTransport.(*http.Transport)
+	saved := transport.TLSClientConfig
+	defer func() { transport.TLSClientConfig = saved }()
+	t.Setenv("AWS_CA_BUNDLE", "")
+	system := filepath.Join(t.TempDir(), "ca-certificates.crt")
+	if err := ioutil.WriteFile(system, []byte("system certificates"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSL_CERT_FILE", system)
+
+	dir := t.TempDir()
+	bundle, err := InstallCACert(string(cert), "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, caCertDir, "ca.crt"); bundle != want {
+		t.Errorf("got bundle %s, want %s", bundle, want)
+	}
+	if content, _ := ioutil.ReadFile(bundle); string(content) != string(cert) {
+		t.Errorf("unexpected bundle content %q", content)
+	}
+	// the AWS SDK trusts only its bundle, which must hold the system roots
+	awsBundle := os.Getenv("AWS_CA_BUNDLE")
+	if want := filepath.Join(dir, caCertDir, "aws-ca.crt"); awsBundle != want {
+		t.Errorf("got AWS_CA_BUNDLE %q, want %q", awsBundle, want)
+	}
+	if content, _ := ioutil.ReadFile(awsBundle); string(content) != "system certificates\n"+string(cert) {
+		t.Errorf("expected the system and the custom certificates in the AWS bundle, got %q", content)
+	}
+
+	res, err := (&http.Client{Transport: transport.Clone()}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the server certificate to be trusted: %s", err)
+	}
+	res.Body.Close()
+}
+
+func TestInstallCACert_noSystemCerts(t *testing.T) {
+	t.Setenv("AWS_CA_BUNDLE", "")
+	t.Setenv("SSL_CERT_FILE", filepath.Join(t.TempDir(), "missing.crt"))
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	transport := http.DefaultTransport.(*http.Transport)
+	saved := transport.TLSClientConfig
+	defer func() { transport.TLSClientConfig = saved }()
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if _, err := InstallCACert(string(cert), "", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv("AWS_CA_BUNDLE"); got != "" {
+		t.Errorf("expected AWS_CA_BUNDLE unset without system certificates, got %q", got)
+	}
+}
+
+func TestInstallCACert_errors(t *testing.T) {
+	if bundle, err := InstallCACert("", "", t.TempDir()); bundle != "" || err != nil {
+		t.Errorf("expected nothing installed, got %q, %v", bundle, err)
+	}
+	if _, err := InstallCACert("not a certificate", "", t.TempDir()); err == nil {
+		t.Error("expected an error for content without certificates")
+	}
+	if _, err := InstallCACert("cert", "/path/ca.crt", t.TempDir()); err == nil {
+		t.Error("expected an error when both are set")
+	}
+	if _, err := InstallCACert("", filepath.Join(t.TempDir(), "missing.crt"), t.TempDir()); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestBuild_caCertRegistries(t *testing.T) {
+	b := testBuild(t)
+	b.Repo = "registry.example.com/app"
+	b.CacheRepo = "cache.example.com:5000/cache"
+	b.Mirrors = []string{"https://mirror.example.com/v2", "registry.example.com"}
+	if err := ioutil.WriteFile(b.Dockerfile, []byte("FROM golang:1.22 AS build\nFROM base.example.com/distroless\nFROM build\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"registry.example.com", "cache.example.com:5000", "mirror.example.com", "index.docker.io", "base.example.com"}
+	if diff := cmp.Diff(want, b.caCertRegistries()); diff != "" {
+		t.Errorf("registries mismatch (-want +got):\n%s", diff)
+	}
+}
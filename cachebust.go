@@ -0,0 +1,75 @@
+package kaniko
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/pkg/errors"
+)
+
+// cacheBustArg is the build arg carrying the cache bust token.
+const cacheBustArg = "KANIKO_CACHE_BUST"
+
+// injectCacheBust declares the cache bust arg at the start of the stage,
+// given by name or index, or of every stage when empty. The commands of the
+// stage then depend on the token, so a new token invalidates their cache.
+func injectCacheBust(content []byte, stage string) ([]byte, error) {
+	d, err := dockerfile.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse dockerfile")
+	}
+	// the last line of each FROM instruction the arg is declared after
+	after := map[int]bool{}
+	for _, s := range d.Stages {
+		if stage == "" || strings.EqualFold(s.Name, stage) || stage == strconv.Itoa(s.Index) {
+			after[s.From.EndLine] = true
+		}
+	}
+	if len(after) == 0 {
+		return nil, fmt.Errorf("cache bust stage %q not found in the dockerfile", stage)
+	}
+
+	var out strings.Builder
+	for n, line := range strings.SplitAfter(string(content), "\n") {
+		out.WriteString(line)
+		if after[n+1] {
+			if !strings.HasSuffix(line, "\n") {
+				out.WriteString("\n")
+			}
+			out.WriteString("ARG " + cacheBustArg + "\n")
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// stageCacheBust writes the Dockerfile with the cache bust arg declared to
+// a temporary file, removed by the returned cleanup.
+func (b Build) stageCacheBust() (string, func(), error) {
+	content, err := ioutil.ReadFile(b.Dockerfile)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to read dockerfile")
+	}
+	content, err = injectCacheBust(content, b.CacheBustStage)
+	if err != nil {
+		return "", nil, err
+	}
+	parent := b.kanikoDir()
+	if _, err := os.Stat(parent); err != nil {
+		parent = ""
+	}
+	f, err := ioutil.TempFile(parent, "Dockerfile-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to create cache bust dockerfile")
+	}
+	defer f.Close()
+	if _, err := f.Write(content); err != nil {
+		os.Remove(f.Name())
+		return "", nil, errors.Wrap(err, "failed to write cache bust dockerfile")
+	}
+	return f.Name(), func() { os.Remove(f.Name()) }, nil
+}
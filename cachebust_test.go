@@ -0,0 +1,50 @@
+package kaniko
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+func TestInjectCacheBust(t *testing.T) {
+	dockerfile := "FROM golang:1.20 AS build\nRUN go build\n\nFROM --platform=linux/amd64 alpine\nCOPY --from=build /app /app"
+	tests := []struct {
+		stage string
+		want  string
+	}{
+		{"build", "FROM golang:1.20 AS build\nARG KANIKO_CACHE_BUST\nRUN go build\n\nFROM --platform=linux/amd64 alpine\nCOPY --from=build /app /app"},
+		{"1", "FROM golang:1.20 AS build\nRUN go build\n\nFROM --platform=linux/amd64 alpine\nARG KANIKO_CACHE_BUST\nCOPY --from=build /app /app"},
+		{"", "FROM golang:1.20 AS build\nARG KANIKO_CACHE_BUST\nRUN go build\n\nFROM --platform=linux/amd64 alpine\nARG KANIKO_CACHE_BUST\nCOPY --from=build /app /app"},
+	}
+	for _, tt := range tests {
+		got, err := injectCacheBust([]byte(dockerfile), tt.stage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("stage %q: got\n%s\nwant\n%s", tt.stage, got, tt.want)
+		}
+	}
+	if _, err := injectCacheBust([]byte(dockerfile), "test"); err == nil {
+		t.Errorf("expected error for an unknown stage")
+	}
+}
+
+func TestPlugin_ExecCacheBust(t *testing.T) {
+	b := testBuild(t)
+	b.CacheBust = "20240531"
+	runner := &fakeRunner{}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	args := runner.cmds[0].Args
+	if !contains(args, "--build-arg=KANIKO_CACHE_BUST=20240531") {
+		t.Errorf("expected the cache bust build arg in %v", args)
+	}
+	if contains(args, "--dockerfile="+b.Dockerfile) {
+		t.Errorf("expected the dockerfile with the cache bust arg, got %v", args)
+	}
+	if content, _ := ioutil.ReadFile(b.Dockerfile); string(content) != "FROM scratch\n" {
+		t.Errorf("expected the dockerfile to be unchanged, got %q", content)
+	}
+}
@@ -0,0 +1,149 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// defaultCacheTTL is the cache timeout of kaniko when no cache TTL is set.
+const defaultCacheTTL = 14 * 24 * time.Hour
+
+// cacheKeyTagRE matches the tags kaniko pushes cached layers to, the cache
+// key of the command, so other images in the repository are never deleted.
+var cacheKeyTagRE = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// cacheCleanupInterval is the pause between the requests of the cache
+// cleanup, to stay below the rate limits of the registry.
+var cacheCleanupInterval = 200 * time.Millisecond
+
+// cacheCleanupBudget is how long the cache cleanup inspects cached layers,
+// so large cache repositories do not hold up the build. Each cleanup starts
+// at a random tag, so later builds inspect the remaining layers.
+var cacheCleanupBudget = 2 * time.Minute
+
+// cacheTTL returns the cache timeout.
+func (b Build) cacheTTL() time.Duration {
+	if b.CacheTTL == 0 {
+		return defaultCacheTTL
+	}
+	return time.Duration(b.CacheTTL) * time.Hour
+}
+
+// cleanCache deletes the cached layers of the cache repository created
+// longer than the cache TTL ago, which kaniko no longer uses, up to the
+// cache cleanup limit. The cleanup is best effort: failures are printed and
+// do not change the outcome of the build.
+func (b Build) cleanCache(ctx context.Context) {
+	if b.CacheInsecure {
+		fmt.Fprintf(os.Stderr, "warning: cache cleanup is not supported for cache repositories accessed over http and is skipped\n")
+		return
+	}
+	deleted, err := b.deleteExpiredCache(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to clean cache repository %s: %s\n", b.CacheRepo, err)
+	}
+	if deleted > 0 {
+		fmt.Fprintf(os.Stdout, "Deleted %d cached layers older than %s from %s\n", deleted, b.cacheTTL(), b.CacheRepo)
+	}
+}
+
+// deleteExpiredCache deletes the expired cached layers and returns how many
+// were deleted.
+func (b Build) deleteExpiredCache(ctx context.Context) (int, error) {
+	repo, err := registry.ParseReference(b.CacheRepo)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid cache repository")
+	}
+	client := b.registryClient()
+	tags, err := client.Tags(ctx, repo)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list cached layers")
+	}
+
+	expiry := time.Now().Add(-b.cacheTTL())
+	deadline := time.Now().Add(cacheCleanupBudget)
+	deleted := 0
+	start := 0
+	if len(tags) > 0 {
+		start = rand.Intn(len(tags))
+	}
+	for i := range tags {
+		tag := tags[(start+i)%len(tags)]
+		if deleted >= b.CacheCleanupLimit && b.CacheCleanupLimit > 0 {
+			break
+		}
+		if !cacheKeyTagRE.MatchString(tag) {
+			continue
+		}
+		if time.Now().After(deadline) {
+			fmt.Fprintf(os.Stdout, "Cache cleanup of %s stopped after %s, later builds inspect the remaining cached layers\n", b.CacheRepo, cacheCleanupBudget)
+			break
+		}
+		if err := pause(ctx, cacheCleanupInterval); err != nil {
+			return deleted, err
+		}
+		ref := repo
+		ref.Tag = tag
+		created, digest, err := cacheCreated(ctx, client, ref)
+		if err != nil {
+			return deleted, errors.Wrap(err, fmt.Sprintf("failed to inspect cached layer %s", tag))
+		}
+		if created.IsZero() || created.After(expiry) {
+			continue
+		}
+		ref.Digest = digest
+		if err := client.Delete(ctx, ref); err != nil {
+			return deleted, errors.Wrap(err, fmt.Sprintf("failed to delete cached layer %s", tag))
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// cacheCreated returns the creation time kaniko checks the cache TTL
+// against, from the image config of the cached layer, and the manifest
+// digest.
+func cacheCreated(ctx context.Context, client *registry.Client, ref registry.Reference) (time.Time, string, error) {
+	manifest, desc, err := client.Manifest(ctx, ref)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if manifest.IsIndex() {
+		return time.Time{}, desc.Digest, nil
+	}
+	blob, err := client.Blob(ctx, ref, manifest.Config.Digest)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	defer blob.Close()
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := json.NewDecoder(blob).Decode(&config); err != nil {
+		return time.Time{}, "", errors.Wrap(err, "failed to decode image config")
+	}
+	return config.Created, desc.Digest, nil
+}
+
+// pause waits for d, or until ctx is done.
+func pause(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
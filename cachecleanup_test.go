@@ -0,0 +1,101 @@
+package kaniko
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuild_cleanCache(t *testing.T) {
+	defer func(d time.Duration) { cacheCleanupInterval = d }(cacheCleanupInterval)
+	cacheCleanupInterval = 0
+
+	key := func(n int) string { return strings.Repeat(fmt.Sprint(n), 64) }
+	created := map[string]time.Time{
+		key(1):   time.Now().Add(-30 * 24 * time.Hour),
+		key(2):   time.Now().Add(-time.Hour),
+		key(3):   time.Now().Add(-20 * 24 * time.Hour),
+		"latest": time.Now().Add(-30 * 24 * time.Hour),
+	}
+	digests := map[string]string{}
+	configs := map[string]string{}
+	manifests := map[string]string{}
+	for tag, at := range created {
+		config := fmt.Sprintf(`{"created": %q}`, at.Format(time.RFC3339))
+		sum := sha256.Sum256([]byte(config))
+		configDigest := "sha256:" + hex.EncodeToString(sum[:])
+		configs[configDigest] = config
+		manifest := fmt.Sprintf(`{"schemaVersion": 2, "mediaType": %q, "config": {"digest": %q}}`, registry.MediaTypeDockerManifest, configDigest)
+		sum = sha256.Sum256([]byte(manifest))
+		digests[tag] = "sha256:" + hex.EncodeToString(sum[:])
+		manifests[tag] = manifest
+	}
+
+	var mu sync.Mutex
+	var deleted []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := strings.TrimPrefix(r.URL.Path, "/v2/cache/")
+		switch {
+		case r.Method == http.MethodGet && path == "tags/list":
+			w.Write([]byte(fmt.Sprintf(`{"tags": ["latest", %q, %q, %q]}`, key(1), key(2), key(3))))
+		case r.Method == http.MethodGet && strings.HasPrefix(path, "manifests/"):
+			w.Header().Set("Content-Type", registry.MediaTypeDockerManifest)
+			w.Write([]byte(manifests[strings.TrimPrefix(path, "manifests/")]))
+		case r.Method == http.MethodGet && strings.HasPrefix(path, "blobs/"):
+			w.Write([]byte(configs[strings.TrimPrefix(path, "blobs/")]))
+		case r.Method == http.MethodDelete && strings.HasPrefix(path, "manifests/"):
+			deleted = append(deleted, strings.TrimPrefix(path, "manifests/"))
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	b := Build{CacheRepo: host.Host + "/cache", SkipTlsVerify: true, DockerConfigDir: t.TempDir()}
+	b.cleanCache(context.Background())
+	want := []string{digests[key(1)], digests[key(3)]}
+	sort.Strings(want)
+	sort.Strings(deleted)
+	if diff := cmp.Diff(want, deleted); diff != "" {
+		t.Errorf("deleted mismatch (-want +got):\n%s", diff)
+	}
+
+	deleted = nil
+	b.CacheTTL = 24 * 40
+	b.cleanCache(context.Background())
+	if len(deleted) != 0 {
+		t.Errorf("expected nothing deleted within the cache ttl, got %v", deleted)
+	}
+
+	b.CacheTTL = 0
+	b.CacheCleanupLimit = 1
+	b.cleanCache(context.Background())
+	if len(deleted) != 1 {
+		t.Errorf("expected the cleanup limited to 1 layer, got %v", deleted)
+	}
+
+	deleted = nil
+	b.CacheCleanupLimit = 0
+	defer func(d time.Duration) { cacheCleanupBudget = d }(cacheCleanupBudget)
+	cacheCleanupBudget = -time.Second
+	b.cleanCache(context.Background())
+	if len(deleted) != 0 {
+		t.Errorf("expected nothing inspected once the time budget is spent, got %v", deleted)
+	}
+}
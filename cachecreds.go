@@ -0,0 +1,83 @@
+package kaniko
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// httpsPort is the port appended to the registry of a cache repository that
+// shares its registry with the repository.
+const httpsPort = "443"
+
+// writeCacheCredentials writes the cache credentials for the registry of the
+// cache repository to the docker config file, and returns the cache
+// repository to use. kaniko selects credentials by registry host, so a cache
+// repository on the registry of the repository is addressed through the
+// explicit https port, which gives it a docker config entry of its own.
+func (b Build) writeCacheCredentials() (string, error) {
+	if b.CacheUsername == "" && b.CachePassword == "" {
+		return b.CacheRepo, nil
+	}
+	if !b.EnableCache {
+		return b.CacheRepo, nil
+	}
+	if b.CacheRepo == "" || strings.HasSuffix(b.CacheRepo, "/") {
+		return "", fmt.Errorf("cache repository must be specified with cache credentials")
+	}
+	if b.CacheUsername == "" || b.CachePassword == "" {
+		return "", fmt.Errorf("cache username and password must be specified together")
+	}
+
+	cacheRepo, host, err := b.cacheCredentialRepo()
+	if err != nil {
+		return "", err
+	}
+	if host == registry.DockerHub {
+		host = docker.RegistryV1
+	}
+	config := docker.NewConfig()
+	config.SetAuth(host, b.CacheUsername, b.CachePassword)
+	content, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	if err := docker.WriteConfigFile(b.dockerConfigPath(), content, docker.MergeStrategyMerge); err != nil {
+		return "", errors.Wrap(err, "failed to write cache credentials")
+	}
+	return cacheRepo, nil
+}
+
+// cacheCredentialRepo returns the cache repository and the registry host its
+// credentials are stored for.
+func (b Build) cacheCredentialRepo() (string, string, error) {
+	cache, err := registry.ParseReference(b.CacheRepo)
+	if err != nil {
+		return "", "", errors.Wrap(err, "invalid cache repository")
+	}
+	if b.Repo == "" {
+		return b.CacheRepo, cache.Registry, nil
+	}
+	repo, err := registry.ParseReference(b.Repo)
+	if err != nil || repo.Registry != cache.Registry {
+		return b.CacheRepo, cache.Registry, nil
+	}
+	if cache.Registry == registry.DockerHub || strings.Contains(cache.Registry, ":") {
+		return "", "", fmt.Errorf("cache credentials for %s require the cache repository in another registry, as credentials are selected by registry host", cache.Registry)
+	}
+	host := cache.Registry + ":" + httpsPort
+	return host + "/" + cache.Repository, host, nil
+}
+
+// cacheRegistry returns the registry host of the cache repository.
+func (b Build) cacheRegistry() string {
+	cache, err := registry.ParseReference(b.CacheRepo)
+	if err != nil {
+		return ""
+	}
+	return cache.Registry
+}
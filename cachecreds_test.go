@@ -0,0 +1,76 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuild_writeCacheCredentials(t *testing.T) {
+	tests := []struct {
+		repo, cacheRepo string
+		wantRepo        string
+		wantHost        string
+		wantErr         bool
+	}{
+		{"harbor.example.com/team/app", "cache.example.com/app", "cache.example.com/app", "cache.example.com", false},
+		{"harbor.example.com/team/app", "harbor.example.com/cache/app", "harbor.example.com:443/cache/app", "harbor.example.com:443", false},
+		{"foo/app", "cache.example.com/app", "cache.example.com/app", "cache.example.com", false},
+		{"registry.example.com:5000/app", "registry.example.com:5000/cache", "", "", true},
+		{"foo/app", "foo/cache", "", "", true},
+		{"harbor.example.com/team/app", "harbor.example.com/", "", "", true},
+	}
+	for _, test := range tests {
+		b := Build{
+			Repo:            test.repo,
+			CacheRepo:       test.cacheRepo,
+			EnableCache:     true,
+			CacheUsername:   "cache",
+			CachePassword:   "secret",
+			DockerConfigDir: t.TempDir(),
+		}
+		path := filepath.Join(b.DockerConfigDir, "config.json")
+		if err := ioutil.WriteFile(path, []byte(`{"auths": {"harbor.example.com": {"auth": "cHVzaDpwdXNo"}}}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cacheRepo, err := b.writeCacheCredentials()
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.cacheRepo)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.cacheRepo, err)
+			continue
+		}
+		if cacheRepo != test.wantRepo {
+			t.Errorf("%s: want cache repo %s, got %s", test.cacheRepo, test.wantRepo, cacheRepo)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := docker.NewConfig()
+		if err := config.UnmarshalJSON(data); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]docker.Auth{
+			"harbor.example.com": {Auth: "cHVzaDpwdXNo"},
+			test.wantHost:        {Auth: "Y2FjaGU6c2VjcmV0"},
+		}
+		if diff := cmp.Diff(want, config.Auths); diff != "" {
+			t.Errorf("%s: auths mismatch (-want +got):\n%s", test.cacheRepo, diff)
+		}
+	}
+}
+
+func TestBuild_writeCacheCredentialsUnset(t *testing.T) {
+	b := Build{Repo: "foo/app", CacheRepo: "foo/cache", EnableCache: true}
+	if cacheRepo, err := b.writeCacheCredentials(); err != nil || cacheRepo != "foo/cache" {
+		t.Errorf("expected the cache repo unchanged, got %s, %v", cacheRepo, err)
+	}
+}
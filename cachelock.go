@@ -0,0 +1,348 @@
+package kaniko
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/drone/drone-kaniko/pkg/state"
+	"github.com/pkg/errors"
+)
+
+// CacheLockRegistry locks the cache repository with a tag of the cache
+// repository itself, instead of an object in a bucket or directory.
+const CacheLockRegistry = "registry"
+
+const (
+	// cacheLockTag is the tag of the cache repository holding the lock.
+	cacheLockTag = "kaniko-cache-lock"
+	// cacheLockType is the artifact type of the lock pushed to the tag.
+	cacheLockType = "application/vnd.drone.kaniko.cache-lock.v1+json"
+	// cacheLockAnnotation is the annotation of the lock manifest holding the
+	// lease.
+	cacheLockAnnotation = "io.drone.kaniko.cache-lock"
+)
+
+// cacheLockKeyRE matches the characters of the cache repository replaced in
+// the key of the lock object.
+var cacheLockKeyRE = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+var (
+	// cacheLockLease is how long the lock is held without being renewed, so
+	// the lock of a killed build expires.
+	cacheLockLease = 5 * time.Minute
+	// cacheLockPoll is the pause between attempts to take a held lock.
+	cacheLockPoll = 10 * time.Second
+	// cacheLockSettle is how long a lock pushed to the registry is left to
+	// settle before checking no other build overwrote it, as tags cannot be
+	// created exclusively.
+	cacheLockSettle = 2 * time.Second
+)
+
+// cacheLease is the content of the lock: the build holding it and when it
+// expires unless renewed.
+type cacheLease struct {
+	Holder  string    `json:"holder"`
+	Build   string    `json:"build,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// expired returns true when the lease is no longer held.
+func (l cacheLease) expired() bool {
+	return !time.Now().Before(l.Expires)
+}
+
+// holder describes the build holding the lease.
+func (l cacheLease) holder() string {
+	switch {
+	case l.Build != "":
+		return l.Build
+	case l.Holder != "":
+		return l.Holder
+	default:
+		return "another build"
+	}
+}
+
+// cacheLocker takes, renews and releases the lease of the cache lock.
+type cacheLocker interface {
+	// acquire takes the lease unless another build holds it, and returns
+	// the lease held otherwise.
+	acquire(ctx context.Context, lease cacheLease) (bool, cacheLease, error)
+	renew(ctx context.Context, lease cacheLease) error
+	release(ctx context.Context, lease cacheLease) error
+}
+
+// checkCacheLock validates the cache lock settings.
+func (b Build) checkCacheLock() error {
+	if b.CacheLock == "" {
+		return nil
+	}
+	if !b.EnableCache || b.CacheRepo == "" {
+		return fmt.Errorf("cache lock needs enable-cache and a cache repository")
+	}
+	if b.CacheLockTimeout < 0 {
+		return fmt.Errorf("invalid cache lock timeout %s", b.CacheLockTimeout)
+	}
+	_, err := b.cacheLocker()
+	return err
+}
+
+// cacheLocker returns the locker of the cache lock setting: a tag of the
+// cache repository, or an object in a bucket or a shared directory.
+func (b Build) cacheLocker() (cacheLocker, error) {
+	if b.CacheLock == CacheLockRegistry {
+		if b.CacheInsecure {
+			return nil, fmt.Errorf("the registry cache lock is not supported for cache repositories accessed over http, lock with a bucket instead")
+		}
+		ref, err := registry.ParseReference(b.CacheRepo)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid cache repository")
+		}
+		ref.Tag, ref.Digest = cacheLockTag, ""
+		return registryLock{client: b.registryClient(), ref: ref}, nil
+	}
+	store, err := state.Open(b.CacheLock)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cache lock")
+	}
+	exclusive, ok := store.(state.ExclusiveStore)
+	if !ok {
+		return nil, fmt.Errorf("unsupported cache lock %q", b.CacheLock)
+	}
+	key := "cache-locks/" + cacheLockKeyRE.ReplaceAllString(b.CacheRepo, "_") + ".json"
+	return &storeLock{store: exclusive, key: key}, nil
+}
+
+// lockCache takes the lock of the cache repository, waiting up to the cache
+// lock timeout while other builds hold it, and renews it until the returned
+// function releases it. It returns false when the timeout passed and the
+// cache lock skip is set, for the build to only read the cache.
+func (b Build) lockCache(ctx context.Context) (func(), bool, error) {
+	locker, err := b.cacheLocker()
+	if err != nil {
+		return nil, false, err
+	}
+	lease := cacheLease{Holder: cacheLockHolder(), Build: os.Getenv("DRONE_BUILD_LINK")}
+
+	deadline := time.Now().Add(b.CacheLockTimeout)
+	waiting := false
+	for {
+		lease.Expires = time.Now().Add(cacheLockLease)
+		ok, held, err := locker.acquire(ctx, lease)
+		if err != nil {
+			return nil, false, errors.Wrap(err, fmt.Sprintf("failed to lock cache repository %s", b.CacheRepo))
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			if b.CacheLockSkip {
+				fmt.Fprintf(os.Stderr, "warning: cache repository %s is still locked by %s after %s, building without writing to the cache\n", b.CacheRepo, held.holder(), b.CacheLockTimeout)
+				return func() {}, false, nil
+			}
+			return nil, false, fmt.Errorf("cache repository %s is still locked by %s after %s", b.CacheRepo, held.holder(), b.CacheLockTimeout)
+		}
+		if !waiting {
+			fmt.Fprintf(os.Stdout, "Waiting for the lock of cache repository %s held by %s\n", b.CacheRepo, held.holder())
+			waiting = true
+		}
+		if err := pause(ctx, cacheLockPoll); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// renew the lease while the build runs, so it does not expire
+	renewCtx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for pause(renewCtx, cacheLockLease/3) == nil {
+			lease.Expires = time.Now().Add(cacheLockLease)
+			if err := locker.renew(renewCtx, lease); err != nil && renewCtx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "failed to renew the lock of cache repository %s: %s\n", b.CacheRepo, err)
+			}
+		}
+	}()
+	var once sync.Once
+	unlock := func() {
+		once.Do(func() {
+			stop()
+			<-done
+			if err := locker.release(context.Background(), lease); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to release the lock of cache repository %s, it expires in %s: %s\n", b.CacheRepo, cacheLockLease, err)
+			}
+		})
+	}
+	return unlock, true, nil
+}
+
+// cacheLockHolder returns a unique name of this build for the lease.
+func cacheLockHolder() string {
+	host, _ := os.Hostname()
+	random := make([]byte, 8)
+	rand.Read(random)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(random))
+}
+
+// storeLock locks with an object created exclusively in a store. The lease
+// is only renewed, released or taken over at the version last read or
+// written, so a build never overwrites the lease of another.
+type storeLock struct {
+	store state.ExclusiveStore
+	key   string
+
+	// version of the lease written by this build
+	version string
+}
+
+func (l *storeLock) acquire(ctx context.Context, lease cacheLease) (bool, cacheLease, error) {
+	content, err := json.Marshal(lease)
+	if err != nil {
+		return false, cacheLease{}, err
+	}
+	version, err := l.store.Create(ctx, l.key, content)
+	if err != state.ErrExists {
+		l.version = version
+		return err == nil, cacheLease{}, err
+	}
+	data, current, err := l.store.GetVersion(ctx, l.key)
+	if err == state.ErrNotFound {
+		// released meanwhile, taken at the next attempt
+		return false, cacheLease{}, nil
+	}
+	if err != nil {
+		return false, cacheLease{}, err
+	}
+	var held cacheLease
+	if err := json.Unmarshal(data, &held); err == nil && !held.expired() {
+		return false, held, nil
+	}
+	// the holder was killed, or the lock is corrupt, take it over unless
+	// another build does first
+	version, err = l.store.Replace(ctx, l.key, content, current)
+	if err == state.ErrChanged {
+		return false, held, nil
+	}
+	if err != nil {
+		return false, held, err
+	}
+	l.version = version
+	return true, held, nil
+}
+
+func (l *storeLock) renew(ctx context.Context, lease cacheLease) error {
+	content, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	version, err := l.store.Replace(ctx, l.key, content, l.version)
+	if err == state.ErrChanged {
+		return fmt.Errorf("the lease expired and was taken over by another build")
+	}
+	if err != nil {
+		return err
+	}
+	l.version = version
+	return nil
+}
+
+func (l *storeLock) release(ctx context.Context, lease cacheLease) error {
+	err := l.store.Delete(ctx, l.key, l.version)
+	if err == state.ErrChanged {
+		// another build took the expired lease over, it is not ours to delete
+		return nil
+	}
+	return err
+}
+
+// registryLock locks with a tag of the cache repository. As registries
+// cannot create tags exclusively, the lease is pushed when the tag is free,
+// and held once it was not overwritten by another build while settling.
+type registryLock struct {
+	client *registry.Client
+	ref    registry.Reference
+}
+
+func (l registryLock) acquire(ctx context.Context, lease cacheLease) (bool, cacheLease, error) {
+	held, err := l.read(ctx)
+	if err != nil {
+		return false, cacheLease{}, err
+	}
+	if held.Holder != "" && held.Holder != lease.Holder && !held.expired() {
+		return false, held, nil
+	}
+	if err := l.push(ctx, lease); err != nil {
+		return false, cacheLease{}, err
+	}
+	if err := pause(ctx, cacheLockSettle); err != nil {
+		return false, cacheLease{}, err
+	}
+	if held, err = l.read(ctx); err != nil {
+		return false, cacheLease{}, err
+	}
+	return held.Holder == lease.Holder, held, nil
+}
+
+func (l registryLock) renew(ctx context.Context, lease cacheLease) error {
+	if err := l.check(ctx, lease); err != nil {
+		return err
+	}
+	return l.push(ctx, lease)
+}
+
+// release pushes an expired lease rather than deleting the tag, as deleting
+// needs permissions, or is not supported, on many registries.
+func (l registryLock) release(ctx context.Context, lease cacheLease) error {
+	if err := l.check(ctx, lease); err != nil {
+		return err
+	}
+	lease.Expires = time.Unix(0, 0).UTC()
+	return l.push(ctx, lease)
+}
+
+// check returns an error when the tag holds the lease of another build, so
+// a build whose lease was taken over never overwrites it.
+func (l registryLock) check(ctx context.Context, lease cacheLease) error {
+	held, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+	if held.Holder != lease.Holder {
+		return fmt.Errorf("the lease expired and was taken over by another build")
+	}
+	return nil
+}
+
+// read returns the lease of the tag, empty when the tag does not exist.
+func (l registryLock) read(ctx context.Context) (cacheLease, error) {
+	manifest, _, err := l.client.Manifest(ctx, l.ref)
+	if err == registry.ErrNotFound {
+		return cacheLease{}, nil
+	}
+	if err != nil {
+		return cacheLease{}, err
+	}
+	var lease cacheLease
+	if value, ok := manifest.Annotations[cacheLockAnnotation]; ok {
+		// a corrupt lease is free to take
+		json.Unmarshal([]byte(value), &lease)
+	}
+	return lease, nil
+}
+
+func (l registryLock) push(ctx context.Context, lease cacheLease) error {
+	content, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	_, err = l.client.PushAnnotations(ctx, l.ref, cacheLockType, map[string]string{cacheLockAnnotation: string(content)})
+	return err
+}
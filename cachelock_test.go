@@ -0,0 +1,220 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/drone/drone-kaniko/pkg/state"
+)
+
+func TestBuild_lockCache(t *testing.T) {
+	saved := cacheLockPoll
+	cacheLockPoll = 10 * time.Millisecond
+	defer func() { cacheLockPoll = saved }()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	b := Build{EnableCache: true, CacheRepo: "registry.example.com/app/cache", CacheLock: dir, CacheLockTimeout: 50 * time.Millisecond}
+	if err := b.checkCacheLock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock, locked, err := b.lockCache(ctx)
+	if err != nil || !locked {
+		t.Fatalf("expected the lock to be taken, got %v, %v", locked, err)
+	}
+	if _, err := state.Dir(dir).Get(ctx, "cache-locks/registry.example.com_app_cache.json"); err != nil {
+		t.Errorf("expected the lock object, got %v", err)
+	}
+
+	// another build times out, or builds without writing to the cache
+	if _, _, err := b.lockCache(ctx); err == nil || !strings.Contains(err.Error(), "still locked") {
+		t.Errorf("expected a timeout while the lock is held, got %v", err)
+	}
+	skip := b
+	skip.CacheLockSkip = true
+	if _, locked, err := skip.lockCache(ctx); err != nil || locked {
+		t.Errorf("expected to build without the lock, got %v, %v", locked, err)
+	}
+
+	unlock()
+	unlock()
+	unlock, locked, err = b.lockCache(ctx)
+	if err != nil || !locked {
+		t.Fatalf("expected the released lock to be taken, got %v, %v", locked, err)
+	}
+	unlock()
+}
+
+func TestBuild_lockCache_expired(t *testing.T) {
+	saved := cacheLockPoll
+	cacheLockPoll = 10 * time.Millisecond
+	defer func() { cacheLockPoll = saved }()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	// the lease of a killed build
+	expired, _ := json.Marshal(cacheLease{Holder: "killed", Expires: time.Now().Add(-time.Minute)})
+	if _, err := state.Dir(dir).Create(ctx, "cache-locks/app_cache.json", expired); err != nil {
+		t.Fatal(err)
+	}
+	b := Build{EnableCache: true, CacheRepo: "app/cache", CacheLock: dir, CacheLockTimeout: time.Second}
+	unlock, locked, err := b.lockCache(ctx)
+	if err != nil || !locked {
+		t.Fatalf("expected the expired lock to be taken over, got %v, %v", locked, err)
+	}
+	unlock()
+}
+
+func TestStoreLock_takeover(t *testing.T) {
+	ctx := context.Background()
+	store := state.Dir(t.TempDir())
+	expired, _ := json.Marshal(cacheLease{Holder: "killed", Expires: time.Now().Add(-time.Minute)})
+	if _, err := store.Create(ctx, "lock.json", expired); err != nil {
+		t.Fatal(err)
+	}
+
+	// builds waiting for the lease of a killed build take it over at once,
+	// only one of them may hold it
+	const builds = 8
+	locks := make([]*storeLock, builds)
+	taken := make([]bool, builds)
+	var wg sync.WaitGroup
+	for i := range locks {
+		locks[i] = &storeLock{store: store, key: "lock.json"}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lease := cacheLease{Holder: fmt.Sprintf("build-%d", i), Expires: time.Now().Add(time.Minute)}
+			ok, _, err := locks[i].acquire(ctx, lease)
+			if err != nil {
+				t.Error(err)
+			}
+			taken[i] = ok
+		}(i)
+	}
+	wg.Wait()
+	holder := -1
+	for i, ok := range taken {
+		if ok && holder >= 0 {
+			t.Fatalf("expected a single holder, got builds %d and %d", holder, i)
+		}
+		if ok {
+			holder = i
+		}
+	}
+	if holder < 0 {
+		t.Fatal("expected the expired lease to be taken over")
+	}
+	data, _ := store.Get(ctx, "lock.json")
+	var held cacheLease
+	if err := json.Unmarshal(data, &held); err != nil || held.Holder != fmt.Sprintf("build-%d", holder) {
+		t.Errorf("expected the lease of build %d, got %s", holder, data)
+	}
+
+	// a build whose lease was taken over neither renews nor releases it
+	stale := &storeLock{store: store, key: "lock.json", version: "outdated"}
+	if err := stale.renew(ctx, cacheLease{Holder: "stale", Expires: time.Now().Add(time.Minute)}); err == nil {
+		t.Error("expected renewing a lease taken over to fail")
+	}
+	if err := stale.release(ctx, cacheLease{Holder: "stale"}); err != nil {
+		t.Error(err)
+	}
+	if after, _ := store.Get(ctx, "lock.json"); string(after) != string(data) {
+		t.Errorf("expected the lease of the holder to be kept, got %s", after)
+	}
+	if err := locks[holder].renew(ctx, cacheLease{Holder: held.Holder, Expires: time.Now().Add(time.Minute)}); err != nil {
+		t.Errorf("expected the holder to renew the lease, got %v", err)
+	}
+	if err := locks[holder].release(ctx, held); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.Exists(ctx, "lock.json"); ok {
+		t.Error("expected the released lease to be deleted")
+	}
+}
+
+func TestRegistryLock_takeover(t *testing.T) {
+	var mu sync.Mutex
+	var manifest []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead && strings.Contains(r.URL.Path, "/blobs/"):
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/manifests/"+cacheLockTag) && manifest != nil:
+			w.Header().Set("Content-Type", registry.MediaTypeOCIManifest)
+			w.Write(manifest)
+		case r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/manifests/"+cacheLockTag):
+			manifest, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := registry.NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+	lock := registryLock{client: client, ref: registry.Reference{Registry: host.Host, Repository: "app/cache", Tag: cacheLockTag}}
+
+	ctx := context.Background()
+	stale := cacheLease{Holder: "stale", Expires: time.Now().Add(time.Minute)}
+	if err := lock.push(ctx, stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.renew(ctx, stale); err != nil {
+		t.Errorf("expected the holder to renew the lease, got %v", err)
+	}
+
+	// the lease expired while the renewals of the stale build stalled, and
+	// another build took it over
+	holder := cacheLease{Holder: "holder", Expires: time.Now().Add(time.Minute)}
+	if err := lock.push(ctx, holder); err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.renew(ctx, stale); err == nil {
+		t.Error("expected renewing a lease taken over to fail")
+	}
+	if err := lock.release(ctx, stale); err == nil {
+		t.Error("expected releasing a lease taken over to fail")
+	}
+	if held, err := lock.read(ctx); err != nil || held.Holder != "holder" || held.expired() {
+		t.Errorf("expected the lease of the holder to be kept, got %+v, %v", held, err)
+	}
+	if err := lock.release(ctx, holder); err != nil {
+		t.Fatal(err)
+	}
+	if held, err := lock.read(ctx); err != nil || !held.expired() {
+		t.Errorf("expected the released lease to expire, got %+v, %v", held, err)
+	}
+}
+
+func TestBuild_checkCacheLock(t *testing.T) {
+	for _, b := range []Build{
+		{CacheLock: CacheLockRegistry, CacheRepo: "app/cache"},
+		{CacheLock: CacheLockRegistry, EnableCache: true},
+		{CacheLock: CacheLockRegistry, EnableCache: true, CacheRepo: "app/cache", CacheInsecure: true},
+		{CacheLock: "ftp://locks", EnableCache: true, CacheRepo: "app/cache"},
+		{CacheLock: filepath.Join(t.TempDir(), "locks"), EnableCache: true, CacheRepo: "app/cache", CacheLockTimeout: -time.Second},
+	} {
+		if err := b.checkCacheLock(); err == nil {
+			t.Errorf("expected error for %+v", b)
+		}
+	}
+	if err := (Build{CacheLock: CacheLockRegistry, EnableCache: true, CacheRepo: "app/cache"}).checkCacheLock(); err != nil {
+		t.Error(err)
+	}
+}
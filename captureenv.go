@@ -0,0 +1,75 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/diagnostics"
+	"github.com/drone/drone-kaniko/pkg/redact"
+)
+
+// labelEnvPrefix prefixes the labels recording captured environment
+// variables, followed by the lowercased variable name.
+const labelEnvPrefix = "io.drone.kaniko.env."
+
+// captureEnv returns the environment variables matching the capture
+// allowlist, sorted by name. Variables named like secrets, matching the
+// denylist, or holding a known credential or a match of the redact patterns
+// are refused with a warning.
+func (b Build) captureEnv() [][2]string {
+	if len(b.CaptureEnv) == 0 {
+		return nil
+	}
+	patterns, _ := redact.Compile(b.RedactPatterns)
+	secrets := b.knownSecrets()
+
+	var captured [][2]string
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[1] == "" || !matchesAny(b.CaptureEnv, parts[0]) {
+			continue
+		}
+		name, value := parts[0], parts[1]
+		refused := diagnostics.IsSensitive(name) || matchesAny(b.CaptureEnvDeny, name) || contains(secrets, value)
+		for _, re := range patterns {
+			refused = refused || re.MatchString(value)
+		}
+		if refused {
+			fmt.Fprintf(os.Stderr, "refusing to capture environment variable %s, it may hold a secret\n", name)
+			continue
+		}
+		captured = append(captured, [2]string{name, value})
+	}
+	sort.Slice(captured, func(i, j int) bool { return captured[i][0] < captured[j][0] })
+	return captured
+}
+
+// envLabels returns labels recording the captured environment variables,
+// except those whose label is set explicitly.
+func (b Build) envLabels() []string {
+	explicit := map[string]bool{}
+	for _, label := range b.Labels {
+		explicit[strings.SplitN(label, "=", 2)[0]] = true
+	}
+	var labels []string
+	for _, env := range b.capturedEnv {
+		key := labelEnvPrefix + strings.ToLower(env[0])
+		if !explicit[key] {
+			labels = append(labels, key+"="+env[1])
+		}
+	}
+	return labels
+}
+
+// matchesAny returns true when name matches one of the glob patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
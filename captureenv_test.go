@@ -0,0 +1,40 @@
+package kaniko
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuild_captureEnv(t *testing.T) {
+	t.Setenv("CI_PIPELINE_ID", "1234")
+	t.Setenv("CI_PIPELINE_URL", "https://ci.example.com/1234")
+	t.Setenv("CI_PIPELINE_TRIGGER", "schedule")
+	t.Setenv("CI_JOB_TOKEN", "secret-value")
+	t.Setenv("CI_RUNNER_NOTE", "ghp_0123456789")
+	t.Setenv("CI_EMPTY", "")
+
+	b := Build{
+		CaptureEnv:     []string{"CI_PIPELINE_*", "CI_JOB_TOKEN", "CI_RUNNER_NOTE", "CI_EMPTY"},
+		CaptureEnvDeny: []string{"CI_PIPELINE_TRIGGER*"},
+		RedactPatterns: []string{`ghp_[0-9a-zA-Z]+`},
+	}
+	want := [][2]string{{"CI_PIPELINE_ID", "1234"}, {"CI_PIPELINE_URL", "https://ci.example.com/1234"}}
+	if diff := cmp.Diff(want, b.captureEnv()); diff != "" {
+		t.Errorf("captured env mismatch (-want +got):\n%s", diff)
+	}
+	if env := (Build{}).captureEnv(); env != nil {
+		t.Errorf("expected nothing captured without an allowlist, got %v", env)
+	}
+}
+
+func TestBuild_envLabels(t *testing.T) {
+	b := Build{
+		Labels:      []string{"io.drone.kaniko.env.ci_pipeline_id=override"},
+		capturedEnv: [][2]string{{"CI_PIPELINE_ID", "1234"}, {"CI_PIPELINE_URL", "https://ci.example.com/1234"}},
+	}
+	want := []string{"io.drone.kaniko.env.ci_pipeline_url=https://ci.example.com/1234"}
+	if diff := cmp.Diff(want, b.envLabels()); diff != "" {
+		t.Errorf("labels mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,100 @@
+package kaniko
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/buildlog"
+	"github.com/drone/drone-kaniko/pkg/card"
+	"github.com/drone/drone-kaniko/pkg/image"
+	"github.com/drone/drone-kaniko/pkg/units"
+)
+
+// cardSchema is the adaptive card template the Drone UI renders the card of
+// the build with.
+const cardSchema = "https://raw.githubusercontent.com/drone/drone-kaniko/main/docs/card.json"
+
+// buildCard is the data of the Drone card of the build.
+type buildCard struct {
+	Image        string   `json:"image"`
+	Tags         []string `json:"tags"`
+	Digest       string   `json:"digest,omitempty"`
+	Pushed       bool     `json:"pushed"`
+	Platform     string   `json:"platform,omitempty"`
+	Size         string   `json:"size,omitempty"`
+	Duration     string   `json:"duration,omitempty"`
+	CacheHits    int      `json:"cache_hits"`
+	CacheMisses  int      `json:"cache_misses"`
+	CacheHitRate string   `json:"cache_hit_rate,omitempty"`
+	ScanFindings *int     `json:"scan_findings,omitempty"`
+}
+
+// writeCard writes the Drone card summarising the built image. The size is
+// taken from the inspected image, or from the image tarball when the image
+// was not inspected. Failures are printed and do not fail the build.
+func (p Plugin) writeCard(summary *buildlog.Parser, img *image.Image, tags []string) {
+	c := buildCard{
+		Image:    p.Build.Repo,
+		Tags:     tags,
+		Digest:   getDigest(p.Build.DigestFile),
+		Pushed:   !p.Build.NoPush,
+		Platform: p.Build.Platform,
+	}
+	if img == nil && p.Build.TarPath != "" {
+		if tarball, err := image.FromTarball(p.Build.TarPath); err == nil {
+			img = &tarball
+		}
+	}
+	if img != nil {
+		var size int64
+		for _, layer := range img.Layers {
+			size += layer.Size
+		}
+		c.Size = units.FormatSize(size)
+	}
+	if summary != nil {
+		s := summary.Summary()
+		c.Duration = time.Duration(s.Seconds * float64(time.Second)).Round(time.Second).String()
+		c.CacheHits, c.CacheMisses = s.CacheHits, s.CacheMisses
+		if ratio := s.CacheRatio(); ratio >= 0 {
+			c.CacheHitRate = fmt.Sprintf("%.0f%%", ratio*100)
+		}
+	}
+	if p.Build.ScanReport != "" {
+		findings, err := countScanFindings(p.Build.ScanReport)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read scan report at path: %s with error: %s\n", p.Build.ScanReport, err)
+		} else {
+			c.ScanFindings = &findings
+		}
+	}
+	if err := card.Write(p.Build.CardPath, cardSchema, c); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write card at path: %s with error: %s\n", p.Build.CardPath, err)
+	}
+}
+
+// countScanFindings returns the number of vulnerabilities in a Trivy or
+// Grype JSON report.
+func countScanFindings(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var report struct {
+		Results []struct {
+			Vulnerabilities []json.RawMessage `json:"Vulnerabilities"`
+		} `json:"Results"` // Trivy
+		Matches []json.RawMessage `json:"matches"` // Grype
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return 0, err
+	}
+	findings := len(report.Matches)
+	for _, result := range report.Results {
+		findings += len(result.Vulnerabilities)
+	}
+	return findings, nil
+}
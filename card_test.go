@@ -0,0 +1,87 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCountScanFindings(t *testing.T) {
+	dir := t.TempDir()
+	reports := map[string]string{
+		"trivy.json": `{"Results":[{"Vulnerabilities":[{"VulnerabilityID":"CVE-1"},{"VulnerabilityID":"CVE-2"}]},{"Target":"app"}]}`,
+		"grype.json": `{"matches":[{"vulnerability":{"id":"CVE-1"}}]}`,
+	}
+	want := map[string]int{"trivy.json": 2, "grype.json": 1}
+	for name, content := range reports {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := countScanFindings(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want[name] {
+			t.Errorf("%s: got %d findings, want %d", name, got, want[name])
+		}
+	}
+}
+
+func TestPlugin_ExecCard(t *testing.T) {
+	b := testBuild(t)
+	b.NoPush = false
+	b.Repo = "example/app"
+	b.Tags = []string{"1.0"}
+	b.DigestFile = filepath.Join(t.TempDir(), "digest")
+	b.CardPath = filepath.Join(t.TempDir(), "card.json")
+	b.ScanReport = filepath.Join(t.TempDir(), "trivy.json")
+	if err := ioutil.WriteFile(b.ScanReport, []byte(`{"Results":[{"Vulnerabilities":[{}]}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(b.DigestFile, []byte("sha256:abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runner := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		cmd.Stdout.Write([]byte("INFO[0001] Using caching version of cmd: RUN make\nINFO[0002] No cached layer found for cmd RUN make test\n"))
+		return nil
+	}}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(b.CardPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Schema string
+		Data   buildCard
+	}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+	findings := 1
+	want := buildCard{
+		Image:        "example/app",
+		Tags:         []string{"1.0"},
+		Digest:       "sha256:abc",
+		Pushed:       true,
+		Duration:     got.Data.Duration,
+		CacheHits:    1,
+		CacheMisses:  1,
+		CacheHitRate: "50%",
+		ScanFindings: &findings,
+	}
+	if got.Schema != cardSchema {
+		t.Errorf("got schema %s", got.Schema)
+	}
+	if diff := cmp.Diff(want, got.Data); diff != "" {
+		t.Errorf("card mismatch (-want +got):\n%s", diff)
+	}
+}
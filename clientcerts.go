@@ -0,0 +1,103 @@
+package kaniko
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// clientCertsDir is the directory, within the scratch directory, the
+// registry client certificates are staged in.
+const clientCertsDir = "client-certs"
+
+type clientCert struct {
+	registry string
+	cert     []byte
+	key      []byte
+}
+
+// parseClientCerts pairs the registry=source client certificates and keys,
+// the sources being read as for secrets, and validates each pair.
+func (b Build) parseClientCerts() ([]clientCert, error) {
+	certs, err := parseSecrets(b.RegistryClientCerts)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid registry client cert")
+	}
+	keys, err := parseSecrets(b.RegistryClientKeys)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid registry client key")
+	}
+
+	byRegistry := map[string][]byte{}
+	for _, key := range keys {
+		byRegistry[key.id] = key.value
+	}
+	var pairs []clientCert
+	for _, cert := range certs {
+		key, ok := byRegistry[cert.id]
+		if !ok {
+			return nil, fmt.Errorf("registry client cert for %s has no key", cert.id)
+		}
+		delete(byRegistry, cert.id)
+		if _, err := tls.X509KeyPair(cert.value, key); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid registry client cert for %s", cert.id))
+		}
+		pairs = append(pairs, clientCert{registry: cert.id, cert: cert.value, key: key})
+	}
+	for registry := range byRegistry {
+		return nil, fmt.Errorf("registry client key for %s has no cert", registry)
+	}
+	return pairs, nil
+}
+
+// clientCertificates returns the client certificate of each registry, for
+// the plugin's registry client. Invalid pairs are reported by Exec.
+func (b Build) clientCertificates() map[string]tls.Certificate {
+	pairs, err := b.parseClientCerts()
+	if err != nil || len(pairs) == 0 {
+		return nil
+	}
+	certs := map[string]tls.Certificate{}
+	for _, pair := range pairs {
+		if cert, err := tls.X509KeyPair(pair.cert, pair.key); err == nil {
+			certs[pair.registry] = cert
+		}
+	}
+	return certs
+}
+
+// stageClientCerts writes the client certificates to the kaniko directory,
+// returning the registry=cert,key values of --registry-client-cert. The
+// returned function removes the staged files.
+func (b Build) stageClientCerts() ([]string, func(), error) {
+	pairs, err := b.parseClientCerts()
+	if err != nil {
+		return nil, nil, err
+	}
+	dir := filepath.Join(b.scratchDir(), clientCertsDir)
+	cleanup := func() { os.RemoveAll(dir) }
+
+	var values []string
+	for _, pair := range pairs {
+		certDir := filepath.Join(dir, pair.registry)
+		if err := os.MkdirAll(certDir, 0700); err != nil {
+			cleanup()
+			return nil, nil, errors.Wrap(err, "failed to create client cert directory")
+		}
+		cert, key := filepath.Join(certDir, "client.cert"), filepath.Join(certDir, "client.key")
+		if err := ioutil.WriteFile(cert, pair.cert, 0600); err != nil {
+			cleanup()
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to stage client cert for %s", pair.registry))
+		}
+		if err := ioutil.WriteFile(key, pair.key, 0600); err != nil {
+			cleanup()
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("failed to stage client key for %s", pair.registry))
+		}
+		values = append(values, fmt.Sprintf("%s=%s,%s", pair.registry, cert, key))
+	}
+	return values, cleanup, nil
+}
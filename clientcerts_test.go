@@ -0,0 +1,100 @@
+package kaniko
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testClientCert returns a self-signed client certificate and its key.
+func testClientCert(t *testing.T) (cert, key string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "builder"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func TestBuild_parseClientCerts(t *testing.T) {
+	cert, key := testClientCert(t)
+	t.Setenv("REGISTRY_CERT", cert)
+	t.Setenv("REGISTRY_KEY", key)
+
+	tests := []struct {
+		certs, keys []string
+		valid       bool
+	}{
+		{certs: []string{"registry.example.com=REGISTRY_CERT"}, keys: []string{"registry.example.com=REGISTRY_KEY"}, valid: true},
+		{certs: []string{"registry.example.com=REGISTRY_CERT"}},
+		{keys: []string{"registry.example.com=REGISTRY_KEY"}},
+		{certs: []string{"registry.example.com=REGISTRY_KEY"}, keys: []string{"registry.example.com=REGISTRY_CERT"}},
+		{certs: []string{"registry.example.com=UNSET_CERT"}, keys: []string{"registry.example.com=REGISTRY_KEY"}},
+	}
+	for _, tc := range tests {
+		b := Build{RegistryClientCerts: tc.certs, RegistryClientKeys: tc.keys}
+		_, err := b.parseClientCerts()
+		if tc.valid && err != nil {
+			t.Errorf("%v %v: unexpected error %s", tc.certs, tc.keys, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%v %v: expected an error", tc.certs, tc.keys)
+		}
+	}
+}
+
+func TestPlugin_ExecClientCerts(t *testing.T) {
+	cert, key := testClientCert(t)
+	t.Setenv("REGISTRY_CERT", cert)
+
+	b := testBuild(t)
+	keyPath := filepath.Join(t.TempDir(), "client.key")
+	if err := ioutil.WriteFile(keyPath, []byte(key), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b.RegistryClientCerts = []string{"registry.example.com=REGISTRY_CERT"}
+	b.RegistryClientKeys = []string{"registry.example.com=" + keyPath}
+
+	dir := filepath.Join(b.KanikoDir, clientCertsDir, "registry.example.com")
+	runner := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		if staged, _ := ioutil.ReadFile(filepath.Join(dir, "client.key")); string(staged) != key {
+			t.Errorf("expected the key staged during the build, got %q", staged)
+		}
+		return nil
+	}}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := "--registry-client-cert=registry.example.com=" + filepath.Join(dir, "client.cert") + "," + filepath.Join(dir, "client.key")
+	if !contains(runner.cmds[0].Args, want) {
+		t.Errorf("expected argument %s in %v", want, runner.cmds[0].Args)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the client certs removed after the build, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/cmd/acr"
+	"github.com/drone/drone-kaniko/pkg/cmd/docker"
+	"github.com/drone/drone-kaniko/pkg/cmd/ecr"
+	"github.com/drone/drone-kaniko/pkg/cmd/gar"
+	"github.com/drone/drone-kaniko/pkg/cmd/gcr"
+	"github.com/drone/drone-kaniko/pkg/failure"
+)
+
+// registryTypeEnv selects the plugin when no subcommand is given.
+const registryTypeEnv = "PLUGIN_REGISTRY_TYPE"
+
+// plugins are the registry subcommands, the first is the default.
+var plugins = []struct {
+	name string
+	app  func() *cli.App
+}{
+	{"docker", docker.App},
+	{"ecr", ecr.App},
+	{"gcr", gcr.App},
+	{"gar", gar.App},
+	{"acr", acr.App},
+}
+
+func main() {
+	// Load env-file if it exists first
+	if env := os.Getenv("PLUGIN_ENV_FILE"); env != "" {
+		if err := godotenv.Load(env); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	app := cli.NewApp()
+	app.Name = "kaniko"
+	app.Usage = "kaniko plugin for docker, ecr, gcr, gar and acr registries"
+	for _, plugin := range plugins {
+		sub := plugin.app()
+		app.Commands = append(app.Commands, cli.Command{
+			Name:        plugin.name,
+			Usage:       sub.Usage,
+			Flags:       sub.Flags,
+			Action:      sub.Action,
+			Subcommands: sub.Commands,
+		})
+	}
+
+	args, err := withSubcommand(os.Args, os.Getenv(registryTypeEnv))
+	if err == nil {
+		err = app.Run(args)
+	}
+	if err != nil {
+		logrus.Error(err)
+		os.Exit(failure.ExitCode(err))
+	}
+}
+
+// withSubcommand inserts the subcommand of the registry type when the
+// arguments do not start with one, as when run as a Drone plugin.
+func withSubcommand(args []string, registryType string) ([]string, error) {
+	if len(args) > 1 {
+		switch args[1] {
+		case "help", "h", "--help", "-h", "--version", "-v":
+			return args, nil
+		}
+		for _, plugin := range plugins {
+			if args[1] == plugin.name {
+				return args, nil
+			}
+		}
+	}
+
+	name := plugins[0].name
+	if registryType != "" {
+		name = ""
+		for _, plugin := range plugins {
+			if registryType == plugin.name {
+				name = plugin.name
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("unsupported registry type %q", registryType)
+		}
+	}
+	return append([]string{args[0], name}, args[1:]...), nil
+}
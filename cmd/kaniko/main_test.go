@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithSubcommand(t *testing.T) {
+	tests := []struct {
+		args         []string
+		registryType string
+		want         []string
+		wantErr      bool
+	}{
+		{args: []string{"kaniko"}, want: []string{"kaniko", "docker"}},
+		{args: []string{"kaniko"}, registryType: "ecr", want: []string{"kaniko", "ecr"}},
+		{args: []string{"kaniko", "--tags", "latest"}, registryType: "gar", want: []string{"kaniko", "gar", "--tags", "latest"}},
+		{args: []string{"kaniko", "acr", "--tags", "latest"}, registryType: "ecr", want: []string{"kaniko", "acr", "--tags", "latest"}},
+		{args: []string{"kaniko", "--help"}, want: []string{"kaniko", "--help"}},
+		{args: []string{"kaniko"}, registryType: "quay", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := withSubcommand(tc.args, tc.registryType)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%v: error = %v, wantErr %v", tc.args, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && !reflect.DeepEqual(tc.want, got) {
+			t.Errorf("want %v, got %v", tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/drone/drone-kaniko/pkg/status"
+	"github.com/pkg/errors"
+)
+
+// execWithStatus runs the build and publishes its progress and result as
+// the status of the commit. Failures to publish are printed and do not
+// change the outcome of the build.
+func (p Plugin) execWithStatus(ctx context.Context) error {
+	p.publishStatus(ctx, status.Status{State: status.StatePending, Description: "Building " + p.Build.Repo})
+	err := p.exec(ctx)
+	if ctx.Err() != nil {
+		// the build was cancelled, and so is the request
+		return err
+	}
+	p.publishStatus(ctx, p.buildStatus(err))
+	return err
+}
+
+// publishStatus publishes the status of the commit.
+func (p Plugin) publishStatus(ctx context.Context, s status.Status) {
+	if err := status.Publish(ctx, p.Status, s); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to publish %s commit status: %s\n", s.State, err)
+	}
+}
+
+// buildStatus returns the status of the finished build: the failure
+// category, or the pushed digest and the number of scan findings.
+func (p Plugin) buildStatus(err error) status.Status {
+	if err != nil {
+		var f *failure.Error
+		if errors.As(err, &f) {
+			summary := f.Message
+			if f.Line != "" {
+				summary += "\n\n```\n" + f.Line + "\n```"
+			}
+			return status.Status{State: status.StateFailure, Description: "Build failed: " + string(f.Category), Summary: summary}
+		}
+		return status.Status{State: status.StateFailure, Description: "Build failed: " + strings.SplitN(err.Error(), "\n", 2)[0], Summary: err.Error()}
+	}
+
+	var description []string
+	summary := []string{"**Image:** " + p.Build.Repo}
+	digest := getDigest(p.Build.DigestFile)
+	switch {
+	case p.Build.NoPush:
+		description = append(description, "Built "+p.Build.Repo+" without pushing")
+	case digest != "":
+		description = append(description, "Pushed "+p.Build.Repo+"@"+digest)
+		summary = append(summary, "**Digest:** `"+digest+"`")
+	default:
+		description = append(description, "Built "+p.Build.Repo)
+	}
+	if p.Build.ScanReport != "" {
+		if findings, err := countScanFindings(p.Build.ScanReport); err == nil {
+			description = append(description, fmt.Sprintf("%d scan findings", findings))
+			summary = append(summary, fmt.Sprintf("**Scan findings:** %d", findings))
+		}
+	}
+	return status.Status{
+		State:       status.StateSuccess,
+		Description: strings.Join(description, ", "),
+		Summary:     strings.Join(summary, "\n\n"),
+	}
+}
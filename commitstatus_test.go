@@ -0,0 +1,59 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/status"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlugin_ExecStatus(t *testing.T) {
+	var got []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		got = append(got, map[string]string{"state": body["state"], "description": body["description"]})
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	b := testBuild(t)
+	b.NoPush = false
+	b.Repo = "octocat/app"
+	b.Tags = []string{"1.0"}
+	b.DigestFile = filepath.Join(t.TempDir(), "digest")
+	if err := ioutil.WriteFile(b.DigestFile, []byte("sha256:abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := New(b, WithRunner(&fakeRunner{}), WithStatus(status.Config{Provider: status.ProviderGitea, URL: server.URL, Token: "secret", Repo: "octocat/app", Commit: "abc123"}))
+	if err := p.Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"state": "pending", "description": "Building octocat/app"},
+		{"state": "success", "description": "Pushed octocat/app@sha256:abc"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("statuses mismatch (-want +got):\n%s", diff)
+	}
+
+	got = nil
+	p.Runner = &fakeRunner{run: func(cmd *exec.Cmd) error {
+		cmd.Stderr.Write([]byte("error building image: UNAUTHORIZED: authentication required\n"))
+		return errors.New("exit status 1")
+	}}
+	if err := p.Exec(context.Background()); err == nil {
+		t.Fatal("expected the build to fail")
+	}
+	if len(got) != 2 || got[1]["state"] != "failure" || got[1]["description"] != "Build failed: auth" {
+		t.Errorf("expected a failure status, got %v", got)
+	}
+}
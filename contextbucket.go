@@ -0,0 +1,97 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/contextpack"
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+	"github.com/drone/drone-kaniko/pkg/state"
+	"github.com/drone/drone-kaniko/pkg/units"
+)
+
+// checkContextBucket validates the context bucket is an S3 or GCS bucket,
+// which only kaniko reads contexts from.
+func (p Plugin) checkContextBucket() error {
+	if p.Backend.ContextBucket == "" {
+		return nil
+	}
+	if !strings.HasPrefix(p.Backend.ContextBucket, "s3://") && !strings.HasPrefix(p.Backend.ContextBucket, "gs://") {
+		return fmt.Errorf("invalid context bucket %q, expected s3://bucket or gs://bucket", p.Backend.ContextBucket)
+	}
+	if p.Build.builder() != BuilderKaniko {
+		return fmt.Errorf("the context bucket is not supported by the %s builder", p.Build.builder())
+	}
+	_, err := state.Open(p.Backend.ContextBucket)
+	return err
+}
+
+// uploadContext packages the local build context in dir, with the patterns
+// of its .dockerignore file applied, and uploads it to the context bucket
+// under the digest of the archive, so the executor does not need the
+// workspace. The upload is skipped when the bucket already holds the
+// archive, e.g. when a failed build is retried. It returns the remote
+// context and the Dockerfile path within it.
+func (p Plugin) uploadContext(ctx context.Context, store state.Store, dir string) (string, string, error) {
+	// the Dockerfile is resolved within the extracted context
+	dockerfile := p.Build.Dockerfile
+	var keep []string
+	if rel, ok := relativeTo(filepath.Join(p.Build.Context, p.Build.ContextSubPath), dockerfile); ok {
+		dockerfile = rel
+		keep = append(keep, rel)
+	}
+	ignore, err := dockerignore.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return "", "", err
+	}
+	keep = append(keep, ".dockerignore")
+
+	tmpDir := p.Build.kanikoDir()
+	if _, err := os.Stat(tmpDir); err != nil {
+		tmpDir = ""
+	}
+	archive, digest, err := contextpack.File(tmpDir, dir, ignore, keep...)
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(archive)
+
+	key := "context-" + digest + ".tar.gz"
+	remote := strings.TrimSuffix(p.Backend.ContextBucket, "/") + "/" + key
+	exists, err := store.Exists(ctx, key)
+	if err != nil {
+		return "", "", err
+	}
+	if exists {
+		fmt.Fprintf(os.Stdout, "Build context already uploaded to %s\n", remote)
+		return remote, dockerfile, nil
+	}
+	if info, err := os.Stat(archive); err == nil {
+		fmt.Fprintf(os.Stdout, "Uploading build context (%s) to %s\n", units.FormatSize(info.Size()), remote)
+	}
+	if err := state.PutFile(ctx, store, key, archive); err != nil {
+		return "", "", err
+	}
+	return remote, dockerfile, nil
+}
+
+// relativeTo returns the slash separated path of file relative to dir, if
+// the file is within dir.
+func relativeTo(dir, file string) (string, bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absDir, absFile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
@@ -0,0 +1,95 @@
+package kaniko
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/state"
+)
+
+func TestPlugin_checkContextBucket(t *testing.T) {
+	for bucket, valid := range map[string]bool{
+		"":                true,
+		"s3://bucket/ctx": true,
+		"gs://bucket":     true,
+		"/mnt/contexts":   false,
+		"https://example": false,
+	} {
+		err := Plugin{Backend: Backend{ContextBucket: bucket}}.checkContextBucket()
+		if valid && err != nil {
+			t.Errorf("%q: unexpected error %s", bucket, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("%q: expected an error", bucket)
+		}
+	}
+
+	p := Plugin{Build: Build{Builder: BuilderBuildah}, Backend: Backend{ContextBucket: "s3://bucket"}}
+	if err := p.checkContextBucket(); err == nil {
+		t.Error("expected an error for the buildah builder")
+	}
+}
+
+func TestPlugin_uploadContext(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"docker/Dockerfile": "FROM scratch\n",
+		".dockerignore":     "docker\n",
+		"main.go":           "package main\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := testBuild(t)
+	b.Context = dir
+	b.Dockerfile = filepath.Join(dir, "docker", "Dockerfile")
+	p := Plugin{Build: b, Backend: Backend{ContextBucket: "s3://bucket/contexts/"}}
+	store := state.Dir(t.TempDir())
+
+	ctx := context.Background()
+	remote, dockerfile, err := p.uploadContext(ctx, store, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dockerfile != "docker/Dockerfile" {
+		t.Errorf("got dockerfile %s, want docker/Dockerfile", dockerfile)
+	}
+	key := filepath.Base(remote)
+	if want := "s3://bucket/contexts/" + key; remote != want {
+		t.Errorf("got context %s, want %s", remote, want)
+	}
+	if exists, err := store.Exists(ctx, key); err != nil || !exists {
+		t.Fatalf("expected the archive %s in the bucket (%v)", key, err)
+	}
+
+	// the same content is not uploaded again
+	if err := os.Chtimes(filepath.Join(dir, "main.go"), time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if again, _, err := p.uploadContext(ctx, store, dir); err != nil || again != remote {
+		t.Errorf("got context %s, want %s (%v)", again, remote, err)
+	}
+}
+
+func TestPlugin_kanikoArgs_uploadedContext(t *testing.T) {
+	p := Plugin{Build: Build{Dockerfile: "app/Dockerfile", Context: "app", ContextSubPath: "app", NoPush: true}}
+	args := p.kanikoArgs(buildInput{context: "gs://bucket/context-1.tar.gz", uploaded: "Dockerfile"})
+	for _, want := range []string{"--dockerfile=Dockerfile", "--context=gs://bucket/context-1.tar.gz"} {
+		if !contains(args, want) {
+			t.Errorf("expected %s in %v", want, args)
+		}
+	}
+	for _, arg := range args {
+		if arg == "--context-sub-path=app" {
+			t.Error("expected no sub path for an uploaded context")
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// CredentialProvider provides the registry credentials of a build.
+type CredentialProvider interface {
+	DockerConfig(ctx context.Context) (*docker.Config, error)
+}
+
+// StaticCredentials authenticates against a single registry with a username
+// and password.
+type StaticCredentials struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// DockerConfig returns a docker config holding the credentials.
+func (c StaticCredentials) DockerConfig(ctx context.Context) (*docker.Config, error) {
+	config := docker.NewConfig()
+	config.SetAuth(c.Registry, c.Username, c.Password)
+	return config, nil
+}
+
+// writeCredentials writes the docker config of the credential provider to
+// the docker config directory, creating a temporary directory in the kaniko
+// directory when none is set. The returned cleanup removes it.
+func (p *Plugin) writeCredentials(ctx context.Context) (func(), error) {
+	cleanup := func() {}
+	config, err := p.Credentials.DockerConfig(ctx)
+	if err != nil {
+		return cleanup, errors.Wrap(err, "failed to get registry credentials")
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return cleanup, err
+	}
+
+	if p.Build.DockerConfigDir == "" {
+		parent := p.Build.kanikoDir()
+		if _, err := os.Stat(parent); err != nil {
+			parent = ""
+		}
+		dir, err := ioutil.TempDir(parent, "docker-")
+		if err != nil {
+			return cleanup, errors.Wrap(err, "failed to create docker config directory")
+		}
+		p.Build.DockerConfigDir = dir
+		cleanup = func() { os.RemoveAll(dir) }
+	}
+	path := filepath.Join(p.Build.DockerConfigDir, "config.json")
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		cleanup()
+		return func() {}, errors.Wrap(err, "failed to write docker config file")
+	}
+	return cleanup, nil
+}
+
+// dockerConfigPath returns the docker config file used for registry access.
+func (b Build) dockerConfigPath() string {
+	if b.DockerConfigDir != "" {
+		return filepath.Join(b.DockerConfigDir, "config.json")
+	}
+	return registry.ConfigPath()
+}
+
+// registryClient returns a registry client authenticating with the docker
+// config file of the build. The registry of the cache repository is
+// accessed over http when CacheInsecure is set, as kaniko does.
+func (b Build) registryClient() *registry.Client {
+	client := registry.NewClient(b.dockerConfigPath(), b.SkipTlsVerify)
+	client.Referrers = b.ReferrersMode
+	if host := b.cacheRegistry(); b.CacheInsecure && host != "" {
+		client.PlainHTTP = map[string]bool{host: true}
+	}
+	client.ClientCertificates(b.clientCertificates())
+	return client
+}
@@ -0,0 +1,132 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/drone/drone-kaniko/pkg/snapshot"
+	"github.com/drone/drone-kaniko/pkg/units"
+	"github.com/pkg/errors"
+)
+
+// defaultDebugSnapshotPath is the debug snapshot written to the workspace.
+const defaultDebugSnapshotPath = "debug-snapshot.tar.gz"
+
+// debugSnapshotRoot is the root filesystem kaniko builds the stages in.
+var debugSnapshotRoot = "/"
+
+// debugSnapshotPath returns the file the debug snapshot is written to.
+func (b Build) debugSnapshotPath() string {
+	if b.DebugSnapshotPath != "" {
+		return b.DebugSnapshotPath
+	}
+	return defaultDebugSnapshotPath
+}
+
+// debugSnapshotFile returns the debug snapshot uploaded with the outputs,
+// if enabled.
+func (p Plugin) debugSnapshotFile() string {
+	if !p.Build.DebugSnapshot {
+		return ""
+	}
+	return p.Build.debugSnapshotPath()
+}
+
+// debugSnapshotExcludes returns the paths left out of the debug snapshot:
+// those kaniko ignores, including every mount point, and the workspace and
+// files of the plugin, including its credentials.
+func (b Build) debugSnapshotExcludes() []string {
+	excludes := []string{b.kanikoDir(), "/proc", "/sys", "/dev", "/etc/mtab", secretsDir}
+	excludes = append(excludes, snapshot.MountPoints()...)
+	if !b.IncludeVarRun {
+		excludes = append(excludes, "/var/run")
+	}
+	excludes = append(excludes, b.IgnorePaths...)
+	volumes, _ := parseVolumes(b.Volumes)
+	for _, v := range volumes {
+		excludes = append(excludes, v.src, v.dst)
+	}
+	for _, path := range []string{".", b.Context, b.ScratchDir, b.DockerConfigDir, b.DockerConfigSecretPath, b.SSHAgentSock, b.debugSnapshotPath()} {
+		if path == "" || isRemoteContext(path) {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			excludes = append(excludes, abs)
+		}
+	}
+	return excludes
+}
+
+// writeDebugSnapshot archives the filesystem of the stage the failed build
+// stopped in, and pushes it to the debug tag when set. Failures are printed
+// and do not change the outcome of the build.
+func (p Plugin) writeDebugSnapshot(ctx context.Context, local bool) {
+	if !local || p.Build.builder() != BuilderKaniko {
+		fmt.Fprintf(os.Stderr, "warning: debug snapshots need the kaniko executor running in the plugin container and are skipped\n")
+		return
+	}
+	path := p.Build.debugSnapshotPath()
+	diffID, err := writeSnapshotFile(path, debugSnapshotRoot, p.Build.debugSnapshotExcludes())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write debug snapshot at path: %s with error: %s\n", path, err)
+		return
+	}
+	if info, err := os.Stat(path); err == nil {
+		fmt.Fprintf(os.Stdout, "Debug snapshot of the failed stage written to %s (%s)\n", path, units.FormatSize(info.Size()))
+	}
+
+	if p.Build.DebugSnapshotTag == "" || p.Build.Repo == "" {
+		return
+	}
+	image := p.Build.Repo + ":" + p.Build.DebugSnapshotTag
+	if err := p.Build.pushDebugSnapshot(ctx, path, diffID, image); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to push debug snapshot to %s: %s\n", image, err)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "Debug snapshot pushed to %s, inspect it with: docker run -it --rm %s\n", image, image)
+}
+
+// writeSnapshotFile writes the snapshot of the root filesystem to path.
+func writeSnapshotFile(path, root string, excludes []string) (string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	diffID, err := snapshot.Write(f, root, excludes)
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return diffID, f.Close()
+}
+
+// pushDebugSnapshot pushes the snapshot as a single layer image.
+func (b Build) pushDebugSnapshot(ctx context.Context, layer, diffID, image string) error {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(b.scratchDir(), "debug-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create debug image directory")
+	}
+	defer os.RemoveAll(dir)
+
+	platform := strings.SplitN(b.Platform, ",", 2)[0]
+	if platform == "" {
+		platform = "linux/" + runtime.GOARCH
+	}
+	tarball := filepath.Join(dir, "image.tar")
+	if err := snapshot.Image(tarball, layer, diffID, platform); err != nil {
+		return err
+	}
+	_, err = b.registryClient().PushTarball(ctx, tarball, []registry.Reference{ref})
+	return err
+}
@@ -0,0 +1,46 @@
+package kaniko
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlugin_writeDebugSnapshot(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "failed.txt"), []byte("output"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(root string) { debugSnapshotRoot = root }(debugSnapshotRoot)
+	debugSnapshotRoot = root
+
+	path := filepath.Join(t.TempDir(), "snapshot.tar.gz")
+	p := Plugin{Build: Build{DebugSnapshot: true, DebugSnapshotPath: path, KanikoDir: t.TempDir()}}
+	p.writeDebugSnapshot(context.Background(), false)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no snapshot without a local executor, got %v", err)
+	}
+	p.writeDebugSnapshot(context.Background(), true)
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Fatalf("expected the snapshot written: %v", err)
+	}
+	if !contains(p.outputFiles(), path) {
+		t.Error("expected the snapshot uploaded with the outputs")
+	}
+}
+
+func TestBuild_debugSnapshotExcludes(t *testing.T) {
+	b := Build{KanikoDir: "/kaniko", IgnorePaths: []string{"/cache"}, Context: "/drone/src", DockerConfigSecretPath: "/secrets/docker"}
+	excludes := b.debugSnapshotExcludes()
+	for _, want := range []string{"/kaniko", "/proc", "/var/run", "/cache", "/drone/src", "/secrets/docker", secretsDir} {
+		if !contains(excludes, want) {
+			t.Errorf("expected %s excluded, got %v", want, excludes)
+		}
+	}
+	b.IncludeVarRun = true
+	if contains(b.debugSnapshotExcludes(), "/var/run") {
+		t.Error("expected /var/run included with ignore var run disabled")
+	}
+}
@@ -0,0 +1,119 @@
+package kaniko
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/diagnostics"
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+	"github.com/drone/drone-kaniko/pkg/units"
+)
+
+// diagnosticsLogSize is the amount of kaniko output kept for diagnostics.
+const diagnosticsLogSize = 8 << 20
+
+// diagnosticsEnvPrefixes select the environment variables summarized in the
+// diagnostics bundle.
+var diagnosticsEnvPrefixes = []string{"PLUGIN_", "DRONE_", "CI_", "KANIKO_", "DOCKER_", "HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// writeDiagnostics writes the diagnostics bundle of a failed build.
+func (p Plugin) writeDiagnostics(log []byte, buildErr error) {
+	var bundle diagnostics.Bundle
+	bundle.Add("error.txt", []byte(buildErr.Error()+"\n"))
+	bundle.Add("kaniko.log", log)
+	if config, err := p.redactedConfig(); err == nil {
+		bundle.Add("config.json", config)
+	}
+	bundle.Add("environment.txt", []byte(environmentSummary()))
+	bundle.Add("disk.txt", []byte(diskSummary(".", p.Build.kanikoDir(), os.TempDir())))
+	if !isRemoteContext(p.Build.Context) {
+		bundle.AddFile("Dockerfile", p.Build.Dockerfile)
+	}
+
+	if err := bundle.Write(p.Build.DiagnosticsPath); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write diagnostics bundle at path: %s with error: %s\n", p.Build.DiagnosticsPath, err)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "Diagnostics bundle written to %s\n", p.Build.DiagnosticsPath)
+}
+
+// redactedConfig returns the resolved plugin configuration with secrets and
+// build argument values removed.
+func (p Plugin) redactedConfig() ([]byte, error) {
+	config := map[string]interface{}{}
+	for name, section := range map[string]interface{}{"build": p.Build, "artifact": p.Artifact, "gitops": p.GitOps} {
+		content, err := json.Marshal(section)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(content, &fields); err != nil {
+			return nil, err
+		}
+		for key, value := range fields {
+			if diagnostics.IsSensitive(key) && value != "" && value != nil {
+				fields[key] = diagnostics.Redacted
+			}
+		}
+		config[name] = fields
+	}
+
+	var args []string
+	for _, arg := range p.Build.Args {
+		args = append(args, strings.SplitN(arg, "=", 2)[0]+"="+diagnostics.Redacted)
+	}
+	config["build"].(map[string]interface{})["Args"] = args
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// environmentSummary describes the runtime and the relevant environment
+// variables, with secret values redacted.
+func environmentSummary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "os: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "uid: %d gid: %d\n", os.Getuid(), os.Getgid())
+	fmt.Fprintf(&b, "cpus: %d\n\n", runtime.NumCPU())
+
+	var env []string
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if !hasAnyPrefix(parts[0], diagnosticsEnvPrefixes) {
+			continue
+		}
+		if diagnostics.IsSensitive(parts[0]) {
+			kv = parts[0] + "=" + diagnostics.Redacted
+		}
+		env = append(env, kv)
+	}
+	sort.Strings(env)
+	b.WriteString(strings.Join(env, "\n"))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// diskSummary describes the disk usage of the filesystems holding paths.
+func diskSummary(paths ...string) string {
+	var b strings.Builder
+	for _, path := range paths {
+		usage, err := sysinfo.Disk(path)
+		if err != nil {
+			fmt.Fprintf(&b, "%s: %s\n", path, err)
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s free of %s (%s used)\n", path, units.FormatSize(int64(usage.Free)), units.FormatSize(int64(usage.Total)), units.FormatSize(int64(usage.Used)))
+	}
+	return b.String()
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
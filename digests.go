@@ -0,0 +1,113 @@
+package kaniko
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// imageTagDigestFile is the file in the kaniko directory kaniko writes the
+// image:tag@digest of each destination to.
+const imageTagDigestFile = "image-tag-digests"
+
+// headDigest returns the digest a tag points to in the registry, it is
+// replaced in tests.
+var headDigest = func(ctx context.Context, b Build, tag string) (string, error) {
+	ref, err := registry.ParseReference(fmt.Sprintf("%s:%s", b.Repo, tag))
+	if err != nil {
+		return "", err
+	}
+	client := b.registryClient()
+	desc, err := client.Head(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest, nil
+}
+
+// perTagDigests reports whether the digest of each tag is captured.
+func (p Plugin) perTagDigests() bool {
+	return p.Build.DigestDir != "" || p.Artifact.ArtifactFile != ""
+}
+
+// imageTagDigestPath returns the path kaniko writes the digest of each
+// destination to.
+func (b Build) imageTagDigestPath() string {
+	return filepath.Join(b.kanikoDir(), imageTagDigestFile)
+}
+
+// tagDigests returns the digest of each tag, read from the file kaniko
+// writes the digest of each destination to. Tags missing from it are looked
+// up in the registry, falling back to the digest file.
+func (p Plugin) tagDigests(ctx context.Context, tags []string) map[string]string {
+	digests := parseImageTagDigests(p.Build.imageTagDigestPath())
+	var fallback string
+	if p.Build.DigestFile != "" {
+		fallback = strings.TrimSpace(getDigest(p.Build.DigestFile))
+	}
+	for _, tag := range tags {
+		if digests[tag] != "" {
+			continue
+		}
+		if !p.Build.NoPush && p.Build.Repo != "" {
+			digest, err := headDigest(ctx, p.Build, tag)
+			if err == nil {
+				digests[tag] = digest
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "failed to look up the digest of %s:%s: %s\n", p.Build.Repo, tag, err)
+		}
+		digests[tag] = fallback
+	}
+	return digests
+}
+
+// parseImageTagDigests parses image:tag@digest lines into a map of tag to
+// digest. A missing file yields an empty map.
+func parseImageTagDigests(path string) map[string]string {
+	digests := map[string]string{}
+	f, err := os.Open(path)
+	if err != nil {
+		return digests
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		at := strings.LastIndex(line, "@")
+		if at < 0 {
+			continue
+		}
+		image, digest := line[:at], line[at+1:]
+		colon := strings.LastIndex(image, ":")
+		if colon < 0 || strings.Contains(image[colon:], "/") {
+			continue
+		}
+		digests[image[colon+1:]] = digest
+	}
+	return digests
+}
+
+// writeDigestDir writes the digest of each tag to a file named after the tag.
+func writeDigestDir(dir string, tags []string, digests map[string]string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to create digest directory %s", dir))
+	}
+	for _, tag := range tags {
+		if digests[tag] == "" {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, tag), []byte(digests[tag]), 0644); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to write digest of tag %s", tag))
+		}
+	}
+	return nil
+}
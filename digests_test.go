@@ -0,0 +1,52 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlugin_tagDigests(t *testing.T) {
+	defer func(head func(context.Context, Build, string) (string, error)) { headDigest = head }(headDigest)
+
+	dir := t.TempDir()
+	lines := "registry:5000/app:v1@sha256:11\nregistry:5000/app:latest@sha256:22\ninvalid\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, imageTagDigestFile), []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digestFile := filepath.Join(dir, "digest-file")
+	if err := ioutil.WriteFile(digestFile, []byte("sha256:ff\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	headDigest = func(ctx context.Context, b Build, tag string) (string, error) {
+		if tag == "v2" {
+			return "sha256:33", nil
+		}
+		return "", fmt.Errorf("not found")
+	}
+
+	p := Plugin{Build: Build{Repo: "registry:5000/app", KanikoDir: dir, DigestFile: digestFile}}
+	got := p.tagDigests(context.Background(), []string{"v1", "latest", "v2", "v3"})
+	want := map[string]string{"v1": "sha256:11", "latest": "sha256:22", "v2": "sha256:33", "v3": "sha256:ff"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected digests (-want +got):\n%s", diff)
+	}
+
+	out := filepath.Join(dir, "digests")
+	if err := writeDigestDir(out, []string{"v1", "v3"}, got); err != nil {
+		t.Fatal(err)
+	}
+	for tag, digest := range map[string]string{"v1": "sha256:11", "v3": "sha256:ff"} {
+		data, err := ioutil.ReadFile(filepath.Join(out, tag))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != digest {
+			t.Errorf("expected digest %s for tag %s, got %s", digest, tag, data)
+		}
+	}
+}
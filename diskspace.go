@@ -0,0 +1,97 @@
+package kaniko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+	"github.com/drone/drone-kaniko/pkg/units"
+)
+
+// diskUsage is replaced in tests.
+var diskUsage = sysinfo.Disk
+
+// checkDiskSpace fails early when a filesystem used by the build has less
+// free space than the configured minimum. When enabled, the local cache
+// directory is cleaned before failing.
+func (b Build) checkDiskSpace() error {
+	if b.MinFreeSpace == "" {
+		return nil
+	}
+	minFree, err := units.ParseSize(b.MinFreeSpace)
+	if err != nil {
+		return err
+	}
+
+	// kaniko unpacks the image into the root filesystem
+	paths := []string{"/", b.kanikoDir()}
+	if !isRemoteContext(b.Context) && b.Context != "" {
+		paths = append(paths, b.Context)
+	}
+	if b.CacheDir != "" {
+		paths = append(paths, b.CacheDir)
+	}
+
+	checked := map[string]bool{}
+	for _, path := range paths {
+		if checked[path] {
+			continue
+		}
+		checked[path] = true
+
+		free, err := freeSpace(path)
+		if err != nil {
+			continue
+		}
+		if free >= minFree {
+			continue
+		}
+		if b.CleanCacheOnLowSpace && b.CacheDir != "" {
+			fmt.Fprintf(os.Stdout, "Only %s free on %s, cleaning the cache directory %s\n", units.FormatSize(free), path, b.CacheDir)
+			if err := cleanDir(b.CacheDir); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to clean cache directory %s: %s\n", b.CacheDir, err)
+			}
+			if free, err = freeSpace(path); err == nil && free >= minFree {
+				continue
+			}
+		}
+		return fmt.Errorf("only %s free on the filesystem holding %s, %s required: free up space or lower PLUGIN_MIN_FREE_SPACE", units.FormatSize(free), path, units.FormatSize(minFree))
+	}
+	return nil
+}
+
+// freeSpace returns the free bytes on the filesystem holding path, or of
+// its closest existing parent.
+func freeSpace(path string) (int64, error) {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+	usage, err := diskUsage(path)
+	if err != nil {
+		return 0, err
+	}
+	return int64(usage.Free), nil
+}
+
+// cleanDir removes the contents of dir.
+func cleanDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
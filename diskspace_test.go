@@ -0,0 +1,48 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+func TestBuild_checkDiskSpace(t *testing.T) {
+	defer func() { diskUsage = sysinfo.Disk }()
+
+	cacheDir := t.TempDir()
+	free := uint64(100)
+	diskUsage = func(path string) (sysinfo.DiskUsage, error) {
+		return sysinfo.DiskUsage{Total: 1000, Free: free}, nil
+	}
+
+	b := Build{MinFreeSpace: "50B", KanikoDir: t.TempDir(), CacheDir: cacheDir}
+	if err := b.checkDiskSpace(); err != nil {
+		t.Errorf("unexpected error with enough space: %s", err)
+	}
+
+	b.MinFreeSpace = "200B"
+	if err := b.checkDiskSpace(); err == nil {
+		t.Errorf("expected error with too little space")
+	}
+
+	// cleaning the cache frees enough space
+	if err := ioutil.WriteFile(filepath.Join(cacheDir, "layer"), []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b.CleanCacheOnLowSpace = true
+	diskUsage = func(path string) (sysinfo.DiskUsage, error) {
+		if _, err := os.Stat(filepath.Join(cacheDir, "layer")); err == nil {
+			return sysinfo.DiskUsage{Total: 1000, Free: 100}, nil
+		}
+		return sysinfo.DiskUsage{Total: 1000, Free: 500}, nil
+	}
+	if err := b.checkDiskSpace(); err != nil {
+		t.Errorf("unexpected error after cleaning the cache: %s", err)
+	}
+	if entries, _ := ioutil.ReadDir(cacheDir); len(entries) != 0 {
+		t.Errorf("expected the cache directory to be cleaned")
+	}
+}
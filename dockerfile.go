@@ -0,0 +1,87 @@
+package kaniko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/pkg/errors"
+)
+
+// resolveDockerfile returns the Dockerfile to build. Inline contents are
+// written to a temporary file, removed by the returned cleanup. Otherwise
+// the first existing file of the comma separated candidates is used.
+func (b Build) resolveDockerfile(remote bool) (string, func(), error) {
+	cleanup := func() {}
+	if b.DockerfileContents != "" {
+		// the kaniko directory is never snapshotted into the image
+		parent := b.kanikoDir()
+		if _, err := os.Stat(parent); err != nil {
+			parent = ""
+		}
+		f, err := ioutil.TempFile(parent, "Dockerfile-")
+		if err != nil {
+			return "", cleanup, errors.Wrap(err, "failed to create inline dockerfile")
+		}
+		defer f.Close()
+		if _, err := f.WriteString(b.DockerfileContents); err != nil {
+			os.Remove(f.Name())
+			return "", cleanup, errors.Wrap(err, "failed to write inline dockerfile")
+		}
+		fmt.Fprintf(os.Stdout, "Using the inline dockerfile written to %s\n", f.Name())
+		return f.Name(), func() { os.Remove(f.Name()) }, nil
+	}
+
+	var candidates []string
+	for _, candidate := range strings.Split(b.Dockerfile, ",") {
+		if candidate = strings.TrimSpace(candidate); candidate != "" {
+			candidates = append(candidates, candidate)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", cleanup, fmt.Errorf("dockerfile must be specified")
+	}
+	// the dockerfile of a remote context is resolved by kaniko
+	if remote {
+		return candidates[0], cleanup, nil
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			if len(candidates) > 1 {
+				fmt.Fprintf(os.Stdout, "Using dockerfile %s from candidates %s\n", candidate, strings.Join(candidates, ", "))
+			}
+			return candidate, cleanup, nil
+		}
+	}
+	if len(candidates) == 1 {
+		return "", cleanup, fmt.Errorf("dockerfile does not exist at path: %s", candidates[0])
+	}
+	return "", cleanup, fmt.Errorf("none of the dockerfiles exist: %s", strings.Join(candidates, ", "))
+}
+
+// checkTarget validates the target stage exists in the Dockerfile, and that
+// multi-stage builds set a target when required.
+func (b Build) checkTarget(remote bool) error {
+	if remote || b.Target == "" && !b.RequireTarget {
+		return nil
+	}
+	d, err := dockerfile.ParseFile(b.Dockerfile)
+	if err != nil {
+		// reported by the executor
+		return nil
+	}
+	stages := d.StageIDs()
+
+	if b.Target == "" {
+		if len(stages) > 1 {
+			return fmt.Errorf("a target must be set for multi-stage builds, available stages: %s", strings.Join(stages, ", "))
+		}
+		return nil
+	}
+	if _, ok := d.Stage(b.Target); ok {
+		return nil
+	}
+	return fmt.Errorf("target stage %q not found in %s, available stages: %s", b.Target, b.Dockerfile, strings.Join(stages, ", "))
+}
@@ -0,0 +1,89 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuild_resolveDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	containerfile := filepath.Join(dir, "Containerfile")
+	if err := ioutil.WriteFile(containerfile, []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dockerfile := filepath.Join(dir, "Dockerfile")
+
+	tests := []struct {
+		name       string
+		dockerfile string
+		remote     bool
+		want       string
+		err        bool
+	}{
+		{name: "single", dockerfile: containerfile, want: containerfile},
+		{name: "missing", dockerfile: dockerfile, err: true},
+		{name: "candidates", dockerfile: dockerfile + ", " + containerfile, want: containerfile},
+		{name: "no candidate exists", dockerfile: dockerfile + "," + dockerfile + ".dev", err: true},
+		{name: "remote", dockerfile: "Dockerfile,Containerfile", remote: true, want: "Dockerfile"},
+		{name: "empty", dockerfile: "", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, cleanup, err := Build{Dockerfile: test.dockerfile}.resolveDockerfile(test.remote)
+			defer cleanup()
+			if test.err != (err != nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestBuild_resolveDockerfileContents(t *testing.T) {
+	b := Build{Dockerfile: "Dockerfile", DockerfileContents: "FROM alpine\n", KanikoDir: t.TempDir()}
+	path, cleanup, err := b.resolveDockerfile(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != b.KanikoDir {
+		t.Errorf("expected the inline dockerfile in the kaniko directory, got %s", path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != b.DockerfileContents {
+		t.Errorf("unexpected contents %q", data)
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the inline dockerfile to be removed")
+	}
+}
+
+func TestBuild_checkTarget(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	content := "FROM golang:1.20 AS build\nRUN go build\nFROM build as test\nFROM --platform=linux/amd64 alpine\n"
+	if err := ioutil.WriteFile(dockerfile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for target, ok := range map[string]bool{"build": true, "Test": true, "2": true, "release": false} {
+		err := Build{Dockerfile: dockerfile, Target: target}.checkTarget(false)
+		if ok && err != nil {
+			t.Errorf("target %s: unexpected error %s", target, err)
+		}
+		if !ok && (err == nil || !strings.Contains(err.Error(), "available stages: build, test, 2")) {
+			t.Errorf("target %s: expected an error listing the stages, got %v", target, err)
+		}
+	}
+
+	if err := (Build{Dockerfile: dockerfile, RequireTarget: true}).checkTarget(false); err == nil {
+		t.Errorf("expected an error for a multi-stage build without target")
+	}
+}
@@ -0,0 +1,38 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+)
+
+// contextRoot returns the directory kaniko uses as the build context.
+func (b Build) contextRoot() string {
+	return filepath.Join(b.Context, b.ContextSubPath)
+}
+
+// dockerignore returns the patterns of the .dockerignore file at the root of
+// the local build context, which kaniko applies to the context as well. An
+// unreadable file is reported and ignored.
+func (b Build) dockerignore() *dockerignore.Matcher {
+	m, err := dockerignore.ReadFile(filepath.Join(b.contextRoot(), ".dockerignore"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read .dockerignore: %s\n", err)
+		return nil
+	}
+	return m
+}
+
+// ignoredChange returns a func reporting whether a changed file, relative to
+// the working directory, is excluded from the build context, so changes to
+// it do not trigger a build.
+func (b Build) ignoredChange() func(file string) bool {
+	ignore := b.dockerignore()
+	root := b.contextRoot()
+	return func(file string) bool {
+		rel, ok := relativeTo(root, file)
+		return ok && rel != ".dockerignore" && ignore.Excluded(rel)
+	}
+}
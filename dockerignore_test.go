@@ -0,0 +1,63 @@
+package kaniko
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuild_ignoredChange(t *testing.T) {
+	b := Build{Context: "services/api"}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, b.Context), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, b.Context, ".dockerignore"), []byte("*.md\ntestdata\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	ignored := b.ignoredChange()
+	for file, want := range map[string]bool{
+		"services/api/README.md":          true,
+		"services/api/testdata/case.json": true,
+		"services/api/main.go":            false,
+		"services/api/.dockerignore":      false,
+		"README.md":                       false,
+		"services/web/README.md":          false,
+	} {
+		if got := ignored(file); got != want {
+			t.Errorf("%s: got ignored %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestBuild_ContentTag_dockerignore(t *testing.T) {
+	b := testBuild(t)
+	if err := os.WriteFile(filepath.Join(b.Context, ".dockerignore"), []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first, err := b.ContentTag()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(b.Context, "build.log"), []byte("done\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := b.ContentTag(); err != nil || got != first {
+		t.Errorf("got tag %s, want %s (%v)", got, first, err)
+	}
+	if err := os.WriteFile(filepath.Join(b.Context, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.ContentTag(); got == first {
+		t.Error("expected the tag to change with the context")
+	}
+}
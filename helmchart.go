@@ -0,0 +1,78 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/helm"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// loadHelmChart packages the chart of the HelmChart setting. It runs before
+// the build, so an invalid chart fails the step before the image is pushed.
+func (b Build) loadHelmChart() (*helm.Chart, registry.Reference, error) {
+	if b.HelmChart == "" {
+		return nil, registry.Reference{}, nil
+	}
+	chart, err := helm.Load(b.HelmChart)
+	if err != nil {
+		return nil, registry.Reference{}, err
+	}
+	ref, err := b.helmChartRef(chart)
+	if err != nil {
+		return nil, registry.Reference{}, err
+	}
+	return chart, ref, nil
+}
+
+// helmChartRef returns the reference the chart is pushed to, as helm push
+// to the oci:// namespace of HelmRepo does: the repository named after the
+// chart in the namespace, tagged with the chart version. The namespace
+// defaults to the parent of the image repository.
+func (b Build) helmChartRef(chart *helm.Chart) (registry.Reference, error) {
+	namespace := strings.TrimSuffix(strings.TrimPrefix(b.HelmRepo, "oci://"), "/")
+	if namespace == "" {
+		image, err := registry.ParseReference(b.Repo)
+		if err != nil {
+			return registry.Reference{}, errors.Wrap(err, "failed to derive the Helm chart repository")
+		}
+		namespace = image.Registry
+		if parent := path.Dir(image.Repository); parent != "." {
+			namespace += "/" + parent
+		}
+	}
+	ref, err := registry.ParseReference(namespace + "/" + chart.Metadata.Name + ":" + chart.Tag())
+	if err != nil {
+		return registry.Reference{}, errors.Wrap(err, "invalid Helm chart repository")
+	}
+	if image, err := registry.ParseReference(b.Repo); err == nil && image.Registry == ref.Registry && image.Repository == ref.Repository {
+		return registry.Reference{}, fmt.Errorf("Helm chart %s would be pushed to the image repository %s, set the Helm chart repository", chart.Metadata.Name, b.Repo)
+	}
+	return ref, nil
+}
+
+// pushHelmChart pushes the packaged chart next to the image with the
+// registry credentials of the build, returning its reference for the
+// artifact file.
+func (p Plugin) pushHelmChart(ctx context.Context, chart *helm.Chart, ref registry.Reference) ([]artifact.Reference, error) {
+	if p.Build.NoPush {
+		fmt.Fprintf(os.Stdout, "Not pushing Helm chart %s, pushing is disabled\n", ref)
+		return nil, nil
+	}
+	config, err := chart.Config()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := p.Build.registryClient().PushChart(ctx, ref, config, chart.Content, chart.Annotations())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to push Helm chart")
+	}
+	fmt.Fprintf(os.Stdout, "Pushed Helm chart %s@%s\n", ref, digest)
+	repository := ref.Registry + "/" + ref.Repository
+	return []artifact.Reference{{Type: "helm-chart", MediaType: registry.MediaTypeHelmChart, Image: repository, Digest: digest}}, nil
+}
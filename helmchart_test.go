@@ -0,0 +1,32 @@
+package kaniko
+
+import (
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/helm"
+)
+
+func TestBuild_helmChartRef(t *testing.T) {
+	chart := &helm.Chart{Metadata: helm.Metadata{Name: "app", Version: "1.0.0+build.2"}}
+	tests := []struct {
+		repo, helmRepo string
+		want           string
+		err            bool
+	}{
+		{repo: "registry.example.com/team/api", want: "registry.example.com/team/app:1.0.0_build.2"},
+		{repo: "registry.example.com/team/app", helmRepo: "oci://registry.example.com/team/charts/", want: "registry.example.com/team/charts/app:1.0.0_build.2"},
+		{repo: "localhost:5000/api", want: "localhost:5000/app:1.0.0_build.2"},
+		{repo: "team/api", want: "index.docker.io/team/app:1.0.0_build.2"},
+		{repo: "registry.example.com/team/app", err: true},
+	}
+	for _, tt := range tests {
+		ref, err := Build{Repo: tt.repo, HelmRepo: tt.helmRepo}.helmChartRef(chart)
+		if (err != nil) != tt.err {
+			t.Errorf("helmChartRef(%s, %s) error = %v", tt.repo, tt.helmRepo, err)
+			continue
+		}
+		if !tt.err && ref.String() != tt.want {
+			t.Errorf("helmChartRef(%s, %s) = %s, want %s", tt.repo, tt.helmRepo, ref, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package kaniko
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/pkg/errors"
+)
+
+// writeHubPullCredentials writes the Docker Hub pull credentials to the
+// docker config file, so base images are not pulled anonymously. Existing
+// Docker Hub credentials, such as those pushing the image, take precedence.
+func (b Build) writeHubPullCredentials() error {
+	if b.HubPullCredentials == "" {
+		return nil
+	}
+	parts := strings.SplitN(b.HubPullCredentials, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid Docker Hub pull credentials, expected username:password")
+	}
+	config := docker.NewConfig()
+	config.SetAuth(docker.RegistryV1, parts[0], parts[1])
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := docker.WriteConfigFile(b.dockerConfigPath(), content, docker.MergeStrategyKeep); err != nil {
+		return errors.Wrap(err, "failed to write Docker Hub pull credentials")
+	}
+	return nil
+}
+
+// retryThroughHubMirror reports whether the failed kaniko build was rate
+// limited by Docker Hub and can be retried through the Docker Hub mirror.
+func (b Build) retryThroughHubMirror(err error, log []byte) bool {
+	if b.HubMirror == "" || b.builder() != BuilderKaniko || contains(b.Mirrors, b.HubMirror) {
+		return false
+	}
+	return failure.Classify(err, log).Category == failure.RateLimited
+}
+
+// withArgs returns a copy of cmd with args appended, as a command cannot be
+// started twice.
+func withArgs(cmd *exec.Cmd, args ...string) *exec.Cmd {
+	retry := exec.Command(cmd.Path, append(append([]string(nil), cmd.Args[1:]...), args...)...)
+	retry.Dir = cmd.Dir
+	retry.Env = cmd.Env
+	retry.Stdout = cmd.Stdout
+	retry.Stderr = cmd.Stderr
+	return retry
+}
+
+// printRateLimitHelp prints how to avoid the Docker Hub rate limit.
+func (b Build) printRateLimitHelp() {
+	if b.HubPullCredentials == "" {
+		fmt.Fprintf(os.Stderr, "Docker Hub limits anonymous pulls: set PLUGIN_HUB_PULL_CREDENTIALS to pull base images as a Docker Hub user\n")
+	}
+	if b.HubMirror == "" && len(b.Mirrors) == 0 {
+		fmt.Fprintf(os.Stderr, "Set PLUGIN_HUB_MIRROR (e.g. mirror.gcr.io) to retry rate limited builds through a registry mirror\n")
+	}
+}
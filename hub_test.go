@@ -0,0 +1,65 @@
+package kaniko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+)
+
+func TestPlugin_ExecHubMirrorRetry(t *testing.T) {
+	b := testBuild(t)
+	b.HubMirror = "mirror.gcr.io"
+
+	runner := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		if !contains(cmd.Args, "--registry-mirror=mirror.gcr.io") {
+			fmt.Fprintln(cmd.Stderr, "GET https://index.docker.io/v2/library/golang/manifests/1.22: TOOMANYREQUESTS: You have reached your pull rate limit.")
+			return errors.New("exit status 1")
+		}
+		return nil
+	}}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.cmds) != 2 {
+		t.Fatalf("expected the executor to run twice, ran %d commands", len(runner.cmds))
+	}
+}
+
+func TestBuild_writeHubPullCredentials(t *testing.T) {
+	b := Build{HubPullCredentials: "puller:secret", DockerConfigDir: t.TempDir()}
+	path := filepath.Join(b.DockerConfigDir, "config.json")
+	for _, existing := range []string{`{"auths": {}}`, `{"auths": {"https://index.docker.io/v1/": {"auth": "cHVzaDpwdXNo"}}}`} {
+		if err := ioutil.WriteFile(path, []byte(existing), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.writeHubPullCredentials(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := docker.NewConfig()
+		if err := config.UnmarshalJSON(data); err != nil {
+			t.Fatal(err)
+		}
+		want := "cHVsbGVyOnNlY3JldA=="
+		if existing != `{"auths": {}}` {
+			want = "cHVzaDpwdXNo"
+		}
+		if got := config.Auths[docker.RegistryV1].Auth; got != want {
+			t.Errorf("want Docker Hub auth %s, got %s", want, got)
+		}
+	}
+
+	b.HubPullCredentials = "puller"
+	if err := b.writeHubPullCredentials(); err == nil {
+		t.Error("expected an error for credentials without a password")
+	}
+}
@@ -1,45 +1,195 @@
 package kaniko
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/buildinfo"
+	"github.com/drone/drone-kaniko/pkg/buildlog"
+	"github.com/drone/drone-kaniko/pkg/contexthash"
+	"github.com/drone/drone-kaniko/pkg/diagnostics"
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/drone/drone-kaniko/pkg/fips"
+	"github.com/drone/drone-kaniko/pkg/fsutil"
+	"github.com/drone/drone-kaniko/pkg/gitops"
+	"github.com/drone/drone-kaniko/pkg/image"
 	"github.com/drone/drone-kaniko/pkg/output"
+	"github.com/drone/drone-kaniko/pkg/redact"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/drone/drone-kaniko/pkg/state"
+	"github.com/drone/drone-kaniko/pkg/status"
 	"github.com/drone/drone-kaniko/pkg/tagger"
+	"github.com/drone/drone-kaniko/pkg/trigger"
+	"github.com/pkg/errors"
 	"golang.org/x/mod/semver"
 )
 
+// contentTagPrefix prefixes tags derived from the build context hash.
+const contentTagPrefix = "content-"
+
+// expandTagLevels are the semver levels generated by ExpandTag, in order.
+var expandTagLevels = []string{"major", "minor", "patch"}
+
 type (
 	// Build defines Docker build parameters.
 	Build struct {
-		DroneCommitRef   string   // Drone git commit reference
-		DroneRepoBranch  string   // Drone repo branch
-		Dockerfile       string   // Docker build Dockerfile
-		Context          string   // Docker build context
-		Tags             []string // Docker build tags
-		AutoTag          bool     // Set this to auto detect tags from git commits and semver-tagged labels
-		AutoTagSuffix    string   // Suffix to append to the auto detect tags
-		ExpandTag        bool     // Set this to expand the `Tags` into semver-tagged labels
-		Args             []string // Docker build args
-		Target           string   // Docker build target
-		Repo             string   // Docker build repository
-		Mirrors          []string // Docker repository mirrors
-		Labels           []string // Label map
-		SkipTlsVerify    bool     // Docker skip tls certificate verify for registry
-		SnapshotMode     string   // Kaniko snapshot mode
-		EnableCache      bool     // Whether to enable kaniko cache
-		CacheRepo        string   // Remote repository that will be used to store cached layers
-		CacheTTL         int      // Cache timeout in hours
-		DigestFile       string   // Digest file location
-		NoPush           bool     // Set this flag if you only want to build the image, without pushing to a registry
-		Verbosity        string   // Log level
-		Platform         string   // Allows to build with another default platform than the host, similarly to docker build --platform
-		SkipUnusedStages bool     // Build only used stages
-		TarPath          string   // Set this flag to save the image as a tarball at path
+		DroneCommitRef           string        // Drone git commit reference
+		DroneRepoBranch          string        // Drone repo branch
+		DroneCommitBefore        string        // Drone commit sha before the change
+		DroneCommitAfter         string        // Drone commit sha after the change
+		DroneCommitSha           string        // Drone commit sha
+		DroneCommitAuthor        string        // Drone commit author
+		DroneCommitMessage       string        // Drone commit message
+		DroneCommitBranch        string        // Drone commit branch
+		DroneTag                 string        // Drone tag
+		DroneBuildNumber         string        // Drone build number
+		DroneBuildCreated        int64         // Drone build creation time, in unix seconds
+		AutoLabels               bool          // Label the image with label-schema labels describing the commit
+		Dockerfile               string        // Docker build Dockerfile, or comma separated candidates
+		DockerfileContents       string        // Inline Dockerfile contents, used instead of Dockerfile
+		Context                  string        // Docker build context
+		Tags                     []string      // Docker build tags
+		AutoTag                  bool          // Set this to auto detect tags from git commits and semver-tagged labels
+		AutoTagSuffix            string        // Suffix to append to the auto detect tags
+		Calver                   bool          // Add a calendar version tag rendered from CalverTemplate
+		CalverTemplate           string        // Template of the calendar version tag
+		CalverTimezone           string        // Timezone of the calendar version date, UTC by default
+		ExpandTag                bool          // Set this to expand the `Tags` into semver-tagged labels
+		ExpandTagLevels          []string      // Semver levels generated by ExpandTag, major, minor and patch by default
+		ExpandTagLatest          bool          // Also tag expanded releases as latest on the default branch or a tag
+		SanitizeTags             bool          // Lowercase the tags and replace invalid characters with dashes
+		TagPrefix                string        // Prefix added to every tag, e.g. staging-
+		TagSuffix                string        // Suffix added to every tag, e.g. -arm64
+		TagsResolved             bool          // Tags were resolved already and are published as set
+		Args                     []string      // Docker build args
+		Target                   string        // Docker build target
+		RequireTarget            bool          // Fail multi-stage builds without a target
+		StrictArgs               bool          // Fail when build args are not declared or required args are not provided
+		AutoProxyArgs            bool          // Forward dependency proxy env vars declared as args in the Dockerfile
+		Repo                     string        // Docker build repository
+		Mirrors                  []string      // Docker repository mirrors
+		MirrorPreset             string        // Mirror Docker Hub base images are pulled through: gcr, ecr-public or custom
+		MirrorPrefix             string        // Registry and path of the custom mirror preset
+		MirrorExclude            []string      // Docker Hub images pulled directly despite the mirror preset
+		Labels                   []string      // Label map
+		LabelsFile               string        // File of k=v lines or a JSON object of labels, overridden by Labels
+		PostLabels               []string      // Labels added to the pushed image after the build, without rebuilding it
+		PostAnnotations          []string      // Manifest annotations added to the pushed image after the build
+		SkipTlsVerify            bool          // Docker skip tls certificate verify for registry
+		CACert                   string        // CA bundle installed by InstallCACert, trusted for the registries
+		RegistryClientCerts      []string      // Client certificates (registry=envvar or registry=filepath) for registries enforcing mutual TLS
+		RegistryClientKeys       []string      // Keys (registry=envvar or registry=filepath) of the client certificates
+		SnapshotMode             string        // Kaniko snapshot mode
+		EnableCache              bool          // Whether to enable kaniko cache
+		CacheRepo                string        // Remote repository that will be used to store cached layers
+		CacheTTL                 int           // Cache timeout in hours
+		CacheCleanup             bool          // Delete cached layers older than the cache TTL after a successful build
+		CacheCleanupLimit        int           // Most cached layers deleted by a build, unlimited when 0
+		CacheLock                string        // Lock of the cache repository across builds: registry, or a bucket or directory
+		CacheLockTimeout         time.Duration // How long to wait for the cache lock held by another build
+		CacheLockSkip            bool          // Build without writing to the cache when the cache lock is not acquired in time
+		HubPullCredentials       string        // Docker Hub username:password used to pull base images
+		HubMirror                string        // Registry mirror retried when Docker Hub rate limits the build
+		CacheInsecure            bool          // Access the registry of the cache repository over http
+		CacheUsername            string        // Username for the cache repository
+		CachePassword            string        // Password for the cache repository
+		CacheBust                string        // Token passed as a build arg to invalidate the cache of a stage
+		CacheBustStage           string        // Stage, by name or index, the cache bust token applies to, all stages by default
+		CacheKeys                bool          // Print the cache key of each command looked up in the cache
+		DigestFile               string        // Digest file location
+		DigestDir                string        // Directory the digest of each tag is written to
+		NoPush                   bool          // Set this flag if you only want to build the image, without pushing to a registry
+		ProbePush                bool          // Check the push permission on the repository before building
+		PushPermissionCheck      string        // Push permission check before the build: kaniko, probe or none
+		Verbosity                string        // Log level
+		LogTimestamps            bool          // Prefix the executor log lines with timestamps
+		LogColor                 string        // Colored executor logs: auto, always or never
+		Platform                 string        // Allows to build with another default platform than the host, similarly to docker build --platform
+		SkipUnusedStages         bool          // Build only used stages
+		Cleanup                  bool          // Clean the filesystem at the end of the build
+		TarPath                  string        // Set this flag to save the image as a tarball at path
+		OCILayout                string        // Directory the image is saved to as an OCI layout
+		PushOnly                 bool          // Push the OCI layout saved by an earlier step instead of building
+		SkipIfExists             bool          // Skip the build when the image already exists in the registry
+		TagContent               bool          // Add a tag derived from the hash of the build inputs
+		TriggerPaths             []string      // Skip the build unless a changed file matches one of these globs
+		ContextSubPath           string        // Sub path within the build context to use as the context root
+		ExtraContexts            []string      // Named directories (name=path) staged into the build context
+		Secrets                  []string      // Build secrets (id=envvar or id=filepath) for RUN --mount=type=secret
+		SecretArgs               []string      // Build args (ARGNAME=ENVVAR) whose values are read from environment variables
+		SSHKey                   string        // Private ssh key exposed to RUN steps
+		SSHKnownHosts            string        // Known hosts used with the ssh key
+		SSHAgentSock             string        // ssh agent socket exposed to RUN steps
+		Volumes                  []string      // Runner directories exposed to RUN steps, as src:dst
+		NetrcMachine             string        // Netrc machine used to fetch remote git contexts
+		NetrcLogin               string        // Netrc login
+		NetrcPassword            string        // Netrc password
+		KanikoDir                string        // Directory kaniko keeps its state in
+		ScratchDir               string        // Directory of the files of this run, created by NewScratchDir
+		IncludeVarRun            bool          // Snapshot /var/run, which kaniko ignores by default
+		IgnorePaths              []string      // Paths ignored when snapshotting
+		MaxImageSize             string        // Compressed image size budget, e.g. 500MB
+		MaxUncompressedImageSize string        // Uncompressed image size budget
+		LayerReport              bool          // Report layer sizes compared with the previous image
+		LayerReportFile          string        // File the layer report is written to
+		LayerReportBaseline      string        // Tag of the previous image, defaults to the first tag
+		LayerReportThreshold     string        // Growth flagged in the layer report, e.g. 10MB
+		TestCommand              string        // Command run in the image before it is pushed
+		TestRunner               string        // Shell command running the test instead of the built-in runner
+		TestTimeout              time.Duration // Smoke test timeout
+		StructureTestConfigs     []string      // container-structure-test configs run before the image is pushed
+		StructureTestReport      string        // File the structure test report is written to
+		DiagnosticsPath          string        // File a diagnostics bundle is written to when the build fails
+		DebugSnapshot            bool          // Archive the filesystem of the failed stage when the build fails
+		DebugSnapshotPath        string        // File the debug snapshot is written to, defaults to debug-snapshot.tar.gz
+		DebugSnapshotTag         string        // Tag the debug snapshot is pushed to as an image
+		ErrorSummaryFile         string        // File a JSON summary of the classified failure is written to
+		MinFreeSpace             string        // Free disk space required to start the build, e.g. 5GB
+		CacheDir                 string        // Local directory caching base images
+		RunCacheDirs             []string      // Directories RUN instructions share across builds, e.g. /root/.npm
+		RunCacheMounts           bool          // Share the targets of RUN --mount=type=cache across builds
+		RunCacheVolume           string        // Directory the run cache directories are kept in between builds
+		CleanCacheOnLowSpace     bool          // Clean the cache directory when free disk space is low
+		SingleSnapshot           bool          // Take a single snapshot at the end of the build
+		DisableCompressedCaching bool          // Do not compress cached layers, reduces memory usage
+		AutoTune                 bool          // Pick memory saving settings based on the runner memory limit
+		BuildSummary             bool          // Print a summary of the build times and cache effectiveness
+		BuildSummaryFile         string        // File the build summary is written to as JSON
+		TimingFile               string        // File the time spent on each stage and instruction is written to as JSON
+		StatsdAddress            string        // StatsD agent the build timings are sent to
+		StatsdPrefix             string        // Prefix of the StatsD metric names
+		StateStore               string        // Directory or bucket (s3:// or gs://) the history of previous builds is kept in
+		CardPath                 string        // File the Drone card of the build is written to
+		ScanReport               string        // Trivy or Grype JSON report whose findings are counted on the card
+		DockerConfigDir          string        // Directory holding the docker config file, defaults to DOCKER_CONFIG
+		DockerConfigSecretPath   string        // Mounted docker config secret merged into the docker config
+		Builder                  string        // Builder running the build, kaniko, buildkit or buildah
+		AttestationFile          string        // File the in-toto attestation of the build inputs is written to
+		PushAttestation          bool          // Push the attestation as a referrer of the image
+		ReferrersMode            string        // How artifacts are attached to images, auto, api or tag
+		CheckUpdates             bool          // Warn when a newer plugin release exists
+		Offline                  bool          // Disable optional outbound calls and reject features needing network access
+		FIPS                     bool          // Require the FIPS validated BoringCrypto module
+		RedactPatterns           []string      // Regular expressions masked in the executor output
+		CaptureEnv               []string      // Environment variables, or glob patterns, recorded in labels and the attestation
+		CaptureEnvDeny           []string      // Glob patterns of environment variables never captured
+		HelmChart                string        // Helm chart directory or package pushed as an OCI artifact with the image
+		HelmRepo                 string        // Registry namespace the Helm chart is pushed to, defaults to that of the image
+		OCIArtifacts             []string      // Files, path[:media type], pushed as an OCI artifact with the image
+		OCIArtifactType          string        // Artifact type of the OCI artifact
+		OCIArtifactRef           string        // Reference the OCI artifact is pushed to instead of attaching it to the image
+		OCIArtifactAnnotations   []string      // Annotations, key=value, of the OCI artifact manifest
+
+		executorVersion string      // Version of the local kaniko executor, read before the build
+		capturedEnv     [][2]string // Environment variables captured by CaptureEnv, read before the build
 	}
 
 	// Artifact defines content of artifact file
@@ -49,18 +199,27 @@ type (
 		Registry     string                    // Docker artifact registry
 		RegistryType artifact.RegistryTypeEnum // Rocker artifact registry type
 		ArtifactFile string                    // Artifact file location
+		Schema       string                    // Artifact file schema, v1 or v2
 	}
 
 	// Output defines content of output file
 	Output struct {
 		OutputFile string // File where plugin output are saved
+		Bucket     string // Bucket (s3:// or gs://) the output files are uploaded to
+		Prefix     string // Key prefix of the uploaded output files
 	}
 
 	// Plugin defines the Docker plugin parameters.
 	Plugin struct {
-		Build    Build    // Docker build configuration
-		Artifact Artifact // Artifact file content
-		Output   Output   // Output file content
+		Build       Build              // Docker build configuration
+		Artifact    Artifact           // Artifact file content
+		Output      Output             // Output file content
+		GitOps      gitops.Config      // GitOps repository updated after push
+		Status      status.Config      // Where the commit status of the build is published
+		Runner      Runner             // Runs the kaniko executor, defaults to a local process
+		Executor    string             // Path of the kaniko executor
+		Credentials CredentialProvider // Registry credentials, defaults to the docker config file
+		Backend     Backend            // Where the kaniko executor runs, unless Runner is set
 	}
 )
 
@@ -98,11 +257,37 @@ func (b Build) labelsForTag(tag string) (labels []string) {
 	labelFor := func(base string) string {
 		return strings.TrimPrefix(base, VersionPrefix) + semver.Build(tag)
 	}
-	return []string{
-		labelFor(semver.Major(tag)),
-		labelFor(semver.MajorMinor(tag)),
-		labelFor(semver.Canonical(tag)),
+	levels := b.ExpandTagLevels
+	if len(levels) == 0 {
+		levels = expandTagLevels
+	}
+	for _, level := range expandTagLevels {
+		if !contains(levels, level) {
+			continue
+		}
+		switch level {
+		case "major":
+			labels = append(labels, labelFor(semver.Major(tag)))
+		case "minor":
+			labels = append(labels, labelFor(semver.MajorMinor(tag)))
+		case "patch":
+			labels = append(labels, labelFor(semver.Canonical(tag)))
+		}
+	}
+	if b.ExpandTagLatest && tagger.UseAutoTag(b.DroneCommitRef, b.DroneRepoBranch) {
+		labels = append(labels, "latest")
+	}
+	return labels
+}
+
+// checkExpandTagLevels returns an error if a semver level is not known.
+func (b Build) checkExpandTagLevels() error {
+	for _, level := range b.ExpandTagLevels {
+		if !contains(expandTagLevels, level) {
+			return fmt.Errorf("unsupported expand-tag level %q, must be one of %s", level, strings.Join(expandTagLevels, ", "))
+		}
 	}
+	return nil
 }
 
 // Returns the auto detected tags. See the AutoTag section of
@@ -129,126 +314,810 @@ func (b Build) AutoTags() (tags []string, err error) {
 	return
 }
 
-// Exec executes the plugin step
-func (p Plugin) Exec() error {
+// ResolveTags returns the tags the image is published with, after auto
+// detection, semver expansion and the tag prefix and suffix have been
+// applied. Empty and duplicate tags are dropped and invalid tags are rejected.
+// Tags resolved already are returned as set.
+func (b Build) ResolveTags() ([]string, error) {
+	if b.TagsResolved {
+		return b.Tags, nil
+	}
+	var tags = b.Tags
+	if b.AutoTag && b.ExpandTag {
+		return nil, fmt.Errorf("The auto-tag flag conflicts with the expand-tag flag")
+	}
+	if b.AutoTag && b.Calver {
+		return nil, fmt.Errorf("The auto-tag flag conflicts with the calver flag")
+	}
+	if err := b.checkExpandTagLevels(); err != nil {
+		return nil, err
+	}
+	if b.AutoTag {
+		var err error
+		tags, err = b.AutoTags()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var labels []string
+	for _, entry := range tags {
+		// a .tags file can list one tag per line
+		for _, tag := range strings.Fields(entry) {
+			labels = append(labels, b.labelsForTag(tag)...)
+		}
+	}
+	if b.Calver {
+		tag, err := b.calverTag()
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, tag)
+	}
+	if b.TagContent {
+		tag, err := b.ContentTag()
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, tag)
+	}
+	for i, label := range labels {
+		labels[i] = b.TagPrefix + label + b.TagSuffix
+	}
+	return tagger.Normalize(labels, b.SanitizeTags)
+}
+
+// calverTag returns the calendar version tag of the build. The date is the
+// build creation time, so that restarted builds push the same tag.
+func (b Build) calverTag() (string, error) {
+	created := time.Now()
+	if b.DroneBuildCreated > 0 {
+		created = time.Unix(b.DroneBuildCreated, 0)
+	}
+	return tagger.Calver(b.CalverTemplate, b.CalverTimezone, tagger.CalverData{
+		Time:   created,
+		Build:  b.DroneBuildNumber,
+		Commit: b.DroneCommitSha,
+		Branch: b.DroneCommitBranch,
+	})
+}
+
+// Exec executes the plugin step. Cancelling ctx stops the build, cleaning up
+// before returning.
+func (p Plugin) Exec(ctx context.Context) error {
+	if p.Status.Token != "" && !p.Build.Offline {
+		return p.execWithStatus(ctx)
+	}
+	return p.exec(ctx)
+}
+
+func (p Plugin) exec(ctx context.Context) error {
+	if p.Build.FIPS {
+		if err := fips.Check(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "FIPS mode: cryptography provided by the BoringCrypto module, TLS restricted to FIPS approved settings\n")
+	}
 	if !p.Build.NoPush && p.Build.Repo == "" {
 		return fmt.Errorf("repository name to publish image must be specified")
 	}
+	switch p.Build.ReferrersMode {
+	case "", registry.ReferrersAuto, registry.ReferrersAPI, registry.ReferrersTag:
+	default:
+		return fmt.Errorf("unsupported referrers mode %q, expected %s, %s or %s", p.Build.ReferrersMode, registry.ReferrersAuto, registry.ReferrersAPI, registry.ReferrersTag)
+	}
+	switch p.Artifact.Schema {
+	case "", artifact.SchemaV1, artifact.SchemaV2:
+	default:
+		return fmt.Errorf("unsupported artifact schema %q, expected %s or %s", p.Artifact.Schema, artifact.SchemaV1, artifact.SchemaV2)
+	}
+	if _, err := p.Build.pushCheck(); err != nil {
+		return err
+	}
+	if _, err := p.Build.logArgs(); err != nil {
+		return err
+	}
+	if err := p.Build.checkCacheLock(); err != nil {
+		return err
+	}
 
-	if _, err := os.Stat(p.Build.Dockerfile); os.IsNotExist(err) {
-		return fmt.Errorf("dockerfile does not exist at path: %s", p.Build.Dockerfile)
+	if _, err := p.Build.parseClientCerts(); err != nil {
+		return err
+	}
+	redactPatterns, err := redact.Compile(p.Build.RedactPatterns)
+	if err != nil {
+		return err
+	}
+	labels, err := p.Build.resolveLabels()
+	if err != nil {
+		return err
+	}
+	p.Build.Labels = labels
+	p.Build.capturedEnv = p.Build.captureEnv()
+	p.Build.Labels = append(p.Build.Labels, p.Build.envLabels()...)
+	if err := p.Output.checkOutputBucket(); err != nil {
+		return err
+	}
+	if err := p.checkContextBucket(); err != nil {
+		return err
+	}
+	if err := p.checkOffline(); err != nil {
+		return err
+	}
+	if p.Output.Bucket != "" {
+		// also uploads the diagnostics of failed builds
+		defer p.uploadOutputs(ctx)
 	}
 
-	var tags = p.Build.Tags
-	if p.Build.AutoTag && p.Build.ExpandTag {
-		return fmt.Errorf("The auto-tag flag conflicts with the expand-tag flag")
+	executor, err := p.executorRunner()
+	if err != nil {
+		return err
 	}
-	if p.Build.AutoTag {
-		var err error
-		tags, err = p.Build.AutoTags()
+	if p.Build.CheckUpdates {
+		checkUpdates(ctx)
+	}
+	if _, local := executor.(ExecRunner); local && p.Build.builder() == BuilderKaniko {
+		p.Build.executorVersion, _ = buildinfo.Executor(ctx, p.executor())
+	}
+
+	if p.Credentials != nil {
+		cleanup, err := p.writeCredentials(ctx)
 		if err != nil {
 			return err
 		}
+		defer cleanup()
+	}
+	cacheRepo, err := p.Build.writeCacheCredentials()
+	if err != nil {
+		return err
+	}
+	p.Build.CacheRepo = cacheRepo
+	if err := p.Build.writeHubPullCredentials(); err != nil {
+		return err
+	}
+	if p.Build.PushOnly {
+		return p.pushLayout(ctx)
 	}
 
-	cmdArgs := []string{
-		fmt.Sprintf("--dockerfile=%s", p.Build.Dockerfile),
-		fmt.Sprintf("--context=dir://%s", p.Build.Context),
+	remote := isRemoteContext(p.Build.Context)
+	if remote && len(p.Build.ExtraContexts) > 0 {
+		return fmt.Errorf("extra contexts are not supported with a remote build context")
 	}
 
-	// Set the destination repository only when we push or save to tarball
-	if !p.Build.NoPush || p.Build.TarPath != "" {
-		for _, tag := range tags {
-			for _, label := range p.Build.labelsForTag(tag) {
-				cmdArgs = append(cmdArgs, fmt.Sprintf("--destination=%s:%s", p.Build.Repo, label))
+	dockerfile, cleanup, err := p.Build.resolveDockerfile(remote)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	p.Build.Dockerfile = dockerfile
+
+	if p.Build.CacheBust != "" {
+		if remote {
+			return fmt.Errorf("cache bust is not supported with a remote build context")
+		}
+		dockerfile, cleanup, err := p.Build.stageCacheBust()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		p.Build.Dockerfile = dockerfile
+		p.Build.Args = append(p.Build.Args, cacheBustArg+"="+p.Build.CacheBust)
+	}
+
+	if p.Build.MirrorPreset != "" {
+		preset, err := p.Build.mirrorPreset()
+		if err != nil {
+			return err
+		}
+		if preset.mirror != "" && !contains(p.Build.Mirrors, preset.mirror) {
+			p.Build.Mirrors = append(p.Build.Mirrors, preset.mirror)
+		}
+		if !remote {
+			dockerfile, cleanup, err := p.Build.stageMirrorPreset(preset)
+			if err != nil {
+				return err
 			}
+			defer cleanup()
+			p.Build.Dockerfile = dockerfile
 		}
 	}
 
-	// Set the build arguments
-	for _, arg := range p.Build.Args {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--build-arg=%s", arg))
+	p.detectPlatform()
+	platform, err := p.Build.normalizePlatform()
+	if err != nil {
+		return err
+	}
+	if platform != p.Build.Platform {
+		fmt.Fprintf(os.Stdout, "Building for the platform %s, normalized from %s\n", platform, p.Build.Platform)
+		p.Build.Platform = platform
 	}
-	// Set the labels
-	for _, label := range p.Build.Labels {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--label=%s", label))
+	if err := p.Build.checkPlatform(remote); err != nil {
+		return err
 	}
-	// Set repository mirrors
-	for _, mirror := range p.Build.Mirrors {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--registry-mirror=%s", mirror))
+	if err := p.Build.checkTarget(remote); err != nil {
+		return err
 	}
-	if p.Build.Target != "" {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--target=%s", p.Build.Target))
+	if p.Build.AutoProxyArgs {
+		args := p.Build.autoProxyArgs(remote)
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stdout, "Forwarding dependency proxy build args: %s\n", strings.Join(argNames(args), ", "))
+		}
+		p.Build.Args = append(p.Build.Args, args...)
+	}
+	if err := p.Build.checkArgs(remote); err != nil {
+		return err
+	}
+	chart, chartRef, err := p.Build.loadHelmChart()
+	if err != nil {
+		return err
+	}
+	ociArtifact, err := p.Build.loadOCIArtifact()
+	if err != nil {
+		return err
+	}
+
+	if len(p.Build.TriggerPaths) > 0 {
+		changed, files, err := trigger.Changed(".", p.Build.DroneCommitBefore, p.Build.DroneCommitAfter, p.Build.TriggerPaths, p.Build.ignoredChange())
+		switch {
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "failed to detect changed paths, building anyway: %s\n", err)
+		case !changed:
+			fmt.Fprintf(os.Stdout, "No changed files match trigger paths %s, skipping build\n", strings.Join(p.Build.TriggerPaths, ","))
+			if p.Artifact.ArtifactFile != "" {
+				if err := artifact.Write(p.Artifact.Schema, p.Artifact.ArtifactFile, p.artifact(nil, nil)); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to write plugin artifact file at path: %s with error: %s\n", p.Artifact.ArtifactFile, err)
+				}
+			}
+			return nil
+		default:
+			fmt.Fprintf(os.Stdout, "Changed files matching trigger paths: %s\n", strings.Join(files, ","))
+		}
+	}
+
+	if err := p.Build.preflight(); err != nil {
+		return err
+	}
+	if check, _ := p.Build.pushCheck(); check == PushCheckProbe && !p.Build.NoPush {
+		if err := p.Build.probePush(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := p.Build.checkDiskSpace(); err != nil {
+		return err
 	}
 
-	if p.Build.SkipTlsVerify {
-		cmdArgs = append(cmdArgs, "--skip-tls-verify=true")
+	if p.Build.AutoTune {
+		p.Build.logAutoTune()
 	}
 
-	if p.Build.SnapshotMode != "" {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--snapshotMode=%s", p.Build.SnapshotMode))
+	maxSize, maxUncompressedSize, err := p.Build.sizeLimits()
+	if err != nil {
+		return err
 	}
 
-	if p.Build.EnableCache {
-		cmdArgs = append(cmdArgs, "--cache=true")
+	tags, err := p.Build.ResolveTags()
+	if err != nil {
+		return err
+	}
 
-		if p.Build.CacheRepo != "" {
-			cmdArgs = append(cmdArgs, fmt.Sprintf("--cache-repo=%s", p.Build.CacheRepo))
+	var report *layerReport
+	if p.Build.LayerReport {
+		if report, err = p.newLayerReport(ctx, tags); err != nil {
+			return err
 		}
 	}
 
-	if p.Build.CacheTTL != 0 {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--cache-ttl=%dh", p.Build.CacheTTL))
+	if p.Build.SkipIfExists && !p.Build.NoPush {
+		// check the provided tags, or a tag derived from the build inputs when
+		// only the default latest tag is set, as latest always exists
+		var checkTags []string
+		for _, tag := range tags {
+			if tag != "latest" {
+				checkTags = append(checkTags, tag)
+			}
+		}
+		if p.Build.TagContent {
+			// the content tag identifies the inputs, other tags may move
+			checkTags = filterPrefix(tags, p.Build.TagPrefix+contentTagPrefix)
+		}
+		if len(checkTags) == 0 {
+			contentTag, err := p.Build.ContentTag()
+			if err != nil {
+				return err
+			}
+			tags = append(tags, contentTag)
+			checkTags = []string{contentTag}
+		}
+
+		digest, err := p.Build.existingDigest(ctx, checkTags)
+		if err != nil {
+			return err
+		}
+		if digest != "" {
+			fmt.Fprintf(os.Stdout, "Image %s:%s already exists with digest %s, skipping build\n", p.Build.Repo, strings.Join(checkTags, ","), digest)
+			if p.Build.DigestFile != "" {
+				if err := ioutil.WriteFile(p.Build.DigestFile, []byte(digest), 0644); err != nil {
+					return errors.Wrap(err, "failed to write digest file")
+				}
+			}
+			p.writeOutputs(ctx, checkTags, nil)
+			return nil
+		}
 	}
 
-	if p.Build.DigestFile != "" {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--digest-file=%s", p.Build.DigestFile))
+	// save the image to a tarball and push it after testing it
+	testsImage := p.Build.testsImage()
+	if testsImage {
+		tarball, cleanup, err := p.Build.testTarball()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		p.Build.TarPath = tarball
 	}
 
-	if p.Build.NoPush {
-		cmdArgs = append(cmdArgs, "--no-push")
+	buildContext := p.Build.Context
+	if len(p.Build.ExtraContexts) > 0 {
+		buildContext, err = p.Build.stageContexts()
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(buildContext)
+	}
+	var uploaded string
+	if p.Backend.ContextBucket != "" && !remote {
+		store, err := state.Open(p.Backend.ContextBucket)
+		if err != nil {
+			return err
+		}
+		buildContext, uploaded, err = p.uploadContext(ctx, store, filepath.Join(buildContext, p.Build.ContextSubPath))
+		if err != nil {
+			return err
+		}
 	}
 
-	if p.Build.Verbosity != "" {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--verbosity=%s", p.Build.Verbosity))
+	in := buildInput{
+		context:  buildContext,
+		uploaded: uploaded,
+		tags:     tags,
+		noPush:   p.Build.NoPush || testsImage,
 	}
 
-	if p.Build.Platform != "" {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--customPlatform=%s", p.Build.Platform))
+	if len(p.Build.Secrets) > 0 {
+		cleanup, err := stageSecrets(secretsDir, p.Build.Secrets)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		in.secrets = true
 	}
 
-	if p.Build.SkipUnusedStages {
-		cmdArgs = append(cmdArgs, "--skip-unused-stages")
+	if len(p.Build.RegistryClientCerts) > 0 {
+		clientCerts, cleanup, err := p.Build.stageClientCerts()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		in.clientCerts = clientCerts
 	}
 
-	if p.Build.TarPath != "" {
-		cmdArgs = append(cmdArgs, fmt.Sprintf("--tar-path=%s", p.Build.TarPath))
+	var secretEnv []string
+	if len(p.Build.SecretArgs) > 0 {
+		in.secretArgs, secretEnv, err = parseSecretArgs(p.Build.SecretArgs, p.Build.Args)
+		if err != nil {
+			return err
+		}
+		executor = withSecretEnv(executor, secretEnv)
+	}
+
+	if p.Build.SSHKey != "" || p.Build.SSHKnownHosts != "" || p.Build.SSHAgentSock != "" {
+		in.sshDir = filepath.Join(p.Build.scratchDir(), "ssh")
+		sshArgs, cleanup, err := p.Build.stageSSH(in.sshDir)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		in.sshArgs = sshArgs
+	}
+
+	if p.perTagDigests() {
+		os.Remove(p.Build.imageTagDigestPath())
+	}
+
+	_, local := executor.(ExecRunner)
+	if in.runCacheDirs, err = p.runCacheDirs(local, remote); err != nil {
+		return err
+	}
+
+	if len(p.Build.Volumes) > 0 {
+		if in.volumes, err = parseVolumes(p.Build.Volumes); err != nil {
+			return err
+		}
+		if p.Build.builder() == BuilderKaniko {
+			if !local {
+				return fmt.Errorf("volumes need the kaniko executor running in the plugin container")
+			}
+			cleanup, err := stageVolumes(in.volumes)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+		}
+	}
+
+	unlockCache := func() {}
+	if p.Build.CacheLock != "" {
+		var locked bool
+		if unlockCache, locked, err = p.Build.lockCache(ctx); err != nil {
+			return err
+		}
+		defer unlockCache()
+		in.noPushCache = !locked
+	}
+
+	cmdArgs, err := p.builderArgs(in)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(p.executor(), cmdArgs...)
+	// keep the end of the output to classify failures
+	log := &diagnostics.TailBuffer{Max: diagnosticsLogSize}
+	// the kept output is masked too, as it ends up in the error summary
+	stdout := p.Build.redactOutput(io.MultiWriter(os.Stdout, log), redactPatterns)
+	stderr := p.Build.redactOutput(io.MultiWriter(os.Stderr, log), redactPatterns)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	var summary *buildlog.Parser
+	if p.Build.BuildSummary || p.Build.CacheKeys || p.Build.TimingFile != "" || p.Build.StatsdAddress != "" || p.Build.StateStore != "" || p.Build.CardPath != "" {
+		summary = &buildlog.Parser{}
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, summary)
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, summary)
+	}
+	env := p.Build.contextEnv()
+	env = append(env, secretEnv...)
+	if p.Build.DockerConfigDir != "" {
+		env = append(env, "DOCKER_CONFIG="+p.Build.DockerConfigDir)
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if remote && p.Build.NetrcMachine != "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return errors.Wrap(err, "failed to locate home directory for netrc")
+		}
+		restore, err := p.Build.stageNetrc(home)
+		if err != nil {
+			return err
+		}
+		defer restore()
 	}
-	
-	cmd := exec.Command("/kaniko/executor", cmdArgs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
 	trace(cmd)
 
-	err := cmd.Run()
+	unlock := func() {}
+	if local && p.Build.builder() == BuilderKaniko {
+		if unlock, err = p.Build.lockKanikoDir(); err != nil {
+			return err
+		}
+	}
+	p.Build.restoreRunCache(in.runCacheDirs)
+	err = executor.Run(ctx, cmd)
+	if err != nil && p.Build.retryThroughHubMirror(err, log.Bytes()) {
+		fmt.Fprintf(os.Stdout, "Docker Hub rate limit reached, retrying through registry mirror %s\n", p.Build.HubMirror)
+		log.Reset()
+		cmd = withArgs(cmd, "--registry-mirror="+p.Build.HubMirror)
+		trace(cmd)
+		err = executor.Run(ctx, cmd)
+	}
+	if ctx.Err() == nil {
+		p.Build.saveRunCache(in.runCacheDirs)
+	}
+	unlock()
+	unlockCache()
+	stdout.Flush()
+	stderr.Flush()
+	if p.Build.CacheKeys {
+		buildlog.PrintCacheKeys(os.Stdout, summary.Summary())
+	}
+	if summary != nil {
+		p.Build.exportTimings(summary.Summary())
+	}
 	if err != nil {
+		if p.Build.DebugSnapshot && ctx.Err() == nil {
+			p.writeDebugSnapshot(ctx, local)
+		}
+		return p.buildFailure(err, log.Bytes())
+	}
+	if err := p.afterBuild(ctx, executor, cmd, in); err != nil {
 		return err
 	}
+	if p.Build.OCILayout != "" {
+		if err := p.Build.writeLayoutDescriptor(); err != nil {
+			return err
+		}
+	}
+
+	if testsImage {
+		if p.Build.TestCommand != "" {
+			if err := p.Build.smokeTest(ctx, p.Build.TarPath); err != nil {
+				return err
+			}
+		}
+		if len(p.Build.StructureTestConfigs) > 0 {
+			if err := p.structureTest(ctx, p.Build.TarPath); err != nil {
+				return err
+			}
+		}
+		if !p.Build.NoPush {
+			if err := p.Build.pushTarball(ctx, p.Build.TarPath, tags); err != nil {
+				return errors.Wrap(err, "failed to push the tested image")
+			}
+		}
+	}
+
+	if err := p.applyPostLabels(ctx, tags); err != nil {
+		return err
+	}
+
+	var img *image.Image
+	if maxSize > 0 || maxUncompressedSize > 0 || report != nil {
+		inspected, err := p.inspectImage(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to inspect image")
+		}
+		img = &inspected
+		if report != nil {
+			report.write(inspected)
+		}
+		if err := checkImageSize(inspected, maxSize, maxUncompressedSize); err != nil {
+			return err
+		}
+	}
+
+	if p.Build.BuildSummary {
+		p.writeBuildSummary(summary.Summary(), img)
+	}
+	if p.Build.StateStore != "" {
+		p.Build.recordBuildState(ctx, summary.Summary())
+	}
+
+	references := p.writeAttestation(ctx, remote)
+	if chart != nil {
+		charts, err := p.pushHelmChart(ctx, chart, chartRef)
+		if err != nil {
+			return err
+		}
+		references = append(references, charts...)
+	}
+	if ociArtifact != nil {
+		pushed, err := p.pushOCIArtifact(ctx, ociArtifact)
+		if err != nil {
+			return err
+		}
+		references = append(references, pushed...)
+	}
+	p.writeOutputs(ctx, tags, references)
+	if p.Build.CardPath != "" {
+		p.writeCard(summary, img, tags)
+	}
+	if p.Build.CacheCleanup && p.Build.EnableCache && p.Build.CacheRepo != "" && p.Build.builder() == BuilderKaniko {
+		p.Build.cleanCache(ctx)
+	}
+
+	if p.GitOps.Repo != "" && !p.Build.NoPush && len(tags) > 0 {
+		update := gitops.Update{
+			Image:  p.Build.Repo,
+			Tag:    gitopsTag(tags),
+			Tags:   tags,
+			Digest: getDigest(p.Build.DigestFile),
+		}
+		if err = gitops.Commit(ctx, p.GitOps, update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stageContexts copies the build context and each named extra context into a
+// staging directory, with the extra contexts placed under <name>/ of the
+// context root, the context sub path when set. The staging directory lives in
+// the kaniko directory so it is never snapshotted into the image.
+func (b Build) stageContexts() (string, error) {
+	extras, err := parseExtraContexts(b.ExtraContexts)
+	if err != nil {
+		return "", err
+	}
+
+	parent := b.kanikoDir()
+	if _, err := os.Stat(parent); err != nil {
+		parent = ""
+	}
+	dir, err := ioutil.TempDir(parent, "context-")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create context staging directory")
+	}
+	if err := fsutil.CopyDir(b.Context, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", errors.Wrap(err, "failed to stage build context")
+	}
+	root := filepath.Join(dir, b.ContextSubPath)
+	if rel, err := filepath.Rel(dir, root); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("context sub path %s is not within the build context", b.ContextSubPath)
+	}
+	for _, extra := range extras {
+		target := filepath.Join(root, extra.name)
+		if _, err := os.Lstat(target); err == nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("extra context %s conflicts with an existing path in the build context", extra.name)
+		}
+		if err := fsutil.CopyDir(extra.path, target); err != nil {
+			os.RemoveAll(dir)
+			return "", errors.Wrap(err, fmt.Sprintf("failed to stage extra context %s", extra.name))
+		}
+		fmt.Fprintf(os.Stdout, "Staged extra context %s from %s\n", extra.name, extra.path)
+	}
+	return dir, nil
+}
+
+type extraContext struct {
+	name string
+	path string
+}
+
+// parseExtraContexts parses name=path pairs. Names must be a single path
+// element as they become directories in the staged context.
+func parseExtraContexts(values []string) ([]extraContext, error) {
+	var extras []extraContext
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid extra context %q, expected name=path", value)
+		}
+		name := parts[0]
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("invalid extra context name %q", name)
+		}
+		info, err := os.Stat(parts[1])
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("extra context %s", name))
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("extra context %s is not a directory: %s", name, parts[1])
+		}
+		extras = append(extras, extraContext{name: name, path: parts[1]})
+	}
+	return extras, nil
+}
+
+// buildFailure classifies the kaniko failure, writing the error summary and
+// diagnostics bundle when configured.
+func (p Plugin) buildFailure(err error, log []byte) error {
+	f := failure.Classify(err, log)
+	fmt.Fprintf(os.Stderr, "Build failed: %s (exit code %d)\n", f.Category, f.ExitCode)
+	if f.Category == failure.RateLimited {
+		p.Build.printRateLimitHelp()
+	}
+	if p.Build.ErrorSummaryFile != "" {
+		if err := failure.WriteSummary(p.Build.ErrorSummaryFile, f); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write error summary at path: %s with error: %s\n", p.Build.ErrorSummaryFile, err)
+		}
+	}
+	if p.Build.DiagnosticsPath != "" {
+		p.writeDiagnostics(log, err)
+	}
+	return &failure.Error{Failure: f, Err: err}
+}
+
+// writeOutputs writes the artifact and output files and the digest
+// directory for the published image, with the artifacts attached to it.
+func (p Plugin) writeOutputs(ctx context.Context, tags []string, references []artifact.Reference) {
+	var digests map[string]string
+	if p.perTagDigests() {
+		digests = p.tagDigests(ctx, append(append([]string(nil), tags...), p.Artifact.Tags...))
+	}
 
 	if p.Build.DigestFile != "" && p.Artifact.ArtifactFile != "" {
-		err = artifact.WritePluginArtifactFile(p.Artifact.RegistryType, p.Artifact.ArtifactFile, p.Artifact.Registry, p.Artifact.Repo, getDigest(p.Build.DigestFile), p.Artifact.Tags)
+		err := artifact.Write(p.Artifact.Schema, p.Artifact.ArtifactFile, p.artifact(digests, references))
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to write plugin artifact file at path: %s with error: %s\n", p.Artifact.ArtifactFile, err)
 		}
 	}
 
+	if p.Build.DigestDir != "" {
+		if err := writeDigestDir(p.Build.DigestDir, tags, digests); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write digest directory at path: %s with error: %s\n", p.Build.DigestDir, err)
+		}
+	}
+
 	if p.Output.OutputFile != "" {
-		if err = output.WritePluginOutputFile(p.Output.OutputFile, getDigest(p.Build.DigestFile)); err != nil {
+		if err := output.WritePluginOutputFile(p.Output.OutputFile, getDigest(p.Build.DigestFile)); err != nil {
 			fmt.Fprintf(os.Stderr, "failed to write plugin output file at path: %s with error: %s\n", p.Output.OutputFile, err)
 		}
 	}
+}
 
-	return nil
+// artifact describes the published image for the artifact file.
+func (p Plugin) artifact(digests map[string]string, references []artifact.Reference) artifact.Artifact {
+	a := artifact.Artifact{
+		RegistryType: p.Artifact.RegistryType,
+		RegistryUrl:  p.Artifact.Registry,
+		Repo:         p.Artifact.Repo,
+		Tags:         p.Artifact.Tags,
+		Digests:      digests,
+		References:   references,
+		Build: artifact.BuildMetadata{
+			Builder:     p.Build.builder(),
+			Target:      p.Build.Target,
+			CommitSha:   p.Build.DroneCommitSha,
+			CommitRef:   p.Build.DroneCommitRef,
+			BuildNumber: p.Build.DroneBuildNumber,
+			BuildLink:   os.Getenv("DRONE_BUILD_LINK"),
+
+			ExecutorVersion: p.Build.executorVersion,
+		},
+	}
+	a.Build.PluginVersion, a.Build.PluginCommit = buildinfo.Plugin()
+	if p.Build.Platform != "" {
+		a.Platforms = strings.Split(p.Build.Platform, ",")
+	}
+	return a
+}
+
+// ContentTag returns a tag derived from the hash of the build inputs, so that
+// identical inputs always produce the same tag. Files excluded by the
+// .dockerignore file do not change the tag.
+func (b Build) ContentTag() (string, error) {
+	hash, err := contexthash.Compute(contexthash.Inputs{
+		Context:    b.contextRoot(),
+		Dockerfile: b.Dockerfile,
+		Args:       b.Args,
+		Target:     b.Target,
+		Platform:   b.Platform,
+		Ignore:     b.dockerignore(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return contentTagPrefix + hash[:16], nil
+}
+
+// existingDigest returns the digest all tags point to in the registry, or an
+// empty string if any of them is missing or they differ.
+func (b Build) existingDigest(ctx context.Context, tags []string) (string, error) {
+	client := b.registryClient()
+
+	var digest string
+	for _, tag := range tags {
+		ref, err := registry.ParseReference(fmt.Sprintf("%s:%s", b.Repo, tag))
+		if err != nil {
+			return "", err
+		}
+		desc, err := client.Head(ctx, ref)
+		if errors.Is(err, registry.ErrNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("failed to check if %s exists", ref))
+		}
+		if digest != "" && digest != desc.Digest {
+			return "", nil
+		}
+		digest = desc.Digest
+	}
+	return digest, nil
+}
+
+// gitopsTag returns the most specific pushed tag, preferring anything over latest.
+func gitopsTag(tags []string) string {
+	for i := len(tags) - 1; i >= 0; i-- {
+		if tags[i] != "latest" {
+			return tags[i]
+		}
+	}
+	return tags[len(tags)-1]
 }
 
 func getDigest(digestFile string) string {
@@ -264,3 +1133,23 @@ func getDigest(digestFile string) string {
 func trace(cmd *exec.Cmd) {
 	fmt.Fprintf(os.Stdout, "+ %s\n", strings.Join(cmd.Args, " "))
 }
+
+// filterPrefix returns the values starting with prefix.
+func filterPrefix(values []string, prefix string) (filtered []string) {
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
+
+// contains returns true if values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,13 @@
 package kaniko
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -73,6 +79,32 @@ func TestBuild_labelsForTag(t *testing.T) {
 	}
 }
 
+func TestBuild_labelsForTag_levels(t *testing.T) {
+	b := Build{
+		ExpandTag:       true,
+		ExpandTagLevels: []string{"patch", "minor"},
+		ExpandTagLatest: true,
+		DroneCommitRef:  "refs/tags/v1.4.2",
+		DroneRepoBranch: "main",
+	}
+	if got, want := b.labelsForTag("v1.4.2"), []string{"1.4", "1.4.2", "latest"}; !cmp.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// pre-releases are never tagged as latest
+	if got, want := b.labelsForTag("v1.4.2-rc1"), []string{"1.4.2-rc1"}; !cmp.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	b.DroneCommitRef = "refs/heads/feature"
+	if got, want := b.labelsForTag("v1.4.2"), []string{"1.4", "1.4.2"}; !cmp.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	b.ExpandTagLevels = []string{"micro"}
+	if _, err := b.ResolveTags(); err == nil {
+		t.Errorf("Expect error for unknown level")
+	}
+}
+
 func TestBuild_AutoTags(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -148,3 +180,175 @@ func TestBuild_AutoTags(t *testing.T) {
 		}
 	})
 }
+
+func TestBuild_ResolveTags(t *testing.T) {
+	b := Build{Tags: []string{"v1.2.3", "1.2.3", "latest", ""}, ExpandTag: true}
+	tags, err := b.ResolveTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "1.2", "1.2.3", "latest"}; !cmp.Equal(tags, want) {
+		t.Errorf("Got tags %v, want %v", tags, want)
+	}
+
+	b = Build{Tags: []string{"v1.2.3+linux_amd64"}, ExpandTag: true}
+	if _, err := b.ResolveTags(); err == nil {
+		t.Errorf("Expect error for build metadata in tags")
+	}
+	b.SanitizeTags = true
+	tags, err = b.ResolveTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1-linux-amd64", "1.2-linux-amd64", "1.2.3-linux-amd64"}; !cmp.Equal(tags, want) {
+		t.Errorf("Got tags %v, want %v", tags, want)
+	}
+}
+
+func TestBuild_ResolveTags_prefixSuffix(t *testing.T) {
+	b := Build{
+		DroneCommitRef:  "refs/tags/v1.2.3",
+		DroneRepoBranch: "master",
+		AutoTag:         true,
+		TagPrefix:       "staging-",
+		TagSuffix:       "-arm64",
+	}
+	tags, err := b.ResolveTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"staging-1-arm64", "staging-1.2-arm64", "staging-1.2.3-arm64"}; !cmp.Equal(tags, want) {
+		t.Errorf("Got tags %v, want %v", tags, want)
+	}
+}
+
+func TestBuild_ResolveTags_calver(t *testing.T) {
+	b := Build{
+		Tags:              []string{"nightly"},
+		Calver:            true,
+		CalverTimezone:    "America/New_York",
+		DroneBuildNumber:  "42",
+		DroneBuildCreated: time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC).Unix(),
+		TagSuffix:         "-arm64",
+	}
+	tags, err := b.ResolveTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"nightly-arm64", "2024.05.31-42-arm64"}; !cmp.Equal(tags, want) {
+		t.Errorf("Got tags %v, want %v", tags, want)
+	}
+
+	b.AutoTag = true
+	if _, err := b.ResolveTags(); err == nil {
+		t.Errorf("Expect error when combined with auto-tag")
+	}
+}
+
+func TestBuild_ResolveTags_content(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := Build{Tags: []string{"latest"}, Context: dir, Dockerfile: filepath.Join(dir, "Dockerfile"), TagContent: true}
+	tags, err := b.ResolveTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := b.ResolveTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0] != "latest" || !strings.HasPrefix(tags[1], contentTagPrefix) {
+		t.Errorf("Got tags %v, want latest and a content tag", tags)
+	}
+	if !cmp.Equal(tags, again) {
+		t.Errorf("Content tag not stable, got %v and %v", tags, again)
+	}
+}
+
+func TestPlugin_ExecResolvedTags(t *testing.T) {
+	b := testBuild(t)
+	b.Repo = "registry.example.com/app"
+	b.TarPath = filepath.Join(b.KanikoDir, "image.tar")
+	b.Tags = []string{"1.2.3"}
+	b.TagPrefix = "staging-"
+	b.TagSuffix = "-arm64"
+	b.Calver = true
+	b.DroneBuildNumber = "42"
+	b.DroneBuildCreated = time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC).Unix()
+	b.TagContent = true
+	tags, err := b.ResolveTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// as with the immutable tag strategy of ecr, which replaces a tag
+	tags[0] = "staging-1.2.3-arm64-abc1234"
+	b.Tags = tags
+	b.TagsResolved = true
+
+	runner := &fakeRunner{}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var destinations []string
+	for _, arg := range runner.cmds[0].Args {
+		if strings.HasPrefix(arg, "--destination=") {
+			destinations = append(destinations, strings.TrimPrefix(arg, "--destination="+b.Repo+":"))
+		}
+	}
+	if !cmp.Equal(destinations, tags) {
+		t.Errorf("Got destinations %v, want the resolved tags %v", destinations, tags)
+	}
+}
+
+func TestBuild_stageContexts(t *testing.T) {
+	primary := t.TempDir()
+	shared := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(primary, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(shared, "lib.txt"), []byte("lib\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := Build{Context: primary, ExtraContexts: []string{"shared=" + shared}}
+	dir, err := b.stageContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{"Dockerfile", "shared/lib.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, path)); err != nil {
+			t.Errorf("expected %s in staged context: %s", path, err)
+		}
+	}
+
+	// the extra contexts are reachable from the context root
+	if err := os.MkdirAll(filepath.Join(primary, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sub := Build{Context: primary, ContextSubPath: "app", ExtraContexts: []string{"shared=" + shared}}
+	subDir, err := sub.stageContexts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(subDir)
+	if _, err := os.Stat(filepath.Join(subDir, "app", "shared", "lib.txt")); err != nil {
+		t.Errorf("expected the extra context within the context sub path: %s", err)
+	}
+	sub.ContextSubPath = "../outside"
+	if dir, err := sub.stageContexts(); err == nil {
+		os.RemoveAll(dir)
+		t.Error("expected error for a context sub path outside of the build context")
+	}
+
+	for _, extra := range []string{"shared", "=" + shared, "../up=" + shared, "Dockerfile=" + shared} {
+		b := Build{Context: primary, ExtraContexts: []string{extra}}
+		if dir, err := b.stageContexts(); err == nil {
+			os.RemoveAll(dir)
+			t.Errorf("expected error for extra context %q", extra)
+		}
+	}
+}
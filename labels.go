@@ -0,0 +1,99 @@
+package kaniko
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// labelKeyRE matches label keys, alphanumerics separated by dots, dashes,
+// underscores and slashes, e.g. org.opencontainers.image.source.
+var labelKeyRE = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// resolveLabels returns the labels of the labels file merged with Labels,
+// which take precedence over the file. Label keys are validated.
+func (b Build) resolveLabels() ([]string, error) {
+	var labels [][2]string
+	if b.LabelsFile != "" {
+		content, err := ioutil.ReadFile(b.LabelsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read labels file")
+		}
+		if labels, err = parseLabelsFile(content); err != nil {
+			return nil, errors.Wrapf(err, "invalid labels file %s", b.LabelsFile)
+		}
+	}
+
+	index := map[string]int{}
+	for i, label := range labels {
+		index[label[0]] = i
+	}
+	for _, value := range b.Labels {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", value)
+		}
+		if i, ok := index[parts[0]]; ok {
+			labels[i][1] = parts[1]
+			continue
+		}
+		index[parts[0]] = len(labels)
+		labels = append(labels, [2]string{parts[0], parts[1]})
+	}
+
+	var resolved []string
+	for _, label := range labels {
+		if !labelKeyRE.MatchString(label[0]) {
+			return nil, fmt.Errorf("invalid label key %q", label[0])
+		}
+		resolved = append(resolved, label[0]+"="+label[1])
+	}
+	return resolved, nil
+}
+
+// parseLabelsFile parses a JSON object of string values, or key=value lines
+// where blank lines and lines starting with # are skipped. Later lines
+// override earlier ones.
+func parseLabelsFile(content []byte) ([][2]string, error) {
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '{' {
+		var values map[string]string
+		if err := json.Unmarshal(trimmed, &values); err != nil {
+			return nil, err
+		}
+		var labels [][2]string
+		for key, value := range values {
+			labels = append(labels, [2]string{key, value})
+		}
+		sort.Slice(labels, func(i, j int) bool { return labels[i][0] < labels[j][0] })
+		return labels, nil
+	}
+
+	var labels [][2]string
+	index := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key=value", n)
+		}
+		key = strings.TrimSpace(key)
+		if i, ok := index[key]; ok {
+			labels[i][1] = value
+			continue
+		}
+		index[key] = len(labels)
+		labels = append(labels, [2]string{key, value})
+	}
+	return labels, scanner.Err()
+}
@@ -0,0 +1,65 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuild_resolveLabels(t *testing.T) {
+	dir := t.TempDir()
+	lines := filepath.Join(dir, "labels")
+	content := "# compliance\norg.opencontainers.image.vendor=Example Corp\n\ncom.example.owner = team-a\ncom.example.note=a=b\n"
+	if err := ioutil.WriteFile(lines, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := Build{LabelsFile: lines, Labels: []string{"com.example.owner=team-b", "team=build"}}
+	got, err := b.resolveLabels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"org.opencontainers.image.vendor=Example Corp", "com.example.owner=team-b", "com.example.note=a=b", "team=build"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("labels mismatch (-want +got):\n%s", diff)
+	}
+
+	object := filepath.Join(dir, "labels.json")
+	if err := ioutil.WriteFile(object, []byte(`{"com.example.owner": "team-a", "com.example.cost-center": "42"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = Build{LabelsFile: object}.resolveLabels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"com.example.cost-center=42", "com.example.owner=team-a"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("labels mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuild_resolveLabels_invalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"missing-value": "com.example.owner\n",
+		"bad-key":       "com.example owner=team-a\n",
+		"json":          `{"com.example.owner": 1}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := (Build{LabelsFile: path}).resolveLabels(); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+	for _, label := range []string{"team", "=build", ".team=build", "team-=build"} {
+		if _, err := (Build{Labels: []string{label}}).resolveLabels(); err == nil {
+			t.Errorf("expected error for label %q", label)
+		}
+	}
+	if _, err := (Build{LabelsFile: filepath.Join(dir, "missing")}).resolveLabels(); err == nil {
+		t.Error("expected error for a missing labels file")
+	}
+}
@@ -0,0 +1,111 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/drone/drone-kaniko/pkg/image"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/drone/drone-kaniko/pkg/units"
+	"github.com/pkg/errors"
+)
+
+// defaultLayerReportFile is the layer report file name used next to the
+// artifact file.
+const defaultLayerReportFile = "layer-report.json"
+
+// layerReport compares the built image with the previous image, which is
+// fetched before the build as pushing replaces it.
+type layerReport struct {
+	file      string
+	threshold int64
+	baseline  string
+	previous  image.Image
+}
+
+// newLayerReport fetches the previous image of the repository. A missing
+// previous image is not an error, all layers are then reported as new.
+func (p Plugin) newLayerReport(ctx context.Context, tags []string) (*layerReport, error) {
+	report := &layerReport{file: p.Build.LayerReportFile}
+	if report.file == "" && p.Artifact.ArtifactFile != "" {
+		report.file = filepath.Join(filepath.Dir(p.Artifact.ArtifactFile), defaultLayerReportFile)
+	}
+	if p.Build.LayerReportThreshold != "" {
+		threshold, err := units.ParseSize(p.Build.LayerReportThreshold)
+		if err != nil {
+			return nil, err
+		}
+		report.threshold = threshold
+	}
+
+	tag := p.Build.LayerReportBaseline
+	if tag == "" && len(tags) > 0 {
+		tag = tags[0]
+	}
+	if tag == "" || p.Build.Repo == "" {
+		return report, nil
+	}
+	ref, err := registry.ParseReference(fmt.Sprintf("%s:%s", p.Build.Repo, tag))
+	if err != nil {
+		return nil, err
+	}
+	client := p.Build.registryClient()
+	previous, err := image.FromRegistry(ctx, client, ref)
+	switch {
+	case err == nil:
+		report.baseline = ref.String()
+		report.previous = previous
+	case errors.Is(err, registry.ErrNotFound):
+		fmt.Fprintf(os.Stdout, "No previous image %s, reporting all layers as new\n", ref)
+	default:
+		fmt.Fprintf(os.Stderr, "failed to fetch previous image %s for the layer report: %s\n", ref, err)
+	}
+	return report, nil
+}
+
+// write prints the comparison of the built image with the previous image
+// and writes it to the report file.
+func (r *layerReport) write(img image.Image) {
+	report := image.Compare(img, r.previous, r.threshold)
+	report.Baseline = r.baseline
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSIZE\tDELTA\tCOMMAND")
+	for _, layer := range report.Layers {
+		mark, delta := "", "new"
+		if layer.Grew {
+			mark = "!"
+		}
+		if layer.PreviousSize >= 0 {
+			delta = signedSize(layer.Delta)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, units.FormatSize(layer.Size), delta, truncate(layer.Command, 80))
+	}
+	w.Flush()
+	if r.baseline != "" {
+		fmt.Fprintf(os.Stdout, "Image size: %s (%s compared with %s)\n", units.FormatSize(report.Size), signedSize(report.Size-report.PreviousSize), r.baseline)
+	}
+
+	if r.file == "" {
+		return
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(r.file, content, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write layer report at path: %s with error: %s\n", r.file, err)
+	}
+}
+
+func signedSize(bytes int64) string {
+	if bytes > 0 {
+		return "+" + units.FormatSize(bytes)
+	}
+	return units.FormatSize(bytes)
+}
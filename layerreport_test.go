@@ -0,0 +1,33 @@
+package kaniko
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/image"
+)
+
+func TestLayerReport_write(t *testing.T) {
+	file := filepath.Join(t.TempDir(), defaultLayerReportFile)
+	r := &layerReport{
+		file:      file,
+		threshold: 100,
+		baseline:  "index.docker.io/foo/bar:latest",
+		previous:  image.Image{Layers: []image.Layer{{Command: "RUN make", Size: 1000}}},
+	}
+	r.write(image.Image{Layers: []image.Layer{{Command: "RUN make", Size: 1500}}})
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report image.Report
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Baseline != r.baseline || len(report.Layers) != 1 || !report.Layers[0].Grew || report.Layers[0].Delta != 500 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,74 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// layoutDescriptorFile is the file in the OCI layout the descriptor of the
+// image is written to, for the steps testing or pushing it.
+const layoutDescriptorFile = "descriptor.json"
+
+// writeLayoutDescriptor writes the descriptor of the image saved to the OCI
+// layout into the layout.
+func (b Build) writeLayoutDescriptor() error {
+	desc, err := registry.ReadLayout(b.OCILayout)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(b.OCILayout, layoutDescriptorFile), content, 0644); err != nil {
+		return errors.Wrap(err, "failed to write oci layout descriptor")
+	}
+	fmt.Fprintf(os.Stdout, "Saved image %s to oci layout %s\n", desc.Digest, b.OCILayout)
+	return nil
+}
+
+// pushLayout pushes the image an earlier step saved to the OCI layout with
+// the tags resolved in this step, instead of building it.
+func (p Plugin) pushLayout(ctx context.Context) error {
+	if p.Build.OCILayout == "" {
+		return fmt.Errorf("oci layout must be specified in push only mode")
+	}
+	if p.Build.NoPush {
+		return fmt.Errorf("push only mode cannot be combined with no push")
+	}
+	tags, err := p.Build.ResolveTags()
+	if err != nil {
+		return err
+	}
+	var refs []registry.Reference
+	for _, tag := range tags {
+		ref, err := registry.ParseReference(fmt.Sprintf("%s:%s", p.Build.Repo, tag))
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+	}
+
+	digest, err := p.Build.registryClient().PushLayout(ctx, p.Build.OCILayout, refs)
+	if err != nil {
+		return errors.Wrap(err, "failed to push the oci layout")
+	}
+	fmt.Fprintf(os.Stdout, "Pushed %s:%v with digest %s from oci layout %s\n", p.Build.Repo, tags, digest, p.Build.OCILayout)
+	if p.Build.DigestFile != "" {
+		if err := ioutil.WriteFile(p.Build.DigestFile, []byte(digest), 0644); err != nil {
+			return errors.Wrap(err, "failed to write digest file")
+		}
+	}
+	p.writeOutputs(ctx, tags, nil)
+	if p.Build.CardPath != "" {
+		p.writeCard(nil, nil, tags)
+	}
+	return nil
+}
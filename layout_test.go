@@ -0,0 +1,119 @@
+package kaniko
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+)
+
+func TestPlugin_ExecOCILayout(t *testing.T) {
+	b := testBuild(t)
+	b.OCILayout = filepath.Join(t.TempDir(), "image")
+	var digest string
+	runner := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		digest = writeTestLayout(t, b.OCILayout)
+		return nil
+	}}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := "--oci-layout-path=" + b.OCILayout; !contains(runner.cmds[0].Args, want) {
+		t.Errorf("expected %s in %v", want, runner.cmds[0].Args)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(b.OCILayout, layoutDescriptorFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var desc registry.Descriptor
+	if err := json.Unmarshal(content, &desc); err != nil || desc.Digest != digest || desc.MediaType != registry.MediaTypeOCIManifest {
+		t.Errorf("unexpected descriptor %s", content)
+	}
+}
+
+func TestPlugin_ExecPushOnly(t *testing.T) {
+	var mu sync.Mutex
+	manifests := map[string]bool{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/app/manifests/"):
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/app/manifests/")] = true
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	b := testBuild(t)
+	b.OCILayout = filepath.Join(t.TempDir(), "image")
+	digest := writeTestLayout(t, b.OCILayout)
+	b.PushOnly = true
+	b.NoPush = false
+	b.SkipTlsVerify = true
+	b.Repo = host.Host + "/app"
+	b.Tags = []string{"1.0", "latest"}
+	b.DigestFile = filepath.Join(t.TempDir(), "digest")
+	b.DockerConfigDir = t.TempDir()
+	runner := &fakeRunner{}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.cmds) != 0 {
+		t.Errorf("expected no build, got %v", runner.cmds)
+	}
+	if !manifests["1.0"] || !manifests["latest"] {
+		t.Errorf("expected both tags pushed, got %v", manifests)
+	}
+	if got := getDigest(b.DigestFile); got != digest {
+		t.Errorf("digest = %s, want %s", got, digest)
+	}
+
+	b.OCILayout = ""
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err == nil {
+		t.Error("expected error without an oci layout")
+	}
+}
+
+// writeTestLayout writes an OCI layout of a single layer image to dir and
+// returns the manifest digest.
+func writeTestLayout(t *testing.T, dir string) string {
+	write := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		path := filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:]))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	config := write(`{"architecture": "amd64"}`)
+	layer := write("layer")
+	manifest := fmt.Sprintf(`{"schemaVersion": 2, "config": {"digest": "%s", "size": 25}, "layers": [{"digest": "%s", "size": 5}]}`, config, layer)
+	digest := write(manifest)
+	index := fmt.Sprintf(`{"schemaVersion": 2, "manifests": [{"mediaType": "%s", "digest": "%s", "size": %d}]}`, registry.MediaTypeOCIManifest, digest, len(manifest))
+	if err := ioutil.WriteFile(filepath.Join(dir, registry.LayoutIndex), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return digest
+}
@@ -0,0 +1,32 @@
+package kaniko
+
+import "fmt"
+
+const (
+	// LogColorAuto leaves colors to the defaults of the plugin and the
+	// executor.
+	LogColorAuto = "auto"
+	// LogColorAlways colors the log output.
+	LogColorAlways = "always"
+	// LogColorNever writes the log output without ANSI codes, for log viewers
+	// showing them as is.
+	LogColorNever = "never"
+)
+
+// logArgs returns the kaniko executor flags of the log timestamps and colors.
+func (b Build) logArgs() ([]string, error) {
+	var args []string
+	if b.LogTimestamps {
+		args = append(args, "--log-timestamp")
+	}
+	switch b.LogColor {
+	case "", LogColorAuto:
+	case LogColorAlways:
+		args = append(args, "--log-format=color")
+	case LogColorNever:
+		args = append(args, "--log-format=text")
+	default:
+		return nil, fmt.Errorf("unsupported log color %q, expected %s, %s or %s", b.LogColor, LogColorAuto, LogColorAlways, LogColorNever)
+	}
+	return args, nil
+}
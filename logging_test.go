@@ -0,0 +1,31 @@
+package kaniko
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuild_logArgs(t *testing.T) {
+	tests := []struct {
+		build Build
+		want  []string
+	}{
+		{Build{}, nil},
+		{Build{LogColor: LogColorAuto}, nil},
+		{Build{LogTimestamps: true, LogColor: LogColorNever}, []string{"--log-timestamp", "--log-format=text"}},
+		{Build{LogColor: LogColorAlways}, []string{"--log-format=color"}},
+	}
+	for _, test := range tests {
+		got, err := test.build.logArgs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("args mismatch (-want +got):\n%s", diff)
+		}
+	}
+	if _, err := (Build{LogColor: "sometimes"}).logArgs(); err == nil {
+		t.Error("expected error for an unsupported log color")
+	}
+}
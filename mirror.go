@@ -0,0 +1,145 @@
+package kaniko
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// Mirror presets rewriting Docker Hub base images.
+const (
+	MirrorPresetGCR       = "gcr"
+	MirrorPresetECRPublic = "ecr-public"
+	MirrorPresetCustom    = "custom"
+)
+
+// mirrorPreset describes where a preset serves the Docker Hub images from.
+type mirrorPreset struct {
+	prefix      string // Registry and path the repositories are served below
+	mirror      string // Registry mirror passed to kaniko, if any
+	libraryOnly bool   // Only the official images are mirrored
+}
+
+var mirrorPresets = map[string]mirrorPreset{
+	MirrorPresetGCR:       {prefix: "mirror.gcr.io", mirror: "mirror.gcr.io"},
+	MirrorPresetECRPublic: {prefix: "public.ecr.aws/docker", libraryOnly: true},
+}
+
+// mirrorPreset returns the mirror preset of the build.
+func (b Build) mirrorPreset() (mirrorPreset, error) {
+	if b.MirrorPreset == MirrorPresetCustom {
+		if b.MirrorPrefix == "" {
+			return mirrorPreset{}, fmt.Errorf("mirror prefix must be specified with the %s mirror preset", MirrorPresetCustom)
+		}
+		return mirrorPreset{prefix: strings.TrimSuffix(b.MirrorPrefix, "/")}, nil
+	}
+	preset, ok := mirrorPresets[b.MirrorPreset]
+	if !ok {
+		return mirrorPreset{}, fmt.Errorf("unsupported mirror preset %q, expected %s, %s or %s", b.MirrorPreset, MirrorPresetGCR, MirrorPresetECRPublic, MirrorPresetCustom)
+	}
+	return preset, nil
+}
+
+// mirrorImage returns the image pulled through the mirror, and false when
+// the image is not on Docker Hub, not served by the mirror or excluded.
+func (b Build) mirrorImage(preset mirrorPreset, image string) (string, bool) {
+	ref, err := registry.ParseReference(image)
+	if err != nil || ref.Registry != registry.DockerHub {
+		return "", false
+	}
+	name := strings.TrimPrefix(ref.Repository, "library/")
+	if preset.libraryOnly && name == ref.Repository {
+		return "", false
+	}
+	for _, pattern := range b.MirrorExclude {
+		pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "docker.io/"), "library/")
+		if ok, _ := path.Match(pattern, name); ok {
+			return "", false
+		}
+	}
+	ref.Registry = preset.prefix
+	return ref.String(), true
+}
+
+// rewriteBaseImages rewrites the FROM instructions building on Docker Hub
+// images to pull them through the mirror. Bases given by variables are left
+// to the registry mirror of the preset.
+func (b Build) rewriteBaseImages(content []byte, preset mirrorPreset) ([]byte, []string, error) {
+	d, err := dockerfile.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse dockerfile")
+	}
+	// replacement FROM instruction by first line, and the lines it replaces
+	from := map[int]string{}
+	skip := map[int]bool{}
+	var rewritten []string
+	stages := map[string]bool{"scratch": true}
+	for _, stage := range d.Stages {
+		base := stage.Base
+		if !stages[strings.ToLower(base)] && !strings.Contains(base, "$") {
+			if image, ok := b.mirrorImage(preset, base); ok {
+				words := append([]string{"FROM"}, stage.From.Flags...)
+				words = append(words, image)
+				words = append(words, stage.From.Args[1:]...)
+				from[stage.From.StartLine] = strings.Join(words, " ")
+				for line := stage.From.StartLine + 1; line <= stage.From.EndLine; line++ {
+					skip[line] = true
+				}
+				rewritten = append(rewritten, base+" -> "+image)
+			}
+		}
+		if stage.Name != "" {
+			stages[stage.Name] = true
+		}
+	}
+
+	var out strings.Builder
+	for n, line := range strings.SplitAfter(string(content), "\n") {
+		switch {
+		case skip[n+1]:
+		case from[n+1] != "":
+			out.WriteString(from[n+1] + "\n")
+		default:
+			out.WriteString(line)
+		}
+	}
+	return []byte(out.String()), rewritten, nil
+}
+
+// stageMirrorPreset writes the Dockerfile with its Docker Hub base images
+// rewritten to the mirror of the preset to a temporary file, removed by the
+// returned cleanup.
+func (b Build) stageMirrorPreset(preset mirrorPreset) (string, func(), error) {
+	content, err := ioutil.ReadFile(b.Dockerfile)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to read dockerfile")
+	}
+	content, rewritten, err := b.rewriteBaseImages(content, preset)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, image := range rewritten {
+		fmt.Fprintf(os.Stdout, "Pulling base image through the %s mirror: %s\n", b.MirrorPreset, image)
+	}
+	parent := b.kanikoDir()
+	if _, err := os.Stat(parent); err != nil {
+		parent = ""
+	}
+	f, err := ioutil.TempFile(parent, "Dockerfile-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to create mirrored dockerfile")
+	}
+	defer f.Close()
+	if _, err := f.Write(content); err != nil {
+		os.Remove(f.Name())
+		return "", nil, errors.Wrap(err, "failed to write mirrored dockerfile")
+	}
+	return f.Name(), func() { os.Remove(f.Name()) }, nil
+}
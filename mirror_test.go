@@ -0,0 +1,83 @@
+package kaniko
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuild_rewriteBaseImages(t *testing.T) {
+	content := `ARG BASE=alpine:3.19
+FROM --platform=$BUILDPLATFORM golang:1.22 AS build
+RUN go build
+FROM bitnami/kubectl:1.29 AS kubectl
+FROM docker.io/library/postgres:16 AS db
+FROM gcr.io/distroless/static
+FROM $BASE
+FROM build
+COPY --from=kubectl /opt/bitnami/kubectl/bin/kubectl /usr/bin/
+`
+	tests := []struct {
+		preset  string
+		exclude []string
+		want    string
+	}{
+		{
+			preset:  MirrorPresetGCR,
+			exclude: []string{"postgres"},
+			want: `ARG BASE=alpine:3.19
+FROM --platform=$BUILDPLATFORM mirror.gcr.io/library/golang:1.22 AS build
+RUN go build
+FROM mirror.gcr.io/bitnami/kubectl:1.29 AS kubectl
+FROM docker.io/library/postgres:16 AS db
+FROM gcr.io/distroless/static
+FROM $BASE
+FROM build
+COPY --from=kubectl /opt/bitnami/kubectl/bin/kubectl /usr/bin/
+`,
+		},
+		{
+			preset: MirrorPresetECRPublic,
+			want: `ARG BASE=alpine:3.19
+FROM --platform=$BUILDPLATFORM public.ecr.aws/docker/library/golang:1.22 AS build
+RUN go build
+FROM bitnami/kubectl:1.29 AS kubectl
+FROM public.ecr.aws/docker/library/postgres:16 AS db
+FROM gcr.io/distroless/static
+FROM $BASE
+FROM build
+COPY --from=kubectl /opt/bitnami/kubectl/bin/kubectl /usr/bin/
+`,
+		},
+	}
+	for _, test := range tests {
+		b := Build{MirrorPreset: test.preset, MirrorExclude: test.exclude}
+		preset, err := b.mirrorPreset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := b.rewriteBaseImages([]byte(content), preset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(test.want, string(got)); diff != "" {
+			t.Errorf("%s: dockerfile mismatch (-want +got):\n%s", test.preset, diff)
+		}
+	}
+}
+
+func TestBuild_mirrorPreset(t *testing.T) {
+	b := Build{MirrorPreset: MirrorPresetCustom, MirrorPrefix: "harbor.example.com/dockerhub/"}
+	preset, err := b.mirrorPreset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image, ok := b.mirrorImage(preset, "alpine"); !ok || image != "harbor.example.com/dockerhub/library/alpine:latest" {
+		t.Errorf("unexpected mirrored image %s", image)
+	}
+	for _, invalid := range []Build{{MirrorPreset: MirrorPresetCustom}, {MirrorPreset: "quay"}} {
+		if _, err := invalid.mirrorPreset(); err == nil {
+			t.Errorf("%s: expected an error", invalid.MirrorPreset)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// mediaTypeRE matches media types, type/subtype with an optional suffix.
+var mediaTypeRE = regexp.MustCompile(`^[a-zA-Z0-9][\w.+-]*/[a-zA-Z0-9][\w.+-]*$`)
+
+// loadOCIArtifact reads the files of the OCIArtifacts setting. It runs
+// before the build, so a missing file fails the step before the image is
+// pushed.
+func (b Build) loadOCIArtifact() (*registry.Artifact, error) {
+	if len(b.OCIArtifacts) == 0 {
+		return nil, nil
+	}
+	if b.OCIArtifactRef != "" {
+		if _, err := registry.ParseReference(b.OCIArtifactRef); err != nil {
+			return nil, errors.Wrap(err, "invalid OCI artifact reference")
+		}
+	} else if b.DigestFile == "" && !b.NoPush {
+		return nil, fmt.Errorf("the OCI artifact is attached to the image by the digest in the digest file, set the digest file or the OCI artifact reference")
+	}
+	a := &registry.Artifact{ArtifactType: b.OCIArtifactType}
+	if a.ArtifactType == "" {
+		a.ArtifactType = registry.MediaTypeUnknownArtifact
+	}
+	if len(b.OCIArtifactAnnotations) > 0 {
+		annotations, err := parseKeyValues("OCI artifact annotation", b.OCIArtifactAnnotations)
+		if err != nil {
+			return nil, err
+		}
+		a.Annotations = annotations
+	}
+	// files are pulled by their title, files of the same name would
+	// overwrite each other
+	titles := map[string]string{}
+	for _, value := range b.OCIArtifacts {
+		file, mediaType := parseArtifactFile(value)
+		blob, err := registry.FileBlob(mediaType, file)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read OCI artifact file")
+		}
+		title := blob.Annotations[registry.AnnotationTitle]
+		if other, ok := titles[title]; ok {
+			return nil, fmt.Errorf("OCI artifact files %s and %s have the same name %s", other, file, title)
+		}
+		titles[title] = file
+		a.Blobs = append(a.Blobs, blob)
+	}
+	return a, nil
+}
+
+// parseArtifactFile splits a path[:media type] entry as oras push does. The
+// media type defaults to that of a tar layer.
+func parseArtifactFile(value string) (string, string) {
+	if i := strings.LastIndex(value, ":"); i > 0 && mediaTypeRE.MatchString(value[i+1:]) {
+		return value[:i], value[i+1:]
+	}
+	return value, registry.MediaTypeOCILayer
+}
+
+// pushOCIArtifact pushes the artifact with the registry credentials of the
+// build, to the OCIArtifactRef tag or else attached to the pushed image,
+// returning its reference for the artifact file.
+func (p Plugin) pushOCIArtifact(ctx context.Context, a *registry.Artifact) ([]artifact.Reference, error) {
+	if p.Build.NoPush {
+		fmt.Fprintf(os.Stdout, "Not pushing OCI artifact %s, pushing is disabled\n", a.ArtifactType)
+		return nil, nil
+	}
+	client := p.Build.registryClient()
+
+	if p.Build.OCIArtifactRef != "" {
+		ref, err := registry.ParseReference(p.Build.OCIArtifactRef)
+		if err != nil {
+			return nil, err
+		}
+		desc, err := client.PushArtifact(ctx, ref, *a)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to push OCI artifact")
+		}
+		fmt.Fprintf(os.Stdout, "Pushed OCI artifact %s@%s\n", ref, desc.Digest)
+		return []artifact.Reference{{Type: "oci-artifact", MediaType: a.ArtifactType, Image: ref.Registry + "/" + ref.Repository, Digest: desc.Digest}}, nil
+	}
+
+	image := readDigest(p.Build.DigestFile)
+	if image == "" {
+		return nil, fmt.Errorf("failed to attach OCI artifact: the image digest is unknown, set the OCI artifact reference to push it to a tag instead")
+	}
+	ref, err := registry.ParseReference(p.Build.Repo + "@" + image)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := client.Attach(ctx, ref, *a)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to attach OCI artifact")
+	}
+	fmt.Fprintf(os.Stdout, "Attached OCI artifact %s@%s to %s\n", p.Build.Repo, digest, image)
+	return []artifact.Reference{{Type: "oci-artifact", MediaType: a.ArtifactType, Image: p.Build.Repo, Digest: digest}}, nil
+}
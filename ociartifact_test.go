@@ -0,0 +1,76 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+)
+
+func TestParseArtifactFile(t *testing.T) {
+	tests := []struct {
+		value, file, mediaType string
+	}{
+		{value: "bundle.tar.gz", file: "bundle.tar.gz", mediaType: registry.MediaTypeOCILayer},
+		{value: "app.wasm:application/vnd.wasm.content.layer.v1+wasm", file: "app.wasm", mediaType: "application/vnd.wasm.content.layer.v1+wasm"},
+		{value: "c:/config.yaml", file: "c:/config.yaml", mediaType: registry.MediaTypeOCILayer},
+		{value: "times 10:30.txt", file: "times 10:30.txt", mediaType: registry.MediaTypeOCILayer},
+	}
+	for _, tt := range tests {
+		file, mediaType := parseArtifactFile(tt.value)
+		if file != tt.file || mediaType != tt.mediaType {
+			t.Errorf("parseArtifactFile(%q) = %q, %q, want %q, %q", tt.value, file, mediaType, tt.file, tt.mediaType)
+		}
+	}
+}
+
+func TestBuild_loadOCIArtifact(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.wasm")
+	if err := ioutil.WriteFile(file, []byte("\x00asm"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Build{
+		OCIArtifacts:           []string{file + ":application/vnd.wasm.content.layer.v1+wasm"},
+		OCIArtifactAnnotations: []string{"team=build"},
+		DigestFile:             filepath.Join(dir, "digest-file"),
+	}.loadOCIArtifact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ArtifactType != registry.MediaTypeUnknownArtifact || a.Annotations["team"] != "build" {
+		t.Errorf("unexpected artifact %+v", a)
+	}
+	if len(a.Blobs) != 1 || a.Blobs[0].Size != 4 || a.Blobs[0].Annotations[registry.AnnotationTitle] != "app.wasm" {
+		t.Errorf("unexpected blobs %+v", a.Blobs)
+	}
+
+	other := filepath.Join(dir, "other", "app.wasm")
+	if err := os.MkdirAll(filepath.Dir(other), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(other, []byte("\x00asm"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (Build{OCIArtifacts: []string{file}, NoPush: true}).loadOCIArtifact(); err != nil {
+		t.Errorf("expected no digest file needed without pushing, got %v", err)
+	}
+
+	for _, b := range []Build{
+		{OCIArtifacts: []string{filepath.Join(dir, "missing.wasm")}, NoPush: true},
+		{OCIArtifacts: []string{dir}, NoPush: true},
+		{OCIArtifacts: []string{file}, OCIArtifactRef: "registry.example.com/Bundle"},
+		{OCIArtifacts: []string{file}, OCIArtifactAnnotations: []string{"team"}, NoPush: true},
+		// the artifact cannot be attached without the image digest
+		{OCIArtifacts: []string{file}},
+		// both files would be pulled as app.wasm
+		{OCIArtifacts: []string{file, other}, NoPush: true},
+	} {
+		if _, err := b.loadOCIArtifact(); err == nil {
+			t.Errorf("expected error for %+v", b)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// checkOffline fails when a configured feature needs network access beyond
+// the registries in offline mode, and disables the optional outbound calls:
+// the update check and the StatsD metrics.
+func (p *Plugin) checkOffline() error {
+	if !p.Build.Offline {
+		return nil
+	}
+	var features []string
+	if isRemoteContext(p.Build.Context) && !strings.HasPrefix(p.Build.Context, "dir://") && !strings.HasPrefix(p.Build.Context, "tar://") {
+		features = append(features, "remote build context "+p.Build.Context)
+	}
+	if p.Output.Bucket != "" {
+		features = append(features, "output bucket")
+	}
+	if p.Backend.ContextBucket != "" {
+		features = append(features, "context bucket")
+	}
+	if strings.HasPrefix(p.Build.StateStore, "s3://") || strings.HasPrefix(p.Build.StateStore, "gs://") {
+		features = append(features, "state store bucket")
+	}
+	if p.GitOps.Repo != "" {
+		features = append(features, "gitops repository")
+	}
+	if p.Status.Token != "" {
+		features = append(features, "commit status")
+	}
+	if len(features) > 0 {
+		return fmt.Errorf("offline mode: %s require network access beyond the registries", strings.Join(features, ", "))
+	}
+
+	var disabled []string
+	if p.Build.CheckUpdates {
+		p.Build.CheckUpdates = false
+		disabled = append(disabled, "update check")
+	}
+	if p.Build.StatsdAddress != "" {
+		p.Build.StatsdAddress = ""
+		disabled = append(disabled, "statsd metrics")
+	}
+	if len(disabled) > 0 {
+		fmt.Fprintf(os.Stdout, "Offline mode: disabled %s\n", strings.Join(disabled, ", "))
+	}
+	return nil
+}
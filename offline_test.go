@@ -0,0 +1,62 @@
+package kaniko
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/gitops"
+)
+
+func TestPlugin_checkOffline(t *testing.T) {
+	p := Plugin{Build: Build{
+		Offline:       true,
+		Context:       "dir:///workspace",
+		CheckUpdates:  true,
+		StatsdAddress: "statsd.example.com:8125",
+		StateStore:    "/cache/state",
+	}}
+	if err := p.checkOffline(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Build.CheckUpdates || p.Build.StatsdAddress != "" {
+		t.Error("expected the update check and metrics disabled")
+	}
+
+	p = Plugin{
+		Build:  Build{Offline: true, Context: "git://github.com/octocat/app.git", StateStore: "s3://bucket/state"},
+		Output: Output{Bucket: "gs://bucket"},
+		GitOps: gitops.Config{Repo: "https://github.com/octocat/deploy.git"},
+	}
+	err := p.checkOffline()
+	if err == nil {
+		t.Fatal("expected an error for features needing network access")
+	}
+	for _, feature := range []string{"remote build context", "output bucket", "state store bucket", "gitops repository"} {
+		if !strings.Contains(err.Error(), feature) {
+			t.Errorf("expected %s in error %q", feature, err)
+		}
+	}
+}
+
+func TestPlugin_ExecOffline(t *testing.T) {
+	b := testBuild(t)
+	b.Offline = true
+	b.CheckUpdates = true
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+	defer func(url string) { latestReleaseURL = url }(latestReleaseURL)
+	latestReleaseURL = server.URL
+
+	if err := New(b, WithRunner(&fakeRunner{})).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Errorf("expected no update check in offline mode, got %d requests", requests)
+	}
+}
@@ -0,0 +1,55 @@
+package kaniko
+
+import (
+	"github.com/drone/drone-kaniko/pkg/gitops"
+	"github.com/drone/drone-kaniko/pkg/status"
+)
+
+// Option configures a Plugin created with New.
+type Option func(*Plugin)
+
+// New returns a plugin running the build, for programs embedding the plugin
+// rather than configuring it with command line flags.
+func New(build Build, opts ...Option) Plugin {
+	p := Plugin{Build: build}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
+
+// WithArtifact writes the artifact file after the build.
+func WithArtifact(artifact Artifact) Option {
+	return func(p *Plugin) { p.Artifact = artifact }
+}
+
+// WithOutput writes the output file after the build.
+func WithOutput(output Output) Option {
+	return func(p *Plugin) { p.Output = output }
+}
+
+// WithGitOps updates a GitOps repository after the image is pushed.
+func WithGitOps(config gitops.Config) Option {
+	return func(p *Plugin) { p.GitOps = config }
+}
+
+// WithStatus publishes the result of the build as the status of the commit.
+func WithStatus(config status.Config) Option {
+	return func(p *Plugin) { p.Status = config }
+}
+
+// WithRunner runs the kaniko executor with runner instead of a local process.
+func WithRunner(runner Runner) Option {
+	return func(p *Plugin) { p.Runner = runner }
+}
+
+// WithExecutor sets the path of the kaniko executor.
+func WithExecutor(path string) Option {
+	return func(p *Plugin) { p.Executor = path }
+}
+
+// WithCredentials authenticates against registries with the credentials of
+// provider instead of the docker config file written by the plugin binaries.
+func WithCredentials(provider CredentialProvider) Option {
+	return func(p *Plugin) { p.Credentials = provider }
+}
@@ -0,0 +1,61 @@
+package kaniko
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(dockerfile, []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var config string
+	runner := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		for _, env := range cmd.Env {
+			if strings.HasPrefix(env, "DOCKER_CONFIG=") {
+				data, err := ioutil.ReadFile(filepath.Join(strings.TrimPrefix(env, "DOCKER_CONFIG="), "config.json"))
+				if err != nil {
+					return err
+				}
+				config = string(data)
+			}
+		}
+		return nil
+	}}
+	p := New(
+		Build{Dockerfile: dockerfile, Context: dir, NoPush: true, KanikoDir: dir},
+		WithRunner(runner),
+		WithExecutor("/usr/local/bin/executor"),
+		WithCredentials(StaticCredentials{Registry: "registry.example.com", Username: "user", Password: "pass"}),
+	)
+	if err := p.Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runner.cmds) != 1 {
+		t.Fatalf("expected the executor to run once, ran %d commands", len(runner.cmds))
+	}
+	cmd := runner.cmds[0]
+	if cmd.Path != "/usr/local/bin/executor" {
+		t.Errorf("expected the custom executor, got %s", cmd.Path)
+	}
+	if !strings.Contains(strings.Join(cmd.Args, " "), "--dockerfile="+dockerfile) {
+		t.Errorf("unexpected args %v", cmd.Args)
+	}
+	if !strings.Contains(config, `"registry.example.com":{"auth":"dXNlcjpwYXNz"}`) {
+		t.Errorf("expected the credentials in the docker config, got %s", config)
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "docker-") {
+			t.Errorf("expected the docker config directory to be removed")
+		}
+	}
+}
@@ -32,6 +32,7 @@ type (
 		RegistryType RegistryTypeEnum `json:"registryType"`
 		RegistryUrl  string           `json:"registryUrl"`
 		Images       []Image          `json:"images"`
+		Platform     string           `json:"platform,omitempty"`
 	}
 	DockerArtifact struct {
 		Kind string `json:"kind"`
@@ -40,17 +41,29 @@ type (
 )
 
 func WritePluginArtifactFile(registryType RegistryTypeEnum, artifactFilePath, registryUrl, imageName, digest string, tags []string) error {
+	digests := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		digests[tag] = digest
+	}
+	return WritePluginArtifactFileDigests(registryType, artifactFilePath, registryUrl, imageName, "", tags, digests)
+}
+
+// WritePluginArtifactFileDigests writes the artifact file with the digest
+// of each tag, for tags pointing to different images, and the platform the
+// images were built for when known.
+func WritePluginArtifactFileDigests(registryType RegistryTypeEnum, artifactFilePath, registryUrl, imageName, platform string, tags []string, digests map[string]string) error {
 	var images []Image
 	for _, tag := range tags {
 		images = append(images, Image{
 			Image:  fmt.Sprintf("%s:%s", imageName, tag),
-			Digest: digest,
+			Digest: digests[tag],
 		})
 	}
 	data := Data{
 		RegistryType: registryType,
 		RegistryUrl:  registryUrl,
 		Images:       images,
+		Platform:     platform,
 	}
 
 	dockerArtifact := DockerArtifact{
@@ -1,7 +1,10 @@
 package artifact
 
 import (
+	"encoding/json"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -36,3 +39,65 @@ func TestWritePluginArtifactFile(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestWritePluginArtifactFileDigests(t *testing.T) {
+	testFile := t.TempDir() + "got.json"
+
+	digests := map[string]string{"a1": "sha256:11", "latest": "sha256:22"}
+	err := WritePluginArtifactFileDigests(Docker, testFile, "https://index.docker.io/", "image", "linux/arm64", []string{"a1", "latest"}, digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotBytes, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"image": "image:a1",` + "\n\t\t\t\t" + `"digest": "sha256:11"`, `"image": "image:latest",` + "\n\t\t\t\t" + `"digest": "sha256:22"`, `"platform": "linux/arm64"`} {
+		if !strings.Contains(string(gotBytes), want) {
+			t.Errorf("expected artifact file to contain %q, got %s", want, gotBytes)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	a := Artifact{
+		RegistryType: ECR,
+		RegistryUrl:  "123456789012.dkr.ecr.us-east-1.amazonaws.com",
+		Repo:         "123456789012.dkr.ecr.us-east-1.amazonaws.com/app",
+		Tags:         []string{"1.0"},
+		Digests:      map[string]string{"1.0": "sha256:11"},
+		Platforms:    []string{"linux/amd64"},
+		References:   []Reference{{Type: "attestation", Image: "123456789012.dkr.ecr.us-east-1.amazonaws.com/app", Digest: "sha256:22"}},
+		Build:        BuildMetadata{Builder: "kaniko", CommitSha: "abc"},
+	}
+
+	testFile := filepath.Join(t.TempDir(), "v2.json")
+	if err := Write(SchemaV2, testFile, a); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(testFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got DockerArtifactV2
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Kind != "docker/v2" || got.Data.Repo != a.Repo || got.Data.Images[0].Digest != "sha256:11" ||
+		got.Data.Images[0].Tag != "1.0" || got.Data.References[0].Digest != "sha256:22" || got.Data.Build.Builder != "kaniko" {
+		t.Errorf("unexpected v2 artifact %s", content)
+	}
+
+	testFile = filepath.Join(t.TempDir(), "v1.json")
+	if err := Write(SchemaV1, testFile, a); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile(testFile); !strings.Contains(string(content), `"kind": "docker/v1"`) || strings.Contains(string(content), "references") {
+		t.Errorf("unexpected v1 artifact %s", content)
+	}
+
+	if err := Write("v3", testFile, a); err == nil {
+		t.Errorf("expected an error for an unknown schema")
+	}
+}
@@ -0,0 +1,139 @@
+package artifact
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dockerArtifactV2 string = "docker/v2"
+)
+
+// Schema versions of the artifact file.
+const (
+	SchemaV1 = "v1" // docker/v1, the default
+	SchemaV2 = "v2" // docker/v2
+)
+
+type (
+	// Reference is an artifact attached to the image, such as an SBOM, a
+	// signature or an attestation.
+	Reference struct {
+		Type      string `json:"type"`
+		MediaType string `json:"mediaType,omitempty"`
+		Image     string `json:"image"`
+		Digest    string `json:"digest"`
+	}
+
+	// BuildMetadata describes the build the image was published by.
+	BuildMetadata struct {
+		Builder     string `json:"builder,omitempty"`
+		Target      string `json:"target,omitempty"`
+		CommitSha   string `json:"commitSha,omitempty"`
+		CommitRef   string `json:"commitRef,omitempty"`
+		BuildNumber string `json:"buildNumber,omitempty"`
+		BuildLink   string `json:"buildLink,omitempty"`
+
+		PluginVersion   string `json:"pluginVersion,omitempty"`
+		PluginCommit    string `json:"pluginCommit,omitempty"`
+		ExecutorVersion string `json:"executorVersion,omitempty"`
+	}
+
+	// ImageV2 is an image of the docker/v2 schema.
+	ImageV2 struct {
+		Image  string `json:"image"`
+		Tag    string `json:"tag"`
+		Digest string `json:"digest"`
+	}
+
+	// DataV2 is the data of the docker/v2 schema.
+	DataV2 struct {
+		RegistryType RegistryTypeEnum `json:"registryType"`
+		RegistryUrl  string           `json:"registryUrl"`
+		Repo         string           `json:"repo"`
+		Tags         []string         `json:"tags"`
+		Images       []ImageV2        `json:"images"`
+		Platforms    []string         `json:"platforms,omitempty"`
+		References   []Reference      `json:"references,omitempty"`
+		Build        BuildMetadata    `json:"build"`
+	}
+
+	// DockerArtifactV2 is the docker/v2 artifact file.
+	DockerArtifactV2 struct {
+		Kind string `json:"kind"`
+		Data DataV2 `json:"data"`
+	}
+
+	// Artifact describes the published image independently of the schema.
+	Artifact struct {
+		RegistryType RegistryTypeEnum
+		RegistryUrl  string
+		Repo         string
+		Tags         []string
+		Digests      map[string]string // Digest of each tag
+		Platforms    []string
+		References   []Reference
+		Build        BuildMetadata
+	}
+)
+
+// Write writes the artifact file in the schema, v1 when empty. Fields not
+// supported by the schema are left out.
+func Write(schema, artifactFilePath string, a Artifact) error {
+	switch schema {
+	case "", SchemaV1:
+		platform := strings.Join(a.Platforms, ",")
+		return WritePluginArtifactFileDigests(a.RegistryType, artifactFilePath, a.RegistryUrl, a.Repo, platform, a.Tags, a.Digests)
+	case SchemaV2:
+		return writeV2(artifactFilePath, a)
+	default:
+		return fmt.Errorf("unsupported artifact schema %q, expected %s or %s", schema, SchemaV1, SchemaV2)
+	}
+}
+
+func writeV2(artifactFilePath string, a Artifact) error {
+	images := []ImageV2{}
+	for _, tag := range a.Tags {
+		images = append(images, ImageV2{
+			Image:  fmt.Sprintf("%s:%s", a.Repo, tag),
+			Tag:    tag,
+			Digest: a.Digests[tag],
+		})
+	}
+	tags := a.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	dockerArtifact := DockerArtifactV2{
+		Kind: dockerArtifactV2,
+		Data: DataV2{
+			RegistryType: a.RegistryType,
+			RegistryUrl:  a.RegistryUrl,
+			Repo:         a.Repo,
+			Tags:         tags,
+			Images:       images,
+			Platforms:    a.Platforms,
+			References:   a.References,
+			Build:        a.Build,
+		},
+	}
+
+	b, err := json.MarshalIndent(dockerArtifact, "", "\t")
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to marshal output %+v", dockerArtifact))
+	}
+	dir := filepath.Dir(artifactFilePath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to create %s directory for artifact file", dir))
+	}
+	if err := ioutil.WriteFile(artifactFilePath, b, 0644); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to write artifact to artifact file %s", artifactFilePath))
+	}
+	return nil
+}
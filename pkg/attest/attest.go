@@ -0,0 +1,110 @@
+// Package attest records the inputs of a build as in-toto link metadata.
+package attest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/pkg/errors"
+)
+
+// Types of the in-toto statement.
+const (
+	StatementType = "https://in-toto.io/Statement/v0.1"
+	PredicateLink = "https://in-toto.io/attestation/link/v0.3"
+	MediaType     = "application/vnd.in-toto+json"
+)
+
+type (
+	// Digest maps a hash algorithm to the hex encoded digest.
+	Digest map[string]string
+
+	// Subject is the artifact the statement is about.
+	Subject struct {
+		Name   string `json:"name"`
+		Digest Digest `json:"digest"`
+	}
+
+	// Material is an input of the build.
+	Material struct {
+		Name   string `json:"name"`
+		URI    string `json:"uri,omitempty"`
+		Digest Digest `json:"digest,omitempty"`
+	}
+
+	// Link describes a step of the supply chain and the materials it used.
+	Link struct {
+		Name        string                 `json:"name"`
+		Materials   []Material             `json:"materials"`
+		Environment map[string]interface{} `json:"environment,omitempty"`
+	}
+
+	// Statement binds the link to the subjects it produced.
+	Statement struct {
+		Type          string    `json:"_type"`
+		Subject       []Subject `json:"subject"`
+		PredicateType string    `json:"predicateType"`
+		Predicate     Link      `json:"predicate"`
+	}
+)
+
+// NewStatement returns a link statement about the subjects.
+func NewStatement(subjects []Subject, link Link) Statement {
+	return Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: PredicateLink,
+		Predicate:     link,
+	}
+}
+
+// ParseDigest converts a digest in the form algorithm:hex.
+func ParseDigest(digest string) Digest {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	return Digest{parts[0]: parts[1]}
+}
+
+// SHA256 returns the sha256 digest of content.
+func SHA256(content []byte) Digest {
+	sum := sha256.Sum256(content)
+	return Digest{"sha256": hex.EncodeToString(sum[:])}
+}
+
+// HashSecret returns the value replaced by its sha256 digest, so a secret
+// can be compared without being disclosed.
+func HashSecret(value string) string {
+	return "sha256:" + SHA256([]byte(value))["sha256"]
+}
+
+// WriteFile writes the statement as indented JSON.
+func WriteFile(path string, s Statement) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "failed to create attestation directory")
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+// BaseImages returns the images the Dockerfile builds on, with variables
+// substituted from the build args and the ARG defaults declared before the
+// first stage. Stages built on earlier stages and scratch are skipped.
+func BaseImages(content []byte, buildArgs []string) []string {
+	d, err := dockerfile.Parse(bytes.NewReader(content))
+	if err != nil {
+		return nil
+	}
+	return d.BaseImages(buildArgs)
+}
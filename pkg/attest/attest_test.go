@@ -0,0 +1,71 @@
+package attest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBaseImages(t *testing.T) {
+	dockerfile := []byte(`ARG GO_VERSION=1.21
+ARG BASE="alpine:3.18"
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION} AS build
+ARG IGNORED=stage
+RUN go build ./...
+
+FROM build as test
+RUN go test ./...
+
+FROM scratch AS empty
+
+FROM $BASE
+COPY --from=build /app /app
+FROM golang:1.22
+`)
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{want: []string{"golang:1.21", "alpine:3.18", "golang:1.22"}},
+		{args: []string{"GO_VERSION=1.22"}, want: []string{"golang:1.22", "alpine:3.18"}},
+	}
+	for _, tc := range tests {
+		if got := BaseImages(dockerfile, tc.args); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("BaseImages(%v) = %v, want %v", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "attestation.json")
+	s := NewStatement(
+		[]Subject{{Name: "registry.example.com/app", Digest: ParseDigest("sha256:abc")}},
+		Link{Name: "build", Materials: []Material{{Name: "Dockerfile", Digest: SHA256([]byte("FROM scratch\n"))}}},
+	)
+	if err := WriteFile(path, s); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["_type"] != StatementType || got["predicateType"] != PredicateLink {
+		t.Errorf("unexpected statement types %v", got)
+	}
+	subject := got["subject"].([]interface{})[0].(map[string]interface{})
+	if subject["digest"].(map[string]interface{})["sha256"] != "abc" {
+		t.Errorf("unexpected subject %v", subject)
+	}
+}
+
+func TestHashSecret(t *testing.T) {
+	if got := HashSecret("secret"); got != "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b" {
+		t.Errorf("HashSecret() = %s", got)
+	}
+}
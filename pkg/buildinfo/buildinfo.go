@@ -0,0 +1,103 @@
+// Package buildinfo reports the versions of the plugin and of the kaniko
+// executor, and checks for newer plugin releases.
+package buildinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// LatestReleaseURL is the GitHub API endpoint of the latest plugin release.
+const LatestReleaseURL = "https://api.github.com/repos/drone/drone-kaniko/releases/latest"
+
+var (
+	// Version is the plugin version, set at build time with
+	// -ldflags "-X github.com/drone/drone-kaniko/pkg/buildinfo.Version=v1.2.3".
+	Version = ""
+	// Commit is the git SHA the plugin was built from, read from the Go build
+	// info unless set at build time.
+	Commit = ""
+)
+
+// Plugin returns the version and git SHA of the plugin, with the version
+// unknown when not set at build time.
+func Plugin() (string, string) {
+	v, commit := Version, Commit
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && commit == "" {
+				commit = setting.Value
+			}
+		}
+	}
+	if v == "" {
+		v = "unknown"
+	}
+	return v, commit
+}
+
+// Executor returns the version of the kaniko executor at path, read from
+// its version command, e.g. "Kaniko version :  v1.23.2".
+func Executor(ctx context.Context, path string) (string, error) {
+	out, err := exec.CommandContext(ctx, path, "version").Output()
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(out))
+	if i := strings.LastIndex(line, ":"); i >= 0 {
+		line = strings.TrimSpace(line[i+1:])
+	}
+	if line == "" {
+		return "", fmt.Errorf("no version printed by %s", path)
+	}
+	return line, nil
+}
+
+// Latest returns the tag of the latest release published at the GitHub
+// releases endpoint.
+func Latest(ctx context.Context, client *http.Client, endpoint string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s from %s", res.Status, endpoint)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return "", err
+	}
+	return release.TagName, nil
+}
+
+// Newer returns true if latest is a newer version than current. Versions
+// that are not semantic versions, such as unknown, are never outdated.
+func Newer(current, latest string) bool {
+	c, err := version.NewVersion(current)
+	if err != nil {
+		return false
+	}
+	l, err := version.NewVersion(latest)
+	if err != nil {
+		return false
+	}
+	return l.GreaterThan(c)
+}
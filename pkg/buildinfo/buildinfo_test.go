@@ -0,0 +1,47 @@
+package buildinfo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLatest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v1.10.0", "name": "v1.10.0"}`))
+	}))
+	defer server.Close()
+
+	latest, err := Latest(context.Background(), server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != "v1.10.0" {
+		t.Errorf("want latest v1.10.0, got %s", latest)
+	}
+}
+
+func TestNewer(t *testing.T) {
+	for _, test := range []struct {
+		current, latest string
+		want            bool
+	}{
+		{"v1.9.0", "v1.10.0", true},
+		{"1.10.0", "v1.10.0", false},
+		{"v1.11.0-rc1", "v1.10.0", false},
+		{"unknown", "v1.10.0", false},
+	} {
+		if got := Newer(test.current, test.latest); got != test.want {
+			t.Errorf("%s < %s: want %t, got %t", test.current, test.latest, test.want, got)
+		}
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	defer func(v, c string) { Version, Commit = v, c }(Version, Commit)
+	Version, Commit = "v1.2.3", "abc123"
+	if v, commit := Plugin(); v != "v1.2.3" || commit != "abc123" {
+		t.Errorf("unexpected plugin version %s, commit %s", v, commit)
+	}
+}
@@ -0,0 +1,305 @@
+// Package buildlog parses the kaniko log into a build summary with the
+// time spent and the cache effectiveness of each stage.
+package buildlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	// kaniko prefixes messages with the level and the seconds since start,
+	// e.g. INFO[0012] Pushing image to repo:tag
+	lineRE  = regexp.MustCompile(`^(?:\x1b\[[0-9;]*m)?[A-Z]+(?:\x1b\[[0-9;]*m)?\[(\d+)\]\s*(.*)$`)
+	stageRE = regexp.MustCompile(`^Building stage '([^']*)' \[idx: '(\d+)'`)
+	pushRE  = regexp.MustCompile(`^Pushed (\S+)`)
+	keyRE   = regexp.MustCompile(`^Checking for cached layer (\S+?)\.*$`)
+	// kaniko logs each instruction as written when it executes it
+	instructionRE = regexp.MustCompile(`^(?i:ADD|ARG|CMD|COPY|ENTRYPOINT|ENV|EXPOSE|HEALTHCHECK|LABEL|ONBUILD|RUN|SHELL|STOPSIGNAL|USER|VOLUME|WORKDIR)\s`)
+)
+
+const (
+	cacheHit  = "Using caching version of cmd:"
+	cacheMiss = "No cached layer found for cmd"
+	pushing   = "Pushing image to"
+)
+
+type (
+	// CacheKey is a cache lookup of a command.
+	CacheKey struct {
+		Key     string `json:"key"`
+		Command string `json:"command"`
+		Hit     bool   `json:"hit"`
+	}
+
+	// Instruction is the time spent on a Dockerfile instruction.
+	Instruction struct {
+		Command string  `json:"command"`
+		Seconds float64 `json:"seconds"`
+	}
+
+	// Stage summarises a build stage.
+	Stage struct {
+		Index        int           `json:"index"`
+		Base         string        `json:"base"`
+		Seconds      float64       `json:"seconds"`
+		CacheHits    int           `json:"cache_hits"`
+		CacheMisses  int           `json:"cache_misses"`
+		CacheKeys    []CacheKey    `json:"cache_keys,omitempty"`
+		Instructions []Instruction `json:"instructions,omitempty"`
+	}
+
+	// Summary summarises a build.
+	Summary struct {
+		Seconds     float64  `json:"seconds"`
+		Stages      []Stage  `json:"stages"`
+		CacheHits   int      `json:"cache_hits"`
+		CacheMisses int      `json:"cache_misses"`
+		Pushed      []string `json:"pushed,omitempty"`
+		ImageSize   int64    `json:"image_size,omitempty"` // Compressed size, 0 when unknown
+	}
+)
+
+// CacheRatio returns the share of cache lookups that hit, or -1 when the
+// cache was not used.
+func (s Summary) CacheRatio() float64 {
+	if s.CacheHits+s.CacheMisses == 0 {
+		return -1
+	}
+	return float64(s.CacheHits) / float64(s.CacheHits+s.CacheMisses)
+}
+
+// Parser is a writer parsing the kaniko log as it is written.
+type Parser struct {
+	mu      sync.Mutex
+	partial []byte
+	stages  []Stage
+	starts  []int
+	last    int
+	pushed  []string
+	key     string // cache key of the pending lookup
+	push    int    // time the push started, 0 when not started
+	// start time of the instructions of each stage
+	instructionStarts map[int][]int
+}
+
+// Write parses the complete lines in p, buffering a trailing partial line.
+func (p *Parser) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		p.parseLine(string(bytes.TrimRight(p.partial[:i], "\r")))
+		p.partial = p.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+func (p *Parser) parseLine(line string) {
+	match := lineRE.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	elapsed, _ := strconv.Atoi(match[1])
+	if elapsed > p.last {
+		p.last = elapsed
+	}
+	msg := match[2]
+
+	if m := stageRE.FindStringSubmatch(msg); m != nil {
+		index, _ := strconv.Atoi(m[2])
+		p.stages = append(p.stages, Stage{Index: index, Base: m[1]})
+		p.starts = append(p.starts, elapsed)
+		return
+	}
+	if strings.HasPrefix(msg, pushing) {
+		if p.push == 0 {
+			p.push = elapsed
+		}
+		return
+	}
+	if instructionRE.MatchString(msg) {
+		p.addInstruction(msg, elapsed)
+		return
+	}
+	if m := pushRE.FindStringSubmatch(msg); m != nil {
+		p.pushed = append(p.pushed, m[1])
+		return
+	}
+
+	if m := keyRE.FindStringSubmatch(msg); m != nil {
+		// the cache image reference ends with the key
+		p.key = m[1][strings.LastIndex(m[1], ":")+1:]
+		return
+	}
+
+	hit := strings.HasPrefix(msg, cacheHit)
+	miss := strings.HasPrefix(msg, cacheMiss)
+	if !hit && !miss {
+		return
+	}
+	stage := p.currentStage()
+	if hit {
+		stage.CacheHits++
+	} else {
+		stage.CacheMisses++
+	}
+	if p.key != "" {
+		command := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(msg, cacheHit), cacheMiss))
+		stage.CacheKeys = append(stage.CacheKeys, CacheKey{Key: p.key, Command: command, Hit: hit})
+		p.key = ""
+	}
+}
+
+// currentStage returns the stage being built. Lines before the first stage
+// line belong to the only stage.
+func (p *Parser) currentStage() *Stage {
+	if len(p.stages) == 0 {
+		p.stages = append(p.stages, Stage{})
+		p.starts = append(p.starts, 0)
+	}
+	return &p.stages[len(p.stages)-1]
+}
+
+func (p *Parser) addInstruction(command string, elapsed int) {
+	stage := p.currentStage()
+	stage.Instructions = append(stage.Instructions, Instruction{Command: command})
+	if p.instructionStarts == nil {
+		p.instructionStarts = map[int][]int{}
+	}
+	i := len(p.stages) - 1
+	p.instructionStarts[i] = append(p.instructionStarts[i], elapsed)
+}
+
+// Summary returns the summary of the log parsed so far. A stage lasts until
+// the next stage starts, the last stage until the last log line.
+func (p *Parser) Summary() Summary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := Summary{
+		Seconds: float64(p.last),
+		Pushed:  append([]string(nil), p.pushed...),
+	}
+	for i, stage := range p.stages {
+		end := p.last
+		if i+1 < len(p.starts) {
+			end = p.starts[i+1]
+		}
+		stage.Seconds = float64(end - p.starts[i])
+		// an instruction lasts until the next one starts, the last one
+		// until the stage ends or the push starts
+		if p.push > 0 && p.push < end {
+			end = p.push
+		}
+		starts := p.instructionStarts[i]
+		stage.Instructions = append([]Instruction(nil), stage.Instructions...)
+		for j := range stage.Instructions {
+			next := end
+			if j+1 < len(starts) {
+				next = starts[j+1]
+			}
+			stage.Instructions[j].Seconds = float64(next - starts[j])
+		}
+		s.CacheHits += stage.CacheHits
+		s.CacheMisses += stage.CacheMisses
+		s.Stages = append(s.Stages, stage)
+	}
+	return s
+}
+
+// Print writes a human readable summary to w.
+func Print(w io.Writer, s Summary, formatSize func(int64) string) {
+	fmt.Fprintf(w, "Build summary: %s total\n", time.Duration(s.Seconds*float64(time.Second)))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tBASE\tTIME\tCACHE HITS\tCACHE MISSES")
+	for _, stage := range s.Stages {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\n", stage.Index, stage.Base, time.Duration(stage.Seconds*float64(time.Second)), stage.CacheHits, stage.CacheMisses)
+	}
+	tw.Flush()
+	if ratio := s.CacheRatio(); ratio >= 0 {
+		fmt.Fprintf(w, "Cache: %d hits, %d misses (%.0f%%)\n", s.CacheHits, s.CacheMisses, ratio*100)
+	}
+	if s.ImageSize > 0 {
+		fmt.Fprintf(w, "Image size: %s\n", formatSize(s.ImageSize))
+	}
+	for _, pushed := range s.Pushed {
+		fmt.Fprintf(w, "Pushed: %s\n", pushed)
+	}
+}
+
+// PrintCacheKeys writes the cache key of each command looked up in the
+// cache to w, by stage, to explain cache misses.
+func PrintCacheKeys(w io.Writer, s Summary) {
+	fmt.Fprintln(w, "Cache keys:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tKEY\tCACHE\tCOMMAND")
+	for _, stage := range s.Stages {
+		for _, key := range stage.CacheKeys {
+			result := "miss"
+			if key.Hit {
+				result = "hit"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", stage.Index, key.Key, result, key.Command)
+		}
+	}
+	tw.Flush()
+}
+
+// WriteFile writes the summary as JSON to path.
+func WriteFile(path string, s Summary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Timings is the time spent on each stage and instruction of a build.
+type Timings struct {
+	Seconds float64       `json:"seconds"`
+	Stages  []StageTiming `json:"stages"`
+}
+
+// StageTiming is the time spent on a stage and its instructions.
+type StageTiming struct {
+	Index        int           `json:"index"`
+	Base         string        `json:"base"`
+	Seconds      float64       `json:"seconds"`
+	Instructions []Instruction `json:"instructions"`
+}
+
+// Timings returns the timings of the summary.
+func (s Summary) Timings() Timings {
+	t := Timings{Seconds: s.Seconds, Stages: []StageTiming{}}
+	for _, stage := range s.Stages {
+		instructions := stage.Instructions
+		if instructions == nil {
+			instructions = []Instruction{}
+		}
+		t.Stages = append(t.Stages, StageTiming{Index: stage.Index, Base: stage.Base, Seconds: stage.Seconds, Instructions: instructions})
+	}
+	return t
+}
+
+// WriteTimings writes the timings of the summary as JSON to path.
+func WriteTimings(path string, s Summary) error {
+	data, err := json.MarshalIndent(s.Timings(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,127 @@
+package buildlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const kanikoLog = `INFO[0000] Retrieving image manifest golang:1.20
+INFO[0001] Building stage 'golang:1.20' [idx: '0', base-idx: '-1']
+INFO[0002] Checking for cached layer registry/cache:1111...
+INFO[0002] Using caching version of cmd: RUN go mod download
+INFO[0003] Checking for cached layer registry/cache:2222...
+INFO[0003] No cached layer found for cmd RUN go build
+INFO[0030] Building stage 'alpine' [idx: '1', base-idx: '-1']
+INFO[0031] No cached layer found for cmd COPY --from=0 /app /app
+INFO[0040] Pushing image to registry/app:latest
+INFO[0045] Pushed registry/app@sha256:abcd
+`
+
+func TestParser(t *testing.T) {
+	p := &Parser{}
+	// write in uneven chunks to exercise the line buffering
+	for _, chunk := range []string{kanikoLog[:50], kanikoLog[50:333], kanikoLog[333:]} {
+		p.Write([]byte(chunk))
+	}
+
+	want := Summary{
+		Seconds: 45,
+		Stages: []Stage{
+			{Index: 0, Base: "golang:1.20", Seconds: 29, CacheHits: 1, CacheMisses: 1, CacheKeys: []CacheKey{
+				{Key: "1111", Command: "RUN go mod download", Hit: true},
+				{Key: "2222", Command: "RUN go build"},
+			}},
+			{Index: 1, Base: "alpine", Seconds: 15, CacheMisses: 1},
+		},
+		CacheHits:   1,
+		CacheMisses: 2,
+		Pushed:      []string{"registry/app@sha256:abcd"},
+	}
+	got := p.Summary()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected summary (-want +got):\n%s", diff)
+	}
+	if ratio := got.CacheRatio(); ratio < 0.33 || ratio > 0.34 {
+		t.Errorf("unexpected cache ratio %f", ratio)
+	}
+}
+
+func TestParser_NoStages(t *testing.T) {
+	p := &Parser{}
+	p.Write([]byte("INFO[0004] Using caching version of cmd: RUN make\nnot a kaniko line\n"))
+	want := Summary{Seconds: 4, Stages: []Stage{{Seconds: 4, CacheHits: 1}}, CacheHits: 1}
+	if diff := cmp.Diff(want, p.Summary()); diff != "" {
+		t.Errorf("unexpected summary (-want +got):\n%s", diff)
+	}
+	if ratio := (Summary{}).CacheRatio(); ratio != -1 {
+		t.Errorf("expected -1 without cache lookups, got %f", ratio)
+	}
+}
+
+func TestPrintAndWriteFile(t *testing.T) {
+	p := &Parser{}
+	p.Write([]byte(kanikoLog))
+	s := p.Summary()
+	s.ImageSize = 1024
+
+	var buf bytes.Buffer
+	Print(&buf, s, func(n int64) string { return "1KB" })
+	for _, want := range []string{"45s total", "golang:1.20", "1 hits, 2 misses", "Image size: 1KB", "Pushed: registry/app@sha256:abcd"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected summary to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	PrintCacheKeys(&buf, s)
+	for _, want := range []string{"1111  hit    RUN go mod download", "2222  miss   RUN go build"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected cache keys to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	if err := WriteFile(path, s); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(data), `"cache_misses": 2`) {
+		t.Errorf("unexpected summary file %s", data)
+	}
+}
+
+func TestParser_Instructions(t *testing.T) {
+	p := &Parser{}
+	p.Write([]byte(`INFO[0001] Building stage 'golang:1.20' [idx: '0', base-idx: '-1']
+INFO[0002] WORKDIR /src
+INFO[0002] COPY . .
+INFO[0004] RUN go build -o /app
+INFO[0004] Cmd: /bin/sh
+INFO[0020] Building stage 'alpine' [idx: '1', base-idx: '-1']
+INFO[0021] COPY --from=0 /app /app
+INFO[0023] Pushing image to registry/app:latest
+INFO[0030] Pushed registry/app@sha256:abcd
+`))
+
+	want := Timings{
+		Seconds: 30,
+		Stages: []StageTiming{
+			{Index: 0, Base: "golang:1.20", Seconds: 19, Instructions: []Instruction{
+				{Command: "WORKDIR /src", Seconds: 0},
+				{Command: "COPY . .", Seconds: 2},
+				{Command: "RUN go build -o /app", Seconds: 16},
+			}},
+			{Index: 1, Base: "alpine", Seconds: 10, Instructions: []Instruction{
+				{Command: "COPY --from=0 /app /app", Seconds: 2},
+			}},
+		},
+	}
+	if diff := cmp.Diff(want, p.Summary().Timings()); diff != "" {
+		t.Errorf("unexpected timings (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,42 @@
+// Package card writes Drone cards, the structured step results the Drone UI
+// renders with an adaptive card template.
+package card
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// card is the document read by the Drone runner.
+type card struct {
+	Schema string      `json:"schema"`
+	Data   interface{} `json:"data"`
+}
+
+// Write writes the card data, rendered with the template at the schema URL,
+// to path. The Drone runner reads cards written to /dev/stdout or
+// /dev/stderr from the step output, encoded in an escape sequence.
+func Write(path, schema string, data interface{}) error {
+	content, err := json.Marshal(card{Schema: schema, Data: data})
+	if err != nil {
+		return err
+	}
+	switch path {
+	case "/dev/stdout":
+		return encode(os.Stdout, content)
+	case "/dev/stderr":
+		return encode(os.Stderr, content)
+	default:
+		return ioutil.WriteFile(path, content, 0644)
+	}
+}
+
+// encode writes the card in the escape sequence the runner extracts from
+// the step output.
+func encode(w io.Writer, content []byte) error {
+	_, err := io.WriteString(w, "\u001B]1338;"+base64.StdEncoding.EncodeToString(content)+"\u001B]0m\n")
+	return err
+}
@@ -0,0 +1,39 @@
+package card
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "card.json")
+	if err := Write(path, "https://example.com/card.json", map[string]string{"digest": "sha256:abc"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"schema":"https://example.com/card.json","data":{"digest":"sha256:abc"}}`; string(content) != want {
+		t.Errorf("got %s, want %s", content, want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encode(&buf, []byte(`{"schema":""}`)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "\u001B]1338;") || !strings.HasSuffix(out, "\u001B]0m\n") {
+		t.Fatalf("unexpected escape sequence %q", out)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(out, "\u001B]1338;"), "\u001B]0m\n"))
+	if err != nil || string(decoded) != `{"schema":""}` {
+		t.Errorf("unexpected card %q: %v", decoded, err)
+	}
+}
@@ -0,0 +1,400 @@
+package acr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	kaniko "github.com/drone/drone-kaniko"
+	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/buildinfo"
+	"github.com/drone/drone-kaniko/pkg/credentials"
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/drone/drone-kaniko/pkg/flags"
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+const (
+	clientIdEnv        string = "AZURE_CLIENT_ID"
+	clientSecretKeyEnv string = "AZURE_CLIENT_SECRET"
+	tenantKeyEnv       string = "AZURE_TENANT_ID"
+	certPathEnv        string = "AZURE_CLIENT_CERTIFICATE_PATH"
+	finalUrl           string = "https://portal.azure.com/#view/Microsoft_Azure_ContainerRegistries/TagMetadataBlade/registryId/"
+)
+
+var (
+	defaultDockerPath = filepath.Join(sysinfo.KanikoDir, ".docker")
+	defaultDigestFile = filepath.Join(sysinfo.KanikoDir, "digest-file")
+
+	dockerConfigPath    = defaultDockerPath
+	configMergeStrategy = docker.MergeStrategyMerge
+	ACRCertPath         = filepath.Join(sysinfo.KanikoDir, "acr-cert.pem")
+	username            = "00000000-0000-0000-0000-000000000000"
+)
+
+// Main runs the acr plugin with the process arguments.
+func Main() {
+	if err := App().Run(os.Args); err != nil {
+		logrus.Error(err)
+		os.Exit(failure.ExitCode(err))
+	}
+}
+
+// App returns the acr plugin application.
+func App() *cli.App {
+	app := cli.NewApp()
+	app.Name = "kaniko acr plugin"
+	app.Usage = "kaniko acr plugin"
+	app.Action = run
+	app.Version, _ = buildinfo.Plugin()
+	app.Flags = append([]cli.Flag{
+		cli.StringFlag{
+			Name:   "repo",
+			Usage:  "docker repository",
+			EnvVar: "PLUGIN_REPO",
+		},
+		cli.BoolFlag{
+			Name:   "create-repository",
+			Usage:  "create ACR repository",
+			EnvVar: "PLUGIN_CREATE_REPOSITORY",
+		},
+		cli.StringFlag{
+			Name:   "registry",
+			Usage:  "ACR registry",
+			EnvVar: "PLUGIN_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   "client-secret",
+			Usage:  "Azure client secret",
+			EnvVar: "PLUGIN_CLIENT_SECRET,CLIENT_SECRET",
+		},
+		cli.StringFlag{
+			Name:   "client-cert",
+			Usage:  "Azure client certificate encoded in base64 format",
+			EnvVar: "PLUGIN_CLIENT_CERTIFICATE,CLIENT_CERTIFICATE",
+		},
+		cli.StringFlag{
+			Name:   "tenant-id",
+			Usage:  "Azure Tenant Id",
+			EnvVar: "PLUGIN_TENANT_ID,TENANT_ID",
+		},
+		cli.StringFlag{
+			Name:   "subscription-id",
+			Usage:  "Azure Subscription Id",
+			EnvVar: "PLUGIN_SUBSCRIPTION_ID,SUBSCRIPTION_ID",
+		},
+		cli.StringFlag{
+			Name:   "client-id",
+			Usage:  "Azure Client Id",
+			EnvVar: "PLUGIN_CLIENT_ID,CLIENT_ID",
+		},
+		cli.StringFlag{
+			Name:   "lifecycle-policy",
+			Usage:  "Path to lifecycle policy file",
+			EnvVar: "PLUGIN_LIFECYCLE_POLICY",
+		},
+		cli.StringFlag{
+			Name:   "repository-policy",
+			Usage:  "Path to repository policy file",
+			EnvVar: "PLUGIN_REPOSITORY_POLICY",
+		},
+		cli.StringFlag{
+			Name:   "cache-repo",
+			Usage:  "Remote repository that will be used to store cached layers. Cache repo should be present in specified registry. enable-cache needs to be set to use this flag",
+			EnvVar: "PLUGIN_CACHE_REPO",
+		},
+		cli.StringFlag{
+			Name:   "config-merge-strategy",
+			Usage:  "how generated credentials are combined with an existing docker config file (merge, keep or overwrite)",
+			Value:  docker.MergeStrategyMerge,
+			EnvVar: "PLUGIN_CONFIG_MERGE_STRATEGY",
+		},
+		cli.DurationFlag{
+			Name:   "token-refresh-interval",
+			Usage:  "interval at which registry tokens are refreshed during long builds, 0 disables the refresh",
+			Value:  time.Hour,
+			EnvVar: "PLUGIN_TOKEN_REFRESH_INTERVAL",
+		},
+	}, flags.Common()...)
+	return app
+}
+
+func run(c *cli.Context) error {
+	// stop the build when the step is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	flags.Logging(c)
+	if err := flags.ResolveSecrets(ctx, c); err != nil {
+		return err
+	}
+
+	scratch, err := flags.ScratchDir(c)
+	if scratch != "" {
+		defer os.RemoveAll(scratch)
+	}
+	if err != nil {
+		return err
+	}
+	if err := flags.DockerConfigSecret(ctx, c); err != nil {
+		return err
+	}
+	ACRCertPath = filepath.Join(scratch, "acr-cert.pem")
+
+	caCert, err := kaniko.InstallCACert(c.String("ca-cert"), c.String("ca-cert-path"), c.String("kaniko-dir"))
+	if err != nil {
+		return err
+	}
+
+	dockerConfigPath = c.String("docker-config-dir")
+	configMergeStrategy = c.String("config-merge-strategy")
+	if err := os.Setenv("DOCKER_CONFIG", dockerConfigPath); err != nil {
+		return errors.Wrap(err, "failed to set DOCKER_CONFIG")
+	}
+
+	registry := c.String("registry")
+	noPush := c.Bool("no-push")
+
+	publicUrl, err := setupAuth(
+		c.String("tenant-id"),
+		c.String("client-id"),
+		c.String("client-cert"),
+		c.String("client-secret"),
+		c.String("subscription-id"),
+		registry,
+		noPush,
+	)
+	if err != nil {
+		return err
+	}
+
+	// ACR refresh tokens expire after three hours
+	if !noPush {
+		refresh := credentials.Fetch{Registry: "https://" + registry, Func: func(context.Context) (string, string, string, error) {
+			token, _, err := getACRToken(c.String("subscription-id"), c.String("tenant-id"), c.String("client-id"),
+				c.String("client-secret"), c.String("client-cert"), registry)
+			return "", username, token, err
+		}}
+		go docker.KeepFresh(ctx, filepath.Join(dockerConfigPath, "config.json"), c.Duration("token-refresh-interval"), refresh.Provide)
+	}
+
+	build := flags.Build(c)
+	build.CACert = caCert
+	build.ScratchDir = scratch
+	build.Repo = c.String("repo")
+	build.CacheRepo = flags.CacheRepo(c, c.String("registry"))
+
+	plugin := kaniko.Plugin{
+		Build: build,
+		Artifact: kaniko.Artifact{
+			Tags:         c.StringSlice("tags"),
+			Repo:         c.String("repo"),
+			Registry:     publicUrl, // this is public url on which the artifact can be seen
+			ArtifactFile: c.String("artifact-file"),
+			Schema:       c.String("artifact-schema"),
+			RegistryType: artifact.Docker,
+		},
+		Output:  flags.Output(c),
+		Backend: flags.Backend(c),
+		GitOps:  flags.GitOps(c),
+		Status:  flags.Status(c),
+	}
+	return plugin.Exec(ctx)
+}
+
+func setupAuth(tenantId, clientId, cert,
+	clientSecret, subscriptionId, registry string, noPush bool) (string, error) {
+	if registry == "" {
+		return "", fmt.Errorf("registry must be specified")
+	}
+
+	if noPush {
+		return "", nil
+	}
+
+	// case of client secret or cert based auth
+	if clientId != "" {
+		// only setup auth when pushing or credentials are defined
+
+		token, publicUrl, err := getACRToken(subscriptionId, tenantId, clientId, clientSecret, cert, registry)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to fetch ACR Token")
+		}
+		auth := credentials.Chain{credentials.Static{Registry: "https://" + registry, Username: username, Password: token}}
+		err = auth.Write(context.Background(), filepath.Join(dockerConfigPath, "config.json"), configMergeStrategy)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to create docker config")
+		}
+		return publicUrl, nil
+	} else {
+		return "", fmt.Errorf("managed authentication is not supported")
+	}
+}
+
+func getACRToken(subscriptionId, tenantId, clientId, clientSecret, cert, registry string) (string, string, error) {
+	if tenantId == "" {
+		return "", "", fmt.Errorf("tenantId can't be empty for AAD authentication")
+	}
+
+	if clientId == "" {
+		return "", "", fmt.Errorf("clientId can't be empty for AAD authentication")
+	}
+
+	if clientSecret == "" && cert == "" {
+		return "", "", fmt.Errorf("one of client secret or cert should be defined")
+	}
+
+	// in case of authentication via cert
+	if cert != "" {
+		err := setupACRCert(cert)
+		if err != nil {
+			errors.Wrap(err, "failed to push setup cert file")
+		}
+	}
+
+	if err := os.Setenv(clientIdEnv, clientId); err != nil {
+		return "", "", errors.Wrap(err, "failed to set env variable client Id")
+	}
+	if err := os.Setenv(clientSecretKeyEnv, clientSecret); err != nil {
+		return "", "", errors.Wrap(err, "failed to set env variable client secret")
+	}
+	if err := os.Setenv(tenantKeyEnv, tenantId); err != nil {
+		return "", "", errors.Wrap(err, "failed to set env variable tenant Id")
+	}
+	if err := os.Setenv(certPathEnv, ACRCertPath); err != nil {
+		return "", "", errors.Wrap(err, "failed to set env variable cert path")
+	}
+	env, err := azidentity.NewEnvironmentCredential(nil)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to get env credentials from azure")
+	}
+
+	policy := policy.TokenRequestOptions{
+		Scopes: []string{"https://management.azure.com/.default"},
+	}
+	os.Unsetenv(clientIdEnv)
+	os.Unsetenv(clientSecretKeyEnv)
+	os.Unsetenv(tenantKeyEnv)
+	os.Unsetenv(certPathEnv)
+
+	azToken, err := env.GetToken(context.Background(), policy)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to fetch access token")
+	}
+
+	publicUrl, err := getPublicUrl(azToken.Token, registry, subscriptionId)
+	if err != nil {
+		// execution should not fail because of this error.
+		fmt.Fprintf(os.Stderr, "failed to get public url with error: %s\n", err)
+	}
+
+	ACRToken, err := fetchACRToken(tenantId, azToken.Token, registry)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to fetch ACR token")
+	}
+	return ACRToken, publicUrl, nil
+}
+
+func fetchACRToken(tenantId, token, registry string) (string, error) {
+	formData := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {registry},
+		"tenant":       {tenantId},
+		"access_token": {token},
+	}
+	jsonResponse, err := http.PostForm(fmt.Sprintf("https://%s/oauth2/exchange", registry), formData)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch ACR token")
+	}
+	var response map[string]interface{}
+	err = json.NewDecoder(jsonResponse.Body).Decode(&response)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode oauth exchange response")
+	}
+
+	if x, found := response["refresh_token"]; found {
+		s, ok := x.(string)
+		if !ok {
+			errors.New("failed to cast refresh token from acr")
+		} else {
+			return s, nil
+		}
+	} else {
+		return "", errors.Wrap(err, "refresh token not found in response of oauth exchange call")
+	}
+	return "", errors.New("failed to get refresh token from acr")
+}
+
+func setupACRCert(cert string) error {
+	decoded, err := base64.StdEncoding.DecodeString(cert)
+	if err != nil {
+		return errors.Wrap(err, "failed to base64 decode ACR certificate")
+	}
+	err = ioutil.WriteFile(ACRCertPath, []byte(decoded), 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write ACR certificate")
+	}
+	return nil
+}
+
+func getPublicUrl(token, registryUrl, subscriptionId string) (string, error) {
+	// for backward compatibilty, if the subscription id is not defined, do not fail step.
+	if len(subscriptionId) == 0 {
+		return "", nil
+	}
+
+	registry := strings.Split(registryUrl, ".")[0]
+	burl := "https://management.azure.com/subscriptions/" +
+		subscriptionId + "/resources?$filter=resourceType%20eq%20'Microsoft.ContainerRegistry/registries'%20and%20name%20eq%20'" +
+		registry + "'&api-version=2021-04-01&$select=id"
+
+	method := "GET"
+	client := &http.Client{}
+	req, err := http.NewRequest(method, burl, nil)
+	if err != nil {
+		fmt.Println(err)
+		return "", errors.Wrap(err, "failed to create request for getting container registry setting")
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+	res, err := client.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return "", errors.Wrap(err, "failed to send request for getting container registry setting")
+	}
+	defer res.Body.Close()
+
+	var response strct
+	err = json.NewDecoder(res.Body).Decode(&response)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to send request for getting container registry setting")
+	}
+	return finalUrl + encodeParam(response.Value[0].ID), nil
+}
+
+func encodeParam(s string) string {
+	return url.QueryEscape(s)
+}
+
+type strct struct {
+	Value []struct {
+		ID string `json:"id"`
+	} `json:"value"`
+}
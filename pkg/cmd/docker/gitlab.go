@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// gitlabJobTokenUser is the username GitLab expects with a CI job token.
+	gitlabJobTokenUser string = "gitlab-ci-token"
+	// gitlabMaxImageLevels is the number of path levels GitLab allows below
+	// the project path.
+	gitlabMaxImageLevels int = 3
+)
+
+// gitlab holds the GitLab container registry settings, usually read from
+// the CI_* variables GitLab provides to jobs.
+type gitlab struct {
+	Registry string // Registry host (CI_REGISTRY)
+	Image    string // Project image path (CI_REGISTRY_IMAGE)
+	JobToken string // CI job token (CI_JOB_TOKEN)
+}
+
+// credentials returns the registry credentials. A deploy token set as
+// username and password takes precedence over the job token.
+func (g gitlab) credentials(username, password string) (string, string) {
+	if password == "" && g.JobToken != "" {
+		return gitlabJobTokenUser, g.JobToken
+	}
+	return username, password
+}
+
+// repo returns the full image path for repo. An empty repo is the project
+// image, a single name is an image below the project image, and other paths
+// are relative to the registry. GitLab requires lowercase paths nested at
+// most three levels below the project path.
+func (g gitlab) repo(registry, repo string) (string, error) {
+	repo = strings.ToLower(strings.Trim(repo, "/"))
+	image := strings.ToLower(g.Image)
+
+	switch {
+	case repo == "" && image == "":
+		return "", fmt.Errorf("repository must be specified when CI_REGISTRY_IMAGE is not set")
+	case repo == "":
+		repo = image
+	case registry != "" && strings.HasPrefix(repo, registry+"/"):
+	case image != "" && !strings.Contains(repo, "/"):
+		repo = image + "/" + repo
+	case registry != "":
+		repo = registry + "/" + repo
+	}
+
+	if image != "" && strings.HasPrefix(repo, image+"/") {
+		if levels := strings.Count(strings.TrimPrefix(repo, image+"/"), "/") + 1; levels > gitlabMaxImageLevels {
+			return "", fmt.Errorf("repository %s is nested %d levels below the project path %s, gitlab allows at most %d", repo, levels, image, gitlabMaxImageLevels)
+		}
+	}
+	return repo, nil
+}
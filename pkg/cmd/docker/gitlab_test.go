@@ -0,0 +1,60 @@
+package docker
+
+import "testing"
+
+func Test_gitlabRepo(t *testing.T) {
+	gl := gitlab{Registry: "registry.gitlab.com", Image: "registry.gitlab.com/acme/platform/api"}
+
+	tests := []struct {
+		name string
+		repo string
+		want string
+		err  bool
+	}{
+		{
+			name: "project_image",
+			want: "registry.gitlab.com/acme/platform/api",
+		},
+		{
+			name: "sub_image",
+			repo: "Worker",
+			want: "registry.gitlab.com/acme/platform/api/worker",
+		},
+		{
+			name: "nested_group",
+			repo: "acme/platform/web",
+			want: "registry.gitlab.com/acme/platform/web",
+		},
+		{
+			name: "full_path",
+			repo: "registry.gitlab.com/acme/platform/api/a/b/c",
+			want: "registry.gitlab.com/acme/platform/api/a/b/c",
+		},
+		{
+			name: "too_deep",
+			repo: "registry.gitlab.com/acme/platform/api/a/b/c/d",
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gl.repo(gl.Registry, tt.repo)
+			if (err != nil) != tt.err {
+				t.Fatalf("repo(%q) error = %v", tt.repo, err)
+			}
+			if got != tt.want {
+				t.Errorf("repo(%q) = %q, want %q", tt.repo, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_gitlabCredentials(t *testing.T) {
+	gl := gitlab{JobToken: "job-token"}
+	if user, pass := gl.credentials("", ""); user != gitlabJobTokenUser || pass != "job-token" {
+		t.Errorf("unexpected job token credentials %s:%s", user, pass)
+	}
+	if user, pass := gl.credentials("deployer", "deploy-token"); user != "deployer" || pass != "deploy-token" {
+		t.Errorf("unexpected deploy token credentials %s:%s", user, pass)
+	}
+}
@@ -0,0 +1,328 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	kaniko "github.com/drone/drone-kaniko"
+	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/buildinfo"
+	"github.com/drone/drone-kaniko/pkg/credentials"
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/dockerhub"
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/drone/drone-kaniko/pkg/flags"
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+const (
+	v1RegistryURL    string = "https://index.docker.io/v1/" // Default registry
+	v2RegistryURL    string = "https://index.docker.io/v2/" // v2 registry is not supported
+	v2HubRegistryURL string = "https://registry.hub.docker.com/v2/"
+)
+
+var (
+	// Docker file path
+	defaultDockerPath = filepath.Join(sysinfo.KanikoDir, ".docker")
+	defaultDigestFile = filepath.Join(sysinfo.KanikoDir, "digest-file")
+
+	dockerPath       = defaultDockerPath
+	dockerConfigPath = filepath.Join(defaultDockerPath, "config.json")
+)
+
+// Main runs the docker plugin with the process arguments.
+func Main() {
+	// Load env-file if it exists first
+	if env := os.Getenv("PLUGIN_ENV_FILE"); env != "" {
+		if err := godotenv.Load(env); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	if err := App().Run(os.Args); err != nil {
+		logrus.Error(err)
+		os.Exit(failure.ExitCode(err))
+	}
+}
+
+// App returns the docker plugin application.
+func App() *cli.App {
+	app := cli.NewApp()
+	app.Name = "kaniko docker plugin"
+	app.Usage = "kaniko docker plugin"
+	app.Action = run
+	app.Version, _ = buildinfo.Plugin()
+	app.Flags = append([]cli.Flag{
+		cli.BoolFlag{
+			Name:   "expand-repo",
+			Usage:  "Prepends the registry url to the repo if registry url is not specified in repo name",
+			EnvVar: "PLUGIN_EXPAND_REPO",
+		},
+		cli.StringFlag{
+			Name:   "dockerconfig",
+			Usage:  "docker json dockerconfig",
+			EnvVar: "PLUGIN_CONFIG",
+		},
+		cli.StringFlag{
+			Name:   "repo",
+			Usage:  "docker repository",
+			EnvVar: "PLUGIN_REPO",
+		},
+		cli.StringFlag{
+			Name:   "registry",
+			Usage:  "docker registry",
+			Value:  v1RegistryURL,
+			EnvVar: "PLUGIN_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   "username",
+			Usage:  "docker username",
+			EnvVar: "PLUGIN_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "password",
+			Usage:  "docker password",
+			EnvVar: "PLUGIN_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:   "cache-repo",
+			Usage:  "Remote repository that will be used to store cached layers. enable-cache needs to be set to use this flag",
+			EnvVar: "PLUGIN_CACHE_REPO",
+		},
+		cli.StringFlag{
+			Name:   "dockerhub-oidc-token",
+			Usage:  "identity token exchanged for a short-lived docker hub access token",
+			EnvVar: "PLUGIN_DOCKERHUB_OIDC_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "dockerhub-token-url",
+			Usage:  "docker hub token exchange endpoint",
+			Value:  dockerhub.DefaultTokenURL,
+			EnvVar: "PLUGIN_DOCKERHUB_TOKEN_URL",
+		},
+		cli.StringFlag{
+			Name:   "config-merge-strategy",
+			Usage:  "how generated credentials are combined with an existing docker config file (merge, keep or overwrite)",
+			Value:  docker.MergeStrategyMerge,
+			EnvVar: "PLUGIN_CONFIG_MERGE_STRATEGY",
+		},
+		cli.StringFlag{
+			Name:   "registry-token",
+			Usage:  "bearer token used to authenticate with the registry",
+			EnvVar: "PLUGIN_REGISTRY_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "identity-token",
+			Usage:  "identity (refresh) token used to authenticate with the registry",
+			EnvVar: "PLUGIN_IDENTITY_TOKEN",
+		},
+		cli.BoolFlag{
+			Name:   "gitlab",
+			Usage:  "push to the gitlab container registry using the gitlab ci variables",
+			EnvVar: "PLUGIN_GITLAB",
+		},
+		cli.StringFlag{
+			Name:   "gitlab-registry",
+			Usage:  "gitlab container registry host",
+			EnvVar: "PLUGIN_GITLAB_REGISTRY,CI_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   "gitlab-registry-image",
+			Usage:  "gitlab project image path",
+			EnvVar: "PLUGIN_GITLAB_REGISTRY_IMAGE,CI_REGISTRY_IMAGE",
+		},
+		cli.StringFlag{
+			Name:   "gitlab-job-token",
+			Usage:  "gitlab ci job token",
+			EnvVar: "PLUGIN_GITLAB_JOB_TOKEN,CI_JOB_TOKEN",
+		},
+	}, flags.Common()...)
+
+	app.Commands = []cli.Command{serveCommand(app.Flags), submitCommand(app.Flags)}
+	return app
+}
+
+func run(c *cli.Context) error {
+	// stop the build when the step is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	flags.Logging(c)
+	if err := flags.ResolveSecrets(ctx, c); err != nil {
+		return err
+	}
+
+	scratch, err := flags.ScratchDir(c)
+	if scratch != "" {
+		defer os.RemoveAll(scratch)
+	}
+	if err != nil {
+		return err
+	}
+	if err := flags.DockerConfigSecret(ctx, c); err != nil {
+		return err
+	}
+
+	caCert, err := kaniko.InstallCACert(c.String("ca-cert"), c.String("ca-cert-path"), c.String("kaniko-dir"))
+	if err != nil {
+		return err
+	}
+
+	dockerPath = c.String("docker-config-dir")
+	dockerConfigPath = filepath.Join(dockerPath, "config.json")
+	if err := os.Setenv("DOCKER_CONFIG", dockerPath); err != nil {
+		return errors.Wrap(err, "failed to set DOCKER_CONFIG")
+	}
+
+	username := c.String("username")
+	password := c.String("password")
+	registry := c.String("registry")
+	repo := c.String("repo")
+	cacheRepo := c.String("cache-repo")
+	expandRepo := c.Bool("expand-repo")
+	noPush := c.Bool("no-push")
+	configOverride := c.String("dockerconfig")
+
+	if c.Bool("gitlab") {
+		gl := gitlab{
+			Registry: c.String("gitlab-registry"),
+			Image:    c.String("gitlab-registry-image"),
+			JobToken: c.String("gitlab-job-token"),
+		}
+		if registry == "" {
+			registry = gl.Registry
+		}
+		username, password = gl.credentials(username, password)
+
+		var err error
+		if repo, err = gl.repo(registry, repo); err != nil {
+			return err
+		}
+		if cacheRepo != "" {
+			if cacheRepo, err = gl.repo(registry, cacheRepo); err != nil {
+				return err
+			}
+		}
+		// the repositories include the registry already
+		expandRepo = false
+	}
+
+	// the docker config override, an identity token exchange, registry
+	// tokens and basic auth are mutually exclusive, in that order
+	registry = authRegistry(registry)
+	var exchanged dockerhub.Token
+	exchanger := dockerhub.Exchanger{
+		URL:        c.String("dockerhub-token-url"),
+		Identifier: username,
+		Secret:     c.String("dockerhub-oidc-token"),
+	}
+	auth := credentials.First(
+		credentials.File{Content: []byte(configOverride)},
+		credentials.OIDC{Registry: registry, Username: username, Exchanger: exchanger, Exchanged: &exchanged},
+		credentials.Token{Registry: registry, RegistryToken: c.String("registry-token"), IdentityToken: c.String("identity-token")},
+		credentials.Static{Registry: registry, Username: username, Password: password},
+	)
+	config, err := auth.Provide(ctx)
+	switch {
+	case err == credentials.ErrNotConfigured:
+		// setup auth when pushing or credentials are defined, unless
+		// they come from the docker config secret
+		if !noPush && c.String("docker-config-secret-path") == "" {
+			return fmt.Errorf("Username must be specified")
+		}
+	case err != nil:
+		return err
+	default:
+		if err := writeDockerCfgFile(config, c.String("config-merge-strategy")); err != nil {
+			return err
+		}
+	}
+	if !exchanged.ExpiresAt.IsZero() {
+		// the refreshed token always replaces the one written above
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go exchanger.KeepFresh(ctx, exchanged, func(token dockerhub.Token) error {
+			config, err := credentials.Static{Registry: registry, Username: username, Password: token.AccessToken}.Provide(ctx)
+			if err != nil {
+				return err
+			}
+			return writeDockerCfgFile(config, docker.MergeStrategyMerge)
+		})
+	}
+
+	build := flags.Build(c)
+	build.CACert = caCert
+	build.ScratchDir = scratch
+	build.Repo = buildRepo(registry, repo, expandRepo)
+	build.CacheRepo = buildRepo(registry, cacheRepo, expandRepo)
+	if c.String("cache-registry") != "" {
+		build.CacheRepo = flags.CacheRepo(c, registry)
+	}
+
+	plugin := kaniko.Plugin{
+		Build: build,
+		Artifact: kaniko.Artifact{
+			Tags:         c.StringSlice("tags"),
+			Repo:         buildRepo(registry, repo, expandRepo),
+			Registry:     registry,
+			ArtifactFile: c.String("artifact-file"),
+			Schema:       c.String("artifact-schema"),
+			RegistryType: artifact.Docker,
+		},
+		Output:  flags.Output(c),
+		Backend: flags.Backend(c),
+		GitOps:  flags.GitOps(c),
+		Status:  flags.Status(c),
+	}
+	return plugin.Exec(ctx)
+}
+
+// authRegistry returns the registry the credentials are stored for.
+func authRegistry(registry string) string {
+	if registry == v2RegistryURL || registry == v2HubRegistryURL {
+		fmt.Println("Docker v2 registry is not supported in kaniko. Refer issue: https://github.com/GoogleContainerTools/kaniko/issues/1209")
+		fmt.Printf("Using v1 registry instead: %s\n", v1RegistryURL)
+		return v1RegistryURL
+	}
+	return registry
+}
+
+// Write the docker config file, combined with an existing config file
+// according to the merge strategy
+func writeDockerCfgFile(config *docker.Config, strategy string) error {
+	jsonBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := docker.WriteConfigFile(dockerConfigPath, jsonBytes, strategy); err != nil {
+		return errors.Wrap(err, "failed to write docker config file")
+	}
+	return nil
+}
+
+func buildRepo(registry, repo string, expandRepo bool) string {
+	if !expandRepo || registry == "" || registry == v1RegistryURL {
+		// No custom registry, just return the repo name
+		return repo
+	}
+	// Trim off trailing slash to prevent double slash when combining with repo
+	registry = strings.TrimSuffix(registry, "/")
+	if strings.HasPrefix(repo, registry+"/") {
+		// Repo already includes the registry prefix
+		// For backward compatibility, we won't add the prefix again.
+		return repo
+	}
+	// Prefix the repo with the registry
+	return registry + "/" + repo
+}
@@ -0,0 +1,250 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/contextsync"
+	"github.com/drone/drone-kaniko/pkg/server"
+)
+
+// serveCommand returns the command serving the build API. Builds accept the
+// given flags as settings.
+func serveCommand(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "serve",
+		Usage: "run builds submitted over http",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "addr",
+				Usage:  "address to listen on",
+				Value:  ":8080",
+				EnvVar: "PLUGIN_SERVE_ADDR",
+			},
+			cli.StringFlag{
+				Name:   "token",
+				Usage:  "bearer token required to use the api, optional only on loopback addresses",
+				EnvVar: "PLUGIN_SERVE_TOKEN",
+			},
+			cli.IntFlag{
+				Name:   "queue-size",
+				Usage:  "number of builds that can be queued",
+				Value:  100,
+				EnvVar: "PLUGIN_SERVE_QUEUE_SIZE",
+			},
+			cli.StringFlag{
+				Name:   "content-dir",
+				Usage:  "directory the chunks of uploaded build contexts are kept in",
+				Value:  filepath.Join(os.TempDir(), "kaniko-contexts"),
+				EnvVar: "PLUGIN_SERVE_CONTENT_DIR",
+			},
+			cli.DurationFlag{
+				Name:   "retention",
+				Usage:  "how long finished builds and their logs are kept",
+				Value:  24 * time.Hour,
+				EnvVar: "PLUGIN_SERVE_RETENTION",
+			},
+			cli.DurationFlag{
+				Name:   "context-retention",
+				Usage:  "how long uploaded contexts and chunks no build used are kept",
+				Value:  7 * 24 * time.Hour,
+				EnvVar: "PLUGIN_SERVE_CONTEXT_RETENTION",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return serve(c, flags)
+		},
+	}
+}
+
+func serve(c *cli.Context, flags []cli.Flag) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// each build runs the plugin with its settings as flags, so the server
+	// configuration must not leak into builds through the environment. Builds
+	// share the root filesystem, so kaniko cleans it up after each build and
+	// registry credentials are written to a docker config of the build only.
+	run := func(ctx context.Context, dir string, args []string, out io.Writer) error {
+		configDir, err := ioutil.TempDir("", "docker-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(configDir)
+		args = append(args, "--cleanup", "--docker-config-dir="+configDir)
+
+		cmd := exec.CommandContext(ctx, exe, args...)
+		cmd.Dir = dir
+		cmd.Stdout = out
+		cmd.Stderr = out
+		cmd.Env = buildEnv(os.Environ())
+		return cmd.Run()
+	}
+
+	if c.String("token") == "" {
+		if !isLoopback(c.String("addr")) {
+			return fmt.Errorf("a token is required to serve builds on %s, only loopback addresses may be served without one", c.String("addr"))
+		}
+		logrus.Warn("serving builds without a token, any local process can run builds")
+	}
+	var names []string
+	for _, flag := range flags {
+		if name := flag.GetName(); buildSettings[name] {
+			names = append(names, name)
+		}
+	}
+	srv := server.New(run, names, c.String("token"), c.Int("queue-size"))
+	srv.SetPaths(pathSettings)
+	srv.SetRetention(c.Duration("retention"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if dir := c.String("content-dir"); dir != "" {
+		srv.EnableContexts(dir)
+		if retention := c.Duration("context-retention"); retention > 0 {
+			go pruneContexts(ctx, contextsync.Store(dir), retention)
+		}
+	}
+	go srv.Start(ctx)
+
+	logrus.Infof("serving builds on %s", c.String("addr"))
+	return http.ListenAndServe(c.String("addr"), srv)
+}
+
+// contextPruneInterval is how often uploaded contexts are pruned.
+const contextPruneInterval = time.Hour
+
+// pruneContexts removes the uploaded contexts and chunks unused for maxAge
+// until ctx is cancelled.
+func pruneContexts(ctx context.Context, store contextsync.Store, maxAge time.Duration) {
+	ticker := time.NewTicker(contextPruneInterval)
+	defer ticker.Stop()
+	for {
+		if removed, err := store.Prune(maxAge); err != nil {
+			logrus.Warnf("failed to prune uploaded contexts: %s", err)
+		} else if removed > 0 {
+			logrus.Infof("pruned %d unused files of uploaded contexts", removed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// isLoopback returns true if addr only listens on a loopback interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// buildSettings are the settings submitted builds can set. Settings naming
+// files, directories, commands or credentials of the server are left out,
+// so a build cannot read or write files of the server, and cleanup and the
+// docker config directory are set by the server for every build.
+var buildSettings = map[string]bool{
+	"args":                        true,
+	"auto-labels":                 true,
+	"auto-tag":                    true,
+	"auto-tag-suffix":             true,
+	"cache-bust":                  true,
+	"cache-bust-stage":            true,
+	"cache-password":              true,
+	"cache-registry":              true,
+	"cache-registry-insecure":     true,
+	"cache-repo":                  true,
+	"cache-ttl":                   true,
+	"cache-username":              true,
+	"calver":                      true,
+	"calver-template":             true,
+	"calver-timezone":             true,
+	"compressed-caching":          true,
+	"content-tag":                 true,
+	"context":                     true,
+	"context-sub-path":            true,
+	"custom-labels":               true,
+	"dockerfile":                  true,
+	"dockerfile-contents":         true,
+	"drone-build-created":         true,
+	"drone-build-number":          true,
+	"drone-commit-after":          true,
+	"drone-commit-author":         true,
+	"drone-commit-before":         true,
+	"drone-commit-branch":         true,
+	"drone-commit-message":        true,
+	"drone-commit-ref":            true,
+	"drone-commit-sha":            true,
+	"drone-repo-branch":           true,
+	"drone-tag":                   true,
+	"enable-cache":                true,
+	"expand-repo":                 true,
+	"expand-tag":                  true,
+	"expand-tag-latest":           true,
+	"expand-tag-levels":           true,
+	"log-color":                   true,
+	"log-timestamps":              true,
+	"max-image-size":              true,
+	"max-uncompressed-image-size": true,
+	"mirror-exclude":              true,
+	"mirror-prefix":               true,
+	"mirror-preset":               true,
+	"no-push":                     true,
+	"password":                    true,
+	"platform":                    true,
+	"post-annotations":            true,
+	"post-labels":                 true,
+	"push-permission-check":       true,
+	"referrers-mode":              true,
+	"registry":                    true,
+	"registry-mirrors":            true,
+	"repo":                        true,
+	"require-target":              true,
+	"sanitize-tags":               true,
+	"single-snapshot":             true,
+	"skip-if-exists":              true,
+	"skip-tls-verify":             true,
+	"skip-unused-stages":          true,
+	"snapshot-mode":               true,
+	"strict-args":                 true,
+	"tag-prefix":                  true,
+	"tag-suffix":                  true,
+	"tags":                        true,
+	"target":                      true,
+	"username":                    true,
+	"verbosity":                   true,
+}
+
+// pathSettings are the build settings naming files of the build context.
+var pathSettings = []string{"context", "context-sub-path", "dockerfile"}
+
+// buildEnv returns env without the plugin settings.
+func buildEnv(env []string) []string {
+	var filtered []string
+	for _, v := range env {
+		if !strings.HasPrefix(v, "PLUGIN_") {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,43 @@
+package docker
+
+import "testing"
+
+func TestIsLoopback(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		"localhost:8080": true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.1:8080":  false,
+		"example.com:80": false,
+		"8080":           false,
+	}
+	for addr, want := range tests {
+		if got := isLoopback(addr); got != want {
+			t.Errorf("expected loopback %v for %s, got %v", want, addr, got)
+		}
+	}
+}
+
+func TestBuildSettings(t *testing.T) {
+	flags := map[string]bool{}
+	for _, flag := range App().Flags {
+		flags[flag.GetName()] = true
+	}
+	for name := range buildSettings {
+		if !flags[name] {
+			t.Errorf("build setting %s is not a flag", name)
+		}
+	}
+	for _, name := range pathSettings {
+		if !buildSettings[name] {
+			t.Errorf("path setting %s is not a build setting", name)
+		}
+	}
+	for _, name := range []string{"cleanup", "docker-config-dir", "tar-path", "digest-file", "artifact-file", "secrets", "ssh-key", "extra-contexts", "cache-dir"} {
+		if buildSettings[name] {
+			t.Errorf("expected builds not to set %s", name)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/contextsync"
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+	"github.com/drone/drone-kaniko/pkg/server"
+	"github.com/drone/drone-kaniko/pkg/units"
+)
+
+// submitCommand returns the command running the build on a build server,
+// started with serve. The given flags are passed as settings.
+func submitCommand(flags []cli.Flag) cli.Command {
+	return cli.Command{
+		Name:  "submit",
+		Usage: "run the build on a build server, uploading the changes of the build context",
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				Name:   "server",
+				Usage:  "address of the build server, e.g. https://builds.example.com",
+				EnvVar: "PLUGIN_SERVE_URL",
+			},
+			cli.StringFlag{
+				Name:   "token",
+				Usage:  "bearer token of the build server",
+				EnvVar: "PLUGIN_SERVE_TOKEN",
+			},
+		}, flags...),
+		Action: func(c *cli.Context) error {
+			return submit(c, flags)
+		},
+	}
+}
+
+func submit(c *cli.Context, flags []cli.Flag) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if c.String("server") == "" {
+		return fmt.Errorf("the build server must be set")
+	}
+	client := server.Client{URL: c.String("server"), Token: c.String("token")}
+	settings, ignored := submitSettings(c, flags)
+	if len(ignored) > 0 {
+		fmt.Fprintf(os.Stderr, "Settings build servers do not accept are ignored: %s\n", strings.Join(ignored, ", "))
+	}
+	req := server.Request{Settings: settings}
+
+	if dir := c.String("context"); strings.Contains(dir, "://") {
+		// remote contexts are fetched by the executor on the server
+		settings["context"] = dir
+	} else {
+		var keep []string
+		if c.String("dockerfile-contents") == "" {
+			dockerfile, err := contextDockerfile(dir, c.String("dockerfile"))
+			if err != nil {
+				return err
+			}
+			settings["dockerfile"] = dockerfile
+			keep = append(keep, dockerfile)
+		}
+		ignore, err := dockerignore.ReadFile(filepath.Join(dir, ".dockerignore"))
+		if err != nil {
+			return err
+		}
+		snapshot, err := contextsync.Scan(dir, ignore, append(keep, ".dockerignore")...)
+		if err != nil {
+			return err
+		}
+		result, err := client.UploadContext(ctx, snapshot)
+		if err != nil {
+			return errors.Wrap(err, "failed to upload the build context")
+		}
+		fmt.Fprintf(os.Stdout, "Uploaded %d of %d chunks (%s of %s) of the build context\n",
+			result.UploadedChunks, result.Chunks, units.FormatSize(result.UploadedBytes), units.FormatSize(snapshot.Size))
+		req.Context = result.ID
+	}
+
+	build, err := client.Submit(ctx, req)
+	if err != nil {
+		return errors.Wrap(err, "failed to submit the build")
+	}
+	fmt.Fprintf(os.Stdout, "Submitted build %s\n", build.ID)
+	if err := client.Logs(ctx, build.ID, os.Stdout); err != nil {
+		return errors.Wrap(err, "failed to follow the build log")
+	}
+	// the status is updated right after the log is complete
+	for build.Status != server.StatusSucceeded && build.Status != server.StatusFailed {
+		time.Sleep(time.Second)
+		if build, err = client.Get(ctx, build.ID); err != nil {
+			return err
+		}
+	}
+	if build.Status == server.StatusFailed {
+		return fmt.Errorf("build %s failed: %s", build.ID, build.Error)
+	}
+	return nil
+}
+
+// submitSettings returns the values of the flags that are set, keyed by
+// flag name, except the context and the Dockerfile, which are resolved
+// against the uploaded context. It also returns the names of the flags set
+// that builds cannot submit.
+func submitSettings(c *cli.Context, flags []cli.Flag) (map[string]interface{}, []string) {
+	settings := map[string]interface{}{}
+	var ignored []string
+	for _, flag := range flags {
+		name := flag.GetName()
+		if name == "context" || name == "dockerfile" || !c.IsSet(name) {
+			continue
+		}
+		if !buildSettings[name] {
+			ignored = append(ignored, name)
+			continue
+		}
+		switch flag.(type) {
+		case cli.BoolFlag:
+			settings[name] = c.Bool(name)
+		case cli.BoolTFlag:
+			settings[name] = c.BoolT(name)
+		case cli.IntFlag:
+			settings[name] = float64(c.Int(name))
+		case cli.DurationFlag:
+			settings[name] = c.Duration(name).String()
+		case cli.StringSliceFlag:
+			var values []interface{}
+			for _, value := range c.StringSlice(name) {
+				values = append(values, value)
+			}
+			settings[name] = values
+		default:
+			settings[name] = c.String(name)
+		}
+	}
+	return settings, ignored
+}
+
+// contextDockerfile returns the path, relative to the context, of the first
+// existing Dockerfile of the comma separated candidates, which must be
+// within the context to be uploaded with it.
+func contextDockerfile(dir, candidates string) (string, error) {
+	for _, candidate := range strings.Split(candidates, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "" {
+			continue
+		}
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		absFile, err := filepath.Abs(candidate)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(absDir, absFile)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("dockerfile %s must be within the build context %s to be uploaded", candidate, dir)
+		}
+		return filepath.ToSlash(rel), nil
+	}
+	return "", fmt.Errorf("none of the dockerfiles exist: %s", candidates)
+}
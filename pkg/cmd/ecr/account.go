@@ -0,0 +1,64 @@
+package ecr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/pkg/errors"
+)
+
+// callerAccount returns the account id of the role when one is assumed,
+// otherwise of the credentials as reported by STS GetCallerIdentity, which
+// requires no permissions. The access key is used when set.
+func callerAccount(ctx context.Context, region, assumeRole, accessKey, secretKey string) (string, error) {
+	if account := roleAccount(assumeRole); account != "" {
+		return account, nil
+	}
+	var opts []func(*config.LoadOptions) error
+	if accessKey != "" && secretKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: accessKey, SecretAccessKey: secretKey}, nil
+		})))
+	}
+	cfg, err := loadAWSConfig(ctx, region, opts...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to load aws config")
+	}
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get caller identity")
+	}
+	return aws.ToString(identity.Account), nil
+}
+
+// roleAccount returns the account id of a role ARN, or an empty string.
+func roleAccount(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) < 6 || parts[0] != "arn" || !accountIDPattern.MatchString(parts[4]) {
+		return ""
+	}
+	return parts[4]
+}
+
+// registryAccount returns the account id of a private ECR registry host,
+// or an empty string.
+func registryAccount(registry string) string {
+	if registryRegion(registry) == "" {
+		return ""
+	}
+	return strings.SplitN(registry, ".", 2)[0]
+}
+
+// checkRegistryAccount returns an error when the private registry belongs
+// to another account than the credentials, the most common cause of
+// authorization failures when pushing.
+func checkRegistryAccount(registry, account string) error {
+	if owner := registryAccount(registry); owner != "" && owner != account {
+		return fmt.Errorf("registry %s belongs to account %s, but the credentials are of account %s; set PLUGIN_CROSS_ACCOUNT=true when the repository policy grants access", registry, owner, account)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package ecr
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	endpointsv1 "github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/pkg/errors"
+)
+
+// service identifiers used by the v2 sdk endpoint resolver.
+const (
+	ecrServiceID = "ECR"
+	stsServiceID = "STS"
+)
+
+// awsEndpoints overrides the public ECR and STS API endpoints, typically
+// with VPC interface endpoints (PrivateLink) so that runners without
+// internet access can fetch auth tokens.
+type awsEndpoints struct {
+	ECR string
+	STS string
+}
+
+// endpoints is set from the plugin settings before any AWS API is called.
+var endpoints awsEndpoints
+
+func (e awsEndpoints) validate() error {
+	for name, endpoint := range map[string]string{"ecr": e.ECR, "sts": e.STS} {
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid %s endpoint %q: must be an https url", name, endpoint)
+		}
+	}
+	return nil
+}
+
+// resolve returns the custom endpoint for the v2 sdk service, falling back
+// to the default resolution for services that are not overridden.
+func (e awsEndpoints) resolve(service, region string, _ ...interface{}) (aws.Endpoint, error) {
+	var endpoint string
+	switch service {
+	case ecrServiceID:
+		endpoint = e.ECR
+	case stsServiceID:
+		endpoint = e.STS
+	}
+	if endpoint == "" {
+		return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+	}
+	return aws.Endpoint{
+		URL:           endpoint,
+		SigningRegion: region,
+		Source:        aws.EndpointSourceCustom,
+	}, nil
+}
+
+// loadAWSConfig loads the default v2 sdk configuration for the region,
+// honouring the endpoint overrides.
+func loadAWSConfig(ctx context.Context, region string, opts ...func(*config.LoadOptions) error) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx, append([]func(*config.LoadOptions) error{
+		config.WithRegion(region),
+		config.WithEndpointResolverWithOptions(aws.EndpointResolverWithOptionsFunc(endpoints.resolve)),
+	}, opts...)...)
+}
+
+// newAWSSession creates a v1 sdk session for the region. STS calls use
+// the regional endpoint so they can be served by a VPC endpoint.
+func newAWSSession(region string) (*session.Session, error) {
+	return session.NewSession(&awsv1.Config{
+		Region:              &region,
+		STSRegionalEndpoint: endpointsv1.RegionalSTSEndpoint,
+	})
+}
+
+// stsProvider returns the config provider used to create the v1 sdk STS
+// client when assuming a role.
+func (e awsEndpoints) stsProvider(sess *session.Session) client.ConfigProvider {
+	if e.STS == "" {
+		return sess
+	}
+	return sess.Copy(&awsv1.Config{Endpoint: awsv1.String(e.STS)})
+}
+
+// ecrEndpoint returns the v1 sdk endpoint override for ECR, if any.
+func (e awsEndpoints) ecrEndpoint() *string {
+	if e.ECR == "" {
+		return nil
+	}
+	return awsv1.String(e.ECR)
+}
+
+// getEcrAuth fetches an auth token through the configured ECR endpoint.
+// The credential helper used by the executor always talks to the public
+// endpoint, so the token is written to the docker config instead.
+func getEcrAuth(ctx context.Context, region string) (username, password string, err error) {
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to load aws config")
+	}
+	result, err := ecr.NewFromConfig(cfg).GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to get ECR auth token")
+	}
+	if len(result.AuthorizationData) == 0 || result.AuthorizationData[0].AuthorizationToken == nil {
+		return "", "", fmt.Errorf("failed to get ECR auth token: empty response")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(*result.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to decode ECR auth token")
+	}
+	creds := strings.SplitN(string(decoded), ":", 2)
+	if len(creds) != 2 {
+		return "", "", fmt.Errorf("failed to decode ECR auth token: unexpected format")
+	}
+	return creds[0], creds[1], nil
+}
@@ -0,0 +1,831 @@
+package ecr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	ecrv1 "github.com/aws/aws-sdk-go/service/ecr"
+	ecrpublicv1 "github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/smithy-go"
+	"github.com/hashicorp/go-version"
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	kaniko "github.com/drone/drone-kaniko"
+	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/buildinfo"
+	"github.com/drone/drone-kaniko/pkg/credentials"
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/drone/drone-kaniko/pkg/flags"
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+const (
+	accessKeyEnv     string = "AWS_ACCESS_KEY_ID"
+	secretKeyEnv     string = "AWS_SECRET_ACCESS_KEY"
+	ecrPublicDomain  string = "public.ecr.aws"
+	kanikoVersionEnv string = "KANIKO_VERSION"
+
+	oneDotEightVersion string = "1.8.0"
+
+	immutableTagFail   string = "fail"
+	immutableTagSkip   string = "skip"
+	immutableTagSuffix string = "suffix"
+)
+
+var (
+	defaultDockerPath = filepath.Join(sysinfo.KanikoDir, ".docker")
+	defaultDigestFile = filepath.Join(sysinfo.KanikoDir, "digest-file")
+)
+
+// Main runs the ecr plugin with the process arguments.
+func Main() {
+	// Load env-file if it exists first
+	if env := os.Getenv("PLUGIN_ENV_FILE"); env != "" {
+		if err := godotenv.Load(env); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	if err := App().Run(os.Args); err != nil {
+		logrus.Error(err)
+		os.Exit(failure.ExitCode(err))
+	}
+}
+
+// App returns the ecr plugin application.
+func App() *cli.App {
+	app := cli.NewApp()
+	app.Name = "kaniko ecr plugin"
+	app.Usage = "kaniko ecr plugin"
+	app.Action = run
+	app.Version, _ = buildinfo.Plugin()
+	app.Flags = append([]cli.Flag{
+		cli.StringFlag{
+			Name:   "docker-registry",
+			Usage:  "docker registry",
+			EnvVar: "PLUGIN_DOCKER_REGISTRY,DOCKER_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   "docker-username",
+			Usage:  "docker username",
+			EnvVar: "PLUGIN_USERNAME,DOCKER_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "docker-password",
+			Usage:  "docker password",
+			EnvVar: "PLUGIN_PASSWORD,DOCKER_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:   "repo",
+			Usage:  "docker repository",
+			EnvVar: "PLUGIN_REPO",
+		},
+		cli.BoolFlag{
+			Name:   "create-repository",
+			Usage:  "create ECR repository",
+			EnvVar: "PLUGIN_CREATE_REPOSITORY",
+		},
+		cli.StringFlag{
+			Name:   "create-repository-policy",
+			Usage:  "repository policy applied to created repositories, and to existing ones when it differs, inline JSON or a file, rendered as a template with the repository, registry, account and region",
+			EnvVar: "PLUGIN_CREATE_REPOSITORY_POLICY",
+		},
+		cli.StringFlag{
+			Name:   "encryption-type",
+			Usage:  "encryption of created repositories, AES256 or KMS",
+			EnvVar: "PLUGIN_ENCRYPTION_TYPE",
+		},
+		cli.StringFlag{
+			Name:   "kms-key",
+			Usage:  "KMS key ARN encrypting created repositories",
+			EnvVar: "PLUGIN_KMS_KEY",
+		},
+		cli.BoolFlag{
+			Name:   "scan-on-push",
+			Usage:  "enable basic scan on push for created repositories",
+			EnvVar: "PLUGIN_SCAN_ON_PUSH",
+		},
+		cli.StringFlag{
+			Name:   "enhanced-scanning",
+			Usage:  "register created repositories for enhanced scanning, scan_on_push or continuous_scan",
+			EnvVar: "PLUGIN_ENHANCED_SCANNING",
+		},
+		cli.StringFlag{
+			Name:   "region",
+			Usage:  "AWS region",
+			Value:  "us-east-1",
+			EnvVar: "PLUGIN_REGION",
+		},
+		cli.StringFlag{
+			Name:   "ecr-endpoint",
+			Usage:  "custom ECR API endpoint, e.g. a VPC interface endpoint",
+			EnvVar: "PLUGIN_ECR_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name:   "sts-endpoint",
+			Usage:  "custom STS API endpoint, e.g. a VPC interface endpoint",
+			EnvVar: "PLUGIN_STS_ENDPOINT",
+		},
+		cli.DurationFlag{
+			Name:   "token-refresh-interval",
+			Usage:  "interval at which registry tokens are refreshed during long builds, 0 disables the refresh",
+			Value:  time.Hour,
+			EnvVar: "PLUGIN_TOKEN_REFRESH_INTERVAL",
+		},
+		cli.StringFlag{
+			Name:   "registry",
+			Usage:  "ECR registry, or the account id of the private registry in the region, defaults to the registry of the account of the credentials",
+			EnvVar: "PLUGIN_REGISTRY",
+		},
+		cli.BoolFlag{
+			Name:   "cross-account",
+			Usage:  "allow pushing to a private registry of another account than the credentials",
+			EnvVar: "PLUGIN_CROSS_ACCOUNT",
+		},
+		cli.StringFlag{
+			Name:   "access-key",
+			Usage:  "ECR access key",
+			EnvVar: "PLUGIN_ACCESS_KEY",
+		},
+		cli.StringFlag{
+			Name:   "secret-key",
+			Usage:  "ECR secret key",
+			EnvVar: "PLUGIN_SECRET_KEY",
+		},
+		cli.StringFlag{
+			Name:   "assume-role",
+			Usage:  "Assume a role",
+			EnvVar: "PLUGIN_ASSUME_ROLE",
+		},
+		cli.StringFlag{
+			Name:   "external-id",
+			Usage:  "Used along with assume role to assume a role",
+			EnvVar: "PLUGIN_EXTERNAL_ID",
+		},
+		cli.StringFlag{
+			Name:   "lifecycle-policy",
+			Usage:  "Path to lifecycle policy file",
+			EnvVar: "PLUGIN_LIFECYCLE_POLICY",
+		},
+		cli.StringFlag{
+			Name:   "repository-policy",
+			Usage:  "Path to repository policy file",
+			EnvVar: "PLUGIN_REPOSITORY_POLICY",
+		},
+		cli.StringFlag{
+			Name:   "cache-repo",
+			Usage:  "Remote repository that will be used to store cached layers. Cache repo should be present in specified registry. enable-cache needs to be set to use this flag",
+			EnvVar: "PLUGIN_CACHE_REPO",
+		},
+		cli.StringFlag{
+			Name:   "immutable-tag-strategy",
+			Usage:  "Action when a tag already exists in an immutable repository, one of fail, skip or suffix",
+			EnvVar: "PLUGIN_IMMUTABLE_TAG_STRATEGY",
+		},
+		cli.StringFlag{
+			Name:   "config-merge-strategy",
+			Usage:  "how generated credentials are combined with an existing docker config file (merge, keep or overwrite)",
+			Value:  docker.MergeStrategyMerge,
+			EnvVar: "PLUGIN_CONFIG_MERGE_STRATEGY",
+		},
+	}, flags.Common()...)
+	return app
+}
+
+func run(c *cli.Context) error {
+	// stop the build when the step is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	flags.Logging(c)
+	if err := flags.ResolveSecrets(ctx, c); err != nil {
+		return err
+	}
+
+	scratch, err := flags.ScratchDir(c)
+	if scratch != "" {
+		defer os.RemoveAll(scratch)
+	}
+	if err != nil {
+		return err
+	}
+	if err := flags.DockerConfigSecret(ctx, c); err != nil {
+		return err
+	}
+
+	caCert, err := kaniko.InstallCACert(c.String("ca-cert"), c.String("ca-cert-path"), c.String("kaniko-dir"))
+	if err != nil {
+		return err
+	}
+
+	if err := os.Setenv("DOCKER_CONFIG", c.String("docker-config-dir")); err != nil {
+		return errors.Wrap(err, "failed to set DOCKER_CONFIG")
+	}
+
+	repo := c.String("repo")
+	registry := c.String("registry")
+	region := c.String("region")
+	noPush := c.Bool("no-push")
+	assumeRole := c.String("assume-role")
+	externalId := c.String("external-id")
+
+	// the registry host determines the region unless it is set explicitly
+	if r := registryRegion(registry); r != "" && !c.IsSet("region") {
+		region = r
+	}
+	partition, err := partitionFor(region)
+	if err != nil {
+		return err
+	}
+	if err := partition.checkRoleArn(assumeRole); err != nil {
+		return err
+	}
+
+	endpoints = awsEndpoints{
+		ECR: c.String("ecr-endpoint"),
+		STS: c.String("sts-endpoint"),
+	}
+	if err := endpoints.validate(); err != nil {
+		return err
+	}
+
+	// the registry defaults to the private registry of the account of the
+	// credentials, which is also expected to own a given registry
+	resolved := registry == "" && !noPush
+	if resolved {
+		account, err := callerAccount(ctx, region, assumeRole, c.String("access-key"), c.String("secret-key"))
+		if err != nil {
+			return errors.Wrap(err, "registry is not specified and failed to resolve the account of the credentials")
+		}
+		registry = account
+	}
+	if registry, err = partition.resolveRegistry(registry, region); err != nil {
+		return err
+	}
+	if resolved {
+		fmt.Printf("Using registry %s of the account of the credentials\n", registry)
+	} else if registryAccount(registry) != "" && !noPush && !c.Bool("cross-account") {
+		account, err := callerAccount(ctx, region, assumeRole, c.String("access-key"), c.String("secret-key"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to check the account of registry %s: %s\n", registry, err)
+		} else if err := checkRegistryAccount(registry, account); err != nil {
+			return err
+		}
+	}
+
+	dockerConfig, err := createDockerConfig(
+		ctx,
+		c.String("docker-registry"),
+		c.String("docker-username"),
+		c.String("docker-password"),
+		c.String("access-key"),
+		c.String("secret-key"),
+		registry,
+		assumeRole,
+		externalId,
+		region,
+		noPush,
+	)
+	if err != nil {
+		return err
+	}
+
+	jsonBytes, err := json.Marshal(dockerConfig)
+	if err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(c.String("docker-config-dir"), "config.json")
+	if err := docker.WriteConfigFile(configPath, jsonBytes, c.String("config-merge-strategy")); err != nil {
+		return err
+	}
+
+	// tokens written to the docker config expire, credential helpers fetch
+	// their own when pushing
+	if token := ecrToken(registry, assumeRole, externalId, region); token.Func != nil && !noPush {
+		go docker.KeepFresh(ctx, configPath, c.Duration("token-refresh-interval"), token.Provide)
+	}
+
+	// only create repository when pushing and create-repository is true
+	if !noPush && c.Bool("create-repository") {
+		opts := repositoryOptions{
+			EncryptionType:   c.String("encryption-type"),
+			KmsKey:           c.String("kms-key"),
+			ScanOnPush:       c.Bool("scan-on-push"),
+			EnhancedScanning: c.String("enhanced-scanning"),
+		}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		if isRegistryPublic(registry) && opts.isSet() {
+			fmt.Println("Encryption and scanning settings are not supported by public repositories and are ignored")
+			opts = repositoryOptions{}
+		}
+		var policy string
+		if text := c.String("create-repository-policy"); text != "" {
+			data := policyData{Repository: repo, Registry: registry, Account: registryAccount(registry), Region: region}
+			if policy, err = renderPolicy(text, data); err != nil {
+				return err
+			}
+		}
+		if err := createRepository(ctx, region, repo, registry, assumeRole, externalId, opts); err != nil {
+			return err
+		}
+		// existing repositories get the policy too, so that changes to the
+		// template reach every repository on its next build
+		if policy != "" {
+			current, err := getRepositoryPolicy(ctx, region, repo, registry, assumeRole, externalId)
+			if err != nil {
+				return err
+			}
+			if policyChanged(current, policy) {
+				if err := uploadRepositoryPolicy(ctx, region, repo, registry, policy, assumeRole, externalId); err != nil {
+					return errors.Wrap(err, "failed to apply the repository policy")
+				}
+				fmt.Printf("Applied the repository policy to repository %s\n", repo)
+			}
+		}
+	}
+
+	if c.IsSet("lifecycle-policy") {
+		contents, err := ioutil.ReadFile(c.String("lifecycle-policy"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if err := uploadLifeCyclePolicy(ctx, region, repo, string(contents), assumeRole, externalId); err != nil {
+			logrus.Fatal(fmt.Sprintf("error uploading ECR lifecycle policy: %v", err))
+		}
+	}
+
+	if c.IsSet("repository-policy") {
+		contents, err := ioutil.ReadFile(c.String("repository-policy"))
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if err := uploadRepositoryPolicy(ctx, region, repo, registry, string(contents), assumeRole, externalId); err != nil {
+			logrus.Fatal(fmt.Sprintf("error uploading ECR lifecycle policy: %v", err))
+		}
+	}
+
+	build := flags.Build(c)
+	build.CACert = caCert
+	build.ScratchDir = scratch
+	build.Repo = fmt.Sprintf("%s/%s", registry, c.String("repo"))
+	build.CacheRepo = flags.CacheRepo(c, registry)
+
+	plugin := kaniko.Plugin{
+		Build: build,
+		Artifact: kaniko.Artifact{
+			Tags:         c.StringSlice("tags"),
+			Repo:         c.String("repo"),
+			Registry:     registry,
+			ArtifactFile: c.String("artifact-file"),
+			Schema:       c.String("artifact-schema"),
+			RegistryType: artifact.ECR,
+		},
+		Output:  flags.Output(c),
+		Backend: flags.Backend(c),
+		GitOps:  flags.GitOps(c),
+		Status:  flags.Status(c),
+	}
+
+	// only check for existing tags when pushing and a strategy is requested,
+	// as the lookup needs additional ECR permissions
+	if strategy := c.String("immutable-tag-strategy"); !noPush && strategy != "" && !isRegistryPublic(registry) {
+		tags, err := plugin.Build.ResolveTags()
+		if err != nil {
+			return err
+		}
+		suffix := immutableTagSuffixFor(c.String("drone-commit-sha"), c.String("drone-build-number"))
+		existing, err := getExistingImmutableTags(ctx, region, repo, assumeRole, externalId, immutableTagCandidates(strategy, tags, suffix))
+		if err != nil {
+			return err
+		}
+		tags, err = resolveImmutableTags(strategy, tags, existing, suffix)
+		if err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			fmt.Printf("All tags already exist in immutable repository %s, skipping build\n", repo)
+			return nil
+		}
+		// the prefix, suffix, calver and content tags are part of the
+		// resolved tags, which must not be derived again
+		plugin.Build.Tags = tags
+		plugin.Build.TagsResolved = true
+		plugin.Artifact.Tags = tags
+	}
+
+	return plugin.Exec(ctx)
+}
+
+func createDockerConfig(ctx context.Context, dockerRegistry, dockerUsername, dockerPassword, accessKey, secretKey,
+	registry, assumeRole, externalId, region string, noPush bool) (*docker.Config, error) {
+	// if no docker registry provided, use dockerhub by default
+	if len(dockerRegistry) == 0 {
+		dockerRegistry = docker.RegistryV1
+	}
+	chain := credentials.Chain{
+		credentials.Static{Registry: dockerRegistry, Username: dockerUsername, Password: dockerPassword},
+	}
+
+	if assumeRole != "" {
+		chain = append(chain, ecrToken(registry, assumeRole, externalId, region))
+	} else if !noPush || accessKey != "" {
+		// only setup auth when pushing or credentials are defined
+		if registry == "" {
+			return nil, fmt.Errorf("registry must be specified")
+		}
+
+		// If IAM role is used, access key & secret key are not required
+		if accessKey != "" && secretKey != "" {
+			err := os.Setenv(accessKeyEnv, accessKey)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("failed to set %s environment variable", accessKeyEnv))
+			}
+
+			err = os.Setenv(secretKeyEnv, secretKey)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("failed to set %s environment variable", secretKeyEnv))
+			}
+		}
+
+		if token := ecrToken(registry, assumeRole, externalId, region); token.Func != nil {
+			chain = append(chain, token)
+		} else if isKanikoVersionBelowOneDotEight(os.Getenv(kanikoVersionEnv)) {
+			// kaniko-executor >=1.8.0 does not require additional cred helper logic for ECR,
+			// as it discovers ECR repositories automatically and acts accordingly.
+			chain = append(chain, credentials.Helper{Helper: "ecr-login", Registries: []string{ecrPublicDomain, registry}})
+		}
+	}
+
+	return chain.Resolve(ctx)
+}
+
+// ecrToken returns the provider of the registry token written to the docker
+// config. It is not configured when the executor uses a credential helper,
+// which cannot assume a role or reach a custom endpoint.
+func ecrToken(registry, assumeRole, externalId, region string) credentials.Fetch {
+	switch {
+	case assumeRole != "":
+		return credentials.Fetch{Func: func(ctx context.Context) (string, string, string, error) {
+			username, password, registry, err := getAssumeRoleCreds(ctx, region, assumeRole, externalId, "")
+			return registry, username, password, err
+		}}
+	case endpoints.ECR != "" && !isRegistryPublic(registry):
+		return credentials.Fetch{Registry: registry, Func: func(ctx context.Context) (string, string, string, error) {
+			username, password, err := getEcrAuth(ctx, region)
+			return "", username, password, err
+		}}
+	}
+	return credentials.Fetch{}
+}
+
+func createRepository(ctx context.Context, region, repo, registry, assumeRole, externalId string, opts repositoryOptions) error {
+	if registry == "" {
+		return fmt.Errorf("registry must be specified")
+	}
+
+	if repo == "" {
+		return fmt.Errorf("repo must be specified")
+	}
+
+	var createErr error
+
+	if assumeRole != "" {
+		if isRegistryPublic(registry) {
+			_, createErr = getAssumeRoleEcrPublicSvc(region, assumeRole, externalId).CreateRepositoryWithContext(ctx, &ecrpublicv1.CreateRepositoryInput{RepositoryName: &repo})
+		} else {
+			_, createErr = getAssumeRoleEcrSvc(region, assumeRole, externalId).CreateRepositoryWithContext(ctx, opts.createInputV1(repo))
+		}
+	} else {
+		cfg, err := loadAWSConfig(ctx, region)
+		if err != nil {
+			return errors.Wrap(err, "failed to load aws config")
+		}
+		//create public repo
+		//if registry string starts with public domain (ex: public.ecr.aws/example-registry)
+		if isRegistryPublic(registry) {
+			svc := ecrpublic.NewFromConfig(cfg)
+			_, createErr = svc.CreateRepository(ctx, &ecrpublic.CreateRepositoryInput{RepositoryName: &repo})
+			//create private repo
+		} else {
+			svc := ecr.NewFromConfig(cfg)
+			_, createErr = svc.CreateRepository(ctx, opts.createInput(repo))
+		}
+	}
+
+	var apiError smithy.APIError
+	if errors.As(createErr, &apiError) && apiError.ErrorCode() != "RepositoryAlreadyExistsException" {
+		return errors.Wrap(createErr, "failed to create repository")
+	}
+
+	if opts.EnhancedScanning != "" && !isRegistryPublic(registry) {
+		if err := registerEnhancedScanning(ctx, region, repo, assumeRole, externalId, opts.scanFrequency()); err != nil {
+			return errors.Wrap(err, "failed to register repository for enhanced scanning")
+		}
+	}
+
+	return nil
+}
+
+// getExistingImmutableTags returns the tags that already exist in the
+// repository when tag immutability is enabled on it.
+func getExistingImmutableTags(ctx context.Context, region, repo, assumeRole, externalId string, tags []string) ([]string, error) {
+	var existing []string
+
+	if assumeRole != "" {
+		svc := getAssumeRoleEcrSvc(region, assumeRole, externalId)
+		repos, err := svc.DescribeRepositoriesWithContext(ctx, &ecrv1.DescribeRepositoriesInput{RepositoryNames: []*string{&repo}})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe repository")
+		}
+		if len(repos.Repositories) == 0 || awsv1.StringValue(repos.Repositories[0].ImageTagMutability) != ecrv1.ImageTagMutabilityImmutable {
+			return nil, nil
+		}
+		var imageIds []*ecrv1.ImageIdentifier
+		for _, tag := range tags {
+			imageIds = append(imageIds, &ecrv1.ImageIdentifier{ImageTag: awsv1.String(tag)})
+		}
+		images, err := svc.BatchGetImageWithContext(ctx, &ecrv1.BatchGetImageInput{RepositoryName: &repo, ImageIds: imageIds})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get existing images")
+		}
+		for _, image := range images.Images {
+			existing = append(existing, awsv1.StringValue(image.ImageId.ImageTag))
+		}
+	} else {
+		cfg, err := loadAWSConfig(ctx, region)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load aws config")
+		}
+
+		svc := ecr.NewFromConfig(cfg)
+		repos, err := svc.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{RepositoryNames: []string{repo}})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to describe repository")
+		}
+		if len(repos.Repositories) == 0 || repos.Repositories[0].ImageTagMutability != types.ImageTagMutabilityImmutable {
+			return nil, nil
+		}
+		var imageIds []types.ImageIdentifier
+		for _, tag := range tags {
+			imageIds = append(imageIds, types.ImageIdentifier{ImageTag: aws.String(tag)})
+		}
+		images, err := svc.BatchGetImage(ctx, &ecr.BatchGetImageInput{RepositoryName: &repo, ImageIds: imageIds})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get existing images")
+		}
+		for _, image := range images.Images {
+			existing = append(existing, aws.ToString(image.ImageId.ImageTag))
+		}
+	}
+
+	return existing, nil
+}
+
+// immutableTagCandidates returns the tags to look up in the repository: the
+// tags, and with the suffix strategy the suffixed tags they may be replaced
+// with.
+func immutableTagCandidates(strategy string, tags []string, suffix string) []string {
+	candidates := append([]string(nil), tags...)
+	if strategy == immutableTagSuffix && suffix != "" {
+		for _, tag := range tags {
+			candidates = append(candidates, fmt.Sprintf("%s-%s", tag, suffix))
+		}
+	}
+	return candidates
+}
+
+// resolveImmutableTags applies the immutable tag strategy to the tags which
+// already exist in the repository and returns the tags to push.
+func resolveImmutableTags(strategy string, tags, existing []string, suffix string) ([]string, error) {
+	exists := map[string]bool{}
+	for _, tag := range existing {
+		exists[tag] = true
+	}
+
+	var resolved, conflicts []string
+	for _, tag := range tags {
+		if !exists[tag] {
+			resolved = append(resolved, tag)
+			continue
+		}
+		conflicts = append(conflicts, tag)
+		switch strategy {
+		case immutableTagSkip:
+			fmt.Printf("Tag %s already exists in immutable repository, skipping it\n", tag)
+		case immutableTagSuffix:
+			if suffix == "" {
+				return nil, fmt.Errorf("tag %s already exists and no commit sha or build number is available to suffix it", tag)
+			}
+			suffixed := fmt.Sprintf("%s-%s", tag, suffix)
+			if exists[suffixed] {
+				return nil, fmt.Errorf("tags %s and %s already exist in immutable repository", tag, suffixed)
+			}
+			fmt.Printf("Tag %s already exists in immutable repository, using %s instead\n", tag, suffixed)
+			resolved = append(resolved, suffixed)
+		}
+	}
+
+	switch strategy {
+	case immutableTagSkip, immutableTagSuffix:
+		return resolved, nil
+	case immutableTagFail:
+		if len(conflicts) > 0 {
+			return nil, fmt.Errorf("tags %s already exist in immutable repository", strings.Join(conflicts, ", "))
+		}
+		return resolved, nil
+	default:
+		return nil, fmt.Errorf("unsupported immutable tag strategy %q, must be one of fail, skip or suffix", strategy)
+	}
+}
+
+// immutableTagSuffixFor returns the short commit sha, falling back to the build number.
+func immutableTagSuffixFor(commitSha, buildNumber string) string {
+	if len(commitSha) > 7 {
+		return commitSha[:7]
+	}
+	if commitSha != "" {
+		return commitSha
+	}
+	return buildNumber
+}
+
+func uploadLifeCyclePolicy(ctx context.Context, region, repo, lifecyclePolicy, assumeRole, externalId string) (err error) {
+	if assumeRole != "" {
+		input := &ecrv1.PutLifecyclePolicyInput{
+			LifecyclePolicyText: aws.String(lifecyclePolicy),
+			RepositoryName:      aws.String(repo),
+		}
+		_, err = getAssumeRoleEcrSvc(region, assumeRole, externalId).PutLifecyclePolicyWithContext(ctx, input)
+	} else {
+		cfg, cfgErr := loadAWSConfig(ctx, region)
+		if cfgErr != nil {
+			return errors.Wrap(cfgErr, "failed to load aws config")
+		}
+
+		svc := ecr.NewFromConfig(cfg)
+
+		input := &ecr.PutLifecyclePolicyInput{
+			LifecyclePolicyText: aws.String(lifecyclePolicy),
+			RepositoryName:      aws.String(repo),
+		}
+		_, err = svc.PutLifecyclePolicy(ctx, input)
+	}
+
+	return err
+}
+
+func uploadRepositoryPolicy(ctx context.Context, region, repo, registry, repositoryPolicy, assumeRole, externalId string) (err error) {
+	if assumeRole != "" {
+		if isRegistryPublic(registry) {
+			input := &ecrpublicv1.SetRepositoryPolicyInput{
+				PolicyText:     aws.String(repositoryPolicy),
+				RepositoryName: aws.String(repo),
+			}
+			_, err = getAssumeRoleEcrPublicSvc(region, assumeRole, externalId).SetRepositoryPolicyWithContext(ctx, input)
+		} else {
+			input := &ecrv1.SetRepositoryPolicyInput{
+				PolicyText:     aws.String(repositoryPolicy),
+				RepositoryName: aws.String(repo),
+			}
+			_, err = getAssumeRoleEcrSvc(region, assumeRole, externalId).SetRepositoryPolicyWithContext(ctx, input)
+		}
+	} else {
+		cfg, cfgErr := loadAWSConfig(ctx, region)
+		if cfgErr != nil {
+			return errors.Wrap(cfgErr, "failed to load aws config")
+		}
+
+		if isRegistryPublic(registry) {
+			svc := ecrpublic.NewFromConfig(cfg)
+			input := &ecrpublic.SetRepositoryPolicyInput{
+				PolicyText:     aws.String(repositoryPolicy),
+				RepositoryName: aws.String(repo),
+			}
+			_, err = svc.SetRepositoryPolicy(ctx, input)
+		} else {
+			svc := ecr.NewFromConfig(cfg)
+			input := &ecr.SetRepositoryPolicyInput{
+				PolicyText:     aws.String(repositoryPolicy),
+				RepositoryName: aws.String(repo),
+			}
+			_, err = svc.SetRepositoryPolicy(ctx, input)
+		}
+	}
+
+	return err
+}
+
+func getAssumeRoleCreds(ctx context.Context, region, roleArn, externalId, roleSessionName string) (string, string, string, error) {
+	sess, err := newAWSSession(region)
+	if err != nil {
+		return "", "", "", errors.Wrap(err, "failed to create aws session")
+	}
+
+	svc := ecrv1.New(sess, &awsv1.Config{
+		Endpoint: endpoints.ecrEndpoint(),
+		Credentials: stscreds.NewCredentials(endpoints.stsProvider(sess), roleArn, func(p *stscreds.AssumeRoleProvider) {
+			if externalId != "" {
+				p.ExternalID = &externalId
+			}
+		}),
+	})
+
+	username, password, registry, err := getAuthInfo(ctx, svc)
+	if err != nil {
+		return "", "", "", errors.Wrap(err, "failed to get ECR auth: no basic auth credentials")
+	}
+	return username, password, registry, nil
+}
+
+func getAuthInfo(ctx context.Context, svc *ecrv1.ECR) (username, password, registry string, err error) {
+	var result *ecrv1.GetAuthorizationTokenOutput
+	var decoded []byte
+
+	result, err = svc.GetAuthorizationTokenWithContext(ctx, &ecrv1.GetAuthorizationTokenInput{})
+	if err != nil {
+		return
+	}
+
+	auth := result.AuthorizationData[0]
+	token := *auth.AuthorizationToken
+	decoded, err = base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return
+	}
+
+	registry = strings.TrimPrefix(*auth.ProxyEndpoint, "https://")
+	creds := strings.Split(string(decoded), ":")
+	username = creds[0]
+	password = creds[1]
+	return
+}
+
+func getAssumeRoleEcrSvc(region, assumeRole, externalId string) *ecrv1.ECR {
+	sess, err := newAWSSession(region)
+	if err != nil {
+		logrus.Fatal(err, "failed to create aws session")
+	}
+
+	return ecrv1.New(sess, &awsv1.Config{
+		Endpoint: endpoints.ecrEndpoint(),
+		Credentials: stscreds.NewCredentials(endpoints.stsProvider(sess), assumeRole, func(p *stscreds.AssumeRoleProvider) {
+			if externalId != "" {
+				p.ExternalID = &externalId
+			}
+		}),
+	})
+}
+
+func getAssumeRoleEcrPublicSvc(region, assumeRole, externalId string) *ecrpublicv1.ECRPublic {
+	sess, err := newAWSSession(region)
+	if err != nil {
+		logrus.Fatal(err, "failed to create aws session")
+	}
+
+	return ecrpublicv1.New(sess, &awsv1.Config{
+		Credentials: stscreds.NewCredentials(endpoints.stsProvider(sess), assumeRole, func(p *stscreds.AssumeRoleProvider) {
+			if externalId != "" {
+				p.ExternalID = &externalId
+			}
+		}),
+	})
+}
+
+func isRegistryPublic(registry string) bool {
+	return strings.HasPrefix(registry, ecrPublicDomain)
+}
+
+func isKanikoVersionBelowOneDotEight(v string) bool {
+	currVer, err := version.NewVersion(v)
+	if err != nil {
+		return true
+	}
+	oneEightVer, err := version.NewVersion(oneDotEightVersion)
+	if err != nil {
+		return true
+	}
+
+	return currVer.LessThan(oneEightVer)
+}
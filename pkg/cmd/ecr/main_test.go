@@ -0,0 +1,421 @@
+package ecr
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+)
+
+func TestCreateDockerConfig(t *testing.T) {
+	got, err := createDockerConfig(
+		context.Background(),
+		"",
+		"docker-username",
+		"docker-password",
+		"access-key",
+		"secret-key",
+		"ecr-registry",
+		"",
+		"",
+		"",
+		false,
+	)
+	if err != nil {
+		t.Error("failed to create docker config")
+	}
+
+	want := docker.NewConfig()
+	want.SetAuth(docker.RegistryV1, "docker-username", "docker-password")
+	want.SetCredHelper(docker.RegistryECRPublic, "ecr-login")
+	want.SetCredHelper("ecr-registry", "ecr-login")
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("not equal:\n  want: %#v\n   got: %#v", want, got)
+	}
+}
+
+func TestCreateDockerConfigFromGivenRegistry(t *testing.T) {
+	got, err := createDockerConfig(
+		context.Background(),
+		"docker-registry",
+		"docker-username",
+		"docker-password",
+		"access-key",
+		"secret-key",
+		"ecr-registry",
+		"",
+		"",
+		"",
+		false,
+	)
+	if err != nil {
+		t.Error("failed to create docker config")
+	}
+
+	want := docker.NewConfig()
+	want.SetAuth("docker-registry", "docker-username", "docker-password")
+	want.SetCredHelper(docker.RegistryECRPublic, "ecr-login")
+	want.SetCredHelper("ecr-registry", "ecr-login")
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("not equal:\n  want: %#v\n   got: %#v", want, got)
+	}
+}
+
+func TestCreateDockerConfigKanikoOneDotEight(t *testing.T) {
+	os.Setenv(kanikoVersionEnv, "1.8.1")
+	defer os.Setenv(kanikoVersionEnv, "")
+	got, err := createDockerConfig(
+		context.Background(),
+		"",
+		"docker-username",
+		"docker-password",
+		"access-key",
+		"secret-key",
+		"ecr-registry",
+		"",
+		"",
+		"",
+		false,
+	)
+	if err != nil {
+		t.Error("failed to create docker config")
+	}
+
+	want := docker.NewConfig()
+	want.SetAuth(docker.RegistryV1, "docker-username", "docker-password")
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("not equal:\n  want: %#v\n   got: %#v", want, got)
+	}
+}
+
+func TestVersionComparison(t *testing.T) {
+	tests := []struct {
+		title    string
+		version  string
+		expected bool
+	}{
+		{
+			title:    "Kaniko 1.6.0 version",
+			version:  "1.6.0",
+			expected: true,
+		},
+		{
+			title:    "Kaniko 1.8.0 version",
+			version:  "1.8.0",
+			expected: false,
+		},
+		{
+			title:    "Kaniko 1.8.1 version",
+			version:  "1.8.1",
+			expected: false,
+		},
+		{
+			title:    "Empty kaniko version",
+			version:  "",
+			expected: true,
+		},
+		{
+			title:    "Kaniko version 1.10.0",
+			version:  "1.10.0",
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		got := isKanikoVersionBelowOneDotEight(test.version)
+		if got != test.expected {
+			t.Fatalf("test name: %s, expected: %v, got: %v", test.title, test.expected, got)
+		}
+	}
+}
+
+func TestResolveImmutableTags(t *testing.T) {
+	tests := []struct {
+		title    string
+		strategy string
+		existing []string
+		suffix   string
+		expected []string
+		err      bool
+	}{
+		{
+			title:    "no conflicts",
+			strategy: immutableTagFail,
+			expected: []string{"1.0.0", "latest"},
+		},
+		{
+			title:    "fail on conflict",
+			strategy: immutableTagFail,
+			existing: []string{"1.0.0"},
+			err:      true,
+		},
+		{
+			title:    "skip conflicting tag",
+			strategy: immutableTagSkip,
+			existing: []string{"1.0.0"},
+			expected: []string{"latest"},
+		},
+		{
+			title:    "suffix conflicting tag",
+			strategy: immutableTagSuffix,
+			existing: []string{"1.0.0"},
+			suffix:   "abc1234",
+			expected: []string{"1.0.0-abc1234", "latest"},
+		},
+		{
+			title:    "suffixed tag exists",
+			strategy: immutableTagSuffix,
+			existing: []string{"1.0.0", "1.0.0-abc1234"},
+			suffix:   "abc1234",
+			err:      true,
+		},
+		{
+			title:    "suffix without commit sha or build number",
+			strategy: immutableTagSuffix,
+			existing: []string{"1.0.0"},
+			err:      true,
+		},
+		{
+			title:    "unknown strategy",
+			strategy: "retry",
+			err:      true,
+		},
+	}
+	for _, test := range tests {
+		got, err := resolveImmutableTags(test.strategy, []string{"1.0.0", "latest"}, test.existing, test.suffix)
+		if (err != nil) != test.err {
+			t.Fatalf("test name: %s, unexpected error: %v", test.title, err)
+		}
+		if !reflect.DeepEqual(got, test.expected) && !test.err {
+			t.Fatalf("test name: %s, expected: %v, got: %v", test.title, test.expected, got)
+		}
+	}
+}
+
+func TestImmutableTagCandidates(t *testing.T) {
+	tags := []string{"1.0.0", "latest"}
+	if got, want := immutableTagCandidates(immutableTagSuffix, tags, "abc1234"), []string{"1.0.0", "latest", "1.0.0-abc1234", "latest-abc1234"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the suffixed tags looked up, got %v", got)
+	}
+	if got := immutableTagCandidates(immutableTagSkip, tags, "abc1234"); !reflect.DeepEqual(got, tags) {
+		t.Errorf("expected only the tags looked up, got %v", got)
+	}
+}
+
+func TestImmutableTagSuffixFor(t *testing.T) {
+	if got := immutableTagSuffixFor("abc1234def", "42"); got != "abc1234" {
+		t.Errorf("expected short commit sha, got %s", got)
+	}
+	if got := immutableTagSuffixFor("", "42"); got != "42" {
+		t.Errorf("expected build number, got %s", got)
+	}
+}
+
+func TestRepositoryOptions(t *testing.T) {
+	tests := []struct {
+		opts    repositoryOptions
+		want    types.EncryptionType
+		wantErr bool
+	}{
+		{opts: repositoryOptions{}},
+		{opts: repositoryOptions{EncryptionType: "aes256"}, want: types.EncryptionTypeAes256},
+		{opts: repositoryOptions{KmsKey: "arn:aws:kms:us-east-1:123456789012:key/abc"}, want: types.EncryptionTypeKms},
+		{opts: repositoryOptions{EncryptionType: "AES256", KmsKey: "arn"}, wantErr: true},
+		{opts: repositoryOptions{EncryptionType: "DES"}, wantErr: true},
+		{opts: repositoryOptions{EnhancedScanning: "continuous_scan"}},
+		{opts: repositoryOptions{EnhancedScanning: "manual"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		err := tc.opts.validate()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("validate(%+v) error = %v, wantErr %v", tc.opts, err, tc.wantErr)
+			continue
+		}
+		if tc.wantErr {
+			continue
+		}
+		input := tc.opts.createInput("repo")
+		switch {
+		case tc.want == "" && input.EncryptionConfiguration != nil:
+			t.Errorf("expected the default encryption, got %+v", input.EncryptionConfiguration)
+		case tc.want != "" && (input.EncryptionConfiguration == nil || input.EncryptionConfiguration.EncryptionType != tc.want):
+			t.Errorf("expected encryption %s, got %+v", tc.want, input.EncryptionConfiguration)
+		}
+		if v1 := tc.opts.createInputV1("repo"); (v1.EncryptionConfiguration == nil) != (input.EncryptionConfiguration == nil) {
+			t.Errorf("expected the v1 and v2 inputs to match, got %+v", v1)
+		}
+	}
+
+	input := repositoryOptions{ScanOnPush: true}.createInput("repo")
+	if input.ImageScanningConfiguration == nil || !input.ImageScanningConfiguration.ScanOnPush {
+		t.Errorf("expected scan on push, got %+v", input.ImageScanningConfiguration)
+	}
+}
+
+func TestWithScanningRule(t *testing.T) {
+	rules := []types.RegistryScanningRule{{
+		ScanFrequency:     types.ScanFrequencyContinuousScan,
+		RepositoryFilters: []types.ScanningRepositoryFilter{{Filter: aws.String("prod/*"), FilterType: types.ScanningRepositoryFilterTypeWildcard}},
+	}}
+
+	rules, changed := withScanningRule(rules, "app", types.ScanFrequencyContinuousScan)
+	if !changed || len(rules) != 1 || len(rules[0].RepositoryFilters) != 2 {
+		t.Errorf("expected the repository added to the existing rule, got %+v", rules)
+	}
+	if _, changed := withScanningRule(rules, "app", types.ScanFrequencyContinuousScan); changed {
+		t.Errorf("expected no change for a registered repository")
+	}
+	rules, changed = withScanningRule(rules, "app", types.ScanFrequencyScanOnPush)
+	if !changed || len(rules) != 2 || rules[1].ScanFrequency != types.ScanFrequencyScanOnPush {
+		t.Errorf("expected a new scan on push rule, got %+v", rules)
+	}
+}
+
+func TestAWSEndpoints(t *testing.T) {
+	for _, e := range []awsEndpoints{
+		{ECR: "http://ecr.local"},
+		{STS: "vpce-123.sts.us-east-1.vpce.amazonaws.com"},
+	} {
+		if err := e.validate(); err == nil {
+			t.Errorf("expected an error for %+v", e)
+		}
+	}
+
+	e := awsEndpoints{ECR: "https://vpce-123-abc.api.ecr.us-east-1.vpce.amazonaws.com"}
+	if err := e.validate(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.resolve(ecrServiceID, "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.URL != e.ECR || got.SigningRegion != "us-east-1" {
+		t.Errorf("unexpected endpoint %+v", got)
+	}
+	if _, err := e.resolve(stsServiceID, "us-east-1"); err == nil {
+		t.Errorf("expected the default sts endpoint")
+	}
+	if e.ecrEndpoint() == nil || (awsEndpoints{}).ecrEndpoint() != nil {
+		t.Errorf("unexpected v1 ecr endpoint")
+	}
+}
+
+func TestPartition(t *testing.T) {
+	tests := []struct {
+		region, registry, role string
+		partition, want        string
+		wantErr                bool
+	}{
+		{region: "us-east-1", registry: "123456789012", partition: "aws", want: "123456789012.dkr.ecr.us-east-1.amazonaws.com"},
+		{region: "cn-north-1", registry: "123456789012", partition: "aws-cn", want: "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn"},
+		{region: "us-gov-west-1", registry: "123456789012.dkr.ecr.us-gov-west-1.amazonaws.com", role: "arn:aws-us-gov:iam::123456789012:role/ci", partition: "aws-us-gov", want: "123456789012.dkr.ecr.us-gov-west-1.amazonaws.com"},
+		{region: "cn-north-1", registry: "123456789012.dkr.ecr.us-east-1.amazonaws.com", partition: "aws-cn", wantErr: true},
+		{region: "cn-north-1", registry: "public.ecr.aws/example", partition: "aws-cn", wantErr: true},
+		{region: "us-gov-east-1", registry: "123456789012", role: "arn:aws:iam::123456789012:role/ci", partition: "aws-us-gov", wantErr: true},
+	}
+	for _, tc := range tests {
+		p, err := partitionFor(tc.region)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ID != tc.partition {
+			t.Errorf("expected partition %s for %s, got %s", tc.partition, tc.region, p.ID)
+		}
+		got, err := p.resolveRegistry(tc.registry, tc.region)
+		if err == nil {
+			err = p.checkRoleArn(tc.role)
+		}
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s in %s: error = %v, wantErr %v", tc.registry, tc.region, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && got != tc.want {
+			t.Errorf("expected registry %s, got %s", tc.want, got)
+		}
+	}
+
+	if got := registryRegion("123456789012.dkr.ecr.cn-northwest-1.amazonaws.com.cn"); got != "cn-northwest-1" {
+		t.Errorf("expected region cn-northwest-1, got %q", got)
+	}
+	if got := registryRegion("public.ecr.aws"); got != "" {
+		t.Errorf("expected no region, got %q", got)
+	}
+}
+
+func TestRegistryAccount(t *testing.T) {
+	if got := roleAccount("arn:aws:iam::123456789012:role/ci"); got != "123456789012" {
+		t.Errorf("expected role account 123456789012, got %q", got)
+	}
+	for _, arn := range []string{"", "ci", "arn:aws:iam::example:role/ci"} {
+		if got := roleAccount(arn); got != "" {
+			t.Errorf("expected no account for %q, got %q", arn, got)
+		}
+	}
+
+	registry := "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	if got := registryAccount(registry); got != "123456789012" {
+		t.Errorf("expected registry account 123456789012, got %q", got)
+	}
+	if err := checkRegistryAccount(registry, "123456789012"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := checkRegistryAccount(registry, "210987654321"); err == nil {
+		t.Errorf("expected error for a registry of another account")
+	}
+	if err := checkRegistryAccount("public.ecr.aws/example", "210987654321"); err != nil {
+		t.Errorf("unexpected error for a public registry: %v", err)
+	}
+}
+
+func TestRenderPolicy(t *testing.T) {
+	data := policyData{Repository: "team/app", Registry: "123456789012.dkr.ecr.eu-west-1.amazonaws.com", Account: "123456789012", Region: "eu-west-1"}
+	inline := `{"Version": "2012-10-17", "Statement": [{"Sid": "{{ .Repository }}-pull", "Principal": {"AWS": "arn:aws:iam::210987654321:root"}}]}`
+	got, err := renderPolicy(inline, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Version": "2012-10-17", "Statement": [{"Sid": "team/app-pull", "Principal": {"AWS": "arn:aws:iam::210987654321:root"}}]}`; got != want {
+		t.Errorf("expected policy %s, got %s", want, got)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := ioutil.WriteFile(path, []byte(`{"Condition": {"StringEquals": {"aws:SourceAccount": "{{ .Account }}"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := renderPolicy(path, data); err != nil || got != `{"Condition": {"StringEquals": {"aws:SourceAccount": "123456789012"}}}` {
+		t.Errorf("unexpected policy %s: %v", got, err)
+	}
+
+	for _, policy := range []string{`{"Sid": "{{ .Missing }}"}`, `{"Sid": {{ .Repository }}}`, filepath.Join(t.TempDir(), "missing.json")} {
+		if _, err := renderPolicy(policy, data); err == nil {
+			t.Errorf("expected error for policy %s", policy)
+		}
+	}
+}
+
+func TestPolicyChanged(t *testing.T) {
+	desired := `{"Version": "2012-10-17", "Statement": [{"Sid": "pull", "Effect": "Allow"}]}`
+	tests := []struct {
+		current string
+		want    bool
+	}{
+		{current: "", want: true},
+		{current: desired, want: false},
+		// ECR returns the policy reformatted
+		{current: "{\n  \"Statement\" : [ {\n    \"Effect\" : \"Allow\",\n    \"Sid\" : \"pull\"\n  } ],\n  \"Version\" : \"2012-10-17\"\n}", want: false},
+		{current: `{"Version": "2012-10-17", "Statement": [{"Sid": "pull", "Effect": "Deny"}]}`, want: true},
+	}
+	for _, test := range tests {
+		if got := policyChanged(test.current, desired); got != test.want {
+			t.Errorf("expected changed %v for current policy %s, got %v", test.want, test.current, got)
+		}
+	}
+}
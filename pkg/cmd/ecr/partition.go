@@ -0,0 +1,67 @@
+package ecr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	endpointsv1 "github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// awsPartition identifies the AWS partition (aws, aws-cn or aws-us-gov)
+// of a region, which determines the DNS suffix of the registry hosts and
+// the partition of the IAM role ARNs.
+type awsPartition struct {
+	ID        string
+	DNSSuffix string
+}
+
+var (
+	accountIDPattern   = regexp.MustCompile(`^\d{12}$`)
+	ecrRegistryPattern = regexp.MustCompile(`^\d{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+)
+
+// partitionFor returns the partition of the region.
+func partitionFor(region string) (awsPartition, error) {
+	p, ok := endpointsv1.PartitionForRegion(endpointsv1.DefaultPartitions(), region)
+	if !ok {
+		return awsPartition{}, fmt.Errorf("unknown aws region %q", region)
+	}
+	return awsPartition{ID: p.ID(), DNSSuffix: p.DNSSuffix()}, nil
+}
+
+// registryRegion returns the region of a private ECR registry host, or an
+// empty string when the registry is not a private ECR registry.
+func registryRegion(registry string) string {
+	if m := ecrRegistryPattern.FindStringSubmatch(registry); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// resolveRegistry expands a bare account id to the private registry host
+// of the region and checks that the registry belongs to the partition.
+func (p awsPartition) resolveRegistry(registry, region string) (string, error) {
+	switch {
+	case accountIDPattern.MatchString(registry):
+		return fmt.Sprintf("%s.dkr.ecr.%s.%s", registry, region, p.DNSSuffix), nil
+	case isRegistryPublic(registry) && p.ID != endpointsv1.AwsPartitionID:
+		return "", fmt.Errorf("ECR Public is not available in the %s partition", p.ID)
+	case registryRegion(registry) != "" && !strings.HasSuffix(registry, "."+p.DNSSuffix):
+		return "", fmt.Errorf("registry %s is not in the %s partition of region %s", registry, p.ID, region)
+	}
+	return registry, nil
+}
+
+// checkRoleArn returns an error when the role ARN belongs to a different
+// partition, which STS rejects with a less helpful error.
+func (p awsPartition) checkRoleArn(arn string) error {
+	parts := strings.SplitN(arn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" {
+		return nil
+	}
+	if parts[1] != p.ID {
+		return fmt.Errorf("role %s is not in the %s partition", arn, p.ID)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package ecr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"github.com/aws/aws-sdk-go-v2/service/ecrpublic"
+	awsv1 "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	ecrv1 "github.com/aws/aws-sdk-go/service/ecr"
+	ecrpublicv1 "github.com/aws/aws-sdk-go/service/ecrpublic"
+	"github.com/aws/smithy-go"
+	"github.com/pkg/errors"
+)
+
+// repositoryOptions configures repositories created by the plugin, so they
+// comply with the organisation policy without a separate provisioning step.
+type repositoryOptions struct {
+	EncryptionType   string // AES256 or KMS, defaults to the ECR default AES256
+	KmsKey           string // KMS key ARN, implies KMS encryption
+	ScanOnPush       bool   // Basic scanning of pushed images
+	EnhancedScanning string // Enhanced scanning frequency, scan_on_push or continuous_scan
+}
+
+// validate checks the options and defaults the encryption type to KMS when
+// a key is set.
+func (o *repositoryOptions) validate() error {
+	o.EncryptionType = strings.ToUpper(o.EncryptionType)
+	if o.EncryptionType == "" && o.KmsKey != "" {
+		o.EncryptionType = string(types.EncryptionTypeKms)
+	}
+	switch types.EncryptionType(o.EncryptionType) {
+	case "", types.EncryptionTypeAes256:
+		if o.KmsKey != "" {
+			return fmt.Errorf("kms key requires the KMS encryption type")
+		}
+	case types.EncryptionTypeKms:
+	default:
+		return fmt.Errorf("unsupported encryption type %q, must be AES256 or KMS", o.EncryptionType)
+	}
+	switch o.scanFrequency() {
+	case "", types.ScanFrequencyScanOnPush, types.ScanFrequencyContinuousScan:
+	default:
+		return fmt.Errorf("unsupported enhanced scanning frequency %q, must be scan_on_push or continuous_scan", o.EnhancedScanning)
+	}
+	return nil
+}
+
+// scanFrequency returns the enhanced scanning frequency.
+func (o repositoryOptions) scanFrequency() types.ScanFrequency {
+	return types.ScanFrequency(strings.ToUpper(o.EnhancedScanning))
+}
+
+// isSet returns true when any option is set, as they only apply to private
+// repositories.
+func (o repositoryOptions) isSet() bool {
+	return o.EncryptionType != "" || o.ScanOnPush || o.EnhancedScanning != ""
+}
+
+// createInput returns the input creating a private repository.
+func (o repositoryOptions) createInput(repo string) *ecr.CreateRepositoryInput {
+	input := &ecr.CreateRepositoryInput{RepositoryName: &repo}
+	if o.EncryptionType != "" {
+		input.EncryptionConfiguration = &types.EncryptionConfiguration{EncryptionType: types.EncryptionType(o.EncryptionType)}
+		if o.KmsKey != "" {
+			input.EncryptionConfiguration.KmsKey = aws.String(o.KmsKey)
+		}
+	}
+	if o.ScanOnPush {
+		input.ImageScanningConfiguration = &types.ImageScanningConfiguration{ScanOnPush: true}
+	}
+	return input
+}
+
+// createInputV1 returns the input creating a private repository with the v1 sdk.
+func (o repositoryOptions) createInputV1(repo string) *ecrv1.CreateRepositoryInput {
+	input := &ecrv1.CreateRepositoryInput{RepositoryName: &repo}
+	if o.EncryptionType != "" {
+		input.EncryptionConfiguration = &ecrv1.EncryptionConfiguration{EncryptionType: awsv1.String(o.EncryptionType)}
+		if o.KmsKey != "" {
+			input.EncryptionConfiguration.KmsKey = awsv1.String(o.KmsKey)
+		}
+	}
+	if o.ScanOnPush {
+		input.ImageScanningConfiguration = &ecrv1.ImageScanningConfiguration{ScanOnPush: awsv1.Bool(true)}
+	}
+	return input
+}
+
+// withScanningRule adds a rule scanning the repository at the frequency to
+// the registry scanning rules. It returns false when a rule of the frequency
+// already matches the repository exactly.
+func withScanningRule(rules []types.RegistryScanningRule, repo string, frequency types.ScanFrequency) ([]types.RegistryScanningRule, bool) {
+	for i, rule := range rules {
+		if rule.ScanFrequency != frequency {
+			continue
+		}
+		for _, filter := range rule.RepositoryFilters {
+			if aws.ToString(filter.Filter) == repo || aws.ToString(filter.Filter) == "*" {
+				return rules, false
+			}
+		}
+		rules[i].RepositoryFilters = append(rule.RepositoryFilters, types.ScanningRepositoryFilter{
+			Filter:     aws.String(repo),
+			FilterType: types.ScanningRepositoryFilterTypeWildcard,
+		})
+		return rules, true
+	}
+	return append(rules, types.RegistryScanningRule{
+		ScanFrequency: frequency,
+		RepositoryFilters: []types.ScanningRepositoryFilter{{
+			Filter:     aws.String(repo),
+			FilterType: types.ScanningRepositoryFilterTypeWildcard,
+		}},
+	}), true
+}
+
+// registerEnhancedScanning adds the repository to the enhanced scanning
+// rules of the registry. The registry scan type is left unchanged, as it
+// applies to every repository.
+func registerEnhancedScanning(ctx context.Context, region, repo, assumeRole, externalId string, frequency types.ScanFrequency) error {
+	if assumeRole != "" {
+		svc := getAssumeRoleEcrSvc(region, assumeRole, externalId)
+		current, err := svc.GetRegistryScanningConfigurationWithContext(ctx, &ecrv1.GetRegistryScanningConfigurationInput{})
+		if err != nil {
+			return errors.Wrap(err, "failed to get registry scanning configuration")
+		}
+		if current.ScanningConfiguration == nil || awsv1.StringValue(current.ScanningConfiguration.ScanType) != ecrv1.ScanTypeEnhanced {
+			return fmt.Errorf("the registry does not use enhanced scanning")
+		}
+		var rules []types.RegistryScanningRule
+		for _, rule := range current.ScanningConfiguration.Rules {
+			converted := types.RegistryScanningRule{ScanFrequency: types.ScanFrequency(awsv1.StringValue(rule.ScanFrequency))}
+			for _, filter := range rule.RepositoryFilters {
+				converted.RepositoryFilters = append(converted.RepositoryFilters, types.ScanningRepositoryFilter{
+					Filter:     filter.Filter,
+					FilterType: types.ScanningRepositoryFilterType(awsv1.StringValue(filter.FilterType)),
+				})
+			}
+			rules = append(rules, converted)
+		}
+		rules, changed := withScanningRule(rules, repo, frequency)
+		if !changed {
+			return nil
+		}
+		input := &ecrv1.PutRegistryScanningConfigurationInput{ScanType: awsv1.String(ecrv1.ScanTypeEnhanced)}
+		for _, rule := range rules {
+			converted := &ecrv1.RegistryScanningRule{ScanFrequency: awsv1.String(string(rule.ScanFrequency))}
+			for _, filter := range rule.RepositoryFilters {
+				converted.RepositoryFilters = append(converted.RepositoryFilters, &ecrv1.ScanningRepositoryFilter{
+					Filter:     filter.Filter,
+					FilterType: awsv1.String(string(filter.FilterType)),
+				})
+			}
+			input.Rules = append(input.Rules, converted)
+		}
+		_, err = svc.PutRegistryScanningConfigurationWithContext(ctx, input)
+		return errors.Wrap(err, "failed to update registry scanning configuration")
+	}
+
+	cfg, err := loadAWSConfig(ctx, region)
+	if err != nil {
+		return errors.Wrap(err, "failed to load aws config")
+	}
+	svc := ecr.NewFromConfig(cfg)
+	current, err := svc.GetRegistryScanningConfiguration(ctx, &ecr.GetRegistryScanningConfigurationInput{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get registry scanning configuration")
+	}
+	if current.ScanningConfiguration == nil || current.ScanningConfiguration.ScanType != types.ScanTypeEnhanced {
+		return fmt.Errorf("the registry does not use enhanced scanning")
+	}
+	rules, changed := withScanningRule(current.ScanningConfiguration.Rules, repo, frequency)
+	if !changed {
+		return nil
+	}
+	_, err = svc.PutRegistryScanningConfiguration(ctx, &ecr.PutRegistryScanningConfigurationInput{
+		ScanType: types.ScanTypeEnhanced,
+		Rules:    rules,
+	})
+	return errors.Wrap(err, "failed to update registry scanning configuration")
+}
+
+// policyData is the data of repository policy templates.
+type policyData struct {
+	Repository string // Repository name
+	Registry   string // Registry host
+	Account    string // Account id of a private registry
+	Region     string // AWS region
+}
+
+// renderPolicy renders the repository policy template, given as inline JSON
+// or the path of a file, and checks the result is a JSON document.
+func renderPolicy(policy string, data policyData) (string, error) {
+	text := policy
+	if !strings.HasPrefix(strings.TrimSpace(policy), "{") {
+		content, err := ioutil.ReadFile(policy)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read repository policy template")
+		}
+		text = string(content)
+	}
+	tmpl, err := template.New("policy").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse repository policy template")
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", errors.Wrap(err, "failed to render repository policy template")
+	}
+	if !json.Valid(rendered.Bytes()) {
+		return "", fmt.Errorf("repository policy template does not render a JSON document")
+	}
+	return rendered.String(), nil
+}
+
+// policyChanged returns true when the desired policy differs from the
+// current one. Both are compared as decoded JSON, as ECR returns the policy
+// reformatted.
+func policyChanged(current, desired string) bool {
+	if current == "" {
+		return true
+	}
+	var a, b interface{}
+	if json.Unmarshal([]byte(current), &a) != nil || json.Unmarshal([]byte(desired), &b) != nil {
+		return current != desired
+	}
+	return !reflect.DeepEqual(a, b)
+}
+
+// getRepositoryPolicy returns the policy of the repository, or an empty
+// string when it has none.
+func getRepositoryPolicy(ctx context.Context, region, repo, registry, assumeRole, externalId string) (string, error) {
+	var text *string
+	var err error
+	if assumeRole != "" {
+		if isRegistryPublic(registry) {
+			var out *ecrpublicv1.GetRepositoryPolicyOutput
+			if out, err = getAssumeRoleEcrPublicSvc(region, assumeRole, externalId).GetRepositoryPolicyWithContext(ctx, &ecrpublicv1.GetRepositoryPolicyInput{RepositoryName: &repo}); err == nil {
+				text = out.PolicyText
+			}
+		} else {
+			var out *ecrv1.GetRepositoryPolicyOutput
+			if out, err = getAssumeRoleEcrSvc(region, assumeRole, externalId).GetRepositoryPolicyWithContext(ctx, &ecrv1.GetRepositoryPolicyInput{RepositoryName: &repo}); err == nil {
+				text = out.PolicyText
+			}
+		}
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == "RepositoryPolicyNotFoundException" {
+			return "", nil
+		}
+	} else {
+		cfg, cfgErr := loadAWSConfig(ctx, region)
+		if cfgErr != nil {
+			return "", errors.Wrap(cfgErr, "failed to load aws config")
+		}
+		if isRegistryPublic(registry) {
+			var out *ecrpublic.GetRepositoryPolicyOutput
+			if out, err = ecrpublic.NewFromConfig(cfg).GetRepositoryPolicy(ctx, &ecrpublic.GetRepositoryPolicyInput{RepositoryName: &repo}); err == nil {
+				text = out.PolicyText
+			}
+		} else {
+			var out *ecr.GetRepositoryPolicyOutput
+			if out, err = ecr.NewFromConfig(cfg).GetRepositoryPolicy(ctx, &ecr.GetRepositoryPolicyInput{RepositoryName: &repo}); err == nil {
+				text = out.PolicyText
+			}
+		}
+		var apiError smithy.APIError
+		if errors.As(err, &apiError) && apiError.ErrorCode() == "RepositoryPolicyNotFoundException" {
+			return "", nil
+		}
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get repository policy")
+	}
+	return aws.ToString(text), nil
+}
@@ -0,0 +1,284 @@
+package gar
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	kaniko "github.com/drone/drone-kaniko"
+	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/buildinfo"
+	"github.com/drone/drone-kaniko/pkg/credentials"
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/drone/drone-kaniko/pkg/flags"
+	"github.com/drone/drone-kaniko/pkg/gcp"
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+const (
+	garEnvVariable string = "GOOGLE_APPLICATION_CREDENTIALS"
+)
+
+var (
+	// GAR JSON key file path
+	garKeyPath = filepath.Join(sysinfo.KanikoDir, "config.json")
+
+	defaultDockerPath = filepath.Join(sysinfo.KanikoDir, ".docker")
+	defaultDigestFile = filepath.Join(sysinfo.KanikoDir, "digest-file")
+)
+
+// Main runs the gar plugin with the process arguments.
+func Main() {
+	// Load env-file if it exists first
+	if env := os.Getenv("PLUGIN_ENV_FILE"); env != "" {
+		if err := godotenv.Load(env); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	if err := App().Run(os.Args); err != nil {
+		logrus.Error(err)
+		os.Exit(failure.ExitCode(err))
+	}
+}
+
+// App returns the gar plugin application.
+func App() *cli.App {
+	app := cli.NewApp()
+	app.Name = "kaniko gar plugin"
+	app.Usage = "kaniko gar plugin"
+	app.Action = run
+	app.Version, _ = buildinfo.Plugin()
+	app.Flags = append([]cli.Flag{
+		cli.StringFlag{
+			Name:   "repo",
+			Usage:  "gar repository",
+			EnvVar: "PLUGIN_REPO",
+		},
+		cli.StringFlag{
+			Name:   "registry",
+			Usage:  "gar registry",
+			EnvVar: "PLUGIN_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   "json-key",
+			Usage:  "docker username",
+			EnvVar: "PLUGIN_JSON_KEY",
+		},
+		cli.StringFlag{
+			Name:   "impersonate-service-account",
+			Usage:  "service account to impersonate with the json key or ambient credentials",
+			EnvVar: "PLUGIN_IMPERSONATE_SERVICE_ACCOUNT",
+		},
+		cli.BoolFlag{
+			Name:   "create-repository",
+			Usage:  "create the Artifact Registry repository if it does not exist",
+			EnvVar: "PLUGIN_CREATE_REPOSITORY",
+		},
+		cli.StringSliceFlag{
+			Name:   "repository-labels",
+			Usage:  "k=v labels of created repositories",
+			EnvVar: "PLUGIN_REPOSITORY_LABELS",
+		},
+		cli.StringFlag{
+			Name:   "kms-key",
+			Usage:  "Cloud KMS key encrypting created repositories",
+			EnvVar: "PLUGIN_KMS_KEY",
+		},
+		cli.BoolFlag{
+			Name:   "skip-iam-check",
+			Usage:  "skip checking that the credentials may push to the repository before building",
+			EnvVar: "PLUGIN_SKIP_IAM_CHECK",
+		},
+		cli.StringFlag{
+			Name:   "cache-repo",
+			Usage:  "Remote repository that will be used to store cached layers. Cache repo should be present in specified registry. enable-cache needs to be set to use this flag",
+			EnvVar: "PLUGIN_CACHE_REPO",
+		},
+	}, flags.Common()...)
+	return app
+}
+
+func run(c *cli.Context) error {
+	// stop the build when the step is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	flags.Logging(c)
+	if err := flags.ResolveSecrets(ctx, c); err != nil {
+		return err
+	}
+
+	scratch, err := flags.ScratchDir(c)
+	if scratch != "" {
+		defer os.RemoveAll(scratch)
+	}
+	if err != nil {
+		return err
+	}
+	if err := flags.DockerConfigSecret(ctx, c); err != nil {
+		return err
+	}
+	garKeyPath = filepath.Join(scratch, "config.json")
+
+	caCert, err := kaniko.InstallCACert(c.String("ca-cert"), c.String("ca-cert-path"), c.String("kaniko-dir"))
+	if err != nil {
+		return err
+	}
+
+	if err := os.Setenv("DOCKER_CONFIG", c.String("docker-config-dir")); err != nil {
+		return errors.Wrap(err, "failed to set DOCKER_CONFIG")
+	}
+
+	noPush := c.Bool("no-push")
+	jsonKey := c.String("json-key")
+
+	// JSON key may not be set in the following cases:
+	// 1. Image does not need to be pushed to GAR.
+	// 2. Workload identity is set on GKE in which pod will inherit the credentials via service account.
+	if serviceAccount := c.String("impersonate-service-account"); serviceAccount != "" {
+		if err := setupImpersonatedAuth(ctx, jsonKey, serviceAccount, c.String("registry"), c.String("docker-config-dir")); err != nil {
+			return err
+		}
+	} else if jsonKey != "" {
+		if err := setupGARAuth(jsonKey); err != nil {
+			return err
+		}
+	}
+
+	image := fmt.Sprintf("%s/%s", c.String("registry"), c.String("repo"))
+	if !noPush {
+		if _, err := gcp.ParseRepository(image); err != nil {
+			return err
+		}
+	}
+
+	// only create repository when pushing and create-repository is true
+	if !noPush && c.Bool("create-repository") {
+		if err := createRepository(ctx, jsonKey, c.String("impersonate-service-account"), image, c.StringSlice("repository-labels"), c.String("kms-key")); err != nil {
+			return err
+		}
+	}
+
+	if !noPush && !c.Bool("skip-iam-check") && !c.Bool("offline") {
+		if err := checkUpload(ctx, jsonKey, c.String("impersonate-service-account"), image); err != nil {
+			return err
+		}
+	}
+
+	build := flags.Build(c)
+	build.CACert = caCert
+	build.ScratchDir = scratch
+	build.Repo = fmt.Sprintf("%s/%s", c.String("registry"), c.String("repo"))
+	build.CacheRepo = flags.CacheRepo(c, c.String("registry"))
+
+	plugin := kaniko.Plugin{
+		Build: build,
+		Artifact: kaniko.Artifact{
+			Tags:         c.StringSlice("tags"),
+			Repo:         c.String("repo"),
+			Registry:     c.String("registry"),
+			ArtifactFile: c.String("artifact-file"),
+			Schema:       c.String("artifact-schema"),
+			RegistryType: artifact.GAR,
+		},
+		Output:  flags.Output(c),
+		Backend: flags.Backend(c),
+		GitOps:  flags.GitOps(c),
+		Status:  flags.Status(c),
+	}
+	return plugin.Exec(ctx)
+}
+
+func setupGARAuth(jsonKey string) error {
+	err := ioutil.WriteFile(garKeyPath, []byte(jsonKey), 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write GAR JSON key")
+	}
+
+	err = os.Setenv(garEnvVariable, garKeyPath)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to set %s environment variable", garEnvVariable))
+	}
+	return nil
+}
+
+// setupImpersonatedAuth writes a docker config with an access token for the
+// impersonated service account, minted with the JSON key if set and the
+// application default credentials otherwise. The key itself is not passed
+// to the executor.
+func setupImpersonatedAuth(ctx context.Context, jsonKey, serviceAccount, registry, dockerConfigDir string) error {
+	if registry == "" {
+		return fmt.Errorf("registry must be specified")
+	}
+	auth := credentials.Chain{credentials.GCP{
+		Registry: "https://" + strings.SplitN(registry, "/", 2)[0],
+		Tokens: gcp.Impersonator{
+			Base:           gcp.Credentials{JSON: []byte(jsonKey)},
+			ServiceAccount: serviceAccount,
+		},
+	}}
+	err := auth.Write(ctx, filepath.Join(dockerConfigDir, "config.json"), docker.MergeStrategyMerge)
+	return errors.Wrap(err, "failed to impersonate service account")
+}
+
+// createRepository creates the Artifact Registry repository of the image
+// unless it exists, using the same credentials as the push.
+func createRepository(ctx context.Context, jsonKey, serviceAccount, image string, labels []string, kmsKey string) error {
+	repo, err := gcp.ParseRepository(image)
+	if err != nil {
+		return err
+	}
+	repo.KMSKey = kmsKey
+	repo.Labels = map[string]string{}
+	for _, label := range labels {
+		k, v, ok := strings.Cut(label, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid repository label %q, expected k=v", label)
+		}
+		repo.Labels[k] = v
+	}
+
+	tokens := gcp.NewTokenSource([]byte(jsonKey), serviceAccount)
+	created, err := gcp.ArtifactRegistry{Tokens: tokens}.EnsureRepository(ctx, repo)
+	if err != nil {
+		return errors.Wrap(err, "failed to create Artifact Registry repository")
+	}
+	if created {
+		fmt.Printf("Created Artifact Registry repository %s in %s\n", repo.Name, repo.Location)
+	}
+	return nil
+}
+
+// checkUpload fails early when the credentials may not push to the
+// Artifact Registry repository of the image, or it does not exist. The
+// build continues when the check itself fails.
+func checkUpload(ctx context.Context, jsonKey, serviceAccount, image string) error {
+	repo, err := gcp.ParseRepository(image)
+	if err != nil {
+		return err
+	}
+	err = gcp.ArtifactRegistry{Tokens: gcp.NewTokenSource([]byte(jsonKey), serviceAccount)}.CheckUpload(ctx, repo)
+	var denied *gcp.PermissionError
+	switch {
+	case err == nil:
+	case errors.As(err, &denied):
+		return err
+	case errors.Is(err, gcp.ErrNotFound):
+		return fmt.Errorf("repository %s does not exist in Artifact Registry project %s, location %s, set create_repository to create it", repo.Name, repo.Project, repo.Location)
+	default:
+		fmt.Fprintf(os.Stderr, "failed to check the push permission on %s, building anyway: %s\n", image, err)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package gcr
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	kaniko "github.com/drone/drone-kaniko"
+	"github.com/drone/drone-kaniko/pkg/artifact"
+	"github.com/drone/drone-kaniko/pkg/buildinfo"
+	"github.com/drone/drone-kaniko/pkg/credentials"
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/drone/drone-kaniko/pkg/flags"
+	"github.com/drone/drone-kaniko/pkg/gcp"
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+const (
+	gcrEnvVariable string = "GOOGLE_APPLICATION_CREDENTIALS"
+)
+
+var (
+	// GCR JSON key file path
+	gcrKeyPath = filepath.Join(sysinfo.KanikoDir, "config.json")
+
+	defaultDockerPath = filepath.Join(sysinfo.KanikoDir, ".docker")
+	defaultDigestFile = filepath.Join(sysinfo.KanikoDir, "digest-file")
+)
+
+// Main runs the gcr plugin with the process arguments.
+func Main() {
+	// Load env-file if it exists first
+	if env := os.Getenv("PLUGIN_ENV_FILE"); env != "" {
+		if err := godotenv.Load(env); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	if err := App().Run(os.Args); err != nil {
+		logrus.Error(err)
+		os.Exit(failure.ExitCode(err))
+	}
+}
+
+// App returns the gcr plugin application.
+func App() *cli.App {
+	app := cli.NewApp()
+	app.Name = "kaniko gcr plugin"
+	app.Usage = "kaniko gcr plugin"
+	app.Action = run
+	app.Version, _ = buildinfo.Plugin()
+	app.Flags = append([]cli.Flag{
+		cli.StringFlag{
+			Name:   "repo",
+			Usage:  "gcr repository",
+			EnvVar: "PLUGIN_REPO",
+		},
+		cli.StringFlag{
+			Name:   "registry",
+			Usage:  "gcr registry",
+			Value:  "gcr.io",
+			EnvVar: "PLUGIN_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   "json-key",
+			Usage:  "docker username",
+			EnvVar: "PLUGIN_JSON_KEY",
+		},
+		cli.StringFlag{
+			Name:   "impersonate-service-account",
+			Usage:  "service account to impersonate with the json key or ambient credentials",
+			EnvVar: "PLUGIN_IMPERSONATE_SERVICE_ACCOUNT",
+		},
+		cli.BoolFlag{
+			Name:   "skip-iam-check",
+			Usage:  "skip checking that the credentials may push to the repository before building",
+			EnvVar: "PLUGIN_SKIP_IAM_CHECK",
+		},
+		cli.StringFlag{
+			Name:   "cache-repo",
+			Usage:  "Remote repository that will be used to store cached layers. Cache repo should be present in specified registry. enable-cache needs to be set to use this flag",
+			EnvVar: "PLUGIN_CACHE_REPO",
+		},
+	}, flags.Common()...)
+	return app
+}
+
+func run(c *cli.Context) error {
+	// stop the build when the step is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	flags.Logging(c)
+	if err := flags.ResolveSecrets(ctx, c); err != nil {
+		return err
+	}
+
+	scratch, err := flags.ScratchDir(c)
+	if scratch != "" {
+		defer os.RemoveAll(scratch)
+	}
+	if err != nil {
+		return err
+	}
+	if err := flags.DockerConfigSecret(ctx, c); err != nil {
+		return err
+	}
+	gcrKeyPath = filepath.Join(scratch, "config.json")
+
+	caCert, err := kaniko.InstallCACert(c.String("ca-cert"), c.String("ca-cert-path"), c.String("kaniko-dir"))
+	if err != nil {
+		return err
+	}
+
+	if err := os.Setenv("DOCKER_CONFIG", c.String("docker-config-dir")); err != nil {
+		return errors.Wrap(err, "failed to set DOCKER_CONFIG")
+	}
+
+	noPush := c.Bool("no-push")
+	jsonKey := c.String("json-key")
+	image := fmt.Sprintf("%s/%s", c.String("registry"), c.String("repo"))
+	repo, err := parseRepository(image)
+	if err != nil && !noPush {
+		return err
+	}
+
+	// JSON key may not be set in the following cases:
+	// 1. Image does not need to be pushed to GCR.
+	// 2. Workload identity is set on GKE in which pod will inherit the credentials via service account.
+	if serviceAccount := c.String("impersonate-service-account"); serviceAccount != "" {
+		if err := setupImpersonatedAuth(ctx, jsonKey, serviceAccount, c.String("registry"), c.String("docker-config-dir")); err != nil {
+			return err
+		}
+	} else if jsonKey != "" {
+		if err := setupGCRAuth(jsonKey); err != nil {
+			return err
+		}
+	}
+
+	if !noPush && !c.Bool("skip-iam-check") && !c.Bool("offline") {
+		if err := checkUpload(ctx, jsonKey, c.String("impersonate-service-account"), repo); err != nil {
+			return err
+		}
+	}
+
+	build := flags.Build(c)
+	build.CACert = caCert
+	build.ScratchDir = scratch
+	build.Repo = fmt.Sprintf("%s/%s", c.String("registry"), c.String("repo"))
+	build.CacheRepo = flags.CacheRepo(c, c.String("registry"))
+
+	plugin := kaniko.Plugin{
+		Build: build,
+		Artifact: kaniko.Artifact{
+			Tags:         c.StringSlice("tags"),
+			Repo:         c.String("repo"),
+			Registry:     c.String("registry"),
+			ArtifactFile: c.String("artifact-file"),
+			Schema:       c.String("artifact-schema"),
+			RegistryType: artifact.GCR,
+		},
+		Output:  flags.Output(c),
+		Backend: flags.Backend(c),
+		GitOps:  flags.GitOps(c),
+		Status:  flags.Status(c),
+	}
+	return plugin.Exec(ctx)
+}
+
+func setupGCRAuth(jsonKey string) error {
+	err := ioutil.WriteFile(gcrKeyPath, []byte(jsonKey), 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write GCR JSON key")
+	}
+
+	err = os.Setenv(gcrEnvVariable, gcrKeyPath)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to set %s environment variable", gcrEnvVariable))
+	}
+	return nil
+}
+
+// setupImpersonatedAuth writes a docker config with an access token for the
+// impersonated service account, minted with the JSON key if set and the
+// application default credentials otherwise. The key itself is not passed
+// to the executor.
+func setupImpersonatedAuth(ctx context.Context, jsonKey, serviceAccount, registry, dockerConfigDir string) error {
+	if registry == "" {
+		return fmt.Errorf("registry must be specified")
+	}
+	auth := credentials.Chain{credentials.GCP{
+		Registry: "https://" + strings.SplitN(registry, "/", 2)[0],
+		Tokens: gcp.Impersonator{
+			Base:           gcp.Credentials{JSON: []byte(jsonKey)},
+			ServiceAccount: serviceAccount,
+		},
+	}}
+	err := auth.Write(ctx, filepath.Join(dockerConfigDir, "config.json"), docker.MergeStrategyMerge)
+	return errors.Wrap(err, "failed to impersonate service account")
+}
+
+// parseRepository returns the Artifact Registry repository of a gcr.io or
+// pkg.dev image, validating the registry host.
+func parseRepository(image string) (gcp.Repository, error) {
+	if gcp.IsArtifactRegistryHost(strings.SplitN(image, "/", 2)[0]) {
+		return gcp.ParseRepository(image)
+	}
+	return gcp.ParseGCRRepository(image)
+}
+
+// checkUpload fails early when the credentials may not push to the
+// repository. Projects still on the legacy Container Registry have no
+// Artifact Registry repository to check, and the build continues when the
+// check itself fails.
+func checkUpload(ctx context.Context, jsonKey, serviceAccount string, repo gcp.Repository) error {
+	err := gcp.ArtifactRegistry{Tokens: gcp.NewTokenSource([]byte(jsonKey), serviceAccount)}.CheckUpload(ctx, repo)
+	var denied *gcp.PermissionError
+	switch {
+	case err == nil, errors.Is(err, gcp.ErrNotFound):
+	case errors.As(err, &denied):
+		return err
+	default:
+		fmt.Fprintf(os.Stderr, "failed to check the push permission, building anyway: %s\n", err)
+	}
+	return nil
+}
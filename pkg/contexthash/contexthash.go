@@ -0,0 +1,119 @@
+package contexthash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+	"github.com/pkg/errors"
+)
+
+// Inputs defines everything that determines the content of a build.
+type Inputs struct {
+	Context    string   // Build context directory
+	Dockerfile string   // Dockerfile path
+	Args       []string // Build arguments
+	Target     string   // Build target
+	Platform   string   // Target platform
+
+	Ignore *dockerignore.Matcher // Patterns of the .dockerignore file of the context
+}
+
+// Compute returns a stable sha256 hex digest of the build inputs. The .git
+// directory is ignored as it changes with every commit, and so are the paths
+// excluded by the .dockerignore file, which never reach the build.
+func Compute(in Inputs) (string, error) {
+	h := sha256.New()
+
+	dockerfile, err := os.Open(in.Dockerfile)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open dockerfile")
+	}
+	defer dockerfile.Close()
+	fmt.Fprintf(h, "dockerfile\x00")
+	if _, err := io.Copy(h, dockerfile); err != nil {
+		return "", errors.Wrap(err, "failed to hash dockerfile")
+	}
+
+	args := append([]string(nil), in.Args...)
+	sort.Strings(args)
+	for _, arg := range args {
+		fmt.Fprintf(h, "arg\x00%s\x00", arg)
+	}
+	fmt.Fprintf(h, "target\x00%s\x00platform\x00%s\x00", in.Target, in.Platform)
+
+	if err := hashDir(h, in.Context, in.Ignore); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Context returns a stable sha256 hex digest of the build context alone,
+// without the paths excluded by the .dockerignore patterns.
+func Context(dir string, ignore *dockerignore.Matcher) (string, error) {
+	h := sha256.New()
+	if err := hashDir(h, dir, ignore); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashDir writes the entries of the directory tree to w, skipping .git and
+// the excluded paths. The .dockerignore file itself is always hashed.
+func hashDir(w io.Writer, dir string, ignore *dockerignore.Matcher) error {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() && rel == ".git" {
+			return filepath.SkipDir
+		}
+		if rel != ".dockerignore" && ignore.Excluded(rel) {
+			if info.IsDir() && ignore.SkipDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return hashEntry(w, path, rel, info)
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to hash build context")
+	}
+	return nil
+}
+
+func hashEntry(w io.Writer, path, rel string, info os.FileInfo) error {
+	mode := info.Mode()
+	fmt.Fprintf(w, "file\x00%s\x00%o\x00", rel, mode.Perm())
+	switch {
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "link\x00%s\x00", target)
+	case mode.IsRegular():
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(w, "size\x00%d\x00", info.Size())
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+	case mode.IsDir():
+		fmt.Fprintf(w, "dir\x00")
+	}
+	return nil
+}
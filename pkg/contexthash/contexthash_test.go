@@ -0,0 +1,84 @@
+package contexthash
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+)
+
+func TestCompute(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	write(t, dockerfile, "FROM alpine\nCOPY . /src\n")
+	write(t, filepath.Join(dir, "main.go"), "package main\n")
+
+	in := Inputs{Context: dir, Dockerfile: dockerfile, Args: []string{"B=2", "A=1"}}
+	first, err := Compute(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// argument order and the .git directory do not change the hash
+	write(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main\n")
+	in.Args = []string{"A=1", "B=2"}
+	if got, _ := Compute(in); got != first {
+		t.Errorf("hash changed for identical inputs")
+	}
+
+	write(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() {}\n")
+	if got, _ := Compute(in); got == first {
+		t.Errorf("hash did not change with the context")
+	}
+}
+
+func TestContext(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "main.go"), "package main\n")
+	first, err := Context(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main\n")
+	if got, _ := Context(dir, nil); got != first {
+		t.Errorf("hash changed with the .git directory")
+	}
+	write(t, filepath.Join(dir, "main.go"), "package other\n")
+	if got, _ := Context(dir, nil); got == first {
+		t.Errorf("hash did not change with the context")
+	}
+}
+
+func TestContext_dockerignore(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "main.go"), "package main\n")
+	ignore, err := dockerignore.New([]string{"*.log", "node_modules"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := Context(dir, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ignored files never reach the build
+	write(t, filepath.Join(dir, "debug.log"), "started\n")
+	write(t, filepath.Join(dir, "node_modules", "pkg", "index.js"), "module.exports = 1\n")
+	if got, _ := Context(dir, ignore); got != first {
+		t.Errorf("hash changed with ignored files")
+	}
+	if got, _ := Context(dir, nil); got == first {
+		t.Errorf("hash did not change without the patterns")
+	}
+}
+
+func write(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
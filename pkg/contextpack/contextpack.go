@@ -0,0 +1,141 @@
+// Package contextpack packages a build context as a gzip compressed tarball,
+// the format kaniko reads from s3:// and gs:// contexts. Archives are
+// reproducible: entries are sorted and their times and owners are reset, so
+// the digest of the archive identifies the content of the context.
+package contextpack
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+	"github.com/pkg/errors"
+)
+
+// epoch is the modification time of all entries.
+var epoch = time.Unix(0, 0)
+
+// Write writes the archive of the directory to w, leaving out the paths
+// excluded by the matcher. The paths to keep, relative to the directory, are
+// always included, e.g. the Dockerfile and the .dockerignore file, as with
+// the docker cli.
+func Write(w io.Writer, dir string, ignore *dockerignore.Matcher, keep ...string) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	err := Walk(dir, ignore, keep, func(path, rel string, info os.FileInfo) error {
+		return writeEntry(tw, path, rel, info)
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to package build context")
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Walk calls fn in lexical order for the files and directories of the build
+// context in dir, with their slash separated path relative to dir, leaving
+// out the paths excluded by the matcher except the paths to keep.
+func Walk(dir string, ignore *dockerignore.Matcher, keep []string, fn func(path, rel string, info os.FileInfo) error) error {
+	kept := map[string]bool{}
+	for _, path := range keep {
+		kept[filepath.ToSlash(filepath.Clean(path))] = true
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if !kept[rel] && ignore.Excluded(rel) {
+			if info.IsDir() && ignore.SkipDir(rel) && !keepsBelow(kept, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, rel, info)
+	})
+}
+
+// keepsBelow returns true if a path to keep is within the directory.
+func keepsBelow(kept map[string]bool, dir string) bool {
+	for path := range kept {
+		if len(path) > len(dir) && path[:len(dir)+1] == dir+"/" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeEntry(tw *tar.Writer, path, rel string, info os.FileInfo) error {
+	var link string
+	switch mode := info.Mode(); {
+	case mode.IsRegular(), mode.IsDir():
+	case mode&os.ModeSymlink != 0:
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	default:
+		// sockets, devices and pipes are not part of a build context
+		return nil
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	header.ModTime, header.AccessTime, header.ChangeTime = epoch, time.Time{}, time.Time{}
+	header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+	header.Format = tar.FormatPAX
+	header.PAXRecords = nil
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// File writes the archive of the directory to a temporary file in tmpDir,
+// returning its path and the sha256 hex digest of the archive.
+func File(tmpDir, dir string, ignore *dockerignore.Matcher, keep ...string) (string, string, error) {
+	f, err := ioutil.TempFile(tmpDir, "context-*.tar.gz")
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to create context archive")
+	}
+	h := sha256.New()
+	err = Write(io.MultiWriter(f, h), dir, ignore, keep...)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return f.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
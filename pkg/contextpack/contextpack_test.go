@@ -0,0 +1,97 @@
+package contextpack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Dockerfile":            "FROM scratch\n",
+		".dockerignore":         "*\n!main.go\n",
+		"main.go":               "package main\n",
+		"secret.env":            "TOKEN=x\n",
+		"node_modules/a/pkg.js": "",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ignore, err := dockerignore.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, dir, ignore, "Dockerfile", ".dockerignore"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".dockerignore", "Dockerfile", "main.go"}
+	if diff := cmp.Diff(want, entries(t, buf.Bytes())); diff != "" {
+		t.Errorf("entries mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFile_reproducible(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, digest, err := File(t.TempDir(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// the digest only depends on the content
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, again, err := File(t.TempDir(), dir, nil); err != nil || again != digest {
+		t.Errorf("got digest %s, want %s (%v)", again, digest, err)
+	}
+
+	if err := os.WriteFile(path, []byte("package app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, changed, err := File(t.TempDir(), dir, nil); err != nil || changed == digest {
+		t.Errorf("expected the digest to change with the content (%v)", err)
+	}
+}
+
+func entries(t *testing.T, archive []byte) []string {
+	zr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+}
@@ -0,0 +1,71 @@
+package contextsync
+
+import "io"
+
+// Chunk sizes. Chunk boundaries are placed where the rolling hash of the
+// content matches the boundary mask, so an edit only changes the chunks
+// around it, on average every 64 KiB past the minimum size.
+const (
+	MinChunkSize = 16 << 10
+	MaxChunkSize = 256 << 10
+
+	boundaryMask = uint64(0xffff) << 48
+)
+
+// gear maps bytes to the random values of the rolling gear hash.
+var gear = func() [256]uint64 {
+	// splitmix64 with a fixed seed, as the boundaries of a file must not
+	// change between builds for its chunks to be found in the store
+	var table [256]uint64
+	state := uint64(0x6b616e696b6f)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Split reads r to the end and calls fn with each content defined chunk.
+// The chunk is only valid during the call.
+func Split(r io.Reader, fn func(chunk []byte) error) error {
+	buf := make([]byte, MaxChunkSize)
+	n, eof := 0, false
+	for {
+		for n < len(buf) && !eof {
+			read, err := r.Read(buf[n:])
+			n += read
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		cut := boundary(buf[:n])
+		if err := fn(buf[:cut]); err != nil {
+			return err
+		}
+		n = copy(buf, buf[cut:n])
+	}
+}
+
+// boundary returns the length of the first chunk of data, all of data when
+// no boundary is found.
+func boundary(data []byte) int {
+	if len(data) <= MinChunkSize {
+		return len(data)
+	}
+	var hash uint64
+	for i := MinChunkSize; i < len(data); i++ {
+		hash = hash<<1 + gear[data[i]]
+		if hash&boundaryMask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,166 @@
+// Package contextsync uploads build contexts incrementally. Files are split
+// into content defined chunks, kept by digest in the content store of the
+// build service, so a build only uploads the chunks the store is missing:
+// those of the files changed since an earlier build, and of a large file
+// only the chunks around an edit.
+package contextsync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/drone/drone-kaniko/pkg/contextpack"
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+	"github.com/pkg/errors"
+)
+
+// modeMask are the mode bits kept for entries.
+const modeMask = os.ModeDir | os.ModeSymlink | os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+type (
+	// Entry is a file, directory or symbolic link of a build context.
+	Entry struct {
+		Path   string      `json:"path"`
+		Mode   os.FileMode `json:"mode"`
+		Link   string      `json:"link,omitempty"`
+		Chunks []string    `json:"chunks,omitempty"`
+	}
+
+	// Manifest lists the entries of a build context in lexical order.
+	Manifest struct {
+		Entries []Entry `json:"entries"`
+	}
+)
+
+// ID returns the hex digest of the manifest, identifying the context.
+func (m Manifest) ID() string {
+	content, _ := json.Marshal(m)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Chunks returns the digests of the chunks of the context, without
+// duplicates.
+func (m Manifest) Chunks() []string {
+	seen := map[string]bool{}
+	var digests []string
+	for _, entry := range m.Entries {
+		for _, digest := range entry.Chunks {
+			if !seen[digest] {
+				seen[digest] = true
+				digests = append(digests, digest)
+			}
+		}
+	}
+	return digests
+}
+
+// chunkSource locates a chunk in a file of the context.
+type chunkSource struct {
+	path   string
+	offset int64
+	size   int
+}
+
+// Snapshot is a scanned build context, with the locations its chunks are
+// read from when uploading them.
+type Snapshot struct {
+	Manifest Manifest
+	Size     int64 // Total size of the files
+
+	chunks map[string]chunkSource
+}
+
+// Scan splits the files of the build context in dir into chunks, leaving out
+// the paths excluded by the matcher except the paths to keep, as in the
+// archives of contextpack.
+func Scan(dir string, ignore *dockerignore.Matcher, keep ...string) (*Snapshot, error) {
+	snapshot := &Snapshot{chunks: map[string]chunkSource{}}
+	err := contextpack.Walk(dir, ignore, keep, func(path, rel string, info os.FileInfo) error {
+		entry := Entry{Path: rel, Mode: info.Mode() & modeMask}
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entry.Link = link
+		case mode.IsRegular():
+			chunks, err := snapshot.split(path)
+			if err != nil {
+				return err
+			}
+			entry.Chunks = chunks
+			snapshot.Size += info.Size()
+		default:
+			// sockets, devices and pipes are not part of a build context
+			return nil
+		}
+		snapshot.Manifest.Entries = append(snapshot.Manifest.Entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to scan build context")
+	}
+	return snapshot, nil
+}
+
+// split returns the digests of the chunks of the file and records where
+// they are.
+func (s *Snapshot) split(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var digests []string
+	var offset int64
+	err = Split(f, func(chunk []byte) error {
+		digest := Digest(chunk)
+		digests = append(digests, digest)
+		if _, ok := s.chunks[digest]; !ok {
+			s.chunks[digest] = chunkSource{path: path, offset: offset, size: len(chunk)}
+		}
+		offset += int64(len(chunk))
+		return nil
+	})
+	return digests, err
+}
+
+// ReadChunk reads the chunk with the digest from the files of the context.
+// It fails when the file changed since it was scanned.
+func (s *Snapshot) ReadChunk(digest string) ([]byte, error) {
+	source, ok := s.chunks[digest]
+	if !ok {
+		return nil, fmt.Errorf("unknown chunk %s", digest)
+	}
+	f, err := os.Open(source.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	chunk := make([]byte, source.size)
+	if _, err := io.ReadFull(io.NewSectionReader(f, source.offset, int64(source.size)), chunk); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to read %s", source.path))
+	}
+	if Digest(chunk) != digest {
+		return nil, fmt.Errorf("%s changed while uploading the build context", source.path)
+	}
+	return chunk, nil
+}
+
+// ChunkSize returns the size of the chunk with the digest.
+func (s *Snapshot) ChunkSize(digest string) int {
+	return s.chunks[digest].size
+}
+
+// Digest returns the digest of a chunk.
+func Digest(chunk []byte) string {
+	sum := sha256.Sum256(chunk)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
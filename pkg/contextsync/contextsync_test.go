@@ -0,0 +1,201 @@
+package contextsync
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+)
+
+func chunkDigests(t *testing.T, data []byte) []string {
+	var digests []string
+	err := Split(bytes.NewReader(data), func(chunk []byte) error {
+		if len(chunk) > MaxChunkSize {
+			t.Errorf("chunk of %d bytes is larger than the maximum", len(chunk))
+		}
+		digests = append(digests, Digest(chunk))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return digests
+}
+
+func TestSplit(t *testing.T) {
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	before := chunkDigests(t, data)
+	if len(before) < 8 {
+		t.Fatalf("expected content defined chunks, got %d", len(before))
+	}
+
+	// an insertion in the middle only changes the chunks around it
+	edited := append(append(append([]byte{}, data[:2<<20]...), []byte("edit")...), data[2<<20:]...)
+	after := chunkDigests(t, edited)
+	known := map[string]bool{}
+	for _, digest := range before {
+		known[digest] = true
+	}
+	changed := 0
+	for _, digest := range after {
+		if !known[digest] {
+			changed++
+		}
+	}
+	if changed == 0 || changed > 2 {
+		t.Errorf("expected one or two changed chunks, got %d of %d", changed, len(after))
+	}
+
+	if digests := chunkDigests(t, []byte("small")); len(digests) != 1 {
+		t.Errorf("expected a small file in one chunk, got %d", len(digests))
+	}
+	if digests := chunkDigests(t, nil); len(digests) != 0 {
+		t.Errorf("expected no chunks of an empty file, got %d", len(digests))
+	}
+}
+
+func TestStore(t *testing.T) {
+	src := t.TempDir()
+	large := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(large)
+	for name, content := range map[string][]byte{
+		"Dockerfile":     []byte("FROM scratch\nCOPY . /\n"),
+		"app/main.go":    []byte("package main\n"),
+		"app/data.bin":   large,
+		"app/copy.bin":   large,
+		"node_modules/x": []byte("ignored"),
+		".dockerignore":  []byte("node_modules\n"),
+	} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chmod(filepath.Join(src, "app/main.go"), 0755)
+	if err := os.Symlink("main.go", filepath.Join(src, "app/link.go")); err != nil {
+		t.Fatal(err)
+	}
+	ignore, err := dockerignore.ReadFile(filepath.Join(src, ".dockerignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := Scan(src, ignore, ".dockerignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := Store(t.TempDir())
+	digests := snapshot.Manifest.Chunks()
+	missing, err := store.Missing(digests)
+	if err != nil || len(missing) != len(digests) {
+		t.Fatalf("expected all chunks missing, got %d of %d, %v", len(missing), len(digests), err)
+	}
+	if _, err := store.PutManifest(snapshot.Manifest); err == nil {
+		t.Error("expected error for a manifest with missing chunks")
+	}
+	for _, digest := range missing {
+		chunk, err := snapshot.ReadChunk(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.PutChunk(digest, bytes.NewReader(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.PutChunk(digests[0], bytes.NewReader([]byte("tampered"))); err == nil {
+		t.Error("expected error for a chunk not matching its digest")
+	}
+	if missing, _ := store.Missing(digests); len(missing) != 0 {
+		t.Errorf("expected no missing chunks after the upload, got %d", len(missing))
+	}
+
+	id, err := store.PutManifest(snapshot.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "context")
+	if err := store.Materialize(id, dst); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Dockerfile", "app/main.go", "app/data.bin", "app/copy.bin", ".dockerignore"} {
+		want, _ := ioutil.ReadFile(filepath.Join(src, filepath.FromSlash(name)))
+		got, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("content of %s mismatch: %v", name, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dst, "app/main.go")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("expected the mode of app/main.go kept, got %v", info)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "app/link.go")); err != nil || link != "main.go" {
+		t.Errorf("expected the symbolic link kept, got %q, %v", link, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "node_modules")); !os.IsNotExist(err) {
+		t.Errorf("expected ignored paths left out, got %v", err)
+	}
+
+	if _, err := store.Manifest("0000000000000000000000000000000000000000000000000000000000000000"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	store := Store(t.TempDir())
+	put := func(content string) (string, string) {
+		digest := Digest([]byte(content))
+		if err := store.PutChunk(digest, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		id, err := store.PutManifest(Manifest{Entries: []Entry{{Path: "file", Mode: 0644, Chunks: []string{digest}}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest, id
+	}
+	oldDigest, oldID := put("old")
+	newDigest, newID := put("new")
+	past := time.Now().Add(-48 * time.Hour)
+	for _, path := range []string{store.chunkPath(oldDigest), store.manifestPath(oldID)} {
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := store.Prune(24 * time.Hour)
+	if err != nil || removed != 2 {
+		t.Fatalf("expected the old chunk and manifest removed, got %d, %v", removed, err)
+	}
+	if _, err := store.Manifest(oldID); err != ErrNotFound {
+		t.Errorf("expected the old context pruned, got %v", err)
+	}
+	if missing, _ := store.Missing([]string{oldDigest, newDigest}); len(missing) != 1 || missing[0] != oldDigest {
+		t.Errorf("expected only the old chunk pruned, got missing %v", missing)
+	}
+	if err := store.Materialize(newID, filepath.Join(t.TempDir(), "context")); err != nil {
+		t.Errorf("expected the recent context kept, got %v", err)
+	}
+}
+
+func TestManifest_validate(t *testing.T) {
+	for _, m := range []Manifest{
+		{Entries: []Entry{{Path: "../etc/passwd"}}},
+		{Entries: []Entry{{Path: "/etc/passwd"}}},
+		{Entries: []Entry{{Path: "app/../../etc"}}},
+		{Entries: []Entry{{Path: "a"}, {Path: "a"}}},
+		{Entries: []Entry{{Path: "a", Mode: os.ModeDevice}}},
+		{Entries: []Entry{{Path: "a", Link: "b"}}},
+		{Entries: []Entry{{Path: "a", Chunks: []string{"sha256:bad"}}}},
+	} {
+		if _, err := Store(t.TempDir()).PutManifest(m); err == nil {
+			t.Errorf("expected error for %+v", m)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package contextsync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when a context was not uploaded.
+var ErrNotFound = errors.New("context not found")
+
+var (
+	digestRE = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	idRE     = regexp.MustCompile(`^[a-f0-9]{64}$`)
+)
+
+// MissingChunksError is returned when a manifest refers to chunks the store
+// does not have.
+type MissingChunksError struct {
+	Digests []string
+}
+
+func (e *MissingChunksError) Error() string {
+	return fmt.Sprintf("%d chunks of the context were not uploaded", len(e.Digests))
+}
+
+// Store keeps the chunks and manifests of uploaded contexts in a directory.
+// Chunks are shared by all contexts; the modification time of a chunk is
+// updated when a context uses it, so unused chunks can be pruned by age.
+type Store string
+
+// Missing returns the digests the store does not have.
+func (s Store) Missing(digests []string) ([]string, error) {
+	now := time.Now()
+	var missing []string
+	for _, digest := range digests {
+		if !digestRE.MatchString(digest) {
+			return nil, fmt.Errorf("invalid chunk digest %q", digest)
+		}
+		if err := os.Chtimes(s.chunkPath(digest), now, now); os.IsNotExist(err) {
+			missing = append(missing, digest)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// PutChunk stores the chunk read from r, which must match the digest.
+func (s Store) PutChunk(digest string, r io.Reader) error {
+	if !digestRE.MatchString(digest) {
+		return fmt.Errorf("invalid chunk digest %q", digest)
+	}
+	chunk, err := ioutil.ReadAll(io.LimitReader(r, MaxChunkSize+1))
+	if err != nil {
+		return err
+	}
+	if len(chunk) > MaxChunkSize {
+		return fmt.Errorf("chunk %s is larger than %d bytes", digest, MaxChunkSize)
+	}
+	if Digest(chunk) != digest {
+		return fmt.Errorf("chunk does not match digest %s", digest)
+	}
+	return writeFile(s.chunkPath(digest), chunk)
+}
+
+// PutManifest stores the manifest of a context and returns its id. It
+// returns a *MissingChunksError when chunks of the context were not
+// uploaded.
+func (s Store) PutManifest(m Manifest) (string, error) {
+	if err := m.validate(); err != nil {
+		return "", err
+	}
+	missing, err := s.Missing(m.Chunks())
+	if err != nil {
+		return "", err
+	}
+	if len(missing) > 0 {
+		return "", &MissingChunksError{Digests: missing}
+	}
+	content, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	id := m.ID()
+	return id, writeFile(s.manifestPath(id), content)
+}
+
+// Manifest returns the manifest of the context with the id.
+func (s Store) Manifest(id string) (Manifest, error) {
+	if !idRE.MatchString(id) {
+		return Manifest{}, fmt.Errorf("invalid context id %q", id)
+	}
+	content, err := ioutil.ReadFile(s.manifestPath(id))
+	if os.IsNotExist(err) {
+		return Manifest{}, ErrNotFound
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(content, &m); err != nil {
+		return Manifest{}, errors.Wrap(err, fmt.Sprintf("invalid manifest of context %s", id))
+	}
+	return m, nil
+}
+
+// Materialize writes the files of the context with the id to dir. Symbolic
+// links are created last, so no file is written through them. The
+// modification times of the manifest and its chunks are updated, so a
+// context in use is not pruned.
+func (s Store) Materialize(id, dir string) error {
+	m, err := s.Manifest(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := os.Chtimes(s.manifestPath(id), now, now); err != nil {
+		return err
+	}
+	missing, err := s.Missing(m.Chunks())
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return &MissingChunksError{Digests: missing}
+	}
+	var dirs, links []Entry
+	for _, entry := range m.Entries {
+		target := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		switch {
+		case entry.Mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, entry)
+		case entry.Mode&os.ModeSymlink != 0:
+			links = append(links, entry)
+		default:
+			if err := s.writeEntry(target, entry); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to write %s", entry.Path))
+			}
+		}
+	}
+	for _, entry := range links {
+		target := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(entry.Link, target); err != nil {
+			return err
+		}
+	}
+	// directories may not be writable, their modes are applied last and
+	// children first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(filepath.Join(dir, filepath.FromSlash(dirs[i].Path)), dirs[i].Mode&^os.ModeDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEntry writes the file assembled from the chunks of the entry.
+func (s Store) writeEntry(target string, entry Entry) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	for _, digest := range entry.Chunks {
+		chunk, err := ioutil.ReadFile(s.chunkPath(digest))
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Write(chunk); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(target, entry.Mode)
+}
+
+// Prune removes the manifests and chunks not used for maxAge and returns
+// how many files were removed. Manifests go first: a context uses its
+// chunks when it is stored or materialized, so the chunks of a kept
+// manifest are never older than the manifest.
+func (s Store) Prune(maxAge time.Duration) (int, error) {
+	expiry := time.Now().Add(-maxAge)
+	removed := 0
+	for _, dir := range []string{"manifests", "chunks"} {
+		err := filepath.Walk(filepath.Join(string(s), dir), func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() || !info.ModTime().Before(expiry) {
+				return nil
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removed++
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+func (s Store) chunkPath(digest string) string {
+	hex := strings.TrimPrefix(digest, "sha256:")
+	return filepath.Join(string(s), "chunks", hex[:2], hex)
+}
+
+func (s Store) manifestPath(id string) string {
+	return filepath.Join(string(s), "manifests", id+".json")
+}
+
+// validate checks the entries are relative paths within the context,
+// without duplicates, with valid chunk digests.
+func (m Manifest) validate() error {
+	seen := map[string]bool{}
+	for _, entry := range m.Entries {
+		p := entry.Path
+		if p == "" || path.Clean(p) != p || path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+			return fmt.Errorf("invalid path %q in the context", p)
+		}
+		if seen[p] {
+			return fmt.Errorf("duplicate path %q in the context", p)
+		}
+		seen[p] = true
+		if entry.Mode&^modeMask != 0 || (entry.Link != "") != (entry.Mode&os.ModeSymlink != 0) {
+			return fmt.Errorf("invalid mode of %q in the context", p)
+		}
+		if len(entry.Chunks) > 0 && !entry.Mode.IsRegular() {
+			return fmt.Errorf("unexpected content of %q in the context", p)
+		}
+		for _, digest := range entry.Chunks {
+			if !digestRE.MatchString(digest) {
+				return fmt.Errorf("invalid chunk digest %q", digest)
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile writes the file atomically, creating its directory.
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, bytes.NewReader(content)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
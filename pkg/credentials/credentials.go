@@ -0,0 +1,122 @@
+// Package credentials resolves the registry credentials written to the
+// docker config, shared by all plugins so that each authentication method
+// is implemented once.
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+)
+
+// ErrNotConfigured is returned by providers whose settings are not set.
+var ErrNotConfigured = errors.New("credentials not configured")
+
+// Provider supplies docker config entries for one authentication method.
+type Provider interface {
+	Provide(ctx context.Context) (*docker.Config, error)
+}
+
+// ProviderFunc adapts a function to a Provider.
+type ProviderFunc func(ctx context.Context) (*docker.Config, error)
+
+// Provide calls f.
+func (f ProviderFunc) Provide(ctx context.Context) (*docker.Config, error) {
+	return f(ctx)
+}
+
+// Chain combines the entries of all configured providers. Earlier providers
+// take precedence when several configure the same registry.
+type Chain []Provider
+
+// Provide resolves the chain, returning ErrNotConfigured when no provider
+// is configured.
+func (c Chain) Provide(ctx context.Context) (*docker.Config, error) {
+	var config *docker.Config
+	for _, provider := range c {
+		next, err := provider.Provide(ctx)
+		if errors.Is(err, ErrNotConfigured) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			config = docker.NewConfig()
+		}
+		merge(config, next)
+	}
+	if config == nil {
+		return nil, ErrNotConfigured
+	}
+	return config, nil
+}
+
+// Resolve is like Provide but returns an empty config when no provider is
+// configured.
+func (c Chain) Resolve(ctx context.Context) (*docker.Config, error) {
+	config, err := c.Provide(ctx)
+	if errors.Is(err, ErrNotConfigured) {
+		return docker.NewConfig(), nil
+	}
+	return config, err
+}
+
+// Write resolves the chain and writes the docker config file at path,
+// combined with an existing file according to the merge strategy. Nothing
+// is written when no provider is configured.
+func (c Chain) Write(ctx context.Context, path, strategy string) error {
+	config, err := c.Provide(ctx)
+	if errors.Is(err, ErrNotConfigured) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return docker.WriteConfigFile(path, content, strategy)
+}
+
+// First uses the first configured provider only, for mutually exclusive
+// authentication methods.
+func First(providers ...Provider) Provider {
+	return ProviderFunc(func(ctx context.Context) (*docker.Config, error) {
+		for _, provider := range providers {
+			config, err := provider.Provide(ctx)
+			if errors.Is(err, ErrNotConfigured) {
+				continue
+			}
+			return config, err
+		}
+		return nil, ErrNotConfigured
+	})
+}
+
+func merge(dst, src *docker.Config) {
+	if src == nil {
+		return
+	}
+	for k, v := range src.Auths {
+		if _, ok := dst.Auths[k]; !ok {
+			dst.Auths[k] = v
+		}
+	}
+	for k, v := range src.CredHelpers {
+		if _, ok := dst.CredHelpers[k]; !ok {
+			dst.CredHelpers[k] = v
+		}
+	}
+	for k, v := range src.Extra {
+		if dst.Extra == nil {
+			dst.Extra = map[string]json.RawMessage{}
+		}
+		if _, ok := dst.Extra[k]; !ok {
+			dst.Extra[k] = v
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/gcp"
+)
+
+type staticToken string
+
+func (s staticToken) Token(context.Context) (gcp.Token, error) {
+	return gcp.Token{AccessToken: string(s)}, nil
+}
+
+func TestChain(t *testing.T) {
+	chain := Chain{
+		Static{Registry: docker.RegistryV1, Username: "octocat", Password: "secret"},
+		Token{},
+		Helper{Helper: "ecr-login", Registries: []string{docker.RegistryECRPublic}},
+		Fetch{Registry: "acme.azurecr.io", Func: func(context.Context) (string, string, string, error) {
+			return "", "00000000-0000-0000-0000-000000000000", "refresh", nil
+		}},
+		GCP{Registry: "gcr.io", Tokens: staticToken("access")},
+		Static{Registry: docker.RegistryV1, Username: "ignored", Password: "ignored"},
+	}
+	got, err := chain.Provide(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := docker.NewConfig()
+	want.SetAuth(docker.RegistryV1, "octocat", "secret")
+	want.SetCredHelper(docker.RegistryECRPublic, "ecr-login")
+	want.SetAuth("acme.azurecr.io", "00000000-0000-0000-0000-000000000000", "refresh")
+	want.SetAuth("gcr.io", "oauth2accesstoken", "access")
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("not equal:\n  want: %#v\n   got: %#v", want, got)
+	}
+
+	if _, err := (Chain{Static{}, Token{}, Fetch{}}).Provide(context.Background()); err != ErrNotConfigured {
+		t.Errorf("expected ErrNotConfigured, got %v", err)
+	}
+	if _, err := (Static{Registry: "ghcr.io", Username: "octocat"}).Provide(context.Background()); err == nil {
+		t.Errorf("expected an error for a missing password")
+	}
+}
+
+func TestFirst(t *testing.T) {
+	override := `{"auths": {"quay.io": {"auth": "b3ZlcnJpZGU="}}, "credsStore": "desktop"}`
+	auth := First(
+		File{Content: []byte(override)},
+		Static{Registry: docker.RegistryV1, Username: "octocat", Password: "secret"},
+	)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := (Chain{auth}).Write(context.Background(), path, docker.MergeStrategyMerge); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want map[string]interface{}
+	json.Unmarshal(content, &got)
+	json.Unmarshal([]byte(`{"auths": {"quay.io": {"auth": "b3ZlcnJpZGU="}}, "credHelpers": {}, "credsStore": "desktop"}`), &want)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("unexpected config %s", content)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	want := docker.NewConfig()
+	want.SetAuth("registry.example.com", "octocat", "secret")
+
+	// a kubernetes.io/dockerconfigjson secret mounted as a directory
+	dir := t.TempDir()
+	content := `{"auths": {"registry.example.com": {"auth": "b2N0b2NhdDpzZWNyZXQ="}}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, ".dockerconfigjson"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Secret{Path: dir}.Provide(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("not equal:\n  want: %#v\n   got: %#v", want, got)
+	}
+
+	// a legacy kubernetes.io/dockercfg secret given by its key
+	legacy := filepath.Join(t.TempDir(), ".dockercfg")
+	if err := ioutil.WriteFile(legacy, []byte(`{"registry.example.com": {"auth": "b2N0b2NhdDpzZWNyZXQ="}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = Secret{Path: legacy}.Provide(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("not equal:\n  want: %#v\n   got: %#v", want, got)
+	}
+
+	if _, err := (Secret{}).Provide(context.Background()); err != ErrNotConfigured {
+		t.Errorf("expected ErrNotConfigured, got %v", err)
+	}
+	if _, err := (Secret{Path: t.TempDir()}).Provide(context.Background()); err == nil {
+		t.Error("expected an error for a secret without a docker config key")
+	}
+}
@@ -0,0 +1,249 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/drone/drone-kaniko/pkg/docker"
+	"github.com/drone/drone-kaniko/pkg/dockerhub"
+	"github.com/drone/drone-kaniko/pkg/gcp"
+)
+
+// gcpUsername is the username registries expect with Google access tokens.
+const gcpUsername = "oauth2accesstoken"
+
+// Static is a registry username and password. It is configured when the
+// username is set.
+type Static struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// Provide implements Provider.
+func (s Static) Provide(context.Context) (*docker.Config, error) {
+	if s.Username == "" {
+		return nil, ErrNotConfigured
+	}
+	if s.Password == "" {
+		return nil, fmt.Errorf("Password must be specified")
+	}
+	if s.Registry == "" {
+		return nil, fmt.Errorf("Registry must be specified")
+	}
+	config := docker.NewConfig()
+	config.SetAuth(s.Registry, s.Username, s.Password)
+	return config, nil
+}
+
+// Env reads the username and password from environment variables.
+type Env struct {
+	Registry    string
+	UsernameVar string
+	PasswordVar string
+}
+
+// Provide implements Provider.
+func (e Env) Provide(ctx context.Context) (*docker.Config, error) {
+	return Static{Registry: e.Registry, Username: os.Getenv(e.UsernameVar), Password: os.Getenv(e.PasswordVar)}.Provide(ctx)
+}
+
+// Token is a registry token sent as a bearer token, or an identity token
+// the registry exchanges for access tokens.
+type Token struct {
+	Registry      string
+	RegistryToken string
+	IdentityToken string
+}
+
+// Provide implements Provider.
+func (t Token) Provide(context.Context) (*docker.Config, error) {
+	if t.RegistryToken == "" && t.IdentityToken == "" {
+		return nil, ErrNotConfigured
+	}
+	if t.Registry == "" {
+		return nil, fmt.Errorf("Registry must be specified")
+	}
+	config := docker.NewConfig()
+	if t.RegistryToken != "" {
+		config.SetRegistryToken(t.Registry, t.RegistryToken)
+	} else {
+		config.SetIdentityToken(t.Registry, t.IdentityToken)
+	}
+	return config, nil
+}
+
+// File is a complete docker config, given inline or as a file path. Other
+// sections than the credentials, such as credsStore, are kept.
+type File struct {
+	Content []byte
+	Path    string
+}
+
+// Provide implements Provider.
+func (f File) Provide(context.Context) (*docker.Config, error) {
+	content := f.Content
+	if len(content) == 0 && f.Path != "" {
+		var err error
+		if content, err = ioutil.ReadFile(f.Path); err != nil {
+			return nil, errors.Wrap(err, "failed to read docker config file")
+		}
+	}
+	if len(content) == 0 {
+		return nil, ErrNotConfigured
+	}
+	config := docker.NewConfig()
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, errors.Wrap(err, "failed to parse docker config")
+	}
+	return config, nil
+}
+
+// Kubernetes secret keys of the docker config, for secrets of the
+// kubernetes.io/dockerconfigjson and the legacy kubernetes.io/dockercfg
+// types.
+const (
+	secretKeyDockerConfigJSON = ".dockerconfigjson"
+	secretKeyDockerCfg        = ".dockercfg"
+)
+
+// Secret is a Kubernetes image pull secret mounted into the pod, given as
+// the mount directory or the path of its key. Both the dockerconfigjson
+// format and the legacy dockercfg format, which lacks the auths section,
+// are read.
+type Secret struct {
+	Path string
+}
+
+// Provide implements Provider.
+func (s Secret) Provide(context.Context) (*docker.Config, error) {
+	if s.Path == "" {
+		return nil, ErrNotConfigured
+	}
+	path := s.Path
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = ""
+		for _, key := range []string{secretKeyDockerConfigJSON, secretKeyDockerCfg, "config.json"} {
+			if _, err := os.Stat(filepath.Join(s.Path, key)); err == nil {
+				path = filepath.Join(s.Path, key)
+				break
+			}
+		}
+		if path == "" {
+			return nil, fmt.Errorf("no %s or %s key found in the docker config secret %s", secretKeyDockerConfigJSON, secretKeyDockerCfg, s.Path)
+		}
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read docker config secret")
+	}
+
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(content, &sections); err != nil {
+		return nil, errors.Wrap(err, "failed to parse docker config secret")
+	}
+	if _, ok := sections["auths"]; !ok && filepath.Base(path) == secretKeyDockerCfg {
+		// the legacy format maps the registries to their auths directly
+		content, _ = json.Marshal(map[string]json.RawMessage{"auths": content})
+	}
+	config := docker.NewConfig()
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, errors.Wrap(err, "failed to parse docker config secret")
+	}
+	return config, nil
+}
+
+// Helper delegates the registries to a docker credential helper, such as
+// ecr-login, which the executor runs when pulling and pushing.
+type Helper struct {
+	Helper     string
+	Registries []string
+}
+
+// Provide implements Provider.
+func (h Helper) Provide(context.Context) (*docker.Config, error) {
+	if h.Helper == "" || len(h.Registries) == 0 {
+		return nil, ErrNotConfigured
+	}
+	config := docker.NewConfig()
+	for _, registry := range h.Registries {
+		config.SetCredHelper(registry, h.Helper)
+	}
+	return config, nil
+}
+
+// Fetch calls a function fetching a short-lived username and password, as
+// done by the ECR and ACR plugins with their cloud SDKs. A nil function is
+// not configured.
+type Fetch struct {
+	Registry string
+	Func     func(ctx context.Context) (registry, username, password string, err error)
+}
+
+// Provide implements Provider.
+func (f Fetch) Provide(ctx context.Context) (*docker.Config, error) {
+	if f.Func == nil {
+		return nil, ErrNotConfigured
+	}
+	registry, username, password, err := f.Func(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if registry == "" {
+		registry = f.Registry
+	}
+	config := docker.NewConfig()
+	config.SetAuth(registry, username, password)
+	return config, nil
+}
+
+// GCP authenticates with a Google access token, for GCR and Artifact
+// Registry. It is configured when the token source is set.
+type GCP struct {
+	Registry string
+	Tokens   gcp.TokenSource
+}
+
+// Provide implements Provider.
+func (g GCP) Provide(ctx context.Context) (*docker.Config, error) {
+	if g.Tokens == nil {
+		return nil, ErrNotConfigured
+	}
+	token, err := g.Tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config := docker.NewConfig()
+	config.SetAuth(g.Registry, gcpUsername, token.AccessToken)
+	return config, nil
+}
+
+// OIDC exchanges an identity token, such as a Drone OIDC token, for a
+// Docker Hub access token. It is configured when the secret is set.
+type OIDC struct {
+	Registry  string
+	Username  string
+	Exchanger dockerhub.Exchanger
+	Exchanged *dockerhub.Token // if set, receives the token for refreshing it
+}
+
+// Provide implements Provider.
+func (o OIDC) Provide(ctx context.Context) (*docker.Config, error) {
+	if o.Exchanger.Secret == "" {
+		return nil, ErrNotConfigured
+	}
+	token, err := o.Exchanger.Exchange(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if o.Exchanged != nil {
+		*o.Exchanged = token
+	}
+	return Static{Registry: o.Registry, Username: o.Username, Password: token.AccessToken}.Provide(ctx)
+}
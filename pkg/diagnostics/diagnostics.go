@@ -0,0 +1,124 @@
+// Package diagnostics collects files describing a failed build into a
+// bundle that can be attached to CI artifacts.
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sensitiveName matches names of variables and fields holding secrets.
+var sensitiveName = regexp.MustCompile(`(?i)(password|passwd|secret|token|key|credential|auth|netrc)`)
+
+// Redacted replaces secret values.
+const Redacted = "[redacted]"
+
+// IsSensitive returns true when the name suggests the value is a secret.
+func IsSensitive(name string) bool {
+	return sensitiveName.MatchString(name)
+}
+
+// Bundle is a set of files written to a tar.gz archive.
+type Bundle struct {
+	files []file
+}
+
+type file struct {
+	name    string
+	content []byte
+}
+
+// Add adds a file with the content to the bundle.
+func (b *Bundle) Add(name string, content []byte) {
+	b.files = append(b.files, file{name: name, content: content})
+}
+
+// AddFile adds a copy of the file at path to the bundle. Missing files are
+// skipped, as diagnostics are collected on a best effort basis.
+func (b *Bundle) AddFile(name, path string) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		b.Add(name+".error", []byte(err.Error()+"\n"))
+		return
+	}
+	b.Add(name, content)
+}
+
+// Write writes the bundle as a tar.gz archive to path.
+func (b *Bundle) Write(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "failed to create diagnostics directory")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create diagnostics bundle")
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, file := range b.files {
+		hdr := &tar.Header{
+			Name:     file.name,
+			Mode:     0644,
+			Size:     int64(len(file.content)),
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.content); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// TailBuffer is a writer keeping the last Max bytes written to it.
+type TailBuffer struct {
+	Max int
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// Write appends p, discarding the oldest bytes beyond the limit.
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if t.Max > 0 && len(t.buf) > t.Max {
+		t.buf = append([]byte(nil), t.buf[len(t.buf)-t.Max:]...)
+	}
+	return len(p), nil
+}
+
+// Reset discards the buffered bytes.
+func (t *TailBuffer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = nil
+}
+
+// Bytes returns a copy of the buffered bytes.
+func (t *TailBuffer) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]byte(nil), t.buf...)
+}
@@ -0,0 +1,80 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	dockerfile := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := ioutil.WriteFile(dockerfile, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var b Bundle
+	b.Add("kaniko.log", []byte("error building image"))
+	b.AddFile("Dockerfile", dockerfile)
+	b.AddFile("missing", filepath.Join(t.TempDir(), "missing"))
+
+	path := filepath.Join(t.TempDir(), "out", "diagnostics.tar.gz")
+	if err := b.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(tr)
+		got[hdr.Name] = string(content)
+	}
+	if got["kaniko.log"] != "error building image" || got["Dockerfile"] != "FROM alpine\n" {
+		t.Errorf("unexpected bundle contents %v", got)
+	}
+	if _, ok := got["missing.error"]; !ok {
+		t.Errorf("expected the missing file error to be recorded")
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tail := &TailBuffer{Max: 5}
+	tail.Write([]byte("hello "))
+	tail.Write([]byte("world"))
+	if got := string(tail.Bytes()); got != "world" {
+		t.Errorf("unexpected tail %q", got)
+	}
+}
+
+func TestIsSensitive(t *testing.T) {
+	for name, want := range map[string]bool{
+		"PLUGIN_PASSWORD":     true,
+		"GITOPS_TOKEN":        true,
+		"SSHKey":              true,
+		"PLUGIN_REPO":         false,
+		"DRONE_COMMIT_BRANCH": false,
+	} {
+		if got := IsSensitive(name); got != want {
+			t.Errorf("IsSensitive(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -2,17 +2,24 @@ package docker
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 )
 
 type (
 	Auth struct {
-		Auth string `json:"auth"`
+		Auth          string `json:"auth,omitempty"`
+		IdentityToken string `json:"identitytoken,omitempty"`
+		RegistryToken string `json:"registrytoken,omitempty"`
 	}
 
 	Config struct {
 		Auths       map[string]Auth   `json:"auths"`
 		CredHelpers map[string]string `json:"credHelpers"`
+
+		// Extra holds the other sections of a parsed config file, such as
+		// credsStore or HttpHeaders, so they survive a round trip.
+		Extra map[string]json.RawMessage `json:"-"`
 	}
 )
 
@@ -32,3 +39,52 @@ func (c *Config) SetAuth(registry, username, password string) {
 func (c *Config) SetCredHelper(registry, helper string) {
 	c.CredHelpers[registry] = helper
 }
+
+// SetIdentityToken sets an OAuth2 refresh token the registry exchanges for
+// access tokens.
+func (c *Config) SetIdentityToken(registry, token string) {
+	c.Auths[registry] = Auth{IdentityToken: token}
+}
+
+// SetRegistryToken sets a bearer token sent to the registry as is.
+func (c *Config) SetRegistryToken(registry, token string) {
+	c.Auths[registry] = Auth{RegistryToken: token}
+}
+
+// MarshalJSON encodes the config including the extra sections.
+func (c Config) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{}
+	for k, v := range c.Extra {
+		out[k] = v
+	}
+	out["auths"] = c.Auths
+	out["credHelpers"] = c.CredHelpers
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes the config, keeping unknown sections in Extra.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return err
+	}
+	*c = Config{Auths: map[string]Auth{}, CredHelpers: map[string]string{}}
+	for k, v := range sections {
+		var err error
+		switch k {
+		case "auths":
+			err = json.Unmarshal(v, &c.Auths)
+		case "credHelpers":
+			err = json.Unmarshal(v, &c.CredHelpers)
+		default:
+			if c.Extra == nil {
+				c.Extra = map[string]json.RawMessage{}
+			}
+			c.Extra[k] = v
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -23,3 +23,22 @@ func TestConfig(t *testing.T) {
 		t.Errorf("unexpected json output:\n  want: %s\n   got: %s", want, got)
 	}
 }
+
+func TestConfigTokens(t *testing.T) {
+	c := NewConfig()
+
+	c.SetIdentityToken("myregistry.azurecr.io", "refresh")
+	c.SetRegistryToken("registry.gitlab.com", "bearer")
+
+	bytes, err := json.Marshal(c)
+	if err != nil {
+		t.Error("json marshal failed")
+	}
+
+	want := `{"auths":{"myregistry.azurecr.io":{"identitytoken":"refresh"},"registry.gitlab.com":{"registrytoken":"bearer"}},"credHelpers":{}}`
+	got := string(bytes)
+
+	if want != got {
+		t.Errorf("unexpected json output:\n  want: %s\n   got: %s", want, got)
+	}
+}
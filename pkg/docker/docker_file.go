@@ -3,14 +3,12 @@ package docker
 import (
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
-	"os"
-
-	"github.com/pkg/errors"
+	"path/filepath"
 )
 
-// Create the docker config file for authentication
-func CreateDockerCfgFile(username, password, registry, path string) error {
+// Create the docker config file for authentication, combined with an
+// existing config file according to the merge strategy
+func CreateDockerCfgFile(username, password, registry, path, strategy string) error {
 	if username == "" {
 		return fmt.Errorf("Username must be specified")
 	}
@@ -18,18 +16,8 @@ func CreateDockerCfgFile(username, password, registry, path string) error {
 		return fmt.Errorf("Password must be specified")
 	}
 
-	err := os.MkdirAll(path, 0600)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("failed to create %s directory", path))
-	}
-
 	authBytes := []byte(fmt.Sprintf("%s:%s", username, password))
 	encodedString := base64.StdEncoding.EncodeToString(authBytes)
 	jsonBytes := []byte(fmt.Sprintf(`{"auths": {"%s": {"auth": "%s"}}}`, "https://"+registry, encodedString))
-	filePath := path + "/config.json"
-	err = ioutil.WriteFile(filePath, jsonBytes, 0644)
-	if err != nil {
-		return errors.Wrap(err, "failed to create docker config file")
-	}
-	return nil
+	return WriteConfigFile(filepath.Join(path, "config.json"), jsonBytes, strategy)
 }
@@ -0,0 +1,122 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Strategies for combining a generated docker config with an existing one.
+const (
+	// MergeStrategyMerge merges the configs, preferring generated entries.
+	MergeStrategyMerge string = "merge"
+	// MergeStrategyKeep merges the configs, preferring existing entries.
+	MergeStrategyKeep string = "keep"
+	// MergeStrategyOverwrite replaces the existing config.
+	MergeStrategyOverwrite string = "overwrite"
+)
+
+// mergedSections are the config sections merged entry by entry.
+var mergedSections = []string{"auths", "credHelpers"}
+
+// MergeConfig combines the generated docker config with the existing one.
+// Registry entries in auths and credHelpers are merged individually, other
+// fields are kept from both configs, and conflicts are resolved according
+// to the strategy.
+func MergeConfig(existing, generated []byte, strategy string) ([]byte, error) {
+	switch strategy {
+	case MergeStrategyOverwrite:
+		return generated, nil
+	case "", MergeStrategyMerge, MergeStrategyKeep:
+	default:
+		return nil, fmt.Errorf("unknown config merge strategy %q", strategy)
+	}
+
+	var base, update map[string]json.RawMessage
+	if err := json.Unmarshal(existing, &base); err != nil {
+		return nil, errors.Wrap(err, "failed to parse existing docker config")
+	}
+	if err := json.Unmarshal(generated, &update); err != nil {
+		return nil, errors.Wrap(err, "failed to parse docker config")
+	}
+	if base == nil {
+		base = map[string]json.RawMessage{}
+	}
+	preferExisting := strategy == MergeStrategyKeep
+
+	for key, value := range update {
+		if !isMergedSection(key) {
+			if _, ok := base[key]; !ok || !preferExisting {
+				base[key] = value
+			}
+			continue
+		}
+
+		var baseEntries, updateEntries map[string]json.RawMessage
+		if raw, ok := base[key]; ok {
+			if err := json.Unmarshal(raw, &baseEntries); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("failed to parse existing %s", key))
+			}
+		}
+		if err := json.Unmarshal(value, &updateEntries); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to parse %s", key))
+		}
+		if baseEntries == nil {
+			baseEntries = map[string]json.RawMessage{}
+		}
+		for registry, entry := range updateEntries {
+			if _, ok := baseEntries[registry]; ok && preferExisting {
+				fmt.Printf("keeping existing %s entry for %s\n", key, registry)
+				continue
+			}
+			baseEntries[registry] = entry
+		}
+		merged, err := json.Marshal(baseEntries)
+		if err != nil {
+			return nil, err
+		}
+		base[key] = merged
+	}
+	return json.Marshal(base)
+}
+
+// WriteConfigFile writes the docker config to path, combining it with an
+// existing config file according to the strategy.
+func WriteConfigFile(path string, content []byte, strategy string) error {
+	existing, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil && len(existing) > 0:
+		if content, err = MergeConfig(existing, content, strategy); err != nil {
+			return err
+		}
+	case err != nil && !os.IsNotExist(err):
+		return errors.Wrap(err, "failed to read docker config file")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to create %s directory", filepath.Dir(path)))
+	}
+	// replace the file atomically, it may be read by a running build
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return errors.Wrap(err, "failed to create docker config file")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "failed to create docker config file")
+	}
+	return nil
+}
+
+func isMergedSection(key string) bool {
+	for _, section := range mergedSections {
+		if key == section {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeConfig(t *testing.T) {
+	existing := `{"auths": {"ghcr.io": {"auth": "old"}, "quay.io": {"auth": "mounted"}}, "credsStore": "desktop", "HttpHeaders": {"X-Meta": "1"}}`
+	generated := `{"auths": {"ghcr.io": {"auth": "new"}}, "credHelpers": {"public.ecr.aws": "ecr-login"}, "credsStore": "pass"}`
+
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{
+			strategy: MergeStrategyMerge,
+			want:     `{"auths": {"ghcr.io": {"auth": "new"}, "quay.io": {"auth": "mounted"}}, "credHelpers": {"public.ecr.aws": "ecr-login"}, "credsStore": "pass", "HttpHeaders": {"X-Meta": "1"}}`,
+		},
+		{
+			strategy: MergeStrategyKeep,
+			want:     `{"auths": {"ghcr.io": {"auth": "old"}, "quay.io": {"auth": "mounted"}}, "credHelpers": {"public.ecr.aws": "ecr-login"}, "credsStore": "desktop", "HttpHeaders": {"X-Meta": "1"}}`,
+		},
+		{
+			strategy: MergeStrategyOverwrite,
+			want:     generated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			got, err := MergeConfig([]byte(existing), []byte(generated), tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSONEqual(t, string(got), tt.want)
+		})
+	}
+
+	if _, err := MergeConfig([]byte(existing), []byte(generated), "replace"); err == nil {
+		t.Errorf("expected error for unknown strategy")
+	}
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".docker", "config.json")
+	if err := WriteConfigFile(path, []byte(`{"auths": {"a": {"auth": "1"}}}`), MergeStrategyMerge); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteConfigFile(path, []byte(`{"auths": {"b": {"auth": "2"}}}`), MergeStrategyMerge); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, string(got), `{"auths": {"a": {"auth": "1"}, "b": {"auth": "2"}}}`)
+}
+
+func assertJSONEqual(t *testing.T, got, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal([]byte(got), &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("unexpected config:\n  want: %s\n   got: %s", want, got)
+	}
+}
@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RefreshFunc fetches fresh registry credentials.
+type RefreshFunc func(ctx context.Context) (*Config, error)
+
+// KeepFresh fetches new credentials every interval and merges them into the
+// docker config file at path, until the context is cancelled. The executor
+// reads the file when pushing, so long builds do not fail at the end with
+// expired tokens. Failures are reported and retried on the next tick, as
+// the current credentials may still be valid.
+func KeepFresh(ctx context.Context, path string, interval time.Duration, refresh RefreshFunc) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		config, err := refresh(ctx)
+		if err == nil {
+			var content []byte
+			if content, err = json.Marshal(config); err == nil {
+				err = WriteConfigFile(path, content, MergeStrategyMerge)
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Printf("failed to refresh registry credentials: %s\n", err)
+		}
+	}
+}
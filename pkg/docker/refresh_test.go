@@ -0,0 +1,50 @@
+package docker
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeepFresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := WriteConfigFile(path, []byte(`{"auths": {"quay.io": {"auth": "mounted"}, "acme.azurecr.io": {"auth": "expired"}}}`), MergeStrategyMerge); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	refreshed := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		KeepFresh(ctx, path, time.Millisecond, func(context.Context) (*Config, error) {
+			config := NewConfig()
+			config.SetAuth("acme.azurecr.io", "user", "fresh")
+			select {
+			case refreshed <- struct{}{}:
+			default:
+			}
+			return config, nil
+		})
+		close(done)
+	}()
+
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("credentials were not refreshed")
+	}
+	cancel()
+	<-done
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "expired") || !strings.Contains(string(content), "mounted") {
+		t.Errorf("unexpected config %s", content)
+	}
+}
@@ -0,0 +1,108 @@
+// Package dockerengine is a minimal Docker Engine API client running the
+// kaniko executor in a sibling container.
+package dockerengine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// DefaultHost is the Docker Engine socket used when DOCKER_HOST is not set.
+	DefaultHost = "unix:///var/run/docker.sock"
+
+	apiVersion = "v1.41"
+)
+
+// Client talks to the Docker Engine API.
+type Client struct {
+	HTTP *http.Client
+	base string
+}
+
+// NewClient returns a client for the engine at host, a unix:// socket or a
+// tcp:// address.
+func NewClient(host string) (*Client, error) {
+	if host == "" {
+		host = DefaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Client{HTTP: &http.Client{Transport: transport}, base: "http://docker/" + apiVersion}, nil
+	case "tcp", "http":
+		return &Client{HTTP: &http.Client{}, base: "http://" + u.Host + "/" + apiVersion}, nil
+	default:
+		return nil, fmt.Errorf("unsupported docker host %s", host)
+	}
+}
+
+// do sends the request and returns the response when its status is one of
+// the expected ones.
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, contentType string, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if res.StatusCode == status {
+			return res, nil
+		}
+	}
+	defer res.Body.Close()
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	content, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if json.Unmarshal(content, &apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(content))
+	}
+	return nil, fmt.Errorf("docker %s %s: %s: %s", method, strings.SplitN(path, "?", 2)[0], res.Status, apiErr.Message)
+}
+
+// doJSON sends v as JSON and decodes the response into out, when set.
+func (c *Client) doJSON(ctx context.Context, method, path string, v, out interface{}, expected ...int) error {
+	var body io.Reader
+	if v != nil {
+		content, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+	}
+	res, err := c.do(ctx, method, path, body, "application/json", expected...)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if out == nil {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,145 @@
+package dockerengine
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+type (
+	// ContainerConfig is the subset of the container create request used
+	// to run the executor.
+	ContainerConfig struct {
+		Image      string     `json:"Image"`
+		Cmd        []string   `json:"Cmd"`
+		Env        []string   `json:"Env,omitempty"`
+		WorkingDir string     `json:"WorkingDir,omitempty"`
+		HostConfig HostConfig `json:"HostConfig"`
+	}
+
+	// HostConfig holds the volumes of the container.
+	HostConfig struct {
+		Binds       []string `json:"Binds,omitempty"`
+		VolumesFrom []string `json:"VolumesFrom,omitempty"`
+		NetworkMode string   `json:"NetworkMode,omitempty"`
+	}
+)
+
+// Pull pulls the image, unless it is already present.
+func (c *Client) Pull(ctx context.Context, image string) error {
+	if err := c.doJSON(ctx, http.MethodGet, "/images/"+url.PathEscape(image)+"/json", nil, nil, http.StatusOK); err == nil {
+		return nil
+	}
+	res, err := c.do(ctx, http.MethodPost, "/images/create?fromImage="+url.QueryEscape(image), nil, "", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// the pull progress is streamed as json messages, errors included
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", image, msg.Error)
+		}
+	}
+}
+
+// Create creates a container and returns its id.
+func (c *Client) Create(ctx context.Context, config ContainerConfig) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/containers/create", config, &created, http.StatusCreated); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// CopyTo extracts the tar archive into the container at path.
+func (c *Client) CopyTo(ctx context.Context, id, path string, archive io.Reader) error {
+	res, err := c.do(ctx, http.MethodPut, "/containers/"+id+"/archive?path="+url.QueryEscape(path), archive, "application/x-tar", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// CopyFrom returns a tar archive of path in the container. The caller must
+// close it.
+func (c *Client) CopyFrom(ctx context.Context, id, path string) (io.ReadCloser, error) {
+	res, err := c.do(ctx, http.MethodGet, "/containers/"+id+"/archive?path="+url.QueryEscape(path), nil, "", http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Start starts the container.
+func (c *Client) Start(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, http.StatusNoContent, http.StatusNotModified)
+}
+
+// Logs follows the container output until it exits, demultiplexing it into
+// stdout and stderr.
+func (c *Client) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	res, err := c.do(ctx, http.MethodGet, "/containers/"+id+"/logs?follow=1&stdout=1&stderr=1", nil, "", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return demux(bufio.NewReader(res.Body), stdout, stderr)
+}
+
+// demux splits the multiplexed stream of a container without a tty: each
+// frame has an 8 byte header holding the stream and the frame size.
+func demux(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if w == nil {
+			w = ioutil.Discard
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// Wait waits for the container to exit and returns its exit code.
+func (c *Client) Wait(ctx context.Context, id string) (int, error) {
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, &result, http.StatusOK); err != nil {
+		return 0, err
+	}
+	return result.StatusCode, nil
+}
+
+// Remove force removes the container.
+func (c *Client) Remove(ctx context.Context, id string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/containers/"+id+"?force=1&v=1", nil, nil, http.StatusNoContent, http.StatusNotFound)
+}
@@ -0,0 +1,264 @@
+package dockerengine
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// outputFlags are the executor flags naming files the executor writes, which
+// are copied back from the container after the build.
+var outputFlags = []string{
+	"--digest-file=",
+	"--tar-path=",
+	"--image-name-with-digest-file=",
+	"--image-name-tag-with-digest-file=",
+}
+
+// ExitError is returned when the container exits with a non-zero code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("executor exited with status %d", e.Code) }
+
+// ExitCode returns the exit code of the container.
+func (e *ExitError) ExitCode() int { return e.Code }
+
+// Runner runs commands in a sibling container of Image instead of a local
+// process. The command path is replaced by the image entrypoint.
+type Runner struct {
+	Client *Client
+	Image  string
+
+	// Container whose volumes and network the sibling container shares,
+	// usually the container running the plugin.
+	Container string
+
+	// Env is set in the container in addition to the variables set for
+	// the command.
+	Env []string
+
+	// SecretEnv is set in the container in addition to Env. Variables set
+	// for the command are only forwarded when they differ from the
+	// environment of the plugin, so secrets are forwarded explicitly.
+	SecretEnv []string
+
+	// Upload lists local paths copied into the container before it starts.
+	Upload []string
+
+	// UploadPrefixes are local directories not shared through volumes:
+	// paths in the command arguments below them are copied into the
+	// container before it starts.
+	UploadPrefixes []string
+}
+
+// Run runs cmd in a sibling container, streaming its output to the command
+// writers, and copies the output files of the executor back.
+func (r Runner) Run(ctx context.Context, cmd *exec.Cmd) error {
+	if err := r.Client.Pull(ctx, r.Image); err != nil {
+		return err
+	}
+
+	// like exec.Cmd, an empty Dir runs in the working directory of the
+	// plugin, which the container shares through its volumes
+	dir := cmd.Dir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		dir = wd
+	}
+	config := ContainerConfig{
+		Image:      r.Image,
+		Cmd:        cmd.Args[1:],
+		Env:        append(append(addedEnv(cmd.Env, os.Environ()), r.Env...), r.SecretEnv...),
+		WorkingDir: dir,
+	}
+	if r.Container != "" {
+		config.HostConfig.VolumesFrom = []string{r.Container}
+		config.HostConfig.NetworkMode = "container:" + r.Container
+	}
+	id, err := r.Client.Create(ctx, config)
+	if err != nil {
+		return errors.Wrap(err, "failed to create executor container")
+	}
+	// remove the container even when the build is cancelled
+	defer r.Client.Remove(context.Background(), id)
+
+	if uploads := r.uploads(cmd); len(uploads) > 0 {
+		pr, pw := io.Pipe()
+		go func() { pw.CloseWithError(writeArchive(pw, uploads)) }()
+		if err := r.Client.CopyTo(ctx, id, "/", pr); err != nil {
+			pr.Close()
+			return errors.Wrap(err, "failed to copy files into the executor container")
+		}
+	}
+
+	if err := r.Client.Start(ctx, id); err != nil {
+		return errors.Wrap(err, "failed to start executor container")
+	}
+	if err := r.Client.Logs(ctx, id, cmd.Stdout, cmd.Stderr); err != nil && ctx.Err() == nil {
+		return errors.Wrap(err, "failed to stream executor logs")
+	}
+	code, err := r.Client.Wait(ctx, id)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if code != 0 {
+		return &ExitError{Code: code}
+	}
+
+	for _, path := range flagPaths(cmd.Args, outputFlags) {
+		if err := r.download(ctx, id, path); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to copy %s from the executor container", path))
+		}
+	}
+	return nil
+}
+
+// uploads returns the existing local paths to copy into the container.
+func (r Runner) uploads(cmd *exec.Cmd) []string {
+	var paths []string
+	for _, path := range append(append([]string(nil), r.Upload...), argPaths(cmd.Args, r.UploadPrefixes)...) {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// download copies the file at path in the container to the same local path.
+func (r Runner) download(ctx context.Context, id, path string) error {
+	archive, err := r.Client.CopyFrom(ctx, id, path)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	tr := tar.NewReader(archive)
+	hdr, err := tr.Next()
+	if err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// addedEnv returns the entries of env that are not in base, the variables
+// set for the command rather than inherited from the plugin.
+func addedEnv(env, base []string) []string {
+	inherited := map[string]bool{}
+	for _, v := range base {
+		inherited[v] = true
+	}
+	var added []string
+	for _, v := range env {
+		if !inherited[v] {
+			added = append(added, v)
+		}
+	}
+	return added
+}
+
+// flagPaths returns the values of the flags with the given prefixes.
+func flagPaths(args, prefixes []string) []string {
+	var paths []string
+	for _, arg := range args {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(arg, prefix) && len(arg) > len(prefix) {
+				paths = append(paths, strings.TrimPrefix(arg, prefix))
+			}
+		}
+	}
+	return paths
+}
+
+// argPaths returns the paths in --flag=path and --flag=dir://path arguments
+// that are below one of the directories.
+func argPaths(args, dirs []string) []string {
+	var paths []string
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		path := strings.TrimPrefix(parts[1], "dir://")
+		for _, dir := range dirs {
+			if dir != "" && (path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")) {
+				paths = append(paths, path)
+				break
+			}
+		}
+	}
+	return paths
+}
+
+// writeArchive writes a tar archive of the paths, named by their absolute
+// path so that the archive is extracted in place at the root.
+func writeArchive(w io.Writer, paths []string) error {
+	tw := tar.NewWriter(w)
+	for _, root := range paths {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			link := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				if link, err = os.Readlink(path); err != nil {
+					return err
+				}
+			}
+			hdr, err := tar.FileInfoHeader(info, link)
+			if err != nil {
+				return err
+			}
+			hdr.Name = strings.TrimPrefix(filepath.ToSlash(path), "/")
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(tw, f)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,187 @@
+package dockerengine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeEngine serves the engine API calls made by the runner.
+type fakeEngine struct {
+	mu       sync.Mutex
+	exitCode int
+	calls    []string
+	config   ContainerConfig
+	uploaded []string
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/"+apiVersion)
+	e.calls = append(e.calls, r.Method+" "+path)
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/images/"):
+		w.Write([]byte(`{}`))
+	case path == "/containers/create":
+		json.NewDecoder(r.Body).Decode(&e.config)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id": "abc"}`))
+	case r.Method == http.MethodPut && path == "/containers/abc/archive":
+		tr := tar.NewReader(r.Body)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			e.uploaded = append(e.uploaded, hdr.Name)
+		}
+	case path == "/containers/abc/start":
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/containers/abc/logs":
+		writeFrame(w, 1, "building\n")
+		writeFrame(w, 2, "warning\n")
+	case path == "/containers/abc/wait":
+		json.NewEncoder(w).Encode(map[string]int{"StatusCode": e.exitCode})
+	case r.Method == http.MethodGet && path == "/containers/abc/archive":
+		tw := tar.NewWriter(w)
+		content := "sha256:1234"
+		tw.WriteHeader(&tar.Header{Name: filepath.Base(r.URL.Query().Get("path")), Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+		tw.Close()
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeFrame(w io.Writer, stream byte, data string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	w.Write(header)
+	w.Write([]byte(data))
+}
+
+func TestRunner(t *testing.T) {
+	engine := &fakeEngine{}
+	ts := httptest.NewServer(engine)
+	defer ts.Close()
+	client, err := NewClient(strings.Replace(ts.URL, "http://", "tcp://", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := t.TempDir()
+	staged := filepath.Join(state, "context")
+	if err := ioutil.WriteFile(filepath.Join(state, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(staged, 0755); err != nil {
+		t.Fatal(err)
+	}
+	digestFile := filepath.Join(t.TempDir(), "digest-file")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("/kaniko/executor", "--dockerfile="+filepath.Join(state, "Dockerfile"), "--context=dir://"+staged, "--digest-file="+digestFile)
+	// a secret read from a variable of the same name is not added to the
+	// environment of the command, it must still reach the executor
+	t.Setenv("NPM_TOKEN", "s3cret")
+	cmd.Env = []string{"DOCKER_CONFIG=/kaniko/.docker", "NPM_TOKEN=s3cret"}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runner := Runner{Client: client, Image: "executor:latest", Container: "plugin", UploadPrefixes: []string{state}, SecretEnv: []string{"NPM_TOKEN=s3cret"}}
+	if err := runner.Run(context.Background(), cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	// without a directory set, the command runs in the working directory
+	wd, _ := os.Getwd()
+	want := ContainerConfig{
+		Image:      "executor:latest",
+		Cmd:        cmd.Args[1:],
+		Env:        []string{"DOCKER_CONFIG=/kaniko/.docker", "NPM_TOKEN=s3cret"},
+		WorkingDir: wd,
+		HostConfig: HostConfig{
+			VolumesFrom: []string{"plugin"},
+			NetworkMode: "container:plugin",
+		},
+	}
+	if diff := cmp.Diff(want, engine.config); diff != "" {
+		t.Errorf("unexpected container config (-want +got):\n%s", diff)
+	}
+	wantUploads := []string{strings.TrimPrefix(filepath.Join(state, "Dockerfile"), "/"), strings.TrimPrefix(staged, "/")}
+	if diff := cmp.Diff(wantUploads, engine.uploaded); diff != "" {
+		t.Errorf("unexpected uploads (-want +got):\n%s", diff)
+	}
+	if stdout.String() != "building\n" || stderr.String() != "warning\n" {
+		t.Errorf("unexpected output %q %q", stdout.String(), stderr.String())
+	}
+	if data, _ := ioutil.ReadFile(digestFile); string(data) != "sha256:1234" {
+		t.Errorf("expected the digest file to be copied back, got %q", data)
+	}
+	if last := engine.calls[len(engine.calls)-1]; last != "DELETE /containers/abc" {
+		t.Errorf("expected the container to be removed, got %s", last)
+	}
+}
+
+func TestRunner_ExitCode(t *testing.T) {
+	engine := &fakeEngine{exitCode: 137}
+	ts := httptest.NewServer(engine)
+	defer ts.Close()
+	client, _ := NewClient(strings.Replace(ts.URL, "http://", "tcp://", 1))
+
+	cmd := exec.Command("/kaniko/executor", "--no-push")
+	err := Runner{Client: client, Image: "executor:latest"}.Run(context.Background(), cmd)
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 137 {
+		t.Errorf("expected exit code 137, got %v", err)
+	}
+}
+
+func TestRunner_WorkingDir(t *testing.T) {
+	engine := &fakeEngine{}
+	ts := httptest.NewServer(engine)
+	defer ts.Close()
+	client, _ := NewClient(strings.Replace(ts.URL, "http://", "tcp://", 1))
+
+	cmd := exec.Command("/kaniko/executor", "--no-push")
+	cmd.Dir = "/drone/src"
+	if err := (Runner{Client: client, Image: "executor:latest"}).Run(context.Background(), cmd); err != nil {
+		t.Fatal(err)
+	}
+	if engine.config.WorkingDir != "/drone/src" {
+		t.Errorf("expected the directory of the command, got %q", engine.config.WorkingDir)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	for host, ok := range map[string]bool{
+		"":                            true,
+		"unix:///var/run/docker.sock": true,
+		"tcp://127.0.0.1:2375":        true,
+		"ssh://host":                  false,
+	} {
+		if _, err := NewClient(host); (err == nil) != ok {
+			t.Errorf("NewClient(%q) error = %v", host, err)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+// Package dockerfile parses Dockerfiles into their stages and instructions,
+// for validating builds before they run. It follows the rules of the
+// BuildKit parser: parser directives, comments, line continuations with the
+// escape character, JSON arguments and heredocs.
+package dockerfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Instruction is a Dockerfile instruction.
+	Instruction struct {
+		Cmd       string   // Instruction in upper case, e.g. RUN
+		Flags     []string // Flags, e.g. --from=build
+		Args      []string // Arguments, from the JSON or the shell form
+		JSON      bool     // Arguments are in the JSON form
+		Original  string   // Instruction as written, continuations joined
+		StartLine int      // First line of the instruction
+		EndLine   int      // Last line of the instruction, including heredocs
+		Heredocs  []string // Contents of the heredocs
+	}
+
+	// Arg is an ARG declaration.
+	Arg struct {
+		Name       string
+		Default    string
+		HasDefault bool
+		Line       int
+	}
+
+	// Copy is a COPY or ADD instruction.
+	Copy struct {
+		Sources []string
+		Dest    string
+		From    string // Stage or image of --from, empty for the build context
+		Line    int
+	}
+
+	// Stage is a build stage, started by a FROM instruction.
+	Stage struct {
+		Index        int
+		Name         string // Lower case name given with AS, if any
+		Base         string // Base image or stage, as written
+		Platform     string // Value of --platform, if any
+		From         Instruction
+		Instructions []Instruction // Instructions following FROM
+		Args         []Arg
+		Copies       []Copy
+	}
+
+	// Dockerfile is a parsed Dockerfile.
+	Dockerfile struct {
+		MetaArgs []Arg // ARGs declared before the first FROM
+		Stages   []Stage
+	}
+)
+
+var (
+	directiveRE = regexp.MustCompile(`^#\s*([a-zA-Z][a-zA-Z0-9]*)\s*=\s*(.+?)\s*$`)
+	heredocRE   = regexp.MustCompile(`<<(-?)(["']?)([a-zA-Z_][a-zA-Z0-9_]*)(["']?)`)
+	variableRE  = regexp.MustCompile(`\$\{?(\w+)\}?`)
+)
+
+// ParseFile parses the Dockerfile at path.
+func ParseFile(path string) (*Dockerfile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bytes.NewReader(content))
+}
+
+// Parse parses a Dockerfile.
+func Parse(r io.Reader) (*Dockerfile, error) {
+	instructions, err := Instructions(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dockerfile{}
+	for _, inst := range instructions {
+		if inst.Cmd == "FROM" {
+			stage, err := newStage(len(d.Stages), inst)
+			if err != nil {
+				return nil, err
+			}
+			d.Stages = append(d.Stages, stage)
+			continue
+		}
+		if len(d.Stages) == 0 {
+			if inst.Cmd != "ARG" {
+				return nil, fmt.Errorf("line %d: %s before the first FROM, only ARG is allowed", inst.StartLine, inst.Cmd)
+			}
+			d.MetaArgs = append(d.MetaArgs, parseArgs(inst)...)
+			continue
+		}
+		stage := &d.Stages[len(d.Stages)-1]
+		stage.Instructions = append(stage.Instructions, inst)
+		switch inst.Cmd {
+		case "ARG":
+			stage.Args = append(stage.Args, parseArgs(inst)...)
+		case "COPY", "ADD":
+			if len(inst.Args) >= 2 {
+				stage.Copies = append(stage.Copies, Copy{
+					Sources: inst.Args[:len(inst.Args)-1],
+					Dest:    inst.Args[len(inst.Args)-1],
+					From:    inst.Flag("from"),
+					Line:    inst.StartLine,
+				})
+			}
+		}
+	}
+	return d, nil
+}
+
+// Instructions splits a Dockerfile into its instructions.
+func Instructions(r io.Reader) ([]Instruction, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	escape := `\`
+	n := 0
+	// parser directives are only recognized before any other line
+	for ; n < len(lines); n++ {
+		m := directiveRE.FindStringSubmatch(lines[n])
+		if m == nil {
+			break
+		}
+		if strings.ToLower(m[1]) == "escape" {
+			if m[2] != `\` && m[2] != "`" {
+				return nil, fmt.Errorf("line %d: invalid escape character %q", n+1, m[2])
+			}
+			escape = m[2]
+		}
+	}
+
+	var instructions []Instruction
+	for n < len(lines) {
+		line := strings.TrimSpace(lines[n])
+		if line == "" || strings.HasPrefix(line, "#") {
+			n++
+			continue
+		}
+		start := n
+		var parts []string
+		for {
+			// continuation lines are joined as is, keeping their indentation
+			trimmed := strings.TrimRight(lines[n], " \t")
+			if n == start {
+				trimmed = strings.TrimSpace(trimmed)
+			}
+			if n > start && (trimmed == "" || strings.HasPrefix(strings.TrimSpace(trimmed), "#")) {
+				// empty lines and comments within continued instructions are
+				// removed
+				n++
+				if n == len(lines) {
+					break
+				}
+				continue
+			}
+			if strings.HasSuffix(trimmed, escape) {
+				parts = append(parts, strings.TrimSuffix(trimmed, escape))
+				n++
+				if n == len(lines) {
+					break
+				}
+				continue
+			}
+			parts = append(parts, trimmed)
+			n++
+			break
+		}
+
+		original := strings.TrimSpace(strings.Join(parts, ""))
+		if original == "" {
+			// a lone escape character continued by nothing
+			continue
+		}
+		inst, err := newInstruction(original, start+1)
+		if err != nil {
+			return nil, err
+		}
+		inst.EndLine = n
+		if inst.Cmd == "RUN" || inst.Cmd == "COPY" || inst.Cmd == "ADD" {
+			for _, m := range heredocRE.FindAllStringSubmatch(inst.Original, -1) {
+				var body []string
+				for n < len(lines) {
+					text := lines[n]
+					n++
+					if m[1] == "-" {
+						text = strings.TrimLeft(text, "\t")
+					}
+					if text == m[3] {
+						break
+					}
+					body = append(body, text)
+				}
+				inst.Heredocs = append(inst.Heredocs, strings.Join(body, "\n"))
+				inst.EndLine = n
+			}
+		}
+		instructions = append(instructions, inst)
+	}
+	return instructions, nil
+}
+
+// newInstruction parses a single instruction with its continuations joined.
+func newInstruction(original string, line int) (Instruction, error) {
+	fields := strings.Fields(original)
+	if len(fields) == 0 {
+		return Instruction{}, fmt.Errorf("line %d: empty instruction", line)
+	}
+	inst := Instruction{Cmd: strings.ToUpper(fields[0]), Original: original, StartLine: line}
+	rest := strings.TrimSpace(original[len(fields[0]):])
+
+	// flags, e.g. --from=build, come before the arguments
+	for strings.HasPrefix(rest, "--") {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		inst.Flags = append(inst.Flags, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+
+	if strings.HasPrefix(rest, "[") {
+		var args []string
+		if err := json.Unmarshal([]byte(rest), &args); err == nil {
+			inst.Args = args
+			inst.JSON = true
+			return inst, nil
+		}
+	}
+	switch inst.Cmd {
+	case "RUN", "CMD", "ENTRYPOINT", "SHELL", "HEALTHCHECK":
+		if rest != "" {
+			inst.Args = []string{rest}
+		}
+	default:
+		inst.Args = splitWords(rest)
+	}
+	return inst, nil
+}
+
+// splitWords splits arguments on whitespace, keeping quoted words together
+// and removing the quotes.
+func splitWords(s string) []string {
+	var (
+		words   []string
+		word    strings.Builder
+		quote   rune
+		inWord  bool
+		escaped bool
+	)
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			word.WriteRune(c)
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// Flag returns the value of the flag, e.g. build for --from=build.
+func (i Instruction) Flag(name string) string {
+	for _, flag := range i.Flags {
+		if strings.HasPrefix(flag, "--"+name+"=") {
+			return strings.TrimPrefix(flag, "--"+name+"=")
+		}
+	}
+	return ""
+}
+
+func newStage(index int, from Instruction) (Stage, error) {
+	stage := Stage{Index: index, From: from, Platform: from.Flag("platform")}
+	switch {
+	case len(from.Args) == 1:
+	case len(from.Args) == 3 && strings.EqualFold(from.Args[1], "AS"):
+		stage.Name = strings.ToLower(from.Args[2])
+	default:
+		return Stage{}, fmt.Errorf("line %d: invalid FROM instruction %q", from.StartLine, from.Original)
+	}
+	stage.Base = from.Args[0]
+	return stage, nil
+}
+
+func parseArgs(inst Instruction) []Arg {
+	var args []Arg
+	for _, word := range inst.Args {
+		parts := strings.SplitN(word, "=", 2)
+		arg := Arg{Name: parts[0], Line: inst.StartLine}
+		if len(parts) == 2 {
+			arg.Default, arg.HasDefault = parts[1], true
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// ID returns the name of the stage, or its index when unnamed.
+func (s Stage) ID() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return strconv.Itoa(s.Index)
+}
+
+// StageIDs returns the name, or index when unnamed, of each stage.
+func (d *Dockerfile) StageIDs() []string {
+	var ids []string
+	for _, stage := range d.Stages {
+		ids = append(ids, stage.ID())
+	}
+	return ids
+}
+
+// Stage returns the stage with the name, matched case insensitively, or
+// index.
+func (d *Dockerfile) Stage(target string) (Stage, bool) {
+	for _, stage := range d.Stages {
+		if strings.EqualFold(stage.Name, target) || strconv.Itoa(stage.Index) == target {
+			return stage, true
+		}
+	}
+	return Stage{}, false
+}
+
+// BaseImages returns the images the Dockerfile builds on, with variables
+// substituted from the build args and the defaults of the meta args. Stages
+// built on earlier stages and scratch are skipped.
+func (d *Dockerfile) BaseImages(buildArgs []string) []string {
+	args := map[string]string{}
+	for _, arg := range d.MetaArgs {
+		if arg.HasDefault {
+			args[arg.Name] = strings.Trim(arg.Default, `"'`)
+		}
+	}
+	for _, arg := range buildArgs {
+		parts := strings.SplitN(arg, "=", 2)
+		if _, declared := args[parts[0]]; len(parts) == 2 && (declared || d.declaresMetaArg(parts[0])) {
+			args[parts[0]] = parts[1]
+		}
+	}
+
+	var images []string
+	stages := map[string]bool{"scratch": true}
+	seen := map[string]bool{}
+	for _, stage := range d.Stages {
+		image := variableRE.ReplaceAllStringFunc(stage.Base, func(v string) string {
+			return args[variableRE.FindStringSubmatch(v)[1]]
+		})
+		if image != "" && !stages[strings.ToLower(image)] && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+		if stage.Name != "" {
+			stages[stage.Name] = true
+		}
+	}
+	return images
+}
+
+// DeclaresArg returns true if an ARG instruction of any stage, or before the
+// first stage, declares the arg.
+func (d *Dockerfile) DeclaresArg(name string) bool {
+	if d.declaresMetaArg(name) {
+		return true
+	}
+	for _, stage := range d.Stages {
+		for _, arg := range stage.Args {
+			if arg.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *Dockerfile) declaresMetaArg(name string) bool {
+	for _, arg := range d.MetaArgs {
+		if arg.Name == name {
+			return true
+		}
+	}
+	return false
+}
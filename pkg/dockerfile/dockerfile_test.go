@@ -0,0 +1,151 @@
+package dockerfile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const multiStage = `# syntax=docker/dockerfile:1
+ARG GO_VERSION=1.21
+ARG BASE
+
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION} AS Build
+ARG VERSION="dev"
+# comment
+COPY go.mod go.sum ./
+RUN go mod download && \
+    # comments within continuations are removed
+    go build \
+      -o /app .
+
+FROM scratch
+COPY --from=build --chown=1000 /app /app
+COPY ["config.json", "/etc/app/"]
+COPY <<EOF /etc/motd
+hello
+EOF
+ENTRYPOINT ["/app"]
+`
+
+func TestParse(t *testing.T) {
+	d, err := Parse(strings.NewReader(multiStage))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantMeta := []Arg{
+		{Name: "GO_VERSION", Default: "1.21", HasDefault: true, Line: 2},
+		{Name: "BASE", Line: 3},
+	}
+	if diff := cmp.Diff(wantMeta, d.MetaArgs); diff != "" {
+		t.Errorf("meta args mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"build", "1"}, d.StageIDs()); diff != "" {
+		t.Errorf("stages mismatch (-want +got):\n%s", diff)
+	}
+	build, release := d.Stages[0], d.Stages[1]
+	if build.Base != "golang:${GO_VERSION}" || build.Platform != "$BUILDPLATFORM" {
+		t.Errorf("unexpected build stage base %q platform %q", build.Base, build.Platform)
+	}
+	if diff := cmp.Diff([]Arg{{Name: "VERSION", Default: "dev", HasDefault: true, Line: 6}}, build.Args); diff != "" {
+		t.Errorf("stage args mismatch (-want +got):\n%s", diff)
+	}
+
+	run := build.Instructions[2]
+	if run.Cmd != "RUN" || run.StartLine != 9 || run.EndLine != 12 {
+		t.Errorf("unexpected RUN instruction %+v", run)
+	}
+	if want := "go mod download &&     go build       -o /app ."; run.Args[0] != want {
+		t.Errorf("got RUN arguments %q, want %q", run.Args[0], want)
+	}
+
+	wantCopies := []Copy{
+		{Sources: []string{"/app"}, Dest: "/app", From: "build", Line: 15},
+		{Sources: []string{"config.json"}, Dest: "/etc/app/", Line: 16},
+		{Sources: []string{"<<EOF"}, Dest: "/etc/motd", Line: 17},
+	}
+	if diff := cmp.Diff(wantCopies, release.Copies); diff != "" {
+		t.Errorf("copies mismatch (-want +got):\n%s", diff)
+	}
+	heredoc := release.Instructions[2]
+	if heredoc.EndLine != 19 || len(heredoc.Heredocs) != 1 || heredoc.Heredocs[0] != "hello" {
+		t.Errorf("unexpected heredoc instruction %+v", heredoc)
+	}
+	if entrypoint := release.Instructions[3]; !entrypoint.JSON || entrypoint.StartLine != 20 {
+		t.Errorf("unexpected ENTRYPOINT instruction %+v", entrypoint)
+	}
+
+	if _, ok := d.Stage("BUILD"); !ok {
+		t.Error("expected stage BUILD to match case insensitively")
+	}
+	if _, ok := d.Stage("1"); !ok {
+		t.Error("expected stage 1 to match by index")
+	}
+	if _, ok := d.Stage("test"); ok {
+		t.Error("expected stage test not to exist")
+	}
+}
+
+func TestParse_escape(t *testing.T) {
+	d, err := Parse(strings.NewReader("# escape=`\nFROM mcr.microsoft.com/windows/nanoserver\nCOPY a.txt `\n  C:\\app\\\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Copy{{Sources: []string{"a.txt"}, Dest: `C:\app\`, Line: 3}}
+	if diff := cmp.Diff(want, d.Stages[0].Copies); diff != "" {
+		t.Errorf("copies mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParse_continuations(t *testing.T) {
+	d, err := Parse(strings.NewReader("FROM alpine\nRUN apk add \\\n\n    curl\n\\\nCOPY a /a\n\\\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	insts := d.Stages[0].Instructions
+	if len(insts) != 2 {
+		t.Fatalf("expected 2 instructions, got %+v", insts)
+	}
+	if run := insts[0]; run.Args[0] != "apk add     curl" || run.StartLine != 2 || run.EndLine != 4 {
+		t.Errorf("expected the empty line within the continuation skipped, got %+v", run)
+	}
+	if copy := insts[1]; copy.Cmd != "COPY" || copy.StartLine != 5 {
+		t.Errorf("expected a lone escape line continued into COPY, got %+v", copy)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	tests := []string{
+		"RUN true\nFROM scratch\n",
+		"FROM alpine AS\n",
+		"# escape=x\nFROM scratch\n",
+	}
+	for _, dockerfile := range tests {
+		if _, err := Parse(strings.NewReader(dockerfile)); err == nil {
+			t.Errorf("expected an error parsing %q", dockerfile)
+		}
+	}
+}
+
+func TestBaseImages(t *testing.T) {
+	d, err := Parse(strings.NewReader(`ARG BASE=alpine:3.18
+FROM golang:1.21 AS build
+FROM build AS test
+FROM scratch
+FROM $BASE
+FROM ${UNDECLARED}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"golang:1.21", "alpine:3.18"}, d.BaseImages(nil)); diff != "" {
+		t.Errorf("base images mismatch (-want +got):\n%s", diff)
+	}
+	got := d.BaseImages([]string{"BASE=debian:12", "UNDECLARED=busybox"})
+	if diff := cmp.Diff([]string{"golang:1.21", "debian:12"}, got); diff != "" {
+		t.Errorf("base images mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,141 @@
+package dockerhub
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultTokenURL is the Docker Hub endpoint issuing access tokens.
+const DefaultTokenURL = "https://hub.docker.com/v2/auth/token"
+
+// refreshMargin is how long before expiry a token is refreshed.
+const refreshMargin = time.Minute
+
+// Token is a short-lived Docker Hub access token.
+type Token struct {
+	AccessToken string
+	ExpiresAt   time.Time // zero when the expiry is unknown
+}
+
+// Exchanger exchanges an identity token, such as a Drone OIDC token, for a
+// Docker Hub access token.
+type Exchanger struct {
+	URL        string // Token endpoint, defaults to DefaultTokenURL
+	Identifier string // Docker Hub organization or user
+	Secret     string // Identity token presented to the endpoint
+	HTTP       *http.Client
+}
+
+// Exchange requests a new access token.
+func (e Exchanger) Exchange(ctx context.Context) (Token, error) {
+	endpoint := e.URL
+	if endpoint == "" {
+		endpoint = DefaultTokenURL
+	}
+	client := e.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	body, err := json.Marshal(map[string]string{"identifier": e.Identifier, "secret": e.Secret})
+	if err != nil {
+		return Token{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return Token{}, errors.Wrap(err, "failed to exchange docker hub token")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		return Token{}, fmt.Errorf("docker hub token exchange failed with status %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return Token{}, errors.Wrap(err, "failed to decode docker hub token response")
+	}
+	if out.AccessToken == "" {
+		return Token{}, fmt.Errorf("docker hub token response did not contain an access token")
+	}
+
+	token := Token{AccessToken: out.AccessToken, ExpiresAt: jwtExpiry(out.AccessToken)}
+	if token.ExpiresAt.IsZero() && out.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// KeepFresh exchanges a new token shortly before the current one expires and
+// passes it to update, until the context is cancelled. Failures are reported
+// and retried, as the current token may still outlive the build.
+func (e Exchanger) KeepFresh(ctx context.Context, current Token, update func(Token) error) {
+	for !current.ExpiresAt.IsZero() {
+		wait := time.Until(current.ExpiresAt) - refreshMargin
+		if wait < 0 {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		token, err := e.Exchange(ctx)
+		if err == nil {
+			err = update(token)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Printf("failed to refresh docker hub token: %s\n", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+		current = token
+	}
+}
+
+// jwtExpiry returns the exp claim of a JWT, or the zero time when the token
+// is not a JWT.
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,69 @@
+package dockerhub
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExchange(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	access := "e30." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp))) + ".sig"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		if in["identifier"] != "acme" || in["secret"] != "oidc-jwt" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": access})
+	}))
+	defer server.Close()
+
+	token, err := Exchanger{URL: server.URL, Identifier: "acme", Secret: "oidc-jwt"}.Exchange(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != access {
+		t.Errorf("unexpected access token %q", token.AccessToken)
+	}
+	if token.ExpiresAt.Unix() != exp {
+		t.Errorf("unexpected expiry %v", token.ExpiresAt)
+	}
+
+	if _, err := (Exchanger{URL: server.URL, Identifier: "acme", Secret: "wrong"}).Exchange(context.Background()); err == nil {
+		t.Errorf("expected error for rejected exchange")
+	}
+}
+
+func TestKeepFresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "refreshed", "expires_in": 3600})
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	updated := make(chan Token, 1)
+	current := Token{AccessToken: "initial", ExpiresAt: time.Now()}
+	go Exchanger{URL: server.URL}.KeepFresh(ctx, current, func(token Token) error {
+		updated <- token
+		return nil
+	})
+
+	select {
+	case token := <-updated:
+		if token.AccessToken != "refreshed" {
+			t.Errorf("unexpected token %q", token.AccessToken)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("token was not refreshed")
+	}
+}
@@ -0,0 +1,170 @@
+// Package dockerignore evaluates .dockerignore files with the rules of the
+// docker cli: patterns are matched against slash separated paths relative to
+// the context, * and ? do not match separators, ** matches any number of
+// directories, a pattern excluding a directory excludes its content, and
+// patterns starting with ! re-include paths. The last matching pattern wins.
+package dockerignore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type pattern struct {
+	text    string
+	re      *regexp.Regexp
+	include bool // pattern starting with !
+}
+
+// Matcher matches paths against the patterns of a .dockerignore file.
+type Matcher struct {
+	patterns []pattern
+	includes bool // some patterns re-include paths
+}
+
+// ReadFile reads the patterns of the file, returning an empty matcher when
+// the file does not exist.
+func ReadFile(file string) (*Matcher, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return &Matcher{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read reads the patterns, one per line. Empty lines and lines starting
+// with # are ignored.
+func Read(r io.Reader) (*Matcher, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return New(patterns)
+}
+
+// New compiles the patterns.
+func New(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, text := range patterns {
+		p := pattern{text: text}
+		if strings.HasPrefix(text, "!") {
+			p.include = true
+			text = strings.TrimSpace(text[1:])
+		}
+		text = strings.TrimPrefix(path.Clean(filepath.ToSlash(text)), "/")
+		if text == "." || text == "" {
+			// matches the context itself, which is never excluded
+			continue
+		}
+		re, err := compile(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %s", p.text, err)
+		}
+		p.re = re
+		m.includes = m.includes || p.include
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+// compile translates a pattern into an anchored regular expression.
+func compile(text string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '*' && i+1 < len(text) && text[i+1] == '*':
+			i++
+			if i+1 < len(text) && text[i+1] == '/' {
+				// **/ matches zero or more directories
+				i++
+				b.WriteString("(?:.*/)?")
+			} else {
+				b.WriteString(".*")
+			}
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(text[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := text[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(text):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(text[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Excluded returns true if the path, relative to the context and slash
+// separated, is excluded from the context.
+func (m *Matcher) Excluded(rel string) bool {
+	rel = strings.TrimPrefix(path.Clean(filepath.ToSlash(rel)), "/")
+	if rel == "." || m == nil {
+		return false
+	}
+	excluded := false
+	for _, p := range m.patterns {
+		if p.include == !excluded {
+			// the pattern cannot change the result
+			continue
+		}
+		if p.matches(rel) {
+			excluded = !p.include
+		}
+	}
+	return excluded
+}
+
+// matches returns true if the pattern matches the path or one of its
+// parent directories.
+func (p pattern) matches(rel string) bool {
+	for dir := rel; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if p.re.MatchString(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipDir returns true if the directory and all its content are excluded,
+// so walks need not descend into it.
+func (m *Matcher) SkipDir(rel string) bool {
+	return m != nil && !m.includes && m.Excluded(rel)
+}
+
+// Empty returns true if there are no patterns.
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.patterns) == 0
+}
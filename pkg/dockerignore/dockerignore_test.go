@@ -0,0 +1,71 @@
+package dockerignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatcher_Excluded(t *testing.T) {
+	m, err := Read(strings.NewReader(`# comment
+node_modules
+*.log
+/build
+docs/**/*.md
+!docs/README.md
+**/.cache
+tmp?
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{
+		"node_modules":              true,
+		"node_modules/pkg/index.js": true,
+		"app/node_modules":          false,
+		"error.log":                 true,
+		"logs/error.log":            false,
+		"build/app":                 true,
+		"docs/README.md":            false,
+		"docs/guide.md":             true,
+		"docs/api/v1/index.md":      true,
+		"docs/api/v1/index.html":    false,
+		".cache/x":                  true,
+		"web/.cache":                true,
+		"tmp1":                      true,
+		"tmp12":                     false,
+		"main.go":                   false,
+		".":                         false,
+	} {
+		if got := m.Excluded(path); got != want {
+			t.Errorf("%s: got excluded %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestMatcher_SkipDir(t *testing.T) {
+	m, err := New([]string{"vendor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.SkipDir("vendor") {
+		t.Error("expected the excluded directory to be skipped")
+	}
+
+	// an exception may re-include content of the excluded directory
+	m, err = New([]string{"vendor", "!vendor/modules.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.SkipDir("vendor") {
+		t.Error("expected the directory not to be skipped with exceptions")
+	}
+	if m.Excluded("vendor/modules.txt") {
+		t.Error("expected the exception to be included")
+	}
+}
+
+func TestNew_invalid(t *testing.T) {
+	if _, err := New([]string{"[abc"}); err == nil {
+		t.Error("expected an error for an unterminated character class")
+	}
+}
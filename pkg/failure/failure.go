@@ -0,0 +1,121 @@
+// Package failure classifies build failures into categories with distinct
+// exit codes, so pipelines can branch on the type of failure.
+package failure
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"regexp"
+)
+
+// Category is a class of build failure.
+type Category string
+
+// Failure categories.
+const (
+	Unknown         Category = "unknown"
+	Auth            Category = "auth"
+	PushDenied      Category = "push_denied"
+	ImageNotFound   Category = "image_not_found"
+	DiskFull        Category = "disk_full"
+	OutOfMemory     Category = "out_of_memory"
+	DockerfileError Category = "dockerfile_syntax"
+	CommandFailed   Category = "command_failed"
+	RateLimited     Category = "rate_limited"
+)
+
+// exitCodes are the documented exit codes of each category.
+var exitCodes = map[Category]int{
+	Unknown:         1,
+	Auth:            10,
+	PushDenied:      11,
+	ImageNotFound:   12,
+	DiskFull:        13,
+	OutOfMemory:     14,
+	DockerfileError: 15,
+	CommandFailed:   16,
+	RateLimited:     17,
+}
+
+// patterns are matched against the build output in order, the first
+// matching category wins.
+var patterns = []struct {
+	category Category
+	pattern  *regexp.Regexp
+}{
+	{DiskFull, regexp.MustCompile(`(?i)no space left on device|disk quota exceeded`)},
+	{OutOfMemory, regexp.MustCompile(`(?i)out of memory|cannot allocate memory|oom-?kill`)},
+	{DockerfileError, regexp.MustCompile(`(?i)dockerfile parse error|unknown instruction|parsing dockerfile|error parsing|unknown flag:`)},
+	{RateLimited, regexp.MustCompile(`(?i)TOOMANYREQUESTS|429 Too Many Requests|pull rate limit`)},
+	{PushDenied, regexp.MustCompile(`(?i)\bDENIED\b|insufficient_scope|403 Forbidden|not authorized to perform|requested access to the resource is denied`)},
+	{Auth, regexp.MustCompile(`(?i)\bUNAUTHORIZED\b|authentication required|401 Unauthorized|no basic auth credentials|invalid username/password|incorrect username or password`)},
+	{ImageNotFound, regexp.MustCompile(`(?i)MANIFEST_UNKNOWN|manifest unknown|NAME_UNKNOWN|repository does not exist|retrieving image .*: .*not found`)},
+	{CommandFailed, regexp.MustCompile(`(?i)failed to execute command|waiting for process to exit: exit status`)},
+}
+
+// Failure describes a classified build failure.
+type Failure struct {
+	Category Category `json:"category"`
+	ExitCode int      `json:"exit_code"`
+	Message  string   `json:"message"`
+	Line     string   `json:"line,omitempty"` // Output line the category was derived from
+}
+
+// Error is a classified build error.
+type Error struct {
+	Failure
+	Err error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Classify classifies the build error using the build output.
+func Classify(err error, output []byte) Failure {
+	f := Failure{Category: Unknown, Message: err.Error()}
+
+	// exit errors of local processes and of executor containers
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 137 {
+		// killed with SIGKILL, most likely by the OOM killer
+		f.Category = OutOfMemory
+	} else {
+	scan:
+		for _, p := range patterns {
+			scanner := bufio.NewScanner(bytes.NewReader(output))
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				if p.pattern.Match(scanner.Bytes()) {
+					f.Category = p.category
+					f.Line = scanner.Text()
+					break scan
+				}
+			}
+		}
+	}
+	f.ExitCode = exitCodes[f.Category]
+	return f
+}
+
+// ExitCode returns the exit code for the error: the category exit code of
+// classified errors, and 1 otherwise.
+func ExitCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.ExitCode
+	}
+	return exitCodes[Unknown]
+}
+
+// WriteSummary writes the failure as JSON to path.
+func WriteSummary(path string, f Failure) error {
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,85 @@
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   Category
+	}{
+		{
+			name:   "auth",
+			output: "error checking push permissions -- make sure you entered the correct tag name, and that you are authenticated correctly, and try again: checking push permission for \"foo/bar:latest\": UNAUTHORIZED: authentication required",
+			want:   Auth,
+		},
+		{
+			name:   "push_denied",
+			output: "checking push permission for \"gcr.io/foo/bar\": DENIED: Permission \"artifactregistry.repositories.uploadArtifacts\" denied",
+			want:   PushDenied,
+		},
+		{
+			name:   "image_not_found",
+			output: "error building image: unable to complete operation after 0 attempts, last error: GET https://index.docker.io/v2/library/alpne/manifests/3.19: MANIFEST_UNKNOWN: manifest unknown",
+			want:   ImageNotFound,
+		},
+		{
+			name:   "disk_full",
+			output: "INFO[0042] RUN npm ci\nerror building image: write /usr/lib/node_modules/foo: no space left on device",
+			want:   DiskFull,
+		},
+		{
+			name:   "dockerfile_syntax",
+			output: "error building image: parsing dockerfile: Dockerfile parse error line 3: unknown instruction: RUNN",
+			want:   DockerfileError,
+		},
+		{
+			name:   "command_failed",
+			output: "error building image: error building stage: failed to execute command: waiting for process to exit: exit status 2",
+			want:   CommandFailed,
+		},
+		{
+			name:   "rate_limited",
+			output: "error building image: GET https://index.docker.io/v2/library/golang/manifests/1.22: TOOMANYREQUESTS: You have reached your pull rate limit. You may increase the limit by authenticating and upgrading",
+			want:   RateLimited,
+		},
+		{
+			name:   "unknown",
+			output: "something unexpected happened",
+			want:   Unknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(errors.New("exit status 1"), []byte("INFO[0000] Retrieving image manifest\n"+tt.output+"\n"))
+			if got.Category != tt.want {
+				t.Errorf("Classify() = %s, want %s", got.Category, tt.want)
+			}
+			if got.ExitCode != exitCodes[tt.want] {
+				t.Errorf("unexpected exit code %d", got.ExitCode)
+			}
+		})
+	}
+}
+
+func TestClassify_Killed(t *testing.T) {
+	err := exec.Command("/bin/sh", "-c", "exit 137").Run()
+	if got := Classify(err, nil); got.Category != OutOfMemory {
+		t.Errorf("Classify() = %s, want %s", got.Category, OutOfMemory)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	err := fmt.Errorf("build failed: %w", &Error{Failure: Failure{Category: DiskFull, ExitCode: 13}, Err: errors.New("exit status 1")})
+	if got := ExitCode(err); got != 13 {
+		t.Errorf("ExitCode() = %d, want 13", got)
+	}
+	if got := ExitCode(errors.New("boom")); got != 1 {
+		t.Errorf("ExitCode() = %d, want 1", got)
+	}
+}
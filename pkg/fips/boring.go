@@ -0,0 +1,15 @@
+//go:build boringcrypto
+
+package fips
+
+import (
+	"crypto/boring"
+	// restrict TLS to FIPS approved settings
+	_ "crypto/tls/fipsonly"
+)
+
+// Enabled returns true if the cryptography of the plugin is provided by
+// the BoringCrypto module.
+func Enabled() bool {
+	return boring.Enabled()
+}
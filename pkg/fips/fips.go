@@ -0,0 +1,14 @@
+// Package fips reports whether the plugin is built with the FIPS 140
+// validated BoringCrypto module. Builds with GOEXPERIMENT=boringcrypto
+// also restrict TLS to FIPS approved versions, cipher suites and curves.
+package fips
+
+import "errors"
+
+// Check returns an error unless the plugin uses the BoringCrypto module.
+func Check() error {
+	if !Enabled() {
+		return errors.New("FIPS mode requires the plugin built with GOEXPERIMENT=boringcrypto, use the fips image")
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package fips
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	if err := Check(); Enabled() != (err == nil) {
+		t.Errorf("check returned %v with the module enabled %t", err, Enabled())
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !boringcrypto
+
+package fips
+
+// Enabled returns true if the cryptography of the plugin is provided by
+// the BoringCrypto module.
+func Enabled() bool {
+	return false
+}
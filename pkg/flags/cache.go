@@ -0,0 +1,16 @@
+package flags
+
+import (
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// CacheRepo returns the cache repository expanded with the cache registry,
+// or with the registry of the command when no cache registry is set.
+func CacheRepo(c *cli.Context, registry string) string {
+	if cacheRegistry := c.String("cache-registry"); cacheRegistry != "" {
+		registry = cacheRegistry
+	}
+	return strings.TrimSuffix(registry, "/") + "/" + c.String("cache-repo")
+}
@@ -0,0 +1,33 @@
+package flags_test
+
+import (
+	"testing"
+
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/flags"
+)
+
+func TestCacheRepo(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--cache-repo", "app/cache"}, "registry.example.com/app/cache"},
+		{[]string{"--cache-repo", "app/cache", "--cache-registry", "cache.svc.cluster.local:5000/"}, "cache.svc.cluster.local:5000/app/cache"},
+	} {
+		var got string
+		app := cli.NewApp()
+		app.Flags = append(flags.Common(), cli.StringFlag{Name: "cache-repo"})
+		app.Action = func(c *cli.Context) error {
+			got = flags.CacheRepo(c, "registry.example.com")
+			return nil
+		}
+		if err := app.Run(append([]string{"plugin"}, test.args...)); err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("want cache repo %s, got %s", test.want, got)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package flags
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/credentials"
+	"github.com/drone/drone-kaniko/pkg/docker"
+)
+
+// DockerConfigSecret writes the docker config of the mounted Kubernetes
+// image pull secret to the docker config directory, merged with an existing
+// config file. The credentials of the plugin are written on top of it
+// according to the merge strategy.
+func DockerConfigSecret(ctx context.Context, c *cli.Context) error {
+	path := c.String("docker-config-secret-path")
+	if path == "" {
+		return nil
+	}
+	chain := credentials.Chain{credentials.Secret{Path: path}}
+	if err := chain.Write(ctx, filepath.Join(c.String("docker-config-dir"), "config.json"), docker.MergeStrategyMerge); err != nil {
+		return errors.Wrap(err, "failed to use the docker config secret")
+	}
+	return nil
+}
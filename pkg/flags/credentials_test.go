@@ -0,0 +1,59 @@
+package flags_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/flags"
+)
+
+func TestScratchDirAndDockerConfigSecret(t *testing.T) {
+	secret := t.TempDir()
+	content := `{"auths": {"registry.example.com": {"auth": "b2N0b2NhdDpzZWNyZXQ="}}}`
+	if err := ioutil.WriteFile(filepath.Join(secret, ".dockerconfigjson"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kanikoDir := t.TempDir()
+
+	var scratch, configDir, digestFile string
+	app := cli.NewApp()
+	app.Flags = flags.Common()
+	app.Action = func(c *cli.Context) error {
+		var err error
+		if scratch, err = flags.ScratchDir(c); err != nil {
+			return err
+		}
+		if err := flags.DockerConfigSecret(context.Background(), c); err != nil {
+			return err
+		}
+		configDir, digestFile = c.String("docker-config-dir"), c.String("digest-file")
+		return nil
+	}
+	if err := app.Run([]string{"plugin", "--kaniko-dir", kanikoDir, "--docker-config-secret-path", secret}); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(scratch)
+
+	if configDir != filepath.Join(scratch, ".docker") || digestFile != filepath.Join(scratch, "digest-file") {
+		t.Errorf("expected the paths in the scratch directory %s, got %s and %s", scratch, configDir, digestFile)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Auths["registry.example.com"]; !ok {
+		t.Errorf("expected the secret credentials in the docker config, got %s", data)
+	}
+}
@@ -0,0 +1,1005 @@
+// Package flags defines the plugin settings shared by all commands, so that
+// every build option is available with the same PLUGIN_ variable for each
+// registry.
+package flags
+
+//go:generate go run ./gen -o ../../docs/settings.md
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+	"github.com/drone/drone-kaniko/pkg/tagger"
+)
+
+var (
+	defaultDockerConfigDir = filepath.Join(sysinfo.KanikoDir, ".docker")
+	defaultDigestFile      = filepath.Join(sysinfo.KanikoDir, "digest-file")
+)
+
+// Common returns the flags of the settings shared by all commands. Registry
+// specific settings, such as the registry, repository and credentials, are
+// defined by the commands.
+func Common() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "dockerfile",
+			Usage:  "build dockerfile, or comma separated candidates of which the first existing is used",
+			Value:  "Dockerfile,Containerfile",
+			EnvVar: "PLUGIN_DOCKERFILE",
+		},
+		cli.StringFlag{
+			Name:   "dockerfile-contents",
+			Usage:  "inline dockerfile contents, used instead of the dockerfile",
+			EnvVar: "PLUGIN_DOCKERFILE_CONTENTS",
+		},
+		cli.StringFlag{
+			Name:   "context",
+			Usage:  "build context",
+			Value:  ".",
+			EnvVar: "PLUGIN_CONTEXT",
+		},
+		cli.StringFlag{
+			Name:   "drone-commit-ref",
+			Usage:  "git commit ref passed by Drone",
+			EnvVar: "DRONE_COMMIT_REF",
+		},
+		cli.StringFlag{
+			Name:   "drone-repo-branch",
+			Usage:  "git repository default branch passed by Drone",
+			EnvVar: "DRONE_REPO_BRANCH",
+		},
+		cli.StringSliceFlag{
+			Name:     "tags",
+			Usage:    "build tags",
+			Value:    &cli.StringSlice{"latest"},
+			EnvVar:   "PLUGIN_TAGS",
+			FilePath: ".tags",
+		},
+		cli.BoolFlag{
+			Name:   "expand-tag",
+			Usage:  "enable for semver tagging",
+			EnvVar: "PLUGIN_EXPAND_TAG",
+		},
+		cli.StringSliceFlag{
+			Name:   "expand-tag-levels",
+			Usage:  "semver levels generated by expand-tag: major, minor, patch (default all)",
+			EnvVar: "PLUGIN_EXPAND_TAG_LEVELS",
+		},
+		cli.BoolFlag{
+			Name:   "expand-tag-latest",
+			Usage:  "also tag expanded releases as latest on the default branch or a git tag",
+			EnvVar: "PLUGIN_EXPAND_TAG_LATEST",
+		},
+		cli.BoolFlag{
+			Name:   "sanitize-tags",
+			Usage:  "lowercase tags and replace characters not allowed in tags with dashes",
+			EnvVar: "PLUGIN_SANITIZE_TAGS",
+		},
+		cli.StringFlag{
+			Name:   "tag-prefix",
+			Usage:  "prefix added to every tag",
+			EnvVar: "PLUGIN_TAG_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "tag-suffix",
+			Usage:  "suffix added to every tag",
+			EnvVar: "PLUGIN_TAG_SUFFIX",
+		},
+		cli.BoolFlag{
+			Name:   "auto-tag",
+			Usage:  "enable auto generation of build tags",
+			EnvVar: "PLUGIN_AUTO_TAG",
+		},
+		cli.StringFlag{
+			Name:   "auto-tag-suffix",
+			Usage:  "the suffix of auto build tags",
+			EnvVar: "PLUGIN_AUTO_TAG_SUFFIX",
+		},
+		cli.BoolFlag{
+			Name:   "calver",
+			Usage:  "add a calendar version tag, e.g. 2024.05.31-42",
+			EnvVar: "PLUGIN_CALVER",
+		},
+		cli.StringFlag{
+			Name:   "calver-template",
+			Usage:  "template of the calendar version tag",
+			Value:  tagger.DefaultCalverTemplate,
+			EnvVar: "PLUGIN_CALVER_TEMPLATE",
+		},
+		cli.StringFlag{
+			Name:   "calver-timezone",
+			Usage:  "timezone of the calendar version date",
+			Value:  "UTC",
+			EnvVar: "PLUGIN_CALVER_TIMEZONE",
+		},
+		cli.StringSliceFlag{
+			Name:   "args",
+			Usage:  "build args",
+			EnvVar: "PLUGIN_BUILD_ARGS",
+		},
+		cli.StringFlag{
+			Name:   "target",
+			Usage:  "build target",
+			EnvVar: "PLUGIN_TARGET",
+		},
+		cli.BoolFlag{
+			Name:   "require-target",
+			Usage:  "fail multi-stage builds that do not set a target",
+			EnvVar: "PLUGIN_REQUIRE_TARGET",
+		},
+		cli.BoolFlag{
+			Name:   "strict-args",
+			Usage:  "fail when build args are not declared in the dockerfile or declared args without a default are not provided",
+			EnvVar: "PLUGIN_STRICT_ARGS",
+		},
+		cli.BoolFlag{
+			Name:   "auto-proxy-args",
+			Usage:  "forward the GOPROXY, NPM_CONFIG_REGISTRY and PIP_INDEX_URL env vars as build args when declared in the dockerfile",
+			EnvVar: "PLUGIN_AUTO_PROXY_ARGS",
+		},
+		cli.StringSliceFlag{
+			Name:   "custom-labels",
+			Usage:  "additional k=v labels",
+			EnvVar: "PLUGIN_CUSTOM_LABELS",
+		},
+		cli.StringFlag{
+			Name:   "labels-file",
+			Usage:  "file of k=v lines or a JSON object of labels, overridden by the custom labels",
+			EnvVar: "PLUGIN_LABELS_FILE",
+		},
+		cli.StringSliceFlag{
+			Name:   "post-labels",
+			Usage:  "k=v labels added to the pushed image after the build, without invalidating the layer cache",
+			EnvVar: "PLUGIN_POST_LABELS",
+		},
+		cli.StringSliceFlag{
+			Name:   "post-annotations",
+			Usage:  "k=v OCI annotations added to the manifest of the pushed image after the build",
+			EnvVar: "PLUGIN_POST_ANNOTATIONS",
+		},
+		cli.StringSliceFlag{
+			Name:   "registry-mirrors",
+			Usage:  "docker registry mirrors",
+			EnvVar: "PLUGIN_REGISTRY_MIRRORS",
+		},
+		cli.StringFlag{
+			Name:   "mirror-preset",
+			Usage:  "mirror docker hub base images are pulled through: gcr, ecr-public or custom",
+			EnvVar: "PLUGIN_MIRROR_PRESET",
+		},
+		cli.StringFlag{
+			Name:   "mirror-prefix",
+			Usage:  "registry and path docker hub repositories are served below by the custom mirror preset",
+			EnvVar: "PLUGIN_MIRROR_PREFIX",
+		},
+		cli.StringSliceFlag{
+			Name:   "mirror-exclude",
+			Usage:  "docker hub images pulled directly despite the mirror preset, e.g. golang or bitnami/*",
+			EnvVar: "PLUGIN_MIRROR_EXCLUDE",
+		},
+		cli.StringFlag{
+			Name:   "hub-pull-credentials",
+			Usage:  "docker hub username:password used to pull base images, distinct from the push credentials",
+			EnvVar: "PLUGIN_HUB_PULL_CREDENTIALS",
+		},
+		cli.StringFlag{
+			Name:   "hub-mirror",
+			Usage:  "registry mirror the build is retried through when docker hub rate limits it",
+			EnvVar: "PLUGIN_HUB_MIRROR",
+		},
+		cli.BoolFlag{
+			Name:   "skip-tls-verify",
+			Usage:  "Skip registry tls verify",
+			EnvVar: "PLUGIN_SKIP_TLS_VERIFY",
+		},
+		cli.StringFlag{
+			Name:   "snapshot-mode",
+			Usage:  "Specify one of full, redo or time as snapshot mode",
+			EnvVar: "PLUGIN_SNAPSHOT_MODE",
+		},
+		cli.BoolFlag{
+			Name:   "enable-cache",
+			Usage:  "Set this flag to opt into caching with kaniko",
+			EnvVar: "PLUGIN_ENABLE_CACHE",
+		},
+		cli.IntFlag{
+			Name:   "cache-ttl",
+			Usage:  "Cache timeout in hours. Defaults to two weeks.",
+			EnvVar: "PLUGIN_CACHE_TTL",
+		},
+		cli.BoolFlag{
+			Name:   "cache-cleanup",
+			Usage:  "delete cached layers older than the cache ttl from the cache repository after a successful build",
+			EnvVar: "PLUGIN_CACHE_CLEANUP",
+		},
+		cli.IntFlag{
+			Name:   "cache-cleanup-limit",
+			Usage:  "most cached layers deleted by a build, unlimited when 0",
+			Value:  100,
+			EnvVar: "PLUGIN_CACHE_CLEANUP_LIMIT",
+		},
+		cli.StringFlag{
+			Name:   "cache-lock",
+			Usage:  "lock the cache repository while building, so concurrent builds do not write to the cache at once: registry, to lock with a tag of the cache repository, or s3://bucket/prefix, gs://bucket/prefix or a shared directory",
+			EnvVar: "PLUGIN_CACHE_LOCK",
+		},
+		cli.DurationFlag{
+			Name:   "cache-lock-timeout",
+			Usage:  "how long to wait for the cache lock held by another build",
+			Value:  10 * time.Minute,
+			EnvVar: "PLUGIN_CACHE_LOCK_TIMEOUT",
+		},
+		cli.BoolFlag{
+			Name:   "cache-lock-skip",
+			Usage:  "build reading the cache without writing to it when the cache lock is not acquired within the timeout, instead of failing",
+			EnvVar: "PLUGIN_CACHE_LOCK_SKIP",
+		},
+		cli.StringFlag{
+			Name:   "cache-registry",
+			Usage:  "registry the cache repository is expanded with, defaults to the registry of the image",
+			EnvVar: "PLUGIN_CACHE_REGISTRY",
+		},
+		cli.BoolFlag{
+			Name:   "cache-registry-insecure",
+			Usage:  "access the cache registry over plain http",
+			EnvVar: "PLUGIN_CACHE_REGISTRY_INSECURE",
+		},
+		cli.StringFlag{
+			Name:   "cache-username",
+			Usage:  "username for the cache repository, when the registry credentials cannot push to it",
+			EnvVar: "PLUGIN_CACHE_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "cache-password",
+			Usage:  "password for the cache repository",
+			EnvVar: "PLUGIN_CACHE_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:   "cache-bust",
+			Usage:  "token passed as the KANIKO_CACHE_BUST build arg, a new value invalidates the cache of the cache bust stage",
+			EnvVar: "PLUGIN_CACHE_BUST",
+		},
+		cli.StringFlag{
+			Name:   "cache-bust-stage",
+			Usage:  "stage, by name or index, invalidated by the cache bust token (default all stages)",
+			EnvVar: "PLUGIN_CACHE_BUST_STAGE",
+		},
+		cli.BoolFlag{
+			Name:   "cache-keys",
+			Usage:  "print the cache key of each command and whether it hit the cache",
+			EnvVar: "PLUGIN_CACHE_KEYS",
+		},
+		cli.StringFlag{
+			Name:   "artifact-file",
+			Usage:  "Artifact file location that will be generated by the plugin. This file will include information of docker images that are uploaded by the plugin.",
+			EnvVar: "PLUGIN_ARTIFACT_FILE",
+		},
+		cli.StringFlag{
+			Name:   "artifact-schema",
+			Usage:  "schema of the artifact file, v1 or v2 with tags, platforms, attached artifacts and build metadata",
+			Value:  "v1",
+			EnvVar: "PLUGIN_ARTIFACT_SCHEMA",
+		},
+		cli.BoolFlag{
+			Name:   "no-push",
+			Usage:  "Set this flag if you only want to build the image, without pushing to a registry",
+			EnvVar: "PLUGIN_NO_PUSH",
+		},
+		cli.BoolFlag{
+			Name:   "probe-push",
+			Usage:  "check the push permission on the repository and cache repository before building, by starting and cancelling a blob upload",
+			EnvVar: "PLUGIN_PROBE_PUSH",
+		},
+		cli.StringFlag{
+			Name:   "push-permission-check",
+			Usage:  "push permission check before the build: kaniko, probe by the plugin, or none, e.g. for air-gapped registries; probe when probe-push is set, kaniko otherwise",
+			EnvVar: "PLUGIN_PUSH_PERMISSION_CHECK",
+		},
+		cli.StringFlag{
+			Name:   "tar-path",
+			Usage:  "Set this flag to save the image as a tarball at path",
+			EnvVar: "PLUGIN_TAR_PATH",
+		},
+		cli.StringFlag{
+			Name:   "oci-layout",
+			Usage:  "directory the image is saved to as an oci layout, pushed by a later push-only step",
+			EnvVar: "PLUGIN_OCI_LAYOUT",
+		},
+		cli.BoolFlag{
+			Name:   "push-only",
+			Usage:  "push the oci layout saved by an earlier step with the tags of this step instead of building",
+			EnvVar: "PLUGIN_PUSH_ONLY",
+		},
+		cli.StringFlag{
+			Name:   "verbosity",
+			Usage:  "Set this flag with value as oneof <panic|fatal|error|warn|info|debug|trace> to set the logging level for kaniko. Defaults to info.",
+			EnvVar: "PLUGIN_VERBOSITY",
+		},
+		cli.BoolFlag{
+			Name:   "log-timestamps",
+			Usage:  "prefix the log lines of the plugin and the executor with timestamps",
+			EnvVar: "PLUGIN_LOG_TIMESTAMPS",
+		},
+		cli.StringFlag{
+			Name:   "log-color",
+			Usage:  "colored log output of the plugin and the executor: auto, always or never, e.g. for log viewers showing ANSI codes",
+			Value:  "auto",
+			EnvVar: "PLUGIN_LOG_COLOR",
+		},
+		cli.StringFlag{
+			Name:   "platform",
+			Usage:  "Allows to build with another default platform than the host, similarly to docker build --platform",
+			EnvVar: "PLUGIN_PLATFORM",
+		},
+		cli.BoolFlag{
+			Name:   "skip-unused-stages",
+			Usage:  "build only used stages",
+			EnvVar: "PLUGIN_SKIP_UNUSED_STAGES",
+		},
+		cli.BoolFlag{
+			Name:   "cleanup",
+			Usage:  "clean the filesystem at the end of the build, so builds can run one after another in the same container",
+			EnvVar: "PLUGIN_CLEANUP",
+		},
+		cli.StringFlag{
+			Name:   "output-file",
+			Usage:  "Output file location that will be generated by the plugin. This file will include information of the output that are exported by the plugin.",
+			EnvVar: "DRONE_OUTPUT",
+		},
+		cli.StringFlag{
+			Name:   "output-bucket",
+			Usage:  "bucket (s3://bucket/path or gs://bucket/path) the image tarball, reports and diagnostics are uploaded to",
+			EnvVar: "PLUGIN_OUTPUT_BUCKET",
+		},
+		cli.StringFlag{
+			Name:   "output-prefix",
+			Usage:  "key prefix of the files uploaded to the output bucket",
+			EnvVar: "PLUGIN_OUTPUT_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "gitops-repo",
+			Usage:  "GitOps repository updated with the pushed image tag",
+			EnvVar: "PLUGIN_GITOPS_REPO",
+		},
+		cli.StringFlag{
+			Name:   "gitops-branch",
+			Usage:  "GitOps repository branch. Defaults to the remote default branch",
+			EnvVar: "PLUGIN_GITOPS_BRANCH",
+		},
+		cli.StringFlag{
+			Name:   "gitops-username",
+			Usage:  "GitOps repository username used with the token",
+			EnvVar: "PLUGIN_GITOPS_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "gitops-token",
+			Usage:  "GitOps repository token",
+			EnvVar: "PLUGIN_GITOPS_TOKEN",
+		},
+		cli.StringSliceFlag{
+			Name:   "gitops-manifests",
+			Usage:  "GitOps manifest files in which the image reference is updated",
+			EnvVar: "PLUGIN_GITOPS_MANIFESTS",
+		},
+		cli.StringFlag{
+			Name:   "gitops-commit-message",
+			Usage:  "GitOps commit message template",
+			EnvVar: "PLUGIN_GITOPS_COMMIT_MESSAGE",
+		},
+		cli.StringFlag{
+			Name:   "gitops-author-name",
+			Usage:  "GitOps commit author name",
+			EnvVar: "PLUGIN_GITOPS_AUTHOR_NAME",
+		},
+		cli.StringFlag{
+			Name:   "gitops-author-email",
+			Usage:  "GitOps commit author email",
+			EnvVar: "PLUGIN_GITOPS_AUTHOR_EMAIL",
+		},
+		cli.StringFlag{
+			Name:   "status-provider",
+			Usage:  "provider the commit status is published to, github, gitea or gitlab",
+			Value:  "github",
+			EnvVar: "PLUGIN_STATUS_PROVIDER",
+		},
+		cli.StringFlag{
+			Name:   "status-url",
+			Usage:  "api url of the status provider, defaults to the public github or gitlab api",
+			EnvVar: "PLUGIN_STATUS_URL",
+		},
+		cli.StringFlag{
+			Name:   "status-token",
+			Usage:  "token publishing the commit status, enables publishing",
+			EnvVar: "PLUGIN_STATUS_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "status-context",
+			Usage:  "name of the commit status",
+			Value:  "image",
+			EnvVar: "PLUGIN_STATUS_CONTEXT",
+		},
+		cli.BoolFlag{
+			Name:   "status-check-run",
+			Usage:  "publish a github check run instead of a commit status",
+			EnvVar: "PLUGIN_STATUS_CHECK_RUN",
+		},
+		cli.StringFlag{
+			Name:   "status-repo",
+			Usage:  "repository the commit status is published to, as owner/name",
+			EnvVar: "PLUGIN_STATUS_REPO,DRONE_REPO",
+		},
+		cli.StringFlag{
+			Name:   "status-target-url",
+			Usage:  "link of the commit status",
+			EnvVar: "PLUGIN_STATUS_TARGET_URL,DRONE_BUILD_LINK",
+		},
+		cli.BoolFlag{
+			Name:   "skip-if-exists",
+			Usage:  "Skip the build when the image already exists in the registry. Uses a tag derived from the build context hash unless tags are provided",
+			EnvVar: "PLUGIN_SKIP_IF_EXISTS",
+		},
+		cli.BoolFlag{
+			Name:   "content-tag",
+			Usage:  "add a content-<hash> tag derived from the build context, Dockerfile, build args, target and platform",
+			EnvVar: "PLUGIN_CONTENT_TAG",
+		},
+		cli.StringFlag{
+			Name:   "drone-commit-before",
+			Usage:  "git commit sha before the change passed by Drone",
+			EnvVar: "DRONE_COMMIT_BEFORE",
+		},
+		cli.StringFlag{
+			Name:   "drone-commit-after",
+			Usage:  "git commit sha after the change passed by Drone",
+			EnvVar: "DRONE_COMMIT_AFTER",
+		},
+		cli.StringSliceFlag{
+			Name:   "trigger-paths",
+			Usage:  "Only build when a file changed between the before and after commits matches one of these globs",
+			EnvVar: "PLUGIN_TRIGGER_PATHS",
+		},
+		cli.StringFlag{
+			Name:   "context-sub-path",
+			Usage:  "sub path within the build context to use as the context root",
+			EnvVar: "PLUGIN_CONTEXT_SUB_PATH",
+		},
+		cli.StringSliceFlag{
+			Name:   "extra-contexts",
+			Usage:  "named directories (name=path) staged into the build context under <name>/ of the context root",
+			EnvVar: "PLUGIN_EXTRA_CONTEXTS",
+		},
+		cli.StringSliceFlag{
+			Name:   "secrets",
+			Usage:  "build secrets (id=envvar or id=filepath) for RUN --mount=type=secret",
+			EnvVar: "PLUGIN_SECRETS",
+		},
+		cli.StringSliceFlag{
+			Name:   "secret-args",
+			Usage:  "build args (ARGNAME=SECRET_ENV_NAME) read from environment variables and kept out of the logs",
+			EnvVar: "PLUGIN_SECRET_ARGS",
+		},
+		cli.StringFlag{
+			Name:   "ssh-key",
+			Usage:  "private ssh key exposed to RUN steps through GIT_SSH_COMMAND",
+			EnvVar: "PLUGIN_SSH_KEY",
+		},
+		cli.StringFlag{
+			Name:   "ssh-known-hosts",
+			Usage:  "ssh known hosts used with the ssh key",
+			EnvVar: "PLUGIN_SSH_KNOWN_HOSTS",
+		},
+		cli.StringFlag{
+			Name:   "ssh-agent-sock",
+			Usage:  "ssh agent socket exposed to RUN steps through SSH_AUTH_SOCK",
+			EnvVar: "PLUGIN_SSH_AGENT_SOCK",
+		},
+		cli.StringSliceFlag{
+			Name:   "volumes",
+			Usage:  "runner directories exposed to RUN steps, as src:dst",
+			EnvVar: "PLUGIN_VOLUMES",
+		},
+		cli.StringFlag{
+			Name:   "netrc-machine",
+			Usage:  "netrc machine used to fetch remote git contexts",
+			EnvVar: "PLUGIN_NETRC_MACHINE,DRONE_NETRC_MACHINE",
+		},
+		cli.StringFlag{
+			Name:   "netrc-login",
+			Usage:  "netrc login",
+			EnvVar: "PLUGIN_NETRC_LOGIN,DRONE_NETRC_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "netrc-password",
+			Usage:  "netrc password",
+			EnvVar: "PLUGIN_NETRC_PASSWORD,DRONE_NETRC_PASSWORD",
+		},
+		cli.StringFlag{
+			Name:   "ca-cert",
+			Usage:  "pem encoded ca certificates trusted by the plugin and for the registries",
+			EnvVar: "PLUGIN_CA_CERT",
+		},
+		cli.StringFlag{
+			Name:   "ca-cert-path",
+			Usage:  "path of the pem encoded ca certificates trusted by the plugin and for the registries",
+			EnvVar: "PLUGIN_CA_CERT_PATH",
+		},
+		cli.StringSliceFlag{
+			Name:   "registry-client-cert",
+			Usage:  "client certificates for registries enforcing mutual tls, as registry=envvar or registry=filepath",
+			EnvVar: "PLUGIN_REGISTRY_CLIENT_CERT",
+		},
+		cli.StringSliceFlag{
+			Name:   "registry-client-key",
+			Usage:  "keys of the registry client certificates, as registry=envvar or registry=filepath",
+			EnvVar: "PLUGIN_REGISTRY_CLIENT_KEY",
+		},
+		cli.StringFlag{
+			Name:   "kaniko-dir",
+			Usage:  "directory kaniko keeps its state in",
+			EnvVar: "PLUGIN_KANIKO_DIR",
+		},
+		cli.StringFlag{
+			Name:   "scratch-dir",
+			Usage:  "directory the per-run scratch directories are created in, defaults to builds in the kaniko directory",
+			EnvVar: "PLUGIN_SCRATCH_DIR",
+		},
+		cli.BoolTFlag{
+			Name:   "ignore-var-run",
+			Usage:  "ignore /var/run when snapshotting",
+			EnvVar: "PLUGIN_IGNORE_VAR_RUN",
+		},
+		cli.StringSliceFlag{
+			Name:   "ignore-paths",
+			Usage:  "paths ignored when snapshotting",
+			EnvVar: "PLUGIN_IGNORE_PATHS",
+		},
+		cli.StringFlag{
+			Name:   "docker-config-dir",
+			Usage:  "directory the docker config file is written to",
+			Value:  defaultDockerConfigDir,
+			EnvVar: "PLUGIN_DOCKER_CONFIG_DIR",
+		},
+		cli.StringFlag{
+			Name:   "vault-addr",
+			Usage:  "vault server address secrets are resolved from",
+			EnvVar: "PLUGIN_VAULT_ADDR",
+		},
+		cli.StringFlag{
+			Name:   "vault-token",
+			Usage:  "vault token",
+			EnvVar: "PLUGIN_VAULT_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "vault-role-id",
+			Usage:  "vault approle role id",
+			EnvVar: "PLUGIN_VAULT_ROLE_ID",
+		},
+		cli.StringFlag{
+			Name:   "vault-secret-id",
+			Usage:  "vault approle secret id",
+			EnvVar: "PLUGIN_VAULT_SECRET_ID",
+		},
+		cli.StringFlag{
+			Name:   "vault-k8s-role",
+			Usage:  "vault kubernetes auth role, logging in with the pod service account token",
+			EnvVar: "PLUGIN_VAULT_K8S_ROLE",
+		},
+		cli.StringFlag{
+			Name:   "vault-auth-path",
+			Usage:  "mount path of the vault auth method, defaults to approle or kubernetes",
+			EnvVar: "PLUGIN_VAULT_AUTH_PATH",
+		},
+		cli.StringFlag{
+			Name:   "vault-namespace",
+			Usage:  "vault enterprise namespace",
+			EnvVar: "PLUGIN_VAULT_NAMESPACE",
+		},
+		cli.StringSliceFlag{
+			Name:   "vault-paths",
+			Usage:  "secrets resolved from vault into environment variables, as NAME=path#field",
+			EnvVar: "PLUGIN_VAULT_PATHS",
+		},
+		cli.StringSliceFlag{
+			Name:   "secret-refs",
+			Usage:  "secrets resolved into environment variables, as NAME=scheme:reference with the vault, ssm, secretsmanager or azurekv scheme",
+			EnvVar: "PLUGIN_SECRET_REFS",
+		},
+		cli.StringFlag{
+			Name:   "secrets-aws-region",
+			Usage:  "region of the ssm and secretsmanager secrets, defaults to the region of the ARN or AWS_REGION",
+			EnvVar: "PLUGIN_SECRETS_AWS_REGION",
+		},
+		cli.StringFlag{
+			Name:   "azure-keyvault-name",
+			Usage:  "azure key vault secrets are resolved from, as a name or URL",
+			EnvVar: "PLUGIN_AZURE_KEYVAULT_NAME",
+		},
+		cli.StringFlag{
+			Name:   "azure-keyvault-tenant-id",
+			Usage:  "tenant of the key vault service principal",
+			EnvVar: "PLUGIN_AZURE_KEYVAULT_TENANT_ID",
+		},
+		cli.StringFlag{
+			Name:   "azure-keyvault-client-id",
+			Usage:  "client id of the key vault service principal, or of the user assigned managed identity",
+			EnvVar: "PLUGIN_AZURE_KEYVAULT_CLIENT_ID",
+		},
+		cli.StringFlag{
+			Name:   "azure-keyvault-client-secret",
+			Usage:  "client secret of the key vault service principal, the managed identity is used when empty",
+			EnvVar: "PLUGIN_AZURE_KEYVAULT_CLIENT_SECRET",
+		},
+		cli.StringSliceFlag{
+			Name:   "azure-keyvault-secrets",
+			Usage:  "secrets resolved from azure key vault into environment variables, as NAME=secret[/version]",
+			EnvVar: "PLUGIN_AZURE_KEYVAULT_SECRETS",
+		},
+		cli.StringFlag{
+			Name:   "docker-config-secret-path",
+			Usage:  "mounted kubernetes.io/dockerconfigjson secret, directory or key file, merged into the docker config",
+			EnvVar: "PLUGIN_DOCKER_CONFIG_SECRET_PATH",
+		},
+		cli.StringFlag{
+			Name:   "digest-file",
+			Usage:  "file the image digest is written to",
+			Value:  defaultDigestFile,
+			EnvVar: "PLUGIN_DIGEST_FILE",
+		},
+		cli.StringFlag{
+			Name:   "max-image-size",
+			Usage:  "fail when the compressed image size exceeds this budget, e.g. 500MB",
+			EnvVar: "PLUGIN_MAX_IMAGE_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "max-uncompressed-image-size",
+			Usage:  "fail when the uncompressed image size exceeds this budget, requires tar-path",
+			EnvVar: "PLUGIN_MAX_UNCOMPRESSED_IMAGE_SIZE",
+		},
+		cli.BoolFlag{
+			Name:   "layer-report",
+			Usage:  "report layer sizes compared with the previous image",
+			EnvVar: "PLUGIN_LAYER_REPORT",
+		},
+		cli.StringFlag{
+			Name:   "layer-report-file",
+			Usage:  "file the layer report is written to, defaults to layer-report.json next to the artifact file",
+			EnvVar: "PLUGIN_LAYER_REPORT_FILE",
+		},
+		cli.StringFlag{
+			Name:   "layer-report-baseline",
+			Usage:  "tag of the previous image compared in the layer report, defaults to the first tag",
+			EnvVar: "PLUGIN_LAYER_REPORT_BASELINE",
+		},
+		cli.StringFlag{
+			Name:   "layer-report-threshold",
+			Usage:  "layer growth flagged in the layer report",
+			Value:  "10MB",
+			EnvVar: "PLUGIN_LAYER_REPORT_THRESHOLD",
+		},
+		cli.StringFlag{
+			Name:   "test-command",
+			Usage:  "arguments passed to the image entrypoint to test the image before it is pushed",
+			EnvVar: "PLUGIN_TEST_COMMAND",
+		},
+		cli.StringFlag{
+			Name:   "test-runner",
+			Usage:  "shell command running the test instead of the built-in chroot runner",
+			EnvVar: "PLUGIN_TEST_RUNNER",
+		},
+		cli.DurationFlag{
+			Name:   "test-timeout",
+			Usage:  "smoke test timeout",
+			Value:  5 * time.Minute,
+			EnvVar: "PLUGIN_TEST_TIMEOUT",
+		},
+		cli.StringSliceFlag{
+			Name:   "structure-test-configs",
+			Usage:  "container-structure-test configs run against the image before it is pushed",
+			EnvVar: "PLUGIN_STRUCTURE_TEST_CONFIGS",
+		},
+		cli.StringFlag{
+			Name:   "structure-test-report",
+			Usage:  "file the structure test report is written to, defaults to structure-test-report.json next to the artifact file",
+			EnvVar: "PLUGIN_STRUCTURE_TEST_REPORT",
+		},
+		cli.StringFlag{
+			Name:   "diagnostics-path",
+			Usage:  "file a tar.gz diagnostics bundle is written to when the build fails",
+			EnvVar: "PLUGIN_DIAGNOSTICS_PATH",
+		},
+		cli.BoolFlag{
+			Name:   "debug-snapshot",
+			Usage:  "archive the filesystem of the failed stage when the build fails",
+			EnvVar: "PLUGIN_DEBUG_SNAPSHOT",
+		},
+		cli.StringFlag{
+			Name:   "debug-snapshot-path",
+			Usage:  "file the debug snapshot is written to, defaults to debug-snapshot.tar.gz",
+			EnvVar: "PLUGIN_DEBUG_SNAPSHOT_PATH",
+		},
+		cli.StringFlag{
+			Name:   "debug-snapshot-tag",
+			Usage:  "tag of the repository the debug snapshot is pushed to as an image",
+			EnvVar: "PLUGIN_DEBUG_SNAPSHOT_TAG",
+		},
+		cli.StringFlag{
+			Name:   "error-summary-file",
+			Usage:  "file a json summary of the classified build failure is written to",
+			EnvVar: "PLUGIN_ERROR_SUMMARY_FILE",
+		},
+		cli.StringFlag{
+			Name:   "min-free-space",
+			Usage:  "free disk space required to start the build, e.g. 5GB",
+			EnvVar: "PLUGIN_MIN_FREE_SPACE",
+		},
+		cli.StringFlag{
+			Name:   "cache-dir",
+			Usage:  "local directory caching base images",
+			EnvVar: "PLUGIN_CACHE_DIR",
+		},
+		cli.StringSliceFlag{
+			Name:   "run-cache-dirs",
+			Usage:  "directories RUN instructions share across builds, e.g. /root/.npm",
+			EnvVar: "PLUGIN_RUN_CACHE_DIRS",
+		},
+		cli.BoolFlag{
+			Name:   "run-cache-mounts",
+			Usage:  "share the targets of RUN --mount=type=cache across builds",
+			EnvVar: "PLUGIN_RUN_CACHE_MOUNTS",
+		},
+		cli.StringFlag{
+			Name:   "run-cache-volume",
+			Usage:  "directory the run cache directories are kept in between builds, defaults to /cache/run",
+			EnvVar: "PLUGIN_RUN_CACHE_VOLUME",
+		},
+		cli.BoolFlag{
+			Name:   "clean-cache-on-low-space",
+			Usage:  "clean the cache directory when free disk space is below min-free-space",
+			EnvVar: "PLUGIN_CLEAN_CACHE_ON_LOW_SPACE",
+		},
+		cli.BoolFlag{
+			Name:   "single-snapshot",
+			Usage:  "take a single snapshot of the filesystem at the end of the build",
+			EnvVar: "PLUGIN_SINGLE_SNAPSHOT",
+		},
+		cli.BoolTFlag{
+			Name:   "compressed-caching",
+			Usage:  "compress cached layers, set to false to reduce memory usage",
+			EnvVar: "PLUGIN_COMPRESSED_CACHING",
+		},
+		cli.BoolFlag{
+			Name:   "auto-tune",
+			Usage:  "pick memory saving kaniko settings based on the runner memory limit",
+			EnvVar: "PLUGIN_AUTO_TUNE",
+		},
+		cli.BoolFlag{
+			Name:   "build-summary",
+			Usage:  "print a summary of the build times and cache effectiveness",
+			EnvVar: "PLUGIN_BUILD_SUMMARY",
+		},
+		cli.StringFlag{
+			Name:   "build-summary-file",
+			Usage:  "file the build summary is written to as json",
+			EnvVar: "PLUGIN_BUILD_SUMMARY_FILE",
+		},
+		cli.StringFlag{
+			Name:   "timing-file",
+			Usage:  "file the time spent on each stage and instruction is written to as json",
+			EnvVar: "PLUGIN_TIMING_FILE",
+		},
+		cli.StringFlag{
+			Name:   "statsd-address",
+			Usage:  "statsd agent the build timings are sent to, e.g. localhost:8125",
+			EnvVar: "PLUGIN_STATSD_ADDRESS",
+		},
+		cli.StringFlag{
+			Name:   "statsd-prefix",
+			Usage:  "prefix of the statsd metric names",
+			Value:  "kaniko",
+			EnvVar: "PLUGIN_STATSD_PREFIX",
+		},
+		cli.StringFlag{
+			Name:   "state-store",
+			Usage:  "directory, s3://bucket/prefix or gs://bucket/prefix the history of previous builds is kept in",
+			EnvVar: "PLUGIN_STATE_STORE",
+		},
+		cli.StringFlag{
+			Name:   "card-path",
+			Usage:  "file the drone card of the build is written to",
+			EnvVar: "PLUGIN_CARD_PATH,DRONE_CARD_PATH",
+		},
+		cli.StringFlag{
+			Name:   "scan-report",
+			Usage:  "trivy or grype json report whose findings are counted on the card",
+			EnvVar: "PLUGIN_SCAN_REPORT",
+		},
+		cli.StringFlag{
+			Name:   "digest-dir",
+			Usage:  "directory the digest of each tag is written to, one file per tag",
+			EnvVar: "PLUGIN_DIGEST_DIR",
+		},
+		cli.BoolFlag{
+			Name:   "auto-labels",
+			Usage:  "label the image with label-schema labels describing the git commit",
+			EnvVar: "PLUGIN_AUTO_LABELS",
+		},
+		cli.StringFlag{
+			Name:   "drone-build-number",
+			Usage:  "build number passed by Drone",
+			EnvVar: "DRONE_BUILD_NUMBER",
+		},
+		cli.Int64Flag{
+			Name:   "drone-build-created",
+			Usage:  "build creation time passed by Drone",
+			EnvVar: "DRONE_BUILD_CREATED",
+		},
+		cli.StringFlag{
+			Name:   "drone-commit-sha",
+			Usage:  "git commit sha passed by Drone",
+			EnvVar: "DRONE_COMMIT_SHA",
+		},
+		cli.StringFlag{
+			Name:   "drone-commit-author",
+			Usage:  "git commit author passed by Drone",
+			EnvVar: "DRONE_COMMIT_AUTHOR",
+		},
+		cli.StringFlag{
+			Name:   "drone-commit-message",
+			Usage:  "git commit message passed by Drone",
+			EnvVar: "DRONE_COMMIT_MESSAGE",
+		},
+		cli.StringFlag{
+			Name:   "drone-commit-branch",
+			Usage:  "git commit branch passed by Drone",
+			EnvVar: "DRONE_COMMIT_BRANCH",
+		},
+		cli.StringFlag{
+			Name:   "drone-tag",
+			Usage:  "git tag passed by Drone",
+			EnvVar: "DRONE_TAG",
+		},
+		cli.StringFlag{
+			Name:   "backend",
+			Usage:  "where the kaniko executor runs, local, docker or kubernetes",
+			Value:  "local",
+			EnvVar: "PLUGIN_BACKEND",
+		},
+		cli.StringFlag{
+			Name:   "executor-image",
+			Usage:  "kaniko executor image run by the docker backend",
+			EnvVar: "PLUGIN_EXECUTOR_IMAGE",
+		},
+		cli.StringFlag{
+			Name:   "docker-host",
+			Usage:  "docker engine address used by the docker backend",
+			EnvVar: "PLUGIN_DOCKER_HOST,DOCKER_HOST",
+		},
+		cli.StringFlag{
+			Name:   "backend-container",
+			Usage:  "container whose volumes and network the executor container shares, defaults to the hostname",
+			EnvVar: "PLUGIN_BACKEND_CONTAINER",
+		},
+		cli.StringFlag{
+			Name:   "k8s-api-server",
+			Usage:  "kubernetes api server used by the kubernetes backend, defaults to the in-cluster address",
+			EnvVar: "PLUGIN_K8S_API_SERVER",
+		},
+		cli.StringFlag{
+			Name:   "k8s-token",
+			Usage:  "kubernetes bearer token, defaults to the service account token",
+			EnvVar: "PLUGIN_K8S_TOKEN",
+		},
+		cli.StringFlag{
+			Name:   "k8s-namespace",
+			Usage:  "namespace of the executor job, defaults to the namespace of the service account",
+			EnvVar: "PLUGIN_K8S_NAMESPACE",
+		},
+		cli.StringFlag{
+			Name:   "k8s-service-account",
+			Usage:  "service account of the executor job",
+			EnvVar: "PLUGIN_K8S_SERVICE_ACCOUNT",
+		},
+		cli.StringSliceFlag{
+			Name:   "k8s-node-selector",
+			Usage:  "node labels of the executor job in the form key=value",
+			EnvVar: "PLUGIN_K8S_NODE_SELECTOR",
+		},
+		cli.StringFlag{
+			Name:   "k8s-context-volume",
+			Usage:  "persistent volume claim holding the workspace, required for a local build context",
+			EnvVar: "PLUGIN_K8S_CONTEXT_VOLUME",
+		},
+		cli.StringFlag{
+			Name:   "context-bucket",
+			Usage:  "s3 or gcs bucket the local build context is uploaded to for the executor",
+			EnvVar: "PLUGIN_CONTEXT_BUCKET",
+		},
+		cli.StringFlag{
+			Name:   "builder",
+			Usage:  "builder running the build, kaniko, buildkit or buildah",
+			Value:  "kaniko",
+			EnvVar: "PLUGIN_BUILDER",
+		},
+		cli.StringFlag{
+			Name:   "attestation-file",
+			Usage:  "file the in-toto attestation of the build inputs is written to",
+			EnvVar: "PLUGIN_ATTESTATION_FILE",
+		},
+		cli.BoolFlag{
+			Name:   "push-attestation",
+			Usage:  "push the in-toto attestation as a referrer of the image",
+			EnvVar: "PLUGIN_PUSH_ATTESTATION",
+		},
+		cli.BoolFlag{
+			Name:   "check-updates",
+			Usage:  "warn when a newer plugin release exists, off by default for air-gapped use",
+			EnvVar: "PLUGIN_CHECK_UPDATES",
+		},
+		cli.BoolFlag{
+			Name:   "offline",
+			Usage:  "disable optional outbound calls and fail when a feature needs network access beyond the registries",
+			EnvVar: "PLUGIN_OFFLINE",
+		},
+		cli.BoolFlag{
+			Name:   "fips",
+			Usage:  "fail unless the plugin is built with the FIPS validated BoringCrypto module",
+			EnvVar: "PLUGIN_FIPS",
+		},
+		cli.StringSliceFlag{
+			Name:   "redact-patterns",
+			Usage:  "regular expressions masked in the executor output, in addition to the known credentials",
+			EnvVar: "PLUGIN_REDACT_PATTERNS",
+		},
+		cli.StringSliceFlag{
+			Name:   "capture-env-allowlist",
+			Usage:  "environment variables, or glob patterns, recorded as labels and in the attestation",
+			EnvVar: "PLUGIN_CAPTURE_ENV_ALLOWLIST",
+		},
+		cli.StringSliceFlag{
+			Name:   "capture-env-denylist",
+			Usage:  "glob patterns of environment variables never captured, in addition to those named like secrets",
+			EnvVar: "PLUGIN_CAPTURE_ENV_DENYLIST",
+		},
+		cli.StringFlag{
+			Name:   "referrers-mode",
+			Usage:  "how artifacts are attached to images: auto probes the referrers API, api relies on it, tag also lists artifacts in the index of the referrers tag schema and tags them with the cosign convention",
+			Value:  "auto",
+			EnvVar: "PLUGIN_REFERRERS_MODE",
+		},
+		cli.StringFlag{
+			Name:   "helm-chart",
+			Usage:  "helm chart directory or packaged chart pushed as an OCI artifact with the image",
+			EnvVar: "PLUGIN_HELM_CHART",
+		},
+		cli.StringFlag{
+			Name:   "helm-repo",
+			Usage:  "registry namespace the helm chart is pushed to, defaults to the namespace of the image repository",
+			EnvVar: "PLUGIN_HELM_REPO",
+		},
+		cli.StringSliceFlag{
+			Name:   "oci-artifacts",
+			Usage:  "files, path[:media type], pushed as an OCI artifact attached to the image",
+			EnvVar: "PLUGIN_OCI_ARTIFACTS",
+		},
+		cli.StringFlag{
+			Name:   "oci-artifact-type",
+			Usage:  "artifact type of the OCI artifact",
+			Value:  "application/vnd.unknown.artifact.v1",
+			EnvVar: "PLUGIN_OCI_ARTIFACT_TYPE",
+		},
+		cli.StringFlag{
+			Name:   "oci-artifact-ref",
+			Usage:  "reference the OCI artifact is pushed to instead of attaching it to the image",
+			EnvVar: "PLUGIN_OCI_ARTIFACT_REF",
+		},
+		cli.StringSliceFlag{
+			Name:   "oci-artifact-annotations",
+			Usage:  "k=v annotations of the OCI artifact manifest",
+			EnvVar: "PLUGIN_OCI_ARTIFACT_ANNOTATIONS",
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package flags_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/cmd/acr"
+	"github.com/drone/drone-kaniko/pkg/cmd/docker"
+	"github.com/drone/drone-kaniko/pkg/cmd/ecr"
+	"github.com/drone/drone-kaniko/pkg/cmd/gar"
+	"github.com/drone/drone-kaniko/pkg/cmd/gcr"
+	"github.com/drone/drone-kaniko/pkg/flags"
+)
+
+func commands() []flags.Command {
+	var commands []flags.Command
+	for _, c := range []struct {
+		name string
+		app  func() *cli.App
+	}{
+		{"docker", docker.App},
+		{"ecr", ecr.App},
+		{"gcr", gcr.App},
+		{"gar", gar.App},
+		{"acr", acr.App},
+	} {
+		commands = append(commands, flags.Command{Name: c.name, Flags: c.app().Flags})
+	}
+	return commands
+}
+
+// TestParity fails when a command misses a common setting or a setting
+// cannot be set from the plugin settings.
+func TestParity(t *testing.T) {
+	for _, command := range commands() {
+		names := map[string]bool{}
+		for _, flag := range command.Flags {
+			s := flags.Describe(flag)
+			if names[s.Name] {
+				t.Errorf("%s: duplicate flag %s", command.Name, s.Name)
+			}
+			names[s.Name] = true
+
+			if s.Plugin() == "" && !strings.HasPrefix(strings.Join(s.EnvVars, ","), "DRONE_") {
+				t.Errorf("%s: flag %s has no PLUGIN_ environment variable", command.Name, s.Name)
+			}
+		}
+		for _, flag := range flags.Common() {
+			if !names[flag.GetName()] {
+				t.Errorf("%s: missing common flag %s", command.Name, flag.GetName())
+			}
+		}
+	}
+}
+
+func TestReference(t *testing.T) {
+	var buf bytes.Buffer
+	if err := flags.WriteReference(&buf, commands()); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("../../docs/settings.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, buf.Bytes()) {
+		t.Errorf("docs/settings.md is out of date, run go generate ./pkg/flags")
+	}
+}
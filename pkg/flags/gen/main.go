@@ -0,0 +1,45 @@
+// Command gen writes the reference of the plugin settings.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log"
+
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/cmd/acr"
+	"github.com/drone/drone-kaniko/pkg/cmd/docker"
+	"github.com/drone/drone-kaniko/pkg/cmd/ecr"
+	"github.com/drone/drone-kaniko/pkg/cmd/gar"
+	"github.com/drone/drone-kaniko/pkg/cmd/gcr"
+	"github.com/drone/drone-kaniko/pkg/flags"
+)
+
+func main() {
+	out := flag.String("o", "docs/settings.md", "output file")
+	flag.Parse()
+
+	var commands []flags.Command
+	for _, c := range []struct {
+		name string
+		app  func() *cli.App
+	}{
+		{"docker", docker.App},
+		{"ecr", ecr.App},
+		{"gcr", gcr.App},
+		{"gar", gar.App},
+		{"acr", acr.App},
+	} {
+		commands = append(commands, flags.Command{Name: c.name, Flags: c.app().Flags})
+	}
+
+	var buf bytes.Buffer
+	if err := flags.WriteReference(&buf, commands); err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,21 @@
+package flags
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	kaniko "github.com/drone/drone-kaniko"
+)
+
+// Logging configures the logger of the plugin with the log timestamps and
+// colors of the executor.
+func Logging(c *cli.Context) {
+	formatter := &logrus.TextFormatter{FullTimestamp: c.Bool("log-timestamps")}
+	switch c.String("log-color") {
+	case kaniko.LogColorAlways:
+		formatter.ForceColors = true
+	case kaniko.LogColorNever:
+		formatter.DisableColors = true
+	}
+	logrus.SetFormatter(formatter)
+}
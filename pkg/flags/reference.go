@@ -0,0 +1,121 @@
+package flags
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// Command is a plugin command listed in the settings reference.
+type Command struct {
+	Name  string
+	Flags []cli.Flag
+}
+
+// Setting describes a flag and the environment variables setting it.
+type Setting struct {
+	Name    string
+	EnvVars []string
+	Default string
+	Usage   string
+}
+
+// Describe returns the setting of a flag.
+func Describe(flag cli.Flag) Setting {
+	v := reflect.Indirect(reflect.ValueOf(flag))
+	s := Setting{Name: flag.GetName()}
+	if f := v.FieldByName("EnvVar"); f.IsValid() && f.String() != "" {
+		for _, env := range strings.Split(f.String(), ",") {
+			s.EnvVars = append(s.EnvVars, strings.TrimSpace(env))
+		}
+	}
+	if f := v.FieldByName("Usage"); f.IsValid() {
+		s.Usage = f.String()
+	}
+	if _, ok := flag.(cli.BoolTFlag); ok {
+		s.Default = "true"
+	}
+	if f := v.FieldByName("Value"); f.IsValid() && !f.IsZero() {
+		switch value := f.Interface().(type) {
+		case *cli.StringSlice:
+			s.Default = strings.Join(value.Value(), ",")
+		default:
+			s.Default = fmt.Sprint(value)
+		}
+	}
+	return s
+}
+
+// Plugin returns the environment variable set by Drone from the plugin
+// settings, if any.
+func (s Setting) Plugin() string {
+	for _, env := range s.EnvVars {
+		if strings.HasPrefix(env, "PLUGIN_") {
+			return env
+		}
+	}
+	return ""
+}
+
+// WriteReference writes the markdown reference of the settings, the common
+// ones first followed by those specific to each command.
+func WriteReference(w io.Writer, commands []Command) error {
+	common := map[string]bool{}
+	for _, flag := range Common() {
+		common[flag.GetName()] = true
+	}
+
+	fmt.Fprintln(w, "<!-- Code generated by go generate ./pkg/flags; DO NOT EDIT. -->")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# Settings")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "## Common")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Supported by %s.\n\n", commandNames(commands))
+	writeTable(w, Common())
+
+	for _, command := range commands {
+		var specific []cli.Flag
+		for _, flag := range command.Flags {
+			if !common[flag.GetName()] {
+				specific = append(specific, flag)
+			}
+		}
+		fmt.Fprintf(w, "\n## %s\n\n", command.Name)
+		writeTable(w, specific)
+	}
+	return nil
+}
+
+func writeTable(w io.Writer, flags []cli.Flag) {
+	fmt.Fprintln(w, "| Setting | Environment | Default | Description |")
+	fmt.Fprintln(w, "|---|---|---|---|")
+	for _, flag := range flags {
+		s := Describe(flag)
+		setting := strings.ToLower(strings.TrimPrefix(s.Plugin(), "PLUGIN_"))
+		var envs []string
+		for _, env := range s.EnvVars {
+			envs = append(envs, "`"+env+"`")
+		}
+		var def string
+		if s.Default != "" {
+			def = "`" + s.Default + "`"
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", setting, strings.Join(envs, ", "), def, escape(s.Usage))
+	}
+}
+
+func commandNames(commands []Command) string {
+	var names []string
+	for _, command := range commands {
+		names = append(names, "`"+command.Name+"`")
+	}
+	return strings.Join(names, ", ")
+}
+
+func escape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
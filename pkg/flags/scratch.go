@@ -0,0 +1,43 @@
+package flags
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	kaniko "github.com/drone/drone-kaniko"
+)
+
+// ScratchDir creates the scratch directory of the run and moves the docker
+// config directory and the digest file into it, unless they are set
+// explicitly. A docker config file at the default location, e.g. mounted
+// into the plugin image, is copied along so it is still merged.
+func ScratchDir(c *cli.Context) (string, error) {
+	dir, err := kaniko.NewScratchDir(c.String("scratch-dir"), c.String("kaniko-dir"))
+	if err != nil {
+		return "", err
+	}
+	if !c.IsSet("docker-config-dir") {
+		configDir := filepath.Join(dir, ".docker")
+		if err := os.MkdirAll(configDir, 0700); err != nil {
+			return dir, errors.Wrap(err, "failed to create docker config directory")
+		}
+		if content, err := ioutil.ReadFile(filepath.Join(c.String("docker-config-dir"), "config.json")); err == nil {
+			if err := ioutil.WriteFile(filepath.Join(configDir, "config.json"), content, 0600); err != nil {
+				return dir, errors.Wrap(err, "failed to copy docker config file")
+			}
+		}
+		if err := c.Set("docker-config-dir", configDir); err != nil {
+			return dir, err
+		}
+	}
+	if !c.IsSet("digest-file") {
+		if err := c.Set("digest-file", filepath.Join(dir, "digest-file")); err != nil {
+			return dir, err
+		}
+	}
+	return dir, nil
+}
@@ -0,0 +1,119 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/secrets"
+)
+
+// secretResolver returns the secret stores configured by the common flags.
+func secretResolver(c *cli.Context) secrets.Resolver {
+	resolver := secrets.Resolver{}
+	if addr := c.String("vault-addr"); addr != "" {
+		resolver["vault"] = &secrets.Vault{
+			Addr:           addr,
+			Namespace:      c.String("vault-namespace"),
+			Token:          c.String("vault-token"),
+			RoleID:         c.String("vault-role-id"),
+			SecretID:       c.String("vault-secret-id"),
+			KubernetesRole: c.String("vault-k8s-role"),
+			AuthPath:       c.String("vault-auth-path"),
+		}
+	}
+	resolver["azurekv"] = &secrets.KeyVault{
+		Vault:        c.String("azure-keyvault-name"),
+		TenantID:     c.String("azure-keyvault-tenant-id"),
+		ClientID:     c.String("azure-keyvault-client-id"),
+		ClientSecret: c.String("azure-keyvault-client-secret"),
+	}
+	region := c.String("secrets-aws-region")
+	resolver["ssm"] = &secrets.SSM{Region: region}
+	resolver["secretsmanager"] = &secrets.SecretsManager{Region: region}
+	return resolver
+}
+
+// ResolveSecrets resolves the secrets mapped by the vault paths, the key
+// vault secrets and the secret refs into environment variables of the plugin, where secret args
+// and build secrets read them. A variable named after the environment
+// variable of a setting, e.g. PLUGIN_PASSWORD, sets the setting as well, as
+// does a reference in the variable of the setting suffixed with _FROM, e.g.
+// PLUGIN_PASSWORD_FROM=ssm:/ci/dockerhub.
+func ResolveSecrets(ctx context.Context, c *cli.Context) error {
+	mappings, err := secrets.ParseMappings(c.StringSlice("vault-paths"), "vault")
+	if err != nil {
+		return err
+	}
+	keyVault, err := secrets.ParseMappings(c.StringSlice("azure-keyvault-secrets"), "azurekv")
+	if err != nil {
+		return err
+	}
+	refs, err := secrets.ParseMappings(c.StringSlice("secret-refs"), "")
+	if err != nil {
+		return err
+	}
+	mappings = append(mappings, keyVault...)
+	mappings = append(mappings, refs...)
+	mappings = append(mappings, settingRefs(c)...)
+	if len(mappings) == 0 {
+		return nil
+	}
+	if c.Bool("offline") {
+		return fmt.Errorf("offline mode: secret references require network access to the secret stores")
+	}
+	resolver := secretResolver(c)
+	for _, mapping := range mappings {
+		value, err := resolver.Resolve(ctx, mapping.Ref)
+		if err != nil {
+			return err
+		}
+		if err := setSecret(c, mapping.Name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settingRefs returns the references set in the environment variables of
+// the settings suffixed with _FROM.
+func settingRefs(c *cli.Context) []secrets.Mapping {
+	var mappings []secrets.Mapping
+	for _, flag := range c.App.Flags {
+		for _, env := range Describe(flag).EnvVars {
+			if ref := os.Getenv(env + "_FROM"); ref != "" && strings.HasPrefix(env, "PLUGIN_") {
+				mappings = append(mappings, secrets.Mapping{Name: env, Ref: ref})
+			}
+		}
+	}
+	return mappings
+}
+
+// setSecret sets the environment variable and the setting reading it.
+func setSecret(c *cli.Context, name, value string) error {
+	if err := os.Setenv(name, value); err != nil {
+		return err
+	}
+	for _, flag := range c.App.Flags {
+		if !contains(Describe(flag).EnvVars, name) {
+			continue
+		}
+		if _, ok := flag.(cli.StringSliceFlag); ok {
+			return fmt.Errorf("%s is a list setting and cannot be resolved from a secret store", name)
+		}
+		return c.Set(flag.GetName(), value)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
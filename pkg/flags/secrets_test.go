@@ -0,0 +1,74 @@
+package flags_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/urfave/cli"
+
+	"github.com/drone/drone-kaniko/pkg/flags"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" || r.URL.Path != "/v1/secret/data/ci" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"username": "octocat", "password": "hunter2", "npm": "npm-token"}, "metadata": {}}}`))
+	}))
+	defer server.Close()
+	t.Setenv("NPM_TOKEN", "")
+	t.Setenv("PLUGIN_PASSWORD", "")
+	t.Setenv("PLUGIN_USERNAME", "")
+	t.Setenv("PLUGIN_USERNAME_FROM", "vault:secret/data/ci#username")
+
+	var username, password string
+	app := cli.NewApp()
+	app.Flags = append(flags.Common(),
+		cli.StringFlag{Name: "username", EnvVar: "PLUGIN_USERNAME"},
+		cli.StringFlag{Name: "password", EnvVar: "PLUGIN_PASSWORD"},
+	)
+	app.Action = func(c *cli.Context) error {
+		if err := flags.ResolveSecrets(context.Background(), c); err != nil {
+			return err
+		}
+		username, password = c.String("username"), c.String("password")
+		return nil
+	}
+	args := []string{"plugin",
+		"--vault-addr", server.URL,
+		"--vault-token", "token",
+		"--vault-paths", "PLUGIN_PASSWORD=secret/data/ci#password",
+		"--secret-refs", "NPM_TOKEN=vault:secret/data/ci#npm",
+	}
+	if err := app.Run(args); err != nil {
+		t.Fatal(err)
+	}
+	if username != "octocat" {
+		t.Errorf("got username %q, want the secret referenced by PLUGIN_USERNAME_FROM", username)
+	}
+	if password != "hunter2" {
+		t.Errorf("got password %q, want the resolved secret", password)
+	}
+	if got := os.Getenv("NPM_TOKEN"); got != "npm-token" {
+		t.Errorf("got NPM_TOKEN %q, want the resolved secret", got)
+	}
+}
+
+func TestResolveSecretsOffline(t *testing.T) {
+	app := cli.NewApp()
+	app.Flags = flags.Common()
+	app.Action = func(c *cli.Context) error {
+		return flags.ResolveSecrets(context.Background(), c)
+	}
+	if err := app.Run([]string{"plugin", "--offline", "--secret-refs", "NPM_TOKEN=ssm:/ci/npm"}); err == nil {
+		t.Error("expected secret references to fail in offline mode")
+	}
+	if err := app.Run([]string{"plugin", "--offline"}); err != nil {
+		t.Errorf("unexpected error without secret references: %s", err)
+	}
+}
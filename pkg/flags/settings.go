@@ -0,0 +1,212 @@
+package flags
+
+import (
+	"github.com/urfave/cli"
+
+	kaniko "github.com/drone/drone-kaniko"
+	"github.com/drone/drone-kaniko/pkg/gitops"
+	"github.com/drone/drone-kaniko/pkg/status"
+)
+
+// Build returns the build settings of the common flags. The repository and
+// cache repository depend on the registry and are set by the commands.
+func Build(c *cli.Context) kaniko.Build {
+	return kaniko.Build{
+		DroneCommitRef:           c.String("drone-commit-ref"),
+		DroneRepoBranch:          c.String("drone-repo-branch"),
+		Dockerfile:               c.String("dockerfile"),
+		DockerfileContents:       c.String("dockerfile-contents"),
+		Context:                  c.String("context"),
+		Tags:                     c.StringSlice("tags"),
+		AutoTag:                  c.Bool("auto-tag"),
+		AutoTagSuffix:            c.String("auto-tag-suffix"),
+		Calver:                   c.Bool("calver"),
+		CalverTemplate:           c.String("calver-template"),
+		CalverTimezone:           c.String("calver-timezone"),
+		DroneBuildNumber:         c.String("drone-build-number"),
+		DroneBuildCreated:        c.Int64("drone-build-created"),
+		ExpandTag:                c.Bool("expand-tag"),
+		ExpandTagLevels:          c.StringSlice("expand-tag-levels"),
+		ExpandTagLatest:          c.Bool("expand-tag-latest"),
+		SanitizeTags:             c.Bool("sanitize-tags"),
+		TagPrefix:                c.String("tag-prefix"),
+		TagSuffix:                c.String("tag-suffix"),
+		Args:                     c.StringSlice("args"),
+		Target:                   c.String("target"),
+		RequireTarget:            c.Bool("require-target"),
+		StrictArgs:               c.Bool("strict-args"),
+		AutoProxyArgs:            c.Bool("auto-proxy-args"),
+		Mirrors:                  c.StringSlice("registry-mirrors"),
+		MirrorPreset:             c.String("mirror-preset"),
+		MirrorPrefix:             c.String("mirror-prefix"),
+		MirrorExclude:            c.StringSlice("mirror-exclude"),
+		Labels:                   c.StringSlice("custom-labels"),
+		LabelsFile:               c.String("labels-file"),
+		PostLabels:               c.StringSlice("post-labels"),
+		PostAnnotations:          c.StringSlice("post-annotations"),
+		SkipTlsVerify:            c.Bool("skip-tls-verify"),
+		RegistryClientCerts:      c.StringSlice("registry-client-cert"),
+		RegistryClientKeys:       c.StringSlice("registry-client-key"),
+		SnapshotMode:             c.String("snapshot-mode"),
+		EnableCache:              c.Bool("enable-cache"),
+		CacheTTL:                 c.Int("cache-ttl"),
+		CacheCleanup:             c.Bool("cache-cleanup"),
+		CacheCleanupLimit:        c.Int("cache-cleanup-limit"),
+		CacheLock:                c.String("cache-lock"),
+		CacheLockTimeout:         c.Duration("cache-lock-timeout"),
+		CacheLockSkip:            c.Bool("cache-lock-skip"),
+		HubPullCredentials:       c.String("hub-pull-credentials"),
+		HubMirror:                c.String("hub-mirror"),
+		CacheInsecure:            c.Bool("cache-registry-insecure"),
+		CacheUsername:            c.String("cache-username"),
+		CachePassword:            c.String("cache-password"),
+		CacheBust:                c.String("cache-bust"),
+		CacheBustStage:           c.String("cache-bust-stage"),
+		CacheKeys:                c.Bool("cache-keys"),
+		DigestFile:               c.String("digest-file"),
+		NoPush:                   c.Bool("no-push"),
+		ProbePush:                c.Bool("probe-push"),
+		PushPermissionCheck:      c.String("push-permission-check"),
+		TarPath:                  c.String("tar-path"),
+		OCILayout:                c.String("oci-layout"),
+		PushOnly:                 c.Bool("push-only"),
+		Verbosity:                c.String("verbosity"),
+		LogTimestamps:            c.Bool("log-timestamps"),
+		LogColor:                 c.String("log-color"),
+		Platform:                 c.String("platform"),
+		SkipUnusedStages:         c.Bool("skip-unused-stages"),
+		Cleanup:                  c.Bool("cleanup"),
+		SkipIfExists:             c.Bool("skip-if-exists"),
+		TagContent:               c.Bool("content-tag"),
+		DroneCommitBefore:        c.String("drone-commit-before"),
+		DroneCommitAfter:         c.String("drone-commit-after"),
+		TriggerPaths:             c.StringSlice("trigger-paths"),
+		ContextSubPath:           c.String("context-sub-path"),
+		ExtraContexts:            c.StringSlice("extra-contexts"),
+		Secrets:                  c.StringSlice("secrets"),
+		SecretArgs:               c.StringSlice("secret-args"),
+		SSHKey:                   c.String("ssh-key"),
+		SSHKnownHosts:            c.String("ssh-known-hosts"),
+		SSHAgentSock:             c.String("ssh-agent-sock"),
+		Volumes:                  c.StringSlice("volumes"),
+		NetrcMachine:             c.String("netrc-machine"),
+		NetrcLogin:               c.String("netrc-login"),
+		NetrcPassword:            c.String("netrc-password"),
+		KanikoDir:                c.String("kaniko-dir"),
+		IncludeVarRun:            !c.BoolT("ignore-var-run"),
+		IgnorePaths:              c.StringSlice("ignore-paths"),
+		MaxImageSize:             c.String("max-image-size"),
+		MaxUncompressedImageSize: c.String("max-uncompressed-image-size"),
+		LayerReport:              c.Bool("layer-report"),
+		LayerReportFile:          c.String("layer-report-file"),
+		LayerReportBaseline:      c.String("layer-report-baseline"),
+		LayerReportThreshold:     c.String("layer-report-threshold"),
+		TestCommand:              c.String("test-command"),
+		TestRunner:               c.String("test-runner"),
+		TestTimeout:              c.Duration("test-timeout"),
+		StructureTestConfigs:     c.StringSlice("structure-test-configs"),
+		StructureTestReport:      c.String("structure-test-report"),
+		DiagnosticsPath:          c.String("diagnostics-path"),
+		ErrorSummaryFile:         c.String("error-summary-file"),
+		DebugSnapshot:            c.Bool("debug-snapshot"),
+		DebugSnapshotPath:        c.String("debug-snapshot-path"),
+		DebugSnapshotTag:         c.String("debug-snapshot-tag"),
+		MinFreeSpace:             c.String("min-free-space"),
+		CacheDir:                 c.String("cache-dir"),
+		RunCacheDirs:             c.StringSlice("run-cache-dirs"),
+		RunCacheMounts:           c.Bool("run-cache-mounts"),
+		RunCacheVolume:           c.String("run-cache-volume"),
+		CleanCacheOnLowSpace:     c.Bool("clean-cache-on-low-space"),
+		SingleSnapshot:           c.Bool("single-snapshot"),
+		DisableCompressedCaching: !c.BoolT("compressed-caching"),
+		AutoTune:                 c.Bool("auto-tune"),
+		BuildSummary:             c.Bool("build-summary"),
+		BuildSummaryFile:         c.String("build-summary-file"),
+		TimingFile:               c.String("timing-file"),
+		StatsdAddress:            c.String("statsd-address"),
+		StatsdPrefix:             c.String("statsd-prefix"),
+		StateStore:               c.String("state-store"),
+		CardPath:                 c.String("card-path"),
+		ScanReport:               c.String("scan-report"),
+		DigestDir:                c.String("digest-dir"),
+		AutoLabels:               c.Bool("auto-labels"),
+		DroneCommitSha:           c.String("drone-commit-sha"),
+		DroneCommitAuthor:        c.String("drone-commit-author"),
+		DroneCommitMessage:       c.String("drone-commit-message"),
+		DroneCommitBranch:        c.String("drone-commit-branch"),
+		DroneTag:                 c.String("drone-tag"),
+		Builder:                  c.String("builder"),
+		DockerConfigSecretPath:   c.String("docker-config-secret-path"),
+		AttestationFile:          c.String("attestation-file"),
+		PushAttestation:          c.Bool("push-attestation"),
+		ReferrersMode:            c.String("referrers-mode"),
+		CheckUpdates:             c.Bool("check-updates"),
+		Offline:                  c.Bool("offline"),
+		FIPS:                     c.Bool("fips"),
+		RedactPatterns:           c.StringSlice("redact-patterns"),
+		CaptureEnv:               c.StringSlice("capture-env-allowlist"),
+		CaptureEnvDeny:           c.StringSlice("capture-env-denylist"),
+		HelmChart:                c.String("helm-chart"),
+		HelmRepo:                 c.String("helm-repo"),
+		OCIArtifacts:             c.StringSlice("oci-artifacts"),
+		OCIArtifactType:          c.String("oci-artifact-type"),
+		OCIArtifactRef:           c.String("oci-artifact-ref"),
+		OCIArtifactAnnotations:   c.StringSlice("oci-artifact-annotations"),
+	}
+}
+
+// Output returns the output settings of the common flags.
+func Output(c *cli.Context) kaniko.Output {
+	return kaniko.Output{
+		OutputFile: c.String("output-file"),
+		Bucket:     c.String("output-bucket"),
+		Prefix:     c.String("output-prefix"),
+	}
+}
+
+// Backend returns the backend settings of the common flags.
+func Backend(c *cli.Context) kaniko.Backend {
+	return kaniko.Backend{
+		Name:          c.String("backend"),
+		ExecutorImage: c.String("executor-image"),
+		DockerHost:    c.String("docker-host"),
+		Container:     c.String("backend-container"),
+
+		KubeAPIServer:      c.String("k8s-api-server"),
+		KubeToken:          c.String("k8s-token"),
+		KubeNamespace:      c.String("k8s-namespace"),
+		KubeServiceAccount: c.String("k8s-service-account"),
+		KubeNodeSelector:   c.StringSlice("k8s-node-selector"),
+		KubeContextVolume:  c.String("k8s-context-volume"),
+
+		ContextBucket: c.String("context-bucket"),
+	}
+}
+
+// GitOps returns the GitOps settings of the common flags.
+func GitOps(c *cli.Context) gitops.Config {
+	return gitops.Config{
+		Repo:          c.String("gitops-repo"),
+		Branch:        c.String("gitops-branch"),
+		Username:      c.String("gitops-username"),
+		Token:         c.String("gitops-token"),
+		Manifests:     c.StringSlice("gitops-manifests"),
+		CommitMessage: c.String("gitops-commit-message"),
+		AuthorName:    c.String("gitops-author-name"),
+		AuthorEmail:   c.String("gitops-author-email"),
+	}
+}
+
+// Status returns the commit status settings of the common flags.
+func Status(c *cli.Context) status.Config {
+	return status.Config{
+		Provider:  c.String("status-provider"),
+		URL:       c.String("status-url"),
+		Token:     c.String("status-token"),
+		Repo:      c.String("status-repo"),
+		Commit:    c.String("drone-commit-sha"),
+		Context:   c.String("status-context"),
+		TargetURL: c.String("status-target-url"),
+		CheckRun:  c.Bool("status-check-run"),
+	}
+}
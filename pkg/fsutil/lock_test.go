@@ -0,0 +1,26 @@
+//go:build !windows
+
+package fsutil
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".lock")
+	unlock, err := Lock(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Lock(path, false); err != ErrLocked {
+		t.Errorf("expected ErrLocked while held, got %v", err)
+	}
+	unlock()
+
+	unlock, err = Lock(path, false)
+	if err != nil {
+		t.Fatalf("expected the released lock to be free: %s", err)
+	}
+	unlock()
+}
@@ -0,0 +1,175 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultArtifactRegistryURL is the Artifact Registry API.
+const DefaultArtifactRegistryURL = "https://artifactregistry.googleapis.com/v1"
+
+// TokenSource issues access tokens, e.g. Credentials or Impersonator.
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// Repository is an Artifact Registry repository.
+type Repository struct {
+	Project  string
+	Location string
+	Name     string
+	Labels   map[string]string
+	KMSKey   string // customer managed encryption key, optional
+}
+
+// ParseRepository returns the repository of an image name such as
+// us-docker.pkg.dev/project/repository/image.
+func ParseRepository(image string) (Repository, error) {
+	parts := strings.Split(image, "/")
+	if len(parts) < 3 || !IsArtifactRegistryHost(parts[0]) {
+		return Repository{}, fmt.Errorf("%s is not an Artifact Registry image, expected LOCATION-docker.pkg.dev/PROJECT/REPOSITORY/IMAGE", image)
+	}
+	return Repository{
+		Location: strings.TrimSuffix(parts[0], "-docker.pkg.dev"),
+		Project:  parts[1],
+		Name:     parts[2],
+	}, nil
+}
+
+func (r Repository) path() string {
+	return fmt.Sprintf("projects/%s/locations/%s/repositories/%s", r.Project, r.Location, r.Name)
+}
+
+// ArtifactRegistry is a minimal Artifact Registry API client.
+type ArtifactRegistry struct {
+	Tokens       TokenSource
+	URL          string // defaults to DefaultArtifactRegistryURL
+	HTTP         *http.Client
+	PollInterval time.Duration
+}
+
+// EnsureRepository creates the docker format repository unless it exists,
+// and reports whether it was created.
+func (a ArtifactRegistry) EnsureRepository(ctx context.Context, repo Repository) (bool, error) {
+	token, err := a.Tokens.Token(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := a.do(ctx, token, http.MethodGet, repo.path(), nil)
+	if err != nil {
+		return false, err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return false, nil
+	case http.StatusNotFound:
+	default:
+		return false, statusError("getting repository "+repo.path(), res)
+	}
+
+	body := map[string]interface{}{"format": "DOCKER"}
+	if len(repo.Labels) > 0 {
+		body["labels"] = repo.Labels
+	}
+	if repo.KMSKey != "" {
+		body["kmsKeyName"] = repo.KMSKey
+	}
+	parent := fmt.Sprintf("projects/%s/locations/%s/repositories?repositoryId=%s", repo.Project, repo.Location, url.QueryEscape(repo.Name))
+	res, err = a.do(ctx, token, http.MethodPost, parent, body)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		// created concurrently by another build
+		return false, nil
+	default:
+		return false, statusError("creating repository "+repo.path(), res)
+	}
+
+	var op operation
+	if err := json.NewDecoder(res.Body).Decode(&op); err != nil {
+		return false, errors.Wrap(err, "failed to decode create repository response")
+	}
+	return true, a.wait(ctx, token, op)
+}
+
+// operation is a long-running operation of the API.
+type operation struct {
+	Name  string `json:"name"`
+	Done  bool   `json:"done"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (a ArtifactRegistry) wait(ctx context.Context, token Token, op operation) error {
+	interval := a.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for !op.Done {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		res, err := a.do(ctx, token, http.MethodGet, op.Name, nil)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			err := statusError("polling operation "+op.Name, res)
+			res.Body.Close()
+			return err
+		}
+		err = json.NewDecoder(res.Body).Decode(&op)
+		res.Body.Close()
+		if err != nil {
+			return errors.Wrap(err, "failed to decode operation")
+		}
+	}
+	if op.Error != nil {
+		return fmt.Errorf("failed to create repository: %s", op.Error.Message)
+	}
+	return nil
+}
+
+func (a ArtifactRegistry) do(ctx context.Context, token Token, method, path string, body interface{}) (*http.Response, error) {
+	endpoint := a.URL
+	if endpoint == "" {
+		endpoint = DefaultArtifactRegistryURL
+	}
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+"/"+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := httpClient(a.HTTP).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "artifact registry request failed")
+	}
+	return res, nil
+}
@@ -0,0 +1,212 @@
+// Package gcp mints Google Cloud access tokens for registry authentication
+// without depending on the Google client libraries.
+package gcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CloudPlatformScope is the OAuth scope requested for all tokens.
+const CloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// DefaultTokenURL is the Google OAuth token endpoint.
+const DefaultTokenURL = "https://oauth2.googleapis.com/token"
+
+// DefaultMetadataURL is the metadata server endpoint issuing tokens for the
+// service account attached to the instance or the Workload Identity pod.
+const DefaultMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// Token is a short-lived Google access token.
+type Token struct {
+	AccessToken string
+	ExpiresAt   time.Time // zero when the expiry is unknown
+}
+
+// Credentials issues access tokens from a JSON key, the file referenced by
+// GOOGLE_APPLICATION_CREDENTIALS, or the metadata server, in that order.
+type Credentials struct {
+	JSON        []byte // service account or authorized user key
+	MetadataURL string // defaults to DefaultMetadataURL
+	HTTP        *http.Client
+}
+
+// key holds the fields of service account and authorized user keys.
+type key struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Token requests a new access token.
+func (c Credentials) Token(ctx context.Context) (Token, error) {
+	data := c.JSON
+	if len(data) == 0 {
+		if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+			var err error
+			if data, err = ioutil.ReadFile(path); err != nil {
+				return Token{}, errors.Wrap(err, "failed to read application default credentials")
+			}
+		}
+	}
+	if len(data) == 0 {
+		return c.metadataToken(ctx)
+	}
+
+	var k key
+	if err := json.Unmarshal(data, &k); err != nil {
+		return Token{}, errors.Wrap(err, "failed to parse google credentials")
+	}
+	switch k.Type {
+	case "service_account":
+		return c.serviceAccountToken(ctx, k)
+	case "authorized_user":
+		return c.exchange(ctx, DefaultTokenURL, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {k.ClientID},
+			"client_secret": {k.ClientSecret},
+			"refresh_token": {k.RefreshToken},
+		})
+	default:
+		return Token{}, fmt.Errorf("unsupported google credentials type %q", k.Type)
+	}
+}
+
+func (c Credentials) serviceAccountToken(ctx context.Context, k key) (Token, error) {
+	tokenURL := k.TokenURI
+	if tokenURL == "" {
+		tokenURL = DefaultTokenURL
+	}
+	assertion, err := signJWT(k, tokenURL, time.Now())
+	if err != nil {
+		return Token{}, err
+	}
+	return c.exchange(ctx, tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+}
+
+func (c Credentials) metadataToken(ctx context.Context) (Token, error) {
+	endpoint := c.MetadataURL
+	if endpoint == "" {
+		endpoint = DefaultMetadataURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return c.do(req, "metadata server")
+}
+
+func (c Credentials) exchange(ctx context.Context, endpoint string, form url.Values) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(req, "oauth")
+}
+
+func (c Credentials) do(req *http.Request, source string) (Token, error) {
+	res, err := httpClient(c.HTTP).Do(req)
+	if err != nil {
+		return Token{}, errors.Wrapf(err, "failed to get %s token", source)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Token{}, statusError(source+" token request", res)
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return Token{}, errors.Wrapf(err, "failed to decode %s token response", source)
+	}
+	if out.AccessToken == "" {
+		return Token{}, fmt.Errorf("%s token response did not contain an access token", source)
+	}
+	token := Token{AccessToken: out.AccessToken}
+	if out.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// signJWT creates the self-signed assertion exchanged for a service account
+// access token.
+func signJWT(k key, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("failed to decode service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", errors.Wrap(err, "failed to parse service account private key")
+		}
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account private key is not an RSA key")
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": k.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   k.ClientEmail,
+		"scope": CloudPlatformScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign service account assertion")
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+	return c
+}
+
+func statusError(action string, res *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	return fmt.Errorf("%s failed with status %s: %s", action, res.Status, strings.TrimSpace(string(msg)))
+}
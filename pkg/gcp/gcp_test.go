@@ -0,0 +1,205 @@
+package gcp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImpersonate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || strings.Count(r.FormValue("assertion"), ".") != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "base", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v1/projects/-/serviceAccounts/builder@acme.iam.gserviceaccount.com:generateAccessToken", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer base" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"accessToken": "impersonated", "expireTime": expire})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	keyJSON, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "ci@acme.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    server.URL + "/token",
+	})
+	impersonator := Impersonator{
+		Base:           Credentials{JSON: keyJSON},
+		ServiceAccount: "builder@acme.iam.gserviceaccount.com",
+		URL:            server.URL + "/v1",
+	}
+	token, err := impersonator.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "impersonated" || !token.ExpiresAt.Equal(expire) {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	impersonator.ServiceAccount = "admin@acme.iam.gserviceaccount.com"
+	if _, err := impersonator.Token(context.Background()); err == nil {
+		t.Errorf("expected an error for an unknown service account")
+	}
+}
+
+func TestMetadataToken(t *testing.T) {
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "workload", "expires_in": 60})
+	}))
+	defer server.Close()
+
+	token, err := Credentials{MetadataURL: server.URL}.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "workload" || token.ExpiresAt.IsZero() {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	if _, err := (Credentials{JSON: []byte(`{"type":"external_account"}`)}).Token(context.Background()); err == nil {
+		t.Errorf("expected an error for unsupported credentials")
+	}
+}
+
+type staticToken string
+
+func (s staticToken) Token(context.Context) (Token, error) {
+	return Token{AccessToken: string(s)}, nil
+}
+
+func TestEnsureRepository(t *testing.T) {
+	repo, err := ParseRepository("europe-west1-docker.pkg.dev/acme/images/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.Location != "europe-west1" || repo.Project != "acme" || repo.Name != "images" {
+		t.Errorf("unexpected repository %+v", repo)
+	}
+	if _, err := ParseRepository("gcr.io/acme/app"); err == nil {
+		t.Errorf("expected an error for a gcr image")
+	}
+
+	var created map[string]interface{}
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/projects/acme/locations/europe-west1/repositories/images", func(w http.ResponseWriter, r *http.Request) {
+		if created == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(created)
+	})
+	mux.HandleFunc("/v1/projects/acme/locations/europe-west1/repositories", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.URL.Query().Get("repositoryId") != "images" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&created)
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "projects/acme/locations/europe-west1/operations/1"})
+	})
+	mux.HandleFunc("/v1/projects/acme/locations/europe-west1/operations/1", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "projects/acme/locations/europe-west1/operations/1", "done": polls > 1})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := ArtifactRegistry{Tokens: staticToken("secret"), URL: server.URL + "/v1", PollInterval: time.Millisecond}
+	repo.Labels = map[string]string{"team": "ci"}
+	repo.KMSKey = "projects/acme/locations/europe-west1/keyRings/ci/cryptoKeys/images"
+	ok, err := client.EnsureRepository(context.Background(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || created["format"] != "DOCKER" || created["kmsKeyName"] != repo.KMSKey || polls != 2 {
+		t.Errorf("unexpected create request %v after %d polls", created, polls)
+	}
+
+	if ok, err := client.EnsureRepository(context.Background(), repo); err != nil || ok {
+		t.Errorf("expected the existing repository to be kept, got %v, %v", ok, err)
+	}
+}
+
+func TestParseGCRRepository(t *testing.T) {
+	repo, err := ParseGCRRepository("eu.gcr.io/acme/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.Location != "europe" || repo.Project != "acme" || repo.Name != "eu.gcr.io" {
+		t.Errorf("unexpected repository %+v", repo)
+	}
+	for _, image := range []string{"gcr.io/acme", "docker.io/acme/app", "europe-west1-docker.pkg.dev/acme/images/app"} {
+		if _, err := ParseGCRRepository(image); err == nil {
+			t.Errorf("expected an error for %s", image)
+		}
+	}
+	if !IsArtifactRegistryHost("us-central1-docker.pkg.dev") || IsArtifactRegistryHost("docker.pkg.dev") || IsArtifactRegistryHost("evil.com/us-docker.pkg.dev") {
+		t.Errorf("unexpected Artifact Registry host matching")
+	}
+}
+
+func TestCheckUpload(t *testing.T) {
+	granted := []string{UploadPermission}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/projects/acme/locations/europe-west1/repositories/images:testIamPermissions", func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Permissions []string `json:"permissions"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&in) != nil || len(in.Permissions) != 1 || in.Permissions[0] != UploadPermission {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"permissions": granted})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := ArtifactRegistry{Tokens: staticToken("secret"), URL: server.URL + "/v1"}
+	repo := Repository{Project: "acme", Location: "europe-west1", Name: "images"}
+	if err := client.CheckUpload(context.Background(), repo); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	granted = nil
+	var denied *PermissionError
+	if err := client.CheckUpload(context.Background(), repo); !errors.As(err, &denied) || denied.Permission != UploadPermission {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+
+	repo.Name = "missing"
+	if err := client.CheckUpload(context.Background(), repo); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultIAMCredentialsURL is the IAM Service Account Credentials API.
+const DefaultIAMCredentialsURL = "https://iamcredentials.googleapis.com/v1"
+
+// Impersonator mints access tokens for a target service account using the
+// base credentials, which need roles/iam.serviceAccountTokenCreator on it.
+type Impersonator struct {
+	Base           Credentials
+	ServiceAccount string // email of the target service account
+	URL            string // defaults to DefaultIAMCredentialsURL
+	Lifetime       time.Duration
+}
+
+// Token requests a new access token for the target service account.
+func (i Impersonator) Token(ctx context.Context) (Token, error) {
+	base, err := i.Base.Token(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+
+	endpoint := i.URL
+	if endpoint == "" {
+		endpoint = DefaultIAMCredentialsURL
+	}
+	lifetime := i.Lifetime
+	if lifetime <= 0 {
+		lifetime = time.Hour
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"scope":    []string{CloudPlatformScope},
+		"lifetime": fmt.Sprintf("%ds", int64(lifetime.Seconds())),
+	})
+	if err != nil {
+		return Token{}, err
+	}
+	target := fmt.Sprintf("%s/projects/-/serviceAccounts/%s:generateAccessToken", endpoint, url.PathEscape(i.ServiceAccount))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+base.AccessToken)
+
+	res, err := httpClient(i.Base.HTTP).Do(req)
+	if err != nil {
+		return Token{}, errors.Wrapf(err, "failed to impersonate %s", i.ServiceAccount)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Token{}, statusError("impersonating "+i.ServiceAccount, res)
+	}
+
+	var out struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return Token{}, errors.Wrap(err, "failed to decode impersonation response")
+	}
+	if out.AccessToken == "" {
+		return Token{}, fmt.Errorf("impersonation response did not contain an access token")
+	}
+	return Token{AccessToken: out.AccessToken, ExpiresAt: out.ExpireTime}, nil
+}
@@ -0,0 +1,111 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// UploadPermission is the permission needed to push images to a repository.
+const UploadPermission = "artifactregistry.repositories.uploadArtifacts"
+
+// ErrNotFound is returned when the repository does not exist.
+var ErrNotFound = errors.New("repository not found")
+
+// artifactRegistryHost matches the docker hosts of Artifact Registry, e.g.
+// europe-west1-docker.pkg.dev.
+var artifactRegistryHost = regexp.MustCompile(`^[a-z][a-z0-9-]*[a-z0-9]-docker\.pkg\.dev$`)
+
+// gcrLocations maps the Container Registry hosts to the location of the
+// gcr.io repositories backing them in Artifact Registry.
+var gcrLocations = map[string]string{
+	"gcr.io":      "us",
+	"us.gcr.io":   "us",
+	"eu.gcr.io":   "europe",
+	"asia.gcr.io": "asia",
+}
+
+// IsArtifactRegistryHost returns true for the docker hosts of Artifact
+// Registry.
+func IsArtifactRegistryHost(host string) bool {
+	return artifactRegistryHost.MatchString(host)
+}
+
+// ParseGCRRepository returns the gcr.io repository backing an image such as
+// gcr.io/project/image in a project served by Artifact Registry.
+func ParseGCRRepository(image string) (Repository, error) {
+	parts := strings.Split(image, "/")
+	location, ok := gcrLocations[parts[0]]
+	if !ok {
+		return Repository{}, fmt.Errorf("%s is not a Container Registry host, expected gcr.io, us.gcr.io, eu.gcr.io or asia.gcr.io", parts[0])
+	}
+	if len(parts) < 3 || parts[1] == "" {
+		return Repository{}, fmt.Errorf("%s is not a Container Registry image, expected HOST/PROJECT/IMAGE", image)
+	}
+	return Repository{Project: parts[1], Location: location, Name: parts[0]}, nil
+}
+
+// PermissionError is returned when the credentials lack a permission on the
+// repository.
+type PermissionError struct {
+	Repository Repository
+	Permission string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("the credentials lack %s on %s: grant roles/artifactregistry.writer on the repository, and check the registry host and project %s are the intended ones",
+		e.Permission, e.Repository.path(), e.Repository.Project)
+}
+
+// CheckUpload tests with testIamPermissions that the credentials may push to
+// the repository. It returns a *PermissionError when they may not, and
+// ErrNotFound when the repository does not exist.
+func (a ArtifactRegistry) CheckUpload(ctx context.Context, repo Repository) error {
+	token, err := a.Tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := a.do(ctx, token, http.MethodPost, repo.path()+":testIamPermissions", map[string]interface{}{
+		"permissions": []string{UploadPermission},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return ErrNotFound
+	default:
+		return statusError("testing permissions on "+repo.path(), res)
+	}
+
+	var out struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return errors.Wrap(err, "failed to decode permissions response")
+	}
+	for _, permission := range out.Permissions {
+		if permission == UploadPermission {
+			return nil
+		}
+	}
+	return &PermissionError{Repository: repo, Permission: UploadPermission}
+}
+
+// NewTokenSource returns the token source of the JSON key, or of the
+// application default credentials when the key is empty, impersonating the
+// service account when set.
+func NewTokenSource(jsonKey []byte, serviceAccount string) TokenSource {
+	base := Credentials{JSON: jsonKey}
+	if serviceAccount != "" {
+		return Impersonator{Base: base, ServiceAccount: serviceAccount}
+	}
+	return base
+}
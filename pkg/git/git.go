@@ -0,0 +1,109 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Command returns a git command executed in dir.
+func Command(dir string, args ...string) *exec.Cmd {
+	return CommandContext(context.Background(), dir, args...)
+}
+
+// CommandContext returns a git command executed in dir, killed when ctx is
+// cancelled.
+func CommandContext(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// Output executes git in dir and returns its trimmed standard output.
+func Output(dir string, args ...string) (string, error) {
+	return OutputContext(context.Background(), dir, args...)
+}
+
+// OutputContext executes git in dir until ctx is cancelled and returns its
+// trimmed standard output.
+func OutputContext(ctx context.Context, dir string, args ...string) (string, error) {
+	return OutputEnv(ctx, dir, nil, args...)
+}
+
+// OutputEnv executes git in dir with env added to the environment until ctx
+// is cancelled and returns its trimmed standard output.
+func OutputEnv(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := CommandContext(ctx, dir, args...)
+	if len(env) != 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %s", subcommand(args), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// ConfigEnv returns the environment passing the key and value pairs to git
+// as configuration. Unlike -c options it does not show in process listings.
+func ConfigEnv(pairs ...string) []string {
+	env := []string{fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(pairs)/2)}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i/2, pairs[i]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i/2, pairs[i+1]),
+		)
+	}
+	return env
+}
+
+// subcommand returns the git subcommand in args, skipping the global options
+// before it.
+func subcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-c" || args[i] == "-C":
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			return args[i]
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// Metadata describes the checked out commit.
+type Metadata struct {
+	Commit  string // Commit sha
+	Author  string // Commit author name
+	Message string // First line of the commit message
+	Branch  string // Checked out branch, empty when detached
+	Tag     string // Tag pointing at the commit, empty when untagged
+}
+
+// ReadMetadata reads the metadata of the commit checked out in dir. Only a
+// missing commit is an error, the branch and tag are optional.
+func ReadMetadata(dir string) (Metadata, error) {
+	var meta Metadata
+	var err error
+	if meta.Commit, err = Output(dir, "rev-parse", "HEAD"); err != nil {
+		return meta, err
+	}
+	if meta.Author, err = Output(dir, "log", "-1", "--format=%an"); err != nil {
+		return meta, err
+	}
+	if meta.Message, err = Output(dir, "log", "-1", "--format=%s"); err != nil {
+		return meta, err
+	}
+	if branch, err := Output(dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		meta.Branch = branch
+	}
+	if tag, err := Output(dir, "describe", "--tags", "--exact-match", "HEAD"); err == nil {
+		meta.Tag = tag
+	}
+	return meta, nil
+}
@@ -0,0 +1,37 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubcommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"rev-parse", "HEAD"}, "rev-parse"},
+		{[]string{"-c", "user.name=drone", "-c", "user.email=drone@localhost", "commit", "-m", "message"}, "commit"},
+		{[]string{"-C", "/tmp", "--no-pager", "log"}, "log"},
+		{[]string{"--version"}, "--version"},
+	}
+	for _, test := range tests {
+		if got := subcommand(test.args); got != test.want {
+			t.Errorf("subcommand(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestConfigEnv(t *testing.T) {
+	got := ConfigEnv("http.extraHeader", "Authorization: Basic dG9rZW4=", "user.name", "drone")
+	want := []string{
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic dG9rZW4=",
+		"GIT_CONFIG_KEY_1=user.name",
+		"GIT_CONFIG_VALUE_1=drone",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigEnv() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,172 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/drone/drone-kaniko/pkg/git"
+)
+
+const (
+	defaultUsername      string = "x-access-token"
+	defaultAuthorName    string = "drone-kaniko"
+	defaultAuthorEmail   string = "drone-kaniko@localhost"
+	defaultCommitMessage string = "Update {{ .Image }} to {{ .Tag }}"
+)
+
+type (
+	// Config defines the GitOps repository that is updated after a push.
+	Config struct {
+		Repo          string   // GitOps repository clone url
+		Branch        string   // Branch to commit to, defaults to the remote default branch
+		Username      string   // Username used together with the token
+		Token         string   // Token used for https authentication
+		Manifests     []string // Manifest files, relative to the repository root
+		CommitMessage string   // Commit message template
+		AuthorName    string   // Commit author name
+		AuthorEmail   string   // Commit author email
+	}
+
+	// Update describes the image change committed to the GitOps repository.
+	Update struct {
+		Image  string   // Image repository
+		Tag    string   // Tag written to the manifests
+		Tags   []string // All tags pushed by the build
+		Digest string   // Digest of the pushed image
+	}
+)
+
+// Commit clones the GitOps repository, rewrites every reference to the image in
+// the configured manifests and pushes the change back.
+func Commit(ctx context.Context, cfg Config, update Update) error {
+	if len(cfg.Manifests) == 0 {
+		return fmt.Errorf("at least one gitops manifest must be specified")
+	}
+
+	message, err := renderMessage(cfg.CommitMessage, update)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "gitops")
+	if err != nil {
+		return errors.Wrap(err, "failed to create gitops workspace")
+	}
+	defer os.RemoveAll(dir)
+
+	auth := authEnv(cfg)
+	cloneArgs := []string{"clone", "--depth=1"}
+	if cfg.Branch != "" {
+		cloneArgs = append(cloneArgs, "--branch", cfg.Branch)
+	}
+	if _, err := git.OutputEnv(ctx, "", auth, append(cloneArgs, cfg.Repo, dir)...); err != nil {
+		return errors.Wrap(err, "failed to clone gitops repository")
+	}
+
+	changed := false
+	for _, manifest := range cfg.Manifests {
+		path := filepath.Join(dir, manifest)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to read gitops manifest %s", manifest))
+		}
+		rewritten := RewriteImage(string(content), update.Image, update.Tag)
+		if rewritten == string(content) {
+			continue
+		}
+		if err := ioutil.WriteFile(path, []byte(rewritten), 0644); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to write gitops manifest %s", manifest))
+		}
+		changed = true
+	}
+	if !changed {
+		fmt.Fprintf(os.Stdout, "gitops manifests already reference %s:%s, nothing to commit\n", update.Image, update.Tag)
+		return nil
+	}
+
+	authorName, authorEmail := cfg.AuthorName, cfg.AuthorEmail
+	if authorName == "" {
+		authorName = defaultAuthorName
+	}
+	if authorEmail == "" {
+		authorEmail = defaultAuthorEmail
+	}
+	if _, err := git.OutputContext(ctx, dir, append([]string{"add", "--"}, cfg.Manifests...)...); err != nil {
+		return err
+	}
+	if _, err := git.OutputContext(ctx, dir, "-c", "user.name="+authorName, "-c", "user.email="+authorEmail, "commit", "-m", message); err != nil {
+		return errors.Wrap(err, "failed to commit gitops change")
+	}
+	if _, err := git.OutputEnv(ctx, dir, auth, "push", "origin", "HEAD"); err != nil {
+		return errors.Wrap(err, "failed to push gitops change")
+	}
+	fmt.Fprintf(os.Stdout, "pushed gitops change: %s\n", message)
+	return nil
+}
+
+// RewriteImage replaces the tag and digest of every reference to image in
+// content with the given tag.
+func RewriteImage(content, image, tag string) string {
+	re := regexp.MustCompile(regexp.QuoteMeta(image) + `(?::[\w][\w.-]{0,127})?(?:@sha256:[0-9a-f]{64})?`)
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(content, -1) {
+		// only rewrite whole references, not repositories sharing a prefix
+		if loc[0] > 0 && isRefChar(content[loc[0]-1]) {
+			continue
+		}
+		if loc[1] < len(content) && (isRefChar(content[loc[1]]) || content[loc[1]] == ':' || content[loc[1]] == '@') {
+			continue
+		}
+		b.WriteString(content[last:loc[0]])
+		b.WriteString(image + ":" + tag)
+		last = loc[1]
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+func isRefChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '/' || c == '-'
+}
+
+func renderMessage(text string, update Update) (string, error) {
+	if text == "" {
+		text = defaultCommitMessage
+	}
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to parse gitops commit message template")
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, update); err != nil {
+		return "", errors.Wrap(err, "failed to render gitops commit message")
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// authEnv returns the git configuration that authenticates https requests
+// with the token, keeping it out of the remote url, the logs and the process
+// listing.
+func authEnv(cfg Config) []string {
+	if cfg.Token == "" {
+		return nil
+	}
+	username := cfg.Username
+	if username == "" {
+		username = defaultUsername
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + cfg.Token))
+	return git.ConfigEnv("http.extraHeader", "Authorization: Basic "+auth)
+}
@@ -0,0 +1,54 @@
+package gitops
+
+import "testing"
+
+func TestRewriteImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "tagged",
+			content: "image: foo/bar:1.0.0\n",
+			want:    "image: foo/bar:1.1.0\n",
+		},
+		{
+			name:    "untagged",
+			content: "image: \"foo/bar\"\n",
+			want:    "image: \"foo/bar:1.1.0\"\n",
+		},
+		{
+			name:    "digest",
+			content: "image: foo/bar:1.0.0@sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n",
+			want:    "image: foo/bar:1.1.0\n",
+		},
+		{
+			name:    "shared_prefix",
+			content: "image: foo/bar-sidecar:1.0.0\nother: registry.io/foo/bar:1.0.0\n",
+			want:    "image: foo/bar-sidecar:1.0.0\nother: registry.io/foo/bar:1.0.0\n",
+		},
+		{
+			name:    "adjacent",
+			content: "images: foo/bar:1,foo/bar:2",
+			want:    "images: foo/bar:1.1.0,foo/bar:1.1.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RewriteImage(tt.content, "foo/bar", "1.1.0"); got != tt.want {
+				t.Errorf("RewriteImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMessage(t *testing.T) {
+	got, err := renderMessage("", Update{Image: "foo/bar", Tag: "1.1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Update foo/bar to 1.1.0"; got != want {
+		t.Errorf("renderMessage() = %q, want %q", got, want)
+	}
+}
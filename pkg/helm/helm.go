@@ -0,0 +1,289 @@
+// Package helm packages Helm charts as helm package does, without the helm
+// binary, so they can be pushed to registries as OCI artifacts. Packages are
+// reproducible: entries are sorted and their times and owners are reset.
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/drone/drone-kaniko/pkg/contextpack"
+	"github.com/drone/drone-kaniko/pkg/dockerignore"
+	"github.com/pkg/errors"
+)
+
+// epoch is the modification time of all entries.
+var epoch = time.Unix(0, 0)
+
+// nameRE matches chart names usable as repository names.
+var nameRE = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*$`)
+
+// Metadata is the chart metadata of Chart.yaml, pushed as the config of the
+// chart artifact. Only scalar fields are read.
+type Metadata struct {
+	APIVersion  string `json:"apiVersion"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"appVersion,omitempty"`
+	KubeVersion string `json:"kubeVersion,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Home        string `json:"home,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+}
+
+// Chart is a packaged chart.
+type Chart struct {
+	Metadata Metadata
+	Content  []byte // Gzip compressed tarball of the chart
+}
+
+// Load packages the chart in the directory, or reads the chart packaged
+// with helm package when the path is a .tgz file.
+func Load(path string) (*Chart, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Helm chart")
+	}
+	if !info.IsDir() {
+		return loadPackage(path)
+	}
+	return packageDir(path)
+}
+
+// Config returns the chart metadata as JSON.
+func (c *Chart) Config() ([]byte, error) {
+	return json.Marshal(c.Metadata)
+}
+
+// Tag returns the tag of the chart, its version with + replaced, as tags
+// must not contain it.
+func (c *Chart) Tag() string {
+	return strings.Replace(c.Metadata.Version, "+", "_", -1)
+}
+
+// Annotations returns the annotations of the chart manifest.
+func (c *Chart) Annotations() map[string]string {
+	annotations := map[string]string{
+		"org.opencontainers.image.title":   c.Metadata.Name,
+		"org.opencontainers.image.version": c.Metadata.Version,
+	}
+	if c.Metadata.Description != "" {
+		annotations["org.opencontainers.image.description"] = c.Metadata.Description
+	}
+	if c.Metadata.Home != "" {
+		annotations["org.opencontainers.image.url"] = c.Metadata.Home
+	}
+	return annotations
+}
+
+// packageDir packages the chart in dir under a directory named after the
+// chart, leaving out the paths excluded by its .helmignore file.
+func packageDir(dir string) (*Chart, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Helm chart")
+	}
+	metadata, err := parseMetadata(content)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := readHelmignore(filepath.Join(dir, ".helmignore"))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	err = contextpack.Walk(dir, ignore, []string{"Chart.yaml"}, func(file, rel string, info os.FileInfo) error {
+		if info.Mode()&os.ModeSymlink != 0 {
+			// helm package follows links to files
+			if info, err = os.Stat(file); err != nil {
+				return err
+			}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return writeEntry(tw, file, metadata.Name+"/"+rel, info)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to package Helm chart")
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &Chart{Metadata: metadata, Content: buf.Bytes()}, nil
+}
+
+func writeEntry(tw *tar.Writer, file, name string, info os.FileInfo) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  epoch,
+		Format:   tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+// loadPackage reads the metadata of a packaged chart from the Chart.yaml
+// file in its top directory.
+func loadPackage(file string) (*Chart, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Helm chart")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("Helm chart %s is not a directory or a gzip compressed tarball", file)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("Helm chart %s does not contain a Chart.yaml file", file)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to read Helm chart %s", file))
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if path.Base(name) != "Chart.yaml" || strings.Count(name, "/") != 1 {
+			continue
+		}
+		chartYAML, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		metadata, err := parseMetadata(chartYAML)
+		if err != nil {
+			return nil, err
+		}
+		return &Chart{Metadata: metadata, Content: content}, nil
+	}
+}
+
+// parseMetadata reads the top level scalar fields of Chart.yaml and checks
+// the chart can be pushed.
+func parseMetadata(content []byte) (Metadata, error) {
+	fields := map[string]string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.ContainsAny(line[:1], " \t#-") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields[strings.TrimSpace(parts[0])] = scalar(parts[1])
+	}
+	m := Metadata{
+		APIVersion:  fields["apiVersion"],
+		Name:        fields["name"],
+		Version:     fields["version"],
+		AppVersion:  fields["appVersion"],
+		KubeVersion: fields["kubeVersion"],
+		Description: fields["description"],
+		Type:        fields["type"],
+		Home:        fields["home"],
+		Icon:        fields["icon"],
+		Deprecated:  fields["deprecated"] == "true",
+	}
+
+	switch {
+	case m.APIVersion != "v1" && m.APIVersion != "v2":
+		return m, fmt.Errorf("unsupported Helm chart apiVersion %q, expected v1 or v2", m.APIVersion)
+	case !nameRE.MatchString(m.Name):
+		return m, fmt.Errorf("invalid Helm chart name %q, expected lowercase letters, digits and separators", m.Name)
+	}
+	if _, err := semver.NewVersion(m.Version); err != nil {
+		return m, fmt.Errorf("invalid Helm chart version %q, expected a semantic version", m.Version)
+	}
+	return m, nil
+}
+
+// scalar returns the value of a YAML scalar, unquoted and without comment.
+// Block scalars are not supported and read as empty.
+func scalar(s string) string {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "" || s[0] == '|' || s[0] == '>':
+		return ""
+	case s[0] == '"':
+		if end := strings.Index(s[1:], `"`); end >= 0 {
+			if value, err := strconv.Unquote(s[:end+2]); err == nil {
+				return value
+			}
+			return s[1 : end+1]
+		}
+	case s[0] == '\'':
+		if end := strings.Index(s[1:], "'"); end >= 0 {
+			return s[1 : end+1]
+		}
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// readHelmignore reads the patterns of the .helmignore file. They follow
+// the rules of .gitignore files: patterns without a slash match names at
+// any depth, and a leading slash anchors them to the chart directory. As
+// with helm, hidden files of the templates directory are always ignored.
+func readHelmignore(file string) (*dockerignore.Matcher, error) {
+	patterns := []string{"templates/.?*"}
+	content, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := ""
+		if strings.HasPrefix(line, "!") {
+			negate, line = "!", line[1:]
+		}
+		line = strings.TrimSuffix(line, "/")
+		if strings.HasPrefix(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+		if line != "" && line != "**/" {
+			patterns = append(patterns, negate+line)
+		}
+	}
+	return dockerignore.New(patterns)
+}
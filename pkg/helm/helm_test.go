@@ -0,0 +1,116 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func write(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// entries returns the names of the files of a packaged chart.
+func entries(t *testing.T, content []byte) []string {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "Chart.yaml"), `apiVersion: v2
+name: app
+description: "The app: deployed"
+version: 1.2.3+build.4 # bumped by the release
+appVersion: '1.2.3'
+maintainers:
+  - name: team
+`)
+	write(t, filepath.Join(dir, "values.yaml"), "replicas: 1\n")
+	write(t, filepath.Join(dir, "templates/deployment.yaml"), "kind: Deployment\n")
+	write(t, filepath.Join(dir, "templates/.swp"), "editor")
+	write(t, filepath.Join(dir, "ci/values.yaml"), "replicas: 2\n")
+	write(t, filepath.Join(dir, "templates/notes.bak"), "backup")
+	write(t, filepath.Join(dir, ".helmignore"), "# ignored\n*.bak\n/ci/\n")
+
+	chart, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{APIVersion: "v2", Name: "app", Version: "1.2.3+build.4", AppVersion: "1.2.3", Description: "The app: deployed"}
+	if diff := cmp.Diff(want, chart.Metadata); diff != "" {
+		t.Errorf("unexpected metadata (-want +got):\n%s", diff)
+	}
+	if got := chart.Tag(); got != "1.2.3_build.4" {
+		t.Errorf("Tag() = %s, want 1.2.3_build.4", got)
+	}
+	files := []string{"app/.helmignore", "app/Chart.yaml", "app/templates/deployment.yaml", "app/values.yaml"}
+	if diff := cmp.Diff(files, entries(t, chart.Content)); diff != "" {
+		t.Errorf("unexpected package entries (-want +got):\n%s", diff)
+	}
+
+	again, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Content, chart.Content) {
+		t.Error("expected reproducible packages")
+	}
+
+	// a chart packaged with helm package is pushed as is
+	file := filepath.Join(t.TempDir(), "app-1.2.3.tgz")
+	if err := ioutil.WriteFile(file, chart.Content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	packaged, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packaged.Content, chart.Content) || packaged.Metadata != chart.Metadata {
+		t.Errorf("unexpected packaged chart %+v", packaged.Metadata)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	for _, content := range []string{
+		"apiVersion: v3\nname: app\nversion: 1.0.0\n",
+		"apiVersion: v2\nversion: 1.0.0\n",
+		"apiVersion: v2\nname: App\nversion: 1.0.0\n",
+		"apiVersion: v2\nname: app\nversion: latest\n",
+	} {
+		if _, err := parseMetadata([]byte(content)); err == nil {
+			t.Errorf("expected error for %q", content)
+		}
+	}
+}
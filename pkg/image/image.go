@@ -0,0 +1,214 @@
+// Package image inspects the layers of built images, either from a tarball
+// written by kaniko or from the manifest pushed to a registry.
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/pkg/errors"
+)
+
+// maxMetadataSize bounds the size of manifest and config files read into memory.
+const maxMetadataSize = 4 << 20
+
+type (
+	// Layer describes an image layer.
+	Layer struct {
+		Digest           string `json:"digest"`
+		Size             int64  `json:"size"`              // Compressed size
+		UncompressedSize int64  `json:"uncompressed_size"` // Uncompressed size, -1 when unknown
+		Command          string `json:"command"`           // Command that created the layer
+	}
+
+	// Image describes the layers of an image.
+	Image struct {
+		Layers []Layer `json:"layers"`
+	}
+
+	// config is the subset of the image config holding the layer history.
+	config struct {
+		History []struct {
+			CreatedBy  string `json:"created_by"`
+			EmptyLayer bool   `json:"empty_layer"`
+		} `json:"history"`
+	}
+)
+
+// Size returns the compressed size of the image layers.
+func (i Image) Size() int64 {
+	var size int64
+	for _, layer := range i.Layers {
+		size += layer.Size
+	}
+	return size
+}
+
+// UncompressedSize returns the uncompressed size of the image layers, or
+// false when it is unknown.
+func (i Image) UncompressedSize() (int64, bool) {
+	var size int64
+	for _, layer := range i.Layers {
+		if layer.UncompressedSize < 0 {
+			return 0, false
+		}
+		size += layer.UncompressedSize
+	}
+	return size, true
+}
+
+// FromTarball inspects an image tarball in the docker save format, as written
+// by kaniko with --tar-path.
+func FromTarball(file string) (Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Image{}, err
+	}
+	defer f.Close()
+
+	type blob struct {
+		size             int64
+		uncompressedSize int64
+		content          []byte
+	}
+	blobs := map[string]blob{}
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Image{}, errors.Wrap(err, "failed to read image tarball")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		r := bufio.NewReader(tr)
+		b := blob{size: hdr.Size, uncompressedSize: hdr.Size}
+		if magic, _ := r.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			if b.uncompressedSize, err = gunzipSize(r); err != nil {
+				return Image{}, errors.Wrap(err, fmt.Sprintf("failed to decompress %s", hdr.Name))
+			}
+		} else if hdr.Size <= maxMetadataSize {
+			if b.content, err = ioutil.ReadAll(r); err != nil {
+				return Image{}, err
+			}
+		}
+		blobs[path.Clean(hdr.Name)] = b
+	}
+
+	var manifest []struct {
+		Config string
+		Layers []string
+	}
+	if err := json.Unmarshal(blobs["manifest.json"].content, &manifest); err != nil || len(manifest) == 0 {
+		return Image{}, fmt.Errorf("image tarball %s does not contain a valid manifest.json", file)
+	}
+
+	var cfg config
+	if content := blobs[path.Clean(manifest[0].Config)].content; content != nil {
+		if err := json.Unmarshal(content, &cfg); err != nil {
+			return Image{}, errors.Wrap(err, "failed to decode image config")
+		}
+	}
+
+	var img Image
+	for _, name := range manifest[0].Layers {
+		b, ok := blobs[path.Clean(name)]
+		if !ok {
+			return Image{}, fmt.Errorf("image tarball %s is missing layer %s", file, name)
+		}
+		img.Layers = append(img.Layers, Layer{
+			Digest:           layerDigest(name),
+			Size:             b.size,
+			UncompressedSize: b.uncompressedSize,
+		})
+	}
+	cfg.annotate(img.Layers)
+	return img, nil
+}
+
+// FromRegistry inspects the image the reference points to. Uncompressed layer
+// sizes are unknown without downloading the layers. For an image index the
+// first image is inspected.
+func FromRegistry(ctx context.Context, client *registry.Client, ref registry.Reference) (Image, error) {
+	manifest, _, err := client.Manifest(ctx, ref)
+	if err != nil {
+		return Image{}, err
+	}
+	if manifest.IsIndex() {
+		if len(manifest.Manifests) == 0 {
+			return Image{}, fmt.Errorf("image index %s is empty", ref)
+		}
+		ref.Digest = manifest.Manifests[0].Digest
+		if manifest, _, err = client.Manifest(ctx, ref); err != nil {
+			return Image{}, err
+		}
+	}
+
+	var img Image
+	for _, desc := range manifest.Layers {
+		img.Layers = append(img.Layers, Layer{Digest: desc.Digest, Size: desc.Size, UncompressedSize: -1})
+	}
+
+	blob, err := client.Blob(ctx, ref, manifest.Config.Digest)
+	if err != nil {
+		return Image{}, errors.Wrap(err, "failed to fetch image config")
+	}
+	defer blob.Close()
+	var cfg config
+	if err := json.NewDecoder(io.LimitReader(blob, maxMetadataSize)).Decode(&cfg); err != nil {
+		return Image{}, errors.Wrap(err, "failed to decode image config")
+	}
+	cfg.annotate(img.Layers)
+	return img, nil
+}
+
+// annotate sets the command of each layer from the config history.
+func (c config) annotate(layers []Layer) {
+	i := 0
+	for _, h := range c.History {
+		if h.EmptyLayer {
+			continue
+		}
+		if i >= len(layers) {
+			return
+		}
+		layers[i].Command = h.CreatedBy
+		i++
+	}
+}
+
+func gunzipSize(r io.Reader) (int64, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	return io.Copy(ioutil.Discard, gz)
+}
+
+// layerDigest derives the layer digest from its file name in the tarball,
+// e.g. 1a2b3c.tar.gz or sha256:1a2b3c.
+func layerDigest(name string) string {
+	base := path.Base(name)
+	base = strings.TrimSuffix(strings.TrimSuffix(base, ".gz"), ".tar")
+	if strings.Contains(base, ":") {
+		return base
+	}
+	return "sha256:" + base
+}
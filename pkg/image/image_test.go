@@ -0,0 +1,62 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFromTarball(t *testing.T) {
+	layer := gzipped(t, bytes.Repeat([]byte("a"), 10000))
+	file := filepath.Join(t.TempDir(), "image.tar")
+	writeTar(t, file, map[string][]byte{
+		"manifest.json": []byte(`[{"Config": "sha256:cfg", "Layers": ["abc.tar.gz"]}]`),
+		"sha256:cfg":    []byte(`{"history": [{"created_by": "ENV A=1", "empty_layer": true}, {"created_by": "RUN make"}]}`),
+		"abc.tar.gz":    layer,
+	})
+
+	img, err := FromTarball(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Image{Layers: []Layer{{Digest: "sha256:abc", Size: int64(len(layer)), UncompressedSize: 10000, Command: "RUN make"}}}
+	if !cmp.Equal(img, want) {
+		t.Errorf("unexpected image: %s", cmp.Diff(want, img))
+	}
+	if size, ok := img.UncompressedSize(); !ok || size != 10000 {
+		t.Errorf("unexpected uncompressed size %d", size)
+	}
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+func writeTar(t *testing.T, file string, entries map[string][]byte) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for name, content := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(content)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,59 @@
+package image
+
+type (
+	// LayerDiff compares a layer with the matching layer of a previous image.
+	LayerDiff struct {
+		Command      string `json:"command"`
+		Digest       string `json:"digest"`
+		Size         int64  `json:"size"`
+		PreviousSize int64  `json:"previous_size"` // -1 for new layers
+		Delta        int64  `json:"delta"`
+		Grew         bool   `json:"grew"` // Delta exceeds the threshold
+	}
+
+	// Report compares the layers of an image with a previous image.
+	Report struct {
+		Image        string      `json:"image"`
+		Baseline     string      `json:"baseline,omitempty"`
+		Size         int64       `json:"size"`
+		PreviousSize int64       `json:"previous_size"`
+		Layers       []LayerDiff `json:"layers"`
+	}
+)
+
+// Compare compares the layers of current with previous. Layers are matched
+// by the command that created them, falling back to their position, and are
+// flagged when they grew by more than threshold bytes.
+func Compare(current, previous Image, threshold int64) Report {
+	report := Report{Size: current.Size(), PreviousSize: previous.Size()}
+	used := make([]bool, len(previous.Layers))
+
+	for i, layer := range current.Layers {
+		match := -1
+		for j, prev := range previous.Layers {
+			if !used[j] && layer.Command != "" && prev.Command == layer.Command {
+				match = j
+				break
+			}
+		}
+		if match < 0 && i < len(previous.Layers) && !used[i] && previous.Layers[i].Command == "" {
+			match = i
+		}
+
+		diff := LayerDiff{
+			Command:      layer.Command,
+			Digest:       layer.Digest,
+			Size:         layer.Size,
+			PreviousSize: -1,
+			Delta:        layer.Size,
+		}
+		if match >= 0 {
+			used[match] = true
+			diff.PreviousSize = previous.Layers[match].Size
+			diff.Delta = layer.Size - diff.PreviousSize
+		}
+		diff.Grew = len(previous.Layers) > 0 && diff.Delta > threshold
+		report.Layers = append(report.Layers, diff)
+	}
+	return report
+}
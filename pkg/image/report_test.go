@@ -0,0 +1,41 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompare(t *testing.T) {
+	previous := Image{Layers: []Layer{
+		{Command: "FROM alpine", Size: 3000},
+		{Command: "RUN apk add git", Size: 5000},
+		{Command: "COPY . /src", Size: 1000},
+	}}
+	current := Image{Layers: []Layer{
+		{Command: "FROM alpine", Size: 3000},
+		{Command: "RUN apk add git curl", Size: 9000},
+		{Command: "COPY . /src", Size: 1200},
+	}}
+
+	got := Compare(current, previous, 500)
+	want := Report{
+		Size:         13200,
+		PreviousSize: 9000,
+		Layers: []LayerDiff{
+			{Command: "FROM alpine", Size: 3000, PreviousSize: 3000},
+			{Command: "RUN apk add git curl", Size: 9000, PreviousSize: -1, Delta: 9000, Grew: true},
+			{Command: "COPY . /src", Size: 1200, PreviousSize: 1000, Delta: 200},
+		},
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("unexpected report: %s", cmp.Diff(want, got))
+	}
+
+	// nothing is flagged without a previous image
+	for _, layer := range Compare(current, Image{}, 500).Layers {
+		if layer.Grew {
+			t.Errorf("unexpected growth flagged for %s", layer.Command)
+		}
+	}
+}
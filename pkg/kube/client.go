@@ -0,0 +1,123 @@
+// Package kube is a minimal Kubernetes API client running the kaniko
+// executor as a Job.
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// serviceAccountDir holds the credentials of the pod service account.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Client talks to the Kubernetes API server.
+type Client struct {
+	Host      string // API server URL
+	Token     string // Bearer token
+	Namespace string // Namespace the resources are created in
+	HTTP      *http.Client
+}
+
+// InClusterClient returns a client authenticating with the service account
+// of the pod the plugin runs in. Host, token and namespace override the
+// in-cluster values when set.
+func InClusterClient(host, token, namespace string) (*Client, error) {
+	if host == "" {
+		h, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if h == "" || port == "" {
+			return nil, fmt.Errorf("not running in a kubernetes cluster, the api server must be specified")
+		}
+		host = "https://" + net.JoinHostPort(h, port)
+	}
+	if token == "" {
+		content, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the service account token: %s", err)
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	if namespace == "" {
+		content, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			namespace = "default"
+		} else {
+			namespace = strings.TrimSpace(string(content))
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt")); err == nil {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &Client{
+		Host:      strings.TrimSuffix(host, "/"),
+		Token:     token,
+		Namespace: namespace,
+		HTTP:      &http.Client{Transport: transport},
+	}, nil
+}
+
+// do sends the request and returns the response when its status is 2xx.
+func (c *Client) do(ctx context.Context, method, path string, v interface{}) (*http.Response, error) {
+	var body io.Reader
+	if v != nil {
+		content, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.Host+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		var status struct {
+			Message string `json:"message"`
+		}
+		content, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+		if json.Unmarshal(content, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(content))
+		}
+		return nil, fmt.Errorf("kubernetes %s %s: %s: %s", method, strings.SplitN(path, "?", 2)[0], res.Status, status.Message)
+	}
+	return res, nil
+}
+
+// doJSON sends v and decodes the response into out, when set.
+func (c *Client) doJSON(ctx context.Context, method, path string, v, out interface{}) error {
+	res, err := c.do(ctx, method, path, v)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if out == nil {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,384 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// terminationLog is the file whose contents Kubernetes reports as the
+// termination message of a container. The executor writes the digest to it.
+const terminationLog = "/dev/termination-log"
+
+// pollInterval is the interval the job is polled at.
+var pollInterval = 2 * time.Second
+
+// ExitError is returned when the executor exits with a non-zero code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("executor exited with status %d", e.Code) }
+
+// ExitCode returns the exit code of the executor.
+func (e *ExitError) ExitCode() int { return e.Code }
+
+// Runner runs commands as a Kubernetes Job of Image. The docker config is
+// passed in a Secret and single files in a ConfigMap, the build context
+// must be remote or on a persistent volume claim mounted at the same path.
+type Runner struct {
+	Client         *Client
+	Image          string
+	ServiceAccount string            // Service account of the job pod
+	NodeSelector   map[string]string // Node labels the job pod is scheduled on
+	ContextVolume  string            // Persistent volume claim holding the build context
+	ContextMount   string            // Path the claim is mounted at, the workspace of the plugin
+
+	DockerConfigDir string   // Local docker config directory passed in a Secret
+	FilePrefixes    []string // Directories whose files in the arguments are passed in a ConfigMap
+	SecretEnv       []string // Environment variables passed in a Secret, e.g. the values of secret build args
+}
+
+type (
+	objectMeta struct {
+		Name string `json:"name"`
+	}
+
+	object struct {
+		Metadata objectMeta `json:"metadata"`
+	}
+
+	podList struct {
+		Items []pod `json:"items"`
+	}
+
+	terminatedState struct {
+		ExitCode int    `json:"exitCode"`
+		Message  string `json:"message"`
+	}
+
+	pod struct {
+		Metadata objectMeta `json:"metadata"`
+		Status   struct {
+			Phase             string `json:"phase"`
+			ContainerStatuses []struct {
+				State struct {
+					Terminated *terminatedState `json:"terminated"`
+				} `json:"state"`
+			} `json:"containerStatuses"`
+		} `json:"status"`
+	}
+)
+
+// Run runs cmd as a Job, streaming the executor log to the command output
+// and writing the digest to the digest file of the arguments.
+func (r Runner) Run(ctx context.Context, cmd *exec.Cmd) error {
+	args, digestFile, err := r.jobArgs(cmd.Args[1:])
+	if err != nil {
+		return err
+	}
+	files, err := r.files(args)
+	if err != nil {
+		return err
+	}
+
+	// clean up even when the build is cancelled
+	var cleanup []string
+	defer func() {
+		for _, path := range cleanup {
+			if err := r.Client.doJSON(context.Background(), http.MethodDelete, path, map[string]string{"propagationPolicy": "Background"}, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to delete %s: %s\n", path, err)
+			}
+		}
+	}()
+	ns := "/api/v1/namespaces/" + r.Client.Namespace
+
+	var volumes, mounts []map[string]interface{}
+	var env []map[string]interface{}
+	secretEnv := map[string]string{}
+	var secretNames []string
+	for _, v := range r.SecretEnv {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if _, ok := secretEnv[parts[0]]; !ok {
+			secretNames = append(secretNames, parts[0])
+		}
+		secretEnv[parts[0]] = parts[1]
+	}
+	for _, v := range addedEnv(cmd.Env, os.Environ()) {
+		parts := strings.SplitN(v, "=", 2)
+		if _, secret := secretEnv[parts[0]]; parts[0] != "DOCKER_CONFIG" && !secret {
+			env = append(env, map[string]interface{}{"name": parts[0], "value": parts[1]})
+		}
+	}
+
+	if len(secretEnv) > 0 {
+		// secret values are kept out of the job spec, readable by anyone
+		// allowed to list jobs
+		var secret object
+		err = r.Client.doJSON(ctx, http.MethodPost, ns+"/secrets", map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"generateName": "kaniko-env-"},
+			"stringData": secretEnv,
+		}, &secret)
+		if err != nil {
+			return errors.Wrap(err, "failed to create environment secret")
+		}
+		cleanup = append(cleanup, ns+"/secrets/"+secret.Metadata.Name)
+		for _, name := range secretNames {
+			env = append(env, map[string]interface{}{
+				"name":      name,
+				"valueFrom": map[string]interface{}{"secretKeyRef": map[string]string{"name": secret.Metadata.Name, "key": name}},
+			})
+		}
+	}
+
+	if r.DockerConfigDir != "" {
+		config, err := ioutil.ReadFile(filepath.Join(r.DockerConfigDir, "config.json"))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		var secret object
+		err = r.Client.doJSON(ctx, http.MethodPost, ns+"/secrets", map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"generateName": "kaniko-docker-config-"},
+			"stringData": map[string]string{"config.json": string(config)},
+		}, &secret)
+		if err != nil {
+			return errors.Wrap(err, "failed to create docker config secret")
+		}
+		cleanup = append(cleanup, ns+"/secrets/"+secret.Metadata.Name)
+		volumes = append(volumes, map[string]interface{}{"name": "docker-config", "secret": map[string]string{"secretName": secret.Metadata.Name}})
+		mounts = append(mounts, map[string]interface{}{"name": "docker-config", "mountPath": "/kaniko/.docker"})
+		env = append(env, map[string]interface{}{"name": "DOCKER_CONFIG", "value": "/kaniko/.docker"})
+	}
+
+	if len(files) > 0 {
+		data := map[string]string{}
+		for i, path := range files {
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			key := fmt.Sprintf("file-%d", i)
+			data[key] = string(content)
+			mounts = append(mounts, map[string]interface{}{"name": "files", "mountPath": path, "subPath": key})
+		}
+		var configMap object
+		err = r.Client.doJSON(ctx, http.MethodPost, ns+"/configmaps", map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"generateName": "kaniko-files-"},
+			"data":       data,
+		}, &configMap)
+		if err != nil {
+			return errors.Wrap(err, "failed to create files config map")
+		}
+		cleanup = append(cleanup, ns+"/configmaps/"+configMap.Metadata.Name)
+		volumes = append(volumes, map[string]interface{}{"name": "files", "configMap": map[string]string{"name": configMap.Metadata.Name}})
+	}
+
+	if r.ContextVolume != "" {
+		volumes = append(volumes, map[string]interface{}{"name": "context", "persistentVolumeClaim": map[string]string{"claimName": r.ContextVolume}})
+		mounts = append(mounts, map[string]interface{}{"name": "context", "mountPath": r.ContextMount})
+	}
+
+	// relative paths are resolved in the workspace on the context volume
+	workingDir := cmd.Dir
+	if workingDir == "" && r.ContextVolume != "" {
+		workingDir = r.ContextMount
+	}
+	podSpec := map[string]interface{}{
+		"restartPolicy": "Never",
+		"containers": []map[string]interface{}{{
+			"name":         "kaniko",
+			"image":        r.Image,
+			"args":         args,
+			"env":          env,
+			"volumeMounts": mounts,
+			"workingDir":   workingDir,
+		}},
+		"volumes": volumes,
+	}
+	if r.ServiceAccount != "" {
+		podSpec["serviceAccountName"] = r.ServiceAccount
+	}
+	if len(r.NodeSelector) > 0 {
+		podSpec["nodeSelector"] = r.NodeSelector
+	}
+	var job object
+	err = r.Client.doJSON(ctx, http.MethodPost, "/apis/batch/v1/namespaces/"+r.Client.Namespace+"/jobs", map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata":   map[string]interface{}{"generateName": "kaniko-", "labels": map[string]string{"app.kubernetes.io/name": "drone-kaniko"}},
+		"spec": map[string]interface{}{
+			"backoffLimit": 0,
+			"template":     map[string]interface{}{"spec": podSpec},
+		},
+	}, &job)
+	if err != nil {
+		return errors.Wrap(err, "failed to create executor job")
+	}
+	cleanup = append(cleanup, "/apis/batch/v1/namespaces/"+r.Client.Namespace+"/jobs/"+job.Metadata.Name)
+	fmt.Fprintf(os.Stdout, "Running the executor in job %s/%s\n", r.Client.Namespace, job.Metadata.Name)
+
+	p, err := r.waitPod(ctx, job.Metadata.Name, func(p pod) bool { return p.Status.Phase != "Pending" })
+	if err != nil {
+		return err
+	}
+	if err := r.streamLogs(ctx, p.Metadata.Name, cmd.Stdout); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "failed to stream executor logs: %s\n", err)
+	}
+	p, err = r.waitPod(ctx, job.Metadata.Name, func(p pod) bool { return terminated(p) != nil })
+	if err != nil {
+		return err
+	}
+
+	state := terminated(p)
+	if state.ExitCode != 0 {
+		return &ExitError{Code: state.ExitCode}
+	}
+	if digestFile != "" {
+		if err := ioutil.WriteFile(digestFile, []byte(strings.TrimSpace(state.Message)), 0644); err != nil {
+			return errors.Wrap(err, "failed to write digest file")
+		}
+	}
+	return nil
+}
+
+// jobArgs rewrites the executor arguments for the job: the digest is written
+// to the termination log, and files the job cannot hand back are rejected.
+func (r Runner) jobArgs(args []string) ([]string, string, error) {
+	var rewritten []string
+	var digestFile string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "--digest-file="):
+			digestFile = strings.TrimPrefix(arg, "--digest-file=")
+			arg = "--digest-file=" + terminationLog
+		case strings.HasPrefix(arg, "--image-name-tag-with-digest-file="), strings.HasPrefix(arg, "--image-name-with-digest-file="):
+			// the digests are looked up in the registry instead
+			continue
+		case strings.HasPrefix(arg, "--tar-path="):
+			return nil, "", fmt.Errorf("saving the image to a tarball is not supported by the kubernetes backend")
+		case strings.HasPrefix(arg, "--context=dir://"):
+			path := strings.TrimPrefix(arg, "--context=dir://")
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(r.ContextMount, path)
+			}
+			if r.ContextVolume == "" || !within(path, r.ContextMount) {
+				return nil, "", fmt.Errorf("the kubernetes backend requires a remote context or a context on the context volume, got %s", path)
+			}
+		}
+		rewritten = append(rewritten, arg)
+	}
+	return rewritten, digestFile, nil
+}
+
+// files returns the files in the arguments below the file prefixes, which
+// are passed to the job in a ConfigMap.
+func (r Runner) files(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, prefix := range r.FilePrefixes {
+			if !within(parts[1], prefix) {
+				continue
+			}
+			info, err := os.Stat(parts[1])
+			if err != nil {
+				break
+			}
+			if !info.Mode().IsRegular() {
+				return nil, fmt.Errorf("%s cannot be passed to the kubernetes backend, only files are supported", parts[1])
+			}
+			files = append(files, parts[1])
+			break
+		}
+	}
+	return files, nil
+}
+
+// waitPod polls the pod of the job until done returns true for it.
+func (r Runner) waitPod(ctx context.Context, job string, done func(pod) bool) (pod, error) {
+	path := "/api/v1/namespaces/" + r.Client.Namespace + "/pods?labelSelector=" + url.QueryEscape("job-name="+job)
+	for {
+		var pods podList
+		if err := r.Client.doJSON(ctx, http.MethodGet, path, nil, &pods); err != nil {
+			return pod{}, err
+		}
+		if len(pods.Items) > 0 && done(pods.Items[0]) {
+			return pods.Items[0], nil
+		}
+		select {
+		case <-ctx.Done():
+			return pod{}, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// streamLogs follows the executor log until the container exits.
+func (r Runner) streamLogs(ctx context.Context, name string, w io.Writer) error {
+	res, err := r.Client.do(ctx, http.MethodGet, "/api/v1/namespaces/"+r.Client.Namespace+"/pods/"+name+"/log?container=kaniko&follow=true", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if w == nil {
+		w = ioutil.Discard
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// terminated returns the terminated state of the executor container, or nil
+// while it runs.
+func terminated(p pod) *terminatedState {
+	for _, status := range p.Status.ContainerStatuses {
+		if status.State.Terminated != nil {
+			return status.State.Terminated
+		}
+	}
+	return nil
+}
+
+// within returns true when path is dir or below it.
+func within(path, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// addedEnv returns the entries of env that are not in base.
+func addedEnv(env, base []string) []string {
+	inherited := map[string]bool{}
+	for _, v := range base {
+		inherited[v] = true
+	}
+	var added []string
+	for _, v := range env {
+		if !inherited[v] {
+			added = append(added, v)
+		}
+	}
+	return added
+}
@@ -0,0 +1,221 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAPI serves the Kubernetes API calls made by the runner.
+type fakeAPI struct {
+	mu       sync.Mutex
+	exitCode int
+	calls    []string
+	job      map[string]interface{}
+	secret   map[string]interface{}
+	secrets  []map[string]interface{}
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/ci/secrets":
+		f.secret = nil
+		json.NewDecoder(r.Body).Decode(&f.secret)
+		f.secrets = append(f.secrets, f.secret)
+		w.Write([]byte(`{"metadata": {"name": "kaniko-docker-config-x"}}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/ci/configmaps":
+		w.Write([]byte(`{"metadata": {"name": "kaniko-files-x"}}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/apis/batch/v1/namespaces/ci/jobs":
+		json.NewDecoder(r.Body).Decode(&f.job)
+		w.Write([]byte(`{"metadata": {"name": "kaniko-x"}}`))
+	case r.URL.Path == "/api/v1/namespaces/ci/pods":
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": []interface{}{map[string]interface{}{
+			"metadata": map[string]string{"name": "kaniko-x-pod"},
+			"status": map[string]interface{}{
+				"phase": "Succeeded",
+				"containerStatuses": []interface{}{map[string]interface{}{
+					"state": map[string]interface{}{"terminated": map[string]interface{}{
+						"exitCode": f.exitCode,
+						"message":  "sha256:abc\n",
+					}},
+				}},
+			},
+		}}})
+	case r.URL.Path == "/api/v1/namespaces/ci/pods/kaniko-x-pod/log":
+		w.Write([]byte("INFO[0001] Pushed image\n"))
+	case r.Method == http.MethodDelete:
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestRunner_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kube")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configDir := filepath.Join(dir, "docker")
+	os.MkdirAll(configDir, 0700)
+	ioutil.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{"auths": {}}`), 0600)
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	ioutil.WriteFile(dockerfile, []byte("FROM scratch\n"), 0644)
+	digestFile := filepath.Join(dir, "digest")
+
+	api := &fakeAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	runner := Runner{
+		Client:          &Client{Host: server.URL, Token: "token", Namespace: "ci", HTTP: server.Client()},
+		Image:           "executor",
+		ServiceAccount:  "builder",
+		NodeSelector:    map[string]string{"pool": "builds"},
+		DockerConfigDir: configDir,
+		FilePrefixes:    []string{dir},
+	}
+	var out bytes.Buffer
+	cmd := exec.Command("/kaniko/executor",
+		"--dockerfile="+dockerfile,
+		"--context=git://github.com/drone/drone-kaniko.git",
+		"--digest-file="+digestFile,
+		"--image-name-tag-with-digest-file="+filepath.Join(dir, "tags"),
+	)
+	cmd.Stdout = &out
+	if err := runner.Run(context.Background(), cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := out.String(); !strings.Contains(got, "Pushed image") {
+		t.Errorf("expected the executor log to be streamed, got %q", got)
+	}
+	if digest, _ := ioutil.ReadFile(digestFile); string(digest) != "sha256:abc" {
+		t.Errorf("expected the digest from the termination message, got %q", digest)
+	}
+	if data := api.secret["stringData"].(map[string]interface{}); data["config.json"] != `{"auths": {}}` {
+		t.Errorf("expected the docker config in the secret, got %v", data)
+	}
+
+	spec := api.job["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	if spec["serviceAccountName"] != "builder" || spec["nodeSelector"].(map[string]interface{})["pool"] != "builds" {
+		t.Errorf("expected the pod placement to be set, got %v", spec)
+	}
+	container := spec["containers"].([]interface{})[0].(map[string]interface{})
+	var args []string
+	for _, arg := range container["args"].([]interface{}) {
+		args = append(args, arg.(string))
+	}
+	want := []string{
+		"--dockerfile=" + dockerfile,
+		"--context=git://github.com/drone/drone-kaniko.git",
+		"--digest-file=" + terminationLog,
+	}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Errorf("expected job args %v, got %v", want, args)
+	}
+
+	var deleted int
+	for _, call := range api.calls {
+		if strings.HasPrefix(call, http.MethodDelete) {
+			deleted++
+		}
+	}
+	if deleted != 3 {
+		t.Errorf("expected the job, secret and config map to be deleted, got %v", api.calls)
+	}
+}
+
+func TestRunner_Run_SecretEnv(t *testing.T) {
+	api := &fakeAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	// a secret read from a variable of the same name is not added to the
+	// environment of the command, it must still reach the executor
+	t.Setenv("NPM_TOKEN", "s3cret")
+	runner := Runner{
+		Client:    &Client{Host: server.URL, Token: "token", Namespace: "ci", HTTP: server.Client()},
+		Image:     "executor",
+		SecretEnv: []string{"NPM_TOKEN=s3cret"},
+	}
+	cmd := exec.Command("/kaniko/executor", "--context=s3://bucket/context.tar.gz", "--build-arg=NPM_TOKEN")
+	cmd.Env = append(os.Environ(), "NPM_TOKEN=s3cret", "CONTEXT_ENV=1")
+	if err := runner.Run(context.Background(), cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(api.secrets) != 1 {
+		t.Fatalf("expected the secret env in a secret, got %v", api.secrets)
+	}
+	if data := api.secrets[0]["stringData"].(map[string]interface{}); data["NPM_TOKEN"] != "s3cret" {
+		t.Errorf("expected the secret value in the secret, got %v", data)
+	}
+	spec := api.job["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	container := spec["containers"].([]interface{})[0].(map[string]interface{})
+	env, _ := json.Marshal(container["env"])
+	want := `[{"name":"CONTEXT_ENV","value":"1"},{"name":"NPM_TOKEN","valueFrom":{"secretKeyRef":{"key":"NPM_TOKEN","name":"kaniko-docker-config-x"}}}]`
+	if string(env) != want {
+		t.Errorf("expected env %s, got %s", want, env)
+	}
+	if strings.Contains(fmt.Sprint(api.job), "s3cret") {
+		t.Error("expected the secret value kept out of the job")
+	}
+}
+
+func TestRunner_Run_Failure(t *testing.T) {
+	api := &fakeAPI{exitCode: 1}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	runner := Runner{
+		Client: &Client{Host: server.URL, Token: "token", Namespace: "ci", HTTP: server.Client()},
+		Image:  "executor",
+	}
+	err := runner.Run(context.Background(), exec.Command("/kaniko/executor", "--context=s3://bucket/context.tar.gz"))
+	if exit, ok := err.(*ExitError); !ok || exit.ExitCode() != 1 {
+		t.Errorf("expected exit code 1, got %v", err)
+	}
+}
+
+func TestRunner_jobArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		runner  Runner
+		arg     string
+		wantErr bool
+	}{
+		{name: "remote context", arg: "--context=git://github.com/drone/drone-kaniko.git"},
+		{name: "local context without volume", arg: "--context=dir:///drone/src", wantErr: true},
+		{name: "context on volume", runner: Runner{ContextVolume: "src", ContextMount: "/drone/src"}, arg: "--context=dir:///drone/src"},
+		{name: "relative context on volume", runner: Runner{ContextVolume: "src", ContextMount: "/drone/src"}, arg: "--context=dir://."},
+		{name: "context outside volume", runner: Runner{ContextVolume: "src", ContextMount: "/drone/src"}, arg: "--context=dir:///kaniko/context", wantErr: true},
+		{name: "tarball", arg: "--tar-path=/drone/src/image.tar", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := tc.runner.jobArgs([]string{tc.arg})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("jobArgs(%s) error = %v, wantErr %v", tc.arg, err, tc.wantErr)
+			}
+		})
+	}
+}
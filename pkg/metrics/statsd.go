@@ -0,0 +1,74 @@
+// Package metrics sends build metrics to a StatsD agent, with tags in the
+// DogStatsD format.
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metric is a StatsD metric.
+type Metric struct {
+	Name  string
+	Value float64
+	Type  string // StatsD type, e.g. ms for timings or g for gauges
+	Tags  map[string]string
+}
+
+// Timing returns a timing metric of the duration in milliseconds.
+func Timing(name string, d time.Duration, tags map[string]string) Metric {
+	return Metric{Name: name, Value: float64(d.Milliseconds()), Type: "ms", Tags: tags}
+}
+
+// Format returns the metric in the StatsD line format with the prefix, e.g.
+// kaniko.stage.duration:1200|ms|#repo:app,stage:0.
+func (m Metric) Format(prefix string) string {
+	var b strings.Builder
+	if prefix != "" {
+		b.WriteString(prefix + ".")
+	}
+	b.WriteString(m.Name + ":" + strconv.FormatFloat(m.Value, 'f', -1, 64) + "|" + m.Type)
+	if len(m.Tags) > 0 {
+		keys := make([]string, 0, len(m.Tags))
+		for k := range m.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var tags []string
+		for _, k := range keys {
+			tags = append(tags, k+":"+sanitizeTag(m.Tags[k]))
+		}
+		b.WriteString("|#" + strings.Join(tags, ","))
+	}
+	return b.String()
+}
+
+// sanitizeTag replaces the characters separating StatsD fields and tags.
+func sanitizeTag(value string) string {
+	return strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", " ").Replace(value)
+}
+
+// StatsD sends metrics to a StatsD agent over UDP.
+type StatsD struct {
+	Addr   string // Address of the agent, e.g. localhost:8125
+	Prefix string // Prefix of the metric names
+}
+
+// Send sends the metrics, one per packet.
+func (s StatsD) Send(metrics []Metric) error {
+	conn, err := net.DialTimeout("udp", s.Addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to statsd at %s: %s", s.Addr, err)
+	}
+	defer conn.Close()
+	for _, m := range metrics {
+		if _, err := conn.Write([]byte(m.Format(s.Prefix))); err != nil {
+			return fmt.Errorf("failed to send metrics to statsd at %s: %s", s.Addr, err)
+		}
+	}
+	return nil
+}
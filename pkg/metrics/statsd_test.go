@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMetric_Format(t *testing.T) {
+	m := Timing("stage.duration", 1500*time.Millisecond, map[string]string{"stage": "0", "base": "golang:1.22|x"})
+	if got, want := m.Format("kaniko"), "kaniko.stage.duration:1500|ms|#base:golang:1.22_x,stage:0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	m = Metric{Name: "build.cache_ratio", Value: 0.5, Type: "g"}
+	if got, want := m.Format(""), "build.cache_ratio:0.5|g"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestStatsD_Send(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	s := StatsD{Addr: conn.LocalAddr().String(), Prefix: "kaniko"}
+	if err := s.Send([]Metric{Timing("build.duration", time.Second, nil)}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 512)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf[:n]), "kaniko.build.duration:1000|ms"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -1,12 +1,29 @@
 package output
 
 import (
+	"os"
+
 	"github.com/joho/godotenv"
 )
 
 func WritePluginOutputFile(outputFilePath, digest string) error {
-	output := map[string]string{
+	return WritePluginOutputValues(outputFilePath, map[string]string{
 		"digest": digest,
+	})
+}
+
+// WritePluginOutputValues adds the values to the output file, keeping the
+// values written earlier in the step.
+func WritePluginOutputValues(outputFilePath string, values map[string]string) error {
+	output, err := godotenv.Read(outputFilePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		output = map[string]string{}
+	}
+	for k, v := range values {
+		output[k] = v
 	}
 	return godotenv.Write(output, outputFilePath)
 }
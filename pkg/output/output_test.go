@@ -0,0 +1,28 @@
+package output
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joho/godotenv"
+)
+
+func TestWritePluginOutputValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "output.env")
+	if err := WritePluginOutputValues(path, map[string]string{"structure_test_passed": "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WritePluginOutputFile(path, "sha256:abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := godotenv.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"structure_test_passed": "3", "digest": "sha256:abc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected output %v, want %v", got, want)
+	}
+}
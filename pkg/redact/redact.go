@@ -0,0 +1,105 @@
+// Package redact masks secrets in streamed build output.
+package redact
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxLine is the length a line is buffered up to before it is masked and
+// written without its end.
+const maxLine = 64 << 10
+
+// Compile compiles the redaction patterns.
+func Compile(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid redact pattern")
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Writer masks secret values and the matches of patterns in the output
+// written to it. Output is masked a line at a time, so that a secret split
+// across writes is still masked; Flush writes the final partial line.
+type Writer struct {
+	w        io.Writer
+	mask     []byte
+	values   [][]byte
+	patterns []*regexp.Regexp
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+// NewWriter returns a writer masking the values and patterns with mask in
+// the output written to w. Empty values are ignored.
+func NewWriter(w io.Writer, mask string, values []string, patterns []*regexp.Regexp) *Writer {
+	rw := &Writer{w: w, mask: []byte(mask), patterns: patterns}
+	for _, value := range values {
+		if value != "" {
+			rw.values = append(rw.values, []byte(value))
+		}
+	}
+	// longer values first, so that a value containing another is masked whole
+	sort.Slice(rw.values, func(i, j int) bool { return len(rw.values[i]) > len(rw.values[j]) })
+	return rw
+}
+
+// Empty returns true if the writer has nothing to mask.
+func (w *Writer) Empty() bool {
+	return len(w.values) == 0 && len(w.patterns) == 0
+}
+
+// Write masks and writes the complete lines of p, buffering the rest.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	end := bytes.LastIndexByte(w.partial, '\n') + 1
+	if end == 0 && len(w.partial) < maxLine {
+		return len(p), nil
+	}
+	if end == 0 {
+		end = len(w.partial)
+	}
+	out := w.redact(w.partial[:end])
+	w.partial = append([]byte(nil), w.partial[end:]...)
+	if _, err := w.w.Write(out); err != nil {
+		return len(p), err
+	}
+	return len(p), nil
+}
+
+// Flush masks and writes the buffered partial line.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) == 0 {
+		return nil
+	}
+	out := w.redact(w.partial)
+	w.partial = nil
+	_, err := w.w.Write(out)
+	return err
+}
+
+func (w *Writer) redact(b []byte) []byte {
+	out := append([]byte(nil), b...)
+	for _, value := range w.values {
+		out = bytes.ReplaceAll(out, value, w.mask)
+	}
+	for _, re := range w.patterns {
+		out = re.ReplaceAllLiteral(out, w.mask)
+	}
+	return out
+}
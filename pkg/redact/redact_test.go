@@ -0,0 +1,35 @@
+package redact
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	patterns, err := Compile([]string{`acme_[A-Za-z0-9]+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	w := NewWriter(&out, "[redacted]", []string{"hunter2hunter2", "", "hunter2"}, patterns)
+	for _, chunk := range []string{"login with hunter2hun", "ter2\nfetch token acme_", "Xy12 ok\n", "INFO[0001] done hunter2"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "login with [redacted]\nfetch token [redacted] ok\n"; out.String() != want {
+		t.Errorf("want %q before the flush, got %q", want, out.String())
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "login with [redacted]\nfetch token [redacted] ok\nINFO[0001] done [redacted]"; out.String() != want {
+		t.Errorf("want %q, got %q", want, out.String())
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if _, err := Compile([]string{"("}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Media types of artifacts and files pushed without an explicit type, as
+// with oras push.
+const (
+	MediaTypeUnknownArtifact string = "application/vnd.unknown.artifact.v1"
+	MediaTypeOCILayer        string = "application/vnd.oci.image.layer.v1.tar"
+)
+
+// AnnotationTitle is the annotation naming the file of a blob, which oras
+// pull restores it as.
+const AnnotationTitle = "org.opencontainers.image.title"
+
+// Blob is content of an artifact, read from Open when uploaded.
+type Blob struct {
+	Descriptor
+	Open func() (io.ReadCloser, error)
+}
+
+// BytesBlob returns the blob of content.
+func BytesBlob(mediaType string, content []byte) Blob {
+	return Blob{
+		Descriptor: describeBytes(mediaType, content),
+		Open:       func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(content)), nil },
+	}
+}
+
+// FileBlob returns the blob of the file, annotated with its name as with
+// oras push. The file is read again when uploaded.
+func FileBlob(mediaType, file string) (Blob, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Blob{}, err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil {
+		return Blob{}, err
+	} else if !info.Mode().IsRegular() {
+		return Blob{}, fmt.Errorf("%s is not a regular file", file)
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return Blob{}, err
+	}
+	desc := Descriptor{
+		MediaType:   mediaType,
+		Digest:      "sha256:" + hex.EncodeToString(h.Sum(nil)),
+		Size:        size,
+		Annotations: map[string]string{AnnotationTitle: filepath.Base(file)},
+	}
+	return Blob{Descriptor: desc, Open: func() (io.ReadCloser, error) { return os.Open(file) }}, nil
+}
+
+// Artifact is an OCI artifact, pushed as an image manifest whose layers are
+// its blobs. The config is empty unless set, and the empty blob stands in
+// for the layers of an artifact without blobs, as the image specification
+// recommends.
+type Artifact struct {
+	ArtifactType string
+	Config       *Blob
+	Blobs        []Blob
+	Annotations  map[string]string
+}
+
+// PushArtifact pushes the blobs and the manifest of the artifact to the tag
+// of ref, or by digest when ref has no tag. It returns the descriptor of
+// the manifest.
+func (c *Client) PushArtifact(ctx context.Context, ref Reference, a Artifact) (Descriptor, error) {
+	body, err := c.uploadArtifact(ctx, ref, a, nil)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	desc := describeBytes(MediaTypeOCIManifest, body)
+	target := Reference{Registry: ref.Registry, Repository: ref.Repository, Tag: ref.Tag}
+	if target.Tag == "" {
+		target.Digest = desc.Digest
+	}
+	if err := c.putManifest(ctx, target, MediaTypeOCIManifest, body); err != nil {
+		return Descriptor{}, errors.Wrap(err, fmt.Sprintf("failed to push artifact manifest to %s", target))
+	}
+	return desc, nil
+}
+
+// Attach pushes the artifact with the manifest ref points to as subject, so
+// registries supporting the referrers API list it with the image. It
+// returns the digest of the artifact manifest.
+func (c *Client) Attach(ctx context.Context, ref Reference, a Artifact) (string, error) {
+	subject, err := c.Head(ctx, ref)
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("failed to resolve %s", ref))
+	}
+	body, err := c.uploadArtifact(ctx, ref, a, &subject)
+	if err != nil {
+		return "", err
+	}
+	desc := describeBytes(MediaTypeOCIManifest, body)
+	target := Reference{Registry: ref.Registry, Repository: ref.Repository, Digest: desc.Digest}
+	if err := c.putManifest(ctx, target, MediaTypeOCIManifest, body); err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("failed to push artifact manifest to %s", target))
+	}
+
+	if c.tagReferrers(ctx, ref, subject.Digest) {
+		// registries without the referrers API cannot list the artifact,
+		// tools find it in the index tagged after the subject digest
+		// instead, and cosign by the tag of its convention
+		desc.ArtifactType = a.ArtifactType
+		desc.Annotations = a.Annotations
+		if err := c.addReferrer(ctx, ref, subject.Digest, desc); err != nil {
+			return "", err
+		}
+		if tag := CosignTag(subject.Digest, a.ArtifactType); tag != "" {
+			target := Reference{Registry: ref.Registry, Repository: ref.Repository, Tag: tag}
+			if err := c.putManifest(ctx, target, MediaTypeOCIManifest, body); err != nil {
+				return "", errors.Wrap(err, fmt.Sprintf("failed to tag artifact manifest as %s", target))
+			}
+		}
+	}
+	return desc.Digest, nil
+}
+
+// uploadArtifact uploads the config and the blobs of the artifact to the
+// repository of ref and returns its manifest.
+func (c *Client) uploadArtifact(ctx context.Context, ref Reference, a Artifact, subject *Descriptor) ([]byte, error) {
+	empty := BytesBlob(MediaTypeOCIEmpty, emptyConfig)
+	config := empty
+	if a.Config != nil {
+		config = *a.Config
+	}
+	blobs := a.Blobs
+	if len(blobs) == 0 {
+		blobs = []Blob{empty}
+	}
+
+	manifest := artifactManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		ArtifactType:  a.ArtifactType,
+		Config:        config.Descriptor,
+		Subject:       subject,
+		Annotations:   a.Annotations,
+	}
+	uploaded := map[string]bool{}
+	for i, blob := range append([]Blob{config}, blobs...) {
+		if i > 0 {
+			manifest.Layers = append(manifest.Layers, blob.Descriptor)
+		}
+		if uploaded[blob.Digest] {
+			continue
+		}
+		if err := c.uploadBlob(ctx, ref, blob.Open, blob.Descriptor); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to push blob %s to %s", blob.Digest, ref))
+		}
+		uploaded[blob.Digest] = true
+	}
+	return json.Marshal(manifest)
+}
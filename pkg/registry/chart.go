@@ -0,0 +1,22 @@
+package registry
+
+import "context"
+
+// Media types of Helm charts stored in registries, as pushed by helm push.
+const (
+	MediaTypeHelmConfig string = "application/vnd.cncf.helm.config.v1+json"
+	MediaTypeHelmChart  string = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// PushChart pushes a packaged Helm chart to the tag of ref as helm push
+// does, with the chart metadata as JSON config, so helm pull and helm
+// install read it from the registry. It returns the manifest digest.
+func (c *Client) PushChart(ctx context.Context, ref Reference, config, chart []byte, annotations map[string]string) (string, error) {
+	configBlob := BytesBlob(MediaTypeHelmConfig, config)
+	desc, err := c.PushArtifact(ctx, ref, Artifact{
+		Config:      &configBlob,
+		Blobs:       []Blob{BytesBlob(MediaTypeHelmChart, chart)},
+		Annotations: annotations,
+	})
+	return desc.Digest, err
+}
@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ScopePull is the token scope needed to read from a repository.
+	ScopePull string = "pull"
+	// ScopePush is the token scope needed to read from and write to a repository.
+	ScopePush string = "pull,push"
+
+	clientID string = "drone-kaniko"
+)
+
+// ErrNotFound is returned when a manifest or blob does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Client is a minimal OCI distribution API client.
+type Client struct {
+	Keychain  Keychain
+	HTTP      *http.Client
+	Referrers string          // how artifacts are attached to images, auto by default
+	PlainHTTP map[string]bool // registries accessed over http instead of https
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns a client authenticating with the docker config file at
+// configPath. TLS verification is skipped when insecure is set.
+func NewClient(configPath string, insecure bool) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &Client{
+		Keychain: ConfigKeychain{Path: configPath},
+		HTTP:     &http.Client{Transport: transport, Timeout: 5 * time.Minute},
+	}
+}
+
+// Do sends the request to the registry, authenticating with the token scope
+// for the repository when challenged. Request bodies must be replayable.
+func (c *Client) Do(req *http.Request, repository, scope string) (*http.Response, error) {
+	key := req.URL.Host + "/" + repository + ":" + scope
+	c.mu.Lock()
+	authorization := c.tokens[key]
+	c.mu.Unlock()
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+	challenge := res.Header.Get("WWW-Authenticate")
+	drain(res)
+
+	authorization, err = c.authorize(req.Context(), req.URL.Host, repository, scope, challenge)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.tokens == nil {
+		c.tokens = map[string]string{}
+	}
+	c.tokens[key] = authorization
+	c.mu.Unlock()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", authorization)
+	return c.HTTP.Do(retry)
+}
+
+// authorize answers the authentication challenge and returns the value of
+// the Authorization header.
+func (c *Client) authorize(ctx context.Context, host, repository, scope, challenge string) (string, error) {
+	cred, err := c.Keychain.Resolve(host)
+	if err != nil {
+		return "", err
+	}
+	if cred.RegistryToken != "" {
+		return "Bearer " + cred.RegistryToken, nil
+	}
+
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if cred.Username == "" {
+			return "", fmt.Errorf("registry %s requires credentials", host)
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(cred.Username, cred.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, params, cred, fmt.Sprintf("repository:%s:%s", repository, scope))
+		if err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("failed to authenticate with %s", host))
+		}
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge from %s: %q", host, challenge)
+	}
+}
+
+func (c *Client) fetchToken(ctx context.Context, params map[string]string, cred Credential, scope string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("bearer challenge without realm")
+	}
+
+	var req *http.Request
+	var err error
+	if cred.IdentityToken != "" {
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {cred.IdentityToken},
+			"service":       {params["service"]},
+			"scope":         {scope},
+			"client_id":     {clientID},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, realm, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{"scope": {scope}}
+		if service := params["service"]; service != "" {
+			query.Set("service", service)
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		if cred.Username != "" {
+			req.SetBasicAuth(cred.Username, cred.Password)
+		}
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", responseError(res)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", errors.Wrap(err, "failed to decode token response")
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("token response did not contain a token")
+}
+
+// parseChallenge parses a WWW-Authenticate header value.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+	for _, param := range splitParams(parts[1]) {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+	}
+	return parts[0], params
+}
+
+// splitParams splits comma separated challenge parameters, respecting quotes.
+func splitParams(s string) []string {
+	var params []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			params = append(params, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(params, s[start:])
+}
+
+func (c *Client) url(ref Reference, path string) string {
+	scheme := "https"
+	if c.PlainHTTP[ref.Registry] {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.Registry, ref.Repository, path)
+}
+
+func responseError(res *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return fmt.Errorf("unexpected status %s from %s %s: %s", res.Status, res.Request.Method, res.Request.URL.Redacted(), strings.TrimSpace(string(body)))
+}
+
+func drain(res *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+	res.Body.Close()
+}
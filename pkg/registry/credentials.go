@@ -0,0 +1,159 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+// DefaultConfigPath is the docker config file written by the plugin binaries.
+var DefaultConfigPath = filepath.Join(sysinfo.KanikoDir, ".docker", "config.json")
+
+const helperTokenUsername string = "<token>"
+
+type (
+	// Credential holds the secrets used to authenticate against a registry.
+	Credential struct {
+		Username      string
+		Password      string
+		IdentityToken string // OAuth2 refresh token exchanged for an access token
+		RegistryToken string // Bearer token sent to the registry as is
+	}
+
+	// Keychain resolves credentials for a registry host.
+	Keychain interface {
+		Resolve(host string) (Credential, error)
+	}
+
+	// ConfigKeychain resolves credentials from a docker config file, falling
+	// back to the credential helpers shipped with kaniko.
+	ConfigKeychain struct {
+		Path string
+	}
+
+	configFile struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			IdentityToken string `json:"identitytoken"`
+			RegistryToken string `json:"registrytoken"`
+		} `json:"auths"`
+		CredHelpers map[string]string `json:"credHelpers"`
+		CredsStore  string            `json:"credsStore"`
+	}
+)
+
+// ConfigPath returns the docker config file honoured by kaniko, taking the
+// DOCKER_CONFIG environment variable into account.
+func ConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	return DefaultConfigPath
+}
+
+// Resolve returns the credential for the registry host. An empty credential
+// is returned for anonymous access.
+func (k ConfigKeychain) Resolve(host string) (Credential, error) {
+	var cfg configFile
+	content, err := ioutil.ReadFile(k.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return Credential{}, errors.Wrap(err, "failed to read docker config file")
+	}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &cfg); err != nil {
+			return Credential{}, errors.Wrap(err, "failed to parse docker config file")
+		}
+	}
+
+	for _, key := range configKeys(host) {
+		auth, ok := cfg.Auths[key]
+		if !ok {
+			continue
+		}
+		cred := Credential{IdentityToken: auth.IdentityToken, RegistryToken: auth.RegistryToken}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return Credential{}, errors.Wrap(err, fmt.Sprintf("failed to decode auth for %s", key))
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) == 2 {
+				cred.Username, cred.Password = parts[0], parts[1]
+			}
+		}
+		return cred, nil
+	}
+
+	helper := cfg.CredHelpers[host]
+	if helper == "" {
+		helper = cfg.CredsStore
+	}
+	if helper == "" {
+		helper = wellKnownHelper(host)
+	}
+	if helper == "" {
+		return Credential{}, nil
+	}
+	return helperCredential(helper, host)
+}
+
+// configKeys returns the keys the registry may be stored under in the auths section.
+func configKeys(host string) []string {
+	if host == DockerHub {
+		return []string{"https://index.docker.io/v1/", "index.docker.io", "docker.io", "https://index.docker.io/v2/"}
+	}
+	return []string{host, "https://" + host, "http://" + host, "https://" + host + "/v1/", "https://" + host + "/v2/"}
+}
+
+// wellKnownHelper returns the credential helper kaniko uses for cloud
+// registries, if it is installed.
+func wellKnownHelper(host string) string {
+	var helper string
+	switch {
+	case strings.Contains(host, ".dkr.ecr.") || host == "public.ecr.aws":
+		helper = "ecr-login"
+	case host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev"):
+		helper = "gcr"
+	case strings.HasSuffix(host, ".azurecr.io"):
+		helper = "acr-env"
+	default:
+		return ""
+	}
+	if _, err := exec.LookPath("docker-credential-" + helper); err != nil {
+		return ""
+	}
+	return helper
+}
+
+func helperCredential(helper, host string) (Credential, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(host)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Credential{}, fmt.Errorf("credential helper %s failed for %s: %s", helper, host, strings.TrimSpace(stderr.String()+stdout.String()))
+	}
+
+	var out struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return Credential{}, errors.Wrap(err, fmt.Sprintf("failed to parse credential helper %s output", helper))
+	}
+	if out.Username == helperTokenUsername {
+		return Credential{IdentityToken: out.Secret}, nil
+	}
+	return Credential{Username: out.Username, Password: out.Secret}, nil
+}
@@ -0,0 +1,91 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// imageIndex is an OCI image index listing the images of a multi-platform
+// image.
+type imageIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// PushIndex pushes an image index listing the images, each with the
+// platform of its config including the variant, to each of refs. The
+// images must be in the repository of refs. It returns the digest of the
+// index.
+func (c *Client) PushIndex(ctx context.Context, images []Reference, refs []Reference) (string, error) {
+	if len(refs) == 0 {
+		return "", fmt.Errorf("no reference to push the image index to")
+	}
+	index := imageIndex{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}
+	platforms := map[string]Reference{}
+	for _, image := range images {
+		if image.Registry != refs[0].Registry || image.Repository != refs[0].Repository {
+			return "", fmt.Errorf("image %s is not in the repository of the index %s", image, refs[0])
+		}
+		desc, err := c.describeImage(ctx, image)
+		if err != nil {
+			return "", err
+		}
+		platform := desc.Platform.String()
+		if other, ok := platforms[platform]; ok {
+			return "", fmt.Errorf("images %s and %s have the same platform %s", other, image, platform)
+		}
+		platforms[platform] = image
+		index.Manifests = append(index.Manifests, desc)
+	}
+
+	body, err := json.Marshal(index)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range refs {
+		if ref.Registry != refs[0].Registry || ref.Repository != refs[0].Repository {
+			return "", fmt.Errorf("image index %s is not in the repository of %s", ref, refs[0])
+		}
+		if err := c.putManifest(ctx, ref, MediaTypeOCIIndex, body); err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("failed to push image index to %s", ref))
+		}
+	}
+	return describeBytes(MediaTypeOCIIndex, body).Digest, nil
+}
+
+// describeImage returns the descriptor of the image manifest ref points
+// to, with the platform read from its config.
+func (c *Client) describeImage(ctx context.Context, ref Reference) (Descriptor, error) {
+	manifest, desc, err := c.Manifest(ctx, ref)
+	if err != nil {
+		return Descriptor{}, errors.Wrap(err, fmt.Sprintf("failed to fetch manifest of %s", ref))
+	}
+	if manifest.IsIndex() {
+		return Descriptor{}, fmt.Errorf("%s is an image index, expected an image of a single platform", ref)
+	}
+	blob, err := c.Blob(ctx, ref, manifest.Config.Digest)
+	if err != nil {
+		return Descriptor{}, errors.Wrap(err, fmt.Sprintf("failed to fetch config of %s", ref))
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(blob, 16<<20))
+	blob.Close()
+	if err != nil {
+		return Descriptor{}, err
+	}
+	// the platform fields of the config are named as in descriptors
+	var platform Platform
+	if err := json.Unmarshal(content, &platform); err != nil {
+		return Descriptor{}, errors.Wrap(err, fmt.Sprintf("failed to decode config of %s", ref))
+	}
+	if platform.OS == "" || platform.Architecture == "" {
+		return Descriptor{}, fmt.Errorf("config of %s does not name its platform", ref)
+	}
+	desc.Platform = &platform
+	return desc, nil
+}
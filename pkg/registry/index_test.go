@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClientPushIndex(t *testing.T) {
+	var mu sync.Mutex
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+	for tag, config := range map[string]string{
+		"amd64":          `{"os": "linux", "architecture": "amd64"}`,
+		"arm-v6":         `{"os": "linux", "architecture": "arm", "variant": "v6"}`,
+		"arm-v7":         `{"os": "linux", "architecture": "arm", "variant": "v7"}`,
+		"arm-v7-rebuilt": `{"os": "linux", "architecture": "arm", "variant": "v7"}`,
+	} {
+		configDesc := describeBytes("application/vnd.oci.image.config.v1+json", []byte(config))
+		blobs[configDesc.Digest] = []byte(config)
+		manifests[tag] = []byte(`{"schemaVersion": 2, "mediaType": "` + MediaTypeOCIManifest + `", "config": {"mediaType": "application/vnd.oci.image.config.v1+json", "digest": "` + configDesc.Digest + `", "size": 1}, "layers": [], "annotations": {"tag": "` + tag + `"}}`)
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			w.Header().Set("Content-Type", MediaTypeOCIManifest)
+			w.Write(manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")])
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/blobs/"):
+			w.Write(blobs[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/blobs/")])
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			if r.Header.Get("Content-Type") != MediaTypeOCIIndex {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")] = body
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+	ref := func(tag string) Reference {
+		return Reference{Registry: host.Host, Repository: "foo/bar", Tag: tag}
+	}
+
+	digest, err := client.PushIndex(context.Background(), []Reference{ref("amd64"), ref("arm-v6"), ref("arm-v7")}, []Reference{ref("1.0"), ref("latest")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if describeBytes(MediaTypeOCIIndex, manifests["1.0"]).Digest != digest || string(manifests["latest"]) != string(manifests["1.0"]) {
+		t.Fatalf("expected the index pushed to both tags, got %v", manifests)
+	}
+	var index Manifest
+	if err := json.Unmarshal(manifests["1.0"], &index); err != nil {
+		t.Fatal(err)
+	}
+	var platforms []string
+	for i, desc := range index.Manifests {
+		platforms = append(platforms, desc.Platform.String())
+		if want := describeBytes(MediaTypeOCIManifest, manifests[[]string{"amd64", "arm-v6", "arm-v7"}[i]]); desc.Digest != want.Digest || desc.Size != want.Size || desc.MediaType != MediaTypeOCIManifest {
+			t.Errorf("unexpected descriptor %+v, want %+v", desc, want)
+		}
+	}
+	if diff := cmp.Diff([]string{"linux/amd64", "linux/arm/v6", "linux/arm/v7"}, platforms); diff != "" {
+		t.Errorf("platforms mismatch (-want +got):\n%s", diff)
+	}
+
+	// arm/v7 twice
+	if _, err := client.PushIndex(context.Background(), []Reference{ref("arm-v7"), ref("arm-v7-rebuilt")}, []Reference{ref("1.0")}); err == nil {
+		t.Error("expected an error for images of the same platform")
+	}
+	other := ref("amd64")
+	other.Repository = "foo/other"
+	if _, err := client.PushIndex(context.Background(), []Reference{other}, []Reference{ref("1.0")}); err == nil {
+		t.Error("expected an error for an image of another repository")
+	}
+}
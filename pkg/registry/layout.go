@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// LayoutIndex is the index.json file of an OCI image layout.
+const LayoutIndex = "index.json"
+
+// ReadLayout returns the descriptor of the image of the OCI image layout in
+// dir, the single manifest or image index listed in its index.json.
+func ReadLayout(dir string) (Descriptor, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, LayoutIndex))
+	if err != nil {
+		return Descriptor{}, errors.Wrap(err, "failed to read oci layout")
+	}
+	var index Manifest
+	if err := json.Unmarshal(content, &index); err != nil {
+		return Descriptor{}, errors.Wrap(err, "invalid oci layout index")
+	}
+	if len(index.Manifests) != 1 {
+		return Descriptor{}, fmt.Errorf("oci layout %s must contain one image, found %d", dir, len(index.Manifests))
+	}
+	return index.Manifests[0], nil
+}
+
+// PushLayout pushes the image of the OCI image layout in dir, as written by
+// kaniko with --oci-layout-path, to each reference and returns the manifest
+// digest. The manifests are pushed as stored, so the digest is preserved.
+func (c *Client) PushLayout(ctx context.Context, dir string, refs []Reference) (string, error) {
+	if len(refs) == 0 {
+		return "", fmt.Errorf("no destination to push %s to", dir)
+	}
+	desc, err := ReadLayout(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range refs {
+		if err := c.pushLayoutManifest(ctx, dir, ref, desc); err != nil {
+			return "", err
+		}
+	}
+	return desc.Digest, nil
+}
+
+// pushLayoutManifest pushes the blobs, or the manifests of an image index,
+// the manifest refers to, and then the manifest itself to ref.
+func (c *Client) pushLayoutManifest(ctx context.Context, dir string, ref Reference, desc Descriptor) error {
+	body, err := ioutil.ReadFile(layoutBlob(dir, desc.Digest))
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("oci layout %s does not contain manifest %s", dir, desc.Digest))
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("invalid manifest %s", desc.Digest))
+	}
+	if manifest.IsIndex() {
+		for _, child := range manifest.Manifests {
+			// the manifests of an index are pushed by digest
+			childRef := ref
+			childRef.Tag, childRef.Digest = "", child.Digest
+			if err := c.pushLayoutManifest(ctx, dir, childRef, child); err != nil {
+				return err
+			}
+		}
+	} else {
+		for _, blob := range append([]Descriptor{manifest.Config}, manifest.Layers...) {
+			path := layoutBlob(dir, blob.Digest)
+			open := func() (io.ReadCloser, error) { return os.Open(path) }
+			if err := c.uploadBlob(ctx, ref, open, blob); err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to push blob %s to %s", blob.Digest, ref))
+			}
+		}
+	}
+
+	mediaType := desc.MediaType
+	if mediaType == "" {
+		mediaType = manifest.MediaType
+	}
+	if err := c.putManifest(ctx, ref, mediaType, body); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to push manifest to %s", ref))
+	}
+	return nil
+}
+
+// layoutBlob returns the path of the blob in the OCI image layout.
+func layoutBlob(dir, digest string) string {
+	return filepath.Join(dir, "blobs", strings.Replace(digest, ":", string(filepath.Separator), 1))
+}
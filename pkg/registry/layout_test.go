@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClientPushLayout(t *testing.T) {
+	var mu sync.Mutex
+	blobs := map[string][]byte{}
+	manifests := map[string]string{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/foo/bar/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/bar/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/foo/bar/blobs/uploads/1":
+			blobs[r.URL.Query().Get("digest")], _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")] = r.Header.Get("Content-Type") + " " + string(body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	config := writeLayoutBlob(t, dir, `{"architecture": "amd64"}`)
+	layer := writeLayoutBlob(t, dir, "layer")
+	manifest := fmt.Sprintf(`{"schemaVersion": 2, "mediaType": "%s", "config": {"mediaType": "application/vnd.oci.image.config.v1+json", "digest": "%s", "size": 25}, "layers": [{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": "%s", "size": 5}]}`, MediaTypeOCIManifest, config, layer)
+	digest := writeLayoutBlob(t, dir, manifest)
+	index := fmt.Sprintf(`{"schemaVersion": 2, "manifests": [{"mediaType": "%s", "digest": "%s", "size": %d}]}`, MediaTypeOCIManifest, digest, len(manifest))
+	if err := ioutil.WriteFile(filepath.Join(dir, LayoutIndex), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+	refs := []Reference{
+		{Registry: host.Host, Repository: "foo/bar", Tag: "1.0"},
+		{Registry: host.Host, Repository: "foo/bar", Tag: "latest"},
+	}
+	got, err := client.PushLayout(context.Background(), dir, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != digest {
+		t.Errorf("digest = %s, want %s", got, digest)
+	}
+	if len(blobs) != 2 || string(blobs[layer]) != "layer" {
+		t.Errorf("expected config and layer blobs, got %v", blobs)
+	}
+	for _, tag := range []string{"1.0", "latest"} {
+		if want := MediaTypeOCIManifest + " " + manifest; manifests[tag] != want {
+			t.Errorf("manifest %s = %s, want %s", tag, manifests[tag], want)
+		}
+	}
+
+	os.Remove(filepath.Join(dir, LayoutIndex))
+	if _, err := client.PushLayout(context.Background(), dir, refs); err == nil {
+		t.Error("expected error for a directory without an oci layout")
+	}
+}
+
+func writeLayoutBlob(t *testing.T, dir, content string) string {
+	sum := sha256.Sum256([]byte(content))
+	path := filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:]))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Manifest media types accepted from registries.
+const (
+	MediaTypeDockerManifest     string = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList string = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        string = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           string = "application/vnd.oci.image.index.v1+json"
+)
+
+var manifestMediaTypes = []string{
+	MediaTypeOCIIndex,
+	MediaTypeOCIManifest,
+	MediaTypeDockerManifestList,
+	MediaTypeDockerManifest,
+}
+
+// Descriptor describes content stored in a registry.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`     // Platform of an image in an index
+	ArtifactType string            `json:"artifactType,omitempty"` // Type of an artifact in a referrers index
+}
+
+// Manifest is an image manifest or an image index.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Manifests     []Descriptor      `json:"manifests,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// IsIndex returns true when the manifest is an image index or manifest list.
+func (m Manifest) IsIndex() bool {
+	return m.MediaType == MediaTypeOCIIndex || m.MediaType == MediaTypeDockerManifestList || len(m.Manifests) > 0
+}
+
+// Head returns the descriptor of the manifest the reference points to, or
+// ErrNotFound if it does not exist.
+func (c *Client) Head(ctx context.Context, ref Reference) (Descriptor, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.url(ref, "manifests/"+ref.Identifier()), nil)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ","))
+
+	res, err := c.Do(req, ref.Repository, ScopePull)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return Descriptor{}, responseError(res)
+	}
+
+	desc := Descriptor{
+		MediaType: res.Header.Get("Content-Type"),
+		Digest:    res.Header.Get("Docker-Content-Digest"),
+	}
+	desc.Size, _ = strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
+	if desc.Digest == "" {
+		return desc, fmt.Errorf("registry did not return a digest for %s", ref)
+	}
+	return desc, nil
+}
+
+// Manifest fetches and decodes the manifest the reference points to.
+func (c *Client) Manifest(ctx context.Context, ref Reference) (Manifest, Descriptor, error) {
+	body, mediaType, err := c.rawManifest(ctx, ref)
+	if err != nil {
+		return Manifest{}, Descriptor{}, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return Manifest{}, Descriptor{}, errors.Wrap(err, fmt.Sprintf("failed to decode manifest of %s", ref))
+	}
+	manifest.MediaType = mediaType
+	return manifest, describeBytes(mediaType, body), nil
+}
+
+// Blob opens the blob with the digest in the reference's repository. The
+// caller must close the returned reader.
+func (c *Client) Blob(ctx context.Context, ref Reference, digest string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(ref, "blobs/"+digest), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Do(req, ref.Repository, ScopePull)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer drain(res)
+		return nil, responseError(res)
+	}
+	return res.Body, nil
+}
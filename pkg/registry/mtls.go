@@ -0,0 +1,44 @@
+package registry
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// hostTransport sends the requests to the hosts with a transport of their
+// own, and the other requests with the base transport.
+type hostTransport struct {
+	base  http.RoundTripper
+	hosts map[string]http.RoundTripper
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if transport, ok := t.hosts[req.URL.Host]; ok {
+		return transport.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// ClientCertificates presents the certificates to the registries, given by
+// host, enforcing mutual TLS.
+func (c *Client) ClientCertificates(certs map[string]tls.Certificate) {
+	if len(certs) == 0 {
+		return
+	}
+	base, ok := c.HTTP.Transport.(*http.Transport)
+	if !ok {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	hosts := map[string]http.RoundTripper{}
+	for host, cert := range certs {
+		transport := base.Clone()
+		config := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			config = transport.TLSClientConfig.Clone()
+		}
+		config.Certificates = []tls.Certificate{cert}
+		transport.TLSClientConfig = config
+		hosts[host] = transport
+	}
+	c.HTTP.Transport = hostTransport{base: base, hosts: hosts}
+}
@@ -0,0 +1,203 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Mutation changes the metadata of a pushed image without changing its
+// layers, so the layer cache stays valid.
+type Mutation struct {
+	Labels      map[string]string // Labels added to the image config
+	Annotations map[string]string // Annotations added to the manifest
+}
+
+// Mutate applies the mutation to the image src points to and pushes the
+// resulting manifest to each of refs, returning its digest. The labels of
+// each image of an index are changed.
+func (c *Client) Mutate(ctx context.Context, src Reference, refs []Reference, m Mutation) (string, error) {
+	body, mediaType, err := c.rawManifest(ctx, src)
+	if err != nil {
+		return "", err
+	}
+	body, err = c.mutateManifest(ctx, src, body, mediaType, m)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range refs {
+		if err := c.putManifest(ctx, ref, mediaType, body); err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("failed to push manifest to %s", ref))
+		}
+	}
+	return describeBytes(mediaType, body).Digest, nil
+}
+
+// mutateManifest returns the manifest with the mutation applied, pushing
+// the changed configs and, for indexes, the changed image manifests.
+func (c *Client) mutateManifest(ctx context.Context, ref Reference, body []byte, mediaType string, m Mutation) ([]byte, error) {
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to decode manifest of %s", ref))
+	}
+
+	if len(m.Annotations) > 0 {
+		if mediaType == MediaTypeDockerManifest || mediaType == MediaTypeDockerManifestList {
+			return nil, fmt.Errorf("annotations require an OCI manifest, %s is %s", ref, mediaType)
+		}
+		if err := mergeField(manifest, "annotations", m.Annotations); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(m.Labels) > 0 {
+		switch mediaType {
+		case MediaTypeOCIIndex, MediaTypeDockerManifestList:
+			if err := c.mutateImages(ctx, ref, manifest, m); err != nil {
+				return nil, err
+			}
+		default:
+			if err := c.mutateConfig(ctx, ref, manifest, m.Labels); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return json.Marshal(manifest)
+}
+
+// mutateImages applies the mutation to the images of an index, updating
+// their descriptors.
+func (c *Client) mutateImages(ctx context.Context, ref Reference, index map[string]json.RawMessage, m Mutation) error {
+	var descs []map[string]json.RawMessage
+	if err := json.Unmarshal(index["manifests"], &descs); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to decode index of %s", ref))
+	}
+	for _, desc := range descs {
+		var digest, mediaType string
+		json.Unmarshal(desc["digest"], &digest)
+		json.Unmarshal(desc["mediaType"], &mediaType)
+		if mediaType != MediaTypeOCIManifest && mediaType != MediaTypeDockerManifest {
+			// attestations and other artifacts stay unchanged
+			continue
+		}
+		image := Reference{Registry: ref.Registry, Repository: ref.Repository, Digest: digest}
+		body, _, err := c.rawManifest(ctx, image)
+		if err != nil {
+			return err
+		}
+		body, err = c.mutateManifest(ctx, image, body, mediaType, Mutation{Labels: m.Labels})
+		if err != nil {
+			return err
+		}
+		mutated := describeBytes(mediaType, body)
+		image.Digest = mutated.Digest
+		if err := c.putManifest(ctx, image, mediaType, body); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to push manifest to %s", image))
+		}
+		desc["digest"], _ = json.Marshal(mutated.Digest)
+		desc["size"], _ = json.Marshal(mutated.Size)
+	}
+	var err error
+	index["manifests"], err = json.Marshal(descs)
+	return err
+}
+
+// mutateConfig adds the labels to the config of an image manifest, pushing
+// the new config blob and updating the config descriptor.
+func (c *Client) mutateConfig(ctx context.Context, ref Reference, manifest map[string]json.RawMessage, labels map[string]string) error {
+	var desc Descriptor
+	if err := json.Unmarshal(manifest["config"], &desc); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to decode config descriptor of %s", ref))
+	}
+	blob, err := c.Blob(ctx, ref, desc.Digest)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to fetch config of %s", ref))
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(blob, 16<<20))
+	blob.Close()
+	if err != nil {
+		return err
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(content, &config); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to decode config of %s", ref))
+	}
+	runtime := map[string]json.RawMessage{}
+	if raw, ok := config["config"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &runtime); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to decode config of %s", ref))
+		}
+	}
+	if err := mergeField(runtime, "Labels", labels); err != nil {
+		return err
+	}
+	if config["config"], err = json.Marshal(runtime); err != nil {
+		return err
+	}
+	if content, err = json.Marshal(config); err != nil {
+		return err
+	}
+
+	mutated := describeBytes(desc.MediaType, content)
+	open := func() (io.ReadCloser, error) { return ioutil.NopCloser(bytes.NewReader(content)), nil }
+	if err := c.uploadBlob(ctx, ref, open, mutated); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to push config to %s", ref))
+	}
+	manifest["config"], err = json.Marshal(mutated)
+	return err
+}
+
+// mergeField adds values to the string map in field of object.
+func mergeField(object map[string]json.RawMessage, field string, values map[string]string) error {
+	merged := map[string]string{}
+	if raw, ok := object[field]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &merged); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("failed to decode %s", field))
+		}
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	var err error
+	object[field], err = json.Marshal(merged)
+	return err
+}
+
+// rawManifest fetches the manifest the reference points to as is, with its
+// media type.
+func (c *Client) rawManifest(ctx context.Context, ref Reference) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(ref, "manifests/"+ref.Identifier()), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ","))
+
+	res, err := c.Do(req, ref.Repository, ScopePull)
+	if err != nil {
+		return nil, "", err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusOK {
+		return nil, "", responseError(res)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 4<<20))
+	if err != nil {
+		return nil, "", err
+	}
+	mediaType := res.Header.Get("Content-Type")
+	var typed struct {
+		MediaType string `json:"mediaType"`
+	}
+	if json.Unmarshal(body, &typed) == nil && typed.MediaType != "" {
+		mediaType = typed.MediaType
+	}
+	return body, mediaType, nil
+}
@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Platform is the platform of an image, as listed in the descriptors of an
+// image index.
+type Platform struct {
+	OS           string   `json:"os"`
+	Architecture string   `json:"architecture"`
+	Variant      string   `json:"variant,omitempty"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+}
+
+// operatingSystems lists the operating systems of image platforms, mapped
+// to the architectures they run on when restricted.
+var operatingSystems = map[string][]string{
+	"linux":   nil,
+	"windows": {"amd64", "arm64", "386"},
+	"darwin":  {"amd64", "arm64"},
+	"freebsd": nil,
+	"wasi":    {"wasm"},
+	"wasip1":  {"wasm"},
+	"wasip2":  {"wasm"},
+}
+
+// architectures lists the architectures of image platforms, mapped to the
+// variant pattern they accept.
+var architectures = map[string]*regexp.Regexp{
+	"amd64":    regexp.MustCompile(`^v[2-4]$`),
+	"arm64":    regexp.MustCompile(`^v(8|9)(\.[0-9])?$`),
+	"arm":      regexp.MustCompile(`^v[5-8]$`),
+	"386":      nil,
+	"ppc64":    nil,
+	"ppc64le":  nil,
+	"s390x":    nil,
+	"riscv32":  nil,
+	"riscv64":  nil,
+	"mips":     nil,
+	"mipsle":   nil,
+	"mips64":   nil,
+	"mips64le": nil,
+	"loong64":  nil,
+	"sparc64":  nil,
+	"wasm":     nil,
+}
+
+// archAliases maps the names architectures are commonly known by to their
+// image platform architecture and default variant.
+var archAliases = map[string][2]string{
+	"x86_64":   {"amd64", ""},
+	"x86-64":   {"amd64", ""},
+	"aarch64":  {"arm64", ""},
+	"armhf":    {"arm", "v7"},
+	"armel":    {"arm", "v6"},
+	"i386":     {"386", ""},
+	"i686":     {"386", ""},
+	"ppc64el":  {"ppc64le", ""},
+	"mipsel":   {"mipsle", ""},
+	"mips64el": {"mips64le", ""},
+	"wasm32":   {"wasm", ""},
+}
+
+// ParsePlatform parses a platform in the form os/arch[/variant] and
+// normalizes it as container runtimes match it: names are lowercased,
+// aliases such as x86_64 and aarch64 are replaced, variants get their v
+// prefix, arm defaults to v7 and the baseline variants amd64/v1 and
+// arm64/v8 are dropped.
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", s)
+	}
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return Platform{}, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", s)
+		}
+		p.Variant = parts[2]
+		if !strings.HasPrefix(p.Variant, "v") {
+			p.Variant = "v" + p.Variant
+		}
+	}
+	if p.OS == "macos" {
+		p.OS = "darwin"
+	}
+	if alias, ok := archAliases[p.Architecture]; ok {
+		p.Architecture = alias[0]
+		if p.Variant == "" {
+			p.Variant = alias[1]
+		}
+	}
+	switch {
+	case p.Architecture == "arm" && p.Variant == "":
+		p.Variant = "v7"
+	case p.Architecture == "arm64" && p.Variant == "v8", p.Architecture == "amd64" && p.Variant == "v1":
+		p.Variant = ""
+	}
+
+	archs, ok := operatingSystems[p.OS]
+	if !ok {
+		return Platform{}, fmt.Errorf("unsupported platform os %q in %s", p.OS, s)
+	}
+	variants, ok := architectures[p.Architecture]
+	if !ok {
+		return Platform{}, fmt.Errorf("unsupported platform architecture %q in %s", p.Architecture, s)
+	}
+	if archs != nil && !contains(archs, p.Architecture) {
+		return Platform{}, fmt.Errorf("unsupported platform %s, %s images run on %s", s, p.OS, strings.Join(archs, ", "))
+	}
+	if p.Architecture == "wasm" && archs == nil {
+		return Platform{}, fmt.Errorf("unsupported platform %s, wasm images run on wasi, e.g. wasi/wasm", s)
+	}
+	if p.Variant != "" && (variants == nil || !variants.MatchString(p.Variant)) {
+		return Platform{}, fmt.Errorf("unsupported variant %q of platform architecture %s in %s", p.Variant, p.Architecture, s)
+	}
+	return p, nil
+}
+
+// String returns the platform in the form os/arch[/variant].
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     string
+		err      bool
+	}{
+		{platform: "linux/amd64", want: "linux/amd64"},
+		{platform: "Linux/x86_64", want: "linux/amd64"},
+		{platform: "linux/amd64/v1", want: "linux/amd64"},
+		{platform: "linux/amd64/v3", want: "linux/amd64/v3"},
+		{platform: "linux/aarch64", want: "linux/arm64"},
+		{platform: "linux/arm64/v8", want: "linux/arm64"},
+		{platform: "linux/arm64/v8.2", want: "linux/arm64/v8.2"},
+		{platform: "linux/arm", want: "linux/arm/v7"},
+		{platform: "linux/arm/6", want: "linux/arm/v6"},
+		{platform: "linux/armhf", want: "linux/arm/v7"},
+		{platform: "macos/arm64", want: "darwin/arm64"},
+		{platform: "wasi/wasm", want: "wasi/wasm"},
+		{platform: "wasip1/wasm32", want: "wasip1/wasm"},
+		{platform: "linux/ppc64", want: "linux/ppc64"},
+		{platform: "linux/ppc64el", want: "linux/ppc64le"},
+		{platform: "linux/mips", want: "linux/mips"},
+		{platform: "linux/mipsel", want: "linux/mipsle"},
+		{platform: "linux/mips64", want: "linux/mips64"},
+		{platform: "linux/mips64el", want: "linux/mips64le"},
+		{platform: "linux/riscv32", want: "linux/riscv32"},
+		{platform: "linux/sparc64", want: "linux/sparc64"},
+		{platform: "linux/wasm", err: true},
+		{platform: "wasi/amd64", err: true},
+		{platform: "windows/s390x", err: true},
+		{platform: "linux/amd64/v7", err: true},
+		{platform: "linux/s390x/v2", err: true},
+		{platform: "linux/sparc", err: true},
+		{platform: "plan9/386", err: true},
+		{platform: "linux/arm/", err: true},
+		{platform: "amd64", err: true},
+	}
+	for _, tt := range tests {
+		p, err := ParsePlatform(tt.platform)
+		if (err != nil) != tt.err {
+			t.Errorf("ParsePlatform(%s) error = %v", tt.platform, err)
+			continue
+		}
+		if !tt.err && p.String() != tt.want {
+			t.Errorf("ParsePlatform(%s) = %s, want %s", tt.platform, p, tt.want)
+		}
+	}
+}
+
+func TestDescriptorPlatform(t *testing.T) {
+	index := []byte(`{"schemaVersion": 2, "manifests": [{"mediaType": "` + MediaTypeOCIManifest + `", "digest": "sha256:arm", "size": 1, "platform": {"os": "linux", "architecture": "arm", "variant": "v6"}}]}`)
+	var manifest Manifest
+	if err := json.Unmarshal(index, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if p := manifest.Manifests[0].Platform; p == nil || p.String() != "linux/arm/v6" {
+		t.Errorf("expected the platform variant of the index entry, got %+v", p)
+	}
+	body, err := json.Marshal(manifest.Manifests[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"platform":{"os":"linux","architecture":"arm","variant":"v6"}`; !strings.Contains(string(body), want) {
+		t.Errorf("expected the variant kept in %s", body)
+	}
+}
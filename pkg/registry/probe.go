@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ProbePush checks the credentials may push to the repository of the
+// reference by starting a blob upload, which needs the push scope, and
+// cancelling it. Nothing is written to the repository.
+func (c *Client) ProbePush(ctx context.Context, ref Reference) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(ref, "blobs/uploads/"), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.Do(req, ref.Repository, ScopePush)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusAccepted {
+		defer drain(res)
+		return responseError(res)
+	}
+	drain(res)
+
+	// cancelling is best effort, registries expire abandoned uploads
+	location, err := res.Request.URL.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return errors.Wrap(err, "invalid upload location")
+	}
+	if req, err = http.NewRequestWithContext(ctx, http.MethodDelete, location.String(), nil); err != nil {
+		return err
+	}
+	if res, err = c.Do(req, ref.Repository, ScopePush); err == nil {
+		drain(res)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientProbePush(t *testing.T) {
+	var cancelled string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/foo/app/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/app/blobs/uploads/1234?_state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodDelete:
+			cancelled = r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+	if err := client.ProbePush(context.Background(), Reference{Registry: host.Host, Repository: "foo/app", Tag: "latest"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/v2/foo/app/blobs/uploads/1234"; cancelled != want {
+		t.Errorf("cancelled %s, want %s", cancelled, want)
+	}
+
+	if err := client.ProbePush(context.Background(), Reference{Registry: host.Host, Repository: "foo/other", Tag: "latest"}); err == nil {
+		t.Error("expected error for a denied upload")
+	}
+}
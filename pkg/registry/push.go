@@ -0,0 +1,208 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// Media types of the image manifest pushed from a tarball.
+const (
+	MediaTypeDockerConfig string = "application/vnd.docker.container.image.v1+json"
+	MediaTypeDockerLayer  string = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// PushTarball pushes the image in a docker save formatted tarball, as
+// written by kaniko with --tar-path, to each reference and returns the
+// manifest digest. Layers must be gzip compressed.
+func (c *Client) PushTarball(ctx context.Context, file string, refs []Reference) (string, error) {
+	if len(refs) == 0 {
+		return "", fmt.Errorf("no destination to push %s to", file)
+	}
+
+	var entries []struct {
+		Config string
+		Layers []string
+	}
+	content, err := readTarEntry(file, "manifest.json")
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(content, &entries); err != nil || len(entries) == 0 {
+		return "", fmt.Errorf("image tarball %s does not contain a valid manifest.json", file)
+	}
+	entry := entries[0]
+
+	manifest := Manifest{SchemaVersion: 2, MediaType: MediaTypeDockerManifest}
+	if manifest.Config, err = describeTarEntry(file, entry.Config, MediaTypeDockerConfig); err != nil {
+		return "", err
+	}
+	for _, layer := range entry.Layers {
+		desc, err := describeTarEntry(file, layer, MediaTypeDockerLayer)
+		if err != nil {
+			return "", err
+		}
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	blobs := append([]string{entry.Config}, entry.Layers...)
+	descs := append([]Descriptor{manifest.Config}, manifest.Layers...)
+	for _, ref := range refs {
+		for i, desc := range descs {
+			name := blobs[i]
+			open := func() (io.ReadCloser, error) { return openTarEntry(file, name) }
+			if err := c.uploadBlob(ctx, ref, open, desc); err != nil {
+				return "", errors.Wrap(err, fmt.Sprintf("failed to push blob %s to %s", desc.Digest, ref))
+			}
+		}
+		if err := c.putManifest(ctx, ref, MediaTypeDockerManifest, body); err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("failed to push manifest to %s", ref))
+		}
+	}
+	return digest, nil
+}
+
+// uploadBlob uploads the blob read from open to the repository unless the
+// registry already has it.
+func (c *Client) uploadBlob(ctx context.Context, ref Reference, open func() (io.ReadCloser, error), desc Descriptor) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.url(ref, "blobs/"+desc.Digest), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.Do(req, ref.Repository, ScopePush)
+	if err != nil {
+		return err
+	}
+	drain(res)
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, c.url(ref, "blobs/uploads/"), nil)
+	if err != nil {
+		return err
+	}
+	res, err = c.Do(req, ref.Repository, ScopePush)
+	if err != nil {
+		return err
+	}
+	drain(res)
+	if res.StatusCode != http.StatusAccepted {
+		return responseError(res)
+	}
+	location, err := res.Request.URL.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return errors.Wrap(err, "invalid upload location")
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	body, err := open()
+	if err != nil {
+		return err
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, location.String(), body)
+	if err != nil {
+		body.Close()
+		return err
+	}
+	req.GetBody = open
+	req.ContentLength = desc.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	res, err = c.Do(req, ref.Repository, ScopePush)
+	if err != nil {
+		return err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusCreated {
+		return responseError(res)
+	}
+	return nil
+}
+
+func (c *Client) putManifest(ctx context.Context, ref Reference, mediaType string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(ref, "manifests/"+url.PathEscape(ref.Identifier())), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mediaType)
+	res, err := c.Do(req, ref.Repository, ScopePush)
+	if err != nil {
+		return err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusCreated && res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+	return nil
+}
+
+// describeTarEntry returns the descriptor of a tarball entry.
+func describeTarEntry(file, name, mediaType string) (Descriptor, error) {
+	r, err := openTarEntry(file, name)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer r.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+}
+
+func readTarEntry(file, name string) ([]byte, error) {
+	r, err := openTarEntry(file, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// openTarEntry opens the named entry of the tarball.
+func openTarEntry(file, name string) (io.ReadCloser, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, errors.Wrap(err, "failed to read image tarball")
+		}
+		if path.Clean(hdr.Name) == path.Clean(name) {
+			return struct {
+				io.Reader
+				io.Closer
+			}{tr, f}, nil
+		}
+	}
+	f.Close()
+	return nil, fmt.Errorf("image tarball %s does not contain %s", file, name)
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DockerHub is the registry host used for references without a registry.
+	DockerHub string = "index.docker.io"
+
+	dockerHubAlias string = "docker.io"
+)
+
+var (
+	tagRegexp    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+)
+
+// Reference is a parsed image reference.
+type Reference struct {
+	Registry   string // Registry host, e.g. index.docker.io
+	Repository string // Repository path, e.g. library/alpine
+	Tag        string // Image tag
+	Digest     string // Image digest, takes precedence over the tag
+}
+
+// ParseReference parses an image reference in the same way the docker cli
+// does, defaulting to Docker Hub and the latest tag.
+func ParseReference(ref string) (Reference, error) {
+	var r Reference
+	if ref == "" {
+		return r, fmt.Errorf("image reference must not be empty")
+	}
+
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		r.Digest = name[i+1:]
+		name = name[:i]
+		if !digestRegexp.MatchString(r.Digest) {
+			return r, fmt.Errorf("invalid digest %q in image reference %s", r.Digest, ref)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		r.Tag = name[i+1:]
+		name = name[:i]
+		if !tagRegexp.MatchString(r.Tag) {
+			return r, fmt.Errorf("invalid tag %q in image reference %s", r.Tag, ref)
+		}
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		r.Registry, r.Repository = parts[0], parts[1]
+	} else {
+		r.Registry, r.Repository = DockerHub, name
+	}
+	if r.Registry == dockerHubAlias {
+		r.Registry = DockerHub
+	}
+	if r.Registry == DockerHub && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+	if r.Repository == "" || strings.ToLower(r.Repository) != r.Repository {
+		return r, fmt.Errorf("invalid repository %q in image reference %s", r.Repository, ref)
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+// Identifier returns the digest of the reference, or the tag if unset.
+func (r Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// String returns the fully qualified reference.
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
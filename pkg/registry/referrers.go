@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Modes of attaching artifacts to images.
+const (
+	ReferrersAuto = "auto" // probe the referrers API, fall back to the referrers tag schema and cosign tags
+	ReferrersAPI  = "api"  // rely on the OCI 1.1 referrers API
+	ReferrersTag  = "tag"  // also list artifacts in the referrers tag schema index and tag them for cosign
+)
+
+// MediaTypeOCIEmpty is the media type of the empty config of artifacts.
+const MediaTypeOCIEmpty string = "application/vnd.oci.empty.v1+json"
+
+// emptyConfig is the content of the empty config descriptor.
+var emptyConfig = []byte("{}")
+
+// artifactManifest is an OCI image manifest describing an artifact, attached
+// to the subject manifest when set.
+type artifactManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// PushReferrer pushes content as an artifact of artifactType whose subject
+// is the manifest ref points to, so registries supporting the referrers API
+// list it with the image. It returns the digest of the artifact manifest.
+func (c *Client) PushReferrer(ctx context.Context, ref Reference, artifactType string, content []byte, annotations map[string]string) (string, error) {
+	return c.Attach(ctx, ref, Artifact{
+		ArtifactType: artifactType,
+		Blobs:        []Blob{BytesBlob(artifactType, content)},
+		Annotations:  annotations,
+	})
+}
+
+// PushAnnotations pushes an artifact of artifactType without content, whose
+// manifest carries the annotations, to the tag of ref. It returns the digest
+// of the artifact manifest.
+func (c *Client) PushAnnotations(ctx context.Context, ref Reference, artifactType string, annotations map[string]string) (string, error) {
+	desc, err := c.PushArtifact(ctx, ref, Artifact{ArtifactType: artifactType, Annotations: annotations})
+	return desc.Digest, err
+}
+
+// tagReferrers returns true if artifacts of the subject must be tagged,
+// according to the referrers mode. Registries are assumed not to support
+// the referrers API when probing fails.
+func (c *Client) tagReferrers(ctx context.Context, ref Reference, subject string) bool {
+	switch c.Referrers {
+	case ReferrersAPI:
+		return false
+	case ReferrersTag:
+		return true
+	}
+	supported, err := c.SupportsReferrers(ctx, ref, subject)
+	return err != nil || !supported
+}
+
+// SupportsReferrers probes whether the registry implements the OCI 1.1
+// referrers API for the repository of ref, listing the referrers of the
+// subject digest.
+func (c *Client) SupportsReferrers(ctx context.Context, ref Reference, subject string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(ref, "referrers/"+subject), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", MediaTypeOCIIndex)
+	res, err := c.Do(req, ref.Repository, ScopePull)
+	if err != nil {
+		return false, err
+	}
+	defer drain(res)
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, nil
+	case res.StatusCode != http.StatusOK:
+		return false, responseError(res)
+	}
+	return strings.HasPrefix(res.Header.Get("Content-Type"), MediaTypeOCIIndex), nil
+}
+
+// referrersIndex is the image index listing the artifacts of a subject in
+// the referrers tag schema. Descriptors are kept as is, so fields added by
+// other tools survive updates.
+type referrersIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Manifests     []json.RawMessage `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// addReferrer adds the descriptor of an artifact to the referrers index of
+// the subject digest in the repository of ref, creating the index when the
+// subject has no artifacts yet.
+func (c *Client) addReferrer(ctx context.Context, ref Reference, subject string, desc Descriptor) error {
+	target := Reference{Registry: ref.Registry, Repository: ref.Repository, Tag: ReferrerTag(subject)}
+	index := referrersIndex{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}
+	body, _, err := c.rawManifest(ctx, target)
+	switch {
+	case err == ErrNotFound:
+	case err != nil:
+		return errors.Wrap(err, fmt.Sprintf("failed to fetch referrers index %s", target))
+	default:
+		if err := json.Unmarshal(body, &index); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid referrers index %s", target))
+		}
+	}
+	for _, manifest := range index.Manifests {
+		var listed Descriptor
+		if json.Unmarshal(manifest, &listed) == nil && listed.Digest == desc.Digest {
+			return nil
+		}
+	}
+	entry, err := json.Marshal(desc)
+	if err != nil {
+		return err
+	}
+	index.Manifests = append(index.Manifests, entry)
+	if body, err = json.Marshal(index); err != nil {
+		return err
+	}
+	if err := c.putManifest(ctx, target, MediaTypeOCIIndex, body); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to push referrers index %s", target))
+	}
+	return nil
+}
+
+// ReferrerTag returns the tag of the referrers index of the subject digest
+// in the referrers tag schema of the OCI distribution specification,
+// <alg>-<ref>, e.g. sha256-<hex>.
+func ReferrerTag(subject string) string {
+	alg, ref := subject, ""
+	if i := strings.Index(subject, ":"); i >= 0 {
+		alg, ref = subject[:i], subject[i+1:]
+	}
+	// tags are limited to 128 characters
+	if len(alg) > 32 {
+		alg = alg[:32]
+	}
+	if len(ref) > 64 {
+		ref = ref[:64]
+	}
+	return alg + "-" + ref
+}
+
+// CosignTag returns the tag of an artifact of the subject digest in the
+// cosign convention, sha256-<hex>.<sig|att|sbom>, or an empty string when
+// the artifact type is neither a signature, an attestation nor an SBOM.
+func CosignTag(subject, artifactType string) string {
+	var suffix string
+	switch {
+	case strings.Contains(artifactType, "signature"):
+		suffix = "sig"
+	case strings.Contains(artifactType, "in-toto"), strings.Contains(artifactType, "dsse"):
+		suffix = "att"
+	case strings.Contains(artifactType, "spdx"), strings.Contains(artifactType, "cyclonedx"), strings.Contains(artifactType, "syft"):
+		suffix = "sbom"
+	default:
+		return ""
+	}
+	return strings.Replace(subject, ":", "-", 1) + "." + suffix
+}
+
+// describeBytes returns the descriptor of content.
+func describeBytes(mediaType string, content []byte) Descriptor {
+	sum := sha256.Sum256(content)
+	return Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(content))}
+}
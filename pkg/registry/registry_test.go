@@ -0,0 +1,605 @@
+package registry
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want Reference
+		err  bool
+	}{
+		{ref: "alpine", want: Reference{Registry: DockerHub, Repository: "library/alpine", Tag: "latest"}},
+		{ref: "docker.io/foo/bar:1.0", want: Reference{Registry: DockerHub, Repository: "foo/bar", Tag: "1.0"}},
+		{ref: "localhost:5000/foo:dev", want: Reference{Registry: "localhost:5000", Repository: "foo", Tag: "dev"}},
+		{ref: "gcr.io/project/image@sha256:abc123", want: Reference{Registry: "gcr.io", Repository: "project/image", Digest: "sha256:abc123"}},
+		{ref: "foo/Bar", err: true},
+		{ref: "foo:bad tag", err: true},
+		{ref: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseReference(tt.ref)
+			if (err != nil) != tt.err {
+				t.Fatalf("ParseReference(%q) error = %v", tt.ref, err)
+			}
+			if !tt.err && got != tt.want {
+				t.Errorf("ParseReference(%q) = %+v, want %+v", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientHead(t *testing.T) {
+	const digest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "foo" || pass != "bar" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if got := r.URL.Query().Get("scope"); got != "repository:foo/bar:pull" {
+				t.Errorf("unexpected scope %q", got)
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": "secret"})
+		case "/v2/foo/bar/manifests/1.0":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.Header().Set("Content-Type", MediaTypeDockerManifest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	config := fmt.Sprintf(`{"auths": {"%s": {"auth": "Zm9vOmJhcg=="}}}`, host.Host)
+	if err := ioutil.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(configPath, false)
+	client.HTTP = server.Client()
+
+	desc, err := client.Head(context.Background(), Reference{Registry: host.Host, Repository: "foo/bar", Tag: "1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != digest {
+		t.Errorf("unexpected digest %s", desc.Digest)
+	}
+
+	_, err = client.Head(context.Background(), Reference{Registry: host.Host, Repository: "foo/bar", Tag: "2.0"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestClientPushTarball(t *testing.T) {
+	var mu sync.Mutex
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/blobs/"):
+			if _, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/blobs/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/foo/bar/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/bar/blobs/uploads/1?state=abc")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/foo/bar/blobs/uploads/1":
+			body, _ := ioutil.ReadAll(r.Body)
+			sum := sha256.Sum256(body)
+			digest := "sha256:" + hex.EncodeToString(sum[:])
+			if digest != r.URL.Query().Get("digest") || r.URL.Query().Get("state") != "abc" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			blobs[digest] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")] = body
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "image.tar")
+	writeTar(t, file, map[string]string{
+		"manifest.json": `[{"Config": "sha256:cfg", "Layers": ["abc.tar.gz"]}]`,
+		"sha256:cfg":    `{"architecture": "amd64"}`,
+		"abc.tar.gz":    "layer",
+	})
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+
+	refs := []Reference{
+		{Registry: host.Host, Repository: "foo/bar", Tag: "1.0"},
+		{Registry: host.Host, Repository: "foo/bar", Tag: "latest"},
+	}
+	digest, err := client.PushTarball(context.Background(), file, refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blobs) != 2 {
+		t.Errorf("expected config and layer blobs, got %d", len(blobs))
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifests["latest"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Layers) != 1 || string(blobs[manifest.Layers[0].Digest]) != "layer" {
+		t.Errorf("unexpected manifest %s", manifests["latest"])
+	}
+	sum := sha256.Sum256(manifests["1.0"])
+	if want := "sha256:" + hex.EncodeToString(sum[:]); digest != want {
+		t.Errorf("digest = %s, want %s", digest, want)
+	}
+}
+
+func writeTar(t *testing.T, file string, entries map[string]string) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for name, content := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientPushReferrer(t *testing.T) {
+	var mu sync.Mutex
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+	referrers := false
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/foo/bar/referrers/sha256:image" && referrers:
+			w.Header().Set("Content-Type", MediaTypeOCIIndex)
+			w.Write([]byte(`{"schemaVersion": 2, "manifests": []}`))
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/foo/bar/manifests/1.0":
+			w.Header().Set("Content-Type", MediaTypeDockerManifest)
+			w.Header().Set("Docker-Content-Digest", "sha256:image")
+			w.Header().Set("Content-Length", "42")
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/blobs/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/foo/bar/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/bar/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/foo/bar/blobs/uploads/1":
+			body, _ := ioutil.ReadAll(r.Body)
+			blobs[r.URL.Query().Get("digest")] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/foo/bar/manifests/sha256-image":
+			if index, ok := manifests["sha256-image"]; ok {
+				w.Header().Set("Content-Type", MediaTypeOCIIndex)
+				w.Write(index)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			tag := strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")
+			want := MediaTypeOCIManifest
+			if tag == "sha256-image" {
+				want = MediaTypeOCIIndex
+			}
+			if r.Header.Get("Content-Type") != want {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			manifests[tag] = body
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+
+	// the existing index of the subject lists an artifact of another tool
+	manifests["sha256-image"] = []byte(`{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.index.v1+json", "manifests": [{"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:other", "size": 1, "artifactType": "application/vnd.dev.cosign.signature", "data": "e30="}]}`)
+
+	ref := Reference{Registry: host.Host, Repository: "foo/bar", Tag: "1.0"}
+	digest, err := client.PushReferrer(context.Background(), ref, "application/vnd.in-toto+json", []byte(`{"_type": "statement"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest artifactManifest
+	if err := json.Unmarshal(manifests[digest], &manifest); err != nil {
+		t.Fatalf("expected the artifact manifest pushed by digest, got %v", manifests)
+	}
+	if manifest.Subject == nil || manifest.Subject.Digest != "sha256:image" || manifest.Subject.Size != 42 {
+		t.Errorf("expected the image as subject, got %+v", manifest.Subject)
+	}
+	if string(blobs[manifest.Layers[0].Digest]) != `{"_type": "statement"}` || string(blobs[manifest.Config.Digest]) != "{}" {
+		t.Errorf("unexpected blobs %v", blobs)
+	}
+	// the registry does not support the referrers API, the artifact is
+	// added to the index of the referrers tag schema, twice without
+	// duplicates
+	if _, err := client.PushReferrer(context.Background(), ref, "application/vnd.in-toto+json", []byte(`{"_type": "statement"}`), map[string]string{"team": "build"}); err != nil {
+		t.Fatal(err)
+	}
+	var index struct {
+		MediaType string                   `json:"mediaType"`
+		Manifests []map[string]interface{} `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifests["sha256-image"], &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.MediaType != MediaTypeOCIIndex || len(index.Manifests) != 3 {
+		t.Fatalf("expected 3 artifacts in the referrers index, got %s", manifests["sha256-image"])
+	}
+	if other := index.Manifests[0]; other["digest"] != "sha256:other" || other["data"] != "e30=" {
+		t.Errorf("expected the listed artifact kept as is, got %v", other)
+	}
+	if added := index.Manifests[1]; added["digest"] != digest || added["artifactType"] != "application/vnd.in-toto+json" || added["mediaType"] != MediaTypeOCIManifest {
+		t.Errorf("expected the artifact added to the referrers index, got %v", added)
+	}
+	if annotated := index.Manifests[2]; fmt.Sprint(annotated["annotations"]) != "map[team:build]" {
+		t.Errorf("expected the annotations of the artifact in the referrers index, got %v", annotated)
+	}
+	// cosign finds the latest attestation by its tag
+	if tagged := describeBytes(MediaTypeOCIManifest, manifests["sha256-image.att"]).Digest; tagged != index.Manifests[2]["digest"] {
+		t.Errorf("expected the attestation tagged sha256-image.att, got %s", manifests["sha256-image.att"])
+	}
+
+	referrers = true
+	before, tagged := string(manifests["sha256-image"]), string(manifests["sha256-image.att"])
+	if _, err := client.PushReferrer(context.Background(), ref, "application/vnd.in-toto+json", []byte(`{"_type": "other"}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if string(manifests["sha256-image"]) != before || string(manifests["sha256-image.att"]) != tagged {
+		t.Errorf("expected the referrers index and the cosign tag unchanged when the registry supports the referrers API")
+	}
+}
+
+func TestCosignTag(t *testing.T) {
+	for artifactType, want := range map[string]string{
+		"application/vnd.dev.cosign.signature":  "sha256-abc.sig",
+		"application/vnd.in-toto+json":          "sha256-abc.att",
+		"application/vnd.dsse.envelope.v1+json": "sha256-abc.att",
+		"application/spdx+json":                 "sha256-abc.sbom",
+		"application/vnd.cyclonedx+json":        "sha256-abc.sbom",
+		"application/vnd.example.report":        "",
+	} {
+		if got := CosignTag("sha256:abc", artifactType); got != want {
+			t.Errorf("CosignTag(%s) = %q, want %q", artifactType, got, want)
+		}
+	}
+}
+
+func TestReferrerTag(t *testing.T) {
+	for subject, want := range map[string]string{
+		"sha256:abc":                         "sha256-abc",
+		"sha512:" + strings.Repeat("a", 128): "sha512-" + strings.Repeat("a", 64),
+	} {
+		if got := ReferrerTag(subject); got != want {
+			t.Errorf("ReferrerTag(%s) = %s, want %s", subject, got, want)
+		}
+	}
+}
+
+func TestClientPushAnnotations(t *testing.T) {
+	var mu sync.Mutex
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/blobs/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/foo/bar/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/bar/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/foo/bar/blobs/uploads/1":
+			body, _ := ioutil.ReadAll(r.Body)
+			blobs[r.URL.Query().Get("digest")] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			body, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", MediaTypeOCIManifest)
+			w.Write(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+
+	ref := Reference{Registry: host.Host, Repository: "foo/bar", Tag: "lock"}
+	digest, err := client.PushAnnotations(context.Background(), ref, "application/vnd.example.lock", map[string]string{"holder": "build-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, desc, err := client.Manifest(context.Background(), ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != digest || manifest.Annotations["holder"] != "build-1" {
+		t.Errorf("expected the annotated manifest %s, got %s with %v", digest, desc.Digest, manifest.Annotations)
+	}
+	if strings.Contains(string(manifests["lock"]), "subject") {
+		t.Errorf("expected no subject, got %s", manifests["lock"])
+	}
+	if string(blobs[manifest.Config.Digest]) != "{}" {
+		t.Errorf("expected the empty config pushed, got %v", blobs)
+	}
+}
+
+func TestClientPushChart(t *testing.T) {
+	var mu sync.Mutex
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/foo/chart/blobs/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/foo/chart/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/chart/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/foo/chart/blobs/uploads/1":
+			body, _ := ioutil.ReadAll(r.Body)
+			blobs[r.URL.Query().Get("digest")] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/foo/chart/manifests/"):
+			if r.Header.Get("Content-Type") != MediaTypeOCIManifest {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/chart/manifests/")] = body
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+
+	ref := Reference{Registry: host.Host, Repository: "foo/chart", Tag: "1.0.0"}
+	config := []byte(`{"apiVersion":"v2","name":"chart","version":"1.0.0"}`)
+	digest, err := client.PushChart(context.Background(), ref, config, []byte("chart"), map[string]string{"org.opencontainers.image.title": "chart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifests["1.0.0"], &manifest); err != nil {
+		t.Fatalf("expected the chart manifest pushed to the tag, got %v", manifests)
+	}
+	if describeBytes(MediaTypeOCIManifest, manifests["1.0.0"]).Digest != digest {
+		t.Errorf("expected the chart manifest digest %s", digest)
+	}
+	if manifest.Config.MediaType != MediaTypeHelmConfig || string(blobs[manifest.Config.Digest]) != string(config) {
+		t.Errorf("unexpected config %+v", manifest.Config)
+	}
+	if len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != MediaTypeHelmChart || string(blobs[manifest.Layers[0].Digest]) != "chart" {
+		t.Errorf("unexpected layers %+v", manifest.Layers)
+	}
+	if manifest.Annotations["org.opencontainers.image.title"] != "chart" {
+		t.Errorf("unexpected annotations %v", manifest.Annotations)
+	}
+}
+
+func TestClientPushArtifact(t *testing.T) {
+	var mu sync.Mutex
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+	uploads := 0
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/foo/bundle/blobs/"):
+			if _, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/foo/bundle/blobs/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/foo/bundle/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/bundle/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/foo/bundle/blobs/uploads/1":
+			body, _ := ioutil.ReadAll(r.Body)
+			blobs[r.URL.Query().Get("digest")] = body
+			uploads++
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/foo/bundle/manifests/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bundle/manifests/")] = body
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{"policy.rego": "package main", "copy.rego": "package main"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	policy, err := FileBlob("application/vnd.cncf.openpolicyagent.policy.layer.v1+rego", filepath.Join(dir, "policy.rego"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dup, err := FileBlob("application/vnd.cncf.openpolicyagent.policy.layer.v1+rego", filepath.Join(dir, "copy.rego"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FileBlob(MediaTypeOCILayer, dir); err == nil {
+		t.Error("expected error for a directory")
+	}
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+
+	ref := Reference{Registry: host.Host, Repository: "foo/bundle"}
+	desc, err := client.PushArtifact(context.Background(), ref, Artifact{
+		ArtifactType: "application/vnd.example.policy",
+		Blobs:        []Blob{policy, dup},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest artifactManifest
+	if err := json.Unmarshal(manifests[desc.Digest], &manifest); err != nil {
+		t.Fatalf("expected the artifact manifest pushed by digest without a tag, got %v", manifests)
+	}
+	if manifest.ArtifactType != "application/vnd.example.policy" || manifest.Config.MediaType != MediaTypeOCIEmpty {
+		t.Errorf("unexpected manifest %s", manifests[desc.Digest])
+	}
+	if len(manifest.Layers) != 2 || manifest.Layers[0].Annotations[AnnotationTitle] != "policy.rego" || manifest.Layers[1].Annotations[AnnotationTitle] != "copy.rego" {
+		t.Errorf("expected the files as layers named by title, got %+v", manifest.Layers)
+	}
+	if uploads != 2 || string(blobs[policy.Digest]) != "package main" {
+		t.Errorf("expected the config and the shared content uploaded once, got %d uploads", uploads)
+	}
+}
+
+func TestClientMutate(t *testing.T) {
+	var mu sync.Mutex
+	config := []byte(`{"architecture": "amd64", "config": {"Labels": {"team": "build"}}, "rootfs": {"type": "layers"}}`)
+	configDesc := describeBytes(MediaTypeOCIManifest, config)
+	image := []byte(`{"schemaVersion": 2, "mediaType": "` + MediaTypeOCIManifest + `", "config": {"mediaType": "application/vnd.oci.image.config.v1+json", "digest": "` + configDesc.Digest + `", "size": 95}, "layers": [{"digest": "sha256:layer"}]}`)
+	blobs := map[string][]byte{configDesc.Digest: config}
+	manifests := map[string][]byte{"1.0": image}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			w.Header().Set("Content-Type", MediaTypeOCIManifest)
+			w.Write(manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")])
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/blobs/"):
+			w.Write(blobs[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/blobs/")])
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/blobs/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/foo/bar/blobs/uploads/":
+			w.Header().Set("Location", "/v2/foo/bar/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/foo/bar/blobs/uploads/1":
+			body, _ := ioutil.ReadAll(r.Body)
+			blobs[r.URL.Query().Get("digest")] = body
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/foo/bar/manifests/")] = body
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+
+	ref := Reference{Registry: host.Host, Repository: "foo/bar", Tag: "1.0"}
+	digest, err := client.Mutate(context.Background(), ref, []Reference{ref}, Mutation{
+		Labels:      map[string]string{"build-url": "https://drone.example.com/1"},
+		Annotations: map[string]string{"org.opencontainers.image.url": "https://example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest struct {
+		Config      Descriptor
+		Layers      []Descriptor
+		Annotations map[string]string
+	}
+	if err := json.Unmarshal(manifests["1.0"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if describeBytes(MediaTypeOCIManifest, manifests["1.0"]).Digest != digest {
+		t.Errorf("expected the mutated manifest digest %s", digest)
+	}
+	if manifest.Annotations["org.opencontainers.image.url"] != "https://example.com" || manifest.Layers[0].Digest != "sha256:layer" {
+		t.Errorf("unexpected manifest %s", manifests["1.0"])
+	}
+	var mutated struct {
+		Architecture string
+		Config       struct{ Labels map[string]string }
+	}
+	if err := json.Unmarshal(blobs[manifest.Config.Digest], &mutated); err != nil {
+		t.Fatal(err)
+	}
+	if mutated.Architecture != "amd64" || mutated.Config.Labels["team"] != "build" || mutated.Config.Labels["build-url"] != "https://drone.example.com/1" {
+		t.Errorf("unexpected config %s", blobs[manifest.Config.Digest])
+	}
+}
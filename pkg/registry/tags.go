@@ -0,0 +1,74 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// ScopeDelete is the token scope needed to delete from a repository.
+const ScopeDelete string = "pull,push,delete"
+
+// nextLinkRE matches the link to the next page of a paginated response.
+var nextLinkRE = regexp.MustCompile(`<([^>]+)>;\s*rel="?next"?`)
+
+// Tags lists the tags of the reference's repository, following the
+// pagination links of the registry.
+func (c *Client) Tags(ctx context.Context, ref Reference) ([]string, error) {
+	var tags []string
+	next := c.url(ref, "tags/list")
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.Do(req, ref.Repository, ScopePull)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			defer drain(res)
+			return nil, responseError(res)
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&page)
+		drain(res)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode tags")
+		}
+		tags = append(tags, page.Tags...)
+
+		next = ""
+		if m := nextLinkRE.FindStringSubmatch(res.Header.Get("Link")); m != nil {
+			u, err := res.Request.URL.Parse(m[1])
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid pagination link")
+			}
+			next = u.String()
+		}
+	}
+	return tags, nil
+}
+
+// Delete deletes the manifest with the digest of the reference, and with it
+// every tag pointing to it.
+func (c *Client) Delete(ctx context.Context, ref Reference) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.url(ref, "manifests/"+ref.Digest), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.Do(req, ref.Repository, ScopeDelete)
+	if err != nil {
+		return err
+	}
+	defer drain(res)
+	if res.StatusCode != http.StatusAccepted && res.StatusCode != http.StatusOK {
+		return responseError(res)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestClientTags(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/foo/cache/tags/list" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/foo/cache/tags/list?last=b&n=2>; rel="next"`)
+			w.Write([]byte(`{"name": "foo/cache", "tags": ["a", "b"]}`))
+			return
+		}
+		w.Write([]byte(`{"name": "foo/cache", "tags": ["c"]}`))
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+	tags, err := client.Tags(context.Background(), Reference{Registry: host.Host, Repository: "foo/cache"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags = %v, want %v", tags, want)
+	}
+}
+
+func TestClientDelete(t *testing.T) {
+	var deleted string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		deleted = r.URL.Path
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	host, _ := url.Parse(server.URL)
+	client := NewClient(filepath.Join(t.TempDir(), "config.json"), false)
+	client.HTTP = server.Client()
+	if err := client.Delete(context.Background(), Reference{Registry: host.Host, Repository: "foo/cache", Digest: "sha256:abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/v2/foo/cache/manifests/sha256:abc"; deleted != want {
+		t.Errorf("deleted %s, want %s", deleted, want)
+	}
+}
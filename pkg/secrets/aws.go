@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/pkg/errors"
+)
+
+// awsSession creates sessions with the default AWS credentials, such as
+// the IAM role of the runner.
+type awsSession struct {
+	once sync.Once
+	sess *session.Session
+	err  error
+}
+
+func (s *awsSession) get() (*session.Session, error) {
+	s.once.Do(func() {
+		s.sess, s.err = session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+		s.err = errors.Wrap(s.err, "failed to create aws session")
+	})
+	return s.sess, s.err
+}
+
+// awsConfig returns the config of the client for the region of the
+// reference, when it is an ARN, otherwise for the configured region.
+func awsConfig(ref, region, endpoint string) *aws.Config {
+	config := aws.NewConfig()
+	if a, err := arn.Parse(ref); err == nil && a.Region != "" {
+		region = a.Region
+	}
+	if region != "" {
+		config = config.WithRegion(region)
+	}
+	if endpoint != "" {
+		config = config.WithEndpoint(endpoint)
+	}
+	return config
+}
+
+// SSM reads SecureString and String parameters of the SSM Parameter Store.
+// References are parameter names or ARNs, e.g. /ci/dockerhub.
+type SSM struct {
+	Region   string
+	Endpoint string // Custom endpoint, e.g. a VPC endpoint
+
+	session awsSession
+}
+
+// Get implements Provider.
+func (s *SSM) Get(ctx context.Context, ref string) (string, error) {
+	sess, err := s.session.get()
+	if err != nil {
+		return "", err
+	}
+	out, err := ssm.New(sess, awsConfig(ref, s.Region, s.Endpoint)).GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(ref),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.Parameter.Value), nil
+}
+
+// SecretsManager reads secrets of AWS Secrets Manager. References are
+// secret names or ARNs, optionally followed by #key to select a key of a
+// secret holding a JSON object, e.g. ci/dockerhub#password.
+type SecretsManager struct {
+	Region   string
+	Endpoint string // Custom endpoint, e.g. a VPC endpoint
+
+	session awsSession
+}
+
+// Get implements Provider.
+func (s *SecretsManager) Get(ctx context.Context, ref string) (string, error) {
+	id, key := field(ref)
+	sess, err := s.session.get()
+	if err != nil {
+		return "", err
+	}
+	out, err := secretsmanager.New(sess, awsConfig(id, s.Region, s.Endpoint)).GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+	value := aws.StringValue(out.SecretString)
+	if out.SecretString == nil {
+		value = string(out.SecretBinary)
+	}
+	if key == "" {
+		return value, nil
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, remove #%s", id, key)
+	}
+	v, ok := object[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", id, key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	encoded, _ := json.Marshal(v)
+	return strings.TrimSpace(string(encoded)), nil
+}
@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func awsEnv(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+}
+
+func TestSSM(t *testing.T) {
+	awsEnv(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Name           string
+			WithDecryption bool
+		}
+		json.NewDecoder(r.Body).Decode(&in)
+		if r.Header.Get("X-Amz-Target") != "AmazonSSM.GetParameter" || in.Name != "/ci/dockerhub" || !in.WithDecryption {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ParameterNotFound"}`))
+			return
+		}
+		w.Write([]byte(`{"Parameter": {"Name": "/ci/dockerhub", "Type": "SecureString", "Value": "hunter2"}}`))
+	}))
+	defer server.Close()
+
+	store := &SSM{Endpoint: server.URL}
+	if got, err := store.Get(context.Background(), "/ci/dockerhub"); err != nil || got != "hunter2" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := store.Get(context.Background(), "/ci/missing"); err == nil {
+		t.Error("expected an error for a missing parameter")
+	}
+}
+
+func TestSecretsManager(t *testing.T) {
+	awsEnv(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&in)
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch in.SecretId {
+		case "ci/dockerhub":
+			w.Write([]byte(`{"SecretString": "{\"username\": \"octocat\", \"password\": \"hunter2\"}"}`))
+		case "ci/token":
+			w.Write([]byte(`{"SecretString": "plain"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type": "ResourceNotFoundException"}`))
+		}
+	}))
+	defer server.Close()
+
+	store := &SecretsManager{Endpoint: server.URL}
+	ctx := context.Background()
+	for ref, want := range map[string]string{
+		"ci/dockerhub#password": "hunter2",
+		"ci/token":              "plain",
+	} {
+		if got, err := store.Get(ctx, ref); err != nil || got != want {
+			t.Errorf("%s: got %q, %v", ref, got, err)
+		}
+	}
+	for _, ref := range []string{"ci/dockerhub#token", "ci/token#password", "ci/missing"} {
+		if _, err := store.Get(ctx, ref); err == nil {
+			t.Errorf("%s: expected an error", ref)
+		}
+	}
+}
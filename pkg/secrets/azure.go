@@ -0,0 +1,123 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/pkg/errors"
+)
+
+// keyVaultAPIVersion is the Key Vault REST API version.
+const keyVaultAPIVersion = "7.4"
+
+// keyVaultScope is the scope of Key Vault access tokens.
+const keyVaultScope = "https://vault.azure.net/.default"
+
+// KeyVault reads secrets of Azure Key Vault. It authenticates as the
+// service principal when the client secret is set, otherwise with the
+// managed identity of the runner, selected by the client id when set.
+//
+// References are secret names, optionally followed by /version, of the
+// default vault, or secret URLs such as
+// https://other.vault.azure.net/secrets/name.
+type KeyVault struct {
+	Vault        string // Default vault, as a name or URL
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+
+	Tokens azcore.TokenCredential // defaults to the credential above
+	HTTP   *http.Client
+
+	once sync.Once
+	err  error
+}
+
+// Get implements Provider.
+func (k *KeyVault) Get(ctx context.Context, ref string) (string, error) {
+	endpoint, err := k.secretURL(ref)
+	if err != nil {
+		return "", err
+	}
+	k.once.Do(func() {
+		if k.Tokens != nil {
+			return
+		}
+		if k.ClientSecret != "" {
+			k.Tokens, k.err = azidentity.NewClientSecretCredential(k.TenantID, k.ClientID, k.ClientSecret, nil)
+		} else {
+			options := &azidentity.ManagedIdentityCredentialOptions{}
+			if k.ClientID != "" {
+				options.ID = azidentity.ClientID(k.ClientID)
+			}
+			k.Tokens, k.err = azidentity.NewManagedIdentityCredential(options)
+		}
+		k.err = errors.Wrap(k.err, "failed to create azure credential")
+	})
+	if k.err != nil {
+		return "", k.err
+	}
+	token, err := k.Tokens.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{keyVaultScope}})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get a key vault access token")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	client := k.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var out struct {
+		Value string `json:"value"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.NewDecoder(res.Body).Decode(&out)
+	if res.StatusCode != http.StatusOK {
+		if out.Error.Message != "" {
+			return "", fmt.Errorf("%s: %s", res.Status, out.Error.Message)
+		}
+		return "", fmt.Errorf("%s", res.Status)
+	}
+	return out.Value, nil
+}
+
+// secretURL returns the URL of the referenced secret.
+func (k *KeyVault) secretURL(ref string) (string, error) {
+	if !strings.Contains(ref, "://") {
+		if k.Vault == "" {
+			return "", fmt.Errorf("no key vault configured for secret %s", ref)
+		}
+		vault := k.Vault
+		if !strings.Contains(vault, "://") {
+			vault = "https://" + vault + ".vault.azure.net"
+		}
+		ref = strings.TrimSuffix(vault, "/") + "/secrets/" + strings.TrimPrefix(ref, "/")
+	}
+	u, err := url.Parse(ref)
+	if err != nil || !strings.HasPrefix(u.Path, "/secrets/") {
+		return "", fmt.Errorf("invalid key vault secret %q", ref)
+	}
+	q := u.Query()
+	q.Set("api-version", keyVaultAPIVersion)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
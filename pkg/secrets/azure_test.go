@@ -0,0 +1,55 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+type staticCredential string
+
+func (s staticCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: string(s)}, nil
+}
+
+func TestKeyVault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("api-version") != keyVaultAPIVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/secrets/dockerhub", "/secrets/dockerhub/0123":
+			w.Write([]byte(`{"value": "hunter2", "id": "dockerhub"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": "SecretNotFound", "message": "A secret with (name/id) missing was not found in this key vault."}}`))
+		}
+	}))
+	defer server.Close()
+
+	vault := &KeyVault{Vault: server.URL, Tokens: staticCredential("token")}
+	ctx := context.Background()
+	for _, ref := range []string{"dockerhub", "dockerhub/0123", server.URL + "/secrets/dockerhub"} {
+		if got, err := vault.Get(ctx, ref); err != nil || got != "hunter2" {
+			t.Errorf("%s: got %q, %v", ref, got, err)
+		}
+	}
+	if _, err := vault.Get(ctx, "missing"); err == nil {
+		t.Error("expected an error for a missing secret")
+	}
+	if _, err := (&KeyVault{Tokens: staticCredential("token")}).Get(ctx, "dockerhub"); err == nil {
+		t.Error("expected an error without a vault")
+	}
+}
+
+func TestKeyVault_secretURL(t *testing.T) {
+	got, err := (&KeyVault{Vault: "ci-secrets"}).secretURL("dockerhub")
+	if want := "https://ci-secrets.vault.azure.net/secrets/dockerhub?api-version=" + keyVaultAPIVersion; err != nil || got != want {
+		t.Errorf("got %s, want %s (%v)", got, want, err)
+	}
+}
@@ -0,0 +1,80 @@
+// Package secrets resolves references to secrets held in external stores,
+// such as HashiCorp Vault, at run time, so long-lived secrets stay out of
+// the CI configuration.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Provider reads secrets of one store.
+type Provider interface {
+	// Get returns the secret value the store specific reference points to.
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+// Resolver resolves references of the form scheme:ref with the provider
+// registered for the scheme, e.g. vault:secret/data/ci#password.
+type Resolver map[string]Provider
+
+// Resolve returns the value of the reference.
+func (r Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	parts := strings.SplitN(ref, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("invalid secret reference %q, expected scheme:reference", ref)
+	}
+	provider, ok := r[parts[0]]
+	if !ok || provider == nil {
+		return "", fmt.Errorf("secret reference %q uses the unsupported or unconfigured store %q", ref, parts[0])
+	}
+	value, err := provider.Get(ctx, parts[1])
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret %q: %s", ref, err)
+	}
+	return value, nil
+}
+
+// Mapping is a secret resolved into a variable, parsed from NAME=reference.
+type Mapping struct {
+	Name string
+	Ref  string
+}
+
+// schemes are the schemes of the stores this package implements. A
+// reference starting with another scheme, e.g. an https URL, is a
+// reference of the default store.
+var schemes = map[string]bool{
+	"vault":          true,
+	"azurekv":        true,
+	"ssm":            true,
+	"secretsmanager": true,
+}
+
+// ParseMappings parses NAME=reference values, prefixing references without
+// the scheme of a known store with the default scheme.
+func ParseMappings(values []string, scheme string) ([]Mapping, error) {
+	var mappings []Mapping
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid secret mapping %q, expected NAME=reference", value)
+		}
+		ref := parts[1]
+		if prefix := strings.SplitN(ref, ":", 2); scheme != "" && (len(prefix) != 2 || !schemes[prefix[0]]) {
+			ref = scheme + ":" + ref
+		}
+		mappings = append(mappings, Mapping{Name: parts[0], Ref: ref})
+	}
+	return mappings, nil
+}
+
+// field splits a reference of the form path#field. The field is empty when
+// not given.
+func field(ref string) (path, field string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
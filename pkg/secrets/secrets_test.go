@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func vaultServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		switch {
+		case r.URL.Path == "/v1/auth/approle/login" && in["role_id"] == "role" && in["secret_id"] == "secret":
+			w.Write([]byte(`{"auth": {"client_token": "approle-token"}}`))
+		case r.URL.Path == "/v1/auth/k8s/login" && in["role"] == "ci" && in["jwt"] == "jwt":
+			w.Write([]byte(`{"auth": {"client_token": "k8s-token"}}`))
+		case r.Header.Get("X-Vault-Token") == "":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": ["permission denied"]}`))
+		case r.URL.Path == "/v1/secret/data/ci/dockerhub":
+			w.Write([]byte(`{"data": {"data": {"username": "octocat", "password": "hunter2"}, "metadata": {"version": 3}}}`))
+		case r.URL.Path == "/v1/kv/npm":
+			w.Write([]byte(`{"data": {"token": "npm-token"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": []}`))
+		}
+	}))
+}
+
+func TestVault(t *testing.T) {
+	server := vaultServer(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	jwt := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwt, []byte("jwt\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, vault := range map[string]*Vault{
+		"token":      {Addr: server.URL, Token: "static-token"},
+		"approle":    {Addr: server.URL, RoleID: "role", SecretID: "secret"},
+		"kubernetes": {Addr: server.URL, KubernetesRole: "ci", KubernetesTokenPath: jwt, AuthPath: "/k8s/"},
+	} {
+		if got, err := vault.Get(ctx, "secret/data/ci/dockerhub#password"); err != nil || got != "hunter2" {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+		// kv version 1, with a single field
+		if got, err := vault.Get(ctx, "kv/npm"); err != nil || got != "npm-token" {
+			t.Errorf("%s: got %q, %v", name, got, err)
+		}
+	}
+
+	vault := &Vault{Addr: server.URL, Token: "static-token"}
+	if _, err := vault.Get(ctx, "secret/data/ci/dockerhub"); err == nil {
+		t.Error("expected an error without a field for several fields")
+	}
+	if _, err := vault.Get(ctx, "secret/data/ci/dockerhub#token"); err == nil {
+		t.Error("expected an error for a missing field")
+	}
+	if _, err := (&Vault{Addr: server.URL}).Get(ctx, "kv/npm"); err == nil {
+		t.Error("expected an error without authentication")
+	}
+	if _, err := (&Vault{Addr: server.URL, RoleID: "role", SecretID: "wrong"}).Get(ctx, "kv/npm"); err == nil {
+		t.Error("expected a login error")
+	}
+}
+
+type staticProvider map[string]string
+
+func (p staticProvider) Get(ctx context.Context, ref string) (string, error) {
+	return p[ref], nil
+}
+
+func TestResolver(t *testing.T) {
+	resolver := Resolver{"static": staticProvider{"ci/token": "secret"}}
+	if got, err := resolver.Resolve(context.Background(), "static:ci/token"); err != nil || got != "secret" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	for _, ref := range []string{"ci/token", "static:", "vault:ci/token"} {
+		if _, err := resolver.Resolve(context.Background(), ref); err == nil {
+			t.Errorf("%s: expected an error", ref)
+		}
+	}
+}
+
+func TestParseMappings(t *testing.T) {
+	got, err := ParseMappings([]string{"PLUGIN_PASSWORD=secret/data/ci#password", "NPM_TOKEN=ssm:/ci/npm"}, "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Mapping{
+		{Name: "PLUGIN_PASSWORD", Ref: "vault:secret/data/ci#password"},
+		{Name: "NPM_TOKEN", Ref: "ssm:/ci/npm"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mappings mismatch (-want +got):\n%s", diff)
+	}
+	// a secret URL of a key vault is not a scheme of a store
+	got, err = ParseMappings([]string{"NAME=https://x.vault.azure.net/secrets/n"}, "azurekv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]Mapping{{Name: "NAME", Ref: "azurekv:https://x.vault.azure.net/secrets/n"}}, got); diff != "" {
+		t.Errorf("mappings mismatch (-want +got):\n%s", diff)
+	}
+	// without a default scheme references are kept as is
+	if got, _ := ParseMappings([]string{"NAME=other:npm"}, ""); got[0].Ref != "other:npm" {
+		t.Errorf("expected the reference kept, got %q", got[0].Ref)
+	}
+	if _, err := ParseMappings([]string{"secret/data/ci"}, "vault"); err == nil {
+		t.Error("expected an error without a name")
+	}
+}
@@ -0,0 +1,167 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultKubernetesTokenPath is the service account token of the pod, used
+// to log in with the Kubernetes auth method.
+const DefaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// Vault reads secrets from HashiCorp Vault. It authenticates with the token
+// when set, otherwise with AppRole when the role id is set, otherwise with
+// the Kubernetes auth method when the Kubernetes role is set.
+//
+// References have the form path#field, e.g. secret/data/ci/dockerhub#password
+// for a KV version 2 engine mounted at secret. The field may be omitted for
+// secrets with a single field.
+type Vault struct {
+	Addr      string
+	Namespace string // Enterprise namespace
+	Token     string
+
+	RoleID   string // AppRole role id
+	SecretID string // AppRole secret id
+
+	KubernetesRole      string
+	KubernetesTokenPath string // defaults to DefaultKubernetesTokenPath
+
+	AuthPath string // Mount path of the auth method, defaults to approle or kubernetes
+	HTTP     *http.Client
+
+	once  sync.Once
+	token string
+	err   error
+}
+
+// Get implements Provider.
+func (v *Vault) Get(ctx context.Context, ref string) (string, error) {
+	path, name := field(ref)
+	token, err := v.login(ctx)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), token, nil, &out); err != nil {
+		return "", err
+	}
+	data := out.Data
+	// KV version 2 nests the secret in data.data, next to data.metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	if name == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("secret %s has %d fields, select one with %s#field", path, len(data), path)
+		}
+		for _, value := range data {
+			return fmt.Sprint(value), nil
+		}
+	}
+	value, ok := data[name]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", path, name)
+	}
+	return fmt.Sprint(value), nil
+}
+
+// login returns the client token, logging in once.
+func (v *Vault) login(ctx context.Context) (string, error) {
+	v.once.Do(func() {
+		var path string
+		var body map[string]string
+		switch {
+		case v.Token != "":
+			v.token = v.Token
+			return
+		case v.RoleID != "":
+			path = v.authPath("approle")
+			body = map[string]string{"role_id": v.RoleID, "secret_id": v.SecretID}
+		case v.KubernetesRole != "":
+			tokenPath := v.KubernetesTokenPath
+			if tokenPath == "" {
+				tokenPath = DefaultKubernetesTokenPath
+			}
+			jwt, err := ioutil.ReadFile(tokenPath)
+			if err != nil {
+				v.err = errors.Wrap(err, "failed to read the service account token")
+				return
+			}
+			path = v.authPath("kubernetes")
+			body = map[string]string{"role": v.KubernetesRole, "jwt": strings.TrimSpace(string(jwt))}
+		default:
+			v.err = fmt.Errorf("no vault token, approle role id or kubernetes role configured")
+			return
+		}
+		var out struct {
+			Auth struct {
+				ClientToken string `json:"client_token"`
+			} `json:"auth"`
+		}
+		if err := v.do(ctx, http.MethodPost, "/v1/auth/"+path+"/login", "", body, &out); err != nil {
+			v.err = errors.Wrap(err, "failed to log in to vault")
+			return
+		}
+		v.token = out.Auth.ClientToken
+	})
+	return v.token, v.err
+}
+
+func (v *Vault) authPath(method string) string {
+	if v.AuthPath != "" {
+		return strings.Trim(v.AuthPath, "/")
+	}
+	return method
+}
+
+func (v *Vault) do(ctx context.Context, method, path, token string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(v.Addr, "/")+path, &body)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+	client := v.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(res.Body).Decode(&failure)
+		if len(failure.Errors) > 0 {
+			return fmt.Errorf("%s %s: %s: %s", method, path, res.Status, strings.Join(failure.Errors, "; "))
+		}
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/contextsync"
+)
+
+// missingBatchSize is the number of chunk digests looked up per request.
+const missingBatchSize = 1000
+
+// Client submits builds to a server.
+type Client struct {
+	URL   string // Server address, e.g. https://builds.example.com
+	Token string // Bearer token of the server
+	HTTP  *http.Client
+}
+
+// UploadResult summarizes the upload of a context.
+type UploadResult struct {
+	ID             string // Id of the uploaded context
+	Chunks         int    // Chunks of the context
+	UploadedChunks int    // Chunks the server was missing
+	UploadedBytes  int64  // Size of the uploaded chunks
+}
+
+// UploadContext uploads the chunks of the scanned context the server is
+// missing, and the manifest of the context.
+func (c Client) UploadContext(ctx context.Context, snapshot *contextsync.Snapshot) (UploadResult, error) {
+	digests := snapshot.Manifest.Chunks()
+	result := UploadResult{Chunks: len(digests)}
+	for start := 0; start < len(digests); start += missingBatchSize {
+		end := start + missingBatchSize
+		if end > len(digests) {
+			end = len(digests)
+		}
+		var missing struct {
+			Missing []string `json:"missing"`
+		}
+		if err := c.do(ctx, http.MethodPost, "/contexts/missing", map[string][]string{"chunks": digests[start:end]}, http.StatusOK, &missing); err != nil {
+			return result, err
+		}
+		for _, digest := range missing.Missing {
+			chunk, err := snapshot.ReadChunk(digest)
+			if err != nil {
+				return result, err
+			}
+			if err := c.do(ctx, http.MethodPut, "/chunks/"+digest, chunk, http.StatusCreated, nil); err != nil {
+				return result, err
+			}
+			result.UploadedChunks++
+			result.UploadedBytes += int64(len(chunk))
+		}
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/contexts", snapshot.Manifest, http.StatusCreated, &created); err != nil {
+		return result, err
+	}
+	result.ID = created.ID
+	return result, nil
+}
+
+// Submit queues a build.
+func (c Client) Submit(ctx context.Context, req Request) (Build, error) {
+	var build Build
+	err := c.do(ctx, http.MethodPost, "/builds", req, http.StatusAccepted, &build)
+	return build, err
+}
+
+// Get returns the build with the id.
+func (c Client) Get(ctx context.Context, id string) (Build, error) {
+	var build Build
+	err := c.do(ctx, http.MethodGet, "/builds/"+id, nil, http.StatusOK, &build)
+	return build, err
+}
+
+// Logs copies the log of the build to w until the build finishes.
+func (c Client) Logs(ctx context.Context, id string, w io.Writer) error {
+	res, err := c.request(ctx, http.MethodGet, "/builds/"+id+"/logs", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return statusError(res)
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// do sends the request with body, raw when a byte slice and JSON encoded
+// otherwise, and decodes the response into out when set.
+func (c Client) do(ctx context.Context, method, path string, body interface{}, status int, out interface{}) error {
+	res, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != status {
+		return statusError(res)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (c Client) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	contentType := "application/json"
+	switch body := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(body)
+		contentType = "application/octet-stream"
+	default:
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(content)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func statusError(res *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	return fmt.Errorf("unexpected status %s from %s %s: %s", res.Status, res.Request.Method, res.Request.URL.Path, strings.TrimSpace(string(body)))
+}
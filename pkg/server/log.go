@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Log is a build log that can be followed while it is written.
+type Log struct {
+	mu      sync.Mutex
+	data    []byte
+	closed  bool
+	changed chan struct{}
+}
+
+// Write appends p to the log and wakes up followers.
+func (l *Log) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.data = append(l.data, p...)
+	l.notify()
+	return len(p), nil
+}
+
+// Close marks the log as complete.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.notify()
+	return nil
+}
+
+func (l *Log) notify() {
+	if l.changed != nil {
+		close(l.changed)
+		l.changed = nil
+	}
+}
+
+// Follow copies the log to w until it is closed or ctx is cancelled.
+func (l *Log) Follow(ctx context.Context, w io.Writer) error {
+	offset := 0
+	for {
+		l.mu.Lock()
+		chunk := l.data[offset:]
+		closed := l.closed
+		if l.changed == nil {
+			l.changed = make(chan struct{})
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		if len(chunk) > 0 {
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+			offset += len(chunk)
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		if closed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,463 @@
+// Package server runs builds submitted over HTTP. Builds are queued and run
+// one at a time, as kaniko builds in the root filesystem of the container.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/contextsync"
+)
+
+// Build states.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// RunFunc runs a build with the given command line flags in dir, the
+// uploaded context or an empty directory, writing its log to out.
+type RunFunc func(ctx context.Context, dir string, args []string, out io.Writer) error
+
+type (
+	// Request is the body of a build submission. Settings are keyed by
+	// the command line flag names.
+	Request struct {
+		Settings map[string]interface{} `json:"settings"`
+		Context  string                 `json:"context,omitempty"` // Uploaded context the build runs in
+	}
+
+	// Build describes a submitted build.
+	Build struct {
+		ID       string     `json:"id"`
+		Status   string     `json:"status"`
+		Error    string     `json:"error,omitempty"`
+		Created  time.Time  `json:"created"`
+		Started  *time.Time `json:"started,omitempty"`
+		Finished *time.Time `json:"finished,omitempty"`
+
+		args    []string
+		paths   []string
+		context string
+		log     *Log
+	}
+)
+
+// Server queues builds and serves the build API.
+type Server struct {
+	run   RunFunc
+	flags map[string]bool
+	paths map[string]bool
+	token string
+
+	mu        sync.Mutex
+	builds    map[string]*Build
+	queue     chan *Build
+	retention time.Duration
+
+	contexts contextsync.Store
+}
+
+// New returns a server running builds with run. Only the given flags are
+// accepted as settings. When token is set, requests must carry it as a
+// bearer token.
+func New(run RunFunc, flags []string, token string, queueSize int) *Server {
+	s := &Server{
+		run:    run,
+		flags:  map[string]bool{},
+		paths:  map[string]bool{},
+		token:  token,
+		builds: map[string]*Build{},
+		queue:  make(chan *Build, queueSize),
+	}
+	for _, flag := range flags {
+		s.flags[flag] = true
+	}
+	return s
+}
+
+// EnableContexts accepts build contexts uploaded to the content store in
+// dir, which builds run in.
+func (s *Server) EnableContexts(dir string) {
+	s.contexts = contextsync.Store(dir)
+}
+
+// SetPaths sets the flags naming files of the build. Their values must be
+// relative paths within the build context, or remote contexts, so builds
+// cannot read or write files of the server.
+func (s *Server) SetPaths(flags []string) {
+	for _, flag := range flags {
+		s.paths[flag] = true
+	}
+}
+
+// SetRetention sets how long finished builds and their logs are kept. They
+// are kept until the server stops when unset.
+func (s *Server) SetRetention(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention = d
+}
+
+// Start runs queued builds until ctx is cancelled.
+func (s *Server) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case build := <-s.queue:
+			s.runBuild(ctx, build)
+		}
+	}
+}
+
+func (s *Server) runBuild(ctx context.Context, build *Build) {
+	s.update(build, func(b *Build) {
+		now := time.Now()
+		b.Status = StatusRunning
+		b.Started = &now
+	})
+	err := s.runIn(ctx, build)
+	build.log.Close()
+	s.update(build, func(b *Build) {
+		now := time.Now()
+		b.Finished = &now
+		b.Status = StatusSucceeded
+		if err != nil {
+			b.Status = StatusFailed
+			b.Error = err.Error()
+		}
+	})
+}
+
+// runIn runs the build in its uploaded context, or in an empty directory
+// so relative paths never refer to files of the server.
+func (s *Server) runIn(ctx context.Context, build *Build) error {
+	dir, err := ioutil.TempDir("", "context-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if build.context != "" {
+		if err := s.contexts.Materialize(build.context, dir); err != nil {
+			return fmt.Errorf("failed to write the uploaded context: %s", err)
+		}
+	}
+	// uploaded contexts may hold links to any file of the server
+	for _, p := range build.paths {
+		if err := withinDir(dir, p); err != nil {
+			return err
+		}
+	}
+	return s.run(ctx, dir, build.args, build.log)
+}
+
+// Submit queues a build. It fails for unknown settings or a full queue.
+func (s *Server) Submit(req Request) (Build, error) {
+	args, err := s.Args(req.Settings)
+	if err != nil {
+		return Build{}, err
+	}
+	var paths []string
+	for name, value := range req.Settings {
+		if !s.paths[name] {
+			continue
+		}
+		local, err := localPaths(name, value)
+		if err != nil {
+			return Build{}, err
+		}
+		paths = append(paths, local...)
+	}
+	if req.Context != "" {
+		if s.contexts == "" {
+			return Build{}, fmt.Errorf("uploaded contexts are not enabled")
+		}
+		if _, ok := req.Settings["context"]; ok {
+			return Build{}, fmt.Errorf("the context setting cannot be used with an uploaded context")
+		}
+		if _, err := s.contexts.Manifest(req.Context); err != nil {
+			return Build{}, err
+		}
+	}
+	id, err := newID()
+	if err != nil {
+		return Build{}, err
+	}
+	build := &Build{ID: id, Status: StatusQueued, Created: time.Now(), args: args, paths: paths, context: req.Context, log: &Log{}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(build.Created)
+	select {
+	case s.queue <- build:
+	default:
+		return Build{}, errQueueFull
+	}
+	s.builds[id] = build
+	return *build, nil
+}
+
+// expire forgets the builds that finished before the retention period,
+// dropping their logs. The caller must hold s.mu.
+func (s *Server) expire(now time.Time) {
+	if s.retention <= 0 {
+		return
+	}
+	for id, build := range s.builds {
+		if build.Finished != nil && now.Sub(*build.Finished) > s.retention {
+			delete(s.builds, id)
+		}
+	}
+}
+
+// Get returns the build with the given id.
+func (s *Server) Get(id string) (Build, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	build, ok := s.builds[id]
+	if !ok {
+		return Build{}, false
+	}
+	return *build, true
+}
+
+func (s *Server) update(build *Build, fn func(*Build)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(build)
+}
+
+// Args converts settings into command line flags, sorted by name. Lists are
+// passed as repeated flags.
+func (s *Server) Args(settings map[string]interface{}) ([]string, error) {
+	var names []string
+	for name := range settings {
+		if !s.flags[name] {
+			return nil, fmt.Errorf("unknown setting %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		switch value := settings[name].(type) {
+		case []interface{}:
+			for _, item := range value {
+				arg, err := flagArg(name, item)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+			}
+		default:
+			arg, err := flagArg(name, value)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+	}
+	return args, nil
+}
+
+func flagArg(name string, value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string, bool, float64:
+		return fmt.Sprintf("--%s=%v", name, value), nil
+	default:
+		return "", fmt.Errorf("unsupported value for setting %q", name)
+	}
+}
+
+// remoteSchemes are the schemes of contexts the executor fetches itself.
+var remoteSchemes = []string{"git://", "gs://", "s3://", "http://", "https://"}
+
+// localPaths returns the local paths of a path setting, a comma separated
+// list. They must be relative and within the build context, other schemes
+// than those of remote contexts would read files of the server.
+func localPaths(name string, value interface{}) ([]string, error) {
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported value for setting %q", name)
+	}
+	var paths []string
+	for _, p := range strings.Split(text, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" || isRemote(p) {
+			continue
+		}
+		clean := path.Clean(p)
+		if strings.Contains(p, "://") || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("setting %q must be a path within the build context, got %q", name, p)
+		}
+		paths = append(paths, clean)
+	}
+	return paths, nil
+}
+
+func isRemote(p string) bool {
+	for _, scheme := range remoteSchemes {
+		if strings.HasPrefix(p, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinDir returns an error when the path relative to dir resolves to a
+// file outside of dir. Missing paths fail the build later.
+func withinDir(dir, p string) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(p)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s links to a file outside of the build context", p)
+	}
+	return nil
+}
+
+var errQueueFull = fmt.Errorf("the build queue is full")
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ServeHTTP serves the build API:
+//
+//	POST /builds            submit a build
+//	GET  /builds/{id}       build status
+//	GET  /builds/{id}/logs  build log, streamed until the build finishes
+//
+// and, when uploaded contexts are enabled:
+//
+//	POST /contexts/missing  chunks of the listed digests the store is missing
+//	PUT  /chunks/{digest}   upload a chunk
+//	POST /contexts          store the manifest of a context, returns its id
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "builds" && r.Method == http.MethodPost:
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+			return
+		}
+		build, err := s.Submit(req)
+		switch {
+		case err == errQueueFull:
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			writeJSON(w, http.StatusAccepted, build)
+		}
+	case s.contexts != "" && (parts[0] == "contexts" || parts[0] == "chunks"):
+		s.serveContexts(w, r, parts)
+	case len(parts) == 2 && parts[0] == "builds" && r.Method == http.MethodGet:
+		build, ok := s.Get(parts[1])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, build)
+	case len(parts) == 3 && parts[0] == "builds" && parts[2] == "logs" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		build, ok := s.builds[parts[1]]
+		s.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		build.log.Follow(r.Context(), w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveContexts serves the upload of contexts.
+func (s *Server) serveContexts(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 2 && parts[0] == "contexts" && parts[1] == "missing" && r.Method == http.MethodPost:
+		var req struct {
+			Chunks []string `json:"chunks"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+			return
+		}
+		missing, err := s.contexts.Missing(req.Chunks)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string][]string{"missing": missing})
+	case len(parts) == 2 && parts[0] == "chunks" && r.Method == http.MethodPut:
+		if err := s.contexts.PutChunk(parts[1], r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case len(parts) == 1 && parts[0] == "contexts" && r.Method == http.MethodPost:
+		var manifest contextsync.Manifest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&manifest); err != nil {
+			http.Error(w, fmt.Sprintf("invalid manifest: %s", err), http.StatusBadRequest)
+			return
+		}
+		id, err := s.contexts.PutManifest(manifest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// maxRequestSize limits the size of the manifests and chunk lists of
+// uploaded contexts.
+const maxRequestSize = 64 << 20
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/drone/drone-kaniko/pkg/contextsync"
+)
+
+func TestServer_Args(t *testing.T) {
+	s := New(nil, []string{"repo", "tags", "no-push", "cache-ttl"}, "", 1)
+	args, err := s.Args(map[string]interface{}{
+		"repo":      "example/app",
+		"tags":      []interface{}{"latest", "1.0"},
+		"no-push":   true,
+		"cache-ttl": float64(6),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"--cache-ttl=6", "--no-push=true", "--repo=example/app", "--tags=latest", "--tags=1.0"}
+	if diff := cmp.Diff(want, args); diff != "" {
+		t.Errorf("unexpected args (-want +got):\n%s", diff)
+	}
+
+	if _, err := s.Args(map[string]interface{}{"unknown": "x"}); err == nil {
+		t.Errorf("expected error for an unknown setting")
+	}
+	if _, err := s.Args(map[string]interface{}{"repo": map[string]interface{}{}}); err == nil {
+		t.Errorf("expected error for an unsupported value")
+	}
+}
+
+func TestServer_Retention(t *testing.T) {
+	s := New(nil, []string{"repo"}, "", 3)
+	s.SetRetention(time.Hour)
+	old, err := s.Submit(Request{Settings: map[string]interface{}{"repo": "example/app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent, err := s.Submit(Request{Settings: map[string]interface{}{"repo": "example/app"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.update(s.builds[old.ID], func(b *Build) {
+		finished := time.Now().Add(-2 * time.Hour)
+		b.Finished = &finished
+	})
+	s.update(s.builds[recent.ID], func(b *Build) {
+		finished := time.Now().Add(-time.Minute)
+		b.Finished = &finished
+	})
+
+	if _, err := s.Submit(Request{Settings: map[string]interface{}{"repo": "example/app"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get(old.ID); ok {
+		t.Errorf("expected the build finished before the retention period to be dropped")
+	}
+	if _, ok := s.Get(recent.ID); !ok {
+		t.Errorf("expected the recently finished build to be kept")
+	}
+}
+
+func TestServer_HTTP(t *testing.T) {
+	release := make(chan struct{})
+	run := func(ctx context.Context, dir string, args []string, out io.Writer) error {
+		fmt.Fprintf(out, "building %v\n", args)
+		<-release
+		if args[0] == "--repo=fail" {
+			return fmt.Errorf("build failed")
+		}
+		fmt.Fprintln(out, "done")
+		return nil
+	}
+	s := New(run, []string{"repo"}, "secret", 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Start(ctx)
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res, _ := http.Post(ts.URL+"/builds", "application/json", bytes.NewBufferString(`{}`))
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", res.StatusCode)
+	}
+
+	res = do("POST", "/builds", `{"settings":{"repo":"example/app"}}`)
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", res.StatusCode)
+	}
+	var build Build
+	json.NewDecoder(res.Body).Decode(&build)
+	res.Body.Close()
+
+	res = do("POST", "/builds", `{"settings":{"unknown":"x"}}`)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown setting, got %d", res.StatusCode)
+	}
+
+	// follow the log while the build runs
+	logs := make(chan string)
+	go func() {
+		res := do("GET", "/builds/"+build.ID+"/logs", "")
+		data, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		logs <- string(data)
+	}()
+	close(release)
+	if got := <-logs; got != "building [--repo=example/app]\ndone\n" {
+		t.Errorf("unexpected log %q", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for build.Status != StatusSucceeded && time.Now().Before(deadline) {
+		res = do("GET", "/builds/"+build.ID, "")
+		json.NewDecoder(res.Body).Decode(&build)
+		res.Body.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if build.Status != StatusSucceeded || build.Finished == nil {
+		t.Errorf("expected the build to succeed, got %+v", build)
+	}
+
+	res = do("GET", "/builds/missing", "")
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing build, got %d", res.StatusCode)
+	}
+}
+
+func TestServer_QueueFull(t *testing.T) {
+	s := New(nil, []string{"repo"}, "", 1)
+	if _, err := s.Submit(Request{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Submit(Request{}); err != errQueueFull {
+		t.Errorf("expected the queue to be full, got %v", err)
+	}
+}
+
+func TestServer_UploadContext(t *testing.T) {
+	src := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(src, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	built := make(chan string, 1)
+	run := func(ctx context.Context, dir string, args []string, out io.Writer) error {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "Dockerfile"))
+		built <- string(content)
+		return err
+	}
+	s := New(run, []string{"repo", "context"}, "secret", 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Start(ctx)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	client := Client{URL: ts.URL, Token: "secret"}
+
+	snapshot, err := contextsync.Scan(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UploadContext(ctx, snapshot); err == nil {
+		t.Errorf("expected error when uploaded contexts are not enabled")
+	}
+	s.EnableContexts(t.TempDir())
+	result, err := client.UploadContext(ctx, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ID == "" || result.UploadedChunks != 1 {
+		t.Errorf("expected the chunk uploaded, got %+v", result)
+	}
+	// the second upload finds the chunks in the store
+	if result, err = client.UploadContext(ctx, snapshot); err != nil || result.UploadedChunks != 0 {
+		t.Errorf("expected no chunks uploaded again, got %+v, %v", result, err)
+	}
+
+	if _, err := client.Submit(ctx, Request{Settings: map[string]interface{}{"context": "/src"}, Context: result.ID}); err == nil {
+		t.Errorf("expected error for a context setting with an uploaded context")
+	}
+	if _, err := client.Submit(ctx, Request{Context: strings.Repeat("0", 64)}); err == nil {
+		t.Errorf("expected error for a context that was not uploaded")
+	}
+	build, err := client.Submit(ctx, Request{Settings: map[string]interface{}{"repo": "example/app"}, Context: result.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-built; got != "FROM scratch\n" {
+		t.Errorf("expected the build to run in the uploaded context, got %q", got)
+	}
+	var log bytes.Buffer
+	if err := client.Logs(ctx, build.ID, &log); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for build.Status != StatusSucceeded && time.Now().Before(deadline) {
+		if build, err = client.Get(ctx, build.ID); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if build.Status != StatusSucceeded {
+		t.Errorf("expected the build to succeed, got %+v", build)
+	}
+}
+
+func TestServer_Paths(t *testing.T) {
+	src := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(src, "Dockerfile"), []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := ioutil.WriteFile(outside, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(src, "Dockerfile.link")); err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan string, 1)
+	run := func(ctx context.Context, dir string, args []string, out io.Writer) error {
+		ran <- dir
+		return nil
+	}
+	s := New(run, []string{"context", "dockerfile"}, "", 1)
+	s.SetPaths([]string{"context", "dockerfile"})
+	s.EnableContexts(t.TempDir())
+	snapshot, err := contextsync.Scan(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	result, err := Client{URL: ts.URL}.UploadContext(context.Background(), snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, settings := range []map[string]interface{}{
+		{"dockerfile": "/etc/passwd"},
+		{"dockerfile": "Dockerfile,../Dockerfile"},
+		{"context": "dir:///etc"},
+		{"context": "tar:///var/lib/context.tar.gz"},
+		{"dockerfile": true},
+	} {
+		if _, err := s.Submit(Request{Settings: settings}); err == nil {
+			t.Errorf("expected error for settings %v", settings)
+		}
+	}
+	for _, settings := range []map[string]interface{}{
+		{"context": "git://github.com/example/app.git"},
+		{"context": "s3://bucket/context.tar.gz", "dockerfile": "docker/Dockerfile"},
+	} {
+		if _, err := s.Submit(Request{Settings: settings}); err != nil {
+			t.Errorf("unexpected error for settings %v: %v", settings, err)
+		}
+		// builds without an uploaded context run in an empty directory
+		build := <-s.queue
+		s.runBuild(context.Background(), build)
+		if dir := <-ran; dir == "" {
+			t.Errorf("expected the build to run in a directory of its own")
+		}
+	}
+
+	build, err := s.Submit(Request{Settings: map[string]interface{}{"dockerfile": "Dockerfile.link"}, Context: result.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.runBuild(context.Background(), <-s.queue)
+	if got, _ := s.Get(build.ID); got.Status != StatusFailed || !strings.Contains(got.Error, "outside of the build context") {
+		t.Errorf("expected the build to fail for a link outside of the context, got %+v", got)
+	}
+	select {
+	case <-ran:
+		t.Error("expected the build not to run")
+	default:
+	}
+}
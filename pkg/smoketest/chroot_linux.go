@@ -0,0 +1,115 @@
+//go:build linux
+
+package smoketest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// runChroot runs argv in the root directory with the image environment.
+// /proc and /dev are mounted when permitted, as many programs need them.
+// The mounts are made in a private mount namespace of a dedicated thread,
+// which the command inherits, so they never reach the namespace of the
+// plugin. The chroot is not a sandbox: the command shares the network,
+// processes and users of the plugin.
+func runChroot(ctx context.Context, root string, cfg Config, argv []string) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if syscall.Gettid() == syscall.Getpid() {
+			// the main thread is never discarded, holding it makes the
+			// runtime pick another one
+			errc <- runChroot(ctx, root, cfg, argv)
+			runtime.UnlockOSThread()
+			return
+		}
+		// the thread is discarded when the goroutine returns without
+		// unlocking it, together with its mount namespace
+		errc <- runInNamespace(ctx, root, cfg, argv)
+	}()
+	return <-errc
+}
+
+// runInNamespace runs argv in the root directory from a new mount namespace
+// of the calling thread, which must be locked.
+func runInNamespace(ctx context.Context, root string, cfg Config, argv []string) error {
+	mount := true
+	if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to create a mount namespace for the test, /proc and /dev are not mounted: %s\n", err)
+		mount = false
+	} else if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make the mounts of the test private: %s", err)
+	}
+	for _, m := range []struct {
+		source, target, fstype string
+		flags                  uintptr
+	}{
+		{source: "proc", target: "proc", fstype: "proc"},
+		{source: "/dev", target: "dev", flags: syscall.MS_BIND | syscall.MS_REC},
+	} {
+		if !mount {
+			break
+		}
+		// symlinks of the image are resolved within the root, so a
+		// mount never lands outside of it
+		target, err := resolveInRoot(root, m.target)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		if err := syscall.Mount(m.source, target, m.fstype, m.flags, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to mount /%s in the test root: %s\n", m.target, err)
+			continue
+		}
+		defer syscall.Unmount(target, syscall.MNT_DETACH)
+	}
+
+	binary, err := lookPath(root, argv[0], cfg.Env)
+	if err != nil {
+		return err
+	}
+	dir := cfg.WorkingDir
+	if dir == "" {
+		dir = "/"
+	}
+
+	cmd := exec.CommandContext(ctx, binary)
+	cmd.Args = argv
+	cmd.Dir = dir
+	cmd.Env = cfg.Env
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Chroot: root}
+	return cmd.Run()
+}
+
+// lookPath resolves the program in the PATH of the image environment,
+// returning its path inside the root.
+func lookPath(root, program string, env []string) (string, error) {
+	if strings.Contains(program, "/") {
+		return program, nil
+	}
+	search := "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") {
+			search = strings.TrimPrefix(kv, "PATH=")
+		}
+	}
+	for _, dir := range filepath.SplitList(search) {
+		candidate := path.Join(dir, program)
+		if info, err := os.Stat(filepath.Join(root, candidate)); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in the image PATH %s", program, search)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package smoketest
+
+import (
+	"context"
+	"fmt"
+)
+
+func runChroot(ctx context.Context, root string, cfg Config, argv []string) error {
+	return fmt.Errorf("the built-in test runner is only supported on linux, set a test runner command instead")
+}
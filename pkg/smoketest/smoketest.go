@@ -0,0 +1,113 @@
+// Package smoketest runs a command in a built image before it is pushed.
+package smoketest
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Runner runs the test command in the image saved in the tarball.
+type Runner interface {
+	Run(ctx context.Context, tarball string, args []string) error
+}
+
+// CommandRunner delegates to a user provided shell command, for example one
+// loading the tarball into a container runtime. The tarball path and the test
+// command are passed in the IMAGE_TARBALL and TEST_COMMAND variables.
+type CommandRunner struct {
+	Command string
+}
+
+// Run runs the command with /bin/sh.
+func (r CommandRunner) Run(ctx context.Context, tarball string, args []string) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", r.Command)
+	cmd.Env = append(os.Environ(), "IMAGE_TARBALL="+tarball, "TEST_COMMAND="+strings.Join(args, " "))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// ChrootRunner unpacks the image below Dir and runs the entrypoint with the
+// test command as arguments in a chroot, as docker run <image> <args> runs
+// it. Unlike a container, the command shares the network, processes and
+// users of the plugin, so only images the pipeline trusts are tested.
+type ChrootRunner struct {
+	Dir string
+}
+
+// Run unpacks the image and runs the command.
+func (r ChrootRunner) Run(ctx context.Context, tarball string, args []string) error {
+	root, err := ioutil.TempDir(r.Dir, "rootfs-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create image root directory")
+	}
+	defer os.RemoveAll(root)
+
+	cfg, err := Unpack(tarball, root)
+	if err != nil {
+		return err
+	}
+	argv := Command(cfg, args)
+	if len(argv) == 0 {
+		return fmt.Errorf("the image has no entrypoint or command to run")
+	}
+	return runChroot(ctx, root, cfg, argv)
+}
+
+// Command returns the command line run for the test arguments: the image
+// entrypoint followed by the arguments, or the image command without them.
+func Command(cfg Config, args []string) []string {
+	if len(args) == 0 {
+		args = cfg.Cmd
+	}
+	return append(append([]string(nil), cfg.Entrypoint...), args...)
+}
+
+// SplitArgs splits a command line into arguments, honouring single and
+// double quotes and backslash escapes.
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg, escaped := false, false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,134 @@
+package smoketest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		err  bool
+	}{
+		{in: "--version", want: []string{"--version"}},
+		{in: `sh -c "echo 'ok' && exit 0"`, want: []string{"sh", "-c", "echo 'ok' && exit 0"}},
+		{in: `a\ b 'c d' ""`, want: []string{"a b", "c d", ""}},
+		{in: `"unterminated`, err: true},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("SplitArgs(%q) error = %v", tt.in, err)
+			continue
+		}
+		if !cmp.Equal(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	cfg := Config{Entrypoint: []string{"/app"}, Cmd: []string{"serve"}}
+	if got := Command(cfg, nil); !cmp.Equal(got, []string{"/app", "serve"}) {
+		t.Errorf("unexpected default command %q", got)
+	}
+	if got := Command(cfg, []string{"--version"}); !cmp.Equal(got, []string{"/app", "--version"}) {
+		t.Errorf("unexpected test command %q", got)
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	base := layer(t, map[string]string{"etc/os-release": "alpine", "app/old": "old", "app/keep": "keep"})
+	top := layer(t, map[string]string{"app/.wh.old": "", "app/new": "new"})
+
+	tarball := filepath.Join(t.TempDir(), "image.tar")
+	writeTar(t, tarball, map[string][]byte{
+		"manifest.json": []byte(`[{"Config": "config.json", "Layers": ["base.tar.gz", "top.tar.gz"]}]`),
+		"config.json":   []byte(`{"config": {"Entrypoint": ["/app/new"], "WorkingDir": "/app"}}`),
+		"base.tar.gz":   base,
+		"top.tar.gz":    top,
+	})
+
+	root := t.TempDir()
+	cfg, err := Unpack(tarball, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.WorkingDir != "/app" || !cmp.Equal(cfg.Entrypoint, []string{"/app/new"}) {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	for name, want := range map[string]bool{"etc/os-release": true, "app/keep": true, "app/new": true, "app/old": false} {
+		_, err := os.Stat(filepath.Join(root, name))
+		if got := err == nil; got != want {
+			t.Errorf("%s exists = %v, want %v", name, got, want)
+		}
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(root, "app/new")); string(content) != "new" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func layer(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func writeTar(t *testing.T, file string, entries map[string][]byte) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for name, content := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(content)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveInRoot(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "usr/lib"), 0755)
+	os.Symlink("/etc", filepath.Join(root, "escape"))
+	os.Symlink("usr/lib", filepath.Join(root, "lib"))
+	os.Symlink("../../..", filepath.Join(root, "usr/lib/up"))
+
+	tests := map[string]string{
+		"escape/passwd":  "etc/passwd",
+		"lib/libc.so":    "usr/lib/libc.so",
+		"usr/lib/up/etc": "etc",
+		"../../tmp":      "tmp",
+	}
+	for name, want := range tests {
+		got, err := resolveInRoot(root, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(root, want); got != want {
+			t.Errorf("resolveInRoot(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package smoketest
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// Config is the subset of the image config needed to run the image.
+type Config struct {
+	Entrypoint []string
+	Cmd        []string
+	Env        []string
+	WorkingDir string
+}
+
+// Unpack extracts the filesystem of the image in a docker save formatted
+// tarball into dir, applying layer whiteouts, and returns the image config.
+func Unpack(tarball, dir string) (Config, error) {
+	var entries []struct {
+		Config string
+		Layers []string
+	}
+	if err := readEntry(tarball, "manifest.json", func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&entries)
+	}); err != nil {
+		return Config{}, err
+	}
+	if len(entries) == 0 {
+		return Config{}, fmt.Errorf("image tarball %s does not contain an image", tarball)
+	}
+
+	var cfg struct {
+		Config Config `json:"config"`
+	}
+	if err := readEntry(tarball, entries[0].Config, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&cfg)
+	}); err != nil {
+		return Config{}, err
+	}
+
+	for _, layer := range entries[0].Layers {
+		if err := readEntry(tarball, layer, func(r io.Reader) error {
+			gz, err := gzip.NewReader(r)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			return extractLayer(gz, dir)
+		}); err != nil {
+			return Config{}, errors.Wrap(err, fmt.Sprintf("failed to extract layer %s", layer))
+		}
+	}
+	return cfg.Config, nil
+}
+
+// extractLayer extracts a layer tar stream into dir.
+func extractLayer(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// resolve the parent directory within dir, so symlinks in the image
+		// cannot redirect writes outside of it
+		name := path.Clean("/" + hdr.Name)
+		base := path.Base(name)
+		parent, err := resolveInRoot(dir, path.Dir(name))
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(parent, base)
+		switch {
+		case base == whiteoutOpaque:
+			children, _ := os.ReadDir(parent)
+			for _, child := range children {
+				os.RemoveAll(filepath.Join(parent, child.Name()))
+			}
+			continue
+		case strings.HasPrefix(base, whiteoutPrefix):
+			os.RemoveAll(filepath.Join(parent, strings.TrimPrefix(base, whiteoutPrefix)))
+			continue
+		}
+
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			os.RemoveAll(target)
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			os.RemoveAll(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			os.RemoveAll(target)
+			source, err := resolveInRoot(dir, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resolveInRoot resolves name to a path below root, following symlinks as if
+// root was the filesystem root.
+func resolveInRoot(root, name string) (string, error) {
+	resolved := "/"
+	remaining := strings.Split(path.Clean("/"+name), "/")
+	for links := 0; len(remaining) > 0; {
+		part := remaining[0]
+		remaining = remaining[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		link, err := os.Readlink(filepath.Join(root, filepath.FromSlash(next)))
+		if err != nil {
+			// not a symlink, or not created yet
+			resolved = next
+			continue
+		}
+		if links++; links > 255 {
+			return "", fmt.Errorf("too many symlinks resolving %s", name)
+		}
+		if path.IsAbs(link) {
+			resolved = "/"
+		}
+		remaining = append(strings.Split(link, "/"), remaining...)
+	}
+	return filepath.Join(root, filepath.FromSlash(resolved)), nil
+}
+
+// readEntry calls fn with the named entry of the tarball.
+func readEntry(tarball, name string, fn func(io.Reader) error) error {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("image tarball %s does not contain %s", tarball, name)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read image tarball")
+		}
+		if path.Clean(hdr.Name) == path.Clean(name) {
+			return fn(tr)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package snapshot
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mountInfoPath lists the mounts of the plugin process.
+var mountInfoPath = "/proc/self/mountinfo"
+
+// MountPoints returns the mount points of the plugin process other than the
+// root, e.g. the workspace, mounted secrets and the files the runtime binds
+// into the container, which kaniko leaves out of the image as well. It
+// returns nothing when the mounts cannot be read.
+func MountPoints() []string {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	points, _ := parseMountInfo(f)
+	return points
+}
+
+// parseMountInfo returns the mount points listed in mountinfo format, the
+// fifth field of each line with spaces, tabs, newlines and backslashes
+// escaped in octal.
+func parseMountInfo(r io.Reader) ([]string, error) {
+	var points []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		if point := unescapeOctal(fields[4]); point != "/" {
+			points = append(points, point)
+		}
+	}
+	return points, s.Err()
+}
+
+func unescapeOctal(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
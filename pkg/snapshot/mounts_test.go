@@ -0,0 +1,69 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMountPoints(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"etc/os-release", "run/secrets/token", "build cache/layer"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mountInfo := fmt.Sprintf(`22 1 0:21 / / rw,relatime - overlay overlay rw
+23 22 0:22 / %s rw,nosuid - tmpfs tmpfs rw
+24 22 8:1 /cache %s rw,relatime - ext4 /dev/sda1 rw
+`, filepath.Join(root, "run/secrets"), strings.Replace(filepath.Join(root, "build cache"), " ", `\040`, 1))
+	info := filepath.Join(t.TempDir(), "mountinfo")
+	if err := ioutil.WriteFile(info, []byte(mountInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { mountInfoPath = path }(mountInfoPath)
+	mountInfoPath = info
+
+	points := MountPoints()
+	want := []string{filepath.Join(root, "run/secrets"), filepath.Join(root, "build cache")}
+	if diff := cmp.Diff(want, points); diff != "" {
+		t.Errorf("mount points mismatch (-want +got):\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if _, err := Write(&buf, root, points); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if diff := cmp.Diff([]string{"etc/", "etc/os-release", "run/"}, names); diff != "" {
+		t.Errorf("entries mismatch (-want +got):\n%s", diff)
+	}
+}
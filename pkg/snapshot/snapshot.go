@@ -0,0 +1,186 @@
+// Package snapshot archives the filesystem a failed kaniko build left
+// behind. kaniko unpacks each stage into its own root filesystem, so after
+// a failing instruction the root holds exactly what the instruction saw.
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the entries of the image tarball.
+const (
+	layerName    = "layer.tar.gz"
+	configName   = "config.json"
+	manifestName = "manifest.json"
+)
+
+// Write writes a gzip compressed tar archive of the filesystem below root to
+// w and returns the digest of the uncompressed archive, the diff id of the
+// layer. The excluded paths, given as absolute paths, and sockets, devices
+// and pipes are left out; files that cannot be read are skipped.
+func Write(w io.Writer, root string, exclude []string) (string, error) {
+	zw := gzip.NewWriter(w)
+	h := sha256.New()
+	tw := tar.NewWriter(io.MultiWriter(zw, h))
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// unreadable directories are skipped
+			return nil
+		}
+		if excluded(path, exclude) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		return writeEntry(tw, path, filepath.ToSlash(rel), info)
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to archive the build filesystem")
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// excluded returns true if the path is one of the excluded paths or below.
+func excluded(path string, exclude []string) bool {
+	for _, e := range exclude {
+		e = filepath.Clean(e)
+		if path == e || strings.HasPrefix(path, e+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeEntry(tw *tar.Writer, path, rel string, info os.FileInfo) error {
+	var link string
+	switch mode := info.Mode(); {
+	case mode.IsRegular(), mode.IsDir():
+	case mode&os.ModeSymlink != 0:
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	var f *os.File
+	if info.Mode().IsRegular() {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil
+		}
+		defer f.Close()
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = rel
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Format = tar.FormatPAX
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if f != nil {
+		// a file shrinking while it is read fails the archive, a file
+		// growing is truncated to its size in the header
+		if _, err := io.CopyN(tw, f, hdr.Size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Image writes a docker save formatted image tarball to path holding the
+// layer as its only layer, which can be pulled and run to inspect the
+// snapshot.
+func Image(path, layer, diffID, platform string) error {
+	goos, goarch := "linux", "amd64"
+	if parts := strings.SplitN(platform, "/", 3); len(parts) >= 2 {
+		goos, goarch = parts[0], parts[1]
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": goarch,
+		"os":           goos,
+		"created":      time.Now().UTC(),
+		"config":       map[string]interface{}{"Cmd": []string{"/bin/sh"}},
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": []string{diffID}},
+	})
+	if err != nil {
+		return err
+	}
+	manifest, err := json.Marshal([]map[string]interface{}{
+		{"Config": configName, "RepoTags": nil, "Layers": []string{layerName}},
+	})
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	tw := tar.NewWriter(out)
+	for _, entry := range []struct {
+		name    string
+		content []byte
+	}{{configName, config}, {manifestName, manifest}} {
+		if err := tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content))}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.content); err != nil {
+			return err
+		}
+	}
+	if err := addFile(tw, layerName, layer); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// addFile adds the file to the tarball under the name.
+func addFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: info.Size()}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
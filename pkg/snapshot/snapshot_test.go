@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWrite(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"etc/os-release":        "ID=alpine\n",
+		"app/build.log":         "go: downloading\n",
+		"kaniko/executor":       "binary",
+		"workspace/src/main.go": "package main\n",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("/etc/os-release", filepath.Join(root, "app/release")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	diffID, err := Write(&buf, root, []string{filepath.Join(root, "kaniko"), filepath.Join(root, "workspace")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(layer); diffID != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Errorf("diff id %s is not the digest of the uncompressed layer", diffID)
+	}
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(layer))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	want := []string{"app/", "app/build.log", "app/release", "etc/", "etc/os-release"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("entries mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestImage(t *testing.T) {
+	dir := t.TempDir()
+	layer := filepath.Join(dir, "layer.tar.gz")
+	if err := ioutil.WriteFile(layer, []byte("layer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(dir, "image.tar")
+	if err := Image(image, layer, "sha256:abc", "linux/arm64"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries := map[string][]byte{}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[hdr.Name], _ = ioutil.ReadAll(tr)
+	}
+	var manifest []struct {
+		Config string
+		Layers []string
+	}
+	if err := json.Unmarshal(entries[manifestName], &manifest); err != nil || len(manifest) != 1 {
+		t.Fatalf("invalid manifest %s", entries[manifestName])
+	}
+	if string(entries[manifest[0].Layers[0]]) != "layer" {
+		t.Errorf("expected the layer in the image")
+	}
+	var config struct {
+		Architecture string
+		RootFS       struct {
+			DiffIDs []string `json:"diff_ids"`
+		}
+	}
+	if err := json.Unmarshal(entries[manifest[0].Config], &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Architecture != "arm64" || len(config.RootFS.DiffIDs) != 1 || config.RootFS.DiffIDs[0] != "sha256:abc" {
+		t.Errorf("unexpected config %s", entries[manifest[0].Config])
+	}
+}
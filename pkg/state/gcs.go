@@ -0,0 +1,201 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/drone/drone-kaniko/pkg/gcp"
+	"github.com/pkg/errors"
+)
+
+// DefaultGCSEndpoint is the Cloud Storage JSON API endpoint.
+const DefaultGCSEndpoint = "https://storage.googleapis.com"
+
+// GCS stores objects in a Cloud Storage bucket, with the default Google
+// credentials unless a token source is set.
+type GCS struct {
+	Bucket   string
+	Prefix   string
+	Endpoint string // defaults to DefaultGCSEndpoint
+	Tokens   gcp.TokenSource
+	HTTP     *http.Client
+}
+
+// Get reads the object.
+func (g GCS) Get(ctx context.Context, key string) ([]byte, error) {
+	name := objectKey(g.Prefix, key)
+	endpoint := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", g.endpoint(), url.PathEscape(g.Bucket), url.PathEscape(name))
+	res, err := g.do(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to read gs://%s/%s", g.Bucket, name))
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(res.Body)
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("failed to read gs://%s/%s: %s", g.Bucket, name, res.Status)
+	}
+}
+
+// Exists returns true if the object exists.
+func (g GCS) Exists(ctx context.Context, key string) (bool, error) {
+	name := objectKey(g.Prefix, key)
+	endpoint := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", g.endpoint(), url.PathEscape(g.Bucket), url.PathEscape(name))
+	res, err := g.do(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("failed to look up gs://%s/%s", g.Bucket, name))
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to look up gs://%s/%s: %s", g.Bucket, name, res.Status)
+	}
+}
+
+// Put writes the object, streaming the body.
+func (g GCS) Put(ctx context.Context, key string, body io.Reader) error {
+	name := objectKey(g.Prefix, key)
+	endpoint := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", g.endpoint(), url.PathEscape(g.Bucket), url.QueryEscape(name))
+	res, err := g.do(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to write gs://%s/%s", g.Bucket, name))
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to write gs://%s/%s: %s", g.Bucket, name, res.Status)
+	}
+	return nil
+}
+
+// Create writes the object, or returns ErrExists when it exists, with the
+// ifGenerationMatch=0 precondition. Its version is its generation.
+func (g GCS) Create(ctx context.Context, key string, body []byte) (string, error) {
+	generation, err := g.upload(ctx, key, body, "0")
+	if err == ErrChanged {
+		return "", ErrExists
+	}
+	return generation, err
+}
+
+// GetVersion reads the object and its generation.
+func (g GCS) GetVersion(ctx context.Context, key string) ([]byte, string, error) {
+	name := objectKey(g.Prefix, key)
+	endpoint := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", g.endpoint(), url.PathEscape(g.Bucket), url.PathEscape(name))
+	res, err := g.do(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, "", errors.Wrap(err, fmt.Sprintf("failed to read gs://%s/%s", g.Bucket, name))
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		data, err := ioutil.ReadAll(res.Body)
+		return data, res.Header.Get("X-Goog-Generation"), err
+	case http.StatusNotFound:
+		return nil, "", ErrNotFound
+	default:
+		return nil, "", fmt.Errorf("failed to read gs://%s/%s: %s", g.Bucket, name, res.Status)
+	}
+}
+
+// Replace writes the object with the ifGenerationMatch precondition.
+func (g GCS) Replace(ctx context.Context, key string, body []byte, version string) (string, error) {
+	return g.upload(ctx, key, body, version)
+}
+
+// upload writes the object if its generation matches, returning the new
+// generation.
+func (g GCS) upload(ctx context.Context, key string, body []byte, generation string) (string, error) {
+	name := objectKey(g.Prefix, key)
+	endpoint := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&ifGenerationMatch=%s&name=%s", g.endpoint(), url.PathEscape(g.Bucket), url.QueryEscape(generation), url.QueryEscape(name))
+	res, err := g.do(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("failed to write gs://%s/%s", g.Bucket, name))
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		var object struct {
+			Generation string `json:"generation"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&object); err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("failed to write gs://%s/%s", g.Bucket, name))
+		}
+		return object.Generation, nil
+	case http.StatusPreconditionFailed:
+		return "", ErrChanged
+	default:
+		return "", fmt.Errorf("failed to write gs://%s/%s: %s", g.Bucket, name, res.Status)
+	}
+}
+
+// Delete deletes the object with the ifGenerationMatch precondition, if it
+// exists.
+func (g GCS) Delete(ctx context.Context, key, version string) error {
+	name := objectKey(g.Prefix, key)
+	endpoint := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?ifGenerationMatch=%s", g.endpoint(), url.PathEscape(g.Bucket), url.PathEscape(name), url.QueryEscape(version))
+	res, err := g.do(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to delete gs://%s/%s", g.Bucket, name))
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusNoContent, http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusPreconditionFailed:
+		return ErrChanged
+	default:
+		return fmt.Errorf("failed to delete gs://%s/%s: %s", g.Bucket, name, res.Status)
+	}
+}
+
+func (g GCS) endpoint() string {
+	if g.Endpoint != "" {
+		return g.Endpoint
+	}
+	return DefaultGCSEndpoint
+}
+
+func (g GCS) do(ctx context.Context, method, endpoint string, body io.Reader) (*http.Response, error) {
+	header := http.Header{}
+	if body != nil {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	return g.doHeader(ctx, method, endpoint, body, header)
+}
+
+func (g GCS) doHeader(ctx context.Context, method, endpoint string, body io.Reader, header http.Header) (*http.Response, error) {
+	tokens := g.Tokens
+	if tokens == nil {
+		tokens = gcp.Credentials{}
+	}
+	token, err := tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	client := g.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,114 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// gcsChunkSize is the size of the parts of resumable uploads, a multiple of
+// the 256 KiB required by the API.
+var gcsChunkSize int64 = 16 << 20
+
+// gcsMaxRetries is the number of consecutive failed parts after which a
+// resumable upload is abandoned.
+const gcsMaxRetries = 5
+
+// putFile uploads the file in a resumable upload session: after a failed
+// part, the session is queried for the bytes already persisted and the
+// upload resumes from there instead of starting over.
+func (g GCS) putFile(ctx context.Context, key string, f *os.File, size int64) error {
+	name := objectKey(g.Prefix, key)
+	fail := func(err error) error {
+		return errors.Wrap(err, fmt.Sprintf("failed to write gs://%s/%s", g.Bucket, name))
+	}
+
+	endpoint := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s", g.endpoint(), url.PathEscape(g.Bucket), url.QueryEscape(name))
+	header := http.Header{}
+	header.Set("X-Upload-Content-Type", "application/octet-stream")
+	header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	res, err := g.doHeader(ctx, http.MethodPost, endpoint, nil, header)
+	if err != nil {
+		return fail(err)
+	}
+	res.Body.Close()
+	session := res.Header.Get("Location")
+	if res.StatusCode != http.StatusOK || session == "" {
+		return fail(fmt.Errorf("failed to start the upload session: %s", res.Status))
+	}
+
+	var offset int64
+	for retries := 0; ; {
+		end := offset + gcsChunkSize
+		if end > size {
+			end = size
+		}
+		header := http.Header{}
+		var body io.Reader
+		if end > offset {
+			header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, end-1, size))
+			body = io.NewSectionReader(f, offset, end-offset)
+		} else {
+			// an empty file, or querying the session after a failure
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		}
+		persisted, done, err := g.putPart(ctx, session, body, header)
+		if err == nil && done {
+			return nil
+		}
+		if err == nil && persisted > offset {
+			offset, retries = persisted, 0
+			continue
+		}
+		if retries++; retries > gcsMaxRetries {
+			if err == nil {
+				err = fmt.Errorf("the upload made no progress")
+			}
+			return fail(err)
+		}
+		if ctx.Err() != nil {
+			return fail(ctx.Err())
+		}
+		// resume from the bytes the session persisted
+		if persisted, done, qerr := g.putPart(ctx, session, nil, http.Header{"Content-Range": {fmt.Sprintf("bytes */%d", size)}}); qerr == nil {
+			if done {
+				return nil
+			}
+			offset = persisted
+		}
+	}
+}
+
+// putPart sends a part of a resumable upload, returning the number of bytes
+// persisted by the session, or done when the object is complete.
+func (g GCS) putPart(ctx context.Context, session string, body io.Reader, header http.Header) (int64, bool, error) {
+	res, err := g.doHeader(ctx, http.MethodPut, session, body, header)
+	if err != nil {
+		return 0, false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return 0, true, nil
+	case http.StatusPermanentRedirect:
+		// Range: bytes=0-<last persisted byte>, absent when nothing is persisted
+		r := strings.TrimPrefix(res.Header.Get("Range"), "bytes=0-")
+		if r == "" {
+			return 0, false, nil
+		}
+		last, err := strconv.ParseInt(r, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid range %q", res.Header.Get("Range"))
+		}
+		return last + 1, false, nil
+	default:
+		return 0, false, fmt.Errorf("%s", res.Status)
+	}
+}
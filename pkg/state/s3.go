@@ -0,0 +1,208 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
+)
+
+// S3 stores objects in an S3 bucket, with the default AWS credentials. The
+// region of the bucket is looked up unless set.
+type S3 struct {
+	Bucket   string
+	Prefix   string
+	Region   string
+	Endpoint string // Custom endpoint, e.g. of an S3 compatible store
+
+	once   sync.Once
+	client *s3.S3
+	err    error
+}
+
+func (s *S3) init(ctx context.Context) (*s3.S3, error) {
+	s.once.Do(func() {
+		config := aws.NewConfig()
+		if s.Endpoint != "" {
+			config = config.WithEndpoint(s.Endpoint).WithS3ForcePathStyle(true)
+		}
+		sess, err := session.NewSessionWithOptions(session.Options{
+			Config:            *config,
+			SharedConfigState: session.SharedConfigEnable,
+		})
+		if err != nil {
+			s.err = errors.Wrap(err, "failed to create aws session")
+			return
+		}
+		region := s.Region
+		if region == "" && s.Endpoint == "" {
+			if region, err = s3manager.GetBucketRegion(ctx, sess, s.Bucket, "us-east-1"); err != nil {
+				s.err = errors.Wrap(err, fmt.Sprintf("failed to find the region of bucket %s", s.Bucket))
+				return
+			}
+		}
+		if region == "" {
+			region = aws.StringValue(sess.Config.Region)
+		}
+		s.client = s3.New(sess, aws.NewConfig().WithRegion(region))
+	})
+	return s.client, s.err
+}
+
+// Get reads the object.
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	client, err := s.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(objectKey(s.Prefix, key)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to read s3://%s/%s", s.Bucket, objectKey(s.Prefix, key)))
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// Exists returns true if the object exists.
+func (s *S3) Exists(ctx context.Context, key string) (bool, error) {
+	client, err := s.init(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, err = client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(objectKey(s.Prefix, key)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("failed to look up s3://%s/%s", s.Bucket, objectKey(s.Prefix, key)))
+	}
+	return true, nil
+}
+
+// Put writes the object, uploading large bodies in parts.
+func (s *S3) Put(ctx context.Context, key string, body io.Reader) error {
+	client, err := s.init(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = s3manager.NewUploaderWithClient(client).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(objectKey(s.Prefix, key)),
+		Body:   body,
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to write s3://%s/%s", s.Bucket, objectKey(s.Prefix, key)))
+	}
+	return nil
+}
+
+// Create writes the object, or returns ErrExists when it exists, with the
+// If-None-Match conditional write. Its version is its ETag. S3 compatible
+// stores ignoring the conditional headers replace the object instead.
+func (s *S3) Create(ctx context.Context, key string, body []byte) (string, error) {
+	etag, err := s.put(ctx, key, body, "If-None-Match", "*")
+	if err == ErrChanged {
+		return "", ErrExists
+	}
+	return etag, err
+}
+
+// GetVersion reads the object and its ETag.
+func (s *S3) GetVersion(ctx context.Context, key string) ([]byte, string, error) {
+	client, err := s.init(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	out, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(objectKey(s.Prefix, key)),
+	})
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", errors.Wrap(err, fmt.Sprintf("failed to read s3://%s/%s", s.Bucket, objectKey(s.Prefix, key)))
+	}
+	defer out.Body.Close()
+	data, err := ioutil.ReadAll(out.Body)
+	return data, aws.StringValue(out.ETag), err
+}
+
+// Replace writes the object with the If-Match conditional write.
+func (s *S3) Replace(ctx context.Context, key string, body []byte, version string) (string, error) {
+	return s.put(ctx, key, body, "If-Match", version)
+}
+
+// put writes the object with the conditional header, returning its ETag.
+func (s *S3) put(ctx context.Context, key string, body []byte, header, value string) (string, error) {
+	client, err := s.init(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, out := client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(objectKey(s.Prefix, key)),
+		Body:   bytes.NewReader(body),
+	})
+	req.SetContext(ctx)
+	req.HTTPRequest.Header.Set(header, value)
+	err = req.Send()
+	if conditionFailed(err) {
+		return "", ErrChanged
+	}
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("failed to write s3://%s/%s", s.Bucket, objectKey(s.Prefix, key)))
+	}
+	return aws.StringValue(out.ETag), nil
+}
+
+// Delete deletes the object with the If-Match conditional delete, if it
+// exists.
+func (s *S3) Delete(ctx context.Context, key, version string) error {
+	client, err := s.init(ctx)
+	if err != nil {
+		return err
+	}
+	req, _ := client.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(objectKey(s.Prefix, key)),
+	})
+	req.SetContext(ctx)
+	req.HTTPRequest.Header.Set("If-Match", version)
+	err = req.Send()
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return nil
+	}
+	if conditionFailed(err) {
+		return ErrChanged
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to delete s3://%s/%s", s.Bucket, objectKey(s.Prefix, key)))
+	}
+	return nil
+}
+
+// conditionFailed returns true if the error is that of a failed conditional
+// request.
+func conditionFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && (aerr.Code() == "PreconditionFailed" || aerr.Code() == "ConditionalRequestConflict")
+}
@@ -0,0 +1,272 @@
+// Package state stores small objects, such as the history of previous
+// builds, in a directory, e.g. on a cache volume, or in an S3 or GCS bucket.
+package state
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when an object does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrExists is returned when an object to create exists already.
+var ErrExists = errors.New("already exists")
+
+// ErrChanged is returned when an object to replace or delete was written or
+// deleted since the version it was expected at.
+var ErrChanged = errors.New("changed concurrently")
+
+// Store reads and writes objects by key.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, body io.Reader) error
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// ExclusiveStore is implemented by stores writing objects conditionally,
+// e.g. for leases shared by concurrent builds. Versions identify the writes
+// of an object.
+type ExclusiveStore interface {
+	Store
+	// Create writes the object, or returns ErrExists when it exists. It
+	// returns the version written.
+	Create(ctx context.Context, key string, body []byte) (string, error)
+	// GetVersion reads the object and its version.
+	GetVersion(ctx context.Context, key string) ([]byte, string, error)
+	// Replace writes the object at version, or returns ErrChanged when it
+	// is no longer at that version. It returns the version written.
+	Replace(ctx context.Context, key string, body []byte, version string) (string, error)
+	// Delete deletes the object at version, or returns ErrChanged when it
+	// is at another version. Deleting a missing object succeeds.
+	Delete(ctx context.Context, key, version string) error
+}
+
+// resumable is implemented by stores resuming interrupted uploads of large
+// files.
+type resumable interface {
+	putFile(ctx context.Context, key string, f *os.File, size int64) error
+}
+
+// PutFile writes the file, resuming interrupted uploads when the store
+// supports it.
+func PutFile(ctx context.Context, store Store, key, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if r, ok := store.(resumable); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return r.putFile(ctx, key, f, info.Size())
+	}
+	return store.Put(ctx, key, f)
+}
+
+// Open returns the store at location: s3://bucket/prefix, gs://bucket/prefix
+// or a directory.
+func Open(location string) (Store, error) {
+	switch {
+	case strings.HasPrefix(location, "s3://"):
+		bucket, prefix := splitBucket(strings.TrimPrefix(location, "s3://"))
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid store %q, expected s3://bucket/prefix", location)
+		}
+		return &S3{Bucket: bucket, Prefix: prefix}, nil
+	case strings.HasPrefix(location, "gs://"):
+		bucket, prefix := splitBucket(strings.TrimPrefix(location, "gs://"))
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid store %q, expected gs://bucket/prefix", location)
+		}
+		return GCS{Bucket: bucket, Prefix: prefix}, nil
+	case strings.Contains(location, "://"):
+		return nil, fmt.Errorf("unsupported store %q, expected s3://, gs:// or a directory", location)
+	case location == "":
+		return nil, fmt.Errorf("store location must not be empty")
+	default:
+		return Dir(location), nil
+	}
+}
+
+func splitBucket(path string) (bucket, prefix string) {
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) == 2 {
+		prefix = strings.Trim(parts[1], "/")
+	}
+	return parts[0], prefix
+}
+
+// objectKey joins the prefix and the key.
+func objectKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// Dir stores objects as files in a directory.
+type Dir string
+
+// Get reads the object.
+func (d Dir) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Exists returns true if the object exists.
+func (d Dir) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(filepath.Join(string(d), filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put writes the object, replacing the file atomically.
+func (d Dir) Put(ctx context.Context, key string, body io.Reader) error {
+	path := filepath.Join(string(d), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".state-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Create writes the object, or returns ErrExists when the file exists.
+func (d Dir) Create(ctx context.Context, key string, body []byte) (string, error) {
+	path := filepath.Join(string(d), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return "", ErrExists
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return contentVersion(body), f.Close()
+}
+
+// GetVersion reads the object. Its version is the digest of its content.
+func (d Dir) GetVersion(ctx context.Context, key string) ([]byte, string, error) {
+	data, err := d.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentVersion(data), nil
+}
+
+// Replace writes the object if its content is still that of version, while
+// holding the mutex of the object.
+func (d Dir) Replace(ctx context.Context, key string, body []byte, version string) (string, error) {
+	unlock, err := d.lock(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if _, current, err := d.GetVersion(ctx, key); err == ErrNotFound || (err == nil && current != version) {
+		return "", ErrChanged
+	} else if err != nil {
+		return "", err
+	}
+	if err := d.Put(ctx, key, bytes.NewReader(body)); err != nil {
+		return "", err
+	}
+	return contentVersion(body), nil
+}
+
+// Delete deletes the file if its content is still that of version, while
+// holding the mutex of the object.
+func (d Dir) Delete(ctx context.Context, key, version string) error {
+	unlock, err := d.lock(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, current, err := d.GetVersion(ctx, key); err == ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	} else if current != version {
+		return ErrChanged
+	}
+	err = os.Remove(filepath.Join(string(d), filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// dirLockStale is the age of a mutex file left behind by a killed process,
+// after which it is removed.
+var dirLockStale = 30 * time.Second
+
+// lock takes the mutex of the object, a file created exclusively next to
+// it, as directories may be shared by builds on different hosts, e.g. on a
+// network volume.
+func (d Dir) lock(ctx context.Context, key string) (func(), error) {
+	path := filepath.Join(string(d), filepath.FromSlash(key)) + ".lock"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > dirLockStale {
+			os.Remove(path)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// contentVersion returns the version of an object identified by its
+// content.
+func contentVersion(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
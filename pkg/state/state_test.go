@@ -0,0 +1,260 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/gcp"
+)
+
+func TestOpen(t *testing.T) {
+	store, err := Open("s3://bucket/builds/")
+	if s, ok := store.(*S3); err != nil || !ok || s.Bucket != "bucket" || s.Prefix != "builds" {
+		t.Errorf("unexpected s3 store %#v, %v", store, err)
+	}
+	store, err = Open("gs://bucket")
+	if g, ok := store.(GCS); err != nil || !ok || g.Bucket != "bucket" || g.Prefix != "" {
+		t.Errorf("unexpected gcs store %#v, %v", store, err)
+	}
+	store, err = Open("/cache/state")
+	if d, ok := store.(Dir); err != nil || !ok || d != "/cache/state" {
+		t.Errorf("unexpected dir store %#v, %v", store, err)
+	}
+	for _, location := range []string{"", "s3://", "ftp://host/path"} {
+		if _, err := Open(location); err == nil {
+			t.Errorf("expected an error opening %q", location)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	ctx := context.Background()
+	store := Dir(t.TempDir())
+	if _, err := store.Get(ctx, "app/main.json"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	for _, value := range []string{"first", "second"} {
+		if err := store.Put(ctx, "app/main.json", strings.NewReader(value)); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := store.Get(ctx, "app/main.json"); err != nil || string(data) != value {
+			t.Errorf("got %q, %v, want %q", data, err, value)
+		}
+	}
+}
+
+func TestDir_Create(t *testing.T) {
+	ctx := context.Background()
+	store := Dir(t.TempDir())
+	first, err := store.Create(ctx, "locks/app.json", []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(ctx, "locks/app.json", []byte("second")); err != ErrExists {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+	if data, version, err := store.GetVersion(ctx, "locks/app.json"); err != nil || string(data) != "first" || version != first {
+		t.Errorf("got %q at %s, %v, want %q at %s", data, version, err, "first", first)
+	}
+
+	second, err := store.Replace(ctx, "locks/app.json", []byte("second"), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Replace(ctx, "locks/app.json", []byte("third"), first); err != ErrChanged {
+		t.Errorf("expected ErrChanged replacing an outdated version, got %v", err)
+	}
+	if err := store.Delete(ctx, "locks/app.json", first); err != ErrChanged {
+		t.Errorf("expected ErrChanged deleting an outdated version, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Delete(ctx, "locks/app.json", second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Replace(ctx, "locks/app.json", []byte("third"), second); err != ErrChanged {
+		t.Errorf("expected ErrChanged replacing a deleted object, got %v", err)
+	}
+	if _, err := store.Create(ctx, "locks/app.json", []byte("second")); err != nil {
+		t.Errorf("expected the object to be created after deleting it, got %v", err)
+	}
+}
+
+type staticToken string
+
+func (s staticToken) Token(context.Context) (gcp.Token, error) {
+	return gcp.Token{AccessToken: string(s)}, nil
+}
+
+func TestGCS(t *testing.T) {
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+			body, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Query().Get("name")] = string(body)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+			value, ok := objects[strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(value))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store := GCS{Bucket: "bucket", Prefix: "builds", Endpoint: server.URL, Tokens: staticToken("secret")}
+	if _, err := store.Get(ctx, "app/main.json"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if err := store.Put(ctx, "app/main.json", strings.NewReader("state")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objects["builds/app/main.json"]; !ok {
+		t.Errorf("expected the object under the prefix, got %v", objects)
+	}
+	if data, err := store.Get(ctx, "app/main.json"); err != nil || string(data) != "state" {
+		t.Errorf("got %q, %v", data, err)
+	}
+}
+
+func TestGCS_Create(t *testing.T) {
+	type object struct {
+		content    string
+		generation int
+	}
+	objects := map[string]object{}
+	generation := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		match := r.URL.Query().Get("ifGenerationMatch")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+			name := r.URL.Query().Get("name")
+			if match != "" && match != fmt.Sprint(objects[name].generation) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			generation++
+			objects[name] = object{string(body), generation}
+			fmt.Fprintf(w, `{"generation": "%d"}`, generation)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+			o, ok := objects[strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("X-Goog-Generation", fmt.Sprint(o.generation))
+			w.Write([]byte(o.content))
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/storage/v1/b/bucket/o/"):
+			name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/bucket/o/")
+			o, ok := objects[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if match != "" && match != fmt.Sprint(o.generation) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			delete(objects, name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	store := GCS{Bucket: "bucket", Endpoint: server.URL, Tokens: staticToken("secret")}
+	first, err := store.Create(ctx, "lock.json", []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(ctx, "lock.json", []byte("second")); err != ErrExists {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+	if data, version, err := store.GetVersion(ctx, "lock.json"); err != nil || string(data) != "first" || version != first {
+		t.Errorf("got %q at %s, %v, want %q at %s", data, version, err, "first", first)
+	}
+	second, err := store.Replace(ctx, "lock.json", []byte("second"), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Replace(ctx, "lock.json", []byte("third"), first); err != ErrChanged {
+		t.Errorf("expected ErrChanged replacing an outdated generation, got %v", err)
+	}
+	if err := store.Delete(ctx, "lock.json", first); err != ErrChanged {
+		t.Errorf("expected ErrChanged deleting an outdated generation, got %v", err)
+	}
+	if objects["lock.json"].content != "second" {
+		t.Errorf("expected the object to be kept, got %q", objects["lock.json"].content)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Delete(ctx, "lock.json", second); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGCS_putFile(t *testing.T) {
+	saved := gcsChunkSize
+	gcsChunkSize = 4
+	defer func() { gcsChunkSize = saved }()
+
+	var persisted []byte
+	failed := false
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "resumable":
+			w.Header().Set("Location", server.URL+"/session")
+		case r.Method == http.MethodPut && r.URL.Path == "/session":
+			body, _ := ioutil.ReadAll(r.Body)
+			if len(body) > 0 && len(persisted) == 4 && !failed {
+				// the second part fails once
+				failed = true
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			persisted = append(persisted, body...)
+			if len(persisted) == 10 {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			if len(persisted) > 0 {
+				w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(persisted)-1))
+			}
+			w.WriteHeader(http.StatusPermanentRedirect)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "context.tar.gz")
+	if err := ioutil.WriteFile(path, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := GCS{Bucket: "bucket", Endpoint: server.URL, Tokens: staticToken("secret")}
+	if err := PutFile(context.Background(), store, "context.tar.gz", path); err != nil {
+		t.Fatal(err)
+	}
+	if !failed || string(persisted) != "0123456789" {
+		t.Errorf("got %q after a failed part (%v)", persisted, failed)
+	}
+}
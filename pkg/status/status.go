@@ -0,0 +1,183 @@
+// Package status publishes the result of a build as a commit status, or a
+// GitHub check run, of the commit the image was built from.
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Providers the status is published to.
+const (
+	ProviderGitHub = "github"
+	ProviderGitea  = "gitea"
+	ProviderGitLab = "gitlab"
+)
+
+// States of the published status.
+const (
+	StatePending = "pending"
+	StateSuccess = "success"
+	StateFailure = "failure"
+)
+
+const (
+	defaultContext   = "image"
+	defaultGitHubURL = "https://api.github.com"
+	defaultGitLabURL = "https://gitlab.com/api/v4"
+
+	// maxDescription is the longest description GitHub accepts.
+	maxDescription = 140
+)
+
+type (
+	// Config defines where the status is published.
+	Config struct {
+		Provider  string // github, gitea or gitlab
+		URL       string // API base URL, defaults to the public GitHub or GitLab API
+		Token     string // Token allowed to publish statuses of the repository
+		Repo      string // Repository, as owner/name
+		Commit    string // Commit sha the status is published for
+		Context   string // Name of the status, defaults to image
+		TargetURL string // Link of the status, e.g. the build page
+		CheckRun  bool   // Publish a GitHub check run instead of a commit status
+
+		HTTP *http.Client
+	}
+
+	// Status is the published build result.
+	Status struct {
+		State       string // pending, success or failure
+		Description string // One line description, e.g. the digest of the image
+		Summary     string // Markdown details shown on GitHub check runs
+	}
+)
+
+// Publish publishes the status of the commit.
+func Publish(ctx context.Context, cfg Config, s Status) error {
+	if cfg.Repo == "" || cfg.Commit == "" {
+		return fmt.Errorf("repository and commit must be specified to publish a status")
+	}
+	if cfg.CheckRun && cfg.Provider != "" && cfg.Provider != ProviderGitHub {
+		return fmt.Errorf("check runs are only supported by %s", ProviderGitHub)
+	}
+	if cfg.CheckRun && s.State == StatePending {
+		// check runs are created once, when the build completed
+		return nil
+	}
+	if cfg.Context == "" {
+		cfg.Context = defaultContext
+	}
+	if len(s.Description) > maxDescription {
+		s.Description = s.Description[:maxDescription-3] + "..."
+	}
+
+	var (
+		endpoint string
+		body     interface{}
+		header   = http.Header{}
+	)
+	switch cfg.Provider {
+	case "", ProviderGitHub:
+		base := strings.TrimSuffix(cfg.URL, "/")
+		if base == "" {
+			base = defaultGitHubURL
+		}
+		header.Set("Authorization", "Bearer "+cfg.Token)
+		header.Set("Accept", "application/vnd.github+json")
+		if cfg.CheckRun {
+			endpoint = fmt.Sprintf("%s/repos/%s/check-runs", base, cfg.Repo)
+			body = checkRun(cfg, s)
+		} else {
+			endpoint = fmt.Sprintf("%s/repos/%s/statuses/%s", base, cfg.Repo, cfg.Commit)
+			body = commitStatus(cfg, s)
+		}
+	case ProviderGitea:
+		if cfg.URL == "" {
+			return fmt.Errorf("status url must be specified for %s", ProviderGitea)
+		}
+		header.Set("Authorization", "token "+cfg.Token)
+		endpoint = fmt.Sprintf("%s/repos/%s/statuses/%s", strings.TrimSuffix(cfg.URL, "/"), cfg.Repo, cfg.Commit)
+		body = commitStatus(cfg, s)
+	case ProviderGitLab:
+		base := strings.TrimSuffix(cfg.URL, "/")
+		if base == "" {
+			base = defaultGitLabURL
+		}
+		header.Set("PRIVATE-TOKEN", cfg.Token)
+		endpoint = fmt.Sprintf("%s/projects/%s/statuses/%s", base, url.PathEscape(cfg.Repo), cfg.Commit)
+		state := s.State
+		if state == StateFailure {
+			state = "failed"
+		}
+		body = map[string]string{
+			"state":       state,
+			"name":        cfg.Context,
+			"target_url":  cfg.TargetURL,
+			"description": s.Description,
+		}
+	default:
+		return fmt.Errorf("unsupported status provider %q, expected %s, %s or %s", cfg.Provider, ProviderGitHub, ProviderGitea, ProviderGitLab)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	client := cfg.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		var out struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&out)
+		if out.Message != "" {
+			return fmt.Errorf("%s: %s", res.Status, out.Message)
+		}
+		return fmt.Errorf("%s", res.Status)
+	}
+	return nil
+}
+
+// commitStatus returns the commit status of GitHub and Gitea.
+func commitStatus(cfg Config, s Status) map[string]string {
+	return map[string]string{
+		"state":       s.State,
+		"context":     cfg.Context,
+		"target_url":  cfg.TargetURL,
+		"description": s.Description,
+	}
+}
+
+// checkRun returns the completed GitHub check run.
+func checkRun(cfg Config, s Status) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        cfg.Context,
+		"head_sha":    cfg.Commit,
+		"details_url": cfg.TargetURL,
+		"status":      "completed",
+		"conclusion":  s.State,
+		"output": map[string]string{
+			"title":   s.Description,
+			"summary": s.Summary,
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	type request struct {
+		path, auth string
+		body       map[string]interface{}
+	}
+	var got []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		auth := r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+		got = append(got, request{r.URL.EscapedPath(), auth, body})
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	cfg := Config{URL: server.URL, Token: "secret", Repo: "octocat/app", Commit: "abc123", TargetURL: "https://drone.example.com/octocat/app/1"}
+	success := Status{State: StateSuccess, Description: "octocat/app@sha256:def", Summary: "Pushed 1.0"}
+	tests := []struct {
+		provider string
+		checkRun bool
+		status   Status
+		want     request
+	}{
+		{ProviderGitHub, false, success, request{"/repos/octocat/app/statuses/abc123", "Bearer secret", map[string]interface{}{
+			"state": "success", "context": "image", "target_url": cfg.TargetURL, "description": "octocat/app@sha256:def",
+		}}},
+		{ProviderGitHub, true, success, request{"/repos/octocat/app/check-runs", "Bearer secret", map[string]interface{}{
+			"name": "image", "head_sha": "abc123", "details_url": cfg.TargetURL, "status": "completed", "conclusion": "success",
+			"output": map[string]interface{}{"title": "octocat/app@sha256:def", "summary": "Pushed 1.0"},
+		}}},
+		{ProviderGitea, false, Status{State: StatePending, Description: "Building"}, request{"/repos/octocat/app/statuses/abc123", "token secret", map[string]interface{}{
+			"state": "pending", "context": "image", "target_url": cfg.TargetURL, "description": "Building",
+		}}},
+		{ProviderGitLab, false, Status{State: StateFailure, Description: "auth"}, request{"/projects/octocat%2Fapp/statuses/abc123", "secret", map[string]interface{}{
+			"state": "failed", "name": "image", "target_url": cfg.TargetURL, "description": "auth",
+		}}},
+	}
+	for _, tt := range tests {
+		got = nil
+		cfg.Provider, cfg.CheckRun = tt.provider, tt.checkRun
+		if err := Publish(ctx, cfg, tt.status); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || !reflect.DeepEqual(got[0], tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.provider, got, tt.want)
+		}
+	}
+
+	got = nil
+	cfg.Provider, cfg.CheckRun = ProviderGitHub, true
+	if err := Publish(ctx, cfg, Status{State: StatePending}); err != nil || len(got) != 0 {
+		t.Errorf("expected no pending check run, got %v: %v", got, err)
+	}
+	cfg.Provider = ProviderGitLab
+	if err := Publish(ctx, cfg, success); err == nil {
+		t.Error("expected error for a gitlab check run")
+	}
+}
+
+func TestPublish_error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	}))
+	defer server.Close()
+	err := Publish(context.Background(), Config{URL: server.URL, Repo: "octocat/app", Commit: "abc123"}, Status{State: StateSuccess, Description: strings.Repeat("x", 200)})
+	if err == nil || !strings.Contains(err.Error(), "Not Found") {
+		t.Errorf("expected the api error, got %v", err)
+	}
+	if err := Publish(context.Background(), Config{Provider: ProviderGitea, Repo: "octocat/app", Commit: "abc123"}, Status{}); err == nil {
+		t.Error("expected error for gitea without url")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package sysinfo
+
+import "syscall"
+
+// Disk returns the usage of the filesystem holding path.
+func Disk(path string) (DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return DiskUsage{}, err
+	}
+	bsize := uint64(st.Bsize)
+	return DiskUsage{
+		Total: st.Blocks * bsize,
+		Free:  st.Bavail * bsize,
+		Used:  (st.Blocks - st.Bfree) * bsize,
+	}, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package sysinfo
+
+// Disk returns the usage of the filesystem holding path.
+func Disk(path string) (DiskUsage, error) {
+	return DiskUsage{}, ErrUnsupported
+}
@@ -0,0 +1,52 @@
+package sysinfo
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNoLimit is returned when the process memory is not limited.
+var ErrNoLimit = errors.New("memory is not limited")
+
+// unlimited is the cgroup v1 value reported when no limit is set, rounded
+// down to the page size.
+const unlimited = 1 << 62
+
+// cgroupRoot is where the cgroup filesystem is mounted.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// MemoryLimit returns the cgroup memory limit in bytes, reading the cgroup v2
+// memory.max and falling back to the cgroup v1 memory.limit_in_bytes.
+func MemoryLimit() (int64, error) {
+	return memoryLimit(cgroupRoot)
+}
+
+func memoryLimit(root string) (int64, error) {
+	files := []string{
+		filepath.Join(root, "memory.max"),
+		filepath.Join(root, "memory", "memory.limit_in_bytes"),
+	}
+	var err error
+	for _, file := range files {
+		var data []byte
+		if data, err = ioutil.ReadFile(file); err != nil {
+			continue
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "max" {
+			return 0, ErrNoLimit
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if limit >= unlimited {
+			return 0, ErrNoLimit
+		}
+		return limit, nil
+	}
+	return 0, err
+}
@@ -0,0 +1,46 @@
+package sysinfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		value string
+		limit int64
+		err   error
+	}{
+		{name: "v2", file: "memory.max", value: "1073741824\n", limit: 1 << 30},
+		{name: "v2 unlimited", file: "memory.max", value: "max\n", err: ErrNoLimit},
+		{name: "v1", file: "memory/memory.limit_in_bytes", value: "536870912\n", limit: 1 << 29},
+		{name: "v1 unlimited", file: "memory/memory.limit_in_bytes", value: "9223372036854771712\n", err: ErrNoLimit},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			file := filepath.Join(root, test.file)
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(file, []byte(test.value), 0644); err != nil {
+				t.Fatal(err)
+			}
+			limit, err := memoryLimit(root)
+			if err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if limit != test.limit {
+				t.Errorf("expected limit %d, got %d", test.limit, limit)
+			}
+		})
+	}
+
+	if _, err := memoryLimit(t.TempDir()); err == nil {
+		t.Errorf("expected error without cgroup files")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package sysinfo
+
+// KanikoDir is the directory kaniko keeps its state in.
+const KanikoDir = "/kaniko"
+
+// ExeSuffix is the suffix of executable files.
+const ExeSuffix = ""
@@ -0,0 +1,14 @@
+// Package sysinfo reports resources available to the build.
+package sysinfo
+
+import "errors"
+
+// ErrUnsupported is returned on platforms the information is not available on.
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// DiskUsage describes the filesystem holding a path.
+type DiskUsage struct {
+	Total uint64 // Total size in bytes
+	Free  uint64 // Bytes available to unprivileged users
+	Used  uint64 // Used bytes
+}
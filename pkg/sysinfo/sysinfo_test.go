@@ -0,0 +1,22 @@
+package sysinfo
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestDisk(t *testing.T) {
+	usage, err := Disk(t.TempDir())
+	if runtime.GOOS != "linux" {
+		if err != ErrUnsupported {
+			t.Errorf("expected ErrUnsupported, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Total == 0 || usage.Free > usage.Total || usage.Used > usage.Total {
+		t.Errorf("unexpected disk usage %+v", usage)
+	}
+}
@@ -0,0 +1,56 @@
+package tagger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultCalverTemplate tags images with the build date and number, e.g.
+// 2024.05.31-42.
+const DefaultCalverTemplate = `{{ .Time.Format "2006.01.02" }}{{ if .Build }}-{{ .Build }}{{ end }}`
+
+// CalverData is the data of calendar version templates.
+type CalverData struct {
+	Time   time.Time // Build time in the configured timezone
+	Build  string    // Build number
+	Commit string    // Commit sha
+	Branch string    // Commit branch
+}
+
+// ShortCommit returns the first 8 characters of the commit sha.
+func (d CalverData) ShortCommit() string {
+	if len(d.Commit) > 8 {
+		return d.Commit[:8]
+	}
+	return d.Commit
+}
+
+// Calver renders a calendar version tag from the template, the build time
+// being converted to the timezone, UTC if empty.
+func Calver(text, timezone string, data CalverData) (string, error) {
+	if text == "" {
+		text = DefaultCalverTemplate
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return "", fmt.Errorf("invalid calver timezone %q: %s", timezone, err)
+	}
+	data.Time = data.Time.In(loc)
+
+	tmpl, err := template.New("calver").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse calver template: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render calver template: %s", err)
+	}
+	tag := strings.TrimSpace(buf.String())
+	if tag == "" {
+		return "", fmt.Errorf("calver template %q renders an empty tag", text)
+	}
+	return tag, nil
+}
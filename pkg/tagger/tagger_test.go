@@ -4,7 +4,9 @@ package tagger
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_stripTagPrefix(t *testing.T) {
@@ -197,3 +199,63 @@ func TestUseAutoTag(t *testing.T) {
 		}
 	}
 }
+
+func TestNormalize(t *testing.T) {
+	var tests = []struct {
+		Before   []string
+		Sanitize bool
+		After    []string
+	}{
+		{[]string{"latest", "1.2", "latest"}, false, []string{"latest", "1.2"}},
+		{[]string{"1.2\n1.2.3\n", " "}, false, []string{"1.2", "1.2.3"}},
+		{[]string{"Feature/Login", "1.2.3+build"}, true, []string{"feature-login", "1.2.3-build"}},
+		{[]string{"-rc"}, true, []string{"rc"}},
+	}
+	for _, test := range tests {
+		got, err := Normalize(test.Before, test.Sanitize)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.After) {
+			t.Errorf("Got tags %v, want %v", got, test.After)
+		}
+	}
+
+	if _, err := Normalize([]string{"latest", "feature/login", ".hidden"}, false); err == nil {
+		t.Errorf("Expected an error for invalid tags")
+	} else if want := `invalid tags "feature/login", ".hidden"`; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Got error %q, want prefix %q", err, want)
+	}
+}
+
+func TestCalver(t *testing.T) {
+	data := CalverData{
+		Time:   time.Date(2024, 5, 31, 23, 30, 0, 0, time.UTC),
+		Build:  "42",
+		Commit: "0123456789abcdef",
+	}
+	var tests = []struct {
+		Template string
+		Timezone string
+		After    string
+	}{
+		{"", "", "2024.05.31-42"},
+		{"", "Asia/Tokyo", "2024.06.01-42"},
+		{`{{ .Time.Format "06.1.2" }}-{{ .ShortCommit }}`, "UTC", "24.5.31-01234567"},
+	}
+	for _, test := range tests {
+		got, err := Calver(test.Template, test.Timezone, data)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got != test.After {
+			t.Errorf("Got tag %s, want %s", got, test.After)
+		}
+	}
+
+	if _, err := Calver("", "Mars/Olympus", data); err == nil {
+		t.Errorf("Expected an error for an unknown timezone")
+	}
+}
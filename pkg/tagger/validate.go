@@ -0,0 +1,63 @@
+package tagger
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxTagLength is the longest tag allowed by the OCI distribution spec.
+const maxTagLength = 128
+
+// tagPattern is the tag grammar of the OCI distribution spec.
+var tagPattern = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+
+// invalidChars matches the characters not allowed in a tag.
+var invalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// Valid returns true if the tag matches the OCI reference grammar.
+func Valid(tag string) bool {
+	return tagPattern.MatchString(tag)
+}
+
+// Sanitize lowercases the tag and replaces the characters not allowed in a
+// tag with dashes, e.g. a branch name like feature/Login becomes
+// feature-login.
+func Sanitize(tag string) string {
+	tag = invalidChars.ReplaceAllString(strings.ToLower(tag), "-")
+	tag = strings.TrimLeft(tag, ".-")
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+	return tag
+}
+
+// Normalize splits the tags on whitespace, as in a .tags file with one tag
+// per line, drops empty and duplicate tags and, if sanitize is set,
+// sanitizes them. It fails listing the tags that are not valid.
+func Normalize(tags []string, sanitize bool) ([]string, error) {
+	var (
+		normalized []string
+		invalid    []string
+		seen       = map[string]bool{}
+	)
+	for _, entry := range tags {
+		for _, tag := range strings.Fields(entry) {
+			if sanitize {
+				tag = Sanitize(tag)
+			}
+			if !Valid(tag) {
+				invalid = append(invalid, fmt.Sprintf("%q", tag))
+				continue
+			}
+			if !seen[tag] {
+				seen[tag] = true
+				normalized = append(normalized, tag)
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("invalid tags %s: tags must match [a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}, set sanitize_tags to replace invalid characters", strings.Join(invalid, ", "))
+	}
+	return normalized, nil
+}
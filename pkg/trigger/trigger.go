@@ -0,0 +1,68 @@
+package trigger
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/git"
+)
+
+// Changed reports whether any file changed between the before and after
+// commits of the repository in dir matches one of the patterns. Files the
+// ignored func reports, e.g. files excluded from the build context, do not
+// count. The matching files are returned as well.
+func Changed(dir, before, after string, patterns []string, ignored func(file string) bool) (bool, []string, error) {
+	if before == "" || after == "" || strings.Trim(before, "0") == "" {
+		return false, nil, fmt.Errorf("commit range %q..%q cannot be compared", before, after)
+	}
+	out, err := git.Output(dir, "diff", "--name-only", before, after)
+	if err != nil {
+		return false, nil, err
+	}
+
+	var matched []string
+	for _, file := range strings.Split(out, "\n") {
+		if file == "" || (ignored != nil && ignored(file)) {
+			continue
+		}
+		for _, pattern := range patterns {
+			if Match(pattern, file) {
+				matched = append(matched, file)
+				break
+			}
+		}
+	}
+	return len(matched) > 0, matched, nil
+}
+
+// Match reports whether the slash separated file path matches the glob
+// pattern, where ** matches any number of directories.
+func Match(pattern, file string) bool {
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(file, "/"))
+}
+
+func matchSegments(pattern, file []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range file {
+				if matchSegments(pattern, file[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(file) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], file[0]); err != nil || !ok {
+			return false
+		}
+		pattern, file = pattern[1:], file[1:]
+	}
+	return len(file) == 0
+}
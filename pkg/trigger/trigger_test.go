@@ -0,0 +1,27 @@
+package trigger
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		file    string
+		want    bool
+	}{
+		{"services/api/**", "services/api/main.go", true},
+		{"services/api/**", "services/api/internal/handler.go", true},
+		{"services/api/**", "services/web/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "pkg/trigger/trigger.go", true},
+		{"**/*.go", "README.md", false},
+		{"Dockerfile", "Dockerfile", true},
+		{"Dockerfile", "docker/Dockerfile", false},
+		{"docker/*/Dockerfile", "docker/ecr/Dockerfile", true},
+		{"go.*", "go.sum", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.file); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.file, got, tt.want)
+		}
+	}
+}
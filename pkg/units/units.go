@@ -0,0 +1,57 @@
+package units
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var multipliers = map[string]float64{
+	"":    1,
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+// ParseSize parses a human readable size such as 500MB, 1.5GiB or 1024 into
+// bytes. Units are case insensitive; KB, MB, GB and TB are decimal while KiB,
+// MiB, GiB and TiB are binary.
+func ParseSize(s string) (int64, error) {
+	value := strings.TrimSpace(s)
+	i := len(value)
+	for i > 0 && (value[i-1] < '0' || value[i-1] > '9') && value[i-1] != '.' {
+		i--
+	}
+	number, unit := strings.TrimSpace(value[:i]), strings.ToUpper(strings.TrimSpace(value[i:]))
+
+	multiplier, ok := multipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// FormatSize formats bytes as a human readable decimal size.
+func FormatSize(bytes int64) string {
+	size := float64(bytes)
+	for _, unit := range []string{"B", "KB", "MB", "GB"} {
+		if size < 1000 && size > -1000 {
+			if unit == "B" {
+				return fmt.Sprintf("%d%s", bytes, unit)
+			}
+			return fmt.Sprintf("%.1f%s", size, unit)
+		}
+		size /= 1000
+	}
+	return fmt.Sprintf("%.1fTB", size)
+}
@@ -0,0 +1,45 @@
+package units
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+		err  bool
+	}{
+		{size: "1024", want: 1024},
+		{size: "500MB", want: 500000000},
+		{size: "500 mb", want: 500000000},
+		{size: "1.5GiB", want: 1610612736},
+		{size: "10KiB", want: 10240},
+		{size: "12XB", err: true},
+		{size: "MB", err: true},
+		{size: "", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.size)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseSize(%q) error = %v", tt.size, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		512:        "512B",
+		1500:       "1.5KB",
+		250000000:  "250.0MB",
+		3200000000: "3.2GB",
+		-2500:      "-2.5KB",
+	}
+	for bytes, want := range tests {
+		if got := FormatSize(bytes); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+}
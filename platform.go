@@ -0,0 +1,135 @@
+package kaniko
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/drone/drone-kaniko/pkg/registry"
+)
+
+// hostArch is the architecture the plugin runs on.
+var hostArch = runtime.GOARCH
+
+// platformOS lists the operating systems kaniko builds images for.
+var platformOS = map[string]bool{"linux": true, "windows": true, "wasi": true, "wasip1": true, "wasip2": true}
+
+// parsePlatform parses a platform in the form os/arch[/variant], normalized
+// as by registry.ParsePlatform, e.g. linux/arm64 for linux/aarch64.
+func parsePlatform(platform string) (os, arch, variant string, err error) {
+	p, err := registry.ParsePlatform(platform)
+	if err != nil {
+		return "", "", "", err
+	}
+	if !platformOS[p.OS] {
+		return "", "", "", fmt.Errorf("unsupported platform os %q, expected linux, windows or wasi", p.OS)
+	}
+	return p.OS, p.Architecture, p.Variant, nil
+}
+
+// hostPlatform returns the platform of the runner in the form
+// os/arch[/variant], reading the arm variant from the build settings.
+func hostPlatform() string {
+	platform := hostOS + "/" + hostArch
+	if hostArch == "arm" {
+		variant := "v7"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				if setting.Key == "GOARM" && setting.Value != "" {
+					variant = "v" + setting.Value
+				}
+			}
+		}
+		platform += "/" + variant
+	}
+	return platform
+}
+
+// detectPlatform sets the platform to the runner platform when it is not
+// set and the executor runs locally, so mixed-architecture runner fleets
+// build for an explicit platform that is recorded in the outputs.
+func (p *Plugin) detectPlatform() {
+	if p.Build.Platform != "" || p.Runner != nil {
+		return
+	}
+	if p.Backend.Name != "" && p.Backend.Name != BackendLocal {
+		return
+	}
+	p.Build.Platform = hostPlatform()
+	fmt.Fprintf(os.Stdout, "Building for the runner platform %s\n", p.Build.Platform)
+}
+
+// normalizePlatform validates the comma separated target platforms and
+// returns them normalized. Kaniko builds a single platform per step.
+func (b Build) normalizePlatform() (string, error) {
+	if b.Platform == "" {
+		return "", nil
+	}
+	var platforms []string
+	for _, platform := range strings.Split(b.Platform, ",") {
+		targetOS, arch, variant, err := parsePlatform(platform)
+		if err != nil {
+			return "", err
+		}
+		platforms = append(platforms, registry.Platform{OS: targetOS, Architecture: arch, Variant: variant}.String())
+	}
+	if len(platforms) > 1 && b.builder() == BuilderKaniko {
+		return "", fmt.Errorf("kaniko builds a single platform, got %s, build each platform in its own step", b.Platform)
+	}
+	return strings.Join(platforms, ","), nil
+}
+
+// checkPlatform validates the target platforms. Kaniko cannot execute
+// Windows binaries or WebAssembly modules, so Windows and WASI images can
+// only be assembled from instructions that do not run commands, such as
+// FROM, COPY and ENV.
+func (b Build) checkPlatform(remote bool) error {
+	if b.Platform == "" {
+		return nil
+	}
+	var noRun string
+	for _, platform := range strings.Split(b.Platform, ",") {
+		targetOS, _, _, err := parsePlatform(platform)
+		if err != nil {
+			return err
+		}
+		if targetOS != "linux" {
+			noRun = targetOS
+		}
+	}
+	if noRun == "" || remote {
+		return nil
+	}
+	f, err := os.Open(b.Dockerfile)
+	if err != nil {
+		// reported by the executor
+		return nil
+	}
+	defer f.Close()
+	if line := firstRun(f); line != 0 {
+		if noRun == "windows" {
+			return fmt.Errorf("%s:%d: RUN instructions cannot be executed when building windows images, run them in a windows build and copy the results", b.Dockerfile, line)
+		}
+		return fmt.Errorf("%s:%d: RUN instructions cannot be executed when building %s images, compile the module in an earlier build and copy it", b.Dockerfile, line, noRun)
+	}
+	return nil
+}
+
+// firstRun returns the line of the first RUN instruction in the Dockerfile,
+// or zero when there is none.
+func firstRun(r io.Reader) int {
+	instructions, err := dockerfile.Instructions(r)
+	if err != nil {
+		return 0
+	}
+	for _, inst := range instructions {
+		if inst.Cmd == "RUN" {
+			return inst.StartLine
+		}
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     string
+		wantErr  bool
+	}{
+		{platform: "linux/amd64", want: "linux amd64 "},
+		{platform: "linux/arm/v7", want: "linux arm v7"},
+		{platform: "windows/amd64", want: "windows amd64 "},
+		{platform: "linux/aarch64", want: "linux arm64 "},
+		{platform: "linux/arm", want: "linux arm v7"},
+		{platform: "wasi/wasm", want: "wasi wasm "},
+		{platform: "linux/wasm", wantErr: true},
+		{platform: "linux/amd64/v9", wantErr: true},
+		{platform: "darwin/arm64", wantErr: true},
+		{platform: "amd64", wantErr: true},
+		{platform: "linux/", wantErr: true},
+		{platform: "linux/arm/v7/extra", wantErr: true},
+	}
+	for _, tc := range tests {
+		os, arch, variant, err := parsePlatform(tc.platform)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parsePlatform(%s) error = %v, wantErr %v", tc.platform, err, tc.wantErr)
+			continue
+		}
+		if got := strings.Join([]string{os, arch, variant}, " "); !tc.wantErr && got != tc.want {
+			t.Errorf("parsePlatform(%s) = %q, want %q", tc.platform, got, tc.want)
+		}
+	}
+}
+
+func TestBuild_checkPlatform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "platform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	withRun := filepath.Join(dir, "Dockerfile.run")
+	ioutil.WriteFile(withRun, []byte("FROM mcr.microsoft.com/windows/nanoserver:ltsc2022\nCOPY app.exe C:/app/\n# RUN in a comment\nRUN app.exe --init\n"), 0644)
+	withoutRun := filepath.Join(dir, "Dockerfile.copy")
+	ioutil.WriteFile(withoutRun, []byte("FROM mcr.microsoft.com/windows/nanoserver:ltsc2022\nENV PATH=C:\\\\app \\\n  run=1\nCOPY app.exe C:/app/\n"), 0644)
+
+	tests := []struct {
+		name    string
+		build   Build
+		remote  bool
+		wantErr bool
+	}{
+		{name: "no platform", build: Build{Dockerfile: withRun}},
+		{name: "linux", build: Build{Platform: "linux/arm64", Dockerfile: withRun}},
+		{name: "windows with run", build: Build{Platform: "windows/amd64", Dockerfile: withRun}, wantErr: true},
+		{name: "windows without run", build: Build{Platform: "windows/amd64", Dockerfile: withoutRun}},
+		{name: "windows remote context", build: Build{Platform: "windows/amd64", Dockerfile: withRun}, remote: true},
+		{name: "invalid", build: Build{Platform: "plan9/386"}, wantErr: true},
+		{name: "wasi with run", build: Build{Platform: "wasi/wasm", Dockerfile: withRun}, wantErr: true},
+		{name: "wasi without run", build: Build{Platform: "wasi/wasm", Dockerfile: withoutRun}},
+		{name: "list with windows", build: Build{Platform: "linux/amd64,windows/amd64", Dockerfile: withRun}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.build.checkPlatform(tc.remote); (err != nil) != tc.wantErr {
+				t.Errorf("checkPlatform() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuild_normalizePlatform(t *testing.T) {
+	tests := []struct {
+		build   Build
+		want    string
+		wantErr bool
+	}{
+		{build: Build{}},
+		{build: Build{Platform: "linux/x86_64"}, want: "linux/amd64"},
+		{build: Build{Platform: "linux/arm64/v8"}, want: "linux/arm64"},
+		{build: Build{Platform: "WASI/wasm"}, want: "wasi/wasm"},
+		{build: Build{Platform: "linux/amd64,linux/aarch64", Builder: BuilderBuildKit}, want: "linux/amd64,linux/arm64"},
+		{build: Build{Platform: "linux/amd64,linux/arm64"}, wantErr: true},
+		{build: Build{Platform: "linux/arm/v9"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := tc.build.normalizePlatform()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("normalizePlatform(%s) error = %v, wantErr %v", tc.build.Platform, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("normalizePlatform(%s) = %q, want %q", tc.build.Platform, got, tc.want)
+		}
+	}
+}
+
+func TestPlugin_detectPlatform(t *testing.T) {
+	defer func(arch string) { hostArch = arch }(hostArch)
+	hostArch = "arm64"
+
+	tests := []struct {
+		name   string
+		plugin Plugin
+		want   string
+	}{
+		{name: "local", plugin: Plugin{}, want: hostOS + "/arm64"},
+		{name: "explicit", plugin: Plugin{Build: Build{Platform: "linux/amd64"}}, want: "linux/amd64"},
+		{name: "remote backend", plugin: Plugin{Backend: Backend{Name: BackendKubernetes}}},
+		{name: "custom runner", plugin: Plugin{Runner: &fakeRunner{}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.plugin.detectPlatform()
+			if tc.plugin.Build.Platform != tc.want {
+				t.Errorf("detectPlatform() = %q, want %q", tc.plugin.Build.Platform, tc.want)
+			}
+		})
+	}
+
+	hostArch = "arm"
+	if got := hostPlatform(); !strings.HasPrefix(got, hostOS+"/arm/v") {
+		t.Errorf("expected an arm variant, got %s", got)
+	}
+}
@@ -0,0 +1,71 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+)
+
+// applyPostLabels adds the post-build labels and annotations to the pushed
+// image, without rebuilding it, and pushes the changed manifest to each
+// tag. The digest file is updated with the new digest.
+func (p Plugin) applyPostLabels(ctx context.Context, tags []string) error {
+	if len(p.Build.PostLabels) == 0 && len(p.Build.PostAnnotations) == 0 || p.Build.NoPush || len(tags) == 0 {
+		return nil
+	}
+	labels, err := parseKeyValues("post label", p.Build.PostLabels)
+	if err != nil {
+		return err
+	}
+	annotations, err := parseKeyValues("post annotation", p.Build.PostAnnotations)
+	if err != nil {
+		return err
+	}
+
+	var refs []registry.Reference
+	for _, tag := range tags {
+		ref, err := registry.ParseReference(fmt.Sprintf("%s:%s", p.Build.Repo, tag))
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+	}
+	src := refs[0]
+	if digest := readDigest(p.Build.DigestFile); digest != "" {
+		src.Tag, src.Digest = "", digest
+	}
+
+	digest, err := p.Build.registryClient().Mutate(ctx, src, refs, registry.Mutation{Labels: labels, Annotations: annotations})
+	if err != nil {
+		return errors.Wrap(err, "failed to apply post-build labels")
+	}
+	fmt.Fprintf(os.Stdout, "Applied post-build labels to %s, new digest %s\n", p.Build.Repo, digest)
+
+	if p.Build.DigestFile != "" {
+		if err := ioutil.WriteFile(p.Build.DigestFile, []byte(digest), 0644); err != nil {
+			return errors.Wrap(err, "failed to write digest file")
+		}
+	}
+	// the digests recorded by kaniko are outdated, look them up instead
+	os.Remove(p.Build.imageTagDigestPath())
+	return nil
+}
+
+// parseKeyValues parses key=value pairs.
+func parseKeyValues(kind string, values []string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid %s %q, expected key=value", kind, value)
+		}
+		parsed[parts[0]] = parts[1]
+	}
+	return parsed, nil
+}
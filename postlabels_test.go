@@ -0,0 +1,31 @@
+package kaniko
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseKeyValues(t *testing.T) {
+	got, err := parseKeyValues("post label", []string{"build-url=https://drone.example.com/1?a=b", "approval="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"build-url": "https://drone.example.com/1?a=b", "approval": ""}; !cmp.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, value := range []string{"approval", "=id"} {
+		if _, err := parseKeyValues("post label", []string{value}); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestPlugin_applyPostLabels_noPush(t *testing.T) {
+	b := testBuild(t)
+	b.PostLabels = []string{"invalid"}
+	if err := New(b).applyPostLabels(context.Background(), []string{"latest"}); err != nil {
+		t.Errorf("expected post labels to be ignored without push, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+// defaultKanikoDir is the directory kaniko keeps its state in.
+const defaultKanikoDir = sysinfo.KanikoDir
+
+// Push permission checks performed before the build.
+const (
+	PushCheckKaniko = "kaniko" // Kaniko checks the destinations when it starts
+	PushCheckProbe  = "probe"  // The plugin probes the repositories, kaniko skips its check
+	PushCheckNone   = "none"   // Nothing is checked, permission errors surface when pushing
+)
+
+// preflight checks the executor can write its state, turning obscure kaniko
+// failures on hardened runners into actionable errors.
+func (b Build) preflight() error {
+	dir := b.kanikoDir()
+	uid := os.Getuid()
+
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		if err := checkWritable(dir); err != nil {
+			return fmt.Errorf("%s is not writable, running as uid %d: run the step as root or set PLUGIN_KANIKO_DIR to a writable directory", dir, uid)
+		}
+	}
+	if uid != 0 {
+		fmt.Fprintf(os.Stderr, "warning: running as uid %d, kaniko needs root to unpack base images; builds may fail with permission errors (check runAsNonRoot in the pod security context)\n", uid)
+	}
+	return nil
+}
+
+// kanikoDir returns the directory kaniko keeps its state in.
+func (b Build) kanikoDir() string {
+	if b.KanikoDir != "" {
+		return b.KanikoDir
+	}
+	return defaultKanikoDir
+}
+
+// checkWritable returns an error when files cannot be created in dir.
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".preflight-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// pushCheck returns the push permission check, defaulting to the probe when
+// ProbePush is set and to the check of kaniko otherwise.
+func (b Build) pushCheck() (string, error) {
+	switch b.PushPermissionCheck {
+	case "":
+		if b.ProbePush {
+			return PushCheckProbe, nil
+		}
+		return PushCheckKaniko, nil
+	case PushCheckKaniko, PushCheckProbe, PushCheckNone:
+		return b.PushPermissionCheck, nil
+	default:
+		return "", fmt.Errorf("unsupported push permission check %q, expected %s, %s or %s", b.PushPermissionCheck, PushCheckKaniko, PushCheckProbe, PushCheckNone)
+	}
+}
+
+// probePush checks the credentials may push to the repository, and to the
+// cache repository when caching, so that authentication and authorization
+// errors surface before a long build rather than when pushing.
+func (b Build) probePush(ctx context.Context) error {
+	repos := []string{b.Repo}
+	if b.EnableCache && b.CacheRepo != "" {
+		repos = append(repos, b.CacheRepo)
+	}
+	client := b.registryClient()
+	for _, repo := range repos {
+		ref, err := registry.ParseReference(repo)
+		if err != nil {
+			return err
+		}
+		if err := client.ProbePush(ctx, ref); err != nil {
+			return errors.Wrapf(err, "cannot push to %s, check the credentials and their permissions on the repository", repo)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "Push permission probe succeeded for %s\n", strings.Join(repos, ", "))
+	return nil
+}
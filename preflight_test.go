@@ -0,0 +1,119 @@
+package kaniko
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuild_preflight(t *testing.T) {
+	dir := t.TempDir()
+	if err := (Build{KanikoDir: dir}).preflight(); err != nil {
+		t.Errorf("unexpected error for writable dir: %s", err)
+	}
+
+	// a missing directory is created by kaniko
+	if err := (Build{KanikoDir: filepath.Join(dir, "missing")}).preflight(); err != nil {
+		t.Errorf("unexpected error for missing dir: %s", err)
+	}
+
+	if os.Getuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	readOnly := filepath.Join(dir, "ro")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := (Build{KanikoDir: readOnly}).preflight(); err == nil {
+		t.Errorf("expected error for read-only dir")
+	}
+}
+
+func TestBuild_probePush(t *testing.T) {
+	var probed []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/denied/blobs/uploads/":
+			w.WriteHeader(http.StatusForbidden)
+		case r.Method == http.MethodPost:
+			probed = append(probed, r.URL.Path)
+			w.Header().Set("Location", r.URL.Path+"1234")
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	b := Build{Repo: host.Host + "/app", EnableCache: true, CacheRepo: host.Host + "/cache", SkipTlsVerify: true, DockerConfigDir: t.TempDir()}
+	if err := b.probePush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(probed) != 2 || probed[0] != "/v2/app/blobs/uploads/" || probed[1] != "/v2/cache/blobs/uploads/" {
+		t.Errorf("unexpected probes %v", probed)
+	}
+
+	b.Repo = host.Host + "/denied"
+	if err := b.probePush(context.Background()); err == nil {
+		t.Error("expected error for a denied repository")
+	}
+
+	// an insecure cache registry is probed over http
+	var insecure []string
+	cache := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			insecure = append(insecure, r.URL.Path)
+			w.Header().Set("Location", r.URL.Path+"1234")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer cache.Close()
+	cacheHost, _ := url.Parse(cache.URL)
+	b.Repo = host.Host + "/app"
+	b.CacheRepo = cacheHost.Host + "/cache"
+	b.CacheInsecure = true
+	if err := b.probePush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(insecure) != 1 || insecure[0] != "/v2/cache/blobs/uploads/" {
+		t.Errorf("expected the cache repository probed over http, got %v", insecure)
+	}
+}
+
+func TestBuild_pushCheck(t *testing.T) {
+	tests := []struct {
+		build   Build
+		want    string
+		skipped bool
+	}{
+		{build: Build{}, want: PushCheckKaniko},
+		{build: Build{ProbePush: true}, want: PushCheckProbe, skipped: true},
+		{build: Build{PushPermissionCheck: PushCheckNone, ProbePush: true}, want: PushCheckNone, skipped: true},
+		{build: Build{PushPermissionCheck: PushCheckKaniko}, want: PushCheckKaniko},
+	}
+	for _, tt := range tests {
+		got, err := tt.build.pushCheck()
+		if err != nil || got != tt.want {
+			t.Errorf("%+v: got %q, %v, want %q", tt.build, got, err, tt.want)
+		}
+		args := Plugin{Build: tt.build}.kanikoArgs(buildInput{context: ".", tags: []string{"latest"}})
+		if contains(args, "--skip-push-permission-check") != tt.skipped {
+			t.Errorf("%+v: unexpected kaniko args %v", tt.build, args)
+		}
+	}
+
+	args := Plugin{Build: Build{PushPermissionCheck: PushCheckNone}}.kanikoArgs(buildInput{context: ".", noPush: true})
+	if contains(args, "--skip-push-permission-check") {
+		t.Errorf("unexpected skipped check without push: %v", args)
+	}
+	if _, err := (Build{PushPermissionCheck: "always"}).pushCheck(); err == nil {
+		t.Error("expected error for an unknown check")
+	}
+}
@@ -0,0 +1,46 @@
+package kaniko
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/diagnostics"
+	"github.com/drone/drone-kaniko/pkg/redact"
+)
+
+// minSecretLength is the length below which the values of variables named
+// like secrets are not masked, as they are rarely credentials but would mask
+// common words.
+const minSecretLength = 8
+
+// knownSecrets returns the credentials the build output is masked for: the
+// values of the environment variables named like secrets and the passwords
+// set in the build settings.
+func (b Build) knownSecrets() []string {
+	var secrets []string
+	add := func(value string) {
+		if len(value) >= minSecretLength && !contains(secrets, value) {
+			secrets = append(secrets, value)
+		}
+	}
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 && diagnostics.IsSensitive(parts[0]) {
+			add(parts[1])
+		}
+	}
+	add(b.NetrcPassword)
+	add(b.CachePassword)
+	if parts := strings.SplitN(b.HubPullCredentials, ":", 2); len(parts) == 2 {
+		add(parts[1])
+	}
+	return secrets
+}
+
+// redactOutput returns a writer masking the known credentials and the
+// redact patterns in the output written to w.
+func (b Build) redactOutput(w io.Writer, patterns []*regexp.Regexp) *redact.Writer {
+	return redact.NewWriter(w, diagnostics.Redacted, b.knownSecrets(), patterns)
+}
@@ -0,0 +1,47 @@
+package kaniko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/failure"
+)
+
+func TestPlugin_ExecRedactsOutput(t *testing.T) {
+	t.Setenv("PLUGIN_NETRC_PASSWORD", "hunter2hunter2")
+	b := testBuild(t)
+	b.RedactPatterns = []string{`acme_[A-Za-z0-9]+`}
+	b.ErrorSummaryFile = filepath.Join(t.TempDir(), "error.json")
+
+	runner := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		fmt.Fprintln(cmd.Stderr, "UNAUTHORIZED: authentication required for acme_Xy12 with hunter2hunter2")
+		return errors.New("exit status 1")
+	}}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); failure.ExitCode(err) != 10 {
+		t.Fatalf("expected an auth failure, got %v", err)
+	}
+	summary, err := ioutil.ReadFile(b.ErrorSummaryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(summary), "acme_Xy12") || strings.Contains(string(summary), "hunter2hunter2") {
+		t.Errorf("expected the secrets masked in %s", summary)
+	}
+	if !strings.Contains(string(summary), "authentication required for [redacted] with [redacted]") {
+		t.Errorf("expected the masked line in %s", summary)
+	}
+}
+
+func TestPlugin_ExecInvalidRedactPattern(t *testing.T) {
+	b := testBuild(t)
+	b.RedactPatterns = []string{"("}
+	if err := New(b, WithRunner(&fakeRunner{})).Exec(context.Background()); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
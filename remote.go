@@ -0,0 +1,75 @@
+package kaniko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// isRemoteContext returns true when the build context is a URL, such as
+// git://github.com/foo/bar.git#refs/heads/main or s3://bucket/context.tar.gz,
+// which kaniko fetches itself.
+func isRemoteContext(context string) bool {
+	return strings.Contains(context, "://")
+}
+
+// contextArg returns the value of the kaniko --context flag.
+func contextArg(context string) string {
+	if isRemoteContext(context) {
+		return context
+	}
+	return "dir://" + context
+}
+
+// gitContextHost returns the host of a git build context, or an empty string
+// for other contexts.
+func gitContextHost(context string) string {
+	if !strings.HasPrefix(context, "git://") {
+		return ""
+	}
+	u, err := url.Parse(strings.SplitN(context, "#", 2)[0])
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// stageNetrc writes the netrc credentials to the .netrc file in home and
+// returns a function restoring the previous file.
+func (b Build) stageNetrc(home string) (func(), error) {
+	path := filepath.Join(home, ".netrc")
+	previous, err := ioutil.ReadFile(path)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "failed to read netrc file")
+	}
+
+	content := fmt.Sprintf("machine %s\nlogin %s\npassword %s\n", b.NetrcMachine, b.NetrcLogin, b.NetrcPassword)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return nil, errors.Wrap(err, "failed to write netrc file")
+	}
+	return func() {
+		if existed {
+			ioutil.WriteFile(path, previous, 0600)
+		} else {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+// contextEnv returns the environment passing the netrc credentials to the
+// kaniko git context fetcher, when the context is hosted on the netrc machine.
+func (b Build) contextEnv() []string {
+	if b.NetrcMachine == "" || b.NetrcPassword == "" || gitContextHost(b.Context) != b.NetrcMachine {
+		return nil
+	}
+	return []string{
+		"GIT_USERNAME=" + b.NetrcLogin,
+		"GIT_PASSWORD=" + b.NetrcPassword,
+	}
+}
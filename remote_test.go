@@ -0,0 +1,77 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestContextArg(t *testing.T) {
+	tests := []struct {
+		context string
+		want    string
+	}{
+		{context: ".", want: "dir://."},
+		{context: "/drone/src", want: "dir:///drone/src"},
+		{context: "git://github.com/foo/bar.git#refs/heads/main", want: "git://github.com/foo/bar.git#refs/heads/main"},
+		{context: "s3://bucket/context.tar.gz", want: "s3://bucket/context.tar.gz"},
+	}
+	for _, tt := range tests {
+		if got := contextArg(tt.context); got != tt.want {
+			t.Errorf("contextArg(%q) = %q, want %q", tt.context, got, tt.want)
+		}
+	}
+}
+
+func TestBuild_contextEnv(t *testing.T) {
+	b := Build{
+		Context:       "git://github.com/foo/bar.git#refs/heads/main",
+		NetrcMachine:  "github.com",
+		NetrcLogin:    "octocat",
+		NetrcPassword: "secret",
+	}
+	want := []string{"GIT_USERNAME=octocat", "GIT_PASSWORD=secret"}
+	if got := b.contextEnv(); !cmp.Equal(got, want) {
+		t.Errorf("unexpected env: %s", cmp.Diff(want, got))
+	}
+
+	// credentials are not passed to other hosts
+	b.Context = "git://gitlab.com/foo/bar.git"
+	if got := b.contextEnv(); got != nil {
+		t.Errorf("expected no env, got %v", got)
+	}
+}
+
+func TestBuild_stageNetrc(t *testing.T) {
+	home := t.TempDir()
+	path := filepath.Join(home, ".netrc")
+	if err := ioutil.WriteFile(path, []byte("machine example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restore, err := Build{NetrcMachine: "github.com", NetrcLogin: "octocat", NetrcPassword: "secret"}.stageNetrc(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadFile(path); string(got) != "machine github.com\nlogin octocat\npassword secret\n" {
+		t.Errorf("unexpected netrc %q", got)
+	}
+
+	restore()
+	if got, _ := ioutil.ReadFile(path); string(got) != "machine example.com\n" {
+		t.Errorf("netrc not restored, got %q", got)
+	}
+
+	os.Remove(path)
+	restore, err = Build{NetrcMachine: "github.com"}.stageNetrc(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected netrc to be removed")
+	}
+}
@@ -0,0 +1,162 @@
+package kaniko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/drone/drone-kaniko/pkg/fsutil"
+	"github.com/pkg/errors"
+)
+
+// defaultRunCacheVolume is the directory the run cache directories are kept
+// in between builds, when no volume is set.
+const defaultRunCacheVolume = "/cache/run"
+
+// runCacheVolume returns the directory the run cache directories are kept in.
+func (b Build) runCacheVolume() string {
+	if b.RunCacheVolume == "" {
+		return defaultRunCacheVolume
+	}
+	return b.RunCacheVolume
+}
+
+// runCacheDirs returns the directories the RUN instructions share across
+// builds: the run cache dirs and, with run cache mounts, the targets of the
+// RUN --mount=type=cache flags, which the kaniko executor does not mount.
+// The directories are shared with the executor running in the plugin
+// container only, as RUN instructions execute in its filesystem.
+func (p Plugin) runCacheDirs(local, remote bool) ([]string, error) {
+	if len(p.Build.RunCacheDirs) == 0 && !p.Build.RunCacheMounts {
+		return nil, nil
+	}
+	if p.Build.builder() != BuilderKaniko {
+		fmt.Fprintf(os.Stderr, "warning: run cache settings are not needed by the %s builder, which supports RUN --mount=type=cache, and are ignored\n", p.Build.builder())
+		return nil, nil
+	}
+	if !local {
+		fmt.Fprintf(os.Stderr, "warning: run cache directories need the kaniko executor running in the plugin container and are ignored\n")
+		return nil, nil
+	}
+
+	var dirs []string
+	for _, dir := range p.Build.RunCacheDirs {
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("run cache dir %q must be an absolute path", dir)
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	if p.Build.RunCacheMounts && !remote {
+		d, err := dockerfile.ParseFile(p.Build.Dockerfile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse dockerfile")
+		}
+		dirs = append(dirs, cacheMountTargets(d)...)
+	}
+
+	var unique []string
+	for _, dir := range dirs {
+		if !contains(unique, dir) {
+			unique = append(unique, dir)
+		}
+	}
+	return unique, nil
+}
+
+// cacheMountTargets returns the targets of the RUN --mount=type=cache flags.
+// Targets given by variables or relative to the working directory are
+// skipped, as they are only known while the build runs.
+func cacheMountTargets(d *dockerfile.Dockerfile) []string {
+	var targets []string
+	for _, stage := range d.Stages {
+		for _, inst := range stage.Instructions {
+			if inst.Cmd != "RUN" {
+				continue
+			}
+			for _, flag := range inst.Flags {
+				if !strings.HasPrefix(flag, "--mount=") {
+					continue
+				}
+				options := map[string]string{}
+				for _, option := range strings.Split(strings.TrimPrefix(flag, "--mount="), ",") {
+					key, value, _ := strings.Cut(option, "=")
+					options[strings.ToLower(key)] = value
+				}
+				if options["type"] != "cache" {
+					continue
+				}
+				target := options["target"]
+				for _, alias := range []string{"dst", "destination"} {
+					if target == "" {
+						target = options[alias]
+					}
+				}
+				if !filepath.IsAbs(target) || strings.Contains(target, "$") {
+					fmt.Fprintf(os.Stderr, "warning: cache mount target %q on line %d is not an absolute path and is not cached\n", target, inst.StartLine)
+					continue
+				}
+				targets = append(targets, filepath.Clean(target))
+			}
+		}
+	}
+	return targets
+}
+
+// runCachePath returns the directory the run cache dir is kept in.
+func (b Build) runCachePath(dir string) string {
+	return filepath.Join(b.runCacheVolume(), dir)
+}
+
+// restoreRunCache copies the kept run cache directories into place before
+// the build. Failures are printed, the build then starts with an empty cache.
+func (b Build) restoreRunCache(dirs []string) {
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create run cache dir %s: %s\n", dir, err)
+			continue
+		}
+		kept := b.runCachePath(dir)
+		if _, err := os.Stat(kept); err != nil {
+			continue
+		}
+		if err := fsutil.CopyDir(kept, dir); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to restore run cache dir %s: %s\n", dir, err)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "Restored run cache dir %s\n", dir)
+	}
+}
+
+// saveRunCache keeps the run cache directories for the next build. Each one
+// is copied next to the kept directory first and then swapped in, so a
+// concurrent build restores a complete copy. Failures are printed and do not
+// change the outcome of the build.
+func (b Build) saveRunCache(dirs []string) {
+	for _, dir := range dirs {
+		if err := b.saveRunCacheDir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to save run cache dir %s: %s\n", dir, err)
+		}
+	}
+}
+
+func (b Build) saveRunCacheDir(dir string) error {
+	kept := b.runCachePath(dir)
+	if err := os.MkdirAll(filepath.Dir(kept), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(kept), "."+filepath.Base(kept)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := fsutil.CopyDir(dir, tmp); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(kept); err != nil {
+		return err
+	}
+	return os.Rename(tmp, kept)
+}
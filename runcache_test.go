@@ -0,0 +1,94 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/dockerfile"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCacheMountTargets(t *testing.T) {
+	d, err := dockerfile.Parse(strings.NewReader(`FROM node:20 AS build
+RUN --mount=type=cache,target=/root/.npm npm ci
+RUN --mount=type=secret,id=npmrc,target=/root/.npmrc \
+    --mount=type=cache,id=go,dst=/go/pkg/mod/ go mod download
+RUN --mount=type=cache,target=node_modules/.cache npm run build
+FROM alpine
+RUN --mount=type=cache,sharing=locked,destination=/var/cache/apk apk add git
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/root/.npm", "/go/pkg/mod", "/var/cache/apk"}
+	if diff := cmp.Diff(want, cacheMountTargets(d)); diff != "" {
+		t.Errorf("targets mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPlugin_runCacheDirs(t *testing.T) {
+	dockerfile := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := ioutil.WriteFile(dockerfile, []byte("FROM node\nRUN --mount=type=cache,target=/root/.npm npm ci\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := Plugin{Build: Build{Dockerfile: dockerfile, RunCacheDirs: []string{"/root/.npm/", "/root/.cache/pip"}, RunCacheMounts: true}}
+	dirs, err := p.runCacheDirs(true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"/root/.npm", "/root/.cache/pip"}, dirs); diff != "" {
+		t.Errorf("dirs mismatch (-want +got):\n%s", diff)
+	}
+	if dirs, _ := p.runCacheDirs(false, false); dirs != nil {
+		t.Errorf("expected no run cache dirs with a remote executor, got %v", dirs)
+	}
+	p.Build.Builder = BuilderBuildKit
+	if dirs, _ := p.runCacheDirs(true, false); dirs != nil {
+		t.Errorf("expected no run cache dirs with buildkit, got %v", dirs)
+	}
+	p.Build.Builder = ""
+	p.Build.RunCacheDirs = []string{"node_modules"}
+	if _, err := p.runCacheDirs(true, false); err == nil {
+		t.Error("expected error for a relative run cache dir")
+	}
+}
+
+func TestBuild_saveRunCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "root", ".npm")
+	if err := os.MkdirAll(filepath.Join(dir, "_cacache"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "_cacache", "index"), []byte("express"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := Build{RunCacheVolume: t.TempDir()}
+	b.saveRunCache([]string{dir})
+	// a second save replaces the kept directory
+	b.saveRunCache([]string{dir})
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	b.restoreRunCache([]string{dir})
+	content, err := ioutil.ReadFile(filepath.Join(dir, "_cacache", "index"))
+	if err != nil || string(content) != "express" {
+		t.Fatalf("expected the run cache restored, got %q: %v", content, err)
+	}
+	entries, _ := ioutil.ReadDir(filepath.Dir(b.runCachePath(dir)))
+	if len(entries) != 1 {
+		t.Errorf("expected the temporary copies removed, got %d entries", len(entries))
+	}
+}
+
+func TestPlugin_kanikoArgsRunCache(t *testing.T) {
+	p := Plugin{Build: Build{Dockerfile: "Dockerfile", NoPush: true}}
+	args := p.kanikoArgs(buildInput{context: ".", runCacheDirs: []string{"/root/.npm"}})
+	for _, want := range []string{"--ignore-path=/cache/run", "--ignore-path=/root/.npm"} {
+		if !contains(args, want) {
+			t.Errorf("expected %s in %v", want, args)
+		}
+	}
+}
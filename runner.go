@@ -0,0 +1,74 @@
+package kaniko
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/drone/drone-kaniko/pkg/sysinfo"
+)
+
+// defaultExecutor is the kaniko executor shipped in the kaniko image.
+var defaultExecutor = filepath.Join(sysinfo.KanikoDir, "executor"+sysinfo.ExeSuffix)
+
+// Runner runs the commands of a build, such as the kaniko executor.
+type Runner interface {
+	Run(ctx context.Context, cmd *exec.Cmd) error
+}
+
+// RunnerFunc adapts a function to the Runner interface.
+type RunnerFunc func(ctx context.Context, cmd *exec.Cmd) error
+
+// Run calls f.
+func (f RunnerFunc) Run(ctx context.Context, cmd *exec.Cmd) error {
+	return f(ctx, cmd)
+}
+
+// ExecRunner runs commands as local processes, killing them when the
+// context is cancelled.
+type ExecRunner struct{}
+
+// Run runs cmd and waits for it to exit.
+func (ExecRunner) Run(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// runner returns the runner of the commands other than the executor, which
+// run locally unless a custom runner is set.
+func (p Plugin) runner() Runner {
+	if p.Runner != nil {
+		return p.Runner
+	}
+	return ExecRunner{}
+}
+
+// executor returns the path of the builder executable, the kaniko executor
+// unless another builder is selected.
+func (p Plugin) executor() string {
+	if p.Executor != "" {
+		return p.Executor
+	}
+	switch p.Build.builder() {
+	case BuilderBuildKit:
+		return defaultBuildctl
+	case BuilderBuildah:
+		return defaultBuildah
+	}
+	return defaultExecutor
+}
@@ -0,0 +1,193 @@
+package kaniko
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/failure"
+	"github.com/drone/drone-kaniko/pkg/fips"
+)
+
+// fakeRunner records the commands instead of running them.
+type fakeRunner struct {
+	cmds []*exec.Cmd
+	run  func(cmd *exec.Cmd) error
+}
+
+func (r *fakeRunner) Run(ctx context.Context, cmd *exec.Cmd) error {
+	r.cmds = append(r.cmds, cmd)
+	if r.run != nil {
+		return r.run(cmd)
+	}
+	return nil
+}
+
+// testBuild returns a build of an empty Dockerfile that is not pushed.
+func testBuild(t *testing.T) Build {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(dockerfile, []byte("FROM scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Build{Dockerfile: dockerfile, Context: dir, NoPush: true, KanikoDir: dir}
+}
+
+func TestPlugin_ExecArgs(t *testing.T) {
+	b := testBuild(t)
+	b.Args = []string{"VERSION=1.0"}
+	b.Labels = []string{"team=build"}
+	b.Target = "release"
+	if err := ioutil.WriteFile(b.Dockerfile, []byte("FROM scratch AS release\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b.EnableCache = true
+	b.CacheRepo = "registry.example.com/cache"
+	b.SnapshotMode = "redo"
+	b.DisableCompressedCaching = true
+
+	runner := &fakeRunner{}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.cmds) != 1 {
+		t.Fatalf("expected the executor to run once, ran %d commands", len(runner.cmds))
+	}
+	args := runner.cmds[0].Args
+	if args[0] != defaultExecutor {
+		t.Errorf("expected the default executor, got %s", args[0])
+	}
+	for _, want := range []string{
+		"--dockerfile=" + b.Dockerfile,
+		"--context=dir://" + b.Context,
+		"--build-arg=VERSION=1.0",
+		"--label=team=build",
+		"--target=release",
+		"--cache=true",
+		"--cache-repo=registry.example.com/cache",
+		"--snapshotMode=redo",
+		"--compressed-caching=false",
+		"--no-push",
+	} {
+		if !contains(args, want) {
+			t.Errorf("expected argument %s in %v", want, args)
+		}
+	}
+}
+
+func TestPlugin_ExecCacheRegistry(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheRepo string
+		insecure  bool
+		want      string
+	}{
+		{name: "secure", cacheRepo: "cache.svc.cluster.local:5000/cache"},
+		{name: "insecure", cacheRepo: "cache.svc.cluster.local:5000/cache", insecure: true, want: "--insecure-registry=cache.svc.cluster.local:5000"},
+		{name: "insecure localhost", cacheRepo: "localhost:5000/cache", insecure: true, want: "--insecure-registry=localhost:5000"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := testBuild(t)
+			b.EnableCache = true
+			b.CacheRepo = test.cacheRepo
+			b.CacheInsecure = test.insecure
+
+			runner := &fakeRunner{}
+			if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			var insecure []string
+			for _, arg := range runner.cmds[0].Args {
+				if strings.HasPrefix(arg, "--insecure-registry=") {
+					insecure = append(insecure, arg)
+				}
+			}
+			if test.want == "" && len(insecure) != 0 {
+				t.Errorf("expected no insecure registry, got %v", insecure)
+			}
+			if test.want != "" && !contains(insecure, test.want) {
+				t.Errorf("expected argument %s, got %v", test.want, insecure)
+			}
+		})
+	}
+}
+
+func TestPlugin_ExecFailure(t *testing.T) {
+	b := testBuild(t)
+	b.ErrorSummaryFile = filepath.Join(t.TempDir(), "error.json")
+
+	runner := RunnerFunc(func(ctx context.Context, cmd *exec.Cmd) error {
+		fmt.Fprintln(cmd.Stderr, "error checking push permissions: UNAUTHORIZED: authentication required")
+		return errors.New("exit status 1")
+	})
+	err := New(b, WithRunner(runner)).Exec(context.Background())
+
+	var ferr *failure.Error
+	if !errors.As(err, &ferr) {
+		t.Fatalf("expected a classified failure, got %v", err)
+	}
+	if ferr.Category != failure.Auth {
+		t.Errorf("expected an auth failure, got %s", ferr.Category)
+	}
+	if _, err := ioutil.ReadFile(b.ErrorSummaryFile); err != nil {
+		t.Errorf("expected the error summary to be written: %s", err)
+	}
+}
+
+func TestPlugin_ExecFIPS(t *testing.T) {
+	b := testBuild(t)
+	b.FIPS = true
+	err := New(b, WithRunner(&fakeRunner{})).Exec(context.Background())
+	if fips.Enabled() != (err == nil) {
+		t.Errorf("exec returned %v with the FIPS module enabled %t", err, fips.Enabled())
+	}
+}
+
+func TestPlugin_ExecStructureTest(t *testing.T) {
+	b := testBuild(t)
+	b.StructureTestConfigs = []string{"test.yaml"}
+	b.StructureTestReport = filepath.Join(t.TempDir(), "report.json")
+
+	runner := &fakeRunner{run: func(cmd *exec.Cmd) error {
+		if cmd.Args[0] != structureTestBinary {
+			return nil
+		}
+		report := `{"Pass": 2, "Fail": 0, "Total": 2}`
+		return ioutil.WriteFile(b.StructureTestReport, []byte(report), 0644)
+	}}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.cmds) != 2 {
+		t.Fatalf("expected the executor and the structure tests to run, ran %d commands", len(runner.cmds))
+	}
+	var tarPath string
+	for _, arg := range runner.cmds[0].Args {
+		if strings.HasPrefix(arg, "--tar-path=") {
+			tarPath = strings.TrimPrefix(arg, "--tar-path=")
+		}
+	}
+	if tarPath == "" || !contains(runner.cmds[1].Args, "--image="+tarPath) {
+		t.Errorf("expected the structure tests to run against the image tarball %q, got %v", tarPath, runner.cmds[1].Args)
+	}
+}
+
+func TestExecRunner_Cancel(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not installed")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (ExecRunner{}).Run(ctx, exec.Command("sleep", "10")); err != context.Canceled {
+		t.Errorf("expected the command to be cancelled, got %v", err)
+	}
+	if err := (ExecRunner{}).Run(context.Background(), exec.Command("sleep", "0")); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package kaniko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/fsutil"
+	"github.com/drone/drone-kaniko/pkg/tagger"
+	"github.com/pkg/errors"
+)
+
+// scratchBuildsDir is the directory, within the kaniko directory, the
+// scratch directories of the builds are created in by default.
+const scratchBuildsDir = "builds"
+
+// kanikoLockFile is the file, within the kaniko directory, locked while the
+// executor uses the kaniko directory.
+const kanikoLockFile = ".lock"
+
+// NewScratchDir creates a directory for the files of a single plugin run,
+// such as the docker config and the digest file, so steps running
+// concurrently in the same pod do not overwrite each other's files. It is
+// created in base, defaulting to the builds directory in the kaniko
+// directory, and named after the Drone build and step numbers.
+func NewScratchDir(base, kanikoDir string) (string, error) {
+	if kanikoDir == "" {
+		kanikoDir = defaultKanikoDir
+	}
+	if base == "" {
+		base = filepath.Join(kanikoDir, scratchBuildsDir)
+	}
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return "", errors.Wrap(err, "failed to create scratch directory")
+	}
+	var ids []string
+	for _, name := range []string{"DRONE_BUILD_NUMBER", "DRONE_STAGE_NUMBER", "DRONE_STEP_NUMBER"} {
+		if id := tagger.Sanitize(os.Getenv(name)); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	dir, err := ioutil.TempDir(base, strings.Join(append(ids, ""), "-"))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create scratch directory")
+	}
+	return dir, nil
+}
+
+// scratchDir returns the directory for the files of the build, the scratch
+// directory of the run when set, otherwise the kaniko directory.
+func (b Build) scratchDir() string {
+	if b.ScratchDir != "" {
+		return b.ScratchDir
+	}
+	return b.kanikoDir()
+}
+
+// scratchIgnorePath returns the scratch directory when kaniko would
+// otherwise snapshot it, as it is outside the kaniko directory.
+func (b Build) scratchIgnorePath() string {
+	if b.ScratchDir == "" {
+		return ""
+	}
+	if _, ok := relativeTo(b.kanikoDir(), b.ScratchDir); ok {
+		return ""
+	}
+	return b.ScratchDir
+}
+
+// lockKanikoDir locks the kaniko directory, which the executor unpacks
+// images into, while the executor runs, so concurrent steps sharing it wait
+// for each other instead of corrupting each other's builds.
+func (b Build) lockKanikoDir() (func(), error) {
+	path := filepath.Join(b.kanikoDir(), kanikoLockFile)
+	unlock, err := fsutil.Lock(path, false)
+	if err == fsutil.ErrLocked {
+		fmt.Fprintf(os.Stdout, "Waiting for another build using %s\n", b.kanikoDir())
+		unlock, err = fsutil.Lock(path, true)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lock the kaniko directory")
+	}
+	return unlock, nil
+}
@@ -0,0 +1,71 @@
+package kaniko
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewScratchDir(t *testing.T) {
+	t.Setenv("DRONE_BUILD_NUMBER", "42")
+	t.Setenv("DRONE_STAGE_NUMBER", "1")
+	t.Setenv("DRONE_STEP_NUMBER", "3")
+	kanikoDir := t.TempDir()
+
+	first, err := NewScratchDir("", kanikoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewScratchDir("", kanikoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("expected unique directories, got %s twice", first)
+	}
+	if filepath.Dir(first) != filepath.Join(kanikoDir, scratchBuildsDir) {
+		t.Errorf("unexpected parent of %s", first)
+	}
+	if !strings.HasPrefix(filepath.Base(first), "42-1-3-") {
+		t.Errorf("expected the build and step numbers in %s", first)
+	}
+
+	base := t.TempDir()
+	if dir, err := NewScratchDir(base, kanikoDir); err != nil || filepath.Dir(dir) != base {
+		t.Errorf("expected a directory in %s, got %s (%v)", base, dir, err)
+	}
+}
+
+func TestBuild_scratchIgnorePath(t *testing.T) {
+	b := Build{KanikoDir: "/kaniko"}
+	if got := b.scratchIgnorePath(); got != "" {
+		t.Errorf("expected no ignore path without a scratch dir, got %s", got)
+	}
+	b.ScratchDir = "/kaniko/builds/42-1-3-123"
+	if got := b.scratchIgnorePath(); got != "" {
+		t.Errorf("expected no ignore path within the kaniko dir, got %s", got)
+	}
+	b.ScratchDir = "/tmp/builds/42-1-3-123"
+	if got := b.scratchIgnorePath(); got != b.ScratchDir {
+		t.Errorf("got ignore path %q, want %s", got, b.ScratchDir)
+	}
+}
+
+func TestBuild_lockKanikoDir(t *testing.T) {
+	b := Build{KanikoDir: t.TempDir()}
+	unlock, err := b.lockKanikoDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if _, err := os.Stat(filepath.Join(b.KanikoDir, kanikoLockFile)); err != nil {
+		t.Errorf("expected the lock file: %s", err)
+	}
+	// released locks can be taken again
+	unlock, err = b.lockKanikoDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
@@ -6,24 +6,46 @@ export GOPATH=""
 # disable cgo
 export CGO_ENABLED=0
 
+# stamp the plugin version into the binaries
+LDFLAGS="-X github.com/drone/drone-kaniko/pkg/buildinfo.Version=${DRONE_TAG:-unknown}"
+
 set -e
 set -x
 
 # linux
-GOOS=linux GOARCH=amd64 go build -o release/linux/amd64/kaniko-gcr    ./cmd/kaniko-gcr
-GOOS=linux GOARCH=amd64 go build -o release/linux/amd64/kaniko-acr    ./cmd/kaniko-acr
-GOOS=linux GOARCH=amd64 go build -o release/linux/amd64/kaniko-ecr    ./cmd/kaniko-ecr
-GOOS=linux GOARCH=amd64 go build -o release/linux/amd64/kaniko-docker ./cmd/kaniko-docker
-GOOS=linux GOARCH=amd64 go build -o release/linux/amd64/kaniko-gar    ./cmd/kaniko-gar
-
-GOOS=linux GOARCH=arm64 go build -o release/linux/arm64/kaniko-gcr    ./cmd/kaniko-gcr
-GOOS=linux GOARCH=arm64 go build -o release/linux/arm64/kaniko-acr    ./cmd/kaniko-acr
-GOOS=linux GOARCH=arm64 go build -o release/linux/arm64/kaniko-ecr    ./cmd/kaniko-ecr
-GOOS=linux GOARCH=arm64 go build -o release/linux/arm64/kaniko-docker ./cmd/kaniko-docker
-GOOS=linux GOARCH=arm64 go build -o release/linux/arm64/kaniko-gar    ./cmd/kaniko-gar
-
-GOOS=linux GOARCH=arm   go build -o release/linux/arm/kaniko-gcr      ./cmd/kaniko-gcr
-GOOS=linux GOARCH=arm   go build -o release/linux/arm/kaniko-acr      ./cmd/kaniko-acr
-GOOS=linux GOARCH=arm   go build -o release/linux/arm/kaniko-ecr      ./cmd/kaniko-ecr
-GOOS=linux GOARCH=arm   go build -o release/linux/arm/kaniko-docker   ./cmd/kaniko-docker
-GOOS=linux GOARCH=arm   go build -o release/linux/arm/kaniko-gar      ./cmd/kaniko-gar
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/linux/amd64/kaniko-gcr    ./cmd/kaniko-gcr
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/linux/amd64/kaniko-acr    ./cmd/kaniko-acr
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/linux/amd64/kaniko-ecr    ./cmd/kaniko-ecr
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/linux/amd64/kaniko-docker ./cmd/kaniko-docker
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/linux/amd64/kaniko-gar    ./cmd/kaniko-gar
+GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/linux/amd64/kaniko        ./cmd/kaniko
+
+GOOS=linux GOARCH=arm64 go build -ldflags "$LDFLAGS" -o release/linux/arm64/kaniko-gcr    ./cmd/kaniko-gcr
+GOOS=linux GOARCH=arm64 go build -ldflags "$LDFLAGS" -o release/linux/arm64/kaniko-acr    ./cmd/kaniko-acr
+GOOS=linux GOARCH=arm64 go build -ldflags "$LDFLAGS" -o release/linux/arm64/kaniko-ecr    ./cmd/kaniko-ecr
+GOOS=linux GOARCH=arm64 go build -ldflags "$LDFLAGS" -o release/linux/arm64/kaniko-docker ./cmd/kaniko-docker
+GOOS=linux GOARCH=arm64 go build -ldflags "$LDFLAGS" -o release/linux/arm64/kaniko-gar    ./cmd/kaniko-gar
+GOOS=linux GOARCH=arm64 go build -ldflags "$LDFLAGS" -o release/linux/arm64/kaniko        ./cmd/kaniko
+
+GOOS=linux GOARCH=arm   go build -ldflags "$LDFLAGS" -o release/linux/arm/kaniko-gcr      ./cmd/kaniko-gcr
+GOOS=linux GOARCH=arm   go build -ldflags "$LDFLAGS" -o release/linux/arm/kaniko-acr      ./cmd/kaniko-acr
+GOOS=linux GOARCH=arm   go build -ldflags "$LDFLAGS" -o release/linux/arm/kaniko-ecr      ./cmd/kaniko-ecr
+GOOS=linux GOARCH=arm   go build -ldflags "$LDFLAGS" -o release/linux/arm/kaniko-docker   ./cmd/kaniko-docker
+GOOS=linux GOARCH=arm   go build -ldflags "$LDFLAGS" -o release/linux/arm/kaniko-gar      ./cmd/kaniko-gar
+GOOS=linux GOARCH=arm   go build -ldflags "$LDFLAGS" -o release/linux/arm/kaniko          ./cmd/kaniko
+
+# windows, running the executor with the kubernetes or docker backend
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/windows/amd64/kaniko-gcr.exe    ./cmd/kaniko-gcr
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/windows/amd64/kaniko-acr.exe    ./cmd/kaniko-acr
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/windows/amd64/kaniko-ecr.exe    ./cmd/kaniko-ecr
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/windows/amd64/kaniko-docker.exe ./cmd/kaniko-docker
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/windows/amd64/kaniko-gar.exe    ./cmd/kaniko-gar
+GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o release/windows/amd64/kaniko.exe        ./cmd/kaniko
+
+# linux/amd64 FIPS variant, using the BoringCrypto module which requires cgo
+FIPS_LDFLAGS="$LDFLAGS -linkmode external -extldflags -static"
+CGO_ENABLED=1 GOEXPERIMENT=boringcrypto GOOS=linux GOARCH=amd64 go build -tags netgo,osusergo -ldflags "$FIPS_LDFLAGS" -o release/linux/amd64/fips/kaniko-gcr    ./cmd/kaniko-gcr
+CGO_ENABLED=1 GOEXPERIMENT=boringcrypto GOOS=linux GOARCH=amd64 go build -tags netgo,osusergo -ldflags "$FIPS_LDFLAGS" -o release/linux/amd64/fips/kaniko-acr    ./cmd/kaniko-acr
+CGO_ENABLED=1 GOEXPERIMENT=boringcrypto GOOS=linux GOARCH=amd64 go build -tags netgo,osusergo -ldflags "$FIPS_LDFLAGS" -o release/linux/amd64/fips/kaniko-ecr    ./cmd/kaniko-ecr
+CGO_ENABLED=1 GOEXPERIMENT=boringcrypto GOOS=linux GOARCH=amd64 go build -tags netgo,osusergo -ldflags "$FIPS_LDFLAGS" -o release/linux/amd64/fips/kaniko-docker ./cmd/kaniko-docker
+CGO_ENABLED=1 GOEXPERIMENT=boringcrypto GOOS=linux GOARCH=amd64 go build -tags netgo,osusergo -ldflags "$FIPS_LDFLAGS" -o release/linux/amd64/fips/kaniko-gar    ./cmd/kaniko-gar
@@ -6,21 +6,24 @@ export GOPATH=""
 # disable cgo
 export CGO_ENABLED=0
 
-# force linux amd64 platform
+# linux platform, native architecture unless GOARCH is set (amd64 or arm64)
 export GOOS=linux
-export GOARCH=amd64 
+export GOARCH=${GOARCH:-$(go env GOARCH)}
 
 set -e
 set -x
 
 # build the binary
-go build -o release/linux/amd64/kaniko-gcr    ./cmd/kaniko-gcr
-go build -o release/linux/amd64/kaniko-gar    ./cmd/kaniko-gar
-go build -o release/linux/amd64/kaniko-ecr    ./cmd/kaniko-ecr
-go build -o release/linux/amd64/kaniko-docker ./cmd/kaniko-docker
+go build -o release/linux/$GOARCH/kaniko-gcr    ./cmd/kaniko-gcr
+go build -o release/linux/$GOARCH/kaniko-gar    ./cmd/kaniko-gar
+go build -o release/linux/$GOARCH/kaniko        ./cmd/kaniko
+go build -o release/linux/$GOARCH/kaniko-ecr    ./cmd/kaniko-ecr
+go build -o release/linux/$GOARCH/kaniko-acr    ./cmd/kaniko-acr
+go build -o release/linux/$GOARCH/kaniko-docker ./cmd/kaniko-docker
 
 # build the docker image
-docker build -f docker/gcr/Dockerfile.linux.amd64    -t plugins/kaniko-gcr .
-docker build -f docker/gar/Dockerfile.linux.amd64    -t plugins/kaniko-gar .
-docker build -f docker/ecr/Dockerfile.linux.amd64    -t plugins/kaniko-ecr .
-docker build -f docker/docker/Dockerfile.linux.amd64 -t plugins/kaniko .
+docker build -f docker/gcr/Dockerfile.linux.$GOARCH    -t plugins/kaniko-gcr .
+docker build -f docker/gar/Dockerfile.linux.$GOARCH    -t plugins/kaniko-gar .
+docker build -f docker/ecr/Dockerfile.linux.$GOARCH    -t plugins/kaniko-ecr .
+docker build -f docker/acr/Dockerfile.linux.$GOARCH    -t plugins/kaniko-acr .
+docker build -f docker/docker/Dockerfile.linux.$GOARCH -t plugins/kaniko .
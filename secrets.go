@@ -0,0 +1,109 @@
+package kaniko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// secretsDir is the default target of RUN --mount=type=secret mounts.
+const secretsDir = "/run/secrets"
+
+type secret struct {
+	id    string
+	value []byte
+}
+
+// parseSecrets parses id=source pairs. The source is read as a file when it
+// exists, otherwise it names an environment variable holding the secret.
+func parseSecrets(values []string) ([]secret, error) {
+	var secrets []secret
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid secret %q, expected id=envvar or id=filepath", value)
+		}
+		id, source := parts[0], parts[1]
+		if id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+			return nil, fmt.Errorf("invalid secret id %q", id)
+		}
+
+		if info, err := os.Stat(source); err == nil && !info.IsDir() {
+			data, err := ioutil.ReadFile(source)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("failed to read secret %s", id))
+			}
+			secrets = append(secrets, secret{id: id, value: data})
+			continue
+		}
+		data, ok := os.LookupEnv(source)
+		if !ok {
+			return nil, fmt.Errorf("secret %s: %s is neither a file nor a set environment variable", id, source)
+		}
+		secrets = append(secrets, secret{id: id, value: []byte(data)})
+	}
+	return secrets, nil
+}
+
+// stageSecrets writes the secrets to dir so RUN --mount=type=secret,id=<id>
+// steps find them at their default location. The returned function removes
+// the staged files.
+func stageSecrets(dir string, values []string) (func(), error) {
+	secrets, err := parseSecrets(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "failed to create secrets directory")
+	}
+
+	var staged []string
+	cleanup := func() {
+		for _, path := range staged {
+			os.Remove(path)
+		}
+	}
+	for _, s := range secrets {
+		path := filepath.Join(dir, s.id)
+		if err := ioutil.WriteFile(path, s.value, 0400); err != nil {
+			cleanup()
+			return nil, errors.Wrap(err, fmt.Sprintf("failed to stage secret %s", s.id))
+		}
+		staged = append(staged, path)
+	}
+	return cleanup, nil
+}
+
+// argNamePattern matches the names of build args.
+var argNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// parseSecretArgs parses ARG=ENVVAR pairs into the names of the build args
+// and the environment of the builder. The args are passed by name only, the
+// builder resolving their values from its environment, so that the values
+// never appear in the traced command.
+func parseSecretArgs(values, args []string) (names, env []string, err error) {
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[1] == "" || !argNamePattern.MatchString(parts[0]) {
+			return nil, nil, fmt.Errorf("invalid secret arg %q, expected ARGNAME=SECRET_ENV_NAME", value)
+		}
+		name, source := parts[0], parts[1]
+		for _, arg := range args {
+			if arg == name || strings.HasPrefix(arg, name+"=") {
+				return nil, nil, fmt.Errorf("secret arg %s is also set in build args", name)
+			}
+		}
+		data, ok := os.LookupEnv(source)
+		if !ok {
+			return nil, nil, fmt.Errorf("secret arg %s: environment variable %s is not set", name, source)
+		}
+		names = append(names, name)
+		env = append(env, name+"="+data)
+	}
+	return names, env, nil
+}
@@ -0,0 +1,79 @@
+package kaniko
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStageSecrets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "npmrc")
+	if err := ioutil.WriteFile(file, []byte("token=file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("KANIKO_TEST_SECRET", "token=env")
+	defer os.Unsetenv("KANIKO_TEST_SECRET")
+
+	dir := filepath.Join(t.TempDir(), "secrets")
+	cleanup, err := stageSecrets(dir, []string{"npmrc=" + file, "token=KANIKO_TEST_SECRET"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]string{"npmrc": "token=file", "token": "token=env"} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, id))
+		if err != nil || string(got) != want {
+			t.Errorf("secret %s = %q, %v; want %q", id, got, err, want)
+		}
+	}
+
+	cleanup()
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected secrets to be removed, found %d", len(entries))
+	}
+}
+
+func TestParseSecrets_Invalid(t *testing.T) {
+	for _, value := range []string{"token", "=FOO", "a/b=FOO", "token=KANIKO_TEST_UNSET_SECRET"} {
+		if _, err := parseSecrets([]string{value}); err == nil {
+			t.Errorf("expected error for secret %q", value)
+		}
+	}
+}
+
+func TestPlugin_ExecSecretArgs(t *testing.T) {
+	os.Setenv("KANIKO_TEST_NPM_TOKEN", "s3cr3t")
+	defer os.Unsetenv("KANIKO_TEST_NPM_TOKEN")
+
+	b := testBuild(t)
+	b.SecretArgs = []string{"NPM_TOKEN=KANIKO_TEST_NPM_TOKEN"}
+	runner := &fakeRunner{}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cmd := runner.cmds[0]
+	if !contains(cmd.Args, "--build-arg=NPM_TOKEN") {
+		t.Errorf("expected the secret arg by name in %v", cmd.Args)
+	}
+	for _, arg := range cmd.Args {
+		if strings.Contains(arg, "s3cr3t") {
+			t.Errorf("secret value in argument %s", arg)
+		}
+	}
+	if !contains(cmd.Env, "NPM_TOKEN=s3cr3t") {
+		t.Errorf("expected the secret value in the executor environment")
+	}
+}
+
+func TestParseSecretArgs_Invalid(t *testing.T) {
+	os.Setenv("KANIKO_TEST_NPM_TOKEN", "s3cr3t")
+	defer os.Unsetenv("KANIKO_TEST_NPM_TOKEN")
+
+	for _, value := range []string{"NPM_TOKEN", "NPM-TOKEN=KANIKO_TEST_NPM_TOKEN", "NPM_TOKEN=KANIKO_TEST_UNSET_SECRET", "VERSION=KANIKO_TEST_NPM_TOKEN"} {
+		if _, _, err := parseSecretArgs([]string{value}, []string{"VERSION=1.0"}); err == nil {
+			t.Errorf("expected error for secret arg %q", value)
+		}
+	}
+}
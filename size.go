@@ -0,0 +1,95 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/drone/drone-kaniko/pkg/image"
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/drone/drone-kaniko/pkg/units"
+)
+
+// sizeLimits returns the compressed and uncompressed image size budgets in
+// bytes, zero when unset.
+func (b Build) sizeLimits() (int64, int64, error) {
+	var limits [2]int64
+	for i, value := range []string{b.MaxImageSize, b.MaxUncompressedImageSize} {
+		if value == "" {
+			continue
+		}
+		limit, err := units.ParseSize(value)
+		if err != nil {
+			return 0, 0, err
+		}
+		limits[i] = limit
+	}
+	return limits[0], limits[1], nil
+}
+
+// inspectImage inspects the built image, from the tarball when one was
+// written, otherwise from the pushed manifest.
+func (p Plugin) inspectImage(ctx context.Context) (image.Image, error) {
+	if p.Build.TarPath != "" {
+		return image.FromTarball(p.Build.TarPath)
+	}
+	if p.Build.NoPush {
+		return image.Image{}, fmt.Errorf("the image can only be inspected when pushed or saved to a tarball")
+	}
+
+	digest := strings.TrimSpace(getDigest(p.Build.DigestFile))
+	if digest == "" {
+		return image.Image{}, fmt.Errorf("the digest of the pushed image is unknown")
+	}
+	ref, err := registry.ParseReference(fmt.Sprintf("%s@%s", p.Build.Repo, digest))
+	if err != nil {
+		return image.Image{}, err
+	}
+	client := p.Build.registryClient()
+	return image.FromRegistry(ctx, client, ref)
+}
+
+// checkImageSize reports the layer sizes of the image and fails when the
+// image exceeds a size budget.
+func checkImageSize(img image.Image, maxSize, maxUncompressedSize int64) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LAYER\tSIZE\tUNCOMPRESSED\tCOMMAND")
+	for i, layer := range img.Layers {
+		uncompressed := "-"
+		if layer.UncompressedSize >= 0 {
+			uncompressed = units.FormatSize(layer.UncompressedSize)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, units.FormatSize(layer.Size), uncompressed, truncate(layer.Command, 80))
+	}
+	w.Flush()
+
+	size := img.Size()
+	uncompressedSize, known := img.UncompressedSize()
+	if known {
+		fmt.Fprintf(os.Stdout, "Image size: %s (%s uncompressed)\n", units.FormatSize(size), units.FormatSize(uncompressedSize))
+	} else {
+		fmt.Fprintf(os.Stdout, "Image size: %s\n", units.FormatSize(size))
+	}
+
+	if maxSize > 0 && size > maxSize {
+		return fmt.Errorf("image size %s exceeds the budget of %s", units.FormatSize(size), units.FormatSize(maxSize))
+	}
+	if maxUncompressedSize > 0 {
+		if !known {
+			fmt.Fprintln(os.Stderr, "warning: uncompressed size is only known for images saved to a tarball, skipping the uncompressed budget")
+		} else if uncompressedSize > maxUncompressedSize {
+			return fmt.Errorf("uncompressed image size %s exceeds the budget of %s", units.FormatSize(uncompressedSize), units.FormatSize(maxUncompressedSize))
+		}
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -0,0 +1,34 @@
+package kaniko
+
+import (
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/image"
+)
+
+func TestCheckImageSize(t *testing.T) {
+	img := image.Image{Layers: []image.Layer{
+		{Size: 300, UncompressedSize: 800, Command: "RUN apt-get install -y build-essential"},
+		{Size: 200, UncompressedSize: 400, Command: "COPY . /src"},
+	}}
+
+	tests := []struct {
+		name                string
+		maxSize             int64
+		maxUncompressedSize int64
+		err                 bool
+	}{
+		{name: "no_budget"},
+		{name: "within_budget", maxSize: 500, maxUncompressedSize: 1200},
+		{name: "compressed_exceeded", maxSize: 499, err: true},
+		{name: "uncompressed_exceeded", maxUncompressedSize: 1199, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImageSize(img, tt.maxSize, tt.maxUncompressedSize)
+			if (err != nil) != tt.err {
+				t.Errorf("checkImageSize() error = %v", err)
+			}
+		})
+	}
+}
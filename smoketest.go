@@ -0,0 +1,89 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/registry"
+	"github.com/drone/drone-kaniko/pkg/smoketest"
+	"github.com/pkg/errors"
+)
+
+// defaultTestTimeout bounds the smoke test when no timeout is set.
+const defaultTestTimeout = 5 * time.Minute
+
+// testsImage returns true when the image is tested before it is pushed, in
+// which case it is saved to a tarball and pushed by the plugin.
+func (b Build) testsImage() bool {
+	return b.TestCommand != "" || len(b.StructureTestConfigs) > 0
+}
+
+// testTarball returns the tarball the image is saved to for testing, and a
+// function removing it when the plugin created it.
+func (b Build) testTarball() (string, func(), error) {
+	if b.TarPath != "" {
+		return b.TarPath, func() {}, nil
+	}
+	dir, err := ioutil.TempDir(b.kanikoDir(), "test-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to create test directory")
+	}
+	return filepath.Join(dir, "image.tar"), func() { os.RemoveAll(dir) }, nil
+}
+
+// smokeTest runs the test command in the image saved at tarball.
+func (b Build) smokeTest(ctx context.Context, tarball string) error {
+	args, err := smoketest.SplitArgs(b.TestCommand)
+	if err != nil {
+		return err
+	}
+
+	var runner smoketest.Runner = smoketest.ChrootRunner{Dir: b.kanikoDir()}
+	if b.TestRunner != "" {
+		runner = smoketest.CommandRunner{Command: b.TestRunner}
+	}
+	timeout := b.TestTimeout
+	if timeout <= 0 {
+		timeout = defaultTestTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fmt.Fprintf(os.Stdout, "Running smoke test: %s\n", b.TestCommand)
+	if err := runner.Run(ctx, tarball, args); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("smoke test timed out after %s, not pushing the image", timeout)
+		}
+		return errors.Wrap(err, "smoke test failed, not pushing the image")
+	}
+	return nil
+}
+
+// pushTarball pushes the tested image to each tag and writes its digest.
+func (b Build) pushTarball(ctx context.Context, tarball string, tags []string) error {
+	var refs []registry.Reference
+	for _, tag := range tags {
+		ref, err := registry.ParseReference(fmt.Sprintf("%s:%s", b.Repo, tag))
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+	}
+
+	client := b.registryClient()
+	digest, err := client.PushTarball(ctx, tarball, refs)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Pushed %s:%v with digest %s\n", b.Repo, tags, digest)
+	if b.DigestFile != "" {
+		if err := ioutil.WriteFile(b.DigestFile, []byte(digest), 0644); err != nil {
+			return errors.Wrap(err, "failed to write digest file")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package kaniko
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBuild_smokeTest(t *testing.T) {
+	tests := []struct {
+		name   string
+		runner string
+		err    bool
+	}{
+		{name: "passes", runner: `test "$TEST_COMMAND" = "--version" && test "$IMAGE_TARBALL" = image.tar`},
+		{name: "fails", runner: "exit 1", err: true},
+		{name: "times_out", runner: "sleep 5", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Build{TestCommand: "--version", TestRunner: tt.runner, TestTimeout: 500 * time.Millisecond}
+			if err := b.smokeTest(context.Background(), "image.tar"); (err != nil) != tt.err {
+				t.Errorf("smokeTest() error = %v", err)
+			}
+		})
+	}
+}
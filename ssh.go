@@ -0,0 +1,64 @@
+package kaniko
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// stageSSH writes the ssh key and known hosts to dir, which must be in the
+// kaniko directory so it is never snapshotted into the image. It returns the
+// build args exposing them, together with a function removing the staged files.
+func (b Build) stageSSH(dir string) ([]string, func(), error) {
+	var args []string
+	cleanup := func() {}
+
+	if b.SSHAgentSock != "" {
+		if _, err := os.Stat(b.SSHAgentSock); err != nil {
+			return nil, nil, errors.Wrap(err, "ssh agent socket")
+		}
+		args = append(args, "SSH_AUTH_SOCK="+b.SSHAgentSock)
+	}
+	if b.SSHKey == "" && b.SSHKnownHosts == "" {
+		return args, cleanup, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create ssh directory")
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	command := []string{"ssh"}
+	if b.SSHKey != "" {
+		key := filepath.Join(dir, "id_key")
+		if err := ioutil.WriteFile(key, []byte(withNewline(b.SSHKey)), 0600); err != nil {
+			cleanup()
+			return nil, nil, errors.Wrap(err, "failed to write ssh key")
+		}
+		command = append(command, "-i", key, "-o", "IdentitiesOnly=yes")
+	}
+	if b.SSHKnownHosts != "" {
+		knownHosts := filepath.Join(dir, "known_hosts")
+		if err := ioutil.WriteFile(knownHosts, []byte(withNewline(b.SSHKnownHosts)), 0644); err != nil {
+			cleanup()
+			return nil, nil, errors.Wrap(err, "failed to write ssh known hosts")
+		}
+		command = append(command, "-o", "UserKnownHostsFile="+knownHosts, "-o", "StrictHostKeyChecking=yes")
+	} else {
+		fmt.Fprintln(os.Stderr, "warning: no ssh known hosts provided, host keys are accepted on first use")
+		command = append(command, "-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=accept-new")
+	}
+	args = append(args, "GIT_SSH_COMMAND="+strings.Join(command, " "))
+	return args, cleanup, nil
+}
+
+func withNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
@@ -0,0 +1,107 @@
+package kaniko
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/drone/drone-kaniko/pkg/output"
+	"github.com/pkg/errors"
+)
+
+const (
+	// structureTestBinary is the container-structure-test executable.
+	structureTestBinary = "container-structure-test"
+	// defaultStructureTestReport is the report file name used next to the
+	// artifact file.
+	defaultStructureTestReport = "structure-test-report.json"
+)
+
+// structureTestResult is the summary of a container-structure-test json report.
+type structureTestResult struct {
+	Pass  int `json:"Pass"`
+	Fail  int `json:"Fail"`
+	Total int `json:"Total"`
+}
+
+// structureTest runs the container-structure-test configs against the image
+// saved at tarball and records the results in the report and output files.
+func (p Plugin) structureTest(ctx context.Context, tarball string) error {
+	// a custom runner may run the tests elsewhere
+	binary := structureTestBinary
+	if p.Runner == nil {
+		path, err := exec.LookPath(structureTestBinary)
+		if err != nil {
+			return fmt.Errorf("%s is required to run structure tests: %s", structureTestBinary, err)
+		}
+		binary = path
+	}
+
+	report := p.Build.StructureTestReport
+	if report == "" {
+		if p.Artifact.ArtifactFile != "" {
+			report = filepath.Join(filepath.Dir(p.Artifact.ArtifactFile), defaultStructureTestReport)
+		} else {
+			dir, err := ioutil.TempDir("", "structure-test-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(dir)
+			report = filepath.Join(dir, defaultStructureTestReport)
+		}
+	}
+
+	args := []string{"test", "--driver=tar", "--image=" + tarball, "--output=json", "--test-report=" + report}
+	for _, config := range p.Build.StructureTestConfigs {
+		args = append(args, "--config="+config)
+	}
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	trace(cmd)
+	runErr := p.runner().Run(ctx, cmd)
+
+	result, err := readStructureTestReport(report)
+	if err != nil {
+		if runErr != nil {
+			return errors.Wrap(runErr, "structure tests failed")
+		}
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Structure tests: %d passed, %d failed\n", result.Pass, result.Fail)
+
+	if p.Output.OutputFile != "" {
+		values := map[string]string{
+			"structure_test_passed": strconv.Itoa(result.Pass),
+			"structure_test_failed": strconv.Itoa(result.Fail),
+		}
+		if p.Build.StructureTestReport != "" || p.Artifact.ArtifactFile != "" {
+			values["structure_test_report"] = report
+		}
+		if err := output.WritePluginOutputValues(p.Output.OutputFile, values); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write plugin output file at path: %s with error: %s\n", p.Output.OutputFile, err)
+		}
+	}
+
+	if runErr != nil || result.Fail > 0 {
+		return fmt.Errorf("%d of %d structure tests failed, not pushing the image", result.Fail, result.Total)
+	}
+	return nil
+}
+
+func readStructureTestReport(path string) (structureTestResult, error) {
+	var result structureTestResult
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return result, errors.Wrap(err, "failed to read structure test report")
+	}
+	if err := json.Unmarshal(content, &result); err != nil {
+		return result, errors.Wrap(err, "failed to decode structure test report")
+	}
+	return result, nil
+}
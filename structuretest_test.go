@@ -0,0 +1,23 @@
+package kaniko
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadStructureTestReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), defaultStructureTestReport)
+	report := `{"Pass": 4, "Fail": 1, "Total": 5, "Duration": 1200, "Results": [{"Name": "python version", "Pass": false}]}`
+	if err := ioutil.WriteFile(path, []byte(report), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readStructureTestReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (structureTestResult{Pass: 4, Fail: 1, Total: 5}); got != want {
+		t.Errorf("readStructureTestReport() = %+v, want %+v", got, want)
+	}
+}
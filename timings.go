@@ -0,0 +1,55 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/buildlog"
+	"github.com/drone/drone-kaniko/pkg/metrics"
+)
+
+// timingMetrics returns the duration of the build, of each stage and of
+// each instruction, tagged with the repository.
+func (b Build) timingMetrics(s buildlog.Summary) []metrics.Metric {
+	seconds := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+	list := []metrics.Metric{
+		metrics.Timing("build.duration", seconds(s.Seconds), map[string]string{"repo": b.Repo}),
+	}
+	for _, stage := range s.Stages {
+		index := strconv.Itoa(stage.Index)
+		list = append(list, metrics.Timing("stage.duration", seconds(stage.Seconds), map[string]string{
+			"repo":  b.Repo,
+			"stage": index,
+			"base":  stage.Base,
+		}))
+		for i, inst := range stage.Instructions {
+			list = append(list, metrics.Timing("instruction.duration", seconds(inst.Seconds), map[string]string{
+				"repo":        b.Repo,
+				"stage":       index,
+				"instruction": strings.ToUpper(strings.Fields(inst.Command)[0]),
+				"index":       strconv.Itoa(i),
+			}))
+		}
+	}
+	return list
+}
+
+// exportTimings writes the stage and instruction timings to the timing
+// file and sends them to the StatsD agent. Failures are only reported, the
+// timings are informational.
+func (b Build) exportTimings(s buildlog.Summary) {
+	if b.TimingFile != "" {
+		if err := buildlog.WriteTimings(b.TimingFile, s); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write timings at path: %s with error: %s\n", b.TimingFile, err)
+		}
+	}
+	if b.StatsdAddress != "" {
+		statsd := metrics.StatsD{Addr: b.StatsdAddress, Prefix: b.StatsdPrefix}
+		if err := statsd.Send(b.timingMetrics(s)); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to send timings: %s\n", err)
+		}
+	}
+}
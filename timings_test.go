@@ -0,0 +1,33 @@
+package kaniko
+
+import (
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/buildlog"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuild_timingMetrics(t *testing.T) {
+	b := Build{Repo: "registry/app"}
+	s := buildlog.Summary{
+		Seconds: 30,
+		Stages: []buildlog.Stage{{
+			Index:        0,
+			Base:         "golang:1.22",
+			Seconds:      20,
+			Instructions: []buildlog.Instruction{{Command: "run go build", Seconds: 16}},
+		}},
+	}
+	var got []string
+	for _, m := range b.timingMetrics(s) {
+		got = append(got, m.Format("kaniko"))
+	}
+	want := []string{
+		"kaniko.build.duration:30000|ms|#repo:registry/app",
+		"kaniko.stage.duration:20000|ms|#base:golang:1.22,repo:registry/app,stage:0",
+		"kaniko.instruction.duration:16000|ms|#index:0,instruction:RUN,repo:registry/app,stage:0",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("metrics mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,85 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-kaniko/pkg/state"
+)
+
+// checkOutputBucket validates the output bucket is an S3 or GCS bucket.
+func (o Output) checkOutputBucket() error {
+	if o.Bucket == "" {
+		return nil
+	}
+	if !strings.HasPrefix(o.Bucket, "s3://") && !strings.HasPrefix(o.Bucket, "gs://") {
+		return fmt.Errorf("invalid output bucket %q, expected s3://bucket or gs://bucket", o.Bucket)
+	}
+	_, err := state.Open(o.Bucket)
+	return err
+}
+
+// outputFiles returns the files the build writes: the image tarball and
+// the reports, summaries and bundles that are configured.
+func (p Plugin) outputFiles() []string {
+	var files []string
+	for _, file := range []string{
+		p.Build.TarPath,
+		p.Build.DigestFile,
+		p.Build.AttestationFile,
+		p.Build.LayerReportFile,
+		p.buildSummaryFile(),
+		p.Build.TimingFile,
+		p.Build.ErrorSummaryFile,
+		p.Build.DiagnosticsPath,
+		p.debugSnapshotFile(),
+		p.Artifact.ArtifactFile,
+		p.Output.OutputFile,
+	} {
+		if file != "" && !contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// uploadOutputs uploads the output files the build wrote to the output
+// bucket, under the prefix, so they survive ephemeral runners. Failures
+// are only reported.
+func (p Plugin) uploadOutputs(ctx context.Context) {
+	store, err := state.Open(p.Output.Bucket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open the output bucket: %s\n", err)
+		return
+	}
+	p.uploadFiles(ctx, store)
+}
+
+// uploadFiles uploads the output files that exist to the store.
+func (p Plugin) uploadFiles(ctx context.Context, store state.Store) {
+	for _, file := range p.outputFiles() {
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		key := path.Join(p.Output.Prefix, filepath.Base(file))
+		if err := uploadFile(ctx, store, key, file); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to upload %s to the output bucket: %s\n", file, err)
+			continue
+		}
+		fmt.Fprintf(os.Stdout, "Uploaded %s to %s\n", file, strings.TrimSuffix(p.Output.Bucket, "/")+"/"+key)
+	}
+}
+
+func uploadFile(ctx context.Context, store state.Store, key, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return store.Put(ctx, key, f)
+}
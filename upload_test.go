@@ -0,0 +1,58 @@
+package kaniko
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-kaniko/pkg/state"
+)
+
+func TestOutput_checkOutputBucket(t *testing.T) {
+	for bucket, valid := range map[string]bool{
+		"":                  true,
+		"s3://bucket/path":  true,
+		"gs://bucket":       true,
+		"/mnt/outputs":      false,
+		"azure://container": false,
+		"s3://":             false,
+	} {
+		err := Output{Bucket: bucket}.checkOutputBucket()
+		if valid && err != nil {
+			t.Errorf("%q: unexpected error %s", bucket, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("%q: expected an error", bucket)
+		}
+	}
+}
+
+func TestPlugin_uploadFiles(t *testing.T) {
+	dir := t.TempDir()
+	p := Plugin{
+		Build: Build{
+			TarPath:         filepath.Join(dir, "image.tar"),
+			LayerReportFile: filepath.Join(dir, "layers.json"),
+			DiagnosticsPath: filepath.Join(dir, "missing.tar.gz"),
+		},
+		Artifact: Artifact{ArtifactFile: filepath.Join(dir, "artifact.json")},
+		Output:   Output{Prefix: "app/42"},
+	}
+	for _, file := range []string{p.Build.TarPath, p.Build.LayerReportFile, p.Artifact.ArtifactFile} {
+		if err := ioutil.WriteFile(file, []byte(filepath.Base(file)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bucket := state.Dir(t.TempDir())
+	p.uploadFiles(context.Background(), bucket)
+	for _, name := range []string{"image.tar", "layers.json", "artifact.json"} {
+		if data, err := bucket.Get(context.Background(), "app/42/"+name); err != nil || string(data) != name {
+			t.Errorf("expected %s uploaded, got %q, %v", name, data, err)
+		}
+	}
+	if _, err := bucket.Get(context.Background(), "app/42/missing.tar.gz"); err != state.ErrNotFound {
+		t.Errorf("expected missing files skipped, got %v", err)
+	}
+}
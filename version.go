@@ -0,0 +1,54 @@
+package kaniko
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/drone/drone-kaniko/pkg/buildinfo"
+)
+
+// Labels recording the plugin and executor building the image, set with the
+// auto labels.
+const (
+	labelPluginVersion   = "io.drone.kaniko.plugin-version"
+	labelPluginCommit    = "io.drone.kaniko.plugin-commit"
+	labelExecutorVersion = "io.drone.kaniko.executor-version"
+)
+
+// updateCheckTimeout bounds the lookup of the latest plugin release.
+const updateCheckTimeout = 5 * time.Second
+
+// latestReleaseURL is the endpoint the latest plugin release is read from.
+var latestReleaseURL = buildinfo.LatestReleaseURL
+
+// checkUpdates warns when a newer plugin release exists. Failures to look up
+// the latest release do not fail the build.
+func checkUpdates(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+	defer cancel()
+	latest, err := buildinfo.Latest(ctx, http.DefaultClient, latestReleaseURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to check for plugin updates: %s\n", err)
+		return
+	}
+	if current, _ := buildinfo.Plugin(); buildinfo.Newer(current, latest) {
+		fmt.Fprintf(os.Stderr, "warning: plugin version %s is outdated, the latest release is %s\n", current, latest)
+	}
+}
+
+// versionLabels returns the labels recording the plugin and executor
+// versions, leaving out those that are unknown.
+func (b Build) versionLabels() [][2]string {
+	version, commit := buildinfo.Plugin()
+	if version == "unknown" {
+		version = ""
+	}
+	return [][2]string{
+		{labelPluginVersion, version},
+		{labelPluginCommit, commit},
+		{labelExecutorVersion, b.executorVersion},
+	}
+}
@@ -0,0 +1,54 @@
+package kaniko
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/drone/drone-kaniko/pkg/buildinfo"
+)
+
+func TestBuild_versionLabels(t *testing.T) {
+	defer func(v, c string) { buildinfo.Version, buildinfo.Commit = v, c }(buildinfo.Version, buildinfo.Commit)
+	buildinfo.Version, buildinfo.Commit = "v1.2.3", "abc123"
+
+	b := Build{AutoLabels: true, DroneCommitSha: "def456", executorVersion: "v1.23.2"}
+	want := []string{
+		"org.label-schema.schema-version=1.0",
+		"org.label-schema.vcs-ref=def456",
+		labelPluginVersion + "=v1.2.3",
+		labelPluginCommit + "=abc123",
+		labelExecutorVersion + "=v1.23.2",
+	}
+	if diff := cmp.Diff(want, b.autoLabels()); diff != "" {
+		t.Errorf("unexpected labels (-want +got):\n%s", diff)
+	}
+
+	a := Plugin{Build: b}.artifact(nil, nil)
+	if a.Build.PluginVersion != "v1.2.3" || a.Build.PluginCommit != "abc123" || a.Build.ExecutorVersion != "v1.23.2" {
+		t.Errorf("unexpected artifact build metadata %+v", a.Build)
+	}
+}
+
+func TestCheckUpdates(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"tag_name": "v9.9.9"}`))
+	}))
+	defer server.Close()
+	defer func(url string) { latestReleaseURL = url }(latestReleaseURL)
+	latestReleaseURL = server.URL
+
+	b := testBuild(t)
+	b.CheckUpdates = true
+	if err := New(b, WithRunner(&fakeRunner{})).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Errorf("expected the latest release looked up once, got %d requests", requests)
+	}
+}
@@ -0,0 +1,68 @@
+package kaniko
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// volume is a directory of the runner exposed to the RUN instructions.
+type volume struct {
+	src string // Directory mounted into the plugin container
+	dst string // Path the RUN instructions see it at
+}
+
+// parseVolumes parses src:dst volumes, where a single path is exposed at the
+// same path.
+func parseVolumes(values []string) ([]volume, error) {
+	var volumes []volume
+	for _, value := range values {
+		src, dst, ok := strings.Cut(value, ":")
+		if !ok {
+			dst = src
+		}
+		if !filepath.IsAbs(src) || !filepath.IsAbs(dst) {
+			return nil, fmt.Errorf("invalid volume %q, expected absolute src:dst paths", value)
+		}
+		volumes = append(volumes, volume{src: filepath.Clean(src), dst: filepath.Clean(dst)})
+	}
+	return volumes, nil
+}
+
+// stageVolumes links the destination of each volume to its source, as RUN
+// instructions of the kaniko executor run in the filesystem of the plugin
+// container. The links are removed by the returned cleanup.
+func stageVolumes(volumes []volume) (func(), error) {
+	var links []string
+	cleanup := func() {
+		for _, link := range links {
+			os.Remove(link)
+		}
+	}
+	for _, v := range volumes {
+		if _, err := os.Stat(v.src); err != nil {
+			cleanup()
+			return nil, errors.Wrapf(err, "volume source %s is not mounted", v.src)
+		}
+		if v.src == v.dst {
+			continue
+		}
+		if _, err := os.Lstat(v.dst); err == nil {
+			cleanup()
+			return nil, fmt.Errorf("volume destination %s already exists", v.dst)
+		}
+		if err := os.MkdirAll(filepath.Dir(v.dst), 0755); err != nil {
+			cleanup()
+			return nil, errors.Wrapf(err, "failed to create the parent of volume destination %s", v.dst)
+		}
+		if err := os.Symlink(v.src, v.dst); err != nil {
+			cleanup()
+			return nil, errors.Wrapf(err, "failed to link volume %s to %s", v.src, v.dst)
+		}
+		links = append(links, v.dst)
+	}
+	return cleanup, nil
+}
@@ -0,0 +1,86 @@
+package kaniko
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseVolumes(t *testing.T) {
+	volumes, err := parseVolumes([]string{"/data/models:/models", "/opt/toolchain/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []volume{{src: "/data/models", dst: "/models"}, {src: "/opt/toolchain", dst: "/opt/toolchain"}}
+	if diff := cmp.Diff(want, volumes, cmp.AllowUnexported(volume{})); diff != "" {
+		t.Errorf("volumes mismatch (-want +got):\n%s", diff)
+	}
+	for _, value := range []string{"data:/data", "/data:data"} {
+		if _, err := parseVolumes([]string{value}); err == nil {
+			t.Errorf("expected error for volume %q", value)
+		}
+	}
+}
+
+func TestStageVolumes(t *testing.T) {
+	src := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(src, "weights.bin"), []byte("weights"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(t.TempDir(), "opt", "models")
+	cleanup, err := stageVolumes([]volume{{src: src, dst: dst}, {src: src, dst: src}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dst, "weights.bin")); err != nil || string(content) != "weights" {
+		t.Errorf("expected the volume exposed at the destination, got %q: %v", content, err)
+	}
+	cleanup()
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected the link removed, got %v", err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("expected the source kept: %v", err)
+	}
+
+	if _, err := stageVolumes([]volume{{src: filepath.Join(src, "missing"), dst: dst}}); err == nil {
+		t.Error("expected error for a missing source")
+	}
+	if _, err := stageVolumes([]volume{{src: src, dst: t.TempDir()}}); err == nil {
+		t.Error("expected error for an existing destination")
+	}
+}
+
+func TestPlugin_ExecVolumes(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "data")
+	b := testBuild(t)
+	b.Volumes = []string{src + ":" + dst}
+	if err := New(b, WithRunner(&fakeRunner{})).Exec(context.Background()); err == nil {
+		t.Error("expected error for volumes with a remote kaniko executor")
+	}
+	args := Plugin{Build: b}.kanikoArgs(buildInput{context: b.Context, volumes: []volume{{src: src, dst: dst}}})
+	for _, want := range []string{"--ignore-path=" + dst, "--ignore-path=" + src} {
+		if !contains(args, want) {
+			t.Errorf("expected %s in %v", want, args)
+		}
+	}
+
+	b.Builder = BuilderBuildah
+	runner := &fakeRunner{}
+	if err := New(b, WithRunner(runner)).Exec(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := "--volume=" + src + ":" + dst; !contains(runner.cmds[0].Args, want) {
+		t.Errorf("expected %s in %v", want, runner.cmds[0].Args)
+	}
+
+	b.Builder = BuilderBuildKit
+	if err := New(b, WithRunner(&fakeRunner{})).Exec(context.Background()); err == nil {
+		t.Error("expected error for volumes with buildkit")
+	}
+}